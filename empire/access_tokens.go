@@ -1,50 +1,448 @@
 package empire
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// Scopes that can be granted to an AccessToken.
+const (
+	ScopeAppsRead     = "apps:read"
+	ScopeAppsWrite    = "apps:write"
+	ScopeConfigsRead  = "configs:read"
+	ScopeConfigsWrite = "configs:write"
+	ScopeDeploysWrite = "deploys:write"
+
+	// ScopeAdmin grants access to administrative operations, like listing
+	// every access token.
+	ScopeAdmin = "admin"
+)
+
+// AllScopes is the set of all known scopes.
+var AllScopes = []string{
+	ScopeAppsRead,
+	ScopeAppsWrite,
+	ScopeConfigsRead,
+	ScopeConfigsWrite,
+	ScopeDeploysWrite,
+}
+
+// AdminScopes are scopes that are only granted when explicitly requested.
+// Unlike AllScopes, they're not granted to tokens without a scopes claim.
+var AdminScopes = []string{
+	ScopeAdmin,
+}
+
+// accessTokenTouchInterval is how often the time that a token was last used
+// is updated, so that a token that's used for every request doesn't update its
+// record on every request.
+const accessTokenTouchInterval = time.Minute
+
+var (
+	// ErrNoScopes is returned when creating an AccessToken without any
+	// scopes.
+	ErrNoScopes = &ValidationError{errors.New("An access token requires at least one scope.")}
+
+	// ErrInsufficientScope is returned when the AccessToken in the
+	// context does not grant the scope required by an operation.
+	ErrInsufficientScope = errors.New("access token has insufficient scope")
+
+	// ErrTokenInvalid is returned when finding an AccessToken that's
+	// malformed, wasn't signed by Empire, or wasn't recorded. The same error
+	// is returned in each case, so that the reason isn't leaked.
+	ErrTokenInvalid = errors.New("access token is invalid")
 )
 
 // AccessToken represents a token that allow access to the api.
 type AccessToken struct {
+	// A unique identifier for the token, which is included in its claims.
+	// Tokens issued before tokens were recorded don't have one.
+	ID string
+
 	Token string
 	User  *User
+
+	// The scopes that this token grants.
+	Scopes []string
+
+	// When the token was created, and when it was last used to
+	// authenticate. Only set on recorded tokens.
+	CreatedAt  *time.Time
+	LastUsedAt *time.Time
+
+	// When the token expires, which is included in its claims. Tokens
+	// without one never expire.
+	ExpiresAt *time.Time
+
+	// Identifies the secret that the token was signed with. See
+	// accessTokenSecretHash.
+	secretHash string
+}
+
+// accessTokenRecord is the record of an issued AccessToken that's stored in
+// the database. The signed token is never stored, only a hash that identifies
+// the secret it was signed with, so that it can be re-signed when the secret is
+// rotated.
+type accessTokenRecord struct {
+	ID         string
+	UserName   string
+	Scopes     string
+	SecretHash string
+	CreatedAt  *time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+}
+
+// TableName implements the gorm tabler interface.
+func (accessTokenRecord) TableName() string {
+	return "access_tokens"
+}
+
+// newAccessTokenRecord returns the record for the token. Scopes never contain
+// spaces, so they're stored space separated.
+func newAccessTokenRecord(token *AccessToken) *accessTokenRecord {
+	return &accessTokenRecord{
+		ID:         token.ID,
+		UserName:   token.User.Name,
+		Scopes:     strings.Join(token.Scopes, " "),
+		SecretHash: token.secretHash,
+		ExpiresAt:  token.ExpiresAt,
+	}
+}
+
+// accessToken returns the AccessToken for the record, without the signed
+// token.
+func (r *accessTokenRecord) accessToken() *AccessToken {
+	var scopes []string
+	if r.Scopes != "" {
+		scopes = strings.Split(r.Scopes, " ")
+	}
+
+	return &AccessToken{
+		ID:         r.ID,
+		User:       &User{Name: r.UserName},
+		Scopes:     scopes,
+		CreatedAt:  r.CreatedAt,
+		LastUsedAt: r.LastUsedAt,
+		ExpiresAt:  r.ExpiresAt,
+		secretHash: r.SecretHash,
+	}
+}
+
+// AccessTokensCreate records the issued token.
+func (s *store) AccessTokensCreate(token *AccessToken) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	r := newAccessTokenRecord(token)
+	now := timex.Now()
+	r.CreatedAt = &now
+
+	if err := s.db.Create(r).Error; err != nil {
+		return err
+	}
+
+	token.CreatedAt = r.CreatedAt
+	return nil
+}
+
+// AccessTokensTouch sets the time that the token was last used to now. The
+// record is only updated if it wasn't already used within
+// accessTokenTouchInterval.
+func (s *store) AccessTokensTouch(token *AccessToken) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	now := timex.Now()
+	db := s.db.Model(&accessTokenRecord{}).Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", token.ID, now.Add(-accessTokenTouchInterval)).UpdateColumn("last_used_at", &now)
+	if err := db.Error; err != nil {
+		return err
+	}
+
+	if db.RowsAffected > 0 {
+		token.LastUsedAt = &now
+	}
+	return nil
+}
+
+// AccessTokensUpdateSecretHash stores the hash of the secret that the token
+// was signed with, after it was re-signed with a new secret.
+func (s *store) AccessTokensUpdateSecretHash(token *AccessToken) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	return s.db.Model(&accessTokenRecord{}).Where("id = ?", token.ID).UpdateColumn("secret_hash", token.secretHash).Error
+}
+
+// AccessTokensResign calls resign with each recorded token, within a single
+// transaction, and stores the hash of the secret for tokens that resign
+// returns true for. It returns the number of tokens that were re-signed.
+func (s *store) AccessTokensResign(resign func(*AccessToken) (bool, error)) (int, error) {
+	if err := s.writable(); err != nil {
+		return 0, err
+	}
+
+	t := s.db.Begin()
+
+	var records []*accessTokenRecord
+	if err := t.Find(&records).Error; err != nil {
+		t.Rollback()
+		return 0, err
+	}
+
+	var n int
+	for _, r := range records {
+		token := r.accessToken()
+
+		ok, err := resign(token)
+		if err != nil {
+			t.Rollback()
+			return 0, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := t.Model(r).UpdateColumn("secret_hash", token.secretHash).Error; err != nil {
+			t.Rollback()
+			return 0, err
+		}
+		n++
+	}
+
+	return n, t.Commit().Error
+}
+
+// AccessTokensFirst returns the recorded token with the given id.
+func (s *store) AccessTokensFirst(id string) (*AccessToken, error) {
+	var r accessTokenRecord
+	if err := s.First(ID(id), &r); err != nil {
+		return nil, err
+	}
+
+	return r.accessToken(), nil
+}
+
+// AccessTokens returns the recorded tokens, newest first.
+func (s *store) AccessTokens(page Page) ([]*AccessToken, error) {
+	var records []*accessTokenRecord
+	if err := s.Find(ComposedScope{Order("created_at desc"), page}, &records); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*AccessToken, 0, len(records))
+	for _, r := range records {
+		tokens = append(tokens, r.accessToken())
+	}
+
+	return tokens, nil
 }
 
 type accessTokensService struct {
 	Secret []byte // Secret used to sign jwt tokens.
+
+	// Previous secrets that tokens may still be signed with. Tokens signed
+	// with one of these secrets are still valid, which allows Secret to be
+	// rotated without invalidating existing tokens.
+	SecondarySecrets [][]byte
 }
 
 // AccessTokensCreate "creates" the token by jwt signing it and setting the
 // Token value.
 func (s *accessTokensService) AccessTokensCreate(token *AccessToken) (*AccessToken, error) {
+	if err := validateScopes(token.Scopes); err != nil {
+		return token, err
+	}
+
 	signed, err := SignToken(s.Secret, token)
 	if err != nil {
 		return token, err
 	}
 
 	token.Token = signed
+	if token.ID != "" {
+		token.secretHash = accessTokenSecretHash(s.Secret, token.ID)
+	}
 
 	return token, nil
 }
 
+// AccessTokensFind verifies the signature of the token, then parses it. If the
+// token was signed with one of the secondary secrets, the returned AccessToken
+// will have been re-signed with the primary secret. ErrTokenInvalid is returned
+// if the token isn't signed with any of the secrets.
 func (s *accessTokensService) AccessTokensFind(token string) (*AccessToken, error) {
-	at, err := ParseToken(s.Secret, token)
+	secrets := append([][]byte{s.Secret}, s.SecondarySecrets...)
+
+	for i, secret := range secrets {
+		if !verifyTokenSignature(secret, token) {
+			continue
+		}
+
+		at, err := ParseToken(secret, token)
+		if err != nil {
+			if _, ok := err.(*jwt.ValidationError); ok {
+				err = ErrTokenInvalid
+			}
+			return nil, err
+		}
+
+		if at == nil {
+			return nil, ErrTokenInvalid
+		}
+
+		at.Token = token
+
+		if i > 0 {
+			return s.AccessTokensCreate(at)
+		}
+
+		return at, nil
+	}
+
+	return nil, ErrTokenInvalid
+}
+
+// AccessTokensResign re-signs a recorded token that was signed with oldSecret
+// with newSecret. The token is rebuilt from its record, so claims that aren't
+// recorded, like the GitHub token, aren't included. It returns false for tokens
+// that weren't signed with oldSecret, or that have expired.
+func (s *accessTokensService) AccessTokensResign(oldSecret, newSecret []byte, token *AccessToken) (bool, error) {
+	if token.ID == "" || subtle.ConstantTimeCompare([]byte(token.secretHash), []byte(accessTokenSecretHash(oldSecret, token.ID))) != 1 {
+		return false, nil
+	}
+
+	if token.ExpiresAt != nil && !timex.Now().Before(*token.ExpiresAt) {
+		return false, nil
+	}
+
+	signed, err := SignToken(newSecret, token)
 	if err != nil {
-		switch err.(type) {
-		case *jwt.ValidationError:
-			return nil, nil
-		default:
-			return at, err
+		return false, err
+	}
+
+	token.Token = signed
+	token.secretHash = accessTokenSecretHash(newSecret, token.ID)
+
+	return true, nil
+}
+
+// HasScope returns true if the token grants the given scope.
+func (s *accessTokensService) HasScope(token *AccessToken, scope string) bool {
+	for _, sc := range token.Scopes {
+		if sc == scope {
+			return true
 		}
 	}
+	return false
+}
 
-	if at != nil {
-		at.Token = token
+// validateScopes ensures that there is at least one scope and that every
+// scope is known.
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return ErrNoScopes
+	}
+
+	for _, scope := range scopes {
+		if !knownScope(scope) {
+			return &ValidationError{fmt.Errorf("Unknown scope: %s.", scope)}
+		}
 	}
 
-	return at, nil
+	return nil
+}
+
+func knownScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	for _, s := range AdminScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// WithAccessToken adds an AccessToken to the context.Context.
+func WithAccessToken(ctx context.Context, token *AccessToken) context.Context {
+	return context.WithValue(ctx, AccessTokenKey, token)
+}
+
+// AccessTokenFromContext returns an AccessToken from a context.Context if one
+// is present.
+func AccessTokenFromContext(ctx context.Context) (*AccessToken, bool) {
+	t, ok := ctx.Value(AccessTokenKey).(*AccessToken)
+	return t, ok
+}
+
+// accessTokenID returns the id from the claims of the token, without verifying
+// its signature. Tokens issued before tokens were recorded don't have one.
+func accessTokenID(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrTokenInvalid
+	}
+
+	raw, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return "", ErrTokenInvalid
+	}
+
+	var claims struct {
+		ID string `json:"jti"`
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return "", ErrTokenInvalid
+	}
+
+	return claims.ID, nil
+}
+
+// verifyTokenSignature returns true if the token has a valid HS256 signature
+// for the secret. The signature is compared in constant time, so that the time
+// taken doesn't reveal how much of a forged signature is correct.
+func verifyTokenSignature(secret []byte, token string) bool {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return false
+	}
+
+	sig, err := jwt.DecodeSegment(token[i+1:])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token[:i]))
+	return subtle.ConstantTimeCompare(sig, mac.Sum(nil)) == 1
+}
+
+// accessTokenSecretHash returns a hex encoded HMAC of the token id with the
+// secret. It's recorded in place of the signed token, to identify the secret
+// that the token was signed with without being able to authenticate with it.
+func accessTokenSecretHash(secret []byte, id string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 // SignToken jwt signs the token and adds the signature to the Token field.
@@ -78,6 +476,15 @@ func accessTokenToJwt(token *AccessToken) *jwt.Token {
 		Name:        token.User.Name,
 		GitHubToken: token.User.GitHubToken,
 	}
+	t.Claims["Scopes"] = token.Scopes
+
+	if token.ID != "" {
+		t.Claims["jti"] = token.ID
+	}
+
+	if token.ExpiresAt != nil {
+		t.Claims["exp"] = token.ExpiresAt.Unix()
+	}
 
 	return t
 }
@@ -107,6 +514,27 @@ func jwtToAccessToken(t *jwt.Token) (*AccessToken, error) {
 		return &token, errors.New("missing user")
 	}
 
+	if id, ok := t.Claims["jti"].(string); ok {
+		token.ID = id
+	}
+
+	if exp, ok := t.Claims["exp"].(float64); ok {
+		expiresAt := time.Unix(int64(exp), 0).UTC()
+		token.ExpiresAt = &expiresAt
+	}
+
+	// Tokens issued before scopes were introduced don't have the claim, and
+	// are granted all scopes.
+	if scopes, ok := t.Claims["Scopes"].([]interface{}); ok {
+		for _, sc := range scopes {
+			if sc, ok := sc.(string); ok {
+				token.Scopes = append(token.Scopes, sc)
+			}
+		}
+	} else {
+		token.Scopes = AllScopes
+	}
+
 	return &token, nil
 }
 
@@ -1,8 +1,13 @@
 package empire
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/net/context"
 )
 
 var testSecret = []byte("secret")
@@ -11,12 +16,416 @@ func TestAccessTokensFind(t *testing.T) {
 	s := &accessTokensService{Secret: testSecret}
 
 	at, err := s.AccessTokensFind("")
+	if err != ErrTokenInvalid {
+		t.Fatalf("err => %v; want %v", err, ErrTokenInvalid)
+	}
+
+	if at != nil {
+		t.Fatal("Expected access token to be nil")
+	}
+}
+
+func TestAccessTokensFind_InvalidSignature(t *testing.T) {
+	s := &accessTokensService{Secret: testSecret}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	token, err := s.AccessTokensCreate(&AccessToken{ID: "1234", User: user, Scopes: AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := strings.LastIndex(token.Token, ".")
+	forged, err := SignToken([]byte("other"), &AccessToken{ID: "1234", User: user, Scopes: AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []string{
+		// A valid id, with the signature from another secret.
+		token.Token[:i] + forged[strings.LastIndex(forged, "."):],
+		// A valid id, without a signature.
+		token.Token[:i+1],
+		// Not a token.
+		"abcd",
+	}
+
+	for _, tt := range tests {
+		at, err := s.AccessTokensFind(tt)
+		if err != ErrTokenInvalid {
+			t.Fatalf("AccessTokensFind(%q) => %v; want %v", tt, err, ErrTokenInvalid)
+		}
+
+		if at != nil {
+			t.Fatal("Expected access token to be nil")
+		}
+	}
+}
+
+func TestAccessTokenID(t *testing.T) {
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	tests := []struct {
+		token *AccessToken
+		id    string
+	}{
+		{&AccessToken{ID: "1234", User: user}, "1234"},
+		{&AccessToken{User: user}, ""},
+	}
+
+	for _, tt := range tests {
+		// The id is extracted without verifying the signature.
+		signed, err := SignToken([]byte("other"), tt.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := accessTokenID(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if id != tt.id {
+			t.Fatalf("accessTokenID => %q; want %q", id, tt.id)
+		}
+	}
+
+	for _, token := range []string{"", "abcd", "a.b.c", "a.e30"} {
+		if _, err := accessTokenID(token); err != ErrTokenInvalid {
+			t.Fatalf("accessTokenID(%q) => %v; want %v", token, err, ErrTokenInvalid)
+		}
+	}
+}
+
+func TestEmpire_AccessTokensFind_InvalidID(t *testing.T) {
+	e := &Empire{accessTokens: &accessTokensService{Secret: testSecret}}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	// The id is rejected before the store is queried.
+	for _, id := range []string{"1234", "' OR 1=1 --"} {
+		token, err := SignToken(testSecret, &AccessToken{ID: id, User: user, Scopes: AllScopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		at, err := e.AccessTokensFind(token)
+		if err != ErrTokenInvalid {
+			t.Fatalf("AccessTokensFind(%q) => %v; want %v", id, err, ErrTokenInvalid)
+		}
+
+		if at != nil {
+			t.Fatal("Expected access token to be nil")
+		}
+	}
+}
+
+func TestAccessTokensFind_SecretRotation(t *testing.T) {
+	var (
+		oldSecret = []byte("old")
+		newSecret = []byte("new")
+	)
+
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	signed := func(secret []byte) string {
+		token, err := SignToken(secret, &AccessToken{User: user, Scopes: AllScopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	s := &accessTokensService{
+		Secret:           newSecret,
+		SecondarySecrets: [][]byte{oldSecret},
+	}
+
+	// Signed with the primary secret.
+	at, err := s.AccessTokensFind(signed(newSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := at.User, user; !reflect.DeepEqual(got, want) {
+		t.Fatalf("User => %v; want %v", got, want)
+	}
+
+	// Signed with a secondary secret, should be re-signed with the
+	// primary.
+	at, err = s.AccessTokensFind(signed(oldSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := at.User, user; !reflect.DeepEqual(got, want) {
+		t.Fatalf("User => %v; want %v", got, want)
+	}
+
+	if got, want := at.Token, signed(newSecret); got != want {
+		t.Fatalf("Token => %s; want %s", got, want)
+	}
+
+	// Signed with an unknown secret.
+	at, err = s.AccessTokensFind(signed([]byte("other")))
+	if err != ErrTokenInvalid {
+		t.Fatalf("err => %v; want %v", err, ErrTokenInvalid)
+	}
+
+	if at != nil {
+		t.Fatal("Expected access token to be nil")
+	}
+}
+
+func TestAccessTokensResign(t *testing.T) {
+	var (
+		oldSecret = []byte("old")
+		newSecret = []byte("new")
+	)
+
+	s := &accessTokensService{Secret: oldSecret}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	token, err := s.AccessTokensCreate(&AccessToken{ID: "1234", User: user, Scopes: AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The token is rebuilt from its record, which doesn't include the
+	// signed token or the GitHub token.
+	token = newAccessTokenRecord(token).accessToken()
+
+	ok, err := s.AccessTokensResign(oldSecret, newSecret, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("Expected token to be re-signed")
+	}
+
+	if got, want := token.secretHash, accessTokenSecretHash(newSecret, "1234"); got != want {
+		t.Fatalf("secretHash => %s; want %s", got, want)
+	}
+
+	at, err := ParseToken(newSecret, token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := at.ID, "1234"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if got, want := at.Scopes, AllScopes; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scopes => %v; want %v", got, want)
+	}
+
+	if got := at.User.GitHubToken; got != "" {
+		t.Fatalf("GitHubToken => %q; want an empty string", got)
+	}
+
+	// Tokens that aren't signed with the old secret, that have expired,
+	// or that were issued before the secret was recorded, aren't
+	// re-signed.
+	expiredAt := time.Now().Add(-time.Hour)
+	for _, tt := range []*AccessToken{
+		{ID: "1234", User: user, Scopes: AllScopes, secretHash: accessTokenSecretHash([]byte("other"), "1234")},
+		{ID: "1234", User: user, Scopes: AllScopes, secretHash: accessTokenSecretHash(oldSecret, "1234"), ExpiresAt: &expiredAt},
+		{ID: "1234", User: user, Scopes: AllScopes},
+	} {
+		ok, err := s.AccessTokensResign(oldSecret, newSecret, tt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok {
+			t.Fatalf("AccessTokensResign(%v) => true; want false", tt)
+		}
+	}
+}
+
+func TestAccessTokensCreate_Scopes(t *testing.T) {
+	s := &accessTokensService{Secret: testSecret}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	tests := []struct {
+		scopes []string
+		err    error
+	}{
+		{[]string{ScopeDeploysWrite}, nil},
+		{AllScopes, nil},
+		{[]string{ScopeAdmin}, nil},
+		{nil, ErrNoScopes},
+		{[]string{}, ErrNoScopes},
+		{[]string{ScopeAppsRead, "apps:admin"}, &ValidationError{errors.New("Unknown scope: apps:admin.")}},
+	}
+
+	for i, tt := range tests {
+		_, err := s.AccessTokensCreate(&AccessToken{User: user, Scopes: tt.scopes})
+		if got, want := err, tt.err; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d: err => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestAccessTokensFind_Scopes(t *testing.T) {
+	s := &accessTokensService{Secret: testSecret}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	token, err := s.AccessTokensCreate(&AccessToken{User: user, Scopes: []string{ScopeDeploysWrite}})
 	if err != nil {
-		t.Logf("err: %v", reflect.TypeOf(err))
 		t.Fatal(err)
 	}
 
+	at, err := s.AccessTokensFind(token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := at.Scopes, []string{ScopeDeploysWrite}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scopes => %v; want %v", got, want)
+	}
+
+	if !s.HasScope(at, ScopeDeploysWrite) {
+		t.Fatal("Expected token to have the deploys:write scope")
+	}
+
+	if s.HasScope(at, ScopeConfigsRead) {
+		t.Fatal("Expected token to not have the configs:read scope")
+	}
+
+	// Tokens issued without scopes are granted all scopes.
+	legacy, err := SignToken(testSecret, &AccessToken{User: user})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at, err = s.AccessTokensFind(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := at.Scopes, AllScopes; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scopes => %v; want %v", got, want)
+	}
+
+	if s.HasScope(at, ScopeAdmin) {
+		t.Fatal("Expected token without scopes to not have the admin scope")
+	}
+}
+
+func TestAccessTokensFind_ID(t *testing.T) {
+	s := &accessTokensService{Secret: testSecret}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	token, err := s.AccessTokensCreate(&AccessToken{ID: "1234", User: user, Scopes: AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at, err := s.AccessTokensFind(token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := at.ID, "1234"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+}
+
+func TestAccessTokensFind_ExpiresAt(t *testing.T) {
+	s := &accessTokensService{Secret: testSecret}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	token, err := s.AccessTokensCreate(&AccessToken{User: user, Scopes: AllScopes, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at, err := s.AccessTokensFind(token.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if at.ExpiresAt == nil || !at.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("ExpiresAt => %v; want %v", at.ExpiresAt, expiresAt)
+	}
+
+	// Expired tokens are invalid.
+	expiredAt := time.Now().Add(-time.Hour)
+	expired, err := s.AccessTokensCreate(&AccessToken{User: user, Scopes: AllScopes, ExpiresAt: &expiredAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at, err = s.AccessTokensFind(expired.Token)
+	if err != ErrTokenInvalid {
+		t.Fatalf("err => %v; want %v", err, ErrTokenInvalid)
+	}
+
 	if at != nil {
 		t.Fatal("Expected access token to be nil")
 	}
 }
+
+func TestAccessTokenRecord(t *testing.T) {
+	token := &AccessToken{
+		ID:     "1234",
+		Token:  "signed",
+		User:   &User{Name: "ejholmes", GitHubToken: "token"},
+		Scopes: []string{ScopeAppsRead, ScopeAdmin},
+	}
+
+	r := newAccessTokenRecord(token)
+
+	if got, want := r.Scopes, "apps:read admin"; got != want {
+		t.Fatalf("Scopes => %s; want %s", got, want)
+	}
+
+	want := &AccessToken{
+		ID:     "1234",
+		User:   &User{Name: "ejholmes"},
+		Scopes: []string{ScopeAppsRead, ScopeAdmin},
+	}
+
+	if got := r.accessToken(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("accessToken => %#v; want %#v", got, want)
+	}
+}
+
+func TestEmpire_RequireScope(t *testing.T) {
+	e := &Empire{accessTokens: &accessTokensService{Secret: testSecret}}
+	user := &User{Name: "ejholmes", GitHubToken: "token"}
+
+	deploy := WithAccessToken(context.Background(), &AccessToken{User: user, Scopes: []string{ScopeDeploysWrite}})
+
+	if _, err := e.ConfigsApply(deploy, &App{}, Vars{}); err != ErrInsufficientScope {
+		t.Fatalf("err => %v; want %v", err, ErrInsufficientScope)
+	}
+
+	if err := e.requireScope(deploy, ScopeDeploysWrite); err != nil {
+		t.Fatal(err)
+	}
+
+	all := WithAccessToken(context.Background(), &AccessToken{User: user, Scopes: AllScopes})
+	for _, scope := range AllScopes {
+		if err := e.requireScope(all, scope); err != nil {
+			t.Fatalf("%s: %v", scope, err)
+		}
+	}
+
+	// Without an access token, nothing is restricted.
+	if err := e.requireScope(context.Background(), ScopeConfigsWrite); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmpire_AccessTokensList_WithoutAccessToken(t *testing.T) {
+	e := &Empire{accessTokens: &accessTokensService{Secret: testSecret}}
+
+	// Listing tokens requires an admin token, even for callers that would
+	// otherwise be unrestricted.
+	if _, err := e.AccessTokensList(context.Background(), Page{}); err != ErrInsufficientScope {
+		t.Fatalf("err => %v; want %v", err, ErrInsufficientScope)
+	}
+}
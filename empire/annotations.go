@@ -0,0 +1,86 @@
+package empire
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrInvalidAnnotationKey is returned when annotating an app with an empty key.
+var ErrInvalidAnnotationKey = &ValidationError{
+	errors.New("Annotation keys cannot be blank."),
+}
+
+// AppAnnotation is an arbitrary key/value pair attached to an app by
+// operators, e.g. "owner_email" or "cost_center". An app can only have one
+// annotation with a given key.
+type AppAnnotation struct {
+	AppID string
+	Key   string
+	Value string
+}
+
+// AppAnnotations returns the annotations for the app.
+func (s *store) AppAnnotations(app *App) ([]*AppAnnotation, error) {
+	var annotations []*AppAnnotation
+	return annotations, s.Find(ComposedScope{ForApp(app), Order("key")}, &annotations)
+}
+
+// AppAnnotationsSet sets the annotation, replacing the value of any existing
+// annotation with the same key.
+func (s *store) AppAnnotationsSet(a *AppAnnotation) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	return appAnnotationsSet(s.db, a)
+}
+
+func appAnnotationsSet(db *gorm.DB, a *AppAnnotation) error {
+	t := db.Begin()
+
+	if err := t.Exec(`delete from app_annotations where app_id = ? and key = ?`, a.AppID, a.Key).Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	if err := t.Exec(`insert into app_annotations (app_id, key, value) values (?, ?, ?)`, a.AppID, a.Key, a.Value).Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return t.Commit().Error
+}
+
+// appAnnotationsService is a service for annotating apps.
+type appAnnotationsService struct {
+	store *store
+}
+
+// AppsAnnotate sets the annotation on the app.
+func (s *appAnnotationsService) AppsAnnotate(app *App, key, value string) error {
+	if key == "" {
+		return ErrInvalidAnnotationKey
+	}
+
+	return s.store.AppAnnotationsSet(&AppAnnotation{
+		AppID: app.ID,
+		Key:   key,
+		Value: value,
+	})
+}
+
+// AppsAnnotations returns the annotations of the app as a map.
+func (s *appAnnotationsService) AppsAnnotations(app *App) (map[string]string, error) {
+	annotations, err := s.store.AppAnnotations(app)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(annotations))
+	for _, a := range annotations {
+		m[a.Key] = a.Value
+	}
+
+	return m, nil
+}
@@ -1,14 +1,19 @@
 package empire
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/reporter"
 	"github.com/remind101/pkg/timex"
 	"golang.org/x/net/context"
 )
@@ -18,15 +23,189 @@ const (
 	ExposePublic  = "public"
 )
 
+// Deploy strategies.
+const (
+	// DeployStrategyRecreate schedules all instances of the new release at
+	// once.
+	DeployStrategyRecreate = "recreate"
+
+	// DeployStrategyRolling schedules instances of the new release in
+	// batches.
+	DeployStrategyRolling = "rolling"
+)
+
+// Drain timeouts, in seconds.
+const (
+	// DefaultDrainTimeout is the number of seconds that processes are given
+	// to exit after receiving a SIGTERM, before they're killed.
+	DefaultDrainTimeout = 30
+
+	// MaxDrainTimeout is the longest drain timeout that can be set.
+	MaxDrainTimeout = 3600
+)
+
+// MaxAppNameLength is the maximum length of an app name, which is constrained
+// by the maximum length of a DNS label.
+const MaxAppNameLength = 63
+
 var (
+	// ErrAppNotFound is returned when an app doesn't exist.
+	ErrAppNotFound = errors.New("app not found")
+
 	// ErrInvalidName is used to indicate that the app name is not valid.
 	ErrInvalidName = &ValidationError{
-		errors.New("An app name must be alphanumeric and dashes only, 3-30 chars in length."),
+		errors.New("An app name must be lowercase alphanumeric and dashes only, 3-63 chars in length, and cannot start or end with a dash."),
+	}
+
+	// ErrInvalidNamespace is used to indicate that the app namespace is not
+	// valid, or is too long when combined with the app name.
+	ErrInvalidNamespace = &ValidationError{
+		errors.New("An app namespace must be lowercase alphanumeric and dashes only, cannot start or end with a dash, and combined with the app name must be at most 63 chars in length."),
+	}
+
+	// ErrInvalidCursor is used to indicate that a pagination cursor
+	// couldn't be decoded.
+	ErrInvalidCursor = &ValidationError{
+		errors.New("Invalid cursor."),
+	}
+
+	// ErrInvalidDeployStrategy is used to indicate that the deploy strategy
+	// is not valid.
+	ErrInvalidDeployStrategy = &ValidationError{
+		errors.New(`Deploy strategy must be "recreate" or "rolling".`),
+	}
+
+	// ErrInvalidDrainTimeout is used to indicate that the drain timeout is
+	// out of range.
+	ErrInvalidDrainTimeout = &ValidationError{
+		fmt.Errorf("Drain timeout must be between 0 and %d seconds.", MaxDrainTimeout),
+	}
+
+	// ErrInvalidDrainCount is used to indicate that the number of processes
+	// to drain is negative.
+	ErrInvalidDrainCount = &ValidationError{
+		errors.New("The number of processes to drain cannot be negative."),
+	}
+
+	// ErrReservedName is used to indicate that the app name is reserved.
+	ErrReservedName = &ValidationError{
+		errors.New("That app name is reserved."),
 	}
 )
 
+// ErrAppsDestroyConflict is the error that an AppsDestroyConflictError
+// matches with IsAppsDestroyConflict.
+var ErrAppsDestroyConflict = errors.New("app has dependent resources")
+
+// ErrJobsStillRunning is the error that a JobsStillRunningError matches with
+// IsJobsStillRunning.
+var ErrJobsStillRunning = errors.New("jobs are still running")
+
+// DefaultDestroyVerifyInterval is how often the scheduler is checked for
+// running jobs after an app is destroyed, when verifying that it was removed.
+var DefaultDestroyVerifyInterval = time.Second
+
+// AppsDestroyConflictError is returned by AppsDestroy when the app still has
+// resources that depend on it. It contains one error per type of resource.
+type AppsDestroyConflictError struct {
+	Errors []error
+}
+
+func (e *AppsDestroyConflictError) Error() string {
+	var problems []string
+	for _, err := range e.Errors {
+		problems = append(problems, err.Error())
+	}
+	return fmt.Sprintf("%s: %s", ErrAppsDestroyConflict, strings.Join(problems, ", "))
+}
+
+// Unwrap returns the error for each type of dependent resource.
+func (e *AppsDestroyConflictError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is returns true if target is ErrAppsDestroyConflict.
+func (e *AppsDestroyConflictError) Is(target error) bool {
+	return target == ErrAppsDestroyConflict
+}
+
+// IsAppsDestroyConflict returns true if err is ErrAppsDestroyConflict or an
+// AppsDestroyConflictError.
+func IsAppsDestroyConflict(err error) bool {
+	if _, ok := err.(*AppsDestroyConflictError); ok {
+		return true
+	}
+	return err == ErrAppsDestroyConflict
+}
+
+// JobsStillRunningError is returned by AppsDestroyVerify when the scheduler
+// still has jobs for the app after the timeout.
+type JobsStillRunningError struct {
+	// The names of the jobs that are still running, e.g. "v1.web.1".
+	Jobs []string
+}
+
+func (e *JobsStillRunningError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrJobsStillRunning, strings.Join(e.Jobs, ", "))
+}
+
+// Is returns true if target is ErrJobsStillRunning.
+func (e *JobsStillRunningError) Is(target error) bool {
+	return target == ErrJobsStillRunning
+}
+
+// IsJobsStillRunning returns true if err is ErrJobsStillRunning or a
+// JobsStillRunningError.
+func IsJobsStillRunning(err error) bool {
+	if _, ok := err.(*JobsStillRunningError); ok {
+		return true
+	}
+	return err == ErrJobsStillRunning
+}
+
+// newAppsDestroyConflictError returns an AppsDestroyConflictError describing
+// the dependent resources, or nil if there aren't any.
+func newAppsDestroyConflictError(instances []*service.Instance, domains []*Domain, canary bool) error {
+	var errs []error
+
+	if len(instances) > 0 {
+		errs = append(errs, fmt.Errorf("%d running processes", len(instances)))
+	}
+
+	if len(domains) > 0 {
+		var hostnames []string
+		for _, d := range domains {
+			hostnames = append(hostnames, d.Hostname)
+		}
+		errs = append(errs, fmt.Errorf("domains attached (%s)", strings.Join(hostnames, ", ")))
+	}
+
+	if canary {
+		errs = append(errs, errors.New("canary deployment in progress"))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &AppsDestroyConflictError{Errors: errs}
+}
+
 // NamePattern is a regex pattern that app names must conform to.
-var NamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{2,30}$`)
+var NamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*[a-z0-9]$`)
+
+// dnsLabelPattern is a regex pattern that a single DNS label must conform to.
+var dnsLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// DefaultReservedAppNames are app names that cannot be used when creating an
+// app.
+var DefaultReservedAppNames = []string{
+	"admin",
+	"api",
+	"auth",
+	"empire",
+	"www",
+}
 
 // NewAppNameFromRepo generates a new name from a Repo
 //
@@ -42,6 +221,11 @@ type App struct {
 
 	Name string
 
+	// An optional prefix for the app's DNS label, e.g. an app named
+	// "acme-inc" in the "staging" namespace has the label
+	// "staging-acme-inc".
+	Namespace string
+
 	Repo *string
 
 	Certificates []*Certificate
@@ -49,15 +233,66 @@ type App struct {
 	// Valid values are empire.ExposePrivate and empire.ExposePublic.
 	Exposure string
 
+	// Valid values are empire.DeployStrategyRecreate and
+	// empire.DeployStrategyRolling.
+	DeployStrategy string
+
+	// The number of seconds that processes are given to exit gracefully
+	// after receiving a SIGTERM.
+	DrainTimeoutSeconds int
+
+	// If set, this command is run as a one-off task with every new
+	// release, which is only created if the command exits 0.
+	ValidateCommand string
+
 	CreatedAt *time.Time
 }
 
 // IsValid returns an error if the app isn't valid.
 func (a *App) IsValid() error {
-	if !NamePattern.Match([]byte(a.Name)) {
+	if err := validateAppName(a.Name, nil); err != nil {
+		return err
+	}
+
+	return validateAppNamespace(a.Namespace, a.Name)
+}
+
+// validateAppName returns an error if the name is not a valid app name, or is
+// one of the reserved names.
+func validateAppName(name string, reserved []string) error {
+	if len(name) < 3 || len(name) > MaxAppNameLength {
+		return ErrInvalidName
+	}
+
+	if !NamePattern.MatchString(name) {
 		return ErrInvalidName
 	}
 
+	for _, r := range reserved {
+		if name == r {
+			return ErrReservedName
+		}
+	}
+
+	return nil
+}
+
+// validateAppNamespace returns an error if the namespace isn't a valid DNS
+// label, or if the namespace and name combined are too long to be one.
+func validateAppNamespace(namespace, name string) error {
+	if namespace == "" {
+		return nil
+	}
+
+	if !dnsLabelPattern.MatchString(namespace) {
+		return ErrInvalidNamespace
+	}
+
+	label := namespace + "-" + name
+	if len(label) > MaxAppNameLength || !dnsLabelPattern.MatchString(label) {
+		return ErrInvalidNamespace
+	}
+
 	return nil
 }
 
@@ -69,6 +304,14 @@ func (a *App) BeforeCreate() error {
 		a.Exposure = ExposePrivate
 	}
 
+	if a.DeployStrategy == "" {
+		a.DeployStrategy = DeployStrategyRecreate
+	}
+
+	if a.DrainTimeoutSeconds == 0 {
+		a.DrainTimeoutSeconds = DefaultDrainTimeout
+	}
+
 	return a.IsValid()
 }
 
@@ -83,6 +326,67 @@ type AppsQuery struct {
 
 	// If provided, finds apps with the given repo attached.
 	Repo *string
+
+	// If provided, finds apps that have an annotation with this key.
+	AnnotationKey string
+
+	// If provided along with AnnotationKey, finds apps whose annotation has
+	// this value.
+	AnnotationValue string
+
+	// If provided, the field to sort apps by. Apps are always sorted by
+	// name after this field.
+	SortField AppsSortField
+
+	// The direction to sort SortField in. Defaults to AppsSortAsc.
+	SortOrder AppsSortOrder
+}
+
+// AppsSortField is a field that apps can be sorted by.
+type AppsSortField string
+
+// Fields that apps can be sorted by.
+const (
+	AppsSortName           AppsSortField = "name"
+	AppsSortCreatedAt      AppsSortField = "created_at"
+	AppsSortLastDeployedAt AppsSortField = "last_deployed_at"
+)
+
+// AppsSortOrder is the direction to sort apps in.
+type AppsSortOrder string
+
+// Directions that apps can be sorted in.
+const (
+	AppsSortAsc  AppsSortOrder = "asc"
+	AppsSortDesc AppsSortOrder = "desc"
+)
+
+// appsSortColumns maps an AppsSortField to the sql to order by.
+var appsSortColumns = map[AppsSortField]string{
+	AppsSortName:           "name",
+	AppsSortCreatedAt:      "created_at",
+	AppsSortLastDeployedAt: "(select max(releases.created_at) from releases where releases.app_id = apps.id)",
+}
+
+// ErrInvalidAppsSort is returned when apps are sorted by an unknown field or
+// direction.
+var ErrInvalidAppsSort = &ValidationError{
+	errors.New("Apps can only be sorted by name, created_at or last_deployed_at, in asc or desc order."),
+}
+
+// validateAppsSort returns an error if the sort field or order of the query
+// is unknown.
+func validateAppsSort(q AppsQuery) error {
+	if _, ok := appsSortColumns[q.SortField]; q.SortField != "" && !ok {
+		return ErrInvalidAppsSort
+	}
+
+	switch q.SortOrder {
+	case "", AppsSortAsc, AppsSortDesc:
+		return nil
+	default:
+		return ErrInvalidAppsSort
+	}
 }
 
 // Scope implements the Scope interface.
@@ -101,9 +405,39 @@ func (q AppsQuery) Scope(db *gorm.DB) *gorm.DB {
 		scope = append(scope, FieldEquals("repo", *q.Repo))
 	}
 
+	if q.AnnotationKey != "" {
+		scope = append(scope, annotatedWith(q.AnnotationKey, q.AnnotationValue))
+	}
+
+	if column, ok := appsSortColumns[q.SortField]; ok {
+		order := AppsSortAsc
+		if q.SortOrder == AppsSortDesc {
+			order = AppsSortDesc
+		}
+
+		// Apps that have never been deployed sort last.
+		scope = append(scope, Order(fmt.Sprintf("%s %s nulls last", column, order)))
+	}
+
+	// Apps that are scheduled to be destroyed are hidden.
+	scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+		return db.Where("destroy_scheduled_at is null")
+	}))
+
 	return scope.Scope(db)
 }
 
+// annotatedWith returns a Scope that finds apps with the annotation. If value is
+// empty, any value matches.
+func annotatedWith(key, value string) Scope {
+	return ScopeFunc(func(db *gorm.DB) *gorm.DB {
+		if value == "" {
+			return db.Where("id in (select app_id from app_annotations where key = ?)", key)
+		}
+		return db.Where("id in (select app_id from app_annotations where key = ? and value = ?)", key, value)
+	})
+}
+
 // AppsFirst returns the first matching release.
 func (s *store) AppsFirst(scope Scope) (*App, error) {
 	var app App
@@ -114,23 +448,173 @@ func (s *store) AppsFirst(scope Scope) (*App, error) {
 // Apps returns all apps matching the scope.
 func (s *store) Apps(scope Scope) ([]*App, error) {
 	var apps []*App
-	// Default to ordering by name.
-	scope = ComposedScope{Order("name"), scope}
+	// Default to ordering by name. This comes after the scope so that
+	// it's a tiebreaker when the scope sorts by something else.
+	scope = ComposedScope{scope, Order("name")}
 	return apps, s.Find(scope, &apps)
 }
 
+// AppsAfter returns up to limit apps, sorted by name then id, that come after
+// the cursor.
+func (s *store) AppsAfter(cursor appsCursor, limit int) ([]*App, error) {
+	var apps []*App
+	scope := ComposedScope{AppsQuery{}, cursor, Order("name asc, id asc"), Page{Limit: limit}}
+	return apps, s.Find(scope, &apps)
+}
+
+// AppWithLastRelease is an app along with its most recent active release.
+type AppWithLastRelease struct {
+	*App
+
+	// Nil if the app has never been released.
+	LastRelease *Release
+}
+
+// AppsAllWithLastRelease returns a page of apps, sorted by name, along with
+// their most recent active release, in a single query. Only the fields stored
+// on the releases table are set on the releases.
+func (s *store) AppsAllWithLastRelease(page Page) ([]*AppWithLastRelease, error) {
+	query := `select apps.id, apps.name, apps.repo, apps.exposure, apps.deploy_strategy, apps.drain_timeout_seconds, apps.namespace, apps.validate_command, apps.created_at,
+  r.id, r.version, r.config_id, r.slug_id, r.description, r.created_at, r.commit_sha, r.branch, r.status, r.approved_by
+from apps
+left join lateral (
+  select * from releases
+  where releases.app_id = apps.id and releases.status = ?
+  order by releases.version desc
+  limit 1
+) r on true
+where apps.destroy_scheduled_at is null
+order by apps.name`
+	args := []interface{}{ReleaseStatusActive}
+
+	if page.Limit > 0 {
+		query += " limit ?"
+		args = append(args, page.Limit)
+	}
+	if page.Offset > 0 {
+		query += " offset ?"
+		args = append(args, page.Offset)
+	}
+
+	rows, err := s.reader().Raw(query, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var apps []*AppWithLastRelease
+	for rows.Next() {
+		app := new(App)
+		var (
+			id, configID, slugID, description   *string
+			commitSHA, branch, status, approver *string
+			version                             *int
+			createdAt                           *time.Time
+		)
+
+		if err := rows.Scan(
+			&app.ID, &app.Name, &app.Repo, &app.Exposure, &app.DeployStrategy, &app.DrainTimeoutSeconds, &app.Namespace, &app.ValidateCommand, &app.CreatedAt,
+			&id, &version, &configID, &slugID, &description, &createdAt, &commitSHA, &branch, &status, &approver,
+		); err != nil {
+			return apps, err
+		}
+
+		a := &AppWithLastRelease{App: app}
+		if id != nil {
+			a.LastRelease = &Release{
+				ID:          *id,
+				Version:     *version,
+				AppID:       app.ID,
+				App:         app,
+				ConfigID:    *configID,
+				SlugID:      *slugID,
+				Description: stringValue(description),
+				CreatedAt:   createdAt,
+				CommitSHA:   *commitSHA,
+				Branch:      *branch,
+				Status:      *status,
+				ApprovedBy:  *approver,
+			}
+		}
+		apps = append(apps, a)
+	}
+
+	return apps, rows.Err()
+}
+
+// stringValue returns the string that s points to, or an empty string if s is
+// nil.
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// AppsAllBySlug returns all apps that have a release of the slug, sorted by
+// name.
+func (s *store) AppsAllBySlug(slug *Slug) ([]*App, error) {
+	var apps []*App
+	return apps, s.reader().Raw(`select distinct apps.* from apps
+  inner join releases on releases.app_id = apps.id
+  inner join slugs on slugs.id = releases.slug_id
+where slugs.id = ?
+order by apps.name`, slug.ID).Scan(&apps).Error
+}
+
 // AppsCreate persists an app.
 func (s *store) AppsCreate(app *App) (*App, error) {
+	if err := s.writable(); err != nil {
+		return app, err
+	}
+
 	return appsCreate(s.db, app)
 }
 
+// AppsCreateWithConfig persists an app and its first config in a single
+// transaction.
+func (s *store) AppsCreateWithConfig(app *App, config *Config) (*App, *Config, error) {
+	if err := s.writable(); err != nil {
+		return app, nil, err
+	}
+
+	t := s.db.Begin()
+
+	if _, err := appsCreate(t, app); err != nil {
+		t.Rollback()
+		return app, nil, err
+	}
+
+	config.AppID = app.ID
+
+	if _, err := configsCreateTx(t, config); err != nil {
+		t.Rollback()
+		return app, nil, err
+	}
+
+	if err := t.Commit().Error; err != nil {
+		t.Rollback()
+		return app, nil, err
+	}
+
+	return app, config, nil
+}
+
 // AppsUpdate updates an app.
 func (s *store) AppsUpdate(app *App) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	return appsUpdate(s.db, app)
 }
 
 // AppsDestroy destroys an app.
 func (s *store) AppsDestroy(app *App) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	return appsDestroy(s.db, app)
 }
 
@@ -144,9 +628,131 @@ func AppID(id string) func(*gorm.DB) *gorm.DB {
 type appsService struct {
 	store   *store
 	manager service.Manager
+	configs *configsService
+
+	// App names that cannot be used when creating an app.
+	reservedNames []string
+
+	// When true, AppsDestroy refuses to destroy apps that still have
+	// dependent resources.
+	strictDestroy bool
+
+	// Runs the validation command of new releases.
+	taskRunner TaskRunner
+
+	// When greater than 0, AppsDestroy waits up to this long for the
+	// scheduler to stop all of the app's jobs.
+	verifyDestroyTimeout time.Duration
+
+	// How often the scheduler is checked while verifying that an app was
+	// destroyed. Defaults to DefaultDestroyVerifyInterval.
+	verifyDestroyInterval time.Duration
+}
+
+// AppsAllCursor returns up to limit apps, sorted by name then id, that come
+// after the cursor, along with the cursor of the next page. The next cursor is
+// empty when there are no more apps.
+func (s *appsService) AppsAllCursor(cursor string, limit int) ([]*App, string, error) {
+	after, err := decodeAppsCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if limit <= 0 {
+		apps, err := s.store.AppsAfter(after, 0)
+		return apps, "", err
+	}
+
+	// Fetch an extra app to find out if there's another page.
+	apps, err := s.store.AppsAfter(after, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(apps) <= limit {
+		return apps, "", nil
+	}
+
+	apps = apps[:limit]
+	last := apps[limit-1]
+	return apps, encodeAppsCursor(appsCursor{Name: last.Name, ID: last.ID}), nil
+}
+
+// AppsCreate validates the app name against the reserved names, then creates
+// the app.
+func (s *appsService) AppsCreate(app *App) (*App, error) {
+	a, _, err := s.AppsCreateWithConfig(app, nil)
+	return a, err
+}
+
+// AppsCreateWithConfig validates the app name and config vars, then creates
+// the app and its first config in a single transaction. The config starts with
+// the config defaults, which vars take precedence over.
+func (s *appsService) AppsCreateWithConfig(app *App, vars Vars) (*App, *Config, error) {
+	if err := validateAppName(app.Name, s.reservedNames); err != nil {
+		return app, nil, err
+	}
+
+	if err := validateAppNamespace(app.Namespace, app.Name); err != nil {
+		return app, nil, err
+	}
+
+	if err := s.configs.validate(vars); err != nil {
+		return app, nil, err
+	}
+
+	defaults, err := s.store.ConfigDefaults()
+	if err != nil {
+		return app, nil, err
+	}
+
+	config := NewConfig(&Config{Vars: defaults}, vars)
+	if len(config.Vars) == 0 {
+		a, err := s.store.AppsCreate(app)
+		return a, nil, err
+	}
+
+	if err := s.configs.validate(config.Vars); err != nil {
+		return app, nil, err
+	}
+
+	return s.store.AppsCreateWithConfig(app, config)
 }
 
 func (s *appsService) AppsDestroy(ctx context.Context, app *App) error {
+	return s.AppsDestroyVerify(ctx, app, s.verifyDestroyTimeout)
+}
+
+// AppsDestroyVerify destroys the app like AppsDestroy, then waits up to
+// timeout for the scheduler to stop all of its jobs. If jobs are still running
+// after the timeout, a JobsStillRunningError is returned. A timeout of 0
+// doesn't wait.
+func (s *appsService) AppsDestroyVerify(ctx context.Context, app *App, timeout time.Duration) error {
+	if s.strictDestroy {
+		if err := s.destroyConflicts(ctx, app); err != nil {
+			return err
+		}
+	}
+
+	if err := s.destroy(ctx, app); err != nil {
+		return err
+	}
+
+	return s.verifyDestroyed(ctx, app, timeout)
+}
+
+// AppsDestroyForce destroys the app without checking for dependent
+// resources.
+func (s *appsService) AppsDestroyForce(ctx context.Context, app *App) error {
+	if err := s.destroy(ctx, app); err != nil {
+		return err
+	}
+
+	return s.verifyDestroyed(ctx, app, s.verifyDestroyTimeout)
+}
+
+// destroy removes the app from the scheduler, then deletes it.
+func (s *appsService) destroy(ctx context.Context, app *App) error {
 	if err := s.manager.Remove(ctx, app.ID); err != nil {
 		return err
 	}
@@ -154,6 +760,130 @@ func (s *appsService) AppsDestroy(ctx context.Context, app *App) error {
 	return s.store.AppsDestroy(app)
 }
 
+// verifyDestroyed polls the scheduler until it has no jobs for the app, or
+// the timeout is reached.
+func (s *appsService) verifyDestroyed(ctx context.Context, app *App, timeout time.Duration) error {
+	if timeout <= 0 {
+		return nil
+	}
+
+	interval := s.verifyDestroyInterval
+	if interval == 0 {
+		interval = DefaultDestroyVerifyInterval
+	}
+
+	deadline := time.After(timeout)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		instances, err := s.manager.Instances(ctx, app.ID)
+		if err != nil {
+			return err
+		}
+
+		if len(instances) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			var jobs []string
+			for _, i := range instances {
+				jobs = append(jobs, instanceName(i))
+			}
+			sort.Strings(jobs)
+			return &JobsStillRunningError{Jobs: jobs}
+		case <-t.C:
+		}
+	}
+}
+
+// destroyConflicts returns an AppsDestroyConflictError if the app has running
+// processes, domains or a canary deployment in progress.
+func (s *appsService) destroyConflicts(ctx context.Context, app *App) error {
+	instances, err := s.manager.Instances(ctx, app.ID)
+	if err != nil {
+		return err
+	}
+
+	domains, err := s.store.Domains(DomainsQuery{App: app})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.store.CanaryDeploymentsFirst(CanaryDeploymentsQuery{App: app})
+	if err != nil && err != gorm.RecordNotFound {
+		return err
+	}
+
+	return newAppsDestroyConflictError(instances, domains, err == nil)
+}
+
+// AppsSetDeployStrategy validates and updates the deploy strategy for the app.
+func (s *appsService) AppsSetDeployStrategy(app *App, strategy string) error {
+	if err := validateDeployStrategy(strategy); err != nil {
+		return err
+	}
+
+	app.DeployStrategy = strategy
+
+	return s.store.AppsUpdate(app)
+}
+
+// validateDeployStrategy returns an error if the strategy is not a known
+// deploy strategy.
+func validateDeployStrategy(strategy string) error {
+	switch strategy {
+	case DeployStrategyRecreate, DeployStrategyRolling:
+		return nil
+	default:
+		return ErrInvalidDeployStrategy
+	}
+}
+
+// AppsSetDrainTimeout validates and updates the drain timeout for the app. A
+// timeout of 0 resets it to the DefaultDrainTimeout.
+func (s *appsService) AppsSetDrainTimeout(app *App, seconds int) error {
+	if err := validateDrainTimeout(seconds); err != nil {
+		return err
+	}
+
+	if seconds == 0 {
+		seconds = DefaultDrainTimeout
+	}
+
+	app.DrainTimeoutSeconds = seconds
+
+	return s.store.AppsUpdate(app)
+}
+
+// AppsSetValidateCommand updates the command that's run to validate new
+// releases of the app. An empty command disables validation. A command can't
+// be set if running tasks isn't enabled, since every release would fail.
+func (s *appsService) AppsSetValidateCommand(app *App, cmd string) error {
+	cmd = strings.TrimSpace(cmd)
+
+	if _, ok := s.taskRunner.(*fakeTaskRunner); ok && cmd != "" {
+		return ErrTaskRunnerDisabled
+	}
+
+	app.ValidateCommand = cmd
+
+	return s.store.AppsUpdate(app)
+}
+
+// validateDrainTimeout returns an error if seconds is not between 0 and
+// MaxDrainTimeout.
+func validateDrainTimeout(seconds int) error {
+	if seconds < 0 || seconds > MaxDrainTimeout {
+		return ErrInvalidDrainTimeout
+	}
+	return nil
+}
+
 // AppsEnsureRepo will set the repo if it's not set.
 func (s *appsService) AppsEnsureRepo(app *App, repo string) error {
 	if app.Repo != nil {
@@ -218,8 +948,110 @@ type scaler struct {
 	manager service.Manager
 }
 
+// ErrNoChangeRequired is returned by ProcessesScale when every process already
+// has the requested quantity.
+var ErrNoChangeRequired = &ValidationError{
+	errors.New("The processes are already scaled to the requested quantities."),
+}
+
+// ProcessesScale scales multiple process types of the current release at once,
+// returning the release with its updated formation. Either every process is
+// scaled, or none are: if the scheduler fails to scale one of them, or the new
+// formation can't be saved, the processes that were already scaled are scaled
+// back to their previous quantities.
+func (s *scaler) ProcessesScale(ctx context.Context, app *App, quantities map[string]int) (*Release, error) {
+	qm, err := NewProcessQuantityMap(quantities)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			err = &ValidationError{Err: fmt.Errorf("no releases for %s", app.Name)}
+		}
+		return nil, err
+	}
+
+	f, err := s.store.Formation(ProcessesQuery{Release: release})
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := changedQuantities(f, qm)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(changed) == 0 {
+		return nil, ErrNoChangeRequired
+	}
+
+	var scaled []ProcessType
+	for _, t := range changed {
+		if err := s.manager.Scale(ctx, release.AppID, string(t), uint(qm[t])); err != nil {
+			s.rescale(ctx, release.AppID, f, scaled)
+			return nil, err
+		}
+		scaled = append(scaled, t)
+	}
+
+	var processes []*Process
+	for _, t := range changed {
+		p := *f[t]
+		p.Quantity = qm[t]
+		processes = append(processes, &p)
+	}
+
+	if err := s.store.ProcessesScale(release.AppID, processes); err != nil {
+		s.rescale(ctx, release.AppID, f, scaled)
+		return nil, err
+	}
+
+	if err := s.store.JobStateSnapshotsInvalidate(app); err != nil {
+		return nil, err
+	}
+
+	return s.store.ReleasesFirst(ReleasesQuery{ID: &release.ID})
+}
+
+// rescale scales the process types back to their quantity in the formation.
+// Errors are reported, since the original error is more useful to the caller.
+func (s *scaler) rescale(ctx context.Context, appID string, f Formation, types []ProcessType) {
+	for _, t := range types {
+		if err := s.manager.Scale(ctx, appID, string(t), uint(f[t].Quantity)); err != nil {
+			reporter.Report(ctx, err)
+		}
+	}
+}
+
+// changedQuantities returns the process types, sorted, whose quantity in qm is
+// different from the formation. A ValidationError is returned if qm contains a
+// process type that isn't in the formation.
+func changedQuantities(f Formation, qm ProcessQuantityMap) ([]ProcessType, error) {
+	nf, err := f.WithQuantities(qm)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for t, p := range nf {
+		if p.Quantity != f[t].Quantity {
+			changed = append(changed, string(t))
+		}
+	}
+	sort.Strings(changed)
+
+	types := make([]ProcessType, 0, len(changed))
+	for _, t := range changed {
+		types = append(types, ProcessType(t))
+	}
+
+	return types, nil
+}
+
 func (s *scaler) Scale(ctx context.Context, app *App, t ProcessType, quantity int, c *Constraints) (*Process, error) {
-	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app})
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
 	if err != nil {
 		return nil, err
 	}
@@ -248,7 +1080,19 @@ func (s *scaler) Scale(ctx context.Context, app *App, t ProcessType, quantity in
 		p.Constraints = *c
 	}
 
-	return p, s.store.ProcessesUpdate(p)
+	if err := s.store.ProcessesUpdate(p); err != nil {
+		return p, err
+	}
+
+	if _, err := s.store.ScaleEventsCreate(&ScaleEvent{
+		AppID:       release.AppID,
+		ProcessType: p.Type,
+		Quantity:    p.Quantity,
+	}); err != nil {
+		return p, err
+	}
+
+	return p, s.store.JobStateSnapshotsInvalidate(app)
 }
 
 // restarter is a small service for restarting an apps processes.
@@ -286,3 +1130,106 @@ func (s *restarter) Restart(ctx context.Context, app *App, t ProcessType, id str
 
 	return nil
 }
+
+// drainer is a small service for gracefully stopping an apps processes.
+type drainer struct {
+	manager service.Manager
+}
+
+// Drain sends SIGTERM to count instances of the given process type, then waits
+// up to timeout for them to exit. Any instances that are still running after
+// the timeout are sent SIGKILL.
+func (s *drainer) Drain(ctx context.Context, app *App, t ProcessType, count int, timeout time.Duration) error {
+	if count < 0 {
+		return ErrInvalidDrainCount
+	}
+
+	instances, err := s.manager.Instances(ctx, app.ID)
+	if err != nil {
+		return err
+	}
+
+	var selected []*service.Instance
+
+	for _, i := range instances {
+		if len(selected) == count {
+			break
+		}
+
+		if i.Process.Type == string(t) {
+			selected = append(selected, i)
+		}
+	}
+
+	if len(selected) < count {
+		return &ValidationError{Err: fmt.Errorf("only %d %s processes running, cannot drain %d", len(selected), t, count)}
+	}
+
+	for _, i := range selected {
+		if err := s.manager.SendSignal(ctx, i.ID, syscall.SIGTERM); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for _, i := range selected {
+		remaining := deadline.Sub(time.Now())
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		err := s.manager.WaitForExit(ctx, i.ID, remaining)
+		if err == service.ErrWaitTimeout {
+			err = s.manager.SendSignal(ctx, i.ID, syscall.SIGKILL)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appsCursor is the last app on a page of apps, which the next page starts
+// after. The zero value is the start of the first page.
+type appsCursor struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// Scope implements the Scope interface.
+func (c appsCursor) Scope(db *gorm.DB) *gorm.DB {
+	if c.ID == "" {
+		return db
+	}
+
+	return db.Where("(name, id) > (?, ?)", c.Name, c.ID)
+}
+
+// encodeAppsCursor returns the opaque string form of the cursor.
+func encodeAppsCursor(c appsCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// decodeAppsCursor decodes a cursor from encodeAppsCursor. An empty string is
+// the start of the first page.
+func decodeAppsCursor(s string) (appsCursor, error) {
+	var c appsCursor
+	if s == "" {
+		return c, nil
+	}
+
+	b, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
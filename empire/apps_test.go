@@ -1,7 +1,15 @@
 package empire
 
 import (
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
 )
 
 func TestIsValid(t *testing.T) {
@@ -12,6 +20,9 @@ func TestIsValid(t *testing.T) {
 		{App{}, ErrInvalidName},
 		{App{Name: "api"}, nil},
 		{App{Name: "r101-api"}, nil},
+		{App{Name: "r101-api", Namespace: "staging"}, nil},
+		{App{Name: "r101-api", Namespace: "-staging"}, ErrInvalidNamespace},
+		{App{Name: "-r101-api", Namespace: "staging"}, ErrInvalidName},
 	}
 
 	for _, tt := range tests {
@@ -21,18 +32,425 @@ func TestIsValid(t *testing.T) {
 	}
 }
 
+func TestValidateAppName(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserved []string
+		err      error
+	}{
+		{"acme-inc", DefaultReservedAppNames, nil},
+		{"r101-api", DefaultReservedAppNames, nil},
+		{strings.Repeat("a", 63), DefaultReservedAppNames, nil},
+
+		// Reserved names
+		{"api", DefaultReservedAppNames, ErrReservedName},
+		{"empire", DefaultReservedAppNames, ErrReservedName},
+		{"api", nil, nil},
+		{"acme-inc", []string{"acme-inc"}, ErrReservedName},
+
+		// Invalid names
+		{"", nil, ErrInvalidName},
+		{"ab", nil, ErrInvalidName},
+		{strings.Repeat("a", 64), nil, ErrInvalidName},
+		{"Acme-Inc", nil, ErrInvalidName},
+		{"acme_inc", nil, ErrInvalidName},
+		{"acme.inc", nil, ErrInvalidName},
+		{"-acme-inc", nil, ErrInvalidName},
+		{"acme-inc-", nil, ErrInvalidName},
+	}
+
+	for _, tt := range tests {
+		if err := validateAppName(tt.name, tt.reserved); err != tt.err {
+			t.Fatalf("validateAppName(%q) => %v; want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateAppNamespace(t *testing.T) {
+	tests := []struct {
+		namespace string
+		name      string
+		err       error
+	}{
+		{"", "acme-inc", nil},
+		{"staging", "acme-inc", nil},
+		{strings.Repeat("a", 54), "acme-inc", nil},
+
+		// Too long when combined with the name.
+		{strings.Repeat("a", 55), "acme-inc", ErrInvalidNamespace},
+
+		// Invalid namespaces
+		{"-staging", "acme-inc", ErrInvalidNamespace},
+		{"staging-", "acme-inc", ErrInvalidNamespace},
+		{"Staging", "acme-inc", ErrInvalidNamespace},
+		{"staging.us", "acme-inc", ErrInvalidNamespace},
+	}
+
+	for _, tt := range tests {
+		if err := validateAppNamespace(tt.namespace, tt.name); err != tt.err {
+			t.Fatalf("validateAppNamespace(%q, %q) => %v; want %v", tt.namespace, tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateDeployStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		err      error
+	}{
+		{DeployStrategyRecreate, nil},
+		{DeployStrategyRolling, nil},
+		{"", ErrInvalidDeployStrategy},
+		{"bluegreen", ErrInvalidDeployStrategy},
+	}
+
+	for _, tt := range tests {
+		if err := validateDeployStrategy(tt.strategy); err != tt.err {
+			t.Fatalf("validateDeployStrategy(%q) => %v; want %v", tt.strategy, err, tt.err)
+		}
+	}
+}
+
+func TestApp_BeforeCreate(t *testing.T) {
+	app := &App{Name: "acme-inc"}
+
+	if err := app.BeforeCreate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := app.DeployStrategy, DeployStrategyRecreate; got != want {
+		t.Fatalf("DeployStrategy => %s; want %s", got, want)
+	}
+
+	if got, want := app.DrainTimeoutSeconds, DefaultDrainTimeout; got != want {
+		t.Fatalf("DrainTimeoutSeconds => %d; want %d", got, want)
+	}
+}
+
+func TestAppsCursor(t *testing.T) {
+	tests := scopeTests{
+		{appsCursor{}, "", []interface{}{}},
+		{appsCursor{Name: "acme-inc", ID: "1234"}, "WHERE ((name, id) > ($1, $2))", []interface{}{"acme-inc", "1234"}},
+	}
+
+	tests.Run(t)
+}
+
+func TestDecodeAppsCursor(t *testing.T) {
+	c := appsCursor{Name: "acme-inc", ID: "1234"}
+
+	got, err := decodeAppsCursor(encodeAppsCursor(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != c {
+		t.Fatalf("decodeAppsCursor => %v; want %v", got, c)
+	}
+
+	if got, err := decodeAppsCursor(""); err != nil || got != (appsCursor{}) {
+		t.Fatalf("decodeAppsCursor(\"\") => %v, %v; want the zero cursor", got, err)
+	}
+
+	for _, s := range []string{"acme-inc", "e30=", "bm90IGpzb24="} {
+		if _, err := decodeAppsCursor(s); err != ErrInvalidCursor {
+			t.Fatalf("decodeAppsCursor(%q) => %v; want %v", s, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestValidateDrainTimeout(t *testing.T) {
+	tests := []struct {
+		seconds int
+		err     error
+	}{
+		{0, nil},
+		{30, nil},
+		{MaxDrainTimeout, nil},
+		{-1, ErrInvalidDrainTimeout},
+		{MaxDrainTimeout + 1, ErrInvalidDrainTimeout},
+	}
+
+	for _, tt := range tests {
+		if err := validateDrainTimeout(tt.seconds); err != tt.err {
+			t.Fatalf("validateDrainTimeout(%d) => %v; want %v", tt.seconds, err, tt.err)
+		}
+	}
+}
+
 func TestAppsQuery(t *testing.T) {
 	id := "1234"
 	name := "acme-inc"
 	repo := "remind101/acme-inc"
 
 	tests := scopeTests{
-		{AppsQuery{}, "", []interface{}{}},
-		{AppsQuery{ID: &id}, "WHERE (id = $1)", []interface{}{id}},
-		{AppsQuery{Name: &name}, "WHERE (name = $1)", []interface{}{name}},
-		{AppsQuery{Repo: &repo}, "WHERE (repo = $1)", []interface{}{repo}},
-		{AppsQuery{Name: &name, Repo: &repo}, "WHERE (name = $1) AND (repo = $2)", []interface{}{name, repo}},
+		{AppsQuery{}, "WHERE (destroy_scheduled_at is null)", []interface{}{}},
+		{AppsQuery{ID: &id}, "WHERE (id = $1) AND (destroy_scheduled_at is null)", []interface{}{id}},
+		{AppsQuery{Name: &name}, "WHERE (name = $1) AND (destroy_scheduled_at is null)", []interface{}{name}},
+		{AppsQuery{Repo: &repo}, "WHERE (repo = $1) AND (destroy_scheduled_at is null)", []interface{}{repo}},
+		{AppsQuery{Name: &name, Repo: &repo}, "WHERE (name = $1) AND (repo = $2) AND (destroy_scheduled_at is null)", []interface{}{name, repo}},
+		{AppsQuery{SortField: AppsSortName}, "WHERE (destroy_scheduled_at is null) ORDER BY name asc nulls last", []interface{}{}},
+		{AppsQuery{SortField: AppsSortCreatedAt, SortOrder: AppsSortDesc}, "WHERE (destroy_scheduled_at is null) ORDER BY created_at desc nulls last", []interface{}{}},
+		{AppsQuery{SortField: AppsSortLastDeployedAt}, "WHERE (destroy_scheduled_at is null) ORDER BY (select max(releases.created_at) from releases where releases.app_id = apps.id) asc nulls last", []interface{}{}},
+		{AppsQuery{Repo: &repo, SortField: AppsSortName, SortOrder: AppsSortDesc}, "WHERE (repo = $1) AND (destroy_scheduled_at is null) ORDER BY name desc nulls last", []interface{}{repo}},
+		{AppsQuery{AnnotationKey: "owner_email"}, "WHERE (id in (select app_id from app_annotations where key = $1)) AND (destroy_scheduled_at is null)", []interface{}{"owner_email"}},
+		{AppsQuery{AnnotationKey: "owner_email", AnnotationValue: "alice@example.com"}, "WHERE (id in (select app_id from app_annotations where key = $1 and value = $2)) AND (destroy_scheduled_at is null)", []interface{}{"owner_email", "alice@example.com"}},
+		{AppsQuery{AnnotationValue: "alice@example.com"}, "WHERE (destroy_scheduled_at is null)", []interface{}{}},
 	}
 
 	tests.Run(t)
 }
+
+func TestValidateAppsSort(t *testing.T) {
+	tests := []struct {
+		q   AppsQuery
+		err error
+	}{
+		{AppsQuery{}, nil},
+		{AppsQuery{SortField: AppsSortName}, nil},
+		{AppsQuery{SortField: AppsSortCreatedAt, SortOrder: AppsSortDesc}, nil},
+		{AppsQuery{SortField: AppsSortLastDeployedAt, SortOrder: AppsSortAsc}, nil},
+		{AppsQuery{SortField: "repo"}, ErrInvalidAppsSort},
+		{AppsQuery{SortField: AppsSortName, SortOrder: "up"}, ErrInvalidAppsSort},
+	}
+
+	for i, tt := range tests {
+		if got, want := validateAppsSort(tt.q), tt.err; got != want {
+			t.Fatalf("#%d: err => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestDrainer_Drain(t *testing.T) {
+	m := newMockManager(
+		&service.Instance{ID: "1", Process: &service.Process{Type: "web"}},
+		&service.Instance{ID: "2", Process: &service.Process{Type: "worker"}},
+		&service.Instance{ID: "3", Process: &service.Process{Type: "web"}},
+	)
+	m.exits["1"] = true
+
+	d := &drainer{manager: m}
+
+	if err := d.Drain(context.Background(), &App{ID: "1234"}, "web", 2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	// Instance 1 exits gracefully.
+	if got, want := m.signals["1"], []os.Signal{syscall.SIGTERM}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Signals => %v; want %v", got, want)
+	}
+
+	// Instance 3 doesn't exit before the timeout, so it's killed.
+	if got, want := m.signals["3"], []os.Signal{syscall.SIGTERM, syscall.SIGKILL}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Signals => %v; want %v", got, want)
+	}
+
+	if _, ok := m.signals["2"]; ok {
+		t.Fatal("Expected worker process to not be signaled")
+	}
+}
+
+func TestDrainer_Drain_NotEnoughInstances(t *testing.T) {
+	m := newMockManager(
+		&service.Instance{ID: "1", Process: &service.Process{Type: "web"}},
+	)
+
+	d := &drainer{manager: m}
+
+	err := d.Drain(context.Background(), &App{ID: "1234"}, "web", 2, time.Second)
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("err => %v; want a ValidationError", err)
+	}
+
+	if len(m.signals) != 0 {
+		t.Fatal("Expected no processes to be signaled")
+	}
+}
+
+func TestDrainer_Drain_NegativeCount(t *testing.T) {
+	m := newMockManager(
+		&service.Instance{ID: "1", Process: &service.Process{Type: "web"}},
+	)
+
+	d := &drainer{manager: m}
+
+	if err := d.Drain(context.Background(), &App{ID: "1234"}, "web", -1, time.Second); err != ErrInvalidDrainCount {
+		t.Fatalf("err => %v; want %v", err, ErrInvalidDrainCount)
+	}
+
+	if len(m.signals) != 0 {
+		t.Fatal("Expected no processes to be signaled")
+	}
+}
+
+// mockManager is a service.Manager implementation that returns a fixed set of
+// instances and records the signals sent to them.
+type mockManager struct {
+	*service.FakeManager
+
+	instances []*service.Instance
+
+	// Maps an instance id to the signals it has received.
+	signals map[string][]os.Signal
+
+	// Instances that will exit when signaled.
+	exits map[string]bool
+
+	// Apps that have been submitted.
+	submitted []*service.App
+
+	// Errors to return from Validate, by process type.
+	invalid map[string]error
+}
+
+func newMockManager(instances ...*service.Instance) *mockManager {
+	return &mockManager{
+		FakeManager: service.NewFakeManager(),
+		instances:   instances,
+		signals:     make(map[string][]os.Signal),
+		exits:       make(map[string]bool),
+		invalid:     make(map[string]error),
+	}
+}
+
+func (m *mockManager) Submit(ctx context.Context, app *service.App) error {
+	m.submitted = append(m.submitted, app)
+	return nil
+}
+
+func (m *mockManager) Instances(ctx context.Context, app string) ([]*service.Instance, error) {
+	return m.instances, nil
+}
+
+func (m *mockManager) SendSignal(ctx context.Context, instanceID string, sig os.Signal) error {
+	m.signals[instanceID] = append(m.signals[instanceID], sig)
+	return nil
+}
+
+func (m *mockManager) WaitForExit(ctx context.Context, instanceID string, timeout time.Duration) error {
+	if m.exits[instanceID] {
+		return nil
+	}
+
+	return service.ErrWaitTimeout
+}
+
+func (m *mockManager) Validate(ctx context.Context, app *service.App, process *service.Process) error {
+	return m.invalid[process.Type]
+}
+
+func TestNewAppsDestroyConflictError(t *testing.T) {
+	// A fresh app without any resources isn't blocked.
+	if err := newAppsDestroyConflictError(nil, nil, false); err != nil {
+		t.Fatalf("err => %v; want nil", err)
+	}
+
+	instances := []*service.Instance{
+		{ID: "1", Process: &service.Process{Type: "web"}},
+		{ID: "2", Process: &service.Process{Type: "worker"}},
+	}
+	domains := []*Domain{
+		{Hostname: "example.com"},
+	}
+
+	err := newAppsDestroyConflictError(instances, domains, true)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if !IsAppsDestroyConflict(err) {
+		t.Fatalf("err => %v; want ErrAppsDestroyConflict", err)
+	}
+
+	if got, want := err.Error(), "app has dependent resources: 2 running processes, domains attached (example.com), canary deployment in progress"; got != want {
+		t.Fatalf("err => %q; want %q", got, want)
+	}
+
+	if got, want := len(err.(*AppsDestroyConflictError).Unwrap()), 3; got != want {
+		t.Fatalf("len(Unwrap()) => %d; want %d", got, want)
+	}
+}
+
+// lingeringManager is a service.Manager whose instances keep running until
+// goneAt, like a scheduler that's slow to stop them.
+type lingeringManager struct {
+	*service.FakeManager
+
+	instances []*service.Instance
+	goneAt    time.Time
+}
+
+func (m *lingeringManager) Instances(ctx context.Context, app string) ([]*service.Instance, error) {
+	if time.Now().Before(m.goneAt) {
+		return m.instances, nil
+	}
+	return nil, nil
+}
+
+func TestAppsService_VerifyDestroyed(t *testing.T) {
+	instances := []*service.Instance{
+		{ID: "2", Process: &service.Process{Type: "worker", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}},
+		{ID: "1", Process: &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}},
+	}
+	app := &App{ID: "1234"}
+
+	newService := func(delay time.Duration) *appsService {
+		return &appsService{
+			manager: &lingeringManager{
+				FakeManager: service.NewFakeManager(),
+				instances:   instances,
+				goneAt:      time.Now().Add(delay),
+			},
+			verifyDestroyInterval: time.Millisecond,
+		}
+	}
+
+	// The jobs stop before the timeout.
+	start := time.Now()
+	if err := newService(20*time.Millisecond).verifyDestroyed(context.Background(), app, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("Expected to wait for the jobs to stop, returned after %v", elapsed)
+	}
+
+	// The jobs are still running after the timeout.
+	err := newService(time.Hour).verifyDestroyed(context.Background(), app, 20*time.Millisecond)
+	if !IsJobsStillRunning(err) {
+		t.Fatalf("err => %v; want ErrJobsStillRunning", err)
+	}
+
+	if got, want := err.(*JobsStillRunningError).Jobs, []string{"v1.web.1", "v1.worker.2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Jobs => %v; want %v", got, want)
+	}
+
+	// A timeout of 0 doesn't wait.
+	if err := newService(time.Hour).verifyDestroyed(context.Background(), app, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppsService_AppsCreateWithConfig_Validation(t *testing.T) {
+	s := &appsService{
+		configs:       &configsService{maxValueBytes: 3},
+		reservedNames: []string{"empire"},
+	}
+
+	value := "production"
+
+	tests := []struct {
+		app  *App
+		vars Vars
+	}{
+		{&App{Name: "empire"}, nil},
+		{&App{Name: "acme-inc"}, Vars{"RAILS_ENV": &value}},
+	}
+
+	for i, tt := range tests {
+		_, _, err := s.AppsCreateWithConfig(tt.app, tt.vars)
+		if _, ok := err.(*ValidationError); !ok {
+			t.Fatalf("#%d: err => %v; want a ValidationError", i, err)
+		}
+	}
+}
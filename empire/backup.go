@@ -0,0 +1,230 @@
+package empire
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/timex"
+)
+
+// backupEntity maps a file in a backup archive to the table that it was
+// dumped from.
+type backupEntity struct {
+	File  string
+	Table string
+}
+
+// backupEntities are the entities included in a backup, in the order that they
+// need to be restored to satisfy foreign keys.
+var backupEntities = []backupEntity{
+	{"apps.json", "apps"},
+	{"configs.json", "configs"},
+	{"slugs.json", "slugs"},
+	{"releases.json", "releases"},
+	{"formations.json", "processes"},
+}
+
+// RestoreConflict is a record in a backup that wasn't restored because a
+// record with the same id already exists.
+type RestoreConflict struct {
+	// The file in the archive, e.g. "apps.json".
+	File string
+	ID   string
+}
+
+// RestoreReport is returned by Restore.
+type RestoreReport struct {
+	// The number of records that were restored, by file.
+	Restored map[string]int
+
+	// Records that already existed.
+	Conflicts []RestoreConflict
+}
+
+// backupRecord is the only field of a backed up record that Restore needs to
+// know about.
+type backupRecord struct {
+	ID string `json:"id"`
+}
+
+// BackupDump returns the rows of each of the backupEntities as a json array.
+// Rows are dumped and restored by postgres, so that columns round trip exactly,
+// without going through model hooks. Every table is dumped from the same
+// snapshot, so a release is never dumped without the slug and config it
+// references.
+func (s *store) BackupDump() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	t := s.reader().Begin()
+
+	if err := t.Exec(`set transaction isolation level repeatable read read only`).Error; err != nil {
+		t.Rollback()
+		return files, err
+	}
+
+	for _, e := range backupEntities {
+		var b []byte
+		if err := t.Raw(fmt.Sprintf(`select coalesce(json_agg(t), '[]') from %s t`, e.Table)).Row().Scan(&b); err != nil {
+			t.Rollback()
+			return files, err
+		}
+		files[e.File] = b
+	}
+
+	return files, t.Commit().Error
+}
+
+// BackupRestore inserts the records from BackupDump that don't already exist,
+// in a single transaction.
+func (s *store) BackupRestore(files map[string][]byte) (*RestoreReport, error) {
+	report := &RestoreReport{Restored: make(map[string]int)}
+
+	if err := s.writable(); err != nil {
+		return report, err
+	}
+
+	t := s.db.Begin()
+
+	for _, e := range backupEntities {
+		if err := backupRestoreEntity(t, e, files[e.File], report); err != nil {
+			t.Rollback()
+			return report, fmt.Errorf("restoring %s: %v", e.File, err)
+		}
+	}
+
+	return report, t.Commit().Error
+}
+
+func backupRestoreEntity(db *gorm.DB, e backupEntity, b []byte, report *RestoreReport) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(b, &records); err != nil {
+		return err
+	}
+
+	for _, raw := range records {
+		var r backupRecord
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return err
+		}
+
+		var exists bool
+		if err := db.Raw(fmt.Sprintf(`select exists(select 1 from %s where id = ?)`, e.Table), r.ID).Row().Scan(&exists); err != nil {
+			return err
+		}
+
+		if exists {
+			report.Conflicts = append(report.Conflicts, RestoreConflict{File: e.File, ID: r.ID})
+			continue
+		}
+
+		if err := db.Exec(fmt.Sprintf(`insert into %[1]s select * from json_populate_record(null::%[1]s, ?)`, e.Table), string(raw)).Error; err != nil {
+			return err
+		}
+
+		report.Restored[e.File]++
+	}
+
+	return nil
+}
+
+// backupService creates and restores backups.
+type backupService struct {
+	store *store
+}
+
+// Backup writes a gzipped tar archive of the backupEntities to w.
+func (s *backupService) Backup(w io.Writer) error {
+	files, err := s.store.BackupDump()
+	if err != nil {
+		return err
+	}
+
+	return writeBackupArchive(w, files)
+}
+
+// Restore restores the records in a backup archive.
+func (s *backupService) Restore(r io.Reader) (*RestoreReport, error) {
+	files, err := readBackupArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.BackupRestore(files)
+}
+
+func writeBackupArchive(w io.Writer, files map[string][]byte) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	now := timex.Now()
+	for _, e := range backupEntities {
+		b := files[e.File]
+
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    e.File,
+			Mode:    0600,
+			Size:    int64(len(b)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// readBackupArchive reads the files from a backup archive. Files that aren't
+// part of a backup are ignored.
+func readBackupArchive(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	known := make(map[string]bool)
+	for _, e := range backupEntities {
+		known[e.File] = true
+	}
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+
+		if !known[h.Name] {
+			continue
+		}
+
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return files, err
+		}
+		files[h.Name] = b
+	}
+
+	return files, nil
+}
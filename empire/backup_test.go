@@ -0,0 +1,69 @@
+package empire
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+)
+
+func TestBackupArchive(t *testing.T) {
+	files := map[string][]byte{
+		"apps.json":       []byte(`[{"id":"1234","name":"acme-inc"}]`),
+		"configs.json":    []byte(`[]`),
+		"slugs.json":      []byte(`[]`),
+		"releases.json":   []byte(`[]`),
+		"formations.json": []byte(`[]`),
+	}
+
+	buf := new(bytes.Buffer)
+	if err := writeBackupArchive(buf, files); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readBackupArchive(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, files) {
+		t.Fatalf("files => %v; want %v", got, files)
+	}
+}
+
+func TestReadBackupArchive_UnknownFiles(t *testing.T) {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	for name, b := range map[string]string{
+		"apps.json":  `[]`,
+		"evil.json":  `[{"id":"1234"}]`,
+		"users.json": `[]`,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(b))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(b)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+
+	got, err := readBackupArchive(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string][]byte{"apps.json": []byte(`[]`)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("files => %v; want %v", got, want)
+	}
+}
+
+func TestReadBackupArchive_NotGzip(t *testing.T) {
+	if _, err := readBackupArchive(bytes.NewReader([]byte("not an archive"))); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,149 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/fsouza/go-dockerclient"
+)
+
+// ErrBuildsDisabled is returned when building an image if Empire wasn't
+// configured with a docker socket and an organization to push images to.
+var ErrBuildsDisabled = &ValidationError{
+	errors.New("Building images is not enabled."),
+}
+
+// Labels that are added to every image built by Empire, recording where it
+// came from.
+const (
+	// The name of the app that the image was built for.
+	LabelApp = "com.remind101.empire.app"
+
+	// The id of the app that the image was built for.
+	LabelAppID = "com.remind101.empire.app.id"
+
+	// What the image was built from, e.g. the commit sha of a git
+	// repository, if known.
+	LabelSource = "com.remind101.empire.source"
+)
+
+// Builder builds a docker image from a Dockerfile, then pushes it to a
+// registry.
+type Builder interface {
+	// Build builds and pushes an image for the app, returning the image
+	// tagged with tag, or its id if tag is empty.
+	Build(app *App, buildContext io.Reader, tag string, opts BuildImageOptions) (Image, error)
+}
+
+// fakeBuilder is a Builder that's used when building images isn't enabled.
+type fakeBuilder struct{}
+
+func (b *fakeBuilder) Build(app *App, buildContext io.Reader, tag string, opts BuildImageOptions) (Image, error) {
+	return Image{}, ErrBuildsDisabled
+}
+
+// dockerBuilder is a Builder that builds images with the docker daemon, and
+// pushes them to the organization's repository for the app.
+type dockerBuilder struct {
+	client dockerClient
+
+	// The organization that images are pushed to, e.g. "quay.io/remind101".
+	organization string
+
+	auth   *docker.AuthConfigurations
+	router RegistryRouter
+}
+
+func newDockerBuilder(c dockerClient, organization string, auth *docker.AuthConfigurations, router RegistryRouter) Builder {
+	return &dockerBuilder{
+		client:       c,
+		organization: organization,
+		auth:         auth,
+		router:       router,
+	}
+}
+
+// Build implements the Builder interface. Like images that are pulled by the
+// resolver, the image is tagged with its own id before it's pushed, so that it
+// can be pulled by id, unless a tag is given.
+//
+// The image is built with a tag that's unique to the build, so that concurrent
+// builds for the app don't inspect each other's image. The tag is removed once
+// the image has been tagged for pushing.
+func (b *dockerBuilder) Build(app *App, buildContext io.Reader, tag string, opts BuildImageOptions) (Image, error) {
+	repo := fmt.Sprintf("%s/%s", b.organization, app.Name)
+	build := fmt.Sprintf("%s:build-%s", repo, uuid.New())
+	opts = b.buildOptions(app, build, buildContext, tag, opts)
+
+	if err := b.client.BuildImage(opts); err != nil {
+		return Image{}, err
+	}
+
+	i, err := b.client.InspectImage(build)
+	if err != nil {
+		return Image{}, err
+	}
+
+	image := Image{Repo: repo, ID: i.ID}
+	if tag != "" {
+		image.ID = tag
+	}
+
+	if err := b.client.TagImage(build, docker.TagImageOptions{
+		Repo:  repo,
+		Tag:   image.ID,
+		Force: true,
+	}); err != nil {
+		return image, err
+	}
+
+	if err := b.client.RemoveImage(build); err != nil {
+		return image, err
+	}
+
+	auth, err := registryAuth(b.router, b.auth, image)
+	if err != nil {
+		return image, err
+	}
+
+	return image, b.client.PushImage(docker.PushImageOptions{
+		Name:         repo,
+		Tag:          image.ID,
+		OutputStream: opts.OutputStream,
+	}, auth)
+}
+
+// buildOptions sanitizes the callers build options, so that the image is
+// always built from the build context, named name, and labelled with its
+// provenance. Output is written to the callers
+// OutputStream, if provided.
+func (b *dockerBuilder) buildOptions(app *App, name string, buildContext io.Reader, tag string, opts BuildImageOptions) BuildImageOptions {
+	labels := make(map[string]string)
+	for k, v := range opts.Labels {
+		labels[k] = v
+	}
+	labels[LabelApp] = app.Name
+	labels[LabelAppID] = app.ID
+	labels[LabelSource] = tag
+	opts.Labels = labels
+
+	opts.Name = name
+	opts.InputStream = buildContext
+	opts.Remote = ""
+	opts.ContextDir = ""
+	opts.RmTmpContainer = true
+	opts.RawJSONStream = false
+
+	if opts.OutputStream == nil {
+		opts.OutputStream = ioutil.Discard
+	}
+
+	if b.auth != nil && len(opts.AuthConfigs.Configs) == 0 {
+		opts.AuthConfigs = *b.auth
+	}
+
+	return opts
+}
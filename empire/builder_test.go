@@ -0,0 +1,122 @@
+package empire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// buildTagRegexp matches the tag that dockerBuilder builds images with.
+var buildTagRegexp = regexp.MustCompile(`:build-[0-9a-f-]+`)
+
+func TestDockerBuilder_Build(t *testing.T) {
+	var (
+		requests []string
+		labels   map[string]string
+
+		// The tag that the image was built with.
+		build string
+	)
+
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		switch fmt.Sprintf("%s %s", r.Method, r.URL.Path) {
+		case "POST /build":
+			build = q.Get("t")
+			requests = append(requests, fmt.Sprintf("build rm=%s", q.Get("rm")))
+			if err := json.Unmarshal([]byte(q.Get("labels")), &labels); err != nil {
+				t.Errorf("labels => %v", err)
+			}
+			w.Write([]byte(`{"stream":"Step 0 : FROM busybox\n"}`))
+		case "GET /images/" + build + "/json":
+			requests = append(requests, "inspect")
+			w.Write([]byte(`{"Id":"abcd"}`))
+		case "POST /images/" + build + "/tag":
+			requests = append(requests, fmt.Sprintf("tag repo=%s tag=%s", q.Get("repo"), q.Get("tag")))
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE /images/" + build:
+			requests = append(requests, "untag")
+			w.Write([]byte(`[{"Untagged":"` + build + `"}]`))
+		case "POST /images/quay.io/remind101/acme-inc/push":
+			requests = append(requests, fmt.Sprintf("push tag=%s auth=%t", q.Get("tag"), r.Header.Get("X-Registry-Auth") != ""))
+			w.Write([]byte(`{"status":"Pushed"}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	c, s := newTestDockerClient(t, api)
+	defer s.Close()
+
+	b := newDockerBuilder(c, "quay.io/remind101", nil, MapRegistryRouter{
+		"quay.io/": {Username: "bot"},
+	})
+
+	out := new(bytes.Buffer)
+	image, err := b.Build(&App{ID: "1234", Name: "acme-inc"}, bytes.NewReader(nil), "", BuildImageOptions{
+		BuildImageOptions: docker.BuildImageOptions{
+			// The name and remote are always replaced.
+			Name:         "evil/image",
+			Remote:       "https://github.com/evil/image.git",
+			OutputStream: out,
+		},
+		// Provenance labels can't be overridden.
+		Labels: map[string]string{
+			"team":   "platform",
+			LabelApp: "evil",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := image.String(), "quay.io/remind101/acme-inc:abcd"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+
+	want := []string{
+		"build rm=1",
+		"inspect",
+		"tag repo=quay.io/remind101/acme-inc tag=abcd",
+		"untag",
+		"push tag=abcd auth=true",
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Fatalf("requests => %v; want %v", requests, want)
+	}
+
+	if !strings.HasPrefix(build, "quay.io/remind101/acme-inc:build-") {
+		t.Fatalf("build tag => %s; want a tag that's unique to the build", build)
+	}
+
+	if out.Len() == 0 {
+		t.Fatal("expected build output to be written to the OutputStream")
+	}
+
+	wantLabels := map[string]string{
+		"team":      "platform",
+		LabelApp:    "acme-inc",
+		LabelAppID:  "1234",
+		LabelSource: "",
+	}
+	if !reflect.DeepEqual(labels, wantLabels) {
+		t.Fatalf("labels => %v; want %v", labels, wantLabels)
+	}
+}
+
+func TestFakeBuilder(t *testing.T) {
+	b := &fakeBuilder{}
+
+	if _, err := b.Build(&App{Name: "acme-inc"}, bytes.NewReader(nil), "", BuildImageOptions{}); err != ErrBuildsDisabled {
+		t.Fatalf("err => %v; want %v", err, ErrBuildsDisabled)
+	}
+}
@@ -0,0 +1,331 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// CanaryProcessSuffix is appended to the process type of processes that are
+// running a canary release.
+const CanaryProcessSuffix = "-canary"
+
+var (
+	// ErrInvalidCanaryWeight is returned when the canary weight is not
+	// between 1 and 99.
+	ErrInvalidCanaryWeight = &ValidationError{
+		errors.New("Canary weight must be between 1 and 99."),
+	}
+
+	// ErrNoCanary is returned when promoting or rolling back an app that
+	// doesn't have a canary deployment in progress.
+	ErrNoCanary = &ValidationError{
+		errors.New("No canary deployment in progress."),
+	}
+
+	// ErrCanaryInProgress is returned when starting a canary deployment
+	// for an app that already has one in progress.
+	ErrCanaryInProgress = &ValidationError{
+		errors.New("A canary deployment is already in progress."),
+	}
+
+	// ErrCanaryNoRelease is returned when starting a canary deployment for
+	// an app that has never been released.
+	ErrCanaryNoRelease = &ValidationError{
+		errors.New("Canary deployments require an existing release."),
+	}
+)
+
+// CanaryOptions represents options that can be passed when deploying a canary
+// release.
+type CanaryOptions struct {
+	// The percentage of each process' instances that should run the new
+	// release. Must be between 1 and 99.
+	Weight int
+
+	// EventCh will receive deployment events during deployment.
+	EventCh chan Event
+}
+
+// CanaryDeployment tracks a canary release that is running alongside the
+// previous release.
+type CanaryDeployment struct {
+	ID    string
+	AppID string
+
+	// The canary release.
+	ReleaseID string
+
+	// The release that was running before the canary was deployed.
+	PreviousReleaseID string
+
+	Weight    int
+	CreatedAt *time.Time
+}
+
+// Set created_at before inserting.
+func (c *CanaryDeployment) BeforeCreate() error {
+	t := timex.Now()
+	c.CreatedAt = &t
+	return nil
+}
+
+// CanaryDeploymentsQuery is a Scope implementation for common things to filter
+// canary deployments by.
+type CanaryDeploymentsQuery struct {
+	// If provided, finds the canary deployment for the given app.
+	App *App
+}
+
+// Scope implements the Scope interface.
+func (q CanaryDeploymentsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.App != nil {
+		scope = append(scope, ForApp(q.App))
+	}
+
+	return scope.Scope(db)
+}
+
+// CanaryDeploymentsFirst returns the first matching canary deployment.
+func (s *store) CanaryDeploymentsFirst(scope Scope) (*CanaryDeployment, error) {
+	var c CanaryDeployment
+	return &c, s.First(scope, &c)
+}
+
+// CanaryDeploymentsCreate persists the canary deployment.
+func (s *store) CanaryDeploymentsCreate(c *CanaryDeployment) (*CanaryDeployment, error) {
+	if err := s.writable(); err != nil {
+		return c, err
+	}
+
+	return c, s.db.Create(c).Error
+}
+
+// CanaryDeploymentsDestroy destroys the canary deployment.
+func (s *store) CanaryDeploymentsDestroy(c *CanaryDeployment) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	return s.db.Delete(c).Error
+}
+
+// canaryService deploys a new release to a percentage of an apps instances.
+type canaryService struct {
+	store    *store
+	manager  service.Manager
+	apps     *appsService
+	configs  *configsService
+	slugs    *slugsService
+	releases *releasesService
+}
+
+// DeployCanary creates a new release for the image, then schedules it onto
+// opts.Weight percent of the instances for each process. The remaining
+// instances continue to run the current release, which stays the app's active
+// release until the canary is promoted.
+func (s *canaryService) DeployCanary(ctx context.Context, image Image, opts CanaryOptions) (*Release, error) {
+	if opts.Weight < 1 || opts.Weight > 99 {
+		return nil, ErrInvalidCanaryWeight
+	}
+
+	app, err := s.apps.AppsFindOrCreateByRepo(image.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			return nil, ErrCanaryNoRelease
+		}
+		return nil, err
+	}
+
+	if _, err := s.store.CanaryDeploymentsFirst(CanaryDeploymentsQuery{App: app}); err != gorm.RecordNotFound {
+		if err == nil {
+			err = ErrCanaryInProgress
+		}
+		return nil, err
+	}
+
+	config, err := s.configs.ConfigsCurrent(app)
+	if err != nil {
+		return nil, err
+	}
+
+	out := opts.EventCh
+	if out == nil {
+		out = make(chan Event)
+		defer close(out)
+		go func() {
+			for range out {
+			}
+		}()
+	}
+
+	slug, err := s.slugs.SlugsCreateByImage(image, out)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.releases.create(ctx, &Release{
+		App:           app,
+		Config:        config,
+		Slug:          slug,
+		Description:   fmt.Sprintf("Canary deploy %s to %d%%", image.String(), opts.Weight),
+		Status:        ReleaseStatusCanary,
+		SkipStableTag: true,
+	})
+	if err != nil {
+		return release, err
+	}
+
+	if _, err := s.store.ReleaseTagsSet(&ReleaseTag{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Tag:       ReleaseTagCanary,
+	}); err != nil {
+		return release, err
+	}
+
+	if err := s.releases.newProcessPorts(previous); err != nil {
+		return release, err
+	}
+
+	if _, err := s.store.CanaryDeploymentsCreate(&CanaryDeployment{
+		AppID:             app.ID,
+		ReleaseID:         release.ID,
+		PreviousReleaseID: previous.ID,
+		Weight:            opts.Weight,
+	}); err != nil {
+		return release, err
+	}
+
+	return release, s.manager.Submit(ctx, newCanaryServiceApp(previous, release, opts.Weight))
+}
+
+// PromoteCanary schedules the canary release onto all instances, and makes it
+// the app's active release.
+func (s *canaryService) PromoteCanary(ctx context.Context, app *App) error {
+	c, err := s.canary(app)
+	if err != nil {
+		return err
+	}
+
+	release, err := s.store.ReleasesFirst(ReleasesQuery{ID: &c.ReleaseID})
+	if err != nil {
+		return err
+	}
+
+	// The previous release may have been scaled while the canary was
+	// running, so the canary takes the formation that's running now.
+	if err := s.releases.refreshFormation(release); err != nil {
+		return err
+	}
+
+	if err := s.releases.releaser.Release(ctx, release); err != nil {
+		return err
+	}
+
+	if err := s.store.ReleasesPromoteCanary(release); err != nil {
+		return err
+	}
+
+	if err := s.releases.activated(release); err != nil {
+		return err
+	}
+
+	if _, err := s.store.ReleaseTagsSet(&ReleaseTag{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Tag:       ReleaseTagStable,
+	}); err != nil {
+		return err
+	}
+
+	return s.store.CanaryDeploymentsDestroy(c)
+}
+
+// RollbackCanary rolls the app back to the release that was running before
+// the canary was deployed.
+func (s *canaryService) RollbackCanary(ctx context.Context, app *App) error {
+	c, err := s.canary(app)
+	if err != nil {
+		return err
+	}
+
+	previous, err := s.store.ReleasesFirst(ReleasesQuery{ID: &c.PreviousReleaseID})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.releases.ReleasesRollback(ctx, app, previous.Version); err != nil {
+		return err
+	}
+
+	return s.store.CanaryDeploymentsDestroy(c)
+}
+
+func (s *canaryService) canary(app *App) (*CanaryDeployment, error) {
+	c, err := s.store.CanaryDeploymentsFirst(CanaryDeploymentsQuery{App: app})
+	if err == gorm.RecordNotFound {
+		return nil, ErrNoCanary
+	}
+	return c, err
+}
+
+// newCanaryServiceApp returns a service.App that runs the previous release
+// alongside the canary release. Canary processes are submitted as separate
+// processes, with CanaryProcessSuffix appended to the process type. They're
+// marked as canaries, so that their load balancers don't take over the app's
+// CNAME.
+func newCanaryServiceApp(previous, canary *Release, weight int) *service.App {
+	quantities := canaryQuantities(canary.Formation(), weight)
+
+	a := newServiceApp(previous)
+
+	for _, p := range a.Processes {
+		if n, ok := quantities[ProcessType(p.Type)]; ok {
+			if uint(n) > p.Instances {
+				p.Instances = 0
+			} else {
+				p.Instances -= uint(n)
+			}
+		}
+	}
+
+	for _, p := range canary.Processes {
+		cp := newServiceProcess(canary, p)
+		cp.Type = string(p.Type) + CanaryProcessSuffix
+		cp.Canary = true
+		cp.Instances = uint(quantities[p.Type])
+		a.Processes = append(a.Processes, cp)
+	}
+
+	return a
+}
+
+// canaryQuantities returns the number of instances of each process that should
+// run the canary release. Any process with at least one instance will run at
+// least one canary instance.
+func canaryQuantities(f Formation, weight int) ProcessQuantityMap {
+	q := make(ProcessQuantityMap)
+
+	for t, p := range f {
+		n := (p.Quantity*weight + 50) / 100
+		if n == 0 && p.Quantity > 0 {
+			n = 1
+		}
+		q[t] = n
+	}
+
+	return q
+}
@@ -0,0 +1,129 @@
+package empire
+
+import (
+	"testing"
+
+	"github.com/remind101/empire/empire/pkg/service"
+)
+
+func TestCanaryDeploymentsQuery(t *testing.T) {
+	app := &App{ID: "1234"}
+
+	tests := scopeTests{
+		{CanaryDeploymentsQuery{}, "", []interface{}{}},
+		{CanaryDeploymentsQuery{App: app}, "WHERE (app_id = $1)", []interface{}{app.ID}},
+	}
+
+	tests.Run(t)
+}
+
+func TestCanaryQuantities(t *testing.T) {
+	tests := []struct {
+		quantity int
+		weight   int
+		canary   int
+	}{
+		{10, 20, 2},
+		{10, 50, 5},
+		{10, 99, 10},
+		{3, 50, 2},
+		{1, 10, 1},
+		{0, 50, 0},
+	}
+
+	for _, tt := range tests {
+		f := Formation{"web": &Process{Type: "web", Quantity: tt.quantity}}
+
+		if got, want := canaryQuantities(f, tt.weight)["web"], tt.canary; got != want {
+			t.Fatalf("canaryQuantities(%d, %d) => %d; want %d", tt.quantity, tt.weight, got, want)
+		}
+	}
+}
+
+func TestNewCanaryServiceApp(t *testing.T) {
+	app := &App{ID: "1234", Name: "acme-inc"}
+
+	previous := &Release{
+		App:    app,
+		Config: &Config{},
+		Slug:   &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "v1"}},
+		Processes: []*Process{
+			{Type: "web", Quantity: 10},
+			{Type: "worker", Quantity: 1},
+		},
+	}
+
+	canary := &Release{
+		App:    app,
+		Config: &Config{},
+		Slug:   &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "v2"}},
+		Processes: []*Process{
+			{Type: "web", Quantity: 10},
+			{Type: "worker", Quantity: 1},
+		},
+	}
+
+	a := newCanaryServiceApp(previous, canary, 20)
+
+	expected := map[string]struct {
+		image     string
+		instances uint
+		canary    bool
+	}{
+		"web":           {"remind101/acme-inc:v1", 8, false},
+		"worker":        {"remind101/acme-inc:v1", 0, false},
+		"web-canary":    {"remind101/acme-inc:v2", 2, true},
+		"worker-canary": {"remind101/acme-inc:v2", 1, true},
+	}
+
+	assertServiceProcesses(t, a, len(expected), func(p *service.Process) {
+		e, ok := expected[p.Type]
+		if !ok {
+			t.Fatalf("Unexpected process %s", p.Type)
+		}
+
+		if got, want := p.Image, e.image; got != want {
+			t.Fatalf("%s: Image => %s; want %s", p.Type, got, want)
+		}
+
+		if got, want := p.Instances, e.instances; got != want {
+			t.Fatalf("%s: Instances => %d; want %d", p.Type, got, want)
+		}
+
+		if got, want := p.Canary, e.canary; got != want {
+			t.Fatalf("%s: Canary => %v; want %v", p.Type, got, want)
+		}
+	})
+
+	// Promoting the canary runs all instances on the new release.
+	assertServiceProcesses(t, newServiceApp(canary), 2, func(p *service.Process) {
+		if got, want := p.Image, "remind101/acme-inc:v2"; got != want {
+			t.Fatalf("%s: Image => %s; want %s", p.Type, got, want)
+		}
+
+		if p.Type == "web" && p.Instances != 10 {
+			t.Fatalf("web: Instances => %d; want 10", p.Instances)
+		}
+	})
+
+	// Rolling back runs all instances on the previous release.
+	assertServiceProcesses(t, newServiceApp(previous), 2, func(p *service.Process) {
+		if got, want := p.Image, "remind101/acme-inc:v1"; got != want {
+			t.Fatalf("%s: Image => %s; want %s", p.Type, got, want)
+		}
+
+		if p.Type == "web" && p.Instances != 10 {
+			t.Fatalf("web: Instances => %d; want 10", p.Instances)
+		}
+	})
+}
+
+func assertServiceProcesses(t testing.TB, a *service.App, n int, fn func(*service.Process)) {
+	if got, want := len(a.Processes), n; got != want {
+		t.Fatalf("len(Processes) => %d; want %d", got, want)
+	}
+
+	for _, p := range a.Processes {
+		fn(p)
+	}
+}
@@ -0,0 +1,46 @@
+// Package client provides a programmatic interface to Empire for embedding in
+// admin tools, either by calling an Empire instance in the same process or by
+// talking to a remote Empire over its HTTP API.
+package client
+
+import (
+	"github.com/remind101/empire/empire"
+	"golang.org/x/net/context"
+)
+
+// ClientInterface mirrors the methods of empire.Empire that admin tools use.
+// Apps are referenced by name.
+type ClientInterface interface {
+	// AppsAll returns all apps.
+	AppsAll(ctx context.Context) ([]*empire.App, error)
+
+	// AppsCreate creates a new app with the given name.
+	AppsCreate(ctx context.Context, name string) (*empire.App, error)
+
+	// AppsDestroy destroys the app.
+	AppsDestroy(ctx context.Context, app string) error
+
+	// ConfigsCurrent returns the current config vars of the app.
+	ConfigsCurrent(ctx context.Context, app string) (empire.Vars, error)
+
+	// ConfigsApply applies the config vars to the app, returning the new
+	// config vars. A nil value unsets a var.
+	ConfigsApply(ctx context.Context, app string, vars empire.Vars) (empire.Vars, error)
+}
+
+// Client is a ClientInterface that's backed by either an embedded Empire or
+// a remote Empire.
+type Client struct {
+	ClientInterface
+}
+
+// NewEmbedded returns a Client that calls e directly.
+func NewEmbedded(e *empire.Empire) *Client {
+	return &Client{&EmbeddedClient{Empire: e}}
+}
+
+// NewRemote returns a Client that talks to the Empire API at url,
+// authenticating with the access token.
+func NewRemote(url, token string) *Client {
+	return &Client{&RemoteClient{URL: url, Token: token}}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"github.com/remind101/empire/empire"
+	"golang.org/x/net/context"
+)
+
+// EmbeddedClient is a ClientInterface that calls an Empire instance in the same
+// process. Calls aren't made with an access token, so they aren't limited by
+// scopes.
+type EmbeddedClient struct {
+	*empire.Empire
+}
+
+// AppsAll implements the ClientInterface interface.
+func (c *EmbeddedClient) AppsAll(ctx context.Context) ([]*empire.App, error) {
+	return c.Apps(empire.AppsQuery{})
+}
+
+// AppsCreate implements the ClientInterface interface.
+func (c *EmbeddedClient) AppsCreate(ctx context.Context, name string) (*empire.App, error) {
+	return c.Empire.AppsCreate(&empire.App{Name: name})
+}
+
+// AppsDestroy implements the ClientInterface interface.
+func (c *EmbeddedClient) AppsDestroy(ctx context.Context, app string) error {
+	a, err := c.findApp(app)
+	if err != nil {
+		return err
+	}
+
+	return c.Empire.AppsDestroy(ctx, a)
+}
+
+// ConfigsCurrent implements the ClientInterface interface.
+func (c *EmbeddedClient) ConfigsCurrent(ctx context.Context, app string) (empire.Vars, error) {
+	a, err := c.findApp(app)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := c.Empire.ConfigsCurrent(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Vars, nil
+}
+
+// ConfigsApply implements the ClientInterface interface.
+func (c *EmbeddedClient) ConfigsApply(ctx context.Context, app string, vars empire.Vars) (empire.Vars, error) {
+	a, err := c.findApp(app)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := c.Empire.ConfigsApply(ctx, a, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Vars, nil
+}
+
+func (c *EmbeddedClient) findApp(name string) (*empire.App, error) {
+	return c.AppsFirst(empire.AppsQuery{Name: &name})
+}
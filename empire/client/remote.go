@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/remind101/empire/empire"
+	"golang.org/x/net/context"
+)
+
+// acceptHeader is the Accept header that selects the version of the Empire
+// API.
+const acceptHeader = "application/vnd.heroku+json; version=3"
+
+// Error is returned by RemoteClient when the Empire API returns an error.
+type Error struct {
+	// The http status code of the response.
+	Status int
+
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("client: %s (%d): %s", e.ID, e.Status, e.Message)
+}
+
+// RemoteClient is a ClientInterface that talks to Empire over its HTTP API.
+type RemoteClient struct {
+	// The url of the Empire API, e.g. "https://empire.example.com".
+	URL string
+
+	// The access token to authenticate with.
+	Token string
+
+	// The http.Client to use. Defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// app is the API representation of an empire.App.
+type app struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+func (a *app) empireApp() *empire.App {
+	return &empire.App{
+		ID:        a.ID,
+		Name:      a.Name,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+// AppsAll implements the ClientInterface interface.
+func (c *RemoteClient) AppsAll(ctx context.Context) ([]*empire.App, error) {
+	var resp []*app
+	if err := c.do(ctx, "GET", "/apps", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	apps := make([]*empire.App, 0, len(resp))
+	for _, a := range resp {
+		apps = append(apps, a.empireApp())
+	}
+
+	return apps, nil
+}
+
+// AppsCreate implements the ClientInterface interface.
+func (c *RemoteClient) AppsCreate(ctx context.Context, name string) (*empire.App, error) {
+	var resp app
+	if err := c.do(ctx, "POST", "/apps", map[string]string{"name": name}, &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.empireApp(), nil
+}
+
+// AppsDestroy implements the ClientInterface interface.
+func (c *RemoteClient) AppsDestroy(ctx context.Context, app string) error {
+	return c.do(ctx, "DELETE", appPath(app, ""), nil, nil)
+}
+
+// ConfigsCurrent implements the ClientInterface interface.
+func (c *RemoteClient) ConfigsCurrent(ctx context.Context, app string) (empire.Vars, error) {
+	var vars empire.Vars
+	return vars, c.do(ctx, "GET", appPath(app, "/config-vars"), nil, &vars)
+}
+
+// ConfigsApply implements the ClientInterface interface.
+func (c *RemoteClient) ConfigsApply(ctx context.Context, app string, vars empire.Vars) (empire.Vars, error) {
+	var resp empire.Vars
+	return resp, c.do(ctx, "PATCH", appPath(app, "/config-vars"), vars, &resp)
+}
+
+// do makes a request to the API, encoding body as json and decoding the
+// response into v. Error responses are returned as an *Error.
+func (c *RemoteClient) do(ctx context.Context, method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, r)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", acceptHeader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.SetBasicAuth("", c.Token)
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		e := &Error{Status: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+		return e
+	}
+
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// appPath returns the API path of a resource of the app.
+func appPath(app, resource string) string {
+	return "/apps/" + url.QueryEscape(app) + resource
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire"
+	"golang.org/x/net/context"
+)
+
+var (
+	_ ClientInterface = &EmbeddedClient{}
+	_ ClientInterface = &RemoteClient{}
+)
+
+func TestRemoteClient_AppsAll(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/apps" {
+			t.Errorf("request => %s %s; want GET /apps", r.Method, r.URL.Path)
+		}
+
+		if got, want := r.Header.Get("Accept"), acceptHeader; got != want {
+			t.Errorf("Accept => %s; want %s", got, want)
+		}
+
+		if _, token, _ := r.BasicAuth(); token != "token" {
+			t.Errorf("token => %s; want token", token)
+		}
+
+		w.Write([]byte(`[{"id":"1234","name":"acme-inc","created_at":"2015-01-01T00:00:00Z"}]`))
+	}))
+	defer s.Close()
+
+	c := &RemoteClient{URL: s.URL, Token: "token"}
+
+	apps, err := c.AppsAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := []*empire.App{
+		{ID: "1234", Name: "acme-inc", CreatedAt: &createdAt},
+	}
+
+	if !reflect.DeepEqual(apps, want) {
+		t.Fatalf("AppsAll => %v; want %v", apps, want)
+	}
+}
+
+func TestRemoteClient_ConfigsApply(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" || r.URL.Path != "/apps/acme-inc/config-vars" {
+			t.Errorf("request => %s %s; want PATCH /apps/acme-inc/config-vars", r.Method, r.URL.Path)
+		}
+
+		w.Write([]byte(`{"RAILS_ENV":"production"}`))
+	}))
+	defer s.Close()
+
+	c := &RemoteClient{URL: s.URL, Token: "token"}
+	production := "production"
+
+	vars, err := c.ConfigsApply(context.Background(), "acme-inc", empire.Vars{"RAILS_ENV": &production})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := vars["RAILS_ENV"]; got == nil || *got != production {
+		t.Fatalf("RAILS_ENV => %v; want %s", got, production)
+	}
+}
+
+func TestRemoteClient_Error(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"id":"not_found","message":"Request failed, the specified resource does not exist"}`))
+	}))
+	defer s.Close()
+
+	c := &RemoteClient{URL: s.URL, Token: "token"}
+
+	err := c.AppsDestroy(context.Background(), "acme-inc")
+
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("err => %v; want an *Error", err)
+	}
+
+	if e.Status != http.StatusNotFound || e.ID != "not_found" {
+		t.Fatalf("Error => %d %s; want 404 not_found", e.Status, e.ID)
+	}
+}
@@ -22,16 +22,24 @@ const (
 	FlagGithubSecret = "github.client.secret"
 	FlagGithubOrg    = "github.organization"
 
-	FlagDBPath = "path"
-	FlagDB     = "db"
+	FlagJWTSecret = "jwt.secret"
+
+	FlagDBPath    = "path"
+	FlagDB        = "db"
+	FlagDBReplica = "db.replica"
+	FlagDBMonitor = "db.monitor"
 
 	FlagDockerSocket = "docker.socket"
 	FlagDockerCert   = "docker.cert"
 	FlagDockerAuth   = "docker.auth"
+	FlagDockerOrg    = "docker.organization"
 
 	FlagAWSDebug       = "aws.debug"
 	FlagECSCluster     = "ecs.cluster"
 	FlagECSServiceRole = "ecs.service.role"
+	FlagECSConcurrency = "ecs.concurrency"
+
+	FlagSchedulerTimeout = "scheduler.timeout"
 
 	FlagELBSGPrivate = "elb.sg.private"
 	FlagELBSGPublic  = "elb.sg.public"
@@ -41,7 +49,26 @@ const (
 
 	FlagRoute53InternalZoneID = "route53.zoneid.internal"
 
-	FlagSecret   = "secret"
+	FlagConfigMaxValueBytes = "config.max.value.bytes"
+	FlagConfigMaxTotalBytes = "config.max.total.bytes"
+
+	FlagTarballHosts = "tarball.hosts"
+
+	FlagSlackWebhook        = "slack.webhook"
+	FlagPagerDutyRoutingKey = "pagerduty.routingkey"
+
+	FlagSecret           = "secret"
+	FlagSecondarySecrets = "secret.secondary"
+
+	FlagGCInterval        = "gc.interval"
+	FlagCrashLoopDetector = "crashloop.detector"
+	FlagSLOController     = "slo.controller"
+	FlagWebhookRetrier    = "webhooks.retry"
+	FlagConfigKeyExpirer  = "config.expire"
+
+	FlagTelemetryService     = "telemetry.service"
+	FlagTelemetryEnvironment = "telemetry.environment"
+
 	FlagReporter = "reporter"
 	FlagRunner   = "runner"
 )
@@ -81,6 +108,12 @@ var Commands = []cli.Command{
 				Usage:  "The organization to allow access to",
 				EnvVar: "EMPIRE_GITHUB_ORGANIZATION",
 			},
+			cli.StringFlag{
+				Name:   FlagJWTSecret,
+				Value:  "",
+				Usage:  "If set, users can authenticate with a Bearer JWT signed with this secret",
+				EnvVar: "EMPIRE_JWT_SECRET",
+			},
 		}, append(EmpireFlags, DBFlags...)...),
 		Action: runServer,
 	},
@@ -107,6 +140,17 @@ var DBFlags = []cli.Flag{
 }
 
 var EmpireFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   FlagDBReplica,
+		Value:  "",
+		Usage:  "SQL connection string for a read replica of the database, used while the primary is unavailable",
+		EnvVar: "EMPIRE_DATABASE_REPLICA_URL",
+	},
+	cli.BoolFlag{
+		Name:   FlagDBMonitor,
+		Usage:  "Ping the database in the background, and switch to read-only mode while the primary is unavailable",
+		EnvVar: "EMPIRE_DATABASE_MONITOR",
+	},
 	cli.StringFlag{
 		Name:   FlagDockerSocket,
 		Value:  "unix:///var/run/docker.sock",
@@ -125,6 +169,12 @@ var EmpireFlags = []cli.Flag{
 		Usage:  "Path to a docker registry auth file (~/.dockercfg)",
 		EnvVar: "DOCKER_AUTH_PATH",
 	},
+	cli.StringFlag{
+		Name:   FlagDockerOrg,
+		Value:  "",
+		Usage:  "The organization that images built from a Dockerfile are pushed to, e.g. quay.io/remind101",
+		EnvVar: "EMPIRE_DOCKER_ORGANIZATION",
+	},
 	cli.BoolFlag{
 		Name:   FlagAWSDebug,
 		Usage:  "Enable verbose debug output for AWS integration.",
@@ -142,6 +192,18 @@ var EmpireFlags = []cli.Flag{
 		Usage:  "The ECS cluster to create services within",
 		EnvVar: "EMPIRE_ECS_SERVICE_ROLE",
 	},
+	cli.IntFlag{
+		Name:   FlagECSConcurrency,
+		Value:  empire.DefaultOptions.MaxSchedulerConcurrency,
+		Usage:  "The maximum number of process types to update in ECS at the same time",
+		EnvVar: "EMPIRE_ECS_CONCURRENCY",
+	},
+	cli.DurationFlag{
+		Name:   FlagSchedulerTimeout,
+		Value:  empire.DefaultOptions.SchedulerQueryTimeout,
+		Usage:  "The maximum time that queries to the scheduler for the state of an app can take",
+		EnvVar: "EMPIRE_SCHEDULER_TIMEOUT",
+	},
 	cli.StringFlag{
 		Name:   FlagELBSGPrivate,
 		Value:  "",
@@ -166,12 +228,86 @@ var EmpireFlags = []cli.Flag{
 		Usage:  "The comma separated public subnet ids",
 		EnvVar: "EMPIRE_EC2_SUBNETS_PUBLIC",
 	},
+	cli.IntFlag{
+		Name:   FlagConfigMaxValueBytes,
+		Value:  empire.DefaultMaxConfigValueBytes,
+		Usage:  "The maximum size of a single config var value in bytes. 0 disables the limit.",
+		EnvVar: "EMPIRE_CONFIG_MAX_VALUE_BYTES",
+	},
+	cli.IntFlag{
+		Name:   FlagConfigMaxTotalBytes,
+		Value:  empire.DefaultMaxTotalConfigBytes,
+		Usage:  "The maximum size of all of an apps config vars combined in bytes. 0 disables the limit.",
+		EnvVar: "EMPIRE_CONFIG_MAX_TOTAL_BYTES",
+	},
+	cli.StringSliceFlag{
+		Name:   FlagTarballHosts,
+		Value:  &cli.StringSlice{},
+		Usage:  "The comma separated hosts that apps can be deployed from tarballs on",
+		EnvVar: "EMPIRE_TARBALL_HOSTS",
+	},
+	cli.StringFlag{
+		Name:   FlagSlackWebhook,
+		Value:  "",
+		Usage:  "If provided, a Slack incoming webhook url to send notifications to",
+		EnvVar: "EMPIRE_SLACK_WEBHOOK",
+	},
+	cli.StringFlag{
+		Name:   FlagPagerDutyRoutingKey,
+		Value:  "",
+		Usage:  "If provided, a PagerDuty integration key to send notifications to",
+		EnvVar: "EMPIRE_PAGERDUTY_ROUTING_KEY",
+	},
 	cli.StringFlag{
 		Name:   FlagSecret,
 		Value:  "<change this>",
 		Usage:  "The secret used to sign access tokens",
 		EnvVar: "EMPIRE_TOKEN_SECRET",
 	},
+	cli.StringSliceFlag{
+		Name:   FlagSecondarySecrets,
+		Value:  &cli.StringSlice{},
+		Usage:  "Previous secrets that access tokens may have been signed with. Used when rotating the secret",
+		EnvVar: "EMPIRE_TOKEN_SECRET_SECONDARY",
+	},
+	cli.DurationFlag{
+		Name:   FlagGCInterval,
+		Value:  0,
+		Usage:  "If set, how often to delete slugs whose images no longer exist in the registry",
+		EnvVar: "EMPIRE_GC_INTERVAL",
+	},
+	cli.BoolFlag{
+		Name:   FlagCrashLoopDetector,
+		Usage:  "Check for crash looping processes in the background, and roll back apps that match their crash loop policy",
+		EnvVar: "EMPIRE_CRASHLOOP_DETECTOR",
+	},
+	cli.BoolFlag{
+		Name:   FlagSLOController,
+		Usage:  "Evaluate deploy frequency targets in the background, and notify about apps that miss them",
+		EnvVar: "EMPIRE_SLO_CONTROLLER",
+	},
+	cli.BoolFlag{
+		Name:   FlagWebhookRetrier,
+		Usage:  "Retry failed webhook deliveries in the background",
+		EnvVar: "EMPIRE_WEBHOOKS_RETRY",
+	},
+	cli.BoolFlag{
+		Name:   FlagConfigKeyExpirer,
+		Usage:  "Unset config keys whose TTL has expired in the background",
+		EnvVar: "EMPIRE_CONFIG_EXPIRE",
+	},
+	cli.StringFlag{
+		Name:   FlagTelemetryService,
+		Value:  "",
+		Usage:  "If set, the service name to attach to logs, along with the attributes of the host that Empire is running on",
+		EnvVar: "EMPIRE_TELEMETRY_SERVICE",
+	},
+	cli.StringFlag{
+		Name:   FlagTelemetryEnvironment,
+		Value:  "",
+		Usage:  "The environment to attach to logs when telemetry is enabled, e.g. production",
+		EnvVar: "EMPIRE_TELEMETRY_ENVIRONMENT",
+	},
 	cli.StringFlag{
 		Name:   FlagReporter,
 		Value:  "",
@@ -207,6 +343,7 @@ func newEmpire(c *cli.Context) (*empire.Empire, error) {
 
 	opts.Docker.Socket = c.String(FlagDockerSocket)
 	opts.Docker.CertPath = c.String(FlagDockerCert)
+	opts.Docker.Organization = c.String(FlagDockerOrg)
 	opts.Runner.API = c.String(FlagRunner)
 	opts.AWSConfig = aws.DefaultConfig
 	if c.Bool(FlagAWSDebug) {
@@ -214,13 +351,27 @@ func newEmpire(c *cli.Context) (*empire.Empire, error) {
 	}
 	opts.ECS.Cluster = c.String(FlagECSCluster)
 	opts.ECS.ServiceRole = c.String(FlagECSServiceRole)
+	opts.MaxSchedulerConcurrency = c.Int(FlagECSConcurrency)
+	opts.SchedulerQueryTimeout = c.Duration(FlagSchedulerTimeout)
 	opts.ELB.InternalSecurityGroupID = c.String(FlagELBSGPrivate)
 	opts.ELB.ExternalSecurityGroupID = c.String(FlagELBSGPublic)
 	opts.ELB.InternalSubnetIDs = c.StringSlice(FlagEC2SubnetsPrivate)
 	opts.ELB.ExternalSubnetIDs = c.StringSlice(FlagEC2SubnetsPublic)
 	opts.ELB.InternalZoneID = c.String(FlagRoute53InternalZoneID)
 	opts.DB = c.String(FlagDB)
+	opts.ReplicaDB = c.String(FlagDBReplica)
 	opts.Secret = c.String(FlagSecret)
+	opts.SecondarySecrets = c.StringSlice(FlagSecondarySecrets)
+	opts.MaxConfigValueBytes = c.Int(FlagConfigMaxValueBytes)
+	opts.MaxTotalConfigBytes = c.Int(FlagConfigMaxTotalBytes)
+	opts.TarballAllowedHosts = c.StringSlice(FlagTarballHosts)
+
+	if u := c.String(FlagSlackWebhook); u != "" {
+		opts.NotificationChannels = append(opts.NotificationChannels, &empire.SlackNotificationChannel{URL: u})
+	}
+	if k := c.String(FlagPagerDutyRoutingKey); k != "" {
+		opts.NotificationChannels = append(opts.NotificationChannels, &empire.PagerDutyNotificationChannel{RoutingKey: k})
+	}
 
 	auth, err := dockerAuth(c.String(FlagDockerAuth))
 	if err != nil {
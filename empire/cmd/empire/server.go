@@ -3,10 +3,12 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/remind101/empire/empire"
 	"github.com/remind101/empire/empire/server"
+	"golang.org/x/net/context"
 )
 
 func runServer(c *cli.Context) {
@@ -21,16 +23,85 @@ func runServer(c *cli.Context) {
 		log.Fatal(err)
 	}
 
+	if err := configureTelemetry(context.Background(), c, e); err != nil {
+		log.Fatal(err)
+	}
+
+	startWorkers(context.Background(), c, e)
+
 	s := newServer(c, e)
 	log.Printf("Starting on port %s", port)
 	log.Fatal(http.ListenAndServe(":"+port, s))
 }
 
+// workers are the background processes that Empire can run alongside the
+// server.
+type workers interface {
+	StartAppsDestroySweeper(context.Context)
+	StartStoreMonitor(context.Context)
+	StartGarbageCollector(context.Context, time.Duration)
+	StartCrashLoopDetector(context.Context)
+	StartSLOController(context.Context)
+	StartWebhookRetrier(context.Context)
+	StartConfigKeyExpirer(context.Context)
+}
+
+// startWorkers starts the background processes that are enabled by flags.
+func startWorkers(ctx context.Context, c *cli.Context, w workers) {
+	// Apps that were scheduled to be destroyed are destroyed by whichever
+	// Empire instance notices first.
+	w.StartAppsDestroySweeper(ctx)
+
+	if c.Bool(FlagDBMonitor) {
+		w.StartStoreMonitor(ctx)
+	}
+
+	if d := c.Duration(FlagGCInterval); d > 0 {
+		w.StartGarbageCollector(ctx, d)
+	}
+
+	if c.Bool(FlagCrashLoopDetector) {
+		w.StartCrashLoopDetector(ctx)
+	}
+
+	if c.Bool(FlagSLOController) {
+		w.StartSLOController(ctx)
+	}
+
+	if c.Bool(FlagWebhookRetrier) {
+		w.StartWebhookRetrier(ctx)
+	}
+
+	if c.Bool(FlagConfigKeyExpirer) {
+		w.StartConfigKeyExpirer(ctx)
+	}
+}
+
+// telemetryConfigurer attaches attributes of the environment that Empire is
+// running in to its logs.
+type telemetryConfigurer interface {
+	ConfigureTelemetry(context.Context, empire.TelemetryOptions) error
+}
+
+// configureTelemetry configures telemetry if a service name was provided.
+func configureTelemetry(ctx context.Context, c *cli.Context, t telemetryConfigurer) error {
+	name := c.String(FlagTelemetryService)
+	if name == "" {
+		return nil
+	}
+
+	return t.ConfigureTelemetry(ctx, empire.TelemetryOptions{
+		ServiceName: name,
+		Environment: c.String(FlagTelemetryEnvironment),
+	})
+}
+
 func newServer(c *cli.Context, e *empire.Empire) http.Handler {
 	opts := server.Options{}
 	opts.GitHub.ClientID = c.String(FlagGithubClient)
 	opts.GitHub.ClientSecret = c.String(FlagGithubSecret)
 	opts.GitHub.Organization = c.String(FlagGithubOrg)
+	opts.JWTSecret = c.String(FlagJWTSecret)
 
 	return server.New(e, opts)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/remind101/empire/empire"
+	"golang.org/x/net/context"
+)
+
+func TestStartWorkers(t *testing.T) {
+	tests := []struct {
+		args    []string
+		started []string
+	}{
+		{nil, []string{"AppsDestroySweeper"}},
+		{[]string{"--" + FlagDBMonitor}, []string{"AppsDestroySweeper", "StoreMonitor"}},
+		{[]string{"--" + FlagGCInterval, "1h"}, []string{"AppsDestroySweeper", "GarbageCollector"}},
+		{[]string{"--" + FlagCrashLoopDetector}, []string{"AppsDestroySweeper", "CrashLoopDetector"}},
+		{[]string{"--" + FlagSLOController}, []string{"AppsDestroySweeper", "SLOController"}},
+		{[]string{"--" + FlagWebhookRetrier}, []string{"AppsDestroySweeper", "WebhookRetrier"}},
+		{[]string{"--" + FlagConfigKeyExpirer}, []string{"AppsDestroySweeper", "ConfigKeyExpirer"}},
+	}
+
+	for _, tt := range tests {
+		w := new(fakeWorkers)
+		startWorkers(context.Background(), newContext(t, tt.args), w)
+
+		if got, want := w.started, tt.started; !reflect.DeepEqual(got, want) {
+			t.Errorf("startWorkers(%v) => %v; want %v", tt.args, got, want)
+		}
+	}
+}
+
+func TestConfigureTelemetry(t *testing.T) {
+	tests := []struct {
+		args []string
+		opts *empire.TelemetryOptions
+	}{
+		{nil, nil},
+		{[]string{"--" + FlagTelemetryEnvironment, "production"}, nil},
+		{[]string{"--" + FlagTelemetryService, "empire", "--" + FlagTelemetryEnvironment, "production"}, &empire.TelemetryOptions{
+			ServiceName: "empire",
+			Environment: "production",
+		}},
+	}
+
+	for _, tt := range tests {
+		c := new(fakeTelemetryConfigurer)
+		if err := configureTelemetry(context.Background(), newContext(t, tt.args), c); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := c.opts, tt.opts; !reflect.DeepEqual(got, want) {
+			t.Errorf("configureTelemetry(%v) => %v; want %v", tt.args, got, want)
+		}
+	}
+}
+
+// newContext returns a cli.Context for the server command, with the given
+// arguments parsed.
+func newContext(t testing.TB, args []string) *cli.Context {
+	set := flag.NewFlagSet("server", flag.ContinueOnError)
+	for _, f := range Commands[0].Flags {
+		f.Apply(set)
+	}
+
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return cli.NewContext(nil, set, set)
+}
+
+// fakeWorkers records the background processes that are started.
+type fakeWorkers struct {
+	started []string
+}
+
+func (w *fakeWorkers) StartAppsDestroySweeper(ctx context.Context) {
+	w.started = append(w.started, "AppsDestroySweeper")
+}
+
+func (w *fakeWorkers) StartStoreMonitor(ctx context.Context) {
+	w.started = append(w.started, "StoreMonitor")
+}
+
+func (w *fakeWorkers) StartGarbageCollector(ctx context.Context, interval time.Duration) {
+	w.started = append(w.started, "GarbageCollector")
+}
+
+func (w *fakeWorkers) StartCrashLoopDetector(ctx context.Context) {
+	w.started = append(w.started, "CrashLoopDetector")
+}
+
+func (w *fakeWorkers) StartSLOController(ctx context.Context) {
+	w.started = append(w.started, "SLOController")
+}
+
+func (w *fakeWorkers) StartWebhookRetrier(ctx context.Context) {
+	w.started = append(w.started, "WebhookRetrier")
+}
+
+func (w *fakeWorkers) StartConfigKeyExpirer(ctx context.Context) {
+	w.started = append(w.started, "ConfigKeyExpirer")
+}
+
+// fakeTelemetryConfigurer records the options that telemetry was configured
+// with.
+type fakeTelemetryConfigurer struct {
+	opts *empire.TelemetryOptions
+}
+
+func (c *fakeTelemetryConfigurer) ConfigureTelemetry(ctx context.Context, opts empire.TelemetryOptions) error {
+	c.opts = &opts
+	return nil
+}
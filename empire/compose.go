@@ -0,0 +1,139 @@
+package empire
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
+)
+
+// ComposeOverrides maps a docker-compose service name to a tag that replaces
+// the tag of the service's image, e.g. to deploy a specific build.
+type ComposeOverrides map[string]string
+
+// composeFile is the subset of a docker-compose.yml that's used to create
+// slugs.
+type composeFile struct {
+	Services map[string]composeService `yaml:"services"`
+}
+
+// composeService is a service in a docker-compose.yml.
+type composeService struct {
+	Image string `yaml:"image"`
+
+	// Either a string or a list of arguments.
+	Command interface{} `yaml:"command"`
+}
+
+// command returns the service's command as a single string. A list of
+// arguments is joined with spaces.
+func (s composeService) command() (Command, error) {
+	switch c := s.Command.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return Command(c), nil
+	case []interface{}:
+		var args []string
+		for _, a := range c {
+			args = append(args, fmt.Sprint(a))
+		}
+		return Command(strings.Join(args, " ")), nil
+	default:
+		return "", fmt.Errorf("command must be a string or a list, got %v", c)
+	}
+}
+
+// parseComposeSlugs parses a docker-compose.yml into a Slug for each service,
+// sorted by service name. The service name is the slug's only process type.
+func parseComposeSlugs(r io.Reader, overrides ComposeOverrides) ([]*Slug, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var f composeFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, &ParseError{err}
+	}
+
+	if len(f.Services) == 0 {
+		return nil, &ParseError{fmt.Errorf("no services defined")}
+	}
+
+	for name := range overrides {
+		if _, ok := f.Services[name]; !ok {
+			return nil, &ParseError{fmt.Errorf("override for unknown service %s", name)}
+		}
+	}
+
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var slugs []*Slug
+	for _, name := range names {
+		service := f.Services[name]
+
+		image, err := decodeImage(service.Image)
+		if err != nil {
+			return nil, &ParseError{fmt.Errorf("service %s: %v", name, err)}
+		}
+
+		if tag, ok := overrides[name]; ok {
+			image.ID = tag
+		}
+
+		command, err := service.command()
+		if err != nil {
+			return nil, &ParseError{fmt.Errorf("service %s: %v", name, err)}
+		}
+
+		slugs = append(slugs, &Slug{
+			Image:        image,
+			ProcessTypes: CommandMap{ProcessType(name): command},
+		})
+	}
+
+	return slugs, nil
+}
+
+// SlugsCreateFromCompose creates a Slug for each service in a
+// docker-compose.yml. Each image is resolved, pulling it, before any of the
+// slugs are created, and the slugs are created together, so nothing is created
+// if the file can't be parsed or any image can't be resolved.
+func (s *slugsService) SlugsCreateFromCompose(ctx context.Context, app *App, r io.Reader, overrides ComposeOverrides) ([]*Slug, error) {
+	slugs, err := parseComposeSlugs(r, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nobody is interested in the events from pulling the images.
+	out := make(chan Event)
+	go func() {
+		for range out {
+		}
+	}()
+	defer close(out)
+
+	// The process types of these slugs come from the compose file, not
+	// the image, so ResolvedImageID is left empty to keep
+	// SlugsCreateByImage from reusing them for the image.
+	for _, slug := range slugs {
+		if _, err := s.resolver.Resolve(slug.Image, out); err != nil {
+			return nil, fmt.Errorf("resolving %s: %v", slug.Image, err)
+		}
+	}
+
+	if err := s.store.SlugsCreateAll(slugs); err != nil {
+		return nil, fmt.Errorf("creating slugs for %s: %v", app.Name, err)
+	}
+
+	return slugs, nil
+}
@@ -0,0 +1,75 @@
+package empire
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testComposeFile = `
+version: "2"
+services:
+  web:
+    image: remind101/acme-inc:v1
+    command: ./bin/web
+  worker:
+    image: remind101/acme-worker
+    command: ["./bin/worker", "--queue", "default"]
+`
+
+func TestParseComposeSlugs(t *testing.T) {
+	slugs, err := parseComposeSlugs(strings.NewReader(testComposeFile), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Slug{
+		{
+			Image:        Image{Repo: "remind101/acme-inc", ID: "v1"},
+			ProcessTypes: CommandMap{"web": "./bin/web"},
+		},
+		{
+			Image:        Image{Repo: "remind101/acme-worker", ID: DefaultTag},
+			ProcessTypes: CommandMap{"worker": "./bin/worker --queue default"},
+		},
+	}
+
+	if !reflect.DeepEqual(slugs, expected) {
+		t.Fatalf("Slugs => %v; want %v", slugs, expected)
+	}
+}
+
+func TestParseComposeSlugs_Overrides(t *testing.T) {
+	slugs, err := parseComposeSlugs(strings.NewReader(testComposeFile), ComposeOverrides{"worker": "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := slugs[0].Image.String(), "remind101/acme-inc:v1"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+
+	if got, want := slugs[1].Image.String(), "remind101/acme-worker:v2"; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+}
+
+func TestParseComposeSlugs_Errors(t *testing.T) {
+	tests := []struct {
+		in        string
+		overrides ComposeOverrides
+	}{
+		{`services: [`, nil},
+		{`version: "2"`, nil},
+		{"services:\n  web:\n    command: ./bin/web\n", nil},
+		{"services:\n  web:\n    image: remind101/acme-inc\n    command: {a: b}\n", nil},
+		{testComposeFile, ComposeOverrides{"clock": "v2"}},
+	}
+
+	for _, tt := range tests {
+		_, err := parseComposeSlugs(strings.NewReader(tt.in), tt.overrides)
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("parseComposeSlugs(%q) => %v; want a ParseError", tt.in, err)
+		}
+	}
+}
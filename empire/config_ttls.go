@@ -0,0 +1,267 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// DefaultConfigKeyExpireInterval is how often the ConfigKeyExpirer checks for
+// expired config keys.
+var DefaultConfigKeyExpireInterval = time.Minute
+
+// ErrInvalidConfigKeyTTL is returned when setting a TTL that isn't positive.
+var ErrInvalidConfigKeyTTL = &ValidationError{
+	errors.New("TTL must be greater than 0."),
+}
+
+// ConfigKeyTTL is a config var that is unset when it expires, e.g. temporary
+// credentials.
+type ConfigKeyTTL struct {
+	ID        string
+	AppID     string
+	Key       string
+	ExpiresAt time.Time
+}
+
+// ConfigKeyTTLsQuery is a Scope implementation for common things to filter
+// config key TTLs by.
+type ConfigKeyTTLsQuery struct {
+	// If provided, filters TTLs for the given app.
+	App *App
+
+	// If provided, finds TTLs that expire at or before the given time.
+	ExpiresBefore *time.Time
+}
+
+// Scope implements the Scope interface.
+func (q ConfigKeyTTLsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.App != nil {
+		scope = append(scope, ForApp(q.App))
+	}
+
+	if q.ExpiresBefore != nil {
+		t := *q.ExpiresBefore
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("expires_at <= ?", t)
+		}))
+	}
+
+	return scope.Scope(db)
+}
+
+// ConfigKeyTTLs returns all config key TTLs matching the scope.
+func (s *store) ConfigKeyTTLs(scope Scope) ([]*ConfigKeyTTL, error) {
+	var ttls []*ConfigKeyTTL
+	scope = ComposedScope{scope, Order("expires_at")}
+	return ttls, s.Find(scope, &ttls)
+}
+
+// ConfigKeyTTLsSet sets when the key expires, replacing any existing TTL for
+// the key.
+func (s *store) ConfigKeyTTLsSet(ttl *ConfigKeyTTL) (*ConfigKeyTTL, error) {
+	if err := s.writable(); err != nil {
+		return ttl, err
+	}
+
+	t := s.db.Begin()
+
+	if err := t.Where("app_id = ? and key = ?", ttl.AppID, ttl.Key).Delete(ConfigKeyTTL{}).Error; err != nil {
+		t.Rollback()
+		return ttl, err
+	}
+
+	if err := t.Create(ttl).Error; err != nil {
+		t.Rollback()
+		return ttl, err
+	}
+
+	return ttl, t.Commit().Error
+}
+
+// ConfigKeyTTLsExpire locks the TTLs of the app that expire at or before
+// expiresBefore, skipping any that another Empire instance is already
+// expiring, and calls expire with the app and the TTLs, which are removed if
+// it succeeds. Apps that are scheduled to be destroyed are included, so their
+// keys are still unset if the destroy is cancelled. If the app no longer
+// exists, the TTLs are removed without calling expire.
+func (s *store) ConfigKeyTTLsExpire(appID string, expiresBefore time.Time, expire func(*App, []*ConfigKeyTTL) error) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	rows, err := t.Raw(`select id, app_id, key, expires_at from config_key_ttls where app_id = ? and expires_at <= ? order by expires_at for update skip locked`, appID, expiresBefore).Rows()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	var ttls []*ConfigKeyTTL
+	for rows.Next() {
+		var ttl ConfigKeyTTL
+		if err = rows.Scan(&ttl.ID, &ttl.AppID, &ttl.Key, &ttl.ExpiresAt); err != nil {
+			break
+		}
+		ttls = append(ttls, &ttl)
+	}
+	rows.Close()
+
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	if len(ttls) == 0 {
+		t.Rollback()
+		return nil
+	}
+
+	// The app is hidden from AppsQuery while its destroy is pending.
+	var app App
+	err = t.Where("id = ?", appID).First(&app).Error
+	if err != nil && err != gorm.RecordNotFound {
+		t.Rollback()
+		return err
+	}
+
+	if err == nil {
+		if err := expire(&app, ttls); err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	for _, ttl := range ttls {
+		if err := t.Where("id = ?", ttl.ID).Delete(ConfigKeyTTL{}).Error; err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	return t.Commit().Error
+}
+
+// ConfigsKeySetTTL sets the config key to be unset after ttl.
+func (s *configsService) ConfigsKeySetTTL(app *App, key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrInvalidConfigKeyTTL
+	}
+
+	_, err := s.store.ConfigKeyTTLsSet(&ConfigKeyTTL{
+		AppID:     app.ID,
+		Key:       key,
+		ExpiresAt: timex.Now().Add(ttl),
+	})
+	return err
+}
+
+// ConfigKeyExpirer unsets config keys when their TTL expires.
+type ConfigKeyExpirer struct {
+	// How often to check for expired keys. Defaults to
+	// DefaultConfigKeyExpireInterval.
+	Interval time.Duration
+
+	store   *store
+	configs *configsService
+}
+
+// Run expires keys every Interval until the context is cancelled.
+func (e *ConfigKeyExpirer) Run(ctx context.Context) {
+	interval := e.Interval
+	if interval == 0 {
+		interval = DefaultConfigKeyExpireInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := e.Expire(ctx); err != nil {
+				reporter.Report(ctx, err)
+			}
+		}
+	}
+}
+
+// ConfigKeyExpireError is returned by Expire when the expired keys of any app
+// couldn't be unset. It contains the error for each app, by id.
+type ConfigKeyExpireError struct {
+	Errors map[string]error
+}
+
+func (e *ConfigKeyExpireError) Error() string {
+	var problems []string
+	for id, err := range e.Errors {
+		problems = append(problems, fmt.Sprintf("%s: %v", id, err))
+	}
+	sort.Strings(problems)
+	return fmt.Sprintf("config keys were not expired: %s", strings.Join(problems, ", "))
+}
+
+// Expire unsets every key that has expired. The expired keys of each app are
+// unset together, creating a single new config version. An app that fails
+// doesn't prevent the keys of other apps from being unset; the failures are
+// returned together as a ConfigKeyExpireError.
+func (e *ConfigKeyExpirer) Expire(ctx context.Context) error {
+	now := timex.Now()
+
+	ttls, err := e.store.ConfigKeyTTLs(ConfigKeyTTLsQuery{ExpiresBefore: &now})
+	if err != nil {
+		return err
+	}
+
+	byApp := make(map[string]bool)
+	var appIDs []string
+	for _, ttl := range ttls {
+		if !byApp[ttl.AppID] {
+			byApp[ttl.AppID] = true
+			appIDs = append(appIDs, ttl.AppID)
+		}
+	}
+	sort.Strings(appIDs)
+
+	errs := make(map[string]error)
+	for _, id := range appIDs {
+		if err := e.expire(ctx, id, now); err != nil {
+			errs[id] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ConfigKeyExpireError{Errors: errs}
+	}
+
+	return nil
+}
+
+// expire unsets the expired keys for the app, then removes their TTLs. The
+// TTLs are only removed without unsetting the keys once the app is gone.
+func (e *ConfigKeyExpirer) expire(ctx context.Context, appID string, expiresBefore time.Time) error {
+	return e.store.ConfigKeyTTLsExpire(appID, expiresBefore, func(app *App, ttls []*ConfigKeyTTL) error {
+		vars := make(Vars)
+		for _, ttl := range ttls {
+			vars[Variable(ttl.Key)] = nil
+		}
+
+		if _, err := e.configs.ConfigsApply(ctx, app, vars); err != nil {
+			return fmt.Errorf("expiring config keys for %s: %v", app.Name, err)
+		}
+
+		return nil
+	})
+}
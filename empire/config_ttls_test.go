@@ -0,0 +1,31 @@
+package empire
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConfigKeyTTLsQuery(t *testing.T) {
+	app := &App{ID: "1234"}
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := scopeTests{
+		{ConfigKeyTTLsQuery{}, "", []interface{}{}},
+		{ConfigKeyTTLsQuery{App: app}, "WHERE (app_id = $1)", []interface{}{app.ID}},
+		{ConfigKeyTTLsQuery{ExpiresBefore: &now}, "WHERE (expires_at <= $1)", []interface{}{now}},
+	}
+
+	tests.Run(t)
+}
+
+func TestConfigKeyExpireError(t *testing.T) {
+	err := &ConfigKeyExpireError{Errors: map[string]error{
+		"5678": errors.New("boom"),
+		"1234": ErrStoreReadOnly,
+	}}
+
+	if got, want := err.Error(), "config keys were not expired: 1234: "+ErrStoreReadOnly.Error()+", 5678: boom"; got != want {
+		t.Fatalf("Error() => %q; want %q", got, want)
+	}
+}
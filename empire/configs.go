@@ -3,12 +3,20 @@ package empire
 import (
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/jinzhu/gorm"
 	"github.com/lib/pq/hstore"
 	"golang.org/x/net/context"
+	"gopkg.in/yaml.v2"
 )
 
 // Config represents a collection of environment variables.
@@ -16,18 +24,35 @@ type Config struct {
 	ID   string
 	Vars Vars
 
+	// Version is a monotonically increasing, per app, version number.
+	Version int
+
+	// Frozen marks the config as immutable. Applying new config vars on top
+	// of a frozen config always creates a new, unfrozen, config.
+	Frozen bool
+
+	// VarOrder is the order that Vars are set in the environment of
+	// processes, for vars whose values reference other vars. Vars that
+	// aren't listed are set after, alphabetically.
+	VarOrder VarOrder
+
+	// Resolved is true when secret references in Vars have been replaced
+	// with their values. Resolved configs should never be stored.
+	Resolved bool `sql:"-"`
+
 	AppID string
 	App   *App
 }
 
 // NewConfig initializes a new config based on the old config, with the new
-// variables provided.
+// variables provided. The new config is never frozen, even if the old one is.
 func NewConfig(old *Config, vars Vars) *Config {
 	v := mergeVars(old.Vars, vars)
 
 	return &Config{
-		AppID: old.AppID,
-		Vars:  v,
+		AppID:    old.AppID,
+		Vars:     v,
+		VarOrder: old.VarOrder,
 	}
 }
 
@@ -76,6 +101,36 @@ func (v Vars) Value() (driver.Value, error) {
 	return h.Value()
 }
 
+// VarOrder is an ordered list of the names of config vars.
+type VarOrder []string
+
+// Scan implements the sql.Scanner interface.
+func (o *VarOrder) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into VarOrder", src)
+	}
+
+	var order []string
+	if err := json.Unmarshal(b, &order); err != nil {
+		return err
+	}
+
+	*o = order
+
+	return nil
+}
+
+// Value implements the driver.Value interface.
+func (o VarOrder) Value() (driver.Value, error) {
+	if o == nil {
+		o = VarOrder{}
+	}
+
+	b, err := json.Marshal([]string(o))
+	return driver.Value(b), err
+}
+
 // ConfigsQuery is a Scope implementation for common things to filter releases
 // by.
 type ConfigsQuery struct {
@@ -84,6 +139,9 @@ type ConfigsQuery struct {
 
 	// If provided, filters configs for the given app.
 	App *App
+
+	// If provided, a version to filter by.
+	Version *int
 }
 
 // Scope implements the Scope interface.
@@ -98,49 +156,423 @@ func (q ConfigsQuery) Scope(db *gorm.DB) *gorm.DB {
 		scope = append(scope, ForApp(q.App))
 	}
 
+	if q.Version != nil {
+		scope = append(scope, FieldEquals("version", *q.Version))
+	}
+
 	return scope.Scope(db)
 }
 
 // ConfigsFirst returns the first matching config.
 func (s *store) ConfigsFirst(scope Scope) (*Config, error) {
 	var config Config
-	scope = ComposedScope{Order("created_at desc"), scope}
+	scope = ComposedScope{Order("version desc"), scope}
 	return &config, s.First(scope, &config)
 }
 
+// ErrConfigNotFound is returned when a config doesn't exist.
+var ErrConfigNotFound = errors.New("config not found")
+
+// ConfigsFind finds the config with the given id, returning ErrConfigNotFound
+// if it doesn't exist.
+func (s *store) ConfigsFind(id string) (*Config, error) {
+	c, err := s.ConfigsFirst(ConfigsQuery{ID: &id})
+	if err == gorm.RecordNotFound {
+		return nil, ErrConfigNotFound
+	}
+	return c, err
+}
+
+// ConfigsFindByVersion finds a specific Config version for the given App.
+func (s *store) ConfigsFindByVersion(app *App, version int) (*Config, error) {
+	return s.ConfigsFirst(ConfigsQuery{App: app, Version: &version})
+}
+
+// ConfigsHistory returns the configs for the app, newest first.
+func (s *store) ConfigsHistory(app *App, page Page) ([]*Config, error) {
+	var configs []*Config
+	scope := ComposedScope{ConfigsQuery{App: app}, Order("version desc"), page}
+	return configs, s.Find(scope, &configs)
+}
+
+// ConfigsSetFrozen freezes or unfreezes the config with the given id.
+func (s *store) ConfigsSetFrozen(id string, frozen bool) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	db := s.db.Model(&Config{}).Where("id = ?", id).UpdateColumn("frozen", frozen)
+	if db.Error != nil {
+		return db.Error
+	}
+
+	if db.RowsAffected == 0 {
+		return gorm.RecordNotFound
+	}
+
+	return nil
+}
+
 // ConfigsCreate persists the Config.
 func (s *store) ConfigsCreate(config *Config) (*Config, error) {
+	if err := s.writable(); err != nil {
+		return config, err
+	}
+
 	return configsCreate(s.db, config)
 }
 
+// ConfigsCreateAll persists the configs, in order, in a single transaction. If a
+// config can't be created, none are, and the index of the config that failed
+// is returned along with the error.
+func (s *store) ConfigsCreateAll(configs []*Config) (int, error) {
+	if err := s.writable(); err != nil {
+		return 0, err
+	}
+
+	t := s.db.Begin()
+
+	for i, config := range configs {
+		if _, err := configsCreateTx(t, config); err != nil {
+			t.Rollback()
+			return i, err
+		}
+	}
+
+	if err := t.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	return len(configs), nil
+}
+
+// ConfigsApplyAll finds each app by name, and creates the config that apply
+// returns for the app's current config and vars, in a single transaction. If
+// an app can't be found, or apply returns an error, the transaction is rolled
+// back and a BulkApplyError is returned. The returned configs are keyed by
+// app name.
+func (s *store) ConfigsApplyAll(updates map[string]Vars, apply func(old *Config, vars Vars) (*Config, error)) (map[string]*Config, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+
+	t := s.db.Begin()
+
+	configs := make(map[string]*Config)
+	errs := make(map[string]error)
+
+	for _, name := range sortedAppNames(updates) {
+		var app App
+		if err := (AppsQuery{Name: &name}).Scope(t).First(&app).Error; err != nil {
+			if err == gorm.RecordNotFound {
+				errs[name] = ErrAppNotFound
+				continue
+			}
+			t.Rollback()
+			return nil, err
+		}
+
+		old, err := configsCurrentTx(t, &app)
+		if err != nil {
+			t.Rollback()
+			return nil, err
+		}
+
+		config, err := apply(old, updates[name])
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+
+		config.App = &app
+		if _, err := configsCreateTx(t, config); err != nil {
+			t.Rollback()
+			return nil, fmt.Errorf("applying %s: %v", name, err)
+		}
+
+		configs[name] = config
+	}
+
+	if len(errs) > 0 {
+		t.Rollback()
+		return nil, &BulkApplyError{Errors: errs}
+	}
+
+	return configs, t.Commit().Error
+}
+
+// configsCurrentTx returns the current config for the app, within an existing
+// transaction, like configsService.ConfigsCurrent. If the app has no config,
+// an empty one is returned, but not created.
+func configsCurrentTx(t *gorm.DB, app *App) (*Config, error) {
+	var release Release
+	err := (ReleasesQuery{App: app, Status: ReleaseStatusActive}).Scope(t).First(&release).Error
+	if err == nil {
+		return release.Config, nil
+	}
+	if err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	var config Config
+	err = ComposedScope{Order("version desc"), ConfigsQuery{App: app}}.Scope(t).First(&config).Error
+	if err == gorm.RecordNotFound {
+		return &Config{AppID: app.ID, Vars: make(Vars)}, nil
+	}
+
+	return &config, err
+}
+
+// ConfigDefaults returns the vars that new apps are created with.
+func (s *store) ConfigDefaults() (Vars, error) {
+	rows, err := s.reader().Raw(`select key, value from config_defaults`).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vars := make(Vars)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return vars, err
+		}
+		vars[Variable(k)] = &v
+	}
+
+	return vars, rows.Err()
+}
+
+// ConfigDefaultsSet sets the vars that new apps are created with, in a single
+// transaction. Vars with a nil value are removed.
+func (s *store) ConfigDefaultsSet(vars Vars) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	for k, v := range vars {
+		if err := t.Exec(`delete from config_defaults where key = ?`, string(k)).Error; err != nil {
+			t.Rollback()
+			return err
+		}
+
+		if v == nil {
+			continue
+		}
+
+		if err := t.Exec(`insert into config_defaults (key, value) values (?, ?)`, string(k), *v).Error; err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	return t.Commit().Error
+}
+
+// configsLastVersion returns the last Config version for the given App. Like
+// releasesLastVersion, it locks the last config until the transaction is
+// commited, so the version can be incremented atomically.
+func configsLastVersion(db *gorm.DB, appID string) (int, error) {
+	var version int
+
+	rows, err := db.Raw(`select version from configs where app_id = ? order by version desc for update`, appID).Rows()
+	if err != nil {
+		return version, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err := rows.Scan(&version)
+		return version, err
+	}
+
+	return version, nil
+}
+
 // ConfigsCreate inserts a Config in the database.
 func configsCreate(db *gorm.DB, config *Config) (*Config, error) {
-	return config, db.Create(config).Error
+	t := db.Begin()
+
+	if _, err := configsCreateTx(t, config); err != nil {
+		t.Rollback()
+		return config, err
+	}
+
+	if err := t.Commit().Error; err != nil {
+		t.Rollback()
+		return config, err
+	}
+
+	return config, nil
+}
+
+// configsCreateTx inserts a Config with the next version for the app, within
+// an existing transaction.
+func configsCreateTx(t *gorm.DB, config *Config) (*Config, error) {
+	appID := config.AppID
+	if config.App != nil {
+		appID = config.App.ID
+	}
+
+	// Get the last config version for this app.
+	v, err := configsLastVersion(t, appID)
+	if err != nil {
+		return config, err
+	}
+
+	// Increment the config version.
+	config.Version = v + 1
+
+	return config, t.Create(config).Error
+}
+
+// DefaultSecretReferencePrefix is the default prefix of config values that
+// are references to secrets.
+const DefaultSecretReferencePrefix = "ssm://"
+
+// SecretResolver resolves a reference to a secret that's stored outside of
+// Empire, e.g. "ssm://my/param", into its value.
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ConfigValidator validates config vars when they're applied.
+type ConfigValidator interface {
+	// Validate returns an error if value isn't valid for key.
+	Validate(key, value string) error
+}
+
+// EnvConfigValidator is a ConfigValidator that validates vars whose key matches
+// a regular expression.
+type EnvConfigValidator struct {
+	rules []envConfigRule
+}
+
+type envConfigRule struct {
+	pattern  *regexp.Regexp
+	validate func(string) error
+}
+
+// NewEnvConfigValidator returns an EnvConfigValidator that validates the value
+// of vars with every func whose key pattern matches the var's key, e.g.
+// "^LOG_LEVEL$".
+func NewEnvConfigValidator(rules map[string]func(string) error) (*EnvConfigValidator, error) {
+	patterns := make([]string, 0, len(rules))
+	for p := range rules {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+
+	v := &EnvConfigValidator{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		v.rules = append(v.rules, envConfigRule{pattern: re, validate: rules[p]})
+	}
+
+	return v, nil
+}
+
+// Validate implements the ConfigValidator interface.
+func (v *EnvConfigValidator) Validate(key, value string) error {
+	for _, r := range v.rules {
+		if !r.pattern.MatchString(key) {
+			continue
+		}
+
+		if err := r.validate(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 type configsService struct {
 	store    *store
 	releases *releasesService
+	notifier *notifier
+
+	// Used to resolve config values that start with secretPrefix.
+	secretResolver SecretResolver
+	secretPrefix   string
+
+	// The maximum size of a single config var value, in bytes. Zero
+	// disables the check.
+	maxValueBytes int
+
+	// The maximum size of all config var keys and values combined, in
+	// bytes. Zero disables the check.
+	maxTotalBytes int
+
+	// Validators that vars are checked against when they're applied.
+	validators []ConfigValidator
+
+	// When true, references to other vars are expanded when vars are
+	// applied.
+	expandVarReferences bool
 }
 
 func (s *configsService) ConfigsApply(ctx context.Context, app *App, vars Vars) (*Config, error) {
+	return s.ConfigsApplyOrdered(ctx, app, vars, nil)
+}
+
+// ConfigsApplyOrdered applies the new config vars like ConfigsApply, and sets
+// the order that vars are set in the environment of processes. If order is
+// empty, the order of the current config is kept.
+func (s *configsService) ConfigsApplyOrdered(ctx context.Context, app *App, vars Vars, order []string) (*Config, error) {
 	old, err := s.ConfigsCurrent(app)
 	if err != nil {
 		return nil, err
 	}
 
-	c, err := s.store.ConfigsCreate(NewConfig(old, vars))
+	config, err := s.newConfig(old, vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(order) > 0 {
+		config.VarOrder = order
+	}
+
+	c, err := s.store.ConfigsCreate(config)
 	if err != nil {
 		return c, err
 	}
 
-	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app})
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, string(k))
+	}
+
+	return c, s.release(ctx, app, c, keys)
+}
+
+// ConfigsApplyIfChanged applies the new config vars like ConfigsApply, unless
+// the resulting vars are identical to the current config's, in which case the
+// current config is returned and nothing is created. The bool reports whether
+// a new config was created.
+func (s *configsService) ConfigsApplyIfChanged(ctx context.Context, app *App, vars Vars) (*Config, bool, error) {
+	old, err := s.ConfigsCurrent(app)
 	if err != nil {
-		if err == gorm.RecordNotFound {
-			err = nil
-		}
+		return nil, false, err
+	}
 
-		return c, err
+	config, err := s.newConfig(old, vars)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if varsEqual(old.Vars, config.Vars) {
+		return old, false, nil
+	}
+
+	c, err := s.store.ConfigsCreate(config)
+	if err != nil {
+		return c, false, err
 	}
 
 	keys := make([]string, 0, len(vars))
@@ -148,6 +580,109 @@ func (s *configsService) ConfigsApply(ctx context.Context, app *App, vars Vars)
 		keys = append(keys, string(k))
 	}
 
+	return c, true, s.release(ctx, app, c, keys)
+}
+
+// newConfig returns a new config with the vars applied to old, expanding
+// references and validating the vars.
+func (s *configsService) newConfig(old *Config, vars Vars) (*Config, error) {
+	config := NewConfig(old, vars)
+
+	if s.expandVarReferences {
+		var err error
+		if config.Vars, err = ExpandVarReferences(config.Vars); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.validate(config.Vars); err != nil {
+		return nil, err
+	}
+	if err := validateConfigVars(s.validators, vars); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// ConfigsApplyAtomic applies vars to the configs of several apps, keyed by app
+// name, in a single transaction. If any app doesn't exist, or any of the vars
+// are invalid, no configs are changed and a BulkApplyError is returned. Apps
+// that have been released are released with their new config once the
+// transaction has been committed.
+func (s *configsService) ConfigsApplyAtomic(ctx context.Context, updates map[string]Vars) (map[string]*Config, error) {
+	configs, err := s.store.ConfigsApplyAll(updates, s.newConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedAppNames(updates) {
+		c := configs[name]
+
+		keys := make([]string, 0, len(updates[name]))
+		for k := range updates[name] {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+
+		if err := s.release(ctx, c.App, c, keys); err != nil {
+			return configs, fmt.Errorf("releasing %s: %v", name, err)
+		}
+	}
+
+	return configs, nil
+}
+
+// ConfigDefaultsSet validates, then sets the vars that new apps are created
+// with. Existing apps aren't changed.
+func (s *configsService) ConfigDefaultsSet(defaults Vars) error {
+	if err := s.validate(defaults); err != nil {
+		return err
+	}
+	if err := validateConfigVars(s.validators, defaults); err != nil {
+		return err
+	}
+
+	return s.store.ConfigDefaultsSet(defaults)
+}
+
+// BulkApplyError is returned by ConfigsApplyAtomic when the vars for any app
+// couldn't be applied. It contains the error for each app, by name.
+type BulkApplyError struct {
+	Errors map[string]error
+}
+
+func (e *BulkApplyError) Error() string {
+	var problems []string
+	for name, err := range e.Errors {
+		problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+	}
+	sort.Strings(problems)
+	return fmt.Sprintf("config changes were not applied: %s", strings.Join(problems, ", "))
+}
+
+// sortedAppNames returns the app names in updates, sorted, so that apps are
+// always applied in the same order.
+func sortedAppNames(updates map[string]Vars) []string {
+	names := make([]string, 0, len(updates))
+	for name := range updates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// release creates a new release of the app with the config, if the app has
+// been released before.
+func (s *configsService) release(ctx context.Context, app *App, c *Config, keys []string) error {
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			err = nil
+		}
+
+		return err
+	}
+
 	desc := fmt.Sprintf("Set %s config vars", strings.Join(keys, ","))
 
 	// Create new release based on new config and old slug
@@ -157,12 +692,180 @@ func (s *configsService) ConfigsApply(ctx context.Context, app *App, vars Vars)
 		Slug:        release.Slug,
 		Description: desc,
 	})
-	return c, err
+	return err
+}
+
+// Types of KeyValueChange.
+const (
+	ChangeTypeSet   = "set"
+	ChangeTypeUnset = "unset"
+)
+
+// KeyValueChange is a change to a single config var.
+type KeyValueChange struct {
+	Key   string
+	Value string
+
+	// Either ChangeTypeSet or ChangeTypeUnset.
+	ChangeType string
+}
+
+// ConfigsApplyWithHistory applies each change as a separate Config, so that
+// every intermediate state is recorded. Either all of the configs are created,
+// or none are. If a change can't be applied, the configs for the changes
+// before it are returned, along with the error. Only the last config is
+// released.
+func (s *configsService) ConfigsApplyWithHistory(ctx context.Context, app *App, changes []KeyValueChange) ([]*Config, error) {
+	old, err := s.ConfigsCurrent(app)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		configs []*Config
+		keys    []string
+	)
+	for _, change := range changes {
+		config, err := s.applyChange(old, change)
+		if err != nil {
+			return configs, err
+		}
+
+		configs = append(configs, config)
+		keys = append(keys, change.Key)
+		old = config
+	}
+
+	if len(configs) == 0 {
+		return configs, nil
+	}
+
+	if n, err := s.store.ConfigsCreateAll(configs); err != nil {
+		err = fmt.Errorf("applying %s: %v", changes[n].Key, err)
+		return configs[:n], err
+	}
+
+	return configs, s.release(ctx, app, configs[len(configs)-1], keys)
+}
+
+// applyChange returns a new Config with the change applied to old.
+func (s *configsService) applyChange(old *Config, change KeyValueChange) (*Config, error) {
+	var vars Vars
+	switch change.ChangeType {
+	case ChangeTypeSet:
+		v := change.Value
+		vars = Vars{Variable(change.Key): &v}
+	case ChangeTypeUnset:
+		vars = Vars{Variable(change.Key): nil}
+	default:
+		return nil, &ValidationError{Err: fmt.Errorf("%s: change type must be set or unset, got %q", change.Key, change.ChangeType)}
+	}
+
+	if change.Key == "" {
+		return nil, &ValidationError{Err: fmt.Errorf("config var keys cannot be blank")}
+	}
+
+	config := NewConfig(old, vars)
+	if err := s.validate(config.Vars); err != nil {
+		return nil, &ValidationError{Err: fmt.Errorf("%s: %v", change.Key, err)}
+	}
+	if err := validateConfigVars(s.validators, vars); err != nil {
+		return nil, &ValidationError{Err: fmt.Errorf("%s: %v", change.Key, err)}
+	}
+
+	return config, nil
+}
+
+// ConfigsCopyFromApp copies the current config vars from src to dst, skipping
+// any vars in excludeKeys.
+func (s *configsService) ConfigsCopyFromApp(ctx context.Context, src, dst *App, excludeKeys []string) (*Config, error) {
+	if dst == nil {
+		return nil, ErrAppNotFound
+	}
+
+	if _, err := s.store.AppsFirst(AppsQuery{ID: &dst.ID}); err != nil {
+		if err == gorm.RecordNotFound {
+			err = ErrAppNotFound
+		}
+		return nil, err
+	}
+
+	old, err := s.ConfigsCurrent(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.ConfigsApply(ctx, dst, excludeVars(old.Vars, excludeKeys))
+	if err != nil {
+		return c, err
+	}
+
+	s.notifier.Notify(ctx, Notification{
+		Severity: SeverityInfo,
+		App:      dst.Name,
+		Event:    NotificationConfigCopy,
+		Message:  fmt.Sprintf("Copied config from %s (%s) to %s (%s)", src.Name, src.ID, dst.Name, dst.ID),
+	})
+
+	return c, nil
+}
+
+// ConfigsMerge merges the vars of the override config on top of the vars of
+// the base config, then applies the result to the app's current config like
+// ConfigsApply. Neither of the configs are changed. ErrConfigNotFound is
+// returned if either config doesn't exist.
+func (s *configsService) ConfigsMerge(ctx context.Context, app *App, baseConfigID, overrideConfigID string) (*Config, error) {
+	base, err := s.store.ConfigsFind(baseConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	override, err := s.store.ConfigsFind(overrideConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ConfigsApply(ctx, app, mergeVars(base.Vars, override.Vars))
+}
+
+// ConfigsApplyDeltaFromRelease applies the vars of the source app's release
+// that are new or changed compared to the destination app's current config.
+// Vars that are only in the destination's config are kept. If there are no
+// changes, the current config is returned without creating a new one.
+func (s *configsService) ConfigsApplyDeltaFromRelease(ctx context.Context, dst, src *App, srcVersion int) (*Config, error) {
+	r, err := s.store.ReleasesFirst(ReleasesQuery{App: src, Version: &srcVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.ConfigsCurrent(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := configDelta(current.Vars, r.Config.Vars)
+	if len(delta) == 0 {
+		return current, nil
+	}
+
+	return s.ConfigsApply(ctx, dst, delta)
+}
+
+// configDelta returns the vars that were added or modified in src compared to
+// dst. Vars that were removed are skipped.
+func configDelta(dst, src Vars) Vars {
+	delta := make(Vars)
+	for _, c := range ConfigDiff(dst, src) {
+		if c.New != nil {
+			delta[c.Variable] = c.New
+		}
+	}
+	return delta
 }
 
 // Returns configs for latest release or the latest configs if there are no releases.
 func (s *configsService) ConfigsCurrent(app *App) (*Config, error) {
-	r, err := s.store.ReleasesFirst(ReleasesQuery{App: app})
+	r, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
 	if err != nil {
 		if err == gorm.RecordNotFound {
 			// It's possible to have config without releases, this handles that.
@@ -186,6 +889,189 @@ func (s *configsService) ConfigsCurrent(app *App) (*Config, error) {
 	return r.Config, nil
 }
 
+// maskedValue replaces config values in a DriftReport or ConfigChangeset.
+const maskedValue = "********"
+
+// ConfigsDriftReport compares the apps current config with the reference vars.
+// Values from the apps config are masked, unless they're references to
+// secrets.
+func (s *configsService) ConfigsDriftReport(app *App, reference Vars) (*DriftReport, error) {
+	c, err := s.ConfigsCurrent(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return ConfigDrift(c.Vars, reference, s.mask), nil
+}
+
+// ConfigsDiffByID returns the changes between two configs, which don't need to
+// belong to a release, or even the same app. Values are masked, unless they're
+// references to secrets.
+func (s *configsService) ConfigsDiffByID(fromID, toID string) (ConfigChangeset, error) {
+	from, err := s.store.ConfigsFind(fromID)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := s.store.ConfigsFind(toID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := ConfigDiff(from.Vars, to.Vars)
+	for _, c := range changes {
+		c.Old = s.maskVar(c.Old)
+		c.New = s.maskVar(c.New)
+	}
+
+	return changes, nil
+}
+
+// maskVar returns a masked copy of the value, or nil if it's nil.
+func (s *configsService) maskVar(v *string) *string {
+	if v == nil {
+		return nil
+	}
+	masked := s.mask(*v)
+	return &masked
+}
+
+// mask masks the config value, unless it's a reference to a secret.
+func (s *configsService) mask(v string) string {
+	if s.secretPrefix != "" && strings.HasPrefix(v, s.secretPrefix) {
+		return v
+	}
+	return maskedValue
+}
+
+// ConfigsCurrentWithResolved returns the current config for the app with any
+// secret references replaced by their values.
+func (s *configsService) ConfigsCurrentWithResolved(ctx context.Context, app *App) (*Config, error) {
+	c, err := s.ConfigsCurrent(app)
+	if err != nil {
+		return c, err
+	}
+
+	if s.secretResolver == nil {
+		return c, nil
+	}
+
+	vars, err := resolveVars(ctx, s.secretResolver, s.secretPrefix, c.Vars)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := *c
+	resolved.Vars = vars
+	resolved.Resolved = true
+
+	return &resolved, nil
+}
+
+// resolveVars returns a copy of vars with the values that start with prefix
+// resolved using r.
+func resolveVars(ctx context.Context, r SecretResolver, prefix string, vars Vars) (Vars, error) {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+
+	resolved := make(Vars)
+	for _, k := range keys {
+		v := vars[Variable(k)]
+
+		if v == nil || !strings.HasPrefix(*v, prefix) {
+			resolved[Variable(k)] = v
+			continue
+		}
+
+		value, err := r.Resolve(ctx, *v)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %v", k, err)
+		}
+
+		resolved[Variable(k)] = &value
+	}
+
+	return resolved, nil
+}
+
+// ErrCircularVarReference is returned by ExpandVarReferences when config vars
+// reference each other in a cycle.
+var ErrCircularVarReference = &ValidationError{Err: errors.New("config vars cannot reference each other in a cycle")}
+
+// varReferencePattern matches a reference to another config var, e.g.
+// "${DB_HOST}".
+var varReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandVarReferences returns a copy of vars with references to other vars, in
+// the form "${VAR_NAME}", replaced by their values. Vars are expanded after the
+// vars that they reference, so references can be chained. Values containing a
+// "$" that isn't part of a reference are left alone.
+func ExpandVarReferences(vars Vars) (Vars, error) {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+
+	expanded := make(Vars)
+	visiting := make(map[Variable]bool)
+
+	var expand func(k Variable) error
+	expand = func(k Variable) error {
+		if _, ok := expanded[k]; ok {
+			return nil
+		}
+
+		if visiting[k] {
+			return ErrCircularVarReference
+		}
+		visiting[k] = true
+		defer delete(visiting, k)
+
+		v := vars[k]
+		if v == nil {
+			expanded[k] = nil
+			return nil
+		}
+
+		var err error
+		value := varReferencePattern.ReplaceAllStringFunc(*v, func(ref string) string {
+			if err != nil {
+				return ref
+			}
+
+			name := Variable(varReferencePattern.FindStringSubmatch(ref)[1])
+			if vars[name] == nil {
+				err = &ValidationError{Err: fmt.Errorf("%s references %s, which is not set", k, name)}
+				return ref
+			}
+
+			if err = expand(name); err != nil {
+				return ref
+			}
+
+			return *expanded[name]
+		})
+		if err != nil {
+			return err
+		}
+
+		expanded[k] = &value
+		return nil
+	}
+
+	for _, k := range keys {
+		if err := expand(Variable(k)); err != nil {
+			return nil, err
+		}
+	}
+
+	return expanded, nil
+}
+
 // mergeVars copies all of the vars from a, and merges b into them, returning a
 // new Vars.
 func mergeVars(old, new Vars) Vars {
@@ -205,3 +1091,186 @@ func mergeVars(old, new Vars) Vars {
 
 	return vars
 }
+
+// varsEqual returns true if a and b have the same keys, with the same values.
+func varsEqual(a, b Vars) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok {
+			return false
+		}
+		if (v == nil) != (w == nil) {
+			return false
+		}
+		if v != nil && *v != *w {
+			return false
+		}
+	}
+
+	return true
+}
+
+// excludeVars returns a copy of vars without the given keys.
+func excludeVars(vars Vars, keys []string) Vars {
+	exclude := make(map[Variable]bool, len(keys))
+	for _, k := range keys {
+		exclude[Variable(k)] = true
+	}
+
+	v := make(Vars)
+	for k, val := range vars {
+		if !exclude[k] {
+			v[k] = val
+		}
+	}
+
+	return v
+}
+
+// validate validates the config vars against the configured size limits.
+func (s *configsService) validate(vars Vars) error {
+	return validateVars(vars, s.maxValueBytes, s.maxTotalBytes)
+}
+
+// validateConfigVars returns a ValidationError listing the vars that any of the
+// validators reject. Only the vars that are being set are validated, so that
+// existing vars don't prevent changes to other vars.
+func validateConfigVars(validators []ConfigValidator, vars Vars) error {
+	if len(validators) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, string(k))
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, k := range keys {
+		v := vars[Variable(k)]
+		if v == nil {
+			continue
+		}
+
+		for _, validator := range validators {
+			if err := validator.Validate(k, *v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", k, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Err: fmt.Errorf("invalid config vars: %s", strings.Join(problems, ", "))}
+	}
+
+	return nil
+}
+
+// validateVars returns a ValidationError if any value is larger than maxValue
+// bytes, or if the combined size of all keys and values is larger than
+// maxTotal bytes. A limit of zero disables that check.
+func validateVars(vars Vars, maxValue, maxTotal int) error {
+	var (
+		problems []string
+		total    int
+	)
+
+	for k, v := range vars {
+		var size int
+		if v != nil {
+			size = len(*v)
+		}
+
+		if maxValue > 0 && size > maxValue {
+			problems = append(problems, fmt.Sprintf("%s is %d bytes", k, size))
+		}
+
+		total += len(k) + size
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &ValidationError{Err: fmt.Errorf("config values cannot be larger than %d bytes: %s", maxValue, strings.Join(problems, ", "))}
+	}
+
+	if maxTotal > 0 && total > maxTotal {
+		return &ValidationError{Err: fmt.Errorf("config vars cannot be larger than %d bytes in total, got %d bytes", maxTotal, total)}
+	}
+
+	return nil
+}
+
+// ParseError is returned when config vars can't be parsed.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error: %v", e.Err)
+}
+
+// ConfigsApplyFromYAML parses config vars from a flat YAML mapping, then applies
+// them like ConfigsApply.
+func (s *configsService) ConfigsApplyFromYAML(ctx context.Context, app *App, r io.Reader) (*Config, error) {
+	vars, err := parseYAMLVars(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ConfigsApply(ctx, app, vars)
+}
+
+// ConfigsApplyFromDotenv parses config vars from a .env file, then applies them
+// like ConfigsApply.
+func (s *configsService) ConfigsApplyFromDotenv(ctx context.Context, app *App, r io.Reader) (*Config, error) {
+	vars, err := parseDotenv(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ConfigsApply(ctx, app, vars)
+}
+
+// parseYAMLVars parses a flat YAML mapping of config vars. Values can be
+// strings or integers, and a null value unsets the var. Anchors, aliases and
+// merge keys are resolved by the YAML parser, so vars can be shared.
+func parseYAMLVars(r io.Reader) (Vars, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[interface{}]interface{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, &ParseError{err}
+	}
+
+	vars := make(Vars)
+	for k, v := range m {
+		key, ok := k.(string)
+		if !ok {
+			return nil, &ParseError{fmt.Errorf("key %v is not a string", k)}
+		}
+
+		switch v := v.(type) {
+		case nil:
+			vars[Variable(key)] = nil
+		case string:
+			vars[Variable(key)] = &v
+		case int:
+			s := strconv.Itoa(v)
+			vars[Variable(key)] = &s
+		case map[interface{}]interface{}:
+			return nil, &ParseError{fmt.Errorf("%s is a nested map, only flat key/value pairs are allowed", key)}
+		default:
+			return nil, &ParseError{fmt.Errorf("%s must be a string or an integer", key)}
+		}
+	}
+
+	return vars, nil
+}
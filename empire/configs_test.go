@@ -1,18 +1,27 @@
 package empire
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+
+	"golang.org/x/net/context"
 )
 
 func TestConfigsQuery(t *testing.T) {
 	id := "1234"
 	app := &App{ID: "4321"}
+	version := 2
 
 	tests := scopeTests{
 		{ConfigsQuery{}, "", []interface{}{}},
 		{ConfigsQuery{ID: &id}, "WHERE (id = $1)", []interface{}{id}},
 		{ConfigsQuery{App: app}, "WHERE (app_id = $1)", []interface{}{app.ID}},
+		{ConfigsQuery{Version: &version}, "WHERE (version = $1)", []interface{}{version}},
+		{ConfigsQuery{App: app, Version: &version}, "WHERE (app_id = $1) AND (version = $2)", []interface{}{app.ID, version}},
 	}
 
 	tests.Run(t)
@@ -77,3 +86,478 @@ func TestMergeVars(t *testing.T) {
 		}
 	}
 }
+
+func TestNewConfig_Frozen(t *testing.T) {
+	production := "production"
+	staging := "staging"
+
+	old := &Config{
+		AppID:  "1234",
+		Vars:   Vars{"RAILS_ENV": &production},
+		Frozen: true,
+	}
+
+	c := NewConfig(old, Vars{"RAILS_ENV": &staging})
+
+	if c.Frozen {
+		t.Fatal("Expected new config to not be frozen")
+	}
+
+	if got, want := *old.Vars["RAILS_ENV"], production; got != want {
+		t.Fatalf("Frozen config RAILS_ENV => %s; want %s", got, want)
+	}
+
+	if got, want := *c.Vars["RAILS_ENV"], staging; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+}
+
+func TestValidateVars(t *testing.T) {
+	var (
+		small = strings.Repeat("a", 10)
+		large = strings.Repeat("a", 100)
+	)
+
+	tests := []struct {
+		vars     Vars
+		maxValue int
+		maxTotal int
+		err      string
+	}{
+		// Within the limits
+		{Vars{"A": &small}, 50, 200, ""},
+
+		// Single value too large
+		{Vars{"A": &large, "B": &small}, 50, 1000, "config values cannot be larger than 50 bytes: A is 100 bytes"},
+		{Vars{"A": &large, "B": &large}, 50, 1000, "config values cannot be larger than 50 bytes: A is 100 bytes, B is 100 bytes"},
+
+		// Total too large
+		{Vars{"A": &small, "B": &small, "C": &small}, 50, 30, "config vars cannot be larger than 30 bytes in total, got 33 bytes"},
+
+		// One large and several small, within the total limit.
+		{Vars{"A": &large, "B": &small, "C": &small}, 100, 200, ""},
+
+		// Zero limits disable the checks.
+		{Vars{"A": &large, "B": &large}, 0, 0, ""},
+	}
+
+	for i, tt := range tests {
+		err := validateVars(tt.vars, tt.maxValue, tt.maxTotal)
+
+		if tt.err == "" {
+			if err != nil {
+				t.Fatalf("#%d: err => %v; want nil", i, err)
+			}
+			continue
+		}
+
+		if _, ok := err.(*ValidationError); !ok {
+			t.Fatalf("#%d: err => %v; want a ValidationError", i, err)
+		}
+
+		if got, want := err.Error(), tt.err; got != want {
+			t.Fatalf("#%d: err => %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestExcludeVars(t *testing.T) {
+	var (
+		production = "production"
+		dbURL      = "postgres://localhost"
+		secret     = "secret"
+	)
+
+	vars := Vars{
+		"RAILS_ENV":    &production,
+		"DATABASE_URL": &dbURL,
+		"SECRET_KEY":   &secret,
+	}
+
+	v := excludeVars(vars, []string{"DATABASE_URL", "SECRET_KEY", "MISSING"})
+
+	if got, want := v, (Vars{"RAILS_ENV": &production}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("excludeVars => %v; want %v", got, want)
+	}
+
+	if got, want := len(vars), 3; got != want {
+		t.Fatalf("len(vars) => %d; want %d", got, want)
+	}
+}
+
+func TestConfigDelta(t *testing.T) {
+	var (
+		production = "production"
+		staging    = "staging"
+		dbURL      = "postgres://localhost"
+		newRelic   = "abcd"
+	)
+
+	dst := Vars{
+		"RAILS_ENV":    &production,
+		"DATABASE_URL": &dbURL,
+	}
+	src := Vars{
+		"RAILS_ENV":        &staging,
+		"NEW_RELIC_APP_ID": &newRelic,
+	}
+
+	// DATABASE_URL was removed in src, so it's skipped.
+	want := Vars{
+		"RAILS_ENV":        &staging,
+		"NEW_RELIC_APP_ID": &newRelic,
+	}
+
+	if got := configDelta(dst, src); !reflect.DeepEqual(got, want) {
+		t.Fatalf("configDelta => %v; want %v", got, want)
+	}
+
+	if got := configDelta(src, src); len(got) != 0 {
+		t.Fatalf("configDelta => %v; want no vars", got)
+	}
+}
+
+func TestVarsEqual(t *testing.T) {
+	var (
+		production  = "production"
+		staging     = "staging"
+		production2 = "production"
+	)
+
+	tests := []struct {
+		a, b Vars
+		want bool
+	}{
+		{Vars{}, Vars{}, true},
+		{Vars{"RAILS_ENV": &production}, Vars{"RAILS_ENV": &production2}, true},
+		{Vars{"RAILS_ENV": &production}, Vars{"RAILS_ENV": &staging}, false},
+		{Vars{"RAILS_ENV": &production}, Vars{"RACK_ENV": &production}, false},
+		{Vars{"RAILS_ENV": &production}, Vars{}, false},
+		{Vars{}, Vars{"RAILS_ENV": &production}, false},
+		{Vars{"RAILS_ENV": nil}, Vars{"RAILS_ENV": &production}, false},
+	}
+
+	for _, tt := range tests {
+		if got := varsEqual(tt.a, tt.b); got != tt.want {
+			t.Fatalf("varsEqual(%v, %v) => %v; want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// mapSecretResolver is a SecretResolver that resolves references from a map.
+type mapSecretResolver map[string]string
+
+func (r mapSecretResolver) Resolve(ctx context.Context, ref string) (string, error) {
+	v, ok := r[ref]
+	if !ok {
+		return "", fmt.Errorf("%s not found", ref)
+	}
+	return v, nil
+}
+
+func TestResolveVars(t *testing.T) {
+	var (
+		production = "production"
+		ref        = "ssm://acme-inc/database_url"
+		dbURL      = "postgres://localhost"
+		missing    = "ssm://acme-inc/missing"
+	)
+
+	r := mapSecretResolver{ref: dbURL}
+
+	vars := Vars{
+		"RAILS_ENV":    &production,
+		"DATABASE_URL": &ref,
+	}
+
+	resolved, err := resolveVars(context.Background(), r, DefaultSecretReferencePrefix, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := resolved, (Vars{"RAILS_ENV": &production, "DATABASE_URL": &dbURL}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolveVars => %v; want %v", got, want)
+	}
+
+	// The original vars aren't modified.
+	if got, want := *vars["DATABASE_URL"], ref; got != want {
+		t.Fatalf("DATABASE_URL => %s; want %s", got, want)
+	}
+
+	vars["SECRET_KEY"] = &missing
+
+	_, err = resolveVars(context.Background(), r, DefaultSecretReferencePrefix, vars)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if !strings.Contains(err.Error(), "SECRET_KEY") {
+		t.Fatalf("Expected error to include the key, got %v", err)
+	}
+}
+
+func TestExpandVarReferences(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		vars Vars
+		want Vars
+	}{
+		// Simple reference.
+		{
+			Vars{"DB_HOST": str("localhost"), "DATABASE_URL": str("postgres://${DB_HOST}/acme")},
+			Vars{"DB_HOST": str("localhost"), "DATABASE_URL": str("postgres://localhost/acme")},
+		},
+
+		// Chained references.
+		{
+			Vars{"A": str("${B}/a"), "B": str("${C}/b"), "C": str("c")},
+			Vars{"A": str("c/b/a"), "B": str("c/b"), "C": str("c")},
+		},
+
+		// A "$" that isn't part of a reference is left alone.
+		{
+			Vars{"PASSWORD": str("pa$$word"), "HOME": str("$HOME"), "EMPTY": str("${}")},
+			Vars{"PASSWORD": str("pa$$word"), "HOME": str("$HOME"), "EMPTY": str("${}")},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ExpandVarReferences(tt.vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ExpandVarReferences(%v) => %v; want %v", tt.vars, got, tt.want)
+		}
+	}
+}
+
+func TestExpandVarReferences_Errors(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	if _, err := ExpandVarReferences(Vars{"A": str("${B}"), "B": str("${C}"), "C": str("${A}")}); err != ErrCircularVarReference {
+		t.Fatalf("err => %v; want %v", err, ErrCircularVarReference)
+	}
+
+	if _, err := ExpandVarReferences(Vars{"A": str("${A}")}); err != ErrCircularVarReference {
+		t.Fatalf("err => %v; want %v", err, ErrCircularVarReference)
+	}
+
+	_, err := ExpandVarReferences(Vars{"DATABASE_URL": str("postgres://${DB_HOST}/acme")})
+	if _, ok := err.(*ValidationError); !ok {
+		t.Fatalf("err => %v; want a ValidationError", err)
+	}
+
+	if got, want := err.Error(), "DATABASE_URL references DB_HOST, which is not set"; got != want {
+		t.Fatalf("err => %q; want %q", got, want)
+	}
+}
+
+func TestVarOrder_Value(t *testing.T) {
+	tests := []struct {
+		order VarOrder
+		raw   string
+	}{
+		{nil, `[]`},
+		{VarOrder{"DB_HOST", "DATABASE_URL"}, `["DB_HOST","DATABASE_URL"]`},
+	}
+
+	for _, tt := range tests {
+		v, err := tt.order.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(v.([]byte)); got != tt.raw {
+			t.Fatalf("Value => %s; want %s", got, tt.raw)
+		}
+
+		var order VarOrder
+		if err := order.Scan(v); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(order) != len(tt.order) {
+			t.Fatalf("Scan => %v; want %v", order, tt.order)
+		}
+	}
+}
+
+func TestParseYAMLVars(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		in   string
+		vars Vars
+	}{
+		// Flat
+		{
+			"RAILS_ENV: production\nWORKERS: 4\n",
+			Vars{"RAILS_ENV": str("production"), "WORKERS": str("4")},
+		},
+
+		// Comments
+		{
+			"# The environment.\nRAILS_ENV: production # inline\n# UNUSED: 1\n",
+			Vars{"RAILS_ENV": str("production")},
+		},
+
+		// Anchors, aliases and merge keys
+		{
+			"DATABASE_URL: &db postgres://localhost\nREPLICA_URL: *db\n",
+			Vars{"DATABASE_URL": str("postgres://localhost"), "REPLICA_URL": str("postgres://localhost")},
+		},
+		{
+			"<<: {LOG_LEVEL: info, RAILS_ENV: staging}\nRAILS_ENV: production\n",
+			Vars{"LOG_LEVEL": str("info"), "RAILS_ENV": str("production")},
+		},
+
+		// Null unsets
+		{
+			"RAILS_ENV:\n",
+			Vars{"RAILS_ENV": nil},
+		},
+
+		// Empty
+		{
+			"",
+			Vars{},
+		},
+		{
+			"# Nothing to see here.\n",
+			Vars{},
+		},
+	}
+
+	for _, tt := range tests {
+		vars, err := parseYAMLVars(strings.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("parseYAMLVars(%q) => %v", tt.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(vars, tt.vars) {
+			t.Errorf("parseYAMLVars(%q) => %v; want %v", tt.in, vars, tt.vars)
+		}
+	}
+}
+
+func TestParseYAMLVars_Invalid(t *testing.T) {
+	tests := []string{
+		"RAILS_ENV: [production\n",
+		"- production\n",
+		"HOSTS:\n  - a\n  - b\n",
+		// Nested maps
+		"RAILS_ENV:\n  name: production\n",
+	}
+
+	for _, in := range tests {
+		if _, err := parseYAMLVars(strings.NewReader(in)); err == nil {
+			t.Errorf("parseYAMLVars(%q) => nil; want an error", in)
+		} else if _, ok := err.(*ParseError); !ok {
+			t.Errorf("parseYAMLVars(%q) => %T; want a ParseError", in, err)
+		}
+	}
+}
+
+func TestEnvConfigValidator(t *testing.T) {
+	var called []string
+	v, err := NewEnvConfigValidator(map[string]func(string) error{
+		"^DATABASE_URL$": func(value string) error {
+			called = append(called, value)
+			if !strings.HasPrefix(value, "postgres://") {
+				return fmt.Errorf("must be a postgres url")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Validate("DATABASE_URL", "postgres://localhost/acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Validate("DATABASE_URL", "mysql://localhost/acme"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// Unmatched keys aren't validated.
+	if err := v.Validate("REPLICA_DATABASE_URL", "mysql://localhost/acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"postgres://localhost/acme", "mysql://localhost/acme"}; !reflect.DeepEqual(called, want) {
+		t.Fatalf("called with %v; want %v", called, want)
+	}
+}
+
+func TestNewEnvConfigValidator_InvalidPattern(t *testing.T) {
+	if _, err := NewEnvConfigValidator(map[string]func(string) error{
+		"^(PORT": func(string) error { return nil },
+	}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestValidateConfigVars(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	v, err := NewEnvConfigValidator(map[string]func(string) error{
+		"^PORT$": func(value string) error {
+			if _, err := strconv.Atoi(value); err != nil {
+				return fmt.Errorf("must be numeric")
+			}
+			return nil
+		},
+		"^LOG_LEVEL$": func(value string) error {
+			switch value {
+			case "debug", "info", "warn", "error":
+				return nil
+			}
+			return fmt.Errorf("must be one of debug, info, warn or error")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	validators := []ConfigValidator{v}
+
+	tests := []struct {
+		vars Vars
+		err  string
+	}{
+		{Vars{"PORT": str("8080"), "LOG_LEVEL": str("info")}, ""},
+		{Vars{"PORT": nil, "OTHER": str("anything")}, ""},
+		{Vars{"PORT": str("http")}, "invalid config vars: PORT: must be numeric"},
+		{Vars{"PORT": str("http"), "LOG_LEVEL": str("trace")}, "invalid config vars: LOG_LEVEL: must be one of debug, info, warn or error, PORT: must be numeric"},
+	}
+
+	for _, tt := range tests {
+		err := validateConfigVars(validators, tt.vars)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("validateConfigVars(%v) => %v; want nil", tt.vars, err)
+			}
+			continue
+		}
+
+		if _, ok := err.(*ValidationError); !ok || err.Error() != tt.err {
+			t.Errorf("validateConfigVars(%v) => %v; want %q", tt.vars, err, tt.err)
+		}
+	}
+}
+
+func TestBulkApplyError(t *testing.T) {
+	err := &BulkApplyError{Errors: map[string]error{
+		"acme-jobs": ErrAppNotFound,
+		"acme-api":  &ValidationError{Err: errors.New("invalid config vars: PORT: must be numeric")},
+	}}
+
+	if got, want := err.Error(), "config changes were not applied: acme-api: invalid config vars: PORT: must be numeric, acme-jobs: "+ErrAppNotFound.Error(); got != want {
+		t.Fatalf("Error() => %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,420 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// DefaultCrashLoopInterval is how often the CrashLoopDetector checks for
+// crashing processes by default.
+var DefaultCrashLoopInterval = 30 * time.Second
+
+// ErrInvalidCrashLoopPolicy is returned when the threshold or window of a
+// CrashLoopPolicy is not positive.
+var ErrInvalidCrashLoopPolicy = &ValidationError{
+	errors.New("Crash loop threshold and window must be greater than 0."),
+}
+
+// CrashLoopPolicy configures crash loop detection for a process type of an
+// app. A process type is considered to be crash looping when its instances
+// crash Threshold times within WindowMinutes.
+type CrashLoopPolicy struct {
+	ID string
+
+	AppID string
+	App   *App
+
+	ProcessType ProcessType
+
+	// The number of crashes within the window that is considered a crash
+	// loop.
+	Threshold int
+
+	// The window, in minutes, to count crashes within.
+	WindowMinutes int
+
+	// When true, the app is rolled back to the last release tagged with
+	// ReleaseTagHealthy when a crash loop is detected.
+	AutoRollback bool
+}
+
+// CrashLoopPoliciesQuery is a Scope implementation for common things to
+// filter crash loop policies by.
+type CrashLoopPoliciesQuery struct {
+	// If provided, filters policies for the given app.
+	App *App
+}
+
+// Scope implements the Scope interface.
+func (q CrashLoopPoliciesQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.App != nil {
+		scope = append(scope, ForApp(q.App))
+	}
+
+	scope = append(scope, Preload("App"))
+
+	return scope.Scope(db)
+}
+
+// CrashLoopPolicies returns all crash loop policies matching the scope.
+func (s *store) CrashLoopPolicies(scope Scope) ([]*CrashLoopPolicy, error) {
+	var policies []*CrashLoopPolicy
+	return policies, s.Find(scope, &policies)
+}
+
+// CrashLoopPoliciesSet creates or replaces the crash loop policy for the
+// process type.
+func (s *store) CrashLoopPoliciesSet(policy *CrashLoopPolicy) (*CrashLoopPolicy, error) {
+	if err := s.writable(); err != nil {
+		return policy, err
+	}
+
+	t := s.db.Begin()
+
+	if err := t.Where("app_id = ? and process_type = ?", policy.AppID, policy.ProcessType).Delete(CrashLoopPolicy{}).Error; err != nil {
+		t.Rollback()
+		return policy, err
+	}
+
+	if err := t.Create(policy).Error; err != nil {
+		t.Rollback()
+		return policy, err
+	}
+
+	return policy, t.Commit().Error
+}
+
+// CrashLoopDetector periodically checks the instances of apps that have a
+// CrashLoopPolicy, and sends a "crash_loop" notification when the instances of
+// a process type crash too many times.
+//
+// Instances are replaced when they crash, so when an instance of the current
+// release disappears, the scheduler is asked how it exited. Instances that
+// were stopped, e.g. by a deploy or a scale down, exit from SIGTERM or SIGKILL
+// and aren't counted. New instances, and instances of previous releases, are
+// never counted either.
+//
+// Once a release has run for the longest window of the app's policies without
+// crashing, it's tagged with ReleaseTagHealthy, which is what AutoRollback
+// rolls back to.
+type CrashLoopDetector struct {
+	// How often to check for crash loops. Defaults to
+	// DefaultCrashLoopInterval.
+	Interval time.Duration
+
+	store    *store
+	manager  service.Manager
+	releases *releasesService
+	notifier *notifier
+
+	// rollback is called to roll back an app whose policy has
+	// AutoRollback set.
+	rollback func(context.Context, *App) error
+
+	mu sync.Mutex
+
+	// The running instances of each process type, mapped to the release
+	// they belong to.
+	seen map[crashLoopKey]map[string]string
+
+	// The times that instances crashed for each process type.
+	restarts map[crashLoopKey][]time.Time
+
+	// The version of the active release of each app, and when it was
+	// first seen, or when the app last crashed.
+	versions map[string]int
+	since    map[string]time.Time
+
+	// The version of each app that was last tagged as healthy.
+	healthy map[string]int
+}
+
+// crashLoopKey identifies a process type of an app.
+type crashLoopKey struct {
+	AppID       string
+	ProcessType ProcessType
+}
+
+func newCrashLoopDetector(store *store, manager service.Manager, releases *releasesService, notifier *notifier) *CrashLoopDetector {
+	d := &CrashLoopDetector{
+		store:    store,
+		manager:  manager,
+		releases: releases,
+		notifier: notifier,
+		seen:     make(map[crashLoopKey]map[string]string),
+		restarts: make(map[crashLoopKey][]time.Time),
+		versions: make(map[string]int),
+		since:    make(map[string]time.Time),
+		healthy:  make(map[string]int),
+	}
+	d.rollback = d.rollbackToHealthy
+	return d
+}
+
+// Run checks for crash loops every Interval until the context is cancelled.
+func (d *CrashLoopDetector) Run(ctx context.Context) {
+	interval := d.Interval
+	if interval == 0 {
+		interval = DefaultCrashLoopInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := d.Check(ctx); err != nil {
+				reporter.Report(ctx, err)
+			}
+		}
+	}
+}
+
+// Check checks every app with a CrashLoopPolicy for crash loops.
+func (d *CrashLoopDetector) Check(ctx context.Context) error {
+	policies, err := d.store.CrashLoopPolicies(CrashLoopPoliciesQuery{})
+	if err != nil {
+		return err
+	}
+
+	byApp := make(map[string][]*CrashLoopPolicy)
+	for _, p := range policies {
+		byApp[p.AppID] = append(byApp[p.AppID], p)
+	}
+
+	for _, policies := range byApp {
+		app := policies[0].App
+
+		current, err := d.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+		if err == gorm.RecordNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		instances, err := d.manager.Instances(ctx, app.ID)
+		if err != nil {
+			return err
+		}
+
+		looping, healthy, err := d.observe(ctx, timex.Now(), current.Version, policies, instances)
+		if err != nil {
+			return err
+		}
+
+		if healthy {
+			if _, err := d.store.ReleaseTagsSet(&ReleaseTag{AppID: app.ID, ReleaseID: current.ID, Tag: ReleaseTagHealthy}); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range looping {
+			if err := d.crashLoop(ctx, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// observe records the instances of an app, whose active release is version,
+// and counts the instances that have crashed since the last check. It returns
+// the policies whose threshold has been reached, and whether the release
+// should now be tagged as healthy.
+func (d *CrashLoopDetector) observe(ctx context.Context, now time.Time, version int, policies []*CrashLoopPolicy, instances []*service.Instance) ([]*CrashLoopPolicy, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	appID := policies[0].AppID
+
+	// A new release was deployed, so start counting over. The instances
+	// of the previous release are about to be stopped.
+	if v, ok := d.versions[appID]; !ok || v != version {
+		d.versions[appID] = version
+		d.since[appID] = now
+		for _, p := range policies {
+			delete(d.restarts, crashLoopKey{AppID: appID, ProcessType: p.ProcessType})
+		}
+	}
+
+	release := fmt.Sprintf("v%d", version)
+
+	var (
+		looping []*CrashLoopPolicy
+		window  time.Duration
+	)
+
+	for _, p := range policies {
+		k := crashLoopKey{AppID: p.AppID, ProcessType: p.ProcessType}
+
+		running := make(map[string]string)
+		for _, i := range instances {
+			if i.Process.Type == string(p.ProcessType) {
+				running[i.ID] = i.Process.Env["EMPIRE_RELEASE"]
+			}
+		}
+
+		for id, r := range d.seen[k] {
+			if _, ok := running[id]; ok || r != release {
+				continue
+			}
+
+			exit, err := d.manager.InstanceExit(ctx, id)
+			if err != nil {
+				return nil, false, err
+			}
+
+			if crashed(exit) {
+				d.restarts[k] = append(d.restarts[k], now)
+				d.since[appID] = now
+			}
+		}
+
+		// Instances that are gone have been counted, so only the
+		// running ones need to be remembered.
+		d.seen[k] = running
+
+		w := time.Duration(p.WindowMinutes) * time.Minute
+		if w > window {
+			window = w
+		}
+
+		d.restarts[k] = restartsWithin(d.restarts[k], now, w)
+
+		if p.Threshold > 0 && len(d.restarts[k]) >= p.Threshold {
+			looping = append(looping, p)
+			delete(d.restarts, k)
+		}
+	}
+
+	healthy := d.healthy[appID] != version && now.Sub(d.since[appID]) >= window
+	if healthy {
+		d.healthy[appID] = version
+	}
+
+	return looping, healthy, nil
+}
+
+// crashed returns true if the instance exited because its process crashed,
+// rather than being stopped. Stopped processes exit with 143 from SIGTERM, or
+// 137 from SIGKILL if they didn't exit in time, unless the kernel killed them
+// for using too much memory.
+func crashed(exit *service.InstanceExit) bool {
+	if exit == nil {
+		return false
+	}
+
+	if strings.HasPrefix(exit.Reason, "OutOfMemoryError") {
+		return true
+	}
+
+	// The process couldn't be started.
+	if exit.ExitCode == nil {
+		return exit.Reason != ""
+	}
+
+	switch *exit.ExitCode {
+	case 0, 137, 143:
+		return false
+	default:
+		return true
+	}
+}
+
+// crashLoop sends a notification about the crash loop, and rolls the app
+// back to its last healthy release if the policy allows it.
+func (d *CrashLoopDetector) crashLoop(ctx context.Context, p *CrashLoopPolicy) error {
+	d.notifier.Notify(ctx, Notification{
+		Severity: SeverityCritical,
+		App:      p.App.Name,
+		Event:    NotificationCrashLoop,
+		Message:  fmt.Sprintf("%s %s crashed %d times in %d minutes", p.App.Name, p.ProcessType, p.Threshold, p.WindowMinutes),
+	})
+
+	if !p.AutoRollback {
+		return nil
+	}
+
+	return d.rollback(ctx, p.App)
+}
+
+// rollbackToHealthy rolls the app back to the release tagged with
+// ReleaseTagHealthy. Nothing is done if no release has been healthy yet, or if
+// the current release already runs the slug and config of the healthy one.
+func (d *CrashLoopDetector) rollbackToHealthy(ctx context.Context, app *App) error {
+	current, err := d.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		return err
+	}
+
+	tag := ReleaseTagHealthy
+	t, err := d.store.ReleaseTagsFirst(ReleaseTagsQuery{App: app, Tag: &tag})
+	if err == gorm.RecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	healthy, err := d.store.ReleasesFirst(ReleasesQuery{ID: &t.ReleaseID})
+	if err != nil {
+		return err
+	}
+
+	if healthy.SlugID == current.SlugID && healthy.ConfigID == current.ConfigID {
+		return nil
+	}
+
+	_, err = d.releases.ReleasesRollback(ctx, app, healthy.Version)
+	return err
+}
+
+// restartsWithin returns the restarts that happened less than window before
+// now.
+func restartsWithin(restarts []time.Time, now time.Time, window time.Duration) []time.Time {
+	var within []time.Time
+	for _, t := range restarts {
+		if now.Sub(t) < window {
+			within = append(within, t)
+		}
+	}
+	return within
+}
+
+// CrashLoopPoliciesSet sets the crash loop policy for a process type of the
+// app.
+func (d *CrashLoopDetector) CrashLoopPoliciesSet(app *App, processType string, policy CrashLoopPolicy) error {
+	if err := validateCrashLoopPolicy(policy); err != nil {
+		return err
+	}
+
+	policy.AppID = app.ID
+	policy.ProcessType = ProcessType(processType)
+
+	_, err := d.store.CrashLoopPoliciesSet(&policy)
+	return err
+}
+
+// validateCrashLoopPolicy returns an error if the policy can't be used.
+func validateCrashLoopPolicy(p CrashLoopPolicy) error {
+	if p.Threshold <= 0 || p.WindowMinutes <= 0 {
+		return ErrInvalidCrashLoopPolicy
+	}
+	return nil
+}
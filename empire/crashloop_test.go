@@ -0,0 +1,254 @@
+package empire
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+// recordingNotificationChannel is a NotificationChannel that records the
+// notifications that it receives.
+type recordingNotificationChannel struct {
+	sync.Mutex
+	notifications []Notification
+}
+
+func (c *recordingNotificationChannel) Notify(ctx context.Context, n Notification) error {
+	c.Lock()
+	defer c.Unlock()
+	c.notifications = append(c.notifications, n)
+	return nil
+}
+
+// exitsManager is a service.Manager that reports how stopped instances
+// exited.
+type exitsManager struct {
+	*service.FakeManager
+	exits map[string]*service.InstanceExit
+}
+
+func (m *exitsManager) InstanceExit(ctx context.Context, instanceID string) (*service.InstanceExit, error) {
+	return m.exits[instanceID], nil
+}
+
+func exitCode(code int) *service.InstanceExit {
+	return &service.InstanceExit{ExitCode: &code}
+}
+
+func TestCrashLoopDetector(t *testing.T) {
+	app := &App{ID: "1234", Name: "acme-inc"}
+
+	instances := func(version int, ids ...int) []*service.Instance {
+		web := &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": fmt.Sprintf("v%d", version)}}
+		var i []*service.Instance
+		for _, id := range ids {
+			i = append(i, &service.Instance{ID: fmt.Sprintf("%d", id), Process: web})
+		}
+		return i
+	}
+
+	policies := []*CrashLoopPolicy{
+		{AppID: app.ID, App: app, ProcessType: "web", Threshold: 3, WindowMinutes: 5, AutoRollback: true},
+	}
+
+	m := &exitsManager{
+		FakeManager: service.NewFakeManager(),
+		exits: map[string]*service.InstanceExit{
+			"2": exitCode(143), // Stopped by the deploy of v2.
+			"3": exitCode(1),
+			"4": exitCode(1),
+			"5": exitCode(0), // Exited cleanly.
+			"6": exitCode(1),
+			"7": exitCode(1),
+		},
+	}
+
+	var rollbacks []*App
+	c := &recordingNotificationChannel{}
+	n := newNotifier(c)
+	d := newCrashLoopDetector(nil, m, nil, n)
+	d.rollback = func(ctx context.Context, app *App) error {
+		rollbacks = append(rollbacks, app)
+		return nil
+	}
+
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	checks := []struct {
+		version   int
+		instances []*service.Instance
+		looping   int
+	}{
+		// The first check only records the running instances.
+		{1, instances(1, 1, 2), 0},
+		// v2 is deployed, and scaled up. Instance 2 of v1 is stopped,
+		// and new instances don't count as crashes.
+		{2, append(instances(1, 1), instances(2, 3, 4, 5)...), 0},
+		// Instance 3 crashed and was replaced by 6.
+		{2, append(instances(1, 1), instances(2, 4, 5, 6)...), 0},
+		// Instance 5 exited cleanly, and instance 1 of v1 is gone.
+		{2, instances(2, 4, 6, 7), 0},
+		// Instances 4 and 6 crashed, which reaches the threshold.
+		{2, instances(2, 7, 8, 9), 1},
+		// The crashes are reset after a crash loop is detected.
+		{2, instances(2, 8, 9, 10), 0},
+	}
+
+	for i, tt := range checks {
+		now = now.Add(time.Minute)
+
+		looping, _, err := d.observe(context.Background(), now, tt.version, policies, tt.instances)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(looping), tt.looping; got != want {
+			t.Fatalf("#%d: crash loops => %d; want %d", i, got, want)
+		}
+
+		for _, p := range looping {
+			if err := d.crashLoop(context.Background(), p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	n.Wait()
+
+	if got, want := len(c.notifications), 1; got != want {
+		t.Fatalf("notifications => %d; want %d", got, want)
+	}
+
+	if got, want := c.notifications[0].Event, NotificationCrashLoop; got != want {
+		t.Fatalf("Event => %s; want %s", got, want)
+	}
+
+	if got, want := len(rollbacks), 1; got != want {
+		t.Fatalf("rollbacks => %d; want %d", got, want)
+	}
+
+	// Only the instances that are still running are remembered.
+	seen := d.seen[crashLoopKey{AppID: app.ID, ProcessType: "web"}]
+	if got, want := len(seen), 3; got != want {
+		t.Fatalf("seen => %d; want %d", got, want)
+	}
+}
+
+func TestCrashLoopDetector_Window(t *testing.T) {
+	app := &App{ID: "1234", Name: "acme-inc"}
+	web := &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}
+
+	policies := []*CrashLoopPolicy{
+		{AppID: app.ID, App: app, ProcessType: "web", Threshold: 2, WindowMinutes: 5},
+	}
+
+	m := &exitsManager{FakeManager: service.NewFakeManager(), exits: make(map[string]*service.InstanceExit)}
+	d := newCrashLoopDetector(nil, m, nil, nil)
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 4; i++ {
+		// Crashes are 10 minutes apart, which never reaches the
+		// threshold within the window.
+		now = now.Add(10 * time.Minute)
+		m.exits[fmt.Sprintf("%d", i-1)] = exitCode(1)
+
+		looping, _, err := d.observe(context.Background(), now, 1, policies, []*service.Instance{
+			{ID: fmt.Sprintf("%d", i), Process: web},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(looping) != 0 {
+			t.Fatalf("#%d: Expected no crash loops", i)
+		}
+	}
+}
+
+func TestCrashLoopDetector_Healthy(t *testing.T) {
+	app := &App{ID: "1234", Name: "acme-inc"}
+	web := &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}
+
+	policies := []*CrashLoopPolicy{
+		{AppID: app.ID, App: app, ProcessType: "web", Threshold: 3, WindowMinutes: 5},
+	}
+
+	m := &exitsManager{
+		FakeManager: service.NewFakeManager(),
+		exits:       map[string]*service.InstanceExit{"1": exitCode(1)},
+	}
+	d := newCrashLoopDetector(nil, m, nil, nil)
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	checks := []struct {
+		minutes   int
+		instances []string
+		healthy   bool
+	}{
+		{0, []string{"1"}, false},
+		// Instance 1 crashed, which restarts the clean period.
+		{4, []string{"2"}, false},
+		{8, []string{"2"}, false},
+		{9, []string{"2"}, true},
+		// The release is only tagged once.
+		{10, []string{"2"}, false},
+	}
+
+	start := now
+	for i, tt := range checks {
+		now = start.Add(time.Duration(tt.minutes) * time.Minute)
+
+		var instances []*service.Instance
+		for _, id := range tt.instances {
+			instances = append(instances, &service.Instance{ID: id, Process: web})
+		}
+
+		_, healthy, err := d.observe(context.Background(), now, 1, policies, instances)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := healthy, tt.healthy; got != want {
+			t.Fatalf("#%d: healthy => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestCrashed(t *testing.T) {
+	tests := []struct {
+		exit    *service.InstanceExit
+		crashed bool
+	}{
+		{nil, false},
+		{exitCode(0), false},
+		{exitCode(1), true},
+		{exitCode(137), false},
+		{exitCode(143), false},
+		{&service.InstanceExit{ExitCode: exitCode(137).ExitCode, Reason: "OutOfMemoryError: Container killed due to memory usage"}, true},
+		{&service.InstanceExit{Reason: "CannotPullContainerError: image not found"}, true},
+		{&service.InstanceExit{}, false},
+	}
+
+	for i, tt := range tests {
+		if got, want := crashed(tt.exit), tt.crashed; got != want {
+			t.Fatalf("#%d: crashed => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestValidateCrashLoopPolicy(t *testing.T) {
+	tests := []struct {
+		policy CrashLoopPolicy
+		err    error
+	}{
+		{CrashLoopPolicy{Threshold: 3, WindowMinutes: 5}, nil},
+		{CrashLoopPolicy{Threshold: 0, WindowMinutes: 5}, ErrInvalidCrashLoopPolicy},
+		{CrashLoopPolicy{Threshold: 3, WindowMinutes: 0}, ErrInvalidCrashLoopPolicy},
+	}
+
+	for i, tt := range tests {
+		if got, want := validateCrashLoopPolicy(tt.policy), tt.err; got != want {
+			t.Fatalf("#%d: err => %v; want %v", i, got, want)
+		}
+	}
+}
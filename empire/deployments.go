@@ -3,6 +3,7 @@ package empire
 import (
 	"fmt"
 
+	"github.com/jinzhu/gorm"
 	"golang.org/x/net/context"
 )
 
@@ -24,6 +25,42 @@ type DeploymentsCreateOpts struct {
 
 	// EventCh will receive deployment events during deployment.
 	EventCh chan Event
+
+	// Metadata about the source of the image.
+	Metadata ReleaseMetadata
+
+	// Description of the release. Defaults to "Deploy <image>".
+	Description string
+
+	// If provided, recorded on the release so that retries can find it.
+	IdempotencyKey string
+}
+
+// DeployOptions are options for ReleasesCreateFromImage.
+type DeployOptions struct {
+	// Description of the release. Defaults to "Deploy <image>".
+	Description string
+
+	// Metadata about the source of the image.
+	ReleaseMetadata
+
+	// When true, the app is created if it doesn't exist. Otherwise,
+	// ErrAppNotFound is returned.
+	CreateAppIfMissing bool
+
+	// If provided, and the app already has a release with this key, that
+	// release is returned instead of creating a new one. This allows
+	// callers to safely retry deploys.
+	IdempotencyKey string
+}
+
+// ReleaseMetadata describes what an image was built from.
+type ReleaseMetadata struct {
+	// The git commit sha.
+	CommitSHA string
+
+	// The git branch.
+	Branch string
 }
 
 type deployer struct {
@@ -31,6 +68,8 @@ type deployer struct {
 	*configsService
 	*slugsService
 	*releasesService
+
+	notifier *notifier
 }
 
 // DeploymentsDo performs the Deployment.
@@ -51,33 +90,130 @@ func (s *deployer) DeploymentsDo(ctx context.Context, opts DeploymentsCreateOpts
 
 	// Create a new release for the Config
 	// and Slug.
-	desc := fmt.Sprintf("Deploy %s", image.String())
-	return s.ReleasesCreate(ctx, &Release{
-		App:         app,
-		Config:      config,
-		Slug:        slug,
-		Description: desc,
+	desc := opts.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Deploy %s", image.String())
+	}
+	return s.ReleasesDeploy(ctx, &Release{
+		App:            app,
+		Config:         config,
+		Slug:           slug,
+		Description:    desc,
+		CommitSHA:      opts.Metadata.CommitSHA,
+		Branch:         opts.Metadata.Branch,
+		IdempotencyKey: opts.IdempotencyKey,
 	})
 }
 
-func (s *deployer) DeployImageToApp(ctx context.Context, app *App, image Image, out chan Event) (*Release, error) {
+func (s *deployer) DeployImageToApp(ctx context.Context, app *App, image Image, meta ReleaseMetadata, out chan Event) (*Release, error) {
 	if err := s.appsService.AppsEnsureRepo(app, image.Repo); err != nil {
 		return nil, err
 	}
 
 	return s.DeploymentsDo(ctx, DeploymentsCreateOpts{
-		App:     app,
-		Image:   image,
-		EventCh: out,
+		App:      app,
+		Image:    image,
+		EventCh:  out,
+		Metadata: meta,
 	})
 }
 
+// ReleasesCreateFromImage finds the app by name, then creates a release of the
+// image with the apps current config.
+func (s *deployer) ReleasesCreateFromImage(ctx context.Context, appName string, image string, opts DeployOptions) (*Release, error) {
+	img, err := decodeImage(image)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.appsFindOrCreateByName(appName, img.Repo, opts.CreateAppIfMissing)
+	if err != nil {
+		return nil, err
+	}
+
+	if key := opts.IdempotencyKey; key != "" {
+		r, err := s.releasesService.store.ReleasesFirst(ReleasesQuery{App: app, IdempotencyKey: &key})
+		if err != gorm.RecordNotFound {
+			return r, err
+		}
+	}
+
+	if err := s.appsService.AppsEnsureRepo(app, img.Repo); err != nil {
+		return nil, err
+	}
+
+	// Nobody is interested in the events from pulling the image.
+	out := make(chan Event)
+	go func() {
+		for range out {
+		}
+	}()
+	defer close(out)
+
+	r, err := s.DeploymentsDo(ctx, DeploymentsCreateOpts{
+		App:            app,
+		Image:          img,
+		EventCh:        out,
+		Metadata:       opts.ReleaseMetadata,
+		Description:    opts.Description,
+		IdempotencyKey: opts.IdempotencyKey,
+	})
+
+	// Another deploy with the same key created its release after we
+	// checked for one above.
+	if err == errDuplicateIdempotencyKey {
+		key := opts.IdempotencyKey
+		return s.releasesService.store.ReleasesFirst(ReleasesQuery{App: app, IdempotencyKey: &key})
+	}
+
+	return r, err
+}
+
+func (s *deployer) appsFindOrCreateByName(name, repo string, create bool) (*App, error) {
+	app, err := s.appsService.store.AppsFirst(AppsQuery{Name: &name})
+	if err == nil {
+		return app, nil
+	}
+
+	if err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	if !create {
+		return nil, ErrAppNotFound
+	}
+
+	return s.appsService.AppsCreate(&App{Name: name, Repo: &repo})
+}
+
 // Deploy deploys an Image to the cluster.
-func (s *deployer) DeployImage(ctx context.Context, image Image, out chan Event) (*Release, error) {
+func (s *deployer) DeployImage(ctx context.Context, image Image, meta ReleaseMetadata, out chan Event) (*Release, error) {
+	r, err := s.deployImage(ctx, image, meta, out)
+	if err != nil {
+		s.notifier.Notify(ctx, Notification{
+			Severity: SeverityCritical,
+			App:      NewAppNameFromRepo(image.Repo),
+			Event:    NotificationDeployFailed,
+			Message:  fmt.Sprintf("Failed to deploy %s: %v", image.String(), err),
+		})
+		return r, err
+	}
+
+	s.notifier.Notify(ctx, Notification{
+		Severity: SeverityInfo,
+		App:      r.App.Name,
+		Event:    NotificationDeploy,
+		Message:  fmt.Sprintf("Deployed %s to %s as v%d", image.String(), r.App.Name, r.Version),
+	})
+
+	return r, nil
+}
+
+func (s *deployer) deployImage(ctx context.Context, image Image, meta ReleaseMetadata, out chan Event) (*Release, error) {
 	app, err := s.appsService.AppsFindOrCreateByRepo(image.Repo)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.DeployImageToApp(ctx, app, image, out)
+	return s.DeployImageToApp(ctx, app, image, meta, out)
 }
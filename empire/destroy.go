@@ -0,0 +1,321 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// DefaultDestroySweepInterval is how often pending destroys that are due are
+// executed by default.
+var DefaultDestroySweepInterval = time.Minute
+
+// ErrDestroyAlreadyExecuted is returned when cancelling a PendingDestroy after
+// the app has been destroyed.
+var ErrDestroyAlreadyExecuted = &ValidationError{
+	errors.New("The app has already been destroyed."),
+}
+
+// PendingDestroy is a destroy of an app that will happen after a grace
+// period. Until then, the app is hidden but can be restored by cancelling it.
+type PendingDestroy struct {
+	ID    string
+	AppID string
+
+	// When the destroy was scheduled, and when the app will be destroyed.
+	ScheduledAt time.Time
+	ExecutesAt  time.Time
+
+	// Set when the destroy was cancelled or executed.
+	CancelledAt *time.Time
+	ExecutedAt  *time.Time
+}
+
+// PendingDestroysQuery is a Scope implementation for common things to filter
+// pending destroys by.
+type PendingDestroysQuery struct {
+	// If provided, finds destroys that haven't been cancelled or executed,
+	// and are due before the given time.
+	DueBefore *time.Time
+}
+
+// Scope implements the Scope interface.
+func (q PendingDestroysQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if t := q.DueBefore; t != nil {
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("cancelled_at is null and executed_at is null and executes_at <= ?", *t)
+		}))
+	}
+
+	scope = append(scope, Order("executes_at"))
+
+	return scope.Scope(db)
+}
+
+// PendingDestroys returns all pending destroys matching the scope.
+func (s *store) PendingDestroys(scope Scope) ([]*PendingDestroy, error) {
+	var pending []*PendingDestroy
+	return pending, s.Find(scope, &pending)
+}
+
+// PendingDestroysFirst returns the first pending destroy matching the scope.
+func (s *store) PendingDestroysFirst(scope Scope) (*PendingDestroy, error) {
+	var pending PendingDestroy
+	return &pending, s.First(scope, &pending)
+}
+
+// PendingDestroysCreate creates the pending destroy, and hides the app until
+// it's cancelled. If the app already has a destroy that hasn't been cancelled
+// or executed, that destroy is returned instead.
+func (s *store) PendingDestroysCreate(pending *PendingDestroy) (*PendingDestroy, error) {
+	if err := s.writable(); err != nil {
+		return pending, err
+	}
+
+	t := s.db.Begin()
+
+	// Lock the app, so that concurrent calls can't both create a destroy.
+	if err := t.Exec(`select id from apps where id = ? for update`, pending.AppID).Error; err != nil {
+		t.Rollback()
+		return pending, err
+	}
+
+	var existing PendingDestroy
+	err := t.Where("app_id = ? and cancelled_at is null and executed_at is null", pending.AppID).First(&existing).Error
+	if err == nil {
+		t.Rollback()
+		return &existing, nil
+	}
+
+	if err != gorm.RecordNotFound {
+		t.Rollback()
+		return pending, err
+	}
+
+	if err := t.Create(pending).Error; err != nil {
+		t.Rollback()
+		return pending, err
+	}
+
+	if err := t.Model(&App{}).Where("id = ?", pending.AppID).UpdateColumn("destroy_scheduled_at", pending.ScheduledAt).Error; err != nil {
+		t.Rollback()
+		return pending, err
+	}
+
+	return pending, t.Commit().Error
+}
+
+// PendingDestroysCancel cancels the pending destroy and restores the app. It
+// returns gorm.RecordNotFound if the destroy has already been cancelled or
+// executed.
+func (s *store) PendingDestroysCancel(pending *PendingDestroy) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	now := timex.Now()
+	db := t.Model(&PendingDestroy{}).Where("id = ? and cancelled_at is null and executed_at is null", pending.ID).UpdateColumn("cancelled_at", &now)
+	if db.Error != nil {
+		t.Rollback()
+		return db.Error
+	}
+
+	if db.RowsAffected == 0 {
+		t.Rollback()
+		return gorm.RecordNotFound
+	}
+
+	if err := t.Model(&App{}).Where("id = ?", pending.AppID).UpdateColumn("destroy_scheduled_at", nil).Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	pending.CancelledAt = &now
+	return t.Commit().Error
+}
+
+// PendingDestroysExecute locks the pending destroy, calls destroy with its
+// app, then marks the destroy as executed. If destroy returns an error, the
+// destroy is left pending, so that it's retried and can still be cancelled.
+// If the app no longer exists, the destroy is marked as executed without
+// calling destroy. It returns gorm.RecordNotFound if the destroy has already
+// been cancelled or executed, or is being executed by another instance.
+func (s *store) PendingDestroysExecute(pending *PendingDestroy, destroy func(*App) error) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	rows, err := t.Raw(`select id from pending_destroys where id = ? and cancelled_at is null and executed_at is null for update skip locked`, pending.ID).Rows()
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	var id string
+	for rows.Next() {
+		err = rows.Scan(&id)
+	}
+	rows.Close()
+
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+
+	if id == "" {
+		t.Rollback()
+		return gorm.RecordNotFound
+	}
+
+	// The app is hidden from AppsQuery while its destroy is pending.
+	var app App
+	err = t.Where("id = ?", pending.AppID).First(&app).Error
+	if err != nil && err != gorm.RecordNotFound {
+		t.Rollback()
+		return err
+	}
+
+	if err == nil {
+		if err := destroy(&app); err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	now := timex.Now()
+	if err := t.Model(&PendingDestroy{}).Where("id = ?", pending.ID).UpdateColumn("executed_at", &now).Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	pending.ExecutedAt = &now
+	return t.Commit().Error
+}
+
+// appsDestroyScheduler destroys apps after a grace period. Pending destroys are
+// stored, and executed by Run once they're due, so they survive restarts and
+// are executed by whichever Empire instance gets to them first.
+type appsDestroyScheduler struct {
+	// How often to check for pending destroys that are due. Defaults to
+	// DefaultDestroySweepInterval.
+	Interval time.Duration
+
+	store *store
+	apps  *appsService
+}
+
+// AppsDestroyScheduled hides the app immediately, and destroys it after
+// destroyAfter unless the returned PendingDestroy is cancelled first. If the
+// app already has a pending destroy, it's returned as is. If destroyAfter is 0, the app is destroyed immediately and no PendingDestroy is
+// returned.
+func (s *appsDestroyScheduler) AppsDestroyScheduled(ctx context.Context, app *App, destroyAfter time.Duration) (*PendingDestroy, error) {
+	if destroyAfter == 0 {
+		return nil, s.apps.AppsDestroy(ctx, app)
+	}
+
+	// Check for conflicts now, rather than failing when nobody is around
+	// to see it.
+	if s.apps.strictDestroy {
+		if err := s.apps.destroyConflicts(ctx, app); err != nil {
+			return nil, err
+		}
+	}
+
+	now := timex.Now()
+	return s.store.PendingDestroysCreate(&PendingDestroy{
+		AppID:       app.ID,
+		ScheduledAt: now,
+		ExecutesAt:  now.Add(destroyAfter),
+	})
+}
+
+// AppsDestroyCancelScheduled cancels the pending destroy, restoring the app.
+func (s *appsDestroyScheduler) AppsDestroyCancelScheduled(pendingID string) error {
+	pending, err := s.store.PendingDestroysFirst(ID(pendingID))
+	if err != nil {
+		return err
+	}
+
+	if pending.ExecutedAt != nil {
+		return ErrDestroyAlreadyExecuted
+	}
+
+	if pending.CancelledAt != nil {
+		return nil
+	}
+
+	if err := s.store.PendingDestroysCancel(pending); err != nil {
+		if err == gorm.RecordNotFound {
+			// Executed or cancelled since it was found.
+			return s.AppsDestroyCancelScheduled(pendingID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Run executes pending destroys that are due every Interval until the context
+// is cancelled.
+func (s *appsDestroyScheduler) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval == 0 {
+		interval = DefaultDestroySweepInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.Sweep(ctx); err != nil {
+				reporter.Report(ctx, err)
+			}
+		}
+	}
+}
+
+// Sweep executes every pending destroy whose executes_at has passed. A failed
+// destroy is reported, and doesn't stop the others.
+func (s *appsDestroyScheduler) Sweep(ctx context.Context) error {
+	now := timex.Now()
+
+	pending, err := s.store.PendingDestroys(PendingDestroysQuery{DueBefore: &now})
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		if err := s.execute(ctx, p); err != nil {
+			reporter.Report(ctx, fmt.Errorf("destroying app %s: %v", p.AppID, err))
+		}
+	}
+
+	return nil
+}
+
+// execute destroys the app, unless the destroy was cancelled.
+func (s *appsDestroyScheduler) execute(ctx context.Context, pending *PendingDestroy) error {
+	err := s.store.PendingDestroysExecute(pending, func(app *App) error {
+		return s.apps.AppsDestroyForce(ctx, app)
+	})
+	if err == gorm.RecordNotFound {
+		// Cancelled, or executed by another instance.
+		return nil
+	}
+	return err
+}
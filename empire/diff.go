@@ -0,0 +1,222 @@
+package empire
+
+import "sort"
+
+// VarChange represents a change to a single config var.
+type VarChange struct {
+	Variable Variable
+
+	// The old value. Nil if the variable was added.
+	Old *string
+
+	// The new value. Nil if the variable was removed.
+	New *string
+}
+
+// ConfigChangeset is a set of changes between two Vars, ordered by variable
+// name.
+type ConfigChangeset []*VarChange
+
+// ConfigDiff returns the changes required to go from the old vars to the new
+// vars.
+func ConfigDiff(old, new Vars) ConfigChangeset {
+	var changes ConfigChangeset
+
+	for k, v := range new {
+		if o, ok := old[k]; !ok || !equalVar(o, v) {
+			changes = append(changes, &VarChange{Variable: k, Old: old[k], New: v})
+		}
+	}
+
+	for k, v := range old {
+		if _, ok := new[k]; !ok {
+			changes = append(changes, &VarChange{Variable: k, Old: v})
+		}
+	}
+
+	sort.Sort(changes)
+
+	return changes
+}
+
+func (c ConfigChangeset) Len() int           { return len(c) }
+func (c ConfigChangeset) Less(i, j int) bool { return c[i].Variable < c[j].Variable }
+func (c ConfigChangeset) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+func equalVar(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// ConfigChange is a config var that differs between an apps config and a
+// reference config.
+type ConfigChange struct {
+	Variable Variable
+
+	// The value in the reference config. Nil if it's not in the reference.
+	Expected *string
+
+	// The value in the apps config, masked unless it's a reference to a
+	// secret. Nil if it's not in the apps config.
+	Actual *string
+}
+
+// DriftReport describes how an apps config has drifted from a reference
+// config, e.g. one that's stored in git.
+type DriftReport struct {
+	// Vars in the reference that aren't set.
+	Missing []ConfigChange
+
+	// Vars that are set but aren't in the reference.
+	Extra []ConfigChange
+
+	// Vars whose value differs from the reference.
+	Changed []ConfigChange
+}
+
+// Drifted returns true if the config differs from the reference.
+func (r *DriftReport) Drifted() bool {
+	return len(r.Missing)+len(r.Extra)+len(r.Changed) > 0
+}
+
+// ConfigDrift compares the actual vars with the reference vars. Actual values
+// are passed through mask before they're included in the report. A nil value
+// in the reference means the var shouldn't be set.
+func ConfigDrift(actual, reference Vars, mask func(string) string) *DriftReport {
+	report := &DriftReport{}
+
+	for _, c := range ConfigDiff(actual, reference) {
+		change := ConfigChange{Variable: c.Variable, Expected: c.New}
+		if c.Old != nil {
+			v := mask(*c.Old)
+			change.Actual = &v
+		}
+
+		switch {
+		case c.Old == nil && c.New == nil:
+			// Unset in the reference, and not set.
+		case c.Old == nil:
+			report.Missing = append(report.Missing, change)
+		case c.New == nil:
+			report.Extra = append(report.Extra, change)
+		default:
+			report.Changed = append(report.Changed, change)
+		}
+	}
+
+	return report
+}
+
+// SlugChangeset describes the change in image between two slugs.
+type SlugChangeset struct {
+	OldImage Image
+	NewImage Image
+
+	// The image IDs (a tag or content digest) of the old and new images.
+	OldDigest string
+	NewDigest string
+
+	ImageChanged bool
+}
+
+// SlugDiff returns the changes between the old slug and the new slug.
+func SlugDiff(old, new *Slug) SlugChangeset {
+	return SlugChangeset{
+		OldImage:     old.Image,
+		NewImage:     new.Image,
+		OldDigest:    old.Image.ID,
+		NewDigest:    new.Image.ID,
+		ImageChanged: old.Image != new.Image,
+	}
+}
+
+// ProcessDiff describes the change to a single process between two
+// formations. A process that was added has a zero Old* quantity and command,
+// and a process that was removed has a zero New* quantity and command.
+type ProcessDiff struct {
+	Type ProcessType
+
+	Added   bool
+	Removed bool
+
+	OldQuantity int
+	NewQuantity int
+
+	OldCommand Command
+	NewCommand Command
+
+	OldConstraints Constraints
+	NewConstraints Constraints
+}
+
+// FormationDiff returns a ProcessDiff for each process that differs between the
+// old and new formations, ordered by process type.
+func FormationDiff(old, new Formation) []ProcessDiff {
+	var diffs []ProcessDiff
+
+	for t, n := range new {
+		o, ok := old[t]
+		if !ok {
+			diffs = append(diffs, ProcessDiff{
+				Type:           t,
+				Added:          true,
+				NewQuantity:    n.Quantity,
+				NewCommand:     n.Command,
+				NewConstraints: n.Constraints,
+			})
+			continue
+		}
+
+		if o.Quantity != n.Quantity || o.Command != n.Command || o.Constraints != n.Constraints {
+			diffs = append(diffs, ProcessDiff{
+				Type:           t,
+				OldQuantity:    o.Quantity,
+				NewQuantity:    n.Quantity,
+				OldCommand:     o.Command,
+				NewCommand:     n.Command,
+				OldConstraints: o.Constraints,
+				NewConstraints: n.Constraints,
+			})
+		}
+	}
+
+	for t, o := range old {
+		if _, ok := new[t]; !ok {
+			diffs = append(diffs, ProcessDiff{
+				Type:           t,
+				Removed:        true,
+				OldQuantity:    o.Quantity,
+				OldCommand:     o.Command,
+				OldConstraints: o.Constraints,
+			})
+		}
+	}
+
+	sort.Sort(processDiffsByType(diffs))
+
+	return diffs
+}
+
+type processDiffsByType []ProcessDiff
+
+func (s processDiffsByType) Len() int           { return len(s) }
+func (s processDiffsByType) Less(i, j int) bool { return s[i].Type < s[j].Type }
+func (s processDiffsByType) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// ReleaseComparison describes the differences between two releases.
+type ReleaseComparison struct {
+	ConfigChanges    ConfigChangeset
+	SlugChanges      SlugChangeset
+	FormationChanges []ProcessDiff
+}
+
+// CompareReleases returns the differences between the from and to releases.
+func CompareReleases(from, to *Release) *ReleaseComparison {
+	return &ReleaseComparison{
+		ConfigChanges:    ConfigDiff(from.Config.Vars, to.Config.Vars),
+		SlugChanges:      SlugDiff(from.Slug, to.Slug),
+		FormationChanges: FormationDiff(from.Formation(), to.Formation()),
+	}
+}
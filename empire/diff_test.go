@@ -0,0 +1,191 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigDiff(t *testing.T) {
+	var (
+		production = "production"
+		staging    = "staging"
+		url        = "postgres://localhost"
+	)
+
+	old := Vars{
+		"RAILS_ENV":    &production,
+		"DATABASE_URL": &url,
+		"DEBUG":        &production,
+	}
+
+	new := Vars{
+		"RAILS_ENV": &staging,
+		"DEBUG":     &production,
+		"NEW_VAR":   &url,
+	}
+
+	got := ConfigDiff(old, new)
+	want := ConfigChangeset{
+		{Variable: "DATABASE_URL", Old: &url},
+		{Variable: "NEW_VAR", New: &url},
+		{Variable: "RAILS_ENV", Old: &production, New: &staging},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ConfigDiff => %v; want %v", got, want)
+	}
+
+	if got := ConfigDiff(old, old); len(got) != 0 {
+		t.Fatalf("ConfigDiff => %v; want no changes", got)
+	}
+}
+
+func TestFormationDiff(t *testing.T) {
+	old := Formation{
+		"web":    &Process{Type: "web", Quantity: 1, Command: "./bin/web", Constraints: Constraints1X},
+		"worker": &Process{Type: "worker", Quantity: 1, Command: "sidekiq", Constraints: Constraints1X},
+		"clock":  &Process{Type: "clock", Quantity: 1, Command: "clockwork", Constraints: Constraints1X},
+	}
+
+	new := Formation{
+		"web":       &Process{Type: "web", Quantity: 2, Command: "./bin/web", Constraints: Constraints1X},
+		"worker":    &Process{Type: "worker", Quantity: 1, Command: "sidekiq", Constraints: Constraints1X},
+		"scheduler": &Process{Type: "scheduler", Quantity: 0, Command: "./bin/scheduler", Constraints: Constraints1X},
+	}
+
+	got := FormationDiff(old, new)
+	want := []ProcessDiff{
+		{Type: "clock", Removed: true, OldQuantity: 1, OldCommand: "clockwork", OldConstraints: Constraints1X},
+		{Type: "scheduler", Added: true, NewQuantity: 0, NewCommand: "./bin/scheduler", NewConstraints: Constraints1X},
+		{Type: "web", OldQuantity: 1, NewQuantity: 2, OldCommand: "./bin/web", NewCommand: "./bin/web", OldConstraints: Constraints1X, NewConstraints: Constraints1X},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FormationDiff => %v; want %v", got, want)
+	}
+}
+
+func TestCompareReleases(t *testing.T) {
+	var (
+		production = "production"
+		staging    = "staging"
+	)
+
+	v1 := &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "v1"}}
+	v2 := &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "v2"}}
+
+	productionConfig := &Config{Vars: Vars{"RAILS_ENV": &production}}
+	stagingConfig := &Config{Vars: Vars{"RAILS_ENV": &staging}}
+
+	processes := []*Process{{Type: "web", Quantity: 1, Command: "./bin/web"}}
+
+	tests := []struct {
+		from, to *Release
+
+		configChanges    int
+		imageChanged     bool
+		formationChanges int
+	}{
+		// Same slug, different config.
+		{
+			&Release{Config: productionConfig, Slug: v1, Processes: processes},
+			&Release{Config: stagingConfig, Slug: v1, Processes: processes},
+			1, false, 0,
+		},
+
+		// Different slug, same config.
+		{
+			&Release{Config: productionConfig, Slug: v1, Processes: processes},
+			&Release{Config: productionConfig, Slug: v2, Processes: processes},
+			0, true, 0,
+		},
+
+		// Same slug, same config.
+		{
+			&Release{Config: productionConfig, Slug: v1, Processes: processes},
+			&Release{Config: productionConfig, Slug: v1, Processes: processes},
+			0, false, 0,
+		},
+	}
+
+	for i, tt := range tests {
+		c := CompareReleases(tt.from, tt.to)
+
+		if got, want := len(c.ConfigChanges), tt.configChanges; got != want {
+			t.Fatalf("#%d: len(ConfigChanges) => %d; want %d", i, got, want)
+		}
+
+		if got, want := c.SlugChanges.ImageChanged, tt.imageChanged; got != want {
+			t.Fatalf("#%d: ImageChanged => %v; want %v", i, got, want)
+		}
+
+		if got, want := c.SlugChanges.OldDigest, tt.from.Slug.Image.ID; got != want {
+			t.Fatalf("#%d: OldDigest => %s; want %s", i, got, want)
+		}
+
+		if got, want := c.SlugChanges.NewDigest, tt.to.Slug.Image.ID; got != want {
+			t.Fatalf("#%d: NewDigest => %s; want %s", i, got, want)
+		}
+
+		if got, want := len(c.FormationChanges), tt.formationChanges; got != want {
+			t.Fatalf("#%d: len(FormationChanges) => %d; want %d", i, got, want)
+		}
+	}
+}
+
+func TestConfigDrift(t *testing.T) {
+	var (
+		production = "production"
+		staging    = "staging"
+		url        = "postgres://localhost"
+		secret     = "ssm://acme-inc/secret"
+	)
+
+	actual := Vars{
+		"RAILS_ENV":    &staging,
+		"DATABASE_URL": &url,
+		"SECRET":       &secret,
+		"LOG_LEVEL":    &production,
+	}
+
+	reference := Vars{
+		"RAILS_ENV":    &production,
+		"DATABASE_URL": &url,
+		"NEW_VAR":      &url,
+		"UNSET":        nil,
+	}
+
+	mask := func(v string) string {
+		if v == secret {
+			return v
+		}
+		return "masked"
+	}
+	masked := "masked"
+
+	got := ConfigDrift(actual, reference, mask)
+	want := &DriftReport{
+		Missing: []ConfigChange{
+			{Variable: "NEW_VAR", Expected: &url},
+		},
+		Extra: []ConfigChange{
+			{Variable: "LOG_LEVEL", Actual: &masked},
+			{Variable: "SECRET", Actual: &secret},
+		},
+		Changed: []ConfigChange{
+			{Variable: "RAILS_ENV", Expected: &production, Actual: &masked},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ConfigDrift => %+v; want %+v", got, want)
+	}
+
+	if !got.Drifted() {
+		t.Fatal("expected the config to have drifted")
+	}
+
+	if got := ConfigDrift(actual, actual, mask); got.Drifted() {
+		t.Fatalf("ConfigDrift => %+v; want no drift", got)
+	}
+}
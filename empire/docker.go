@@ -1,9 +1,133 @@
 package empire
 
-import "github.com/fsouza/go-dockerclient"
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
-// newDockerClient returns a new docker.Client using the given socket and certificate path.
-func newDockerClient(socket, certPath string) (*docker.Client, error) {
+	"github.com/fsouza/go-dockerclient"
+)
+
+var (
+	// DefaultMaxReconnectAttempts is the default number of times to try to
+	// reconnect to the docker daemon.
+	DefaultMaxReconnectAttempts = 5
+
+	// DefaultReconnectBackoff is the default amount of time to wait between
+	// reconnect attempts.
+	DefaultReconnectBackoff = time.Second
+)
+
+// ErrDockerUnavailable is returned when the docker daemon could not be
+// reconnected to after MaxReconnectAttempts.
+var ErrDockerUnavailable = errors.New("docker: unable to reconnect to the docker daemon")
+
+// dockerClient is the subset of the docker.Client api that Empire uses.
+type dockerClient interface {
+	InspectImage(name string) (*docker.Image, error)
+	PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error
+	CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error)
+	InspectContainer(id string) (*docker.Container, error)
+	RemoveContainer(opts docker.RemoveContainerOptions) error
+	CopyFromContainer(opts docker.CopyFromContainerOptions) error
+	BuildImage(opts BuildImageOptions) error
+	TagImage(name string, opts docker.TagImageOptions) error
+	RemoveImage(name string) error
+	PushImage(opts docker.PushImageOptions, auth docker.AuthConfiguration) error
+}
+
+// BuildImageOptions are the options for building an image. The vendored
+// go-dockerclient doesn't support build args or labels, so they're added to
+// the build request by ReconnectingDockerClient.
+type BuildImageOptions struct {
+	docker.BuildImageOptions
+
+	// Build-time variables that are passed to the Dockerfile, by name.
+	BuildArgs map[string]string
+
+	// Labels that are added to the image.
+	Labels map[string]string
+}
+
+// query returns the query parameters of the build request for the options
+// that docker.BuildImageOptions doesn't support.
+func (o BuildImageOptions) query() url.Values {
+	q := make(url.Values)
+
+	if len(o.BuildArgs) > 0 {
+		b, _ := json.Marshal(o.BuildArgs)
+		q.Set("buildargs", string(b))
+	}
+
+	if len(o.Labels) > 0 {
+		b, _ := json.Marshal(o.Labels)
+		q.Set("labels", string(b))
+	}
+
+	return q
+}
+
+// newDockerClient returns a new docker.Client using the given socket and
+// certificate path. If query is provided, it's added to the query string of
+// every request that the client makes.
+func newDockerClient(socket, certPath string, query url.Values) (*docker.Client, error) {
+	if len(query) == 0 {
+		return dialDocker(socket, certPath)
+	}
+
+	u, err := url.Parse(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	// docker.Client dials unix sockets itself, without going through its
+	// HTTPClient, so the socket is dialed by the transport instead.
+	if u.Scheme == "unix" {
+		c, err := docker.NewClient("http://docker")
+		if err != nil {
+			return nil, err
+		}
+
+		c.HTTPClient = &http.Client{
+			Transport: &queryTransport{
+				RoundTripper: &http.Transport{
+					Dial: func(network, addr string) (net.Conn, error) {
+						return net.Dial("unix", u.Path)
+					},
+				},
+				query: query,
+			},
+		}
+		return c, nil
+	}
+
+	c, err := dialDocker(socket, certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := c.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	c.HTTPClient = &http.Client{
+		Transport: &queryTransport{
+			RoundTripper: transport,
+			query:        query,
+		},
+	}
+	return c, nil
+}
+
+// dialDocker returns a new docker.Client using the given socket and certificate
+// path.
+func dialDocker(socket, certPath string) (*docker.Client, error) {
 	if certPath != "" {
 		cert := certPath + "/cert.pem"
 		key := certPath + "/key.pem"
@@ -13,3 +137,273 @@ func newDockerClient(socket, certPath string) (*docker.Client, error) {
 
 	return docker.NewClient(socket)
 }
+
+// queryTransport is an http.RoundTripper that adds query to the query string of
+// every request.
+type queryTransport struct {
+	http.RoundTripper
+	query url.Values
+}
+
+func (t *queryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	q := u.Query()
+	for k, v := range t.query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+
+	r := new(http.Request)
+	*r = *req
+	r.URL = &u
+
+	return t.RoundTripper.RoundTrip(r)
+}
+
+// ReconnectingDockerClient wraps a docker.Client and re-dials the docker
+// daemon when the connection is broken, for example, when the docker daemon is
+// restarted.
+type ReconnectingDockerClient struct {
+	// The maximum number of times to try to reconnect before giving up.
+	MaxReconnectAttempts int
+
+	// The amount of time to wait between reconnect attempts.
+	ReconnectBackoff time.Duration
+
+	// dial returns a new docker.Client, which adds query to every
+	// request if provided.
+	dial func(query url.Values) (*docker.Client, error)
+
+	mu     sync.Mutex
+	client *docker.Client
+}
+
+// NewReconnectingDockerClient returns a new ReconnectingDockerClient that
+// connects using the given socket and certificate path.
+func NewReconnectingDockerClient(socket, certPath string) (*ReconnectingDockerClient, error) {
+	return newReconnectingDockerClient(func(query url.Values) (*docker.Client, error) {
+		return newDockerClient(socket, certPath, query)
+	})
+}
+
+func newReconnectingDockerClient(dial func(url.Values) (*docker.Client, error)) (*ReconnectingDockerClient, error) {
+	c, err := dial(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReconnectingDockerClient{
+		MaxReconnectAttempts: DefaultMaxReconnectAttempts,
+		ReconnectBackoff:     DefaultReconnectBackoff,
+		dial:                 dial,
+		client:               c,
+	}, nil
+}
+
+// IsConnected returns true if the docker daemon can be reached.
+func (c *ReconnectingDockerClient) IsConnected() bool {
+	return c.current().Ping() == nil
+}
+
+func (c *ReconnectingDockerClient) InspectImage(name string) (image *docker.Image, err error) {
+	err = c.do(func(client *docker.Client) error {
+		image, err = client.InspectImage(name)
+		return err
+	})
+	return
+}
+
+func (c *ReconnectingDockerClient) PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error {
+	return c.do(func(client *docker.Client) error {
+		return client.PullImage(opts, auth)
+	})
+}
+
+// CreateContainer creates a container. It isn't retried after reconnecting,
+// since the container may have been created before the connection broke.
+func (c *ReconnectingDockerClient) CreateContainer(opts docker.CreateContainerOptions) (container *docker.Container, err error) {
+	err = c.doRetryIf(never, func(client *docker.Client) error {
+		container, err = client.CreateContainer(opts)
+		return err
+	})
+	return
+}
+
+func (c *ReconnectingDockerClient) InspectContainer(id string) (container *docker.Container, err error) {
+	err = c.do(func(client *docker.Client) error {
+		container, err = client.InspectContainer(id)
+		return err
+	})
+	return
+}
+
+func (c *ReconnectingDockerClient) RemoveContainer(opts docker.RemoveContainerOptions) error {
+	return c.do(func(client *docker.Client) error {
+		return client.RemoveContainer(opts)
+	})
+}
+
+// CopyFromContainer copies files from the container. It isn't retried after
+// reconnecting if any of them were already written to the OutputStream.
+func (c *ReconnectingDockerClient) CopyFromContainer(opts docker.CopyFromContainerOptions) error {
+	out := &writeTracker{Writer: opts.OutputStream}
+	if opts.OutputStream != nil {
+		opts.OutputStream = out
+	}
+
+	return c.doRetryIf(func() bool { return !out.written }, func(client *docker.Client) error {
+		return client.CopyFromContainer(opts)
+	})
+}
+
+// BuildImage builds the image. The build context can only be read once, so the
+// build isn't retried after reconnecting if any of it was already sent. Options
+// that docker.Client doesn't support are sent by a client that's dialed for the
+// build, which adds them to the build request.
+func (c *ReconnectingDockerClient) BuildImage(opts BuildImageOptions) error {
+	in := &readTracker{Reader: opts.InputStream}
+	if opts.InputStream != nil {
+		opts.InputStream = in
+	}
+
+	return c.doRetryIf(func() bool { return !in.read }, func(client *docker.Client) error {
+		if q := opts.query(); len(q) > 0 {
+			var err error
+			if client, err = c.dial(q); err != nil {
+				return err
+			}
+		}
+
+		return client.BuildImage(opts.BuildImageOptions)
+	})
+}
+
+func (c *ReconnectingDockerClient) TagImage(name string, opts docker.TagImageOptions) error {
+	return c.do(func(client *docker.Client) error {
+		return client.TagImage(name, opts)
+	})
+}
+
+func (c *ReconnectingDockerClient) RemoveImage(name string) error {
+	return c.do(func(client *docker.Client) error {
+		return client.RemoveImage(name)
+	})
+}
+
+// PushImage pushes the image. It isn't retried after reconnecting once the
+// push has started writing to the OutputStream.
+func (c *ReconnectingDockerClient) PushImage(opts docker.PushImageOptions, auth docker.AuthConfiguration) error {
+	out := &writeTracker{Writer: opts.OutputStream}
+	if opts.OutputStream != nil {
+		opts.OutputStream = out
+	}
+
+	return c.doRetryIf(func() bool { return !out.written }, func(client *docker.Client) error {
+		return client.PushImage(opts, auth)
+	})
+}
+
+// do calls fn with the current docker.Client. If fn returns an error and the
+// docker daemon can no longer be reached, it reconnects and retries fn. It
+// should only be used for calls that are safe to repeat.
+func (c *ReconnectingDockerClient) do(fn func(*docker.Client) error) error {
+	return c.doRetryIf(always, fn)
+}
+
+// doRetryIf is like do, but fn is only retried if retry returns true after
+// it fails, e.g. because its input can't be replayed.
+func (c *ReconnectingDockerClient) doRetryIf(retry func() bool, fn func(*docker.Client) error) error {
+	client := c.current()
+
+	err := fn(client)
+	if err == nil {
+		return nil
+	}
+
+	// If the daemon is still reachable, this is a legitimate error from
+	// the docker api.
+	if client.Ping() == nil {
+		return err
+	}
+
+	if !retry() {
+		// Still reconnect, so that later calls use a working
+		// client.
+		c.reconnect(client)
+		return err
+	}
+
+	client, err = c.reconnect(client)
+	if err != nil {
+		return err
+	}
+
+	return fn(client)
+}
+
+// reconnect re-dials the docker daemon, replacing the broken client.
+func (c *ReconnectingDockerClient) reconnect(broken *docker.Client) (*docker.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another goroutine already reconnected.
+	if c.client != broken {
+		return c.client, nil
+	}
+
+	for i := 0; i < c.MaxReconnectAttempts; i++ {
+		if i > 0 {
+			time.Sleep(c.ReconnectBackoff)
+		}
+
+		client, err := c.dial(nil)
+		if err != nil {
+			continue
+		}
+
+		if err := client.Ping(); err != nil {
+			continue
+		}
+
+		c.client = client
+		return client, nil
+	}
+
+	return nil, ErrDockerUnavailable
+}
+
+func (c *ReconnectingDockerClient) current() *docker.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client
+}
+
+// readTracker records whether anything has been read from the Reader.
+type readTracker struct {
+	io.Reader
+	read bool
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.read = true
+	}
+	return n, err
+}
+
+// writeTracker records whether anything has been written to the Writer.
+type writeTracker struct {
+	io.Writer
+	written bool
+}
+
+func (w *writeTracker) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.written = true
+	}
+	return w.Writer.Write(p)
+}
+
+func always() bool { return true }
+func never() bool  { return false }
@@ -0,0 +1,230 @@
+package empire
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+func TestReconnectingDockerClient(t *testing.T) {
+	// The first two requests (the InspectImage call and the Ping to check
+	// the connection) will have their connections closed.
+	h := &flakyDockerHandler{failures: 2}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c := newTestReconnectingDockerClient(t, s.URL, 1)
+
+	i, err := c.InspectImage("remind101/acme-inc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := i.ID, "abcd"; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if !c.IsConnected() {
+		t.Fatal("Expected client to be connected")
+	}
+}
+
+func TestReconnectingDockerClient_MaxReconnectAttempts(t *testing.T) {
+	h := &flakyDockerHandler{failures: -1}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c := newTestReconnectingDockerClient(t, s.URL, 3)
+
+	if _, err := c.InspectImage("remind101/acme-inc"); err != ErrDockerUnavailable {
+		t.Fatalf("err => %v; want %v", err, ErrDockerUnavailable)
+	}
+
+	if c.IsConnected() {
+		t.Fatal("Expected client to not be connected")
+	}
+}
+
+func TestReconnectingDockerClient_APIError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			w.Write([]byte("OK"))
+			return
+		}
+
+		http.Error(w, "no such image", 404)
+	}))
+	defer s.Close()
+
+	c := newTestReconnectingDockerClient(t, s.URL, 3)
+
+	// Errors from the docker api should be returned without reconnecting.
+	if _, err := c.InspectImage("remind101/acme-inc"); err != docker.ErrNoSuchImage {
+		t.Fatalf("err => %v; want %v", err, docker.ErrNoSuchImage)
+	}
+}
+
+func TestReconnectingDockerClient_BuildImage(t *testing.T) {
+	// The build, and the Ping to check the connection, will have their
+	// connections closed after the build context was sent.
+	h := &flakyDockerHandler{failures: 2}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c := newTestReconnectingDockerClient(t, s.URL, 1)
+
+	err := c.BuildImage(BuildImageOptions{
+		BuildImageOptions: docker.BuildImageOptions{
+			Name:         "remind101/acme-inc",
+			InputStream:  strings.NewReader("FROM busybox"),
+			OutputStream: ioutil.Discard,
+		},
+	})
+	if err == nil {
+		t.Fatal("Expected the build to fail")
+	}
+
+	// The build context was consumed, so the build isn't retried.
+	for _, path := range h.requests {
+		if path == "/build" {
+			t.Fatal("Expected the build to not be retried")
+		}
+	}
+
+	if !c.IsConnected() {
+		t.Fatal("Expected client to be reconnected")
+	}
+}
+
+func TestReconnectingDockerClient_BuildImage_BuildArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "empire-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var (
+		mu        sync.Mutex
+		buildArgs []string
+	)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/build" {
+			mu.Lock()
+			buildArgs = append(buildArgs, r.URL.Query().Get("buildargs"))
+			mu.Unlock()
+		}
+		w.Write([]byte("OK"))
+	}))
+
+	c, err := NewReconnectingDockerClient("unix://"+l.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range []map[string]string{nil, {"VERSION": "1"}} {
+		if err := c.BuildImage(BuildImageOptions{
+			BuildImageOptions: docker.BuildImageOptions{
+				Name:         "remind101/acme-inc",
+				InputStream:  strings.NewReader("FROM busybox"),
+				OutputStream: ioutil.Discard,
+			},
+			BuildArgs: args,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if got, want := buildArgs, []string{"", `{"VERSION":"1"}`}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("buildargs => %q; want %q", got, want)
+	}
+}
+
+func TestReconnectingDockerClient_CreateContainer(t *testing.T) {
+	h := &flakyDockerHandler{failures: 2}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	c := newTestReconnectingDockerClient(t, s.URL, 1)
+
+	if _, err := c.CreateContainer(docker.CreateContainerOptions{
+		Config: &docker.Config{Image: "remind101/acme-inc"},
+	}); err == nil {
+		t.Fatal("Expected creating the container to fail")
+	}
+
+	// The container may have been created, so it isn't created again.
+	for _, path := range h.requests {
+		if path == "/containers/create" {
+			t.Fatal("Expected creating the container to not be retried")
+		}
+	}
+}
+
+func newTestReconnectingDockerClient(t testing.TB, url string, maxAttempts int) *ReconnectingDockerClient {
+	c, err := NewReconnectingDockerClient(url, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.MaxReconnectAttempts = maxAttempts
+	c.ReconnectBackoff = 0
+
+	return c
+}
+
+// flakyDockerHandler is an http.Handler that closes the connection for the
+// first n requests, simulating a docker daemon that has gone away. If failures
+// is negative, every connection is closed.
+type flakyDockerHandler struct {
+	sync.Mutex
+	failures int
+
+	// The paths of the requests that were served.
+	requests []string
+}
+
+func (h *flakyDockerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Lock()
+	fail := h.failures != 0
+	if h.failures > 0 {
+		h.failures--
+	}
+	if !fail {
+		h.requests = append(h.requests, r.URL.Path)
+	}
+	h.Unlock()
+
+	if fail {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			panic(err)
+		}
+		conn.Close()
+		return
+	}
+
+	switch r.URL.Path {
+	case "/_ping":
+		w.Write([]byte("OK"))
+	default:
+		w.Write([]byte(`{"Id": "abcd"}`))
+	}
+}
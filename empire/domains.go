@@ -147,11 +147,19 @@ func (s *store) Domains(scope Scope) ([]*Domain, error) {
 
 // DomainsCreate persists the Domain.
 func (s *store) DomainsCreate(domain *Domain) (*Domain, error) {
+	if err := s.writable(); err != nil {
+		return domain, err
+	}
+
 	return domainsCreate(s.db, domain)
 }
 
 // DomainsDestroy destroys the Domain.
 func (s *store) DomainsDestroy(domain *Domain) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	return domainsDestroy(s.db, domain)
 }
 
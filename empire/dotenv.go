@@ -0,0 +1,148 @@
+package empire
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// parseDotenv parses config vars from a .env file. Each line is a KEY=value
+// pair, optionally prefixed with "export". Values can be:
+//
+//	KEY=value # comment       unquoted, a # preceded by whitespace starts a comment
+//	KEY='value'               single quoted, without any escape processing
+//	KEY="line one\nline two"  double quoted, with \n, \r, \t, \" and \\ escapes
+//	KEY="line one
+//	line two"                 quoted values can span multiple lines
+//
+// A ParseError is returned for lines that aren't KEY=value pairs, and for
+// quoted values without a closing quote.
+func parseDotenv(r io.Reader) (Vars, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	src := strings.Replace(string(b), "\r\n", "\n", -1)
+	lines := strings.Split(src, "\n")
+
+	vars := make(Vars)
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+		line := strings.TrimLeft(lines[i], " \t")
+
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimLeft(line[len("export"):], " \t")
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, &ParseError{fmt.Errorf("line %d: expected KEY=value", n)}
+		}
+
+		key := strings.TrimSpace(line[:eq])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, &ParseError{fmt.Errorf("line %d: invalid key %q", n, key)}
+		}
+
+		raw := line[eq+1:]
+		value := strings.TrimLeft(raw, " \t")
+
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			v := strings.TrimSpace(stripDotenvComment(raw))
+			vars[Variable(key)] = &v
+			continue
+		}
+
+		// Quoted values continue onto the following lines until the
+		// closing quote.
+		q := value[0]
+		body := value[1:]
+		for {
+			end := closingQuote(body, q)
+			if end >= 0 {
+				rest := strings.TrimSpace(body[end+1:])
+				if rest != "" && rest[0] != '#' {
+					return nil, &ParseError{fmt.Errorf("line %d: unexpected %q after the closing quote", n, rest)}
+				}
+				body = body[:end]
+				break
+			}
+
+			if i+1 >= len(lines) {
+				return nil, &ParseError{fmt.Errorf("line %d: unmatched quote in the value of %s", n, key)}
+			}
+
+			i++
+			body += "\n" + lines[i]
+		}
+
+		v := body
+		if q == '"' {
+			v = unescapeDotenv(body)
+		}
+		vars[Variable(key)] = &v
+	}
+
+	return vars, nil
+}
+
+// stripDotenvComment removes a comment from an unquoted value. Only a # that's
+// preceded by whitespace starts a comment.
+func stripDotenvComment(value string) string {
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return value[:i]
+		}
+	}
+
+	return value
+}
+
+// closingQuote returns the index of the quote that closes a value quoted with
+// q, or -1 if there isn't one. Quotes in double quoted values can be escaped.
+func closingQuote(s string, q byte) int {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case q == '"' && s[i] == '\\':
+			i++
+		case s[i] == q:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unescapeDotenv processes the escapes in a double quoted value. Unknown
+// escapes are kept as is.
+func unescapeDotenv(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b = append(b, s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case '"', '\\':
+			b = append(b, s[i])
+		default:
+			b = append(b, '\\', s[i])
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,76 @@
+package empire
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		in   string
+		vars Vars
+	}{
+		{"", Vars{}},
+		{"RAILS_ENV=production\n", Vars{"RAILS_ENV": str("production")}},
+		{"# Comment\n\nRAILS_ENV=production\r\n", Vars{"RAILS_ENV": str("production")}},
+		{"EMPTY=\n", Vars{"EMPTY": str("")}},
+
+		// export prefix
+		{"export RAILS_ENV=production\n", Vars{"RAILS_ENV": str("production")}},
+		{"export\tRAILS_ENV=production\n", Vars{"RAILS_ENV": str("production")}},
+
+		// Comments
+		{"RAILS_ENV=production # The environment\n", Vars{"RAILS_ENV": str("production")}},
+		{"COLOR=#fff\n", Vars{"COLOR": str("#fff")}},
+		{"URL=http://example.com/#anchor\n", Vars{"URL": str("http://example.com/#anchor")}},
+
+		// Double quotes
+		{`GREETING="hello world" # Comment`, Vars{"GREETING": str("hello world")}},
+		{`GREETING="hello\nworld"`, Vars{"GREETING": str("hello\nworld")}},
+		{`QUOTE="say \"hi\""`, Vars{"QUOTE": str(`say "hi"`)}},
+		{`COMMENT="not # a comment"`, Vars{"COMMENT": str("not # a comment")}},
+		{"KEY=\"-----BEGIN KEY-----\nabcd\n-----END KEY-----\"\nRAILS_ENV=production\n", Vars{
+			"KEY":       str("-----BEGIN KEY-----\nabcd\n-----END KEY-----"),
+			"RAILS_ENV": str("production"),
+		}},
+
+		// Single quotes
+		{`GREETING='hello\nworld'`, Vars{"GREETING": str(`hello\nworld`)}},
+		{"GREETING='hello\nworld'\n", Vars{"GREETING": str("hello\nworld")}},
+	}
+
+	for _, tt := range tests {
+		vars, err := parseDotenv(strings.NewReader(tt.in))
+		if err != nil {
+			t.Errorf("parseDotenv(%q) => %v", tt.in, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(vars, tt.vars) {
+			t.Errorf("parseDotenv(%q) => %v; want %v", tt.in, vars, tt.vars)
+		}
+	}
+}
+
+func TestParseDotenv_Invalid(t *testing.T) {
+	tests := []string{
+		"RAILS_ENV\n",
+		"RAILS ENV=production\n",
+		"=production\n",
+		// Unmatched quotes
+		"GREETING=\"hello\n",
+		"GREETING='hello\n\nRAILS_ENV=production\n",
+		`QUOTE="say \"hi\"`,
+		`GREETING="hello" world`,
+	}
+
+	for _, in := range tests {
+		_, err := parseDotenv(strings.NewReader(in))
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("parseDotenv(%q) => %v; want a ParseError", in, err)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package empire // import "github.com/remind101/empire/empire"
 
 import (
+	"io"
 	"log"
 	"os"
+	"time"
 
+	"code.google.com/p/go-uuid/uuid"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/inconshreveable/log15"
+	"github.com/mattes/migrate/driver"
+	"github.com/mattes/migrate/file"
 	"github.com/mattes/migrate/migrate"
 	"github.com/remind101/empire/empire/pkg/service"
 	"github.com/remind101/empire/empire/pkg/sslcert"
@@ -17,7 +22,12 @@ import (
 var (
 	// DefaultOptions is a default Options instance that can be passed when
 	// intializing a new Empire.
-	DefaultOptions = Options{}
+	DefaultOptions = Options{
+		MaxConfigValueBytes:     DefaultMaxConfigValueBytes,
+		MaxTotalConfigBytes:     DefaultMaxTotalConfigBytes,
+		MaxSchedulerConcurrency: service.DefaultMaxConcurrency,
+		SchedulerQueryTimeout:   service.DefaultQueryTimeout,
+	}
 
 	// DefaultReporter is the default reporter.Reporter to use.
 	DefaultReporter = reporter.NewLogReporter()
@@ -29,6 +39,14 @@ const (
 
 	// WebProcessType is the process type we assume are web server processes.
 	WebProcessType = "web"
+
+	// DefaultMaxConfigValueBytes is the default maximum size of a single
+	// config var value.
+	DefaultMaxConfigValueBytes = 64 * 1024
+
+	// DefaultMaxTotalConfigBytes is the default maximum size of all of an
+	// apps config vars combined.
+	DefaultMaxTotalConfigBytes = 512 * 1024
 )
 
 // DockerOptions is a set of options to configure a docker api client.
@@ -41,6 +59,27 @@ type DockerOptions struct {
 
 	// A set of docker registry credentials.
 	Auth *docker.AuthConfigurations
+
+	// The maximum number of times to try to reconnect to the docker daemon
+	// when the connection is broken. Defaults to
+	// DefaultMaxReconnectAttempts.
+	MaxReconnectAttempts int
+
+	// The amount of time to wait between reconnect attempts. Defaults to
+	// DefaultReconnectBackoff.
+	ReconnectBackoff time.Duration
+
+	// RegistryRouter, if provided, selects registry credentials for an
+	// image. Images that it doesn't route fall back to Auth.
+	RegistryRouter RegistryRouter
+
+	// The organization that images built by Empire are pushed to, e.g.
+	// "quay.io/remind101". Building images is disabled if not provided.
+	Organization string
+
+	// Resolver, if provided, is used to pull images and check whether they
+	// still exist, instead of one backed by the docker daemon at Socket.
+	Resolver Resolver
 }
 
 // ECSOptions is a set of options to configure ECS.
@@ -82,10 +121,122 @@ type Options struct {
 	// AWS Configuration
 	AWSConfig *aws.Config
 
+	// The maximum number of process types that will be scheduled at the
+	// same time when releasing an app, and the number of apps that are
+	// queried at the same time when summarizing the cluster's health. Zero
+	// means service.DefaultMaxConcurrency.
+	MaxSchedulerConcurrency int
+
+	// The maximum time that queries to the scheduler for the state of an
+	// app can take. Zero disables the timeout.
+	SchedulerQueryTimeout time.Duration
+
+	// Scheduler, if provided, is used to run apps instead of ECS.
+	Scheduler service.Manager
+
+	// How often JobStatesStream polls the scheduler for changes. Defaults
+	// to DefaultJobStatePollInterval.
+	JobStatePollInterval time.Duration
+
+	// The secret used to sign access tokens.
 	Secret string
 
+	// Previous token secrets. Access tokens signed with any of these are
+	// still accepted, so Secret can be rotated without logging everyone
+	// out.
+	SecondarySecrets []string
+
+	// The maximum size of a single config var value, in bytes. Zero
+	// disables the limit.
+	MaxConfigValueBytes int
+
+	// The maximum size of all of an apps config vars (keys and values)
+	// combined, in bytes. Zero disables the limit.
+	MaxTotalConfigBytes int
+
+	// Validators that config vars are checked against when they're
+	// applied.
+	ConfigValidators []ConfigValidator
+
+	// When true, references to other config vars, like "${DB_HOST}", are
+	// replaced with their values when config vars are applied.
+	ExpandVarReferences bool
+
+	// App names that cannot be used when creating an app. Defaults to
+	// DefaultReservedAppNames.
+	ReservedAppNames []string
+
+	// When true, the scheduler validates every process of a release
+	// before the release is created.
+	ValidateBeforeDeploy bool
+
+	// When true, AppsDestroy refuses to destroy apps that still have
+	// running processes, domains or a canary deployment.
+	StrictDestroy bool
+
+	// When greater than 0, AppsDestroy waits up to this long for the
+	// scheduler to stop all of the app's jobs, returning a
+	// JobsStillRunningError (see IsJobsStillRunning) if it doesn't.
+	VerifyDestroyTimeout time.Duration
+
+	// The maximum time that cloning a repository for SlugsBuildFromSource
+	// can take. Defaults to DefaultGitCloneTimeout.
+	GitCloneTimeout time.Duration
+
+	// The hosts that DeployFromTarball can download tarballs from. If
+	// empty, deploying from a tarball returns ErrTarballHostNotAllowed.
+	TarballAllowedHosts []string
+
+	// The maximum time that downloading a tarball can take. Defaults to
+	// DefaultTarballDownloadTimeout.
+	TarballDownloadTimeout time.Duration
+
+	// When true, every new release is tagged with ReleasesAutoTag.
+	AutoTagReleases bool
+
+	// If provided, config values that start with SecretReferencePrefix are
+	// resolved with it by ConfigsCurrentWithResolved.
+	SecretResolver SecretResolver
+
+	// The prefix of config values that reference secrets. Defaults to
+	// DefaultSecretReferencePrefix.
+	SecretReferencePrefix string
+
+	// Channels that notifications about deploys, rollbacks and crashing
+	// processes will be sent to.
+	NotificationChannels []NotificationChannel
+
+	// The number of times that a webhook notification is delivered before
+	// giving up. Defaults to DefaultWebhookMaxAttempts.
+	WebhookMaxAttempts int
+
+	// Used to email approvers links to approve draft releases. If not
+	// provided, ReleasesRequestApproval returns ErrEmailDisabled.
+	EmailSender EmailSender
+
+	// The url that release approval links point to, with the approval
+	// token added as the "token" query parameter.
+	ReleaseApprovalURL string
+
+	// How long release approval tokens are valid for. Defaults to
+	// DefaultReleaseApprovalTTL.
+	ReleaseApprovalTTL time.Duration
+
+	// Runs the validation commands of apps before their releases are
+	// created. If not provided, releases of apps with a validation command
+	// fail with ErrTaskRunnerDisabled.
+	TaskRunner TaskRunner
+
+	// How long an app's validation command has to exit. Defaults to
+	// DefaultReleaseValidationTimeout.
+	ReleaseValidationTimeout time.Duration
+
 	// Database connection string.
 	DB string
+
+	// Optional connection string for a read replica of DB. When the
+	// primary database is unavailable, reads are served from the replica.
+	ReplicaDB string
 }
 
 // Empire is a context object that contains a collection of services.
@@ -97,19 +248,43 @@ type Empire struct {
 	// Logger is a log15 logger that will be used for logging.
 	Logger log15.Logger
 
-	store *store
-
-	accessTokens *accessTokensService
-	apps         *appsService
-	certs        *certificatesService
-	configs      *configsService
-	domains      *domainsService
-	jobStates    *processStatesService
-	releases     *releasesService
-	deployer     *deployer
-	scaler       *scaler
-	restarter    *restarter
-	runner       *runner
+	store        *store
+	storeMonitor *storeMonitor
+
+	accessTokens    *accessTokensService
+	apps            *appsService
+	appsDestroyer   *appsDestroyScheduler
+	canaries        *canaryService
+	certs           *certificatesService
+	configs         *configsService
+	crashLoops      *CrashLoopDetector
+	slos            *sloService
+	migrator        *schedulerMigrator
+	sloController   *SLOController
+	domains         *domainsService
+	featureFlags    *featureFlagsService
+	jobs            *jobsService
+	jobStates       *processStatesService
+	releases        *releasesService
+	releaseTags     *releaseTagsService
+	releaseStreamer *releaseStreamer
+	deployer        *deployer
+	scaler          *scaler
+	slugs           *slugsService
+	restarter       *restarter
+	drainer         *drainer
+	runner          *runner
+	usage           *usageService
+	formations      *formationHistory
+	backups         *backupService
+	annotations     *appAnnotationsService
+	appsHealth      *appsHealthService
+	tarballs        *tarballDeployer
+	webhooks        *WebhookRetrier
+	configKeys      *ConfigKeyExpirer
+	approvals       *releaseApprovalsService
+	commands        *processCommandOverrider
+	promoter        *stablePromoter
 }
 
 // New returns a new Empire instance.
@@ -119,7 +294,17 @@ func New(options Options) (*Empire, error) {
 		return nil, err
 	}
 
-	store := &store{db: db}
+	var replica *store
+	if options.ReplicaDB != "" {
+		rdb, err := newDB(options.ReplicaDB)
+		if err != nil {
+			return nil, err
+		}
+
+		replica = &store{db: rdb}
+	}
+
+	store := &store{db: db, url: options.DB, replica: replica}
 
 	extractor, err := newExtractor(options.Docker)
 	if err != nil {
@@ -131,26 +316,54 @@ func New(options Options) (*Empire, error) {
 		return nil, err
 	}
 
-	manager, err := newManager(
-		options.ECS,
-		options.ELB,
-		options.AWSConfig,
-	)
+	builder, err := newBuilder(options.Docker)
 	if err != nil {
 		return nil, err
 	}
 
+	manager := options.Scheduler
+	if manager == nil {
+		manager, err = newManager(
+			options.ECS,
+			options.ELB,
+			options.AWSConfig,
+			options.MaxSchedulerConcurrency,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if options.SchedulerQueryTimeout > 0 {
+		manager = &service.QueryTimeoutManager{
+			Manager: manager,
+			Timeout: options.SchedulerQueryTimeout,
+		}
+	}
+
+	var secondarySecrets [][]byte
+	for _, secret := range options.SecondarySecrets {
+		secondarySecrets = append(secondarySecrets, []byte(secret))
+	}
+
 	accessTokens := &accessTokensService{
-		Secret: []byte(options.Secret),
+		Secret:           []byte(options.Secret),
+		SecondarySecrets: secondarySecrets,
 	}
 
-	apps := &appsService{
-		store:   store,
-		manager: manager,
+	reservedAppNames := options.ReservedAppNames
+	if reservedAppNames == nil {
+		reservedAppNames = DefaultReservedAppNames
+	}
+
+	jobs := &jobsService{
+		store: store,
 	}
 
 	jobStates := &processStatesService{
-		manager: manager,
+		store:        store,
+		manager:      manager,
+		pollInterval: options.JobStatePollInterval,
 	}
 
 	scaler := &scaler{
@@ -162,30 +375,117 @@ func New(options Options) (*Empire, error) {
 		manager: manager,
 	}
 
+	drainer := &drainer{
+		manager: manager,
+	}
+
 	runner := newRunner(options.Runner, store)
 
+	usage := &usageService{
+		store: store,
+	}
+
 	releaser := &releaser{
 		manager: manager,
 	}
 
+	notifier := newNotifier(options.NotificationChannels...)
+
+	// Queue failed webhook deliveries to be retried.
+	for _, c := range options.NotificationChannels {
+		if w, ok := c.(webhookChannel); ok {
+			w.setDeadLetters(store)
+		}
+	}
+
+	releaseTags := &releaseTagsService{
+		store: store,
+	}
+
+	var taskRunner TaskRunner = &fakeTaskRunner{}
+	if options.TaskRunner != nil {
+		taskRunner = options.TaskRunner
+	}
+
+	releaseValidationTimeout := options.ReleaseValidationTimeout
+	if releaseValidationTimeout == 0 {
+		releaseValidationTimeout = DefaultReleaseValidationTimeout
+	}
+
 	releases := &releasesService{
 		store:    store,
 		releaser: releaser,
+		notifier: notifier,
+		validate: options.ValidateBeforeDeploy,
+		autoTag:  options.AutoTagReleases,
+		tags:     releaseTags,
+		validator: &releaseValidator{
+			runner:  taskRunner,
+			timeout: releaseValidationTimeout,
+		},
+	}
+
+	releaseStreamer := &releaseStreamer{
+		store: store,
+	}
+
+	secretPrefix := options.SecretReferencePrefix
+	if secretPrefix == "" {
+		secretPrefix = DefaultSecretReferencePrefix
 	}
 
 	configs := &configsService{
-		store:    store,
-		releases: releases,
+		store:               store,
+		releases:            releases,
+		notifier:            notifier,
+		maxValueBytes:       options.MaxConfigValueBytes,
+		maxTotalBytes:       options.MaxTotalConfigBytes,
+		secretResolver:      options.SecretResolver,
+		secretPrefix:        secretPrefix,
+		validators:          options.ConfigValidators,
+		expandVarReferences: options.ExpandVarReferences,
+	}
+
+	apps := &appsService{
+		store:         store,
+		manager:       manager,
+		configs:       configs,
+		reservedNames: reservedAppNames,
+		strictDestroy: options.StrictDestroy,
+		taskRunner:    taskRunner,
+
+		verifyDestroyTimeout: options.VerifyDestroyTimeout,
 	}
 
 	domains := &domainsService{
 		store: store,
 	}
 
+	featureFlags := &featureFlagsService{
+		configsService: configs,
+	}
+
+	gitCloneTimeout := options.GitCloneTimeout
+	if gitCloneTimeout == 0 {
+		gitCloneTimeout = DefaultGitCloneTimeout
+	}
+
+	var emailSender EmailSender = &fakeEmailSender{}
+	if options.EmailSender != nil {
+		emailSender = options.EmailSender
+	}
+
+	releaseApprovalTTL := options.ReleaseApprovalTTL
+	if releaseApprovalTTL == 0 {
+		releaseApprovalTTL = DefaultReleaseApprovalTTL
+	}
+
 	slugs := &slugsService{
 		store:     store,
 		extractor: extractor,
 		resolver:  resolver,
+		builder:   builder,
+		archiver:  &gitArchiver{timeout: gitCloneTimeout},
 	}
 
 	deployer := &deployer{
@@ -193,6 +493,34 @@ func New(options Options) (*Empire, error) {
 		configsService:  configs,
 		slugsService:    slugs,
 		releasesService: releases,
+		notifier:        notifier,
+	}
+
+	canaries := &canaryService{
+		store:    store,
+		manager:  manager,
+		apps:     apps,
+		configs:  configs,
+		slugs:    slugs,
+		releases: releases,
+	}
+
+	crashLoops := newCrashLoopDetector(store, manager, releases, notifier)
+
+	migrator := &schedulerMigrator{
+		store:    store,
+		releases: releases,
+	}
+
+	slos := &sloService{
+		store:    store,
+		interval: DefaultSLOInterval,
+	}
+
+	sloController := &SLOController{
+		store:    store,
+		slos:     slos,
+		notifier: notifier,
 	}
 
 	certs := &certificatesService{
@@ -202,30 +530,188 @@ func New(options Options) (*Empire, error) {
 	}
 
 	return &Empire{
-		Logger:       newLogger(),
-		store:        store,
-		accessTokens: accessTokens,
-		apps:         apps,
-		certs:        certs,
-		configs:      configs,
-		deployer:     deployer,
-		domains:      domains,
-		jobStates:    jobStates,
-		scaler:       scaler,
-		restarter:    restarter,
-		runner:       runner,
-		releases:     releases,
+		Logger:          newLogger(),
+		store:           store,
+		storeMonitor:    newStoreMonitor(store),
+		accessTokens:    accessTokens,
+		apps:            apps,
+		appsDestroyer:   &appsDestroyScheduler{store: store, apps: apps},
+		canaries:        canaries,
+		certs:           certs,
+		configs:         configs,
+		crashLoops:      crashLoops,
+		slos:            slos,
+		migrator:        migrator,
+		sloController:   sloController,
+		deployer:        deployer,
+		domains:         domains,
+		featureFlags:    featureFlags,
+		jobs:            jobs,
+		jobStates:       jobStates,
+		scaler:          scaler,
+		slugs:           slugs,
+		restarter:       restarter,
+		drainer:         drainer,
+		runner:          runner,
+		releases:        releases,
+		releaseTags:     releaseTags,
+		releaseStreamer: releaseStreamer,
+		usage:           usage,
+		formations:      &formationHistory{store: store},
+		backups:         &backupService{store: store},
+		annotations:     &appAnnotationsService{store: store},
+		appsHealth: &appsHealthService{
+			store:          store,
+			manager:        manager,
+			timeout:        options.SchedulerQueryTimeout,
+			maxConcurrency: options.MaxSchedulerConcurrency,
+		},
+		tarballs: &tarballDeployer{
+			allowedHosts: options.TarballAllowedHosts,
+			timeout:      options.TarballDownloadTimeout,
+			builder:      builder,
+			deployer:     deployer,
+		},
+		promoter: &stablePromoter{
+			store:    store,
+			scaler:   scaler,
+			notifier: notifier,
+		},
+		webhooks: &WebhookRetrier{
+			MaxAttempts: options.WebhookMaxAttempts,
+			store:       store,
+		},
+		configKeys: &ConfigKeyExpirer{
+			store:   store,
+			configs: configs,
+		},
+		approvals: &releaseApprovalsService{
+			store:    store,
+			releases: releases,
+			sender:   emailSender,
+			secret:   []byte(options.Secret),
+			url:      options.ReleaseApprovalURL,
+			ttl:      releaseApprovalTTL,
+		},
+		commands: &processCommandOverrider{
+			store:    store,
+			releases: releases,
+			notifier: notifier,
+		},
 	}, nil
 }
 
-// AccessTokensFind finds an access token.
+// AccessTokensFind finds an access token, and records when it was last used.
+// The token's record is looked up by its id before its signature is verified,
+// and ErrTokenInvalid is returned if either fails, including when the id isn't
+// a uuid. Failing to record use while the store is read-only doesn't prevent
+// the token from being used.
+//
+// If the token was signed with one of the secondary secrets, the returned
+// AccessToken's Token is the token re-signed with the primary secret, and the
+// hash of the primary secret is stored in its record. Callers should hand it
+// back to the client, so that it replaces the old token.
 func (e *Empire) AccessTokensFind(token string) (*AccessToken, error) {
-	return e.accessTokens.AccessTokensFind(token)
+	id, err := accessTokenID(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens issued before tokens were recorded don't have an id, and
+	// only have their signature verified.
+	if id != "" {
+		if uuid.Parse(id) == nil {
+			return nil, ErrTokenInvalid
+		}
+
+		if _, err := e.store.AccessTokensFirst(id); err != nil {
+			return nil, ErrTokenInvalid
+		}
+	}
+
+	at, err := e.accessTokens.AccessTokensFind(token)
+	if err != nil || at.ID == "" {
+		return at, err
+	}
+
+	if at.Token != token {
+		if err := e.store.AccessTokensUpdateSecretHash(at); err != nil && err != ErrStoreReadOnly {
+			return at, err
+		}
+	}
+
+	if err := e.store.AccessTokensTouch(at); err != nil && err != ErrStoreReadOnly {
+		return at, err
+	}
+
+	return at, nil
 }
 
-// AccessTokensCreate creates a new AccessToken.
+// AccessTokensMigrateToNewSecret re-signs every recorded token that's signed
+// with oldSecret with newSecret, in bulk, and returns the number of tokens that
+// were re-signed. Signed tokens aren't stored, so they're rebuilt from their
+// records, and clients receive the re-signed token the next time they use
+// theirs, as long as oldSecret is still a secondary secret. Tokens issued
+// before the secret was recorded, and expired tokens, aren't re-signed.
+func (e *Empire) AccessTokensMigrateToNewSecret(oldSecret, newSecret []byte) (int, error) {
+	return e.store.AccessTokensResign(func(token *AccessToken) (bool, error) {
+		return e.accessTokens.AccessTokensResign(oldSecret, newSecret, token)
+	})
+}
+
+// AccessTokensCreate creates a new AccessToken, and records it so that it can
+// be audited with AccessTokensList.
 func (e *Empire) AccessTokensCreate(accessToken *AccessToken) (*AccessToken, error) {
-	return e.accessTokens.AccessTokensCreate(accessToken)
+	if accessToken.ID == "" {
+		accessToken.ID = uuid.New()
+	}
+
+	at, err := e.accessTokens.AccessTokensCreate(accessToken)
+	if err != nil {
+		return at, err
+	}
+
+	return at, e.store.AccessTokensCreate(at)
+}
+
+// AccessTokensList returns every recorded access token, newest first, for
+// auditing. Only a hash identifying the secret that each token was signed with
+// is stored, not the signed token, so Token is always empty. It
+// requires an AccessToken that grants ScopeAdmin, so unlike other operations,
+// calls without an AccessToken in the context aren't allowed.
+func (e *Empire) AccessTokensList(ctx context.Context, page Page) ([]*AccessToken, error) {
+	if _, ok := AccessTokenFromContext(ctx); !ok {
+		return nil, ErrInsufficientScope
+	}
+
+	if err := e.requireScope(ctx, ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	return e.store.AccessTokens(page)
+}
+
+// requireScope returns ErrInsufficientScope if the AccessToken embedded in
+// the context does not grant the given scope. Requests that were not made
+// with an AccessToken (e.g. internal callers) are not restricted.
+func (e *Empire) requireScope(ctx context.Context, scope string) error {
+	token, ok := AccessTokenFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	if !e.accessTokens.HasScope(token, scope) {
+		return ErrInsufficientScope
+	}
+
+	return nil
+}
+
+// AccessTokensRequireScope returns ErrInsufficientScope if the AccessToken in
+// the context does not grant the given scope. It's used by callers of methods
+// that don't take a context.
+func (e *Empire) AccessTokensRequireScope(ctx context.Context, scope string) error {
+	return e.requireScope(ctx, scope)
 }
 
 // AppsFirst finds the first app matching the query.
@@ -235,157 +721,1166 @@ func (e *Empire) AppsFirst(q AppsQuery) (*App, error) {
 
 // Apps returns all Apps.
 func (e *Empire) Apps(q AppsQuery) ([]*App, error) {
+	if err := validateAppsSort(q); err != nil {
+		return nil, err
+	}
+
 	return e.store.Apps(q)
 }
 
+// AppsAllBySlug returns all apps that have ever been released with the slug,
+// e.g. to find the apps that share an image.
+func (e *Empire) AppsAllBySlug(slug *Slug) ([]*App, error) {
+	return e.store.AppsAllBySlug(slug)
+}
+
 // AppsCreate creates a new app.
 func (e *Empire) AppsCreate(app *App) (*App, error) {
-	return e.store.AppsCreate(app)
+	return e.apps.AppsCreate(app)
 }
 
-// AppsDestroy destroys the app.
-func (e *Empire) AppsDestroy(ctx context.Context, app *App) error {
-	return e.apps.AppsDestroy(ctx, app)
-}
+// AppsCreateWithConfig creates an app along with its initial config vars, in
+// a single transaction. If vars is empty, and there are no config defaults, no
+// config is created and the returned Config is nil.
+func (e *Empire) AppsCreateWithConfig(ctx context.Context, app *App, vars Vars) (*App, *Config, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, nil, err
+	}
 
-// CertificatesFirst returns a certificate for the given ID
-func (e *Empire) CertificatesFirst(ctx context.Context, q CertificatesQuery) (*Certificate, error) {
-	return e.store.CertificatesFirst(q)
-}
+	if len(vars) > 0 {
+		if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+			return nil, nil, err
+		}
+	}
 
-// CertificatesCreate creates a certificate.
-func (e *Empire) CertificatesCreate(ctx context.Context, cert *Certificate) (*Certificate, error) {
-	return e.certs.CertificatesCreate(ctx, cert)
+	return e.apps.AppsCreateWithConfig(app, vars)
 }
 
-// CertificatesUpdate updates a certificate.
-func (e *Empire) CertificatesUpdate(ctx context.Context, cert *Certificate) (*Certificate, error) {
-	return e.certs.CertificatesUpdate(ctx, cert)
+// AppsSetDeployStrategy sets the strategy that will be used when deploying new
+// releases of the app.
+func (e *Empire) AppsSetDeployStrategy(app *App, strategy string) error {
+	return e.apps.AppsSetDeployStrategy(app, strategy)
 }
 
-// CertificatesDestroy destroys a certificate.
-func (e *Empire) CertificatesDestroy(ctx context.Context, cert *Certificate) error {
-	return e.certs.CertificatesDestroy(ctx, cert)
+// AppsSetDrainTimeout sets the number of seconds that the app's processes are
+// given to exit after receiving a SIGTERM. A value of 0 resets it to the
+// default.
+func (e *Empire) AppsSetDrainTimeout(app *App, seconds int) error {
+	return e.apps.AppsSetDrainTimeout(app, seconds)
 }
 
-// ConfigsCurrent returns the current Config for a given app.
-func (e *Empire) ConfigsCurrent(app *App) (*Config, error) {
-	return e.configs.ConfigsCurrent(app)
-}
+// AppsSetValidateCommand sets the command that's run as a one-off task with
+// each new release of the app. Releases are only created if the command exits
+// 0 within Options.ReleaseValidationTimeout. An empty command disables it.
+// ErrTaskRunnerDisabled is returned if Empire wasn't configured with a
+// TaskRunner.
+func (e *Empire) AppsSetValidateCommand(ctx context.Context, app *App, cmd string) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
 
-// ConfigsApply applies the new config vars to the apps current Config,
-// returning a new Config. If the app has a running release, a new release will
-// be created and run.
-func (e *Empire) ConfigsApply(ctx context.Context, app *App, vars Vars) (*Config, error) {
-	return e.configs.ConfigsApply(ctx, app, vars)
+	return e.apps.AppsSetValidateCommand(app, cmd)
 }
 
-// DomainsFirst returns the first domain matching the query.
-func (e *Empire) DomainsFirst(q DomainsQuery) (*Domain, error) {
-	return e.store.DomainsFirst(q)
+// AppsAllCursor returns up to limit apps, sorted by name, starting after the
+// cursor, along with an opaque cursor for the next page. Unlike offsets,
+// cursors are stable when apps are created between pages. An empty cursor
+// starts at the first page, and an empty next cursor means there are no more
+// apps. A limit of 0 returns every app.
+func (e *Empire) AppsAllCursor(cursor string, limit int) ([]*App, string, error) {
+	return e.apps.AppsAllCursor(cursor, limit)
 }
 
-// Domains returns all domains matching the query.
-func (e *Empire) Domains(q DomainsQuery) ([]*Domain, error) {
-	return e.store.Domains(q)
+// AppsAllWithLastRelease returns a page of apps, sorted by name, along with
+// their most recent active release, e.g. for dashboards. Apps that have never
+// been released have a nil LastRelease.
+func (e *Empire) AppsAllWithLastRelease(page Page) ([]*AppWithLastRelease, error) {
+	return e.store.AppsAllWithLastRelease(page)
 }
 
-// DomainsCreate adds a new Domain for an App.
-func (e *Empire) DomainsCreate(domain *Domain) (*Domain, error) {
-	return e.domains.DomainsCreate(domain)
-}
+// AppsAllWithHealth returns a page of apps, sorted by name, along with whether
+// all of their processes are running. Apps whose processes can't be queried
+// within Options.SchedulerQueryTimeout have an unknown health.
+func (e *Empire) AppsAllWithHealth(ctx context.Context, page Page) ([]*AppWithHealth, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
 
-// DomainsDestroy removes a Domain for an App.
-func (e *Empire) DomainsDestroy(domain *Domain) error {
-	return e.domains.DomainsDestroy(domain)
+	return e.appsHealth.AppsAllWithHealth(ctx, page)
 }
 
-// JobStatesByApp returns the JobStates for the given app.
-func (e *Empire) JobStatesByApp(ctx context.Context, app *App) ([]*ProcessState, error) {
-	return e.jobStates.JobStatesByApp(ctx, app)
-}
+// ClusterJobHealthSummary returns the number of apps that are healthy,
+// degraded, down or of unknown health, for an overview of the cluster. Apps are
+// queried in parallel, and those whose processes can't be queried within
+// Options.SchedulerQueryTimeout of the summary starting have an unknown
+// health.
+func (e *Empire) ClusterJobHealthSummary(ctx context.Context) (*ClusterHealthReport, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
 
-// ProcessesRestart restarts processes matching the given prefix for the given Release.
-// If the prefix is empty, it will match all processes for the release.
-func (e *Empire) ProcessesRestart(ctx context.Context, app *App, t ProcessType, id string) error {
-	return e.restarter.Restart(ctx, app, t, id)
+	return e.appsHealth.ClusterJobHealthSummary(ctx)
 }
 
-type ProcessesRunOpts struct {
-	Attach bool
-	Env    map[string]string
-	Size   string
+// AppsAnnotate sets an annotation on the app, e.g. "owner_email". Apps can be
+// found by their annotations with AppsQuery.AnnotationKey.
+func (e *Empire) AppsAnnotate(app *App, key, value string) error {
+	return e.annotations.AppsAnnotate(app, key, value)
 }
 
-// ProcessesRun runs a one-off process for a given App and command.
-func (e *Empire) ProcessesRun(ctx context.Context, app *App, command string, opts ProcessesRunOpts) (*ContainerRelay, error) {
-	return e.runner.Run(ctx, app, command, opts)
+// AppsAnnotations returns all of the app's annotations.
+func (e *Empire) AppsAnnotations(app *App) (map[string]string, error) {
+	return e.annotations.AppsAnnotations(app)
 }
 
-// ReleasesFindByApp returns all Releases for a given App.
-func (e *Empire) ReleasesFindByApp(app *App) ([]*Release, error) {
-	return e.store.Releases(ReleasesQuery{App: app})
-}
+// AppsDiscoverByLabel returns the apps whose annotation with the key has the
+// value, sorted by name.
+func (e *Empire) AppsDiscoverByLabel(key, value string) ([]*App, error) {
+	if key == "" {
+		return nil, ErrInvalidAnnotationKey
+	}
 
-// ReleasesFindByAppAndVersion finds a specific Release for a given App.
-func (e *Empire) ReleasesFindByAppAndVersion(app *App, version int) (*Release, error) {
-	return e.store.ReleasesFirst(ReleasesQuery{App: app, Version: &version})
+	return e.store.Apps(AppsQuery{AnnotationKey: key, AnnotationValue: value})
 }
 
-// ReleasesLast returns the last release for an App.
-func (e *Empire) ReleasesLast(app *App) (*Release, error) {
-	return e.store.ReleasesFirst(ReleasesQuery{App: app})
+// AppsDiscoverByLabelPrefix returns the apps that have an annotation with the
+// key, whatever its value, sorted by name.
+func (e *Empire) AppsDiscoverByLabelPrefix(key string) ([]*App, error) {
+	return e.AppsDiscoverByLabel(key, "")
 }
 
-// ReleasesRollback rolls an app back to a specific release version. Returns a
-// new release.
-func (e *Empire) ReleasesRollback(ctx context.Context, app *App, version int) (*Release, error) {
-	return e.releases.ReleasesRollback(ctx, app, version)
-}
+// AppsDestroy destroys the app. If Options.StrictDestroy is set, an
+// AppsDestroyConflictError is returned when the app still has running
+// processes, domains or a canary deployment.
+func (e *Empire) AppsDestroy(ctx context.Context, app *App) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
 
-// DeployImage deploys an image to Empire.
-func (e *Empire) DeployImage(ctx context.Context, image Image, out chan Event) (*Release, error) {
-	return e.deployer.DeployImage(ctx, image, out)
+	return e.apps.AppsDestroy(ctx, app)
 }
 
-// AppsScale scales an apps process.
-func (e *Empire) AppsScale(ctx context.Context, app *App, t ProcessType, quantity int, c *Constraints) (*Process, error) {
-	return e.scaler.Scale(ctx, app, t, quantity, c)
+// AppsDestroyVerify destroys the app, then waits up to timeout for the
+// scheduler to stop all of its jobs. If any are still running after the
+// timeout, a JobsStillRunningError listing them is returned.
+func (e *Empire) AppsDestroyVerify(ctx context.Context, app *App, timeout time.Duration) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
+
+	return e.apps.AppsDestroyVerify(ctx, app, timeout)
 }
 
-// Reset resets empire.
-func (e *Empire) Reset() error {
-	return e.store.Reset()
+// AppsDestroyForce destroys the app without checking for dependent resources.
+func (e *Empire) AppsDestroyForce(ctx context.Context, app *App) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
+
+	return e.apps.AppsDestroyForce(ctx, app)
 }
 
-// IsHealthy returns true if Empire is healthy, which means it can connect to
-// the services it depends on.
-func (e *Empire) IsHealthy() bool {
-	return e.store.IsHealthy()
+// AppsDestroyScheduled hides the app immediately, and destroys it once
+// destroyAfter has elapsed, unless the destroy is cancelled with
+// AppsDestroyCancelScheduled first. A destroyAfter of 0 destroys the app
+// immediately, like AppsDestroy.
+func (e *Empire) AppsDestroyScheduled(ctx context.Context, app *App, destroyAfter time.Duration) (*PendingDestroy, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.appsDestroyer.AppsDestroyScheduled(ctx, app, destroyAfter)
 }
 
-// Migrate runs the migrations.
-func Migrate(db, path string) ([]error, bool) {
-	return migrate.UpSync(db, path)
+// AppsDestroyCancelScheduled cancels a pending destroy, restoring the app. It
+// returns ErrDestroyAlreadyExecuted if the app has already been destroyed.
+func (e *Empire) AppsDestroyCancelScheduled(ctx context.Context, pendingID string) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
+
+	return e.appsDestroyer.AppsDestroyCancelScheduled(pendingID)
 }
 
-// ValidationError is returned when a model is not valid.
-type ValidationError struct {
-	Err error
+// AppsDestroySweep destroys the apps whose pending destroys are due now.
+func (e *Empire) AppsDestroySweep(ctx context.Context) error {
+	return e.appsDestroyer.Sweep(ctx)
 }
 
-func (e *ValidationError) Error() string {
-	return e.Err.Error()
+// StartAppsDestroySweeper destroys apps whose pending destroys are due in the
+// background, until the context is cancelled.
+func (e *Empire) StartAppsDestroySweeper(ctx context.Context) {
+	go e.appsDestroyer.Run(ctx)
 }
 
-// key used to store context values from within this package.
-type key int
+// CertificatesFirst returns a certificate for the given ID
+func (e *Empire) CertificatesFirst(ctx context.Context, q CertificatesQuery) (*Certificate, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.store.CertificatesFirst(q)
+}
+
+// CertificatesCreate creates a certificate.
+func (e *Empire) CertificatesCreate(ctx context.Context, cert *Certificate) (*Certificate, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.certs.CertificatesCreate(ctx, cert)
+}
+
+// CertificatesUpdate updates a certificate.
+func (e *Empire) CertificatesUpdate(ctx context.Context, cert *Certificate) (*Certificate, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.certs.CertificatesUpdate(ctx, cert)
+}
+
+// CertificatesDestroy destroys a certificate.
+func (e *Empire) CertificatesDestroy(ctx context.Context, cert *Certificate) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
+
+	return e.certs.CertificatesDestroy(ctx, cert)
+}
+
+// ConfigsCurrent returns the current Config for a given app.
+func (e *Empire) ConfigsCurrent(app *App) (*Config, error) {
+	return e.configs.ConfigsCurrent(app)
+}
+
+// ConfigsCurrentWithResolved returns the current Config for the app, with
+// secret references replaced by their values when Options.SecretResolver is
+// set. The returned Config has Resolved set and must not be stored.
+func (e *Empire) ConfigsCurrentWithResolved(ctx context.Context, app *App) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsRead); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsCurrentWithResolved(ctx, app)
+}
+
+// ConfigsFindByVersion finds a specific Config version for the given App.
+func (e *Empire) ConfigsFindByVersion(app *App, version int) (*Config, error) {
+	return e.store.ConfigsFindByVersion(app, version)
+}
+
+// ConfigsHistory returns every version of the apps Config, newest first.
+func (e *Empire) ConfigsHistory(app *App, page Page) ([]*Config, error) {
+	return e.store.ConfigsHistory(app, page)
+}
+
+// ConfigsKeySetTTL sets the config key to be unset after ttl, e.g. for
+// temporary credentials. Expired keys are unset by the ConfigKeyExpirer.
+func (e *Empire) ConfigsKeySetTTL(app *App, key string, ttl time.Duration) error {
+	return e.configs.ConfigsKeySetTTL(app, key, ttl)
+}
+
+// ConfigDefaultsSet sets config vars that every new app is created with, e.g.
+// LOG_LEVEL=info. Vars with a nil value are removed from the defaults. Apps
+// that already exist aren't changed.
+func (e *Empire) ConfigDefaultsSet(defaults Vars) error {
+	return e.configs.ConfigDefaultsSet(defaults)
+}
+
+// ConfigDefaultsGet returns the config vars that new apps are created with.
+func (e *Empire) ConfigDefaultsGet() (Vars, error) {
+	return e.store.ConfigDefaults()
+}
+
+// ConfigsDiffByID returns the changes between the configs with the given ids,
+// e.g. a staged config and the current config. Values are masked, unless
+// they're references to secrets. ErrConfigNotFound is returned if either
+// config doesn't exist.
+func (e *Empire) ConfigsDiffByID(fromID, toID string) (ConfigChangeset, error) {
+	return e.configs.ConfigsDiffByID(fromID, toID)
+}
+
+// ConfigsApply applies the new config vars to the apps current Config,
+// returning a new Config. If the app has a running release, a new release will
+// be created and run.
+func (e *Empire) ConfigsApply(ctx context.Context, app *App, vars Vars) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsApply(ctx, app, vars)
+}
+
+// ConfigsApplyIfChanged applies the new config vars like ConfigsApply, but
+// doesn't create a new config, or release the app, when the resulting vars are
+// the same as the current config's, e.g. for pipelines that continuously
+// reconcile config. The bool reports whether a new config was created.
+func (e *Empire) ConfigsApplyIfChanged(ctx context.Context, app *App, vars Vars) (*Config, bool, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, false, err
+	}
+
+	return e.configs.ConfigsApplyIfChanged(ctx, app, vars)
+}
+
+// ConfigsApplyOrdered applies the new config vars like ConfigsApply, and sets
+// the order that they're injected into the environment of processes, for vars
+// that reference other vars. Vars that aren't in order are injected after,
+// alphabetically. An empty order keeps the current order.
+func (e *Empire) ConfigsApplyOrdered(ctx context.Context, app *App, vars Vars, order []string) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsApplyOrdered(ctx, app, vars, order)
+}
+
+// ConfigsApplyFromYAML applies config vars read from a flat YAML mapping, like
+// ConfigsApply. A ParseError is returned if the YAML is invalid.
+func (e *Empire) ConfigsApplyFromYAML(ctx context.Context, app *App, r io.Reader) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsApplyFromYAML(ctx, app, r)
+}
+
+// ConfigsApplyFromDotenv applies config vars read from a .env file, like
+// ConfigsApply. Values can be quoted, span multiple lines, and be prefixed with
+// "export". A ParseError is returned if the file is invalid.
+func (e *Empire) ConfigsApplyFromDotenv(ctx context.Context, app *App, r io.Reader) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsApplyFromDotenv(ctx, app, r)
+}
+
+// ConfigsApplyWithHistory applies the changes one at a time, recording a Config
+// for each, in a single transaction.
+func (e *Empire) ConfigsApplyWithHistory(ctx context.Context, app *App, changes []KeyValueChange) ([]*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsApplyWithHistory(ctx, app, changes)
+}
+
+// ConfigsApplyAtomic applies config vars to several apps, keyed by app name, in
+// a single transaction, e.g. for infrastructure as code tools. If any app
+// doesn't exist, or any of the vars are invalid, nothing is applied and a
+// BulkApplyError is returned.
+func (e *Empire) ConfigsApplyAtomic(ctx context.Context, updates map[string]Vars) (map[string]*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsApplyAtomic(ctx, updates)
+}
+
+// ConfigsDriftReport compares the apps current config with a reference config,
+// e.g. one that's stored in git, reporting vars that are missing, extra or
+// changed.
+func (e *Empire) ConfigsDriftReport(app *App, reference Vars) (*DriftReport, error) {
+	return e.configs.ConfigsDriftReport(app, reference)
+}
+
+// ConfigsFreeze marks the config as frozen. Frozen configs are never
+// modified; applying config vars creates a new config derived from it.
+func (e *Empire) ConfigsFreeze(configID string) error {
+	return e.store.ConfigsSetFrozen(configID, true)
+}
+
+// ConfigsUnfreeze removes the frozen mark from the config.
+func (e *Empire) ConfigsUnfreeze(configID string) error {
+	return e.store.ConfigsSetFrozen(configID, false)
+}
+
+// ConfigsMerge merges the vars of the override config on top of the vars of
+// the base config, e.g. to merge production config into staging, and applies
+// the result to the app's config like ConfigsApply.
+func (e *Empire) ConfigsMerge(ctx context.Context, app *App, baseConfigID, overrideConfigID string) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsMerge(ctx, app, baseConfigID, overrideConfigID)
+}
+
+// ConfigsCopyFromApp copies the current config vars from one app to another,
+// excluding the given keys.
+func (e *Empire) ConfigsCopyFromApp(ctx context.Context, src, dst *App, excludeKeys []string) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsCopyFromApp(ctx, src, dst, excludeKeys)
+}
+
+// ConfigsApplyDeltaFromRelease applies the config vars that were added or
+// changed in a release of the source app, compared to the destination app's
+// current config, e.g. to promote new config from staging to production.
+// Vars that aren't in the release's config are left alone.
+func (e *Empire) ConfigsApplyDeltaFromRelease(ctx context.Context, dstApp, srcApp *App, srcVersion int) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.configs.ConfigsApplyDeltaFromRelease(ctx, dstApp, srcApp, srcVersion)
+}
+
+// DomainsFirst returns the first domain matching the query.
+func (e *Empire) DomainsFirst(q DomainsQuery) (*Domain, error) {
+	return e.store.DomainsFirst(q)
+}
+
+// Domains returns all domains matching the query.
+func (e *Empire) Domains(q DomainsQuery) ([]*Domain, error) {
+	return e.store.Domains(q)
+}
+
+// DomainsCreate adds a new Domain for an App.
+func (e *Empire) DomainsCreate(domain *Domain) (*Domain, error) {
+	return e.domains.DomainsCreate(domain)
+}
+
+// DomainsDestroy removes a Domain for an App.
+func (e *Empire) DomainsDestroy(domain *Domain) error {
+	return e.domains.DomainsDestroy(domain)
+}
+
+// FeatureFlag returns whether the named feature flag is enabled for the app.
+// Feature flags are stored as FEATURE_<NAME> config vars.
+func (e *Empire) FeatureFlag(app *App, name string) (bool, error) {
+	return e.featureFlags.FeatureFlag(app, name)
+}
+
+// FeatureFlagSet enables or disables the named feature flag for the app.
+func (e *Empire) FeatureFlagSet(ctx context.Context, app *App, name string, enabled bool) (*Config, error) {
+	if err := e.requireScope(ctx, ScopeConfigsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.featureFlags.FeatureFlagSet(ctx, app, name, enabled)
+}
+
+// FeatureFlagsAll returns all of the feature flags for the app.
+func (e *Empire) FeatureFlagsAll(app *App) (map[string]bool, error) {
+	return e.featureFlags.FeatureFlagsAll(app)
+}
+
+// JobsByApp returns the jobs for the current release of the app, as stored in
+// the database.
+func (e *Empire) JobsByApp(app *App) ([]*Job, error) {
+	return e.jobs.JobsByApp(app)
+}
+
+// JobStatesByApp returns the JobStates for the given app.
+func (e *Empire) JobStatesByApp(ctx context.Context, app *App) ([]*ProcessState, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.jobStates.JobStatesByApp(ctx, app)
+}
+
+// JobStatesStream returns a channel that receives the app's JobStates
+// whenever they change, starting with the current states. The scheduler is
+// polled every Options.JobStatePollInterval. The channel is closed when the
+// context is cancelled.
+func (e *Empire) JobStatesStream(ctx context.Context, app *App, since time.Time) (<-chan []*ProcessState, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.jobStates.JobStatesStream(ctx, app, since)
+}
+
+// ProcessTypesAll returns every process type that has been declared by any
+// release of the app, including ones that aren't in the current release,
+// sorted alphabetically.
+func (e *Empire) ProcessTypesAll(app *App) ([]string, error) {
+	return e.store.ProcessTypesAll(app)
+}
+
+// ProcessesAllSorted returns the processes of the release, sorted by process
+// type.
+func (e *Empire) ProcessesAllSorted(release *Release) ([]*Process, error) {
+	f, err := e.store.Formation(ProcessesQuery{Release: release})
+	if err != nil {
+		return nil, err
+	}
+
+	return f.SortedProcesses(), nil
+}
+
+// ProcessesAllSortedByState returns the app's process instances along with
+// their processes from the current release, with failed instances first, then
+// stopped, then running.
+func (e *Empire) ProcessesAllSortedByState(ctx context.Context, app *App) ([]ProcessWithState, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.jobStates.ProcessesAllSortedByState(ctx, app)
+}
+
+// ProcessesAllByJobState returns the instances of all apps that are in the
+// given state ("running", "stopped" or "failed"), as of their last job state
+// snapshot.
+func (e *Empire) ProcessesAllByJobState(state string, page Page) ([]*JobStateSummary, error) {
+	return e.jobStates.ProcessesAllByJobState(state, page)
+}
+
+// AppsAllByJobState returns the apps that have at least one job in the given
+// state, one of "running", "stopped" or "failed", as of their last job state
+// snapshot.
+func (e *Empire) AppsAllByJobState(state string) ([]*App, error) {
+	return e.jobStates.AppsAllByJobState(state)
+}
+
+// JobStatesSnapshot queries the scheduler for the JobStates of the app and
+// stores them, to be returned by JobStatesByAppCached.
+func (e *Empire) JobStatesSnapshot(ctx context.Context, app *App) error {
+	return e.jobStates.JobStatesSnapshot(ctx, app)
+}
+
+// JobStatesByAppCached returns the stored JobStates for the app if they're
+// newer than maxAge, otherwise it queries the scheduler and updates them. A
+// maxAge of zero always queries the scheduler.
+func (e *Empire) JobStatesByAppCached(ctx context.Context, app *App, maxAge time.Duration) ([]*ProcessState, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.jobStates.JobStatesByAppCached(ctx, app, maxAge)
+}
+
+// ProcessesGetMetrics returns the current CPU and memory usage of the running
+// processes for the app.
+func (e *Empire) ProcessesGetMetrics(ctx context.Context, app *App) ([]ProcessMetrics, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.jobStates.ProcessesGetMetrics(ctx, app)
+}
+
+// ProcessesTop returns the CPU and memory usage, uptime and state of each of
+// the app's running processes, sorted by CPU usage.
+func (e *Empire) ProcessesTop(ctx context.Context, app *App) ([]ProcessTopEntry, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.jobStates.ProcessesTop(ctx, app)
+}
+
+// ProcessesRestart restarts processes matching the given prefix for the given Release.
+// If the prefix is empty, it will match all processes for the release.
+func (e *Empire) ProcessesRestart(ctx context.Context, app *App, t ProcessType, id string) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
+
+	return e.restarter.Restart(ctx, app, t, id)
+}
+
+// ProcessesDrain gracefully stops count instances of the given process type,
+// sending SIGTERM and waiting up to timeout before sending SIGKILL.
+func (e *Empire) ProcessesDrain(ctx context.Context, app *App, t ProcessType, count int, timeout time.Duration) error {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return err
+	}
+
+	return e.drainer.Drain(ctx, app, t, count, timeout)
+}
+
+type ProcessesRunOpts struct {
+	Attach bool
+	Env    map[string]string
+	Size   string
+}
+
+// ProcessesRun runs a one-off process for a given App and command.
+func (e *Empire) ProcessesRun(ctx context.Context, app *App, command string, opts ProcessesRunOpts) (*ContainerRelay, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.runner.Run(ctx, app, command, opts)
+}
+
+// ReleasesFindByApp returns all Releases for a given App.
+func (e *Empire) ReleasesFindByApp(app *App) ([]*Release, error) {
+	return e.store.Releases(ReleasesQuery{App: app})
+}
+
+// ReleasesFindByAppWithDiff returns a page of the releases for the app, like
+// ReleasesFindByApp, with each release's ConfigDiff set to the changes since
+// the release before it.
+func (e *Empire) ReleasesFindByAppWithDiff(app *App, page Page) ([]*Release, error) {
+	return e.store.ReleasesWithConfigDiff(app, page)
+}
+
+// ReleasesFindByAppAndVersion finds a specific Release for a given App.
+func (e *Empire) ReleasesFindByAppAndVersion(app *App, version int) (*Release, error) {
+	return e.store.ReleasesFirst(ReleasesQuery{App: app, Version: &version})
+}
+
+// ReleasesLast returns the last active release for an App. Drafts and canaries
+// are ignored.
+func (e *Empire) ReleasesLast(app *App) (*Release, error) {
+	return e.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+}
+
+// ReleasesDeploy creates a release of the config and slug with the app's
+// current formation. It's a thin alias of the releases service's
+// ReleasesCreate, which already schedules the release onto the cluster, except
+// that commands overridden with ProcessesSetCommand aren't applied to the
+// release, and are cleared once it's scheduled. Apps that haven't been
+// released before are scaled to the DefaultQuantities.
+func (e *Empire) ReleasesDeploy(ctx context.Context, app *App, config *Config, slug *Slug, desc string) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.releases.ReleasesDeploy(ctx, &Release{
+		App:         app,
+		Config:      config,
+		Slug:        slug,
+		Description: desc,
+	})
+}
+
+// ReleasesCreateDraft creates a draft release of the config and slug, which
+// isn't scheduled until it's approved with ReleasesActivate.
+func (e *Empire) ReleasesCreateDraft(ctx context.Context, app *App, config *Config, slug *Slug, desc string) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.releases.ReleasesCreateDraft(ctx, &Release{
+		App:         app,
+		Config:      config,
+		Slug:        slug,
+		Description: desc,
+	})
+}
+
+// ReleasesActivate activates a draft release, recording approverEmail as the
+// user that approved it, and schedules it onto the cluster.
+func (e *Empire) ReleasesActivate(ctx context.Context, release *Release, approverEmail string) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.releases.ReleasesActivate(ctx, release, approverEmail)
+}
+
+// ReleasesRequestApproval emails each of the approvers a link to approve or
+// reject the draft release, returning the id of the approval request. Links
+// expire after Options.ReleaseApprovalTTL, and only the first approver to
+// respond decides.
+func (e *Empire) ReleasesRequestApproval(ctx context.Context, release *Release, approvers []string) (string, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return "", err
+	}
+
+	return e.approvals.ReleasesRequestApproval(ctx, release, approvers)
+}
+
+// ReleasesApprove approves the draft release with a token from an approval
+// email, then activates it, recording the approver. The token grants access,
+// so no scope is required.
+func (e *Empire) ReleasesApprove(ctx context.Context, token string) (*Release, error) {
+	return e.approvals.ReleasesApprove(ctx, token)
+}
+
+// ReleasesReject rejects the draft release with a token from an approval
+// email, so that it can no longer be approved. Like ReleasesApprove, no scope
+// is required.
+func (e *Empire) ReleasesReject(ctx context.Context, token string, reason string) error {
+	return e.approvals.ReleasesReject(ctx, token, reason)
+}
+
+// ReleasesPromoteToStable makes the version of the app the stable release,
+// scaling the running processes to its formation if it's different.
+func (e *Empire) ReleasesPromoteToStable(ctx context.Context, app *App, version int) error {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return err
+	}
+
+	return e.promoter.ReleasesPromoteToStable(ctx, app, version)
+}
+
+// ReleasesCompare returns the config, slug and formation differences between
+// two versions of an app.
+func (e *Empire) ReleasesCompare(app *App, fromVersion, toVersion int) (*ReleaseComparison, error) {
+	from, err := e.ReleasesFindByAppAndVersion(app, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := e.ReleasesFindByAppAndVersion(app, toVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return CompareReleases(from, to), nil
+}
+
+// ReleasesSearch returns the releases of any app whose description, commit sha
+// or branch contain the query, ignoring case. The most recent releases are
+// returned first.
+func (e *Empire) ReleasesSearch(query string, page Page) ([]*Release, error) {
+	return e.store.Releases(ReleasesSearchQuery{Query: query, Page: page})
+}
+
+// ReleasesFind returns the releases matching all of the non-zero fields of the
+// query, most recent first. If the query's Page doesn't have a Limit, at most
+// DefaultReleasesSearchLimit releases are returned.
+func (e *Empire) ReleasesFind(query ReleasesQuery) ([]*Release, error) {
+	if query.Page.Limit == 0 {
+		query.Page.Limit = DefaultReleasesSearchLimit
+	}
+
+	return e.store.Releases(ComposedScope{Order("created_at desc"), query})
+}
+
+// ReleasesRollback rolls an app back to a specific release version. Returns a
+// new release.
+func (e *Empire) ReleasesRollback(ctx context.Context, app *App, version int) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.releases.ReleasesRollback(ctx, app, version)
+}
+
+// ReleasesGraftConfig creates a new release with the slug of the given version
+// of the app and the config with newConfigID, without changing either release.
+func (e *Empire) ReleasesGraftConfig(ctx context.Context, app *App, version int, newConfigID string) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.releases.ReleasesGraftConfig(ctx, app, version, newConfigID)
+}
+
+// ReleasesStream returns a channel of ReleaseEvents for the app, which is
+// closed when the context is cancelled.
+func (e *Empire) ReleasesStream(ctx context.Context, app *App) (<-chan ReleaseEvent, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.releaseStreamer.ReleasesStream(ctx, app)
+}
+
+// ReleaseTagSet points the tag at the release, moving it from any other
+// release of the app.
+func (e *Empire) ReleaseTagSet(app *App, release *Release, tag string) error {
+	return e.releaseTags.ReleaseTagSet(app, release, tag)
+}
+
+// ReleaseTagGet returns the release of the app with the given tag. If no
+// release has the tag, ErrTagNotFound is returned.
+func (e *Empire) ReleaseTagGet(app *App, tag string) (*Release, error) {
+	return e.releaseTags.ReleaseTagGet(app, tag)
+}
+
+// ReleasesTagSearch returns the releases of the app with a tag matching the
+// SQL LIKE pattern, e.g. "rollback%".
+func (e *Empire) ReleasesTagSearch(app *App, tagPattern string) ([]*Release, error) {
+	return e.releaseTags.ReleasesTagSearch(app, tagPattern)
+}
+
+// ReleasesTagAll returns all of the app's tags, and the releases they point to.
+func (e *Empire) ReleasesTagAll(app *App) (map[string]*Release, error) {
+	return e.releaseTags.ReleasesTagAll(app)
+}
+
+// ReleasesAutoTag tags the release with "semver" if its description contains a
+// semantic version, moving "semver-latest" to it if it's the greatest version
+// so far.
+func (e *Empire) ReleasesAutoTag(app *App, release *Release) error {
+	return e.releaseTags.ReleasesAutoTag(app, release)
+}
+
+// DeployImage deploys an image to Empire.
+func (e *Empire) DeployImage(ctx context.Context, image Image, out chan Event) (*Release, error) {
+	return e.DeployImageWithMetadata(ctx, image, ReleaseMetadata{}, out)
+}
+
+// DeployImageWithMetadata deploys an image to Empire, recording the commit and
+// branch that it was built from on the release.
+func (e *Empire) DeployImageWithMetadata(ctx context.Context, image Image, meta ReleaseMetadata, out chan Event) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.deployer.DeployImage(ctx, image, meta, out)
+}
+
+// ReleasesCreateFromImage deploys the image to the named app, using the apps
+// current config.
+func (e *Empire) ReleasesCreateFromImage(ctx context.Context, appName string, image string, opts DeployOptions) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.deployer.ReleasesCreateFromImage(ctx, appName, image, opts)
+}
+
+// DeployCanary deploys an image to a percentage of an apps instances, leaving
+// the remaining instances on the current release.
+func (e *Empire) DeployCanary(ctx context.Context, image Image, opts CanaryOptions) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.canaries.DeployCanary(ctx, image, opts)
+}
+
+// PromoteCanary runs the canary release on all of an apps instances.
+func (e *Empire) PromoteCanary(ctx context.Context, app *App) error {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return err
+	}
+
+	return e.canaries.PromoteCanary(ctx, app)
+}
+
+// RollbackCanary removes the canary release, rolling back to the release that
+// was running before the canary was deployed.
+func (e *Empire) RollbackCanary(ctx context.Context, app *App) error {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return err
+	}
+
+	return e.canaries.RollbackCanary(ctx, app)
+}
+
+// FormationAtTime returns what the formation of the app looked like at the
+// given time, by replaying its scale events.
+func (e *Empire) FormationAtTime(app *App, at time.Time) (Formation, error) {
+	return e.formations.FormationAtTime(app, at)
+}
+
+// AppsScale scales an apps process.
+func (e *Empire) AppsScale(ctx context.Context, app *App, t ProcessType, quantity int, c *Constraints) (*Process, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.scaler.Scale(ctx, app, t, quantity, c)
+}
+
+// ProcessesScale scales the process types of the app's current release to the
+// given quantities, e.g. {"web": 3}. ErrNoChangeRequired is returned if the
+// processes are already scaled to those quantities.
+func (e *Empire) ProcessesScale(ctx context.Context, app *App, quantities map[string]int) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.scaler.ProcessesScale(ctx, app, quantities)
+}
+
+// ProcessesSetCommand overrides the command of the app's process type, e.g. to
+// add a debug flag, by creating a new release of the current config and slug.
+// The slug isn't changed, and the override is cleared by the next deploy.
+func (e *Empire) ProcessesSetCommand(ctx context.Context, app *App, processType string, command string) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.commands.ProcessesSetCommand(ctx, app, processType, command)
+}
+
+// ScaleReleaseJSONPatch scales the processes of the app's current release by
+// applying a JSON Patch (RFC 6902) document to its formation, represented as
+// {"web": 3, "worker": 1}. ErrInvalidPatch is returned if the patch is
+// malformed.
+func (e *Empire) ScaleReleaseJSONPatch(ctx context.Context, app *App, patch []byte) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeAppsWrite); err != nil {
+		return nil, err
+	}
+
+	return e.scaler.ProcessesScaleJSONPatch(ctx, app, patch)
+}
+
+// UsageReport returns the instance hours used by each process type of the app
+// between since and until.
+func (e *Empire) UsageReport(ctx context.Context, app *App, since, until time.Time) ([]*AppUsageReport, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.usage.UsageReport(ctx, app, since, until)
+}
+
+// UsageReportAll returns the instance hours used by each process type of every
+// app between since and until.
+func (e *Empire) UsageReportAll(ctx context.Context, since, until time.Time) ([]*AppUsageReport, error) {
+	if err := e.requireScope(ctx, ScopeAppsRead); err != nil {
+		return nil, err
+	}
+
+	return e.usage.UsageReportAll(ctx, since, until)
+}
+
+// SlugsCreateFromDockerfile builds an image for the app from the Dockerfile in
+// the build context, which is a tar archive, pushes it to the organization's
+// registry, then creates a slug for it. Build output is written to the
+// OutputStream of buildOpts.
+func (e *Empire) SlugsCreateFromDockerfile(ctx context.Context, app *App, buildContext io.Reader, buildOpts docker.BuildImageOptions) (*Slug, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.slugs.SlugsCreateFromDockerfile(ctx, app, buildContext, buildOpts)
+}
+
+// SlugsBuildFromSource builds an image for the app from the Dockerfile in the
+// https or ssh git repository at ref, tagged with the commit sha, then creates
+// a Slug for it. The output of the build is streamed to w while it runs.
+func (e *Empire) SlugsBuildFromSource(ctx context.Context, app *App, gitURL, ref string, buildArgs map[string]string, w io.Writer) (*Slug, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.slugs.SlugsBuildFromSource(ctx, app, gitURL, ref, buildArgs, w)
+}
+
+// SlugsCreateFromCompose creates a Slug for each service in a
+// docker-compose.yml, with the service name as its process type. Image tags
+// can be replaced with overrides, which may be nil.
+func (e *Empire) SlugsCreateFromCompose(ctx context.Context, app *App, r io.Reader, overrides ComposeOverrides) ([]*Slug, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.slugs.SlugsCreateFromCompose(ctx, app, r, overrides)
+}
+
+// DeployFromTarball downloads a gzipped tar archive containing a Dockerfile,
+// builds an image from it tagged with the sha256 of the URL, pushes it to the
+// organization's registry, then deploys it to the app. Tarballs can only be
+// downloaded from Options.TarballAllowedHosts.
+func (e *Empire) DeployFromTarball(ctx context.Context, app *App, tarURL string, opts TarballDeployOptions) (*Release, error) {
+	if err := e.requireScope(ctx, ScopeDeploysWrite); err != nil {
+		return nil, err
+	}
+
+	return e.tarballs.DeployFromTarball(ctx, app, tarURL, opts)
+}
+
+// SlugsGC deletes slugs that aren't used by any release, for images that no
+// longer exist in the registry. It returns the number of slugs that were
+// deleted.
+func (e *Empire) SlugsGC(ctx context.Context) (int, error) {
+	return e.slugs.SlugsGC(ctx)
+}
+
+// StartGarbageCollector runs SlugsGC in the background every interval, until
+// the context is cancelled.
+func (e *Empire) StartGarbageCollector(ctx context.Context, interval time.Duration) {
+	e.slugs.StartGarbageCollector(ctx, interval)
+}
+
+// CrashLoopPoliciesSet sets the crash loop policy for a process type of the
+// app.
+func (e *Empire) CrashLoopPoliciesSet(app *App, processType string, policy CrashLoopPolicy) error {
+	return e.crashLoops.CrashLoopPoliciesSet(app, processType, policy)
+}
+
+// StartCrashLoopDetector checks for crash looping processes in the background,
+// until the context is cancelled.
+func (e *Empire) StartCrashLoopDetector(ctx context.Context) {
+	go e.crashLoops.Run(ctx)
+}
+
+// StartWebhookRetrier retries failed webhook deliveries in the background,
+// until the context is cancelled.
+func (e *Empire) StartWebhookRetrier(ctx context.Context) {
+	go e.webhooks.Run(ctx)
+}
+
+// StartConfigKeyExpirer unsets expired config keys in the background, until
+// the context is cancelled.
+func (e *Empire) StartConfigKeyExpirer(ctx context.Context) {
+	go e.configKeys.Run(ctx)
+}
+
+// ConfigKeysExpire unsets the config keys that have expired now.
+func (e *Empire) ConfigKeysExpire(ctx context.Context) error {
+	return e.configKeys.Expire(ctx)
+}
+
+// WebhookDeliveriesRetry retries the failed webhook deliveries that are due
+// now.
+func (e *Empire) WebhookDeliveriesRetry(ctx context.Context) error {
+	return e.webhooks.Retry(ctx)
+}
+
+// WebhookDeliveryAttempts returns the failed webhook deliveries with the
+// given status, e.g. WebhookDeliveryExhausted. An empty status returns all of
+// them.
+func (e *Empire) WebhookDeliveryAttempts(status string) ([]*WebhookDeliveryAttempt, error) {
+	return e.store.WebhookDeliveryAttempts(WebhookDeliveryAttemptsQuery{Status: status})
+}
+
+// StoreMode returns whether the store is currently writable.
+func (e *Empire) StoreMode() StoreMode {
+	return e.store.Mode()
+}
+
+// StartStoreMonitor pings the primary and replica databases in the
+// background, switching to read-only mode while the primary is unavailable,
+// until the context is cancelled.
+func (e *Empire) StartStoreMonitor(ctx context.Context) {
+	go e.storeMonitor.Run(ctx)
+}
+
+// SLOTargetSet sets the minimum number of releases per week for the app.
+func (e *Empire) SLOTargetSet(app *App, target DeployFrequencyTarget) (*DeployFrequencyTarget, error) {
+	return e.slos.SetTarget(app, target)
+}
+
+// SLOTargetGet returns the deploy frequency target for the app.
+func (e *Empire) SLOTargetGet(app *App) (*DeployFrequencyTarget, error) {
+	return e.slos.GetTarget(app)
+}
+
+// SLOEvaluate reports whether the app has met its deploy frequency target
+// over the last week.
+func (e *Empire) SLOEvaluate(app *App) (*SLOReport, error) {
+	return e.slos.EvaluateSLO(app)
+}
+
+// StartSLOController evaluates deploy frequency targets in the background,
+// sending a notification for apps that miss their target, until the context
+// is cancelled.
+func (e *Empire) StartSLOController(ctx context.Context) {
+	go e.sloController.Run(ctx)
+}
+
+// MigrateApps moves the current release of every app from one scheduler to
+// another. An app is only removed from the old scheduler once all of its
+// processes are running on the new one. Empire should be restarted with the
+// new scheduler afterwards.
+func (e *Empire) MigrateApps(ctx context.Context, from, to service.Manager) (*MigrationReport, error) {
+	return e.migrator.MigrateApps(ctx, from, to)
+}
+
+// ConfigureTelemetry detects the environment that Empire is running in, and
+// attaches the attributes it finds to every log line and trace written
+// through e.Logger. It should be called before the server is created.
+func (e *Empire) ConfigureTelemetry(ctx context.Context, opts TelemetryOptions) error {
+	r, err := detectResource(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	e.Logger = e.Logger.New(r.pairs()...)
+	return nil
+}
+
+// Backup writes a gzipped tar archive of all apps, configs, slugs, releases and
+// formations to w.
+func (e *Empire) Backup(ctx context.Context, w io.Writer) error {
+	if err := e.requireScope(ctx, ScopeAdmin); err != nil {
+		return err
+	}
+
+	return e.backups.Backup(w)
+}
+
+// Restore restores the records from an archive written by Backup. Records that
+// already exist are skipped, and reported as conflicts.
+func (e *Empire) Restore(ctx context.Context, r io.Reader) (*RestoreReport, error) {
+	if err := e.requireScope(ctx, ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	return e.backups.Restore(r)
+}
+
+// Reset resets empire.
+func (e *Empire) Reset() error {
+	return e.store.Reset()
+}
+
+// IsHealthy returns true if Empire is healthy, which means it can connect to
+// the services it depends on.
+func (e *Empire) IsHealthy() bool {
+	return e.store.IsHealthy()
+}
+
+// Migrate runs the migrations.
+func Migrate(db, path string) ([]error, bool) {
+	return migrate.UpSync(db, path)
+}
+
+// SchemaVersion returns the version of the last migration that was applied to
+// the database.
+func SchemaVersion(db string) (int, error) {
+	d, err := driver.New(db)
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+
+	version, err := d.Version()
+	return int(version), err
+}
+
+// SchemaNeedsUpgrade returns whether there are migrations in path that haven't
+// been applied to the database, and the current schema version.
+func SchemaNeedsUpgrade(db, path string) (bool, int, error) {
+	d, err := driver.New(db)
+	if err != nil {
+		return false, 0, err
+	}
+	defer d.Close()
+
+	version, err := d.Version()
+	if err != nil {
+		return false, 0, err
+	}
+
+	files, err := file.ReadMigrationFiles(path, file.FilenameRegex(d.FilenameExtension()))
+	if err != nil {
+		return false, int(version), err
+	}
+
+	pending, err := files.ToLastFrom(version)
+	return len(pending) > 0, int(version), err
+}
+
+// ValidationError is returned when a model is not valid.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// key used to store context values from within this package.
+type key int
 
 const (
-	UserKey key = 0
+	UserKey        key = 0
+	AccessTokenKey key = 1
+
+	skipValidationKey key = 2
 )
 
-func newManager(ecsOpts ECSOptions, elbOpts ELBOptions, config *aws.Config) (service.Manager, error) {
+func newManager(ecsOpts ECSOptions, elbOpts ELBOptions, config *aws.Config, maxConcurrency int) (service.Manager, error) {
 	if config == nil {
 		log.Println("warn: AWS not configured, ECS service management disabled.")
 		return service.NewFakeManager(), nil
@@ -400,6 +1895,7 @@ func newManager(ecsOpts ECSOptions, elbOpts ELBOptions, config *aws.Config) (ser
 		ExternalSubnetIDs:       elbOpts.ExternalSubnetIDs,
 		AWS:                     config,
 		ZoneID:                  elbOpts.InternalZoneID,
+		MaxConcurrency:          maxConcurrency,
 	})
 }
 
@@ -441,16 +1937,59 @@ func newExtractor(o DockerOptions) (Extractor, error) {
 		return &fakeExtractor{}, nil
 	}
 
-	c, err := newDockerClient(o.Socket, o.CertPath)
-	return newProcfileFallbackExtractor(c), err
+	c, err := newReconnectingDockerClientFromOptions(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return newProcfileFallbackExtractor(c), nil
 }
 
 func newResolver(o DockerOptions) (Resolver, error) {
+	if o.Resolver != nil {
+		return o.Resolver, nil
+	}
+
 	if o.Socket == "" {
 		log.Println("warn: docker socket not configured, docker image puller disabled.")
 		return &fakeResolver{}, nil
 	}
 
-	c, err := newDockerClient(o.Socket, o.CertPath)
-	return newDockerResolver(c, o.Auth), err
+	c, err := newReconnectingDockerClientFromOptions(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDockerResolver(c, o.Auth, o.RegistryRouter), nil
+}
+
+func newBuilder(o DockerOptions) (Builder, error) {
+	if o.Socket == "" || o.Organization == "" {
+		log.Println("warn: docker socket or organization not configured, image builds disabled.")
+		return &fakeBuilder{}, nil
+	}
+
+	c, err := newReconnectingDockerClientFromOptions(o)
+	if err != nil {
+		return nil, err
+	}
+
+	return newDockerBuilder(c, o.Organization, o.Auth, o.RegistryRouter), nil
+}
+
+func newReconnectingDockerClientFromOptions(o DockerOptions) (*ReconnectingDockerClient, error) {
+	c, err := NewReconnectingDockerClient(o.Socket, o.CertPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.MaxReconnectAttempts != 0 {
+		c.MaxReconnectAttempts = o.MaxReconnectAttempts
+	}
+
+	if o.ReconnectBackoff != 0 {
+		c.ReconnectBackoff = o.ReconnectBackoff
+	}
+
+	return c, nil
 }
@@ -0,0 +1,1387 @@
+package empiretest
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+// Call is a call to a method of FakeEmpire.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// FakeEmpire is an empire.EmpireInterface for testing code that uses Empire,
+// without a database. Every call is recorded, then passed to the method's On
+// hook. Methods without a hook return zero values.
+type FakeEmpire struct {
+	OnAccessTokensFind               func(string) (*empire.AccessToken, error)
+	OnAccessTokensCreate             func(*empire.AccessToken) (*empire.AccessToken, error)
+	OnAccessTokensList               func(context.Context, empire.Page) ([]*empire.AccessToken, error)
+	OnAccessTokensRequireScope       func(context.Context, string) error
+	OnAccessTokensMigrateToNewSecret func([]byte, []byte) (int, error)
+	OnAppsFirst                      func(empire.AppsQuery) (*empire.App, error)
+	OnApps                           func(empire.AppsQuery) ([]*empire.App, error)
+	OnAppsAllBySlug                  func(*empire.Slug) ([]*empire.App, error)
+	OnAppsCreate                     func(*empire.App) (*empire.App, error)
+	OnAppsCreateWithConfig           func(context.Context, *empire.App, empire.Vars) (*empire.App, *empire.Config, error)
+	OnAppsSetDeployStrategy          func(*empire.App, string) error
+	OnAppsSetDrainTimeout            func(*empire.App, int) error
+	OnAppsSetValidateCommand         func(context.Context, *empire.App, string) error
+	OnAppsAllCursor                  func(string, int) ([]*empire.App, string, error)
+	OnAppsAllWithLastRelease         func(empire.Page) ([]*empire.AppWithLastRelease, error)
+	OnAppsAllWithHealth              func(context.Context, empire.Page) ([]*empire.AppWithHealth, error)
+	OnClusterJobHealthSummary        func(context.Context) (*empire.ClusterHealthReport, error)
+	OnAppsAnnotate                   func(*empire.App, string, string) error
+	OnAppsAnnotations                func(*empire.App) (map[string]string, error)
+	OnAppsDiscoverByLabel            func(string, string) ([]*empire.App, error)
+	OnAppsDiscoverByLabelPrefix      func(string) ([]*empire.App, error)
+	OnAppsDestroy                    func(context.Context, *empire.App) error
+	OnAppsDestroyVerify              func(context.Context, *empire.App, time.Duration) error
+	OnAppsDestroyForce               func(context.Context, *empire.App) error
+	OnAppsDestroyScheduled           func(context.Context, *empire.App, time.Duration) (*empire.PendingDestroy, error)
+	OnAppsDestroyCancelScheduled     func(context.Context, string) error
+	OnAppsDestroySweep               func(context.Context) error
+	OnCertificatesFirst              func(context.Context, empire.CertificatesQuery) (*empire.Certificate, error)
+	OnCertificatesCreate             func(context.Context, *empire.Certificate) (*empire.Certificate, error)
+	OnCertificatesUpdate             func(context.Context, *empire.Certificate) (*empire.Certificate, error)
+	OnCertificatesDestroy            func(context.Context, *empire.Certificate) error
+	OnConfigsCurrent                 func(*empire.App) (*empire.Config, error)
+	OnConfigsCurrentWithResolved     func(context.Context, *empire.App) (*empire.Config, error)
+	OnConfigsFindByVersion           func(*empire.App, int) (*empire.Config, error)
+	OnConfigsHistory                 func(*empire.App, empire.Page) ([]*empire.Config, error)
+	OnConfigsKeySetTTL               func(*empire.App, string, time.Duration) error
+	OnConfigDefaultsSet              func(empire.Vars) error
+	OnConfigDefaultsGet              func() (empire.Vars, error)
+	OnConfigsDiffByID                func(string, string) (empire.ConfigChangeset, error)
+	OnConfigsApply                   func(context.Context, *empire.App, empire.Vars) (*empire.Config, error)
+	OnConfigsApplyIfChanged          func(context.Context, *empire.App, empire.Vars) (*empire.Config, bool, error)
+	OnConfigsApplyOrdered            func(context.Context, *empire.App, empire.Vars, []string) (*empire.Config, error)
+	OnConfigsApplyFromYAML           func(context.Context, *empire.App, io.Reader) (*empire.Config, error)
+	OnConfigsApplyFromDotenv         func(context.Context, *empire.App, io.Reader) (*empire.Config, error)
+	OnConfigsApplyWithHistory        func(context.Context, *empire.App, []empire.KeyValueChange) ([]*empire.Config, error)
+	OnConfigsApplyAtomic             func(context.Context, map[string]empire.Vars) (map[string]*empire.Config, error)
+	OnConfigsDriftReport             func(*empire.App, empire.Vars) (*empire.DriftReport, error)
+	OnConfigsFreeze                  func(string) error
+	OnConfigsUnfreeze                func(string) error
+	OnConfigsMerge                   func(context.Context, *empire.App, string, string) (*empire.Config, error)
+	OnConfigsCopyFromApp             func(context.Context, *empire.App, *empire.App, []string) (*empire.Config, error)
+	OnConfigsApplyDeltaFromRelease   func(context.Context, *empire.App, *empire.App, int) (*empire.Config, error)
+	OnDomainsFirst                   func(empire.DomainsQuery) (*empire.Domain, error)
+	OnDomains                        func(empire.DomainsQuery) ([]*empire.Domain, error)
+	OnDomainsCreate                  func(*empire.Domain) (*empire.Domain, error)
+	OnDomainsDestroy                 func(*empire.Domain) error
+	OnFeatureFlag                    func(*empire.App, string) (bool, error)
+	OnFeatureFlagSet                 func(context.Context, *empire.App, string, bool) (*empire.Config, error)
+	OnFeatureFlagsAll                func(*empire.App) (map[string]bool, error)
+	OnJobsByApp                      func(*empire.App) ([]*empire.Job, error)
+	OnJobStatesByApp                 func(context.Context, *empire.App) ([]*empire.ProcessState, error)
+	OnJobStatesStream                func(context.Context, *empire.App, time.Time) (<-chan []*empire.ProcessState, error)
+	OnProcessTypesAll                func(*empire.App) ([]string, error)
+	OnProcessesAllSorted             func(*empire.Release) ([]*empire.Process, error)
+	OnProcessesAllSortedByState      func(context.Context, *empire.App) ([]empire.ProcessWithState, error)
+	OnProcessesAllByJobState         func(string, empire.Page) ([]*empire.JobStateSummary, error)
+	OnAppsAllByJobState              func(string) ([]*empire.App, error)
+	OnJobStatesSnapshot              func(context.Context, *empire.App) error
+	OnJobStatesByAppCached           func(context.Context, *empire.App, time.Duration) ([]*empire.ProcessState, error)
+	OnProcessesGetMetrics            func(context.Context, *empire.App) ([]empire.ProcessMetrics, error)
+	OnProcessesTop                   func(context.Context, *empire.App) ([]empire.ProcessTopEntry, error)
+	OnProcessesRestart               func(context.Context, *empire.App, empire.ProcessType, string) error
+	OnProcessesDrain                 func(context.Context, *empire.App, empire.ProcessType, int, time.Duration) error
+	OnProcessesRun                   func(context.Context, *empire.App, string, empire.ProcessesRunOpts) (*empire.ContainerRelay, error)
+	OnReleasesFindByApp              func(*empire.App) ([]*empire.Release, error)
+	OnReleasesFindByAppWithDiff      func(*empire.App, empire.Page) ([]*empire.Release, error)
+	OnReleasesFindByAppAndVersion    func(*empire.App, int) (*empire.Release, error)
+	OnReleasesLast                   func(*empire.App) (*empire.Release, error)
+	OnReleasesDeploy                 func(context.Context, *empire.App, *empire.Config, *empire.Slug, string) (*empire.Release, error)
+	OnReleasesCreateDraft            func(context.Context, *empire.App, *empire.Config, *empire.Slug, string) (*empire.Release, error)
+	OnReleasesActivate               func(context.Context, *empire.Release, string) (*empire.Release, error)
+	OnReleasesRequestApproval        func(context.Context, *empire.Release, []string) (string, error)
+	OnReleasesApprove                func(context.Context, string) (*empire.Release, error)
+	OnReleasesReject                 func(context.Context, string, string) error
+	OnReleasesPromoteToStable        func(context.Context, *empire.App, int) error
+	OnReleasesCompare                func(*empire.App, int, int) (*empire.ReleaseComparison, error)
+	OnReleasesSearch                 func(string, empire.Page) ([]*empire.Release, error)
+	OnReleasesFind                   func(empire.ReleasesQuery) ([]*empire.Release, error)
+	OnReleasesRollback               func(context.Context, *empire.App, int) (*empire.Release, error)
+	OnReleasesGraftConfig            func(context.Context, *empire.App, int, string) (*empire.Release, error)
+	OnReleasesStream                 func(context.Context, *empire.App) (<-chan empire.ReleaseEvent, error)
+	OnReleaseTagSet                  func(*empire.App, *empire.Release, string) error
+	OnReleaseTagGet                  func(*empire.App, string) (*empire.Release, error)
+	OnReleasesTagSearch              func(*empire.App, string) ([]*empire.Release, error)
+	OnReleasesTagAll                 func(*empire.App) (map[string]*empire.Release, error)
+	OnReleasesAutoTag                func(*empire.App, *empire.Release) error
+	OnDeployImage                    func(context.Context, empire.Image, chan empire.Event) (*empire.Release, error)
+	OnDeployImageWithMetadata        func(context.Context, empire.Image, empire.ReleaseMetadata, chan empire.Event) (*empire.Release, error)
+	OnReleasesCreateFromImage        func(context.Context, string, string, empire.DeployOptions) (*empire.Release, error)
+	OnDeployCanary                   func(context.Context, empire.Image, empire.CanaryOptions) (*empire.Release, error)
+	OnPromoteCanary                  func(context.Context, *empire.App) error
+	OnRollbackCanary                 func(context.Context, *empire.App) error
+	OnFormationAtTime                func(*empire.App, time.Time) (empire.Formation, error)
+	OnAppsScale                      func(context.Context, *empire.App, empire.ProcessType, int, *empire.Constraints) (*empire.Process, error)
+	OnProcessesScale                 func(context.Context, *empire.App, map[string]int) (*empire.Release, error)
+	OnProcessesSetCommand            func(context.Context, *empire.App, string, string) (*empire.Release, error)
+	OnScaleReleaseJSONPatch          func(context.Context, *empire.App, []byte) (*empire.Release, error)
+	OnUsageReport                    func(context.Context, *empire.App, time.Time, time.Time) ([]*empire.AppUsageReport, error)
+	OnUsageReportAll                 func(context.Context, time.Time, time.Time) ([]*empire.AppUsageReport, error)
+	OnSlugsCreateFromDockerfile      func(context.Context, *empire.App, io.Reader, docker.BuildImageOptions) (*empire.Slug, error)
+	OnSlugsBuildFromSource           func(context.Context, *empire.App, string, string, map[string]string, io.Writer) (*empire.Slug, error)
+	OnSlugsCreateFromCompose         func(context.Context, *empire.App, io.Reader, empire.ComposeOverrides) ([]*empire.Slug, error)
+	OnDeployFromTarball              func(context.Context, *empire.App, string, empire.TarballDeployOptions) (*empire.Release, error)
+	OnSlugsGC                        func(context.Context) (int, error)
+	OnStartGarbageCollector          func(context.Context, time.Duration)
+	OnCrashLoopPoliciesSet           func(*empire.App, string, empire.CrashLoopPolicy) error
+	OnStartAppsDestroySweeper        func(context.Context)
+	OnStartCrashLoopDetector         func(context.Context)
+	OnStartWebhookRetrier            func(context.Context)
+	OnStartConfigKeyExpirer          func(context.Context)
+	OnConfigKeysExpire               func(context.Context) error
+	OnWebhookDeliveriesRetry         func(context.Context) error
+	OnWebhookDeliveryAttempts        func(string) ([]*empire.WebhookDeliveryAttempt, error)
+	OnStoreMode                      func() empire.StoreMode
+	OnStartStoreMonitor              func(context.Context)
+	OnSLOTargetSet                   func(*empire.App, empire.DeployFrequencyTarget) (*empire.DeployFrequencyTarget, error)
+	OnSLOTargetGet                   func(*empire.App) (*empire.DeployFrequencyTarget, error)
+	OnSLOEvaluate                    func(*empire.App) (*empire.SLOReport, error)
+	OnStartSLOController             func(context.Context)
+	OnMigrateApps                    func(context.Context, service.Manager, service.Manager) (*empire.MigrationReport, error)
+	OnConfigureTelemetry             func(context.Context, empire.TelemetryOptions) error
+	OnBackup                         func(context.Context, io.Writer) error
+	OnRestore                        func(context.Context, io.Reader) (*empire.RestoreReport, error)
+	OnReset                          func() error
+	OnIsHealthy                      func() bool
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ empire.EmpireInterface = (*FakeEmpire)(nil)
+
+// Calls returns the calls that have been made to the FakeEmpire, in order.
+func (f *FakeEmpire) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Call(nil), f.calls...)
+}
+
+func (f *FakeEmpire) record(method string, args ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+}
+
+// AccessTokensFind records the call, then calls OnAccessTokensFind if it's set.
+func (f *FakeEmpire) AccessTokensFind(token string) (r0 *empire.AccessToken, r1 error) {
+	f.record("AccessTokensFind", token)
+	if f.OnAccessTokensFind != nil {
+		return f.OnAccessTokensFind(token)
+	}
+	return
+}
+
+// AccessTokensCreate records the call, then calls OnAccessTokensCreate if it's set.
+func (f *FakeEmpire) AccessTokensCreate(accessToken *empire.AccessToken) (r0 *empire.AccessToken, r1 error) {
+	f.record("AccessTokensCreate", accessToken)
+	if f.OnAccessTokensCreate != nil {
+		return f.OnAccessTokensCreate(accessToken)
+	}
+	return
+}
+
+// AccessTokensList records the call, then calls OnAccessTokensList if it's set.
+func (f *FakeEmpire) AccessTokensList(ctx context.Context, page empire.Page) (r0 []*empire.AccessToken, r1 error) {
+	f.record("AccessTokensList", ctx, page)
+	if f.OnAccessTokensList != nil {
+		return f.OnAccessTokensList(ctx, page)
+	}
+	return
+}
+
+// AccessTokensRequireScope records the call, then calls OnAccessTokensRequireScope if it's set.
+func (f *FakeEmpire) AccessTokensRequireScope(ctx context.Context, scope string) (r0 error) {
+	f.record("AccessTokensRequireScope", ctx, scope)
+	if f.OnAccessTokensRequireScope != nil {
+		return f.OnAccessTokensRequireScope(ctx, scope)
+	}
+	return
+}
+
+// AccessTokensMigrateToNewSecret records the call, then calls OnAccessTokensMigrateToNewSecret if it's set.
+func (f *FakeEmpire) AccessTokensMigrateToNewSecret(oldSecret, newSecret []byte) (r0 int, r1 error) {
+	f.record("AccessTokensMigrateToNewSecret", oldSecret, newSecret)
+	if f.OnAccessTokensMigrateToNewSecret != nil {
+		return f.OnAccessTokensMigrateToNewSecret(oldSecret, newSecret)
+	}
+	return
+}
+
+// AppsFirst records the call, then calls OnAppsFirst if it's set.
+func (f *FakeEmpire) AppsFirst(q empire.AppsQuery) (r0 *empire.App, r1 error) {
+	f.record("AppsFirst", q)
+	if f.OnAppsFirst != nil {
+		return f.OnAppsFirst(q)
+	}
+	return
+}
+
+// Apps records the call, then calls OnApps if it's set.
+func (f *FakeEmpire) Apps(q empire.AppsQuery) (r0 []*empire.App, r1 error) {
+	f.record("Apps", q)
+	if f.OnApps != nil {
+		return f.OnApps(q)
+	}
+	return
+}
+
+// AppsAllBySlug records the call, then calls OnAppsAllBySlug if it's set.
+func (f *FakeEmpire) AppsAllBySlug(slug *empire.Slug) (r0 []*empire.App, r1 error) {
+	f.record("AppsAllBySlug", slug)
+	if f.OnAppsAllBySlug != nil {
+		return f.OnAppsAllBySlug(slug)
+	}
+	return
+}
+
+// AppsCreate records the call, then calls OnAppsCreate if it's set.
+func (f *FakeEmpire) AppsCreate(app *empire.App) (r0 *empire.App, r1 error) {
+	f.record("AppsCreate", app)
+	if f.OnAppsCreate != nil {
+		return f.OnAppsCreate(app)
+	}
+	return
+}
+
+// AppsCreateWithConfig records the call, then calls OnAppsCreateWithConfig if it's set.
+func (f *FakeEmpire) AppsCreateWithConfig(ctx context.Context, app *empire.App, vars empire.Vars) (r0 *empire.App, r1 *empire.Config, r2 error) {
+	f.record("AppsCreateWithConfig", ctx, app, vars)
+	if f.OnAppsCreateWithConfig != nil {
+		return f.OnAppsCreateWithConfig(ctx, app, vars)
+	}
+	return
+}
+
+// AppsSetDeployStrategy records the call, then calls OnAppsSetDeployStrategy if it's set.
+func (f *FakeEmpire) AppsSetDeployStrategy(app *empire.App, strategy string) (r0 error) {
+	f.record("AppsSetDeployStrategy", app, strategy)
+	if f.OnAppsSetDeployStrategy != nil {
+		return f.OnAppsSetDeployStrategy(app, strategy)
+	}
+	return
+}
+
+// AppsSetDrainTimeout records the call, then calls OnAppsSetDrainTimeout if it's set.
+func (f *FakeEmpire) AppsSetDrainTimeout(app *empire.App, seconds int) (r0 error) {
+	f.record("AppsSetDrainTimeout", app, seconds)
+	if f.OnAppsSetDrainTimeout != nil {
+		return f.OnAppsSetDrainTimeout(app, seconds)
+	}
+	return
+}
+
+// AppsSetValidateCommand records the call, then calls OnAppsSetValidateCommand if it's set.
+func (f *FakeEmpire) AppsSetValidateCommand(ctx context.Context, app *empire.App, cmd string) (r0 error) {
+	f.record("AppsSetValidateCommand", ctx, app, cmd)
+	if f.OnAppsSetValidateCommand != nil {
+		return f.OnAppsSetValidateCommand(ctx, app, cmd)
+	}
+	return
+}
+
+// AppsAllCursor records the call, then calls OnAppsAllCursor if it's set.
+func (f *FakeEmpire) AppsAllCursor(cursor string, limit int) (r0 []*empire.App, r1 string, r2 error) {
+	f.record("AppsAllCursor", cursor, limit)
+	if f.OnAppsAllCursor != nil {
+		return f.OnAppsAllCursor(cursor, limit)
+	}
+	return
+}
+
+// AppsAllWithLastRelease records the call, then calls OnAppsAllWithLastRelease if it's set.
+func (f *FakeEmpire) AppsAllWithLastRelease(page empire.Page) (r0 []*empire.AppWithLastRelease, r1 error) {
+	f.record("AppsAllWithLastRelease", page)
+	if f.OnAppsAllWithLastRelease != nil {
+		return f.OnAppsAllWithLastRelease(page)
+	}
+	return
+}
+
+// AppsAllWithHealth records the call, then calls OnAppsAllWithHealth if it's set.
+func (f *FakeEmpire) AppsAllWithHealth(ctx context.Context, page empire.Page) (r0 []*empire.AppWithHealth, r1 error) {
+	f.record("AppsAllWithHealth", ctx, page)
+	if f.OnAppsAllWithHealth != nil {
+		return f.OnAppsAllWithHealth(ctx, page)
+	}
+	return
+}
+
+// ClusterJobHealthSummary records the call, then calls OnClusterJobHealthSummary if it's set.
+func (f *FakeEmpire) ClusterJobHealthSummary(ctx context.Context) (r0 *empire.ClusterHealthReport, r1 error) {
+	f.record("ClusterJobHealthSummary", ctx)
+	if f.OnClusterJobHealthSummary != nil {
+		return f.OnClusterJobHealthSummary(ctx)
+	}
+	return
+}
+
+// AppsAnnotate records the call, then calls OnAppsAnnotate if it's set.
+func (f *FakeEmpire) AppsAnnotate(app *empire.App, key string, value string) (r0 error) {
+	f.record("AppsAnnotate", app, key, value)
+	if f.OnAppsAnnotate != nil {
+		return f.OnAppsAnnotate(app, key, value)
+	}
+	return
+}
+
+// AppsAnnotations records the call, then calls OnAppsAnnotations if it's set.
+func (f *FakeEmpire) AppsAnnotations(app *empire.App) (r0 map[string]string, r1 error) {
+	f.record("AppsAnnotations", app)
+	if f.OnAppsAnnotations != nil {
+		return f.OnAppsAnnotations(app)
+	}
+	return
+}
+
+// AppsDiscoverByLabel records the call, then calls OnAppsDiscoverByLabel if it's set.
+func (f *FakeEmpire) AppsDiscoverByLabel(key string, value string) (r0 []*empire.App, r1 error) {
+	f.record("AppsDiscoverByLabel", key, value)
+	if f.OnAppsDiscoverByLabel != nil {
+		return f.OnAppsDiscoverByLabel(key, value)
+	}
+	return
+}
+
+// AppsDiscoverByLabelPrefix records the call, then calls OnAppsDiscoverByLabelPrefix if it's set.
+func (f *FakeEmpire) AppsDiscoverByLabelPrefix(key string) (r0 []*empire.App, r1 error) {
+	f.record("AppsDiscoverByLabelPrefix", key)
+	if f.OnAppsDiscoverByLabelPrefix != nil {
+		return f.OnAppsDiscoverByLabelPrefix(key)
+	}
+	return
+}
+
+// AppsDestroy records the call, then calls OnAppsDestroy if it's set.
+func (f *FakeEmpire) AppsDestroy(ctx context.Context, app *empire.App) (r0 error) {
+	f.record("AppsDestroy", ctx, app)
+	if f.OnAppsDestroy != nil {
+		return f.OnAppsDestroy(ctx, app)
+	}
+	return
+}
+
+// AppsDestroyVerify records the call, then calls OnAppsDestroyVerify if it's set.
+func (f *FakeEmpire) AppsDestroyVerify(ctx context.Context, app *empire.App, timeout time.Duration) (r0 error) {
+	f.record("AppsDestroyVerify", ctx, app, timeout)
+	if f.OnAppsDestroyVerify != nil {
+		return f.OnAppsDestroyVerify(ctx, app, timeout)
+	}
+	return
+}
+
+// AppsDestroyForce records the call, then calls OnAppsDestroyForce if it's set.
+func (f *FakeEmpire) AppsDestroyForce(ctx context.Context, app *empire.App) (r0 error) {
+	f.record("AppsDestroyForce", ctx, app)
+	if f.OnAppsDestroyForce != nil {
+		return f.OnAppsDestroyForce(ctx, app)
+	}
+	return
+}
+
+// AppsDestroyScheduled records the call, then calls OnAppsDestroyScheduled if it's set.
+func (f *FakeEmpire) AppsDestroyScheduled(ctx context.Context, app *empire.App, destroyAfter time.Duration) (r0 *empire.PendingDestroy, r1 error) {
+	f.record("AppsDestroyScheduled", ctx, app, destroyAfter)
+	if f.OnAppsDestroyScheduled != nil {
+		return f.OnAppsDestroyScheduled(ctx, app, destroyAfter)
+	}
+	return
+}
+
+// AppsDestroyCancelScheduled records the call, then calls OnAppsDestroyCancelScheduled if it's set.
+func (f *FakeEmpire) AppsDestroyCancelScheduled(ctx context.Context, pendingID string) (r0 error) {
+	f.record("AppsDestroyCancelScheduled", ctx, pendingID)
+	if f.OnAppsDestroyCancelScheduled != nil {
+		return f.OnAppsDestroyCancelScheduled(ctx, pendingID)
+	}
+	return
+}
+
+// AppsDestroySweep records the call, then calls OnAppsDestroySweep if it's set.
+func (f *FakeEmpire) AppsDestroySweep(ctx context.Context) (r0 error) {
+	f.record("AppsDestroySweep", ctx)
+	if f.OnAppsDestroySweep != nil {
+		return f.OnAppsDestroySweep(ctx)
+	}
+	return
+}
+
+// CertificatesFirst records the call, then calls OnCertificatesFirst if it's set.
+func (f *FakeEmpire) CertificatesFirst(ctx context.Context, q empire.CertificatesQuery) (r0 *empire.Certificate, r1 error) {
+	f.record("CertificatesFirst", ctx, q)
+	if f.OnCertificatesFirst != nil {
+		return f.OnCertificatesFirst(ctx, q)
+	}
+	return
+}
+
+// CertificatesCreate records the call, then calls OnCertificatesCreate if it's set.
+func (f *FakeEmpire) CertificatesCreate(ctx context.Context, cert *empire.Certificate) (r0 *empire.Certificate, r1 error) {
+	f.record("CertificatesCreate", ctx, cert)
+	if f.OnCertificatesCreate != nil {
+		return f.OnCertificatesCreate(ctx, cert)
+	}
+	return
+}
+
+// CertificatesUpdate records the call, then calls OnCertificatesUpdate if it's set.
+func (f *FakeEmpire) CertificatesUpdate(ctx context.Context, cert *empire.Certificate) (r0 *empire.Certificate, r1 error) {
+	f.record("CertificatesUpdate", ctx, cert)
+	if f.OnCertificatesUpdate != nil {
+		return f.OnCertificatesUpdate(ctx, cert)
+	}
+	return
+}
+
+// CertificatesDestroy records the call, then calls OnCertificatesDestroy if it's set.
+func (f *FakeEmpire) CertificatesDestroy(ctx context.Context, cert *empire.Certificate) (r0 error) {
+	f.record("CertificatesDestroy", ctx, cert)
+	if f.OnCertificatesDestroy != nil {
+		return f.OnCertificatesDestroy(ctx, cert)
+	}
+	return
+}
+
+// ConfigsCurrent records the call, then calls OnConfigsCurrent if it's set.
+func (f *FakeEmpire) ConfigsCurrent(app *empire.App) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsCurrent", app)
+	if f.OnConfigsCurrent != nil {
+		return f.OnConfigsCurrent(app)
+	}
+	return
+}
+
+// ConfigsCurrentWithResolved records the call, then calls OnConfigsCurrentWithResolved if it's set.
+func (f *FakeEmpire) ConfigsCurrentWithResolved(ctx context.Context, app *empire.App) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsCurrentWithResolved", ctx, app)
+	if f.OnConfigsCurrentWithResolved != nil {
+		return f.OnConfigsCurrentWithResolved(ctx, app)
+	}
+	return
+}
+
+// ConfigsFindByVersion records the call, then calls OnConfigsFindByVersion if it's set.
+func (f *FakeEmpire) ConfigsFindByVersion(app *empire.App, version int) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsFindByVersion", app, version)
+	if f.OnConfigsFindByVersion != nil {
+		return f.OnConfigsFindByVersion(app, version)
+	}
+	return
+}
+
+// ConfigsHistory records the call, then calls OnConfigsHistory if it's set.
+func (f *FakeEmpire) ConfigsHistory(app *empire.App, page empire.Page) (r0 []*empire.Config, r1 error) {
+	f.record("ConfigsHistory", app, page)
+	if f.OnConfigsHistory != nil {
+		return f.OnConfigsHistory(app, page)
+	}
+	return
+}
+
+// ConfigsKeySetTTL records the call, then calls OnConfigsKeySetTTL if it's set.
+func (f *FakeEmpire) ConfigsKeySetTTL(app *empire.App, key string, ttl time.Duration) (r0 error) {
+	f.record("ConfigsKeySetTTL", app, key, ttl)
+	if f.OnConfigsKeySetTTL != nil {
+		return f.OnConfigsKeySetTTL(app, key, ttl)
+	}
+	return
+}
+
+// ConfigDefaultsSet records the call, then calls OnConfigDefaultsSet if it's set.
+func (f *FakeEmpire) ConfigDefaultsSet(defaults empire.Vars) (r0 error) {
+	f.record("ConfigDefaultsSet", defaults)
+	if f.OnConfigDefaultsSet != nil {
+		return f.OnConfigDefaultsSet(defaults)
+	}
+	return
+}
+
+// ConfigDefaultsGet records the call, then calls OnConfigDefaultsGet if it's set.
+func (f *FakeEmpire) ConfigDefaultsGet() (r0 empire.Vars, r1 error) {
+	f.record("ConfigDefaultsGet")
+	if f.OnConfigDefaultsGet != nil {
+		return f.OnConfigDefaultsGet()
+	}
+	return
+}
+
+// ConfigsDiffByID records the call, then calls OnConfigsDiffByID if it's set.
+func (f *FakeEmpire) ConfigsDiffByID(fromID string, toID string) (r0 empire.ConfigChangeset, r1 error) {
+	f.record("ConfigsDiffByID", fromID, toID)
+	if f.OnConfigsDiffByID != nil {
+		return f.OnConfigsDiffByID(fromID, toID)
+	}
+	return
+}
+
+// ConfigsApply records the call, then calls OnConfigsApply if it's set.
+func (f *FakeEmpire) ConfigsApply(ctx context.Context, app *empire.App, vars empire.Vars) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsApply", ctx, app, vars)
+	if f.OnConfigsApply != nil {
+		return f.OnConfigsApply(ctx, app, vars)
+	}
+	return
+}
+
+// ConfigsApplyIfChanged records the call, then calls OnConfigsApplyIfChanged if it's set.
+func (f *FakeEmpire) ConfigsApplyIfChanged(ctx context.Context, app *empire.App, vars empire.Vars) (r0 *empire.Config, r1 bool, r2 error) {
+	f.record("ConfigsApplyIfChanged", ctx, app, vars)
+	if f.OnConfigsApplyIfChanged != nil {
+		return f.OnConfigsApplyIfChanged(ctx, app, vars)
+	}
+	return
+}
+
+// ConfigsApplyOrdered records the call, then calls OnConfigsApplyOrdered if it's set.
+func (f *FakeEmpire) ConfigsApplyOrdered(ctx context.Context, app *empire.App, vars empire.Vars, order []string) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsApplyOrdered", ctx, app, vars, order)
+	if f.OnConfigsApplyOrdered != nil {
+		return f.OnConfigsApplyOrdered(ctx, app, vars, order)
+	}
+	return
+}
+
+// ConfigsApplyFromYAML records the call, then calls OnConfigsApplyFromYAML if it's set.
+func (f *FakeEmpire) ConfigsApplyFromYAML(ctx context.Context, app *empire.App, r io.Reader) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsApplyFromYAML", ctx, app, r)
+	if f.OnConfigsApplyFromYAML != nil {
+		return f.OnConfigsApplyFromYAML(ctx, app, r)
+	}
+	return
+}
+
+// ConfigsApplyFromDotenv records the call, then calls OnConfigsApplyFromDotenv if it's set.
+func (f *FakeEmpire) ConfigsApplyFromDotenv(ctx context.Context, app *empire.App, r io.Reader) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsApplyFromDotenv", ctx, app, r)
+	if f.OnConfigsApplyFromDotenv != nil {
+		return f.OnConfigsApplyFromDotenv(ctx, app, r)
+	}
+	return
+}
+
+// ConfigsApplyWithHistory records the call, then calls OnConfigsApplyWithHistory if it's set.
+func (f *FakeEmpire) ConfigsApplyWithHistory(ctx context.Context, app *empire.App, changes []empire.KeyValueChange) (r0 []*empire.Config, r1 error) {
+	f.record("ConfigsApplyWithHistory", ctx, app, changes)
+	if f.OnConfigsApplyWithHistory != nil {
+		return f.OnConfigsApplyWithHistory(ctx, app, changes)
+	}
+	return
+}
+
+// ConfigsApplyAtomic records the call, then calls OnConfigsApplyAtomic if it's set.
+func (f *FakeEmpire) ConfigsApplyAtomic(ctx context.Context, updates map[string]empire.Vars) (r0 map[string]*empire.Config, r1 error) {
+	f.record("ConfigsApplyAtomic", ctx, updates)
+	if f.OnConfigsApplyAtomic != nil {
+		return f.OnConfigsApplyAtomic(ctx, updates)
+	}
+	return
+}
+
+// ConfigsDriftReport records the call, then calls OnConfigsDriftReport if it's set.
+func (f *FakeEmpire) ConfigsDriftReport(app *empire.App, reference empire.Vars) (r0 *empire.DriftReport, r1 error) {
+	f.record("ConfigsDriftReport", app, reference)
+	if f.OnConfigsDriftReport != nil {
+		return f.OnConfigsDriftReport(app, reference)
+	}
+	return
+}
+
+// ConfigsFreeze records the call, then calls OnConfigsFreeze if it's set.
+func (f *FakeEmpire) ConfigsFreeze(configID string) (r0 error) {
+	f.record("ConfigsFreeze", configID)
+	if f.OnConfigsFreeze != nil {
+		return f.OnConfigsFreeze(configID)
+	}
+	return
+}
+
+// ConfigsUnfreeze records the call, then calls OnConfigsUnfreeze if it's set.
+func (f *FakeEmpire) ConfigsUnfreeze(configID string) (r0 error) {
+	f.record("ConfigsUnfreeze", configID)
+	if f.OnConfigsUnfreeze != nil {
+		return f.OnConfigsUnfreeze(configID)
+	}
+	return
+}
+
+// ConfigsMerge records the call, then calls OnConfigsMerge if it's set.
+func (f *FakeEmpire) ConfigsMerge(ctx context.Context, app *empire.App, baseConfigID string, overrideConfigID string) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsMerge", ctx, app, baseConfigID, overrideConfigID)
+	if f.OnConfigsMerge != nil {
+		return f.OnConfigsMerge(ctx, app, baseConfigID, overrideConfigID)
+	}
+	return
+}
+
+// ConfigsCopyFromApp records the call, then calls OnConfigsCopyFromApp if it's set.
+func (f *FakeEmpire) ConfigsCopyFromApp(ctx context.Context, src *empire.App, dst *empire.App, excludeKeys []string) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsCopyFromApp", ctx, src, dst, excludeKeys)
+	if f.OnConfigsCopyFromApp != nil {
+		return f.OnConfigsCopyFromApp(ctx, src, dst, excludeKeys)
+	}
+	return
+}
+
+// ConfigsApplyDeltaFromRelease records the call, then calls OnConfigsApplyDeltaFromRelease if it's set.
+func (f *FakeEmpire) ConfigsApplyDeltaFromRelease(ctx context.Context, dstApp *empire.App, srcApp *empire.App, srcVersion int) (r0 *empire.Config, r1 error) {
+	f.record("ConfigsApplyDeltaFromRelease", ctx, dstApp, srcApp, srcVersion)
+	if f.OnConfigsApplyDeltaFromRelease != nil {
+		return f.OnConfigsApplyDeltaFromRelease(ctx, dstApp, srcApp, srcVersion)
+	}
+	return
+}
+
+// DomainsFirst records the call, then calls OnDomainsFirst if it's set.
+func (f *FakeEmpire) DomainsFirst(q empire.DomainsQuery) (r0 *empire.Domain, r1 error) {
+	f.record("DomainsFirst", q)
+	if f.OnDomainsFirst != nil {
+		return f.OnDomainsFirst(q)
+	}
+	return
+}
+
+// Domains records the call, then calls OnDomains if it's set.
+func (f *FakeEmpire) Domains(q empire.DomainsQuery) (r0 []*empire.Domain, r1 error) {
+	f.record("Domains", q)
+	if f.OnDomains != nil {
+		return f.OnDomains(q)
+	}
+	return
+}
+
+// DomainsCreate records the call, then calls OnDomainsCreate if it's set.
+func (f *FakeEmpire) DomainsCreate(domain *empire.Domain) (r0 *empire.Domain, r1 error) {
+	f.record("DomainsCreate", domain)
+	if f.OnDomainsCreate != nil {
+		return f.OnDomainsCreate(domain)
+	}
+	return
+}
+
+// DomainsDestroy records the call, then calls OnDomainsDestroy if it's set.
+func (f *FakeEmpire) DomainsDestroy(domain *empire.Domain) (r0 error) {
+	f.record("DomainsDestroy", domain)
+	if f.OnDomainsDestroy != nil {
+		return f.OnDomainsDestroy(domain)
+	}
+	return
+}
+
+// FeatureFlag records the call, then calls OnFeatureFlag if it's set.
+func (f *FakeEmpire) FeatureFlag(app *empire.App, name string) (r0 bool, r1 error) {
+	f.record("FeatureFlag", app, name)
+	if f.OnFeatureFlag != nil {
+		return f.OnFeatureFlag(app, name)
+	}
+	return
+}
+
+// FeatureFlagSet records the call, then calls OnFeatureFlagSet if it's set.
+func (f *FakeEmpire) FeatureFlagSet(ctx context.Context, app *empire.App, name string, enabled bool) (r0 *empire.Config, r1 error) {
+	f.record("FeatureFlagSet", ctx, app, name, enabled)
+	if f.OnFeatureFlagSet != nil {
+		return f.OnFeatureFlagSet(ctx, app, name, enabled)
+	}
+	return
+}
+
+// FeatureFlagsAll records the call, then calls OnFeatureFlagsAll if it's set.
+func (f *FakeEmpire) FeatureFlagsAll(app *empire.App) (r0 map[string]bool, r1 error) {
+	f.record("FeatureFlagsAll", app)
+	if f.OnFeatureFlagsAll != nil {
+		return f.OnFeatureFlagsAll(app)
+	}
+	return
+}
+
+// JobsByApp records the call, then calls OnJobsByApp if it's set.
+func (f *FakeEmpire) JobsByApp(app *empire.App) (r0 []*empire.Job, r1 error) {
+	f.record("JobsByApp", app)
+	if f.OnJobsByApp != nil {
+		return f.OnJobsByApp(app)
+	}
+	return
+}
+
+// JobStatesByApp records the call, then calls OnJobStatesByApp if it's set.
+func (f *FakeEmpire) JobStatesByApp(ctx context.Context, app *empire.App) (r0 []*empire.ProcessState, r1 error) {
+	f.record("JobStatesByApp", ctx, app)
+	if f.OnJobStatesByApp != nil {
+		return f.OnJobStatesByApp(ctx, app)
+	}
+	return
+}
+
+// JobStatesStream records the call, then calls OnJobStatesStream if it's set.
+func (f *FakeEmpire) JobStatesStream(ctx context.Context, app *empire.App, since time.Time) (r0 <-chan []*empire.ProcessState, r1 error) {
+	f.record("JobStatesStream", ctx, app, since)
+	if f.OnJobStatesStream != nil {
+		return f.OnJobStatesStream(ctx, app, since)
+	}
+	return
+}
+
+// ProcessTypesAll records the call, then calls OnProcessTypesAll if it's set.
+func (f *FakeEmpire) ProcessTypesAll(app *empire.App) (r0 []string, r1 error) {
+	f.record("ProcessTypesAll", app)
+	if f.OnProcessTypesAll != nil {
+		return f.OnProcessTypesAll(app)
+	}
+	return
+}
+
+// ProcessesAllSorted records the call, then calls OnProcessesAllSorted if it's set.
+func (f *FakeEmpire) ProcessesAllSorted(release *empire.Release) (r0 []*empire.Process, r1 error) {
+	f.record("ProcessesAllSorted", release)
+	if f.OnProcessesAllSorted != nil {
+		return f.OnProcessesAllSorted(release)
+	}
+	return
+}
+
+// ProcessesAllSortedByState records the call, then calls OnProcessesAllSortedByState if it's set.
+func (f *FakeEmpire) ProcessesAllSortedByState(ctx context.Context, app *empire.App) (r0 []empire.ProcessWithState, r1 error) {
+	f.record("ProcessesAllSortedByState", ctx, app)
+	if f.OnProcessesAllSortedByState != nil {
+		return f.OnProcessesAllSortedByState(ctx, app)
+	}
+	return
+}
+
+// ProcessesAllByJobState records the call, then calls OnProcessesAllByJobState if it's set.
+func (f *FakeEmpire) ProcessesAllByJobState(state string, page empire.Page) (r0 []*empire.JobStateSummary, r1 error) {
+	f.record("ProcessesAllByJobState", state, page)
+	if f.OnProcessesAllByJobState != nil {
+		return f.OnProcessesAllByJobState(state, page)
+	}
+	return
+}
+
+// AppsAllByJobState records the call, then calls OnAppsAllByJobState if it's set.
+func (f *FakeEmpire) AppsAllByJobState(state string) (r0 []*empire.App, r1 error) {
+	f.record("AppsAllByJobState", state)
+	if f.OnAppsAllByJobState != nil {
+		return f.OnAppsAllByJobState(state)
+	}
+	return
+}
+
+// JobStatesSnapshot records the call, then calls OnJobStatesSnapshot if it's set.
+func (f *FakeEmpire) JobStatesSnapshot(ctx context.Context, app *empire.App) (r0 error) {
+	f.record("JobStatesSnapshot", ctx, app)
+	if f.OnJobStatesSnapshot != nil {
+		return f.OnJobStatesSnapshot(ctx, app)
+	}
+	return
+}
+
+// JobStatesByAppCached records the call, then calls OnJobStatesByAppCached if it's set.
+func (f *FakeEmpire) JobStatesByAppCached(ctx context.Context, app *empire.App, maxAge time.Duration) (r0 []*empire.ProcessState, r1 error) {
+	f.record("JobStatesByAppCached", ctx, app, maxAge)
+	if f.OnJobStatesByAppCached != nil {
+		return f.OnJobStatesByAppCached(ctx, app, maxAge)
+	}
+	return
+}
+
+// ProcessesGetMetrics records the call, then calls OnProcessesGetMetrics if it's set.
+func (f *FakeEmpire) ProcessesGetMetrics(ctx context.Context, app *empire.App) (r0 []empire.ProcessMetrics, r1 error) {
+	f.record("ProcessesGetMetrics", ctx, app)
+	if f.OnProcessesGetMetrics != nil {
+		return f.OnProcessesGetMetrics(ctx, app)
+	}
+	return
+}
+
+// ProcessesTop records the call, then calls OnProcessesTop if it's set.
+func (f *FakeEmpire) ProcessesTop(ctx context.Context, app *empire.App) (r0 []empire.ProcessTopEntry, r1 error) {
+	f.record("ProcessesTop", ctx, app)
+	if f.OnProcessesTop != nil {
+		return f.OnProcessesTop(ctx, app)
+	}
+	return
+}
+
+// ProcessesRestart records the call, then calls OnProcessesRestart if it's set.
+func (f *FakeEmpire) ProcessesRestart(ctx context.Context, app *empire.App, t empire.ProcessType, id string) (r0 error) {
+	f.record("ProcessesRestart", ctx, app, t, id)
+	if f.OnProcessesRestart != nil {
+		return f.OnProcessesRestart(ctx, app, t, id)
+	}
+	return
+}
+
+// ProcessesDrain records the call, then calls OnProcessesDrain if it's set.
+func (f *FakeEmpire) ProcessesDrain(ctx context.Context, app *empire.App, t empire.ProcessType, count int, timeout time.Duration) (r0 error) {
+	f.record("ProcessesDrain", ctx, app, t, count, timeout)
+	if f.OnProcessesDrain != nil {
+		return f.OnProcessesDrain(ctx, app, t, count, timeout)
+	}
+	return
+}
+
+// ProcessesRun records the call, then calls OnProcessesRun if it's set.
+func (f *FakeEmpire) ProcessesRun(ctx context.Context, app *empire.App, command string, opts empire.ProcessesRunOpts) (r0 *empire.ContainerRelay, r1 error) {
+	f.record("ProcessesRun", ctx, app, command, opts)
+	if f.OnProcessesRun != nil {
+		return f.OnProcessesRun(ctx, app, command, opts)
+	}
+	return
+}
+
+// ReleasesFindByApp records the call, then calls OnReleasesFindByApp if it's set.
+func (f *FakeEmpire) ReleasesFindByApp(app *empire.App) (r0 []*empire.Release, r1 error) {
+	f.record("ReleasesFindByApp", app)
+	if f.OnReleasesFindByApp != nil {
+		return f.OnReleasesFindByApp(app)
+	}
+	return
+}
+
+// ReleasesFindByAppWithDiff records the call, then calls OnReleasesFindByAppWithDiff if it's set.
+func (f *FakeEmpire) ReleasesFindByAppWithDiff(app *empire.App, page empire.Page) (r0 []*empire.Release, r1 error) {
+	f.record("ReleasesFindByAppWithDiff", app, page)
+	if f.OnReleasesFindByAppWithDiff != nil {
+		return f.OnReleasesFindByAppWithDiff(app, page)
+	}
+	return
+}
+
+// ReleasesFindByAppAndVersion records the call, then calls OnReleasesFindByAppAndVersion if it's set.
+func (f *FakeEmpire) ReleasesFindByAppAndVersion(app *empire.App, version int) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesFindByAppAndVersion", app, version)
+	if f.OnReleasesFindByAppAndVersion != nil {
+		return f.OnReleasesFindByAppAndVersion(app, version)
+	}
+	return
+}
+
+// ReleasesLast records the call, then calls OnReleasesLast if it's set.
+func (f *FakeEmpire) ReleasesLast(app *empire.App) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesLast", app)
+	if f.OnReleasesLast != nil {
+		return f.OnReleasesLast(app)
+	}
+	return
+}
+
+// ReleasesDeploy records the call, then calls OnReleasesDeploy if it's set.
+func (f *FakeEmpire) ReleasesDeploy(ctx context.Context, app *empire.App, config *empire.Config, slug *empire.Slug, desc string) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesDeploy", ctx, app, config, slug, desc)
+	if f.OnReleasesDeploy != nil {
+		return f.OnReleasesDeploy(ctx, app, config, slug, desc)
+	}
+	return
+}
+
+// ReleasesCreateDraft records the call, then calls OnReleasesCreateDraft if it's set.
+func (f *FakeEmpire) ReleasesCreateDraft(ctx context.Context, app *empire.App, config *empire.Config, slug *empire.Slug, desc string) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesCreateDraft", ctx, app, config, slug, desc)
+	if f.OnReleasesCreateDraft != nil {
+		return f.OnReleasesCreateDraft(ctx, app, config, slug, desc)
+	}
+	return
+}
+
+// ReleasesActivate records the call, then calls OnReleasesActivate if it's set.
+func (f *FakeEmpire) ReleasesActivate(ctx context.Context, release *empire.Release, approverEmail string) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesActivate", ctx, release, approverEmail)
+	if f.OnReleasesActivate != nil {
+		return f.OnReleasesActivate(ctx, release, approverEmail)
+	}
+	return
+}
+
+// ReleasesRequestApproval records the call, then calls OnReleasesRequestApproval if it's set.
+func (f *FakeEmpire) ReleasesRequestApproval(ctx context.Context, release *empire.Release, approvers []string) (r0 string, r1 error) {
+	f.record("ReleasesRequestApproval", ctx, release, approvers)
+	if f.OnReleasesRequestApproval != nil {
+		return f.OnReleasesRequestApproval(ctx, release, approvers)
+	}
+	return
+}
+
+// ReleasesApprove records the call, then calls OnReleasesApprove if it's set.
+func (f *FakeEmpire) ReleasesApprove(ctx context.Context, token string) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesApprove", ctx, token)
+	if f.OnReleasesApprove != nil {
+		return f.OnReleasesApprove(ctx, token)
+	}
+	return
+}
+
+// ReleasesReject records the call, then calls OnReleasesReject if it's set.
+func (f *FakeEmpire) ReleasesReject(ctx context.Context, token string, reason string) (r0 error) {
+	f.record("ReleasesReject", ctx, token, reason)
+	if f.OnReleasesReject != nil {
+		return f.OnReleasesReject(ctx, token, reason)
+	}
+	return
+}
+
+// ReleasesPromoteToStable records the call, then calls OnReleasesPromoteToStable if it's set.
+func (f *FakeEmpire) ReleasesPromoteToStable(ctx context.Context, app *empire.App, version int) (r0 error) {
+	f.record("ReleasesPromoteToStable", ctx, app, version)
+	if f.OnReleasesPromoteToStable != nil {
+		return f.OnReleasesPromoteToStable(ctx, app, version)
+	}
+	return
+}
+
+// ReleasesCompare records the call, then calls OnReleasesCompare if it's set.
+func (f *FakeEmpire) ReleasesCompare(app *empire.App, fromVersion int, toVersion int) (r0 *empire.ReleaseComparison, r1 error) {
+	f.record("ReleasesCompare", app, fromVersion, toVersion)
+	if f.OnReleasesCompare != nil {
+		return f.OnReleasesCompare(app, fromVersion, toVersion)
+	}
+	return
+}
+
+// ReleasesSearch records the call, then calls OnReleasesSearch if it's set.
+func (f *FakeEmpire) ReleasesSearch(query string, page empire.Page) (r0 []*empire.Release, r1 error) {
+	f.record("ReleasesSearch", query, page)
+	if f.OnReleasesSearch != nil {
+		return f.OnReleasesSearch(query, page)
+	}
+	return
+}
+
+// ReleasesFind records the call, then calls OnReleasesFind if it's set.
+func (f *FakeEmpire) ReleasesFind(query empire.ReleasesQuery) (r0 []*empire.Release, r1 error) {
+	f.record("ReleasesFind", query)
+	if f.OnReleasesFind != nil {
+		return f.OnReleasesFind(query)
+	}
+	return
+}
+
+// ReleasesRollback records the call, then calls OnReleasesRollback if it's set.
+func (f *FakeEmpire) ReleasesRollback(ctx context.Context, app *empire.App, version int) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesRollback", ctx, app, version)
+	if f.OnReleasesRollback != nil {
+		return f.OnReleasesRollback(ctx, app, version)
+	}
+	return
+}
+
+// ReleasesGraftConfig records the call, then calls OnReleasesGraftConfig if it's set.
+func (f *FakeEmpire) ReleasesGraftConfig(ctx context.Context, app *empire.App, version int, newConfigID string) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesGraftConfig", ctx, app, version, newConfigID)
+	if f.OnReleasesGraftConfig != nil {
+		return f.OnReleasesGraftConfig(ctx, app, version, newConfigID)
+	}
+	return
+}
+
+// ReleasesStream records the call, then calls OnReleasesStream if it's set.
+func (f *FakeEmpire) ReleasesStream(ctx context.Context, app *empire.App) (r0 <-chan empire.ReleaseEvent, r1 error) {
+	f.record("ReleasesStream", ctx, app)
+	if f.OnReleasesStream != nil {
+		return f.OnReleasesStream(ctx, app)
+	}
+	return
+}
+
+// ReleaseTagSet records the call, then calls OnReleaseTagSet if it's set.
+func (f *FakeEmpire) ReleaseTagSet(app *empire.App, release *empire.Release, tag string) (r0 error) {
+	f.record("ReleaseTagSet", app, release, tag)
+	if f.OnReleaseTagSet != nil {
+		return f.OnReleaseTagSet(app, release, tag)
+	}
+	return
+}
+
+// ReleaseTagGet records the call, then calls OnReleaseTagGet if it's set.
+func (f *FakeEmpire) ReleaseTagGet(app *empire.App, tag string) (r0 *empire.Release, r1 error) {
+	f.record("ReleaseTagGet", app, tag)
+	if f.OnReleaseTagGet != nil {
+		return f.OnReleaseTagGet(app, tag)
+	}
+	return
+}
+
+// ReleasesTagSearch records the call, then calls OnReleasesTagSearch if it's set.
+func (f *FakeEmpire) ReleasesTagSearch(app *empire.App, tagPattern string) (r0 []*empire.Release, r1 error) {
+	f.record("ReleasesTagSearch", app, tagPattern)
+	if f.OnReleasesTagSearch != nil {
+		return f.OnReleasesTagSearch(app, tagPattern)
+	}
+	return
+}
+
+// ReleasesTagAll records the call, then calls OnReleasesTagAll if it's set.
+func (f *FakeEmpire) ReleasesTagAll(app *empire.App) (r0 map[string]*empire.Release, r1 error) {
+	f.record("ReleasesTagAll", app)
+	if f.OnReleasesTagAll != nil {
+		return f.OnReleasesTagAll(app)
+	}
+	return
+}
+
+// ReleasesAutoTag records the call, then calls OnReleasesAutoTag if it's set.
+func (f *FakeEmpire) ReleasesAutoTag(app *empire.App, release *empire.Release) (r0 error) {
+	f.record("ReleasesAutoTag", app, release)
+	if f.OnReleasesAutoTag != nil {
+		return f.OnReleasesAutoTag(app, release)
+	}
+	return
+}
+
+// DeployImage records the call, then calls OnDeployImage if it's set.
+func (f *FakeEmpire) DeployImage(ctx context.Context, image empire.Image, out chan empire.Event) (r0 *empire.Release, r1 error) {
+	f.record("DeployImage", ctx, image, out)
+	if f.OnDeployImage != nil {
+		return f.OnDeployImage(ctx, image, out)
+	}
+	return
+}
+
+// DeployImageWithMetadata records the call, then calls OnDeployImageWithMetadata if it's set.
+func (f *FakeEmpire) DeployImageWithMetadata(ctx context.Context, image empire.Image, meta empire.ReleaseMetadata, out chan empire.Event) (r0 *empire.Release, r1 error) {
+	f.record("DeployImageWithMetadata", ctx, image, meta, out)
+	if f.OnDeployImageWithMetadata != nil {
+		return f.OnDeployImageWithMetadata(ctx, image, meta, out)
+	}
+	return
+}
+
+// ReleasesCreateFromImage records the call, then calls OnReleasesCreateFromImage if it's set.
+func (f *FakeEmpire) ReleasesCreateFromImage(ctx context.Context, appName string, image string, opts empire.DeployOptions) (r0 *empire.Release, r1 error) {
+	f.record("ReleasesCreateFromImage", ctx, appName, image, opts)
+	if f.OnReleasesCreateFromImage != nil {
+		return f.OnReleasesCreateFromImage(ctx, appName, image, opts)
+	}
+	return
+}
+
+// DeployCanary records the call, then calls OnDeployCanary if it's set.
+func (f *FakeEmpire) DeployCanary(ctx context.Context, image empire.Image, opts empire.CanaryOptions) (r0 *empire.Release, r1 error) {
+	f.record("DeployCanary", ctx, image, opts)
+	if f.OnDeployCanary != nil {
+		return f.OnDeployCanary(ctx, image, opts)
+	}
+	return
+}
+
+// PromoteCanary records the call, then calls OnPromoteCanary if it's set.
+func (f *FakeEmpire) PromoteCanary(ctx context.Context, app *empire.App) (r0 error) {
+	f.record("PromoteCanary", ctx, app)
+	if f.OnPromoteCanary != nil {
+		return f.OnPromoteCanary(ctx, app)
+	}
+	return
+}
+
+// RollbackCanary records the call, then calls OnRollbackCanary if it's set.
+func (f *FakeEmpire) RollbackCanary(ctx context.Context, app *empire.App) (r0 error) {
+	f.record("RollbackCanary", ctx, app)
+	if f.OnRollbackCanary != nil {
+		return f.OnRollbackCanary(ctx, app)
+	}
+	return
+}
+
+// FormationAtTime records the call, then calls OnFormationAtTime if it's set.
+func (f *FakeEmpire) FormationAtTime(app *empire.App, at time.Time) (r0 empire.Formation, r1 error) {
+	f.record("FormationAtTime", app, at)
+	if f.OnFormationAtTime != nil {
+		return f.OnFormationAtTime(app, at)
+	}
+	return
+}
+
+// AppsScale records the call, then calls OnAppsScale if it's set.
+func (f *FakeEmpire) AppsScale(ctx context.Context, app *empire.App, t empire.ProcessType, quantity int, c *empire.Constraints) (r0 *empire.Process, r1 error) {
+	f.record("AppsScale", ctx, app, t, quantity, c)
+	if f.OnAppsScale != nil {
+		return f.OnAppsScale(ctx, app, t, quantity, c)
+	}
+	return
+}
+
+// ProcessesScale records the call, then calls OnProcessesScale if it's set.
+func (f *FakeEmpire) ProcessesScale(ctx context.Context, app *empire.App, quantities map[string]int) (r0 *empire.Release, r1 error) {
+	f.record("ProcessesScale", ctx, app, quantities)
+	if f.OnProcessesScale != nil {
+		return f.OnProcessesScale(ctx, app, quantities)
+	}
+	return
+}
+
+// ProcessesSetCommand records the call, then calls OnProcessesSetCommand if it's set.
+func (f *FakeEmpire) ProcessesSetCommand(ctx context.Context, app *empire.App, processType string, command string) (r0 *empire.Release, r1 error) {
+	f.record("ProcessesSetCommand", ctx, app, processType, command)
+	if f.OnProcessesSetCommand != nil {
+		return f.OnProcessesSetCommand(ctx, app, processType, command)
+	}
+	return
+}
+
+// ScaleReleaseJSONPatch records the call, then calls OnScaleReleaseJSONPatch if it's set.
+func (f *FakeEmpire) ScaleReleaseJSONPatch(ctx context.Context, app *empire.App, patch []byte) (r0 *empire.Release, r1 error) {
+	f.record("ScaleReleaseJSONPatch", ctx, app, patch)
+	if f.OnScaleReleaseJSONPatch != nil {
+		return f.OnScaleReleaseJSONPatch(ctx, app, patch)
+	}
+	return
+}
+
+// UsageReport records the call, then calls OnUsageReport if it's set.
+func (f *FakeEmpire) UsageReport(ctx context.Context, app *empire.App, since time.Time, until time.Time) (r0 []*empire.AppUsageReport, r1 error) {
+	f.record("UsageReport", ctx, app, since, until)
+	if f.OnUsageReport != nil {
+		return f.OnUsageReport(ctx, app, since, until)
+	}
+	return
+}
+
+// UsageReportAll records the call, then calls OnUsageReportAll if it's set.
+func (f *FakeEmpire) UsageReportAll(ctx context.Context, since time.Time, until time.Time) (r0 []*empire.AppUsageReport, r1 error) {
+	f.record("UsageReportAll", ctx, since, until)
+	if f.OnUsageReportAll != nil {
+		return f.OnUsageReportAll(ctx, since, until)
+	}
+	return
+}
+
+// SlugsCreateFromDockerfile records the call, then calls OnSlugsCreateFromDockerfile if it's set.
+func (f *FakeEmpire) SlugsCreateFromDockerfile(ctx context.Context, app *empire.App, buildContext io.Reader, buildOpts docker.BuildImageOptions) (r0 *empire.Slug, r1 error) {
+	f.record("SlugsCreateFromDockerfile", ctx, app, buildContext, buildOpts)
+	if f.OnSlugsCreateFromDockerfile != nil {
+		return f.OnSlugsCreateFromDockerfile(ctx, app, buildContext, buildOpts)
+	}
+	return
+}
+
+// SlugsBuildFromSource records the call, then calls OnSlugsBuildFromSource if it's set.
+func (f *FakeEmpire) SlugsBuildFromSource(ctx context.Context, app *empire.App, gitURL string, ref string, buildArgs map[string]string, w io.Writer) (r0 *empire.Slug, r1 error) {
+	f.record("SlugsBuildFromSource", ctx, app, gitURL, ref, buildArgs, w)
+	if f.OnSlugsBuildFromSource != nil {
+		return f.OnSlugsBuildFromSource(ctx, app, gitURL, ref, buildArgs, w)
+	}
+	return
+}
+
+// SlugsCreateFromCompose records the call, then calls OnSlugsCreateFromCompose if it's set.
+func (f *FakeEmpire) SlugsCreateFromCompose(ctx context.Context, app *empire.App, r io.Reader, overrides empire.ComposeOverrides) (r0 []*empire.Slug, r1 error) {
+	f.record("SlugsCreateFromCompose", ctx, app, r, overrides)
+	if f.OnSlugsCreateFromCompose != nil {
+		return f.OnSlugsCreateFromCompose(ctx, app, r, overrides)
+	}
+	return
+}
+
+// DeployFromTarball records the call, then calls OnDeployFromTarball if it's set.
+func (f *FakeEmpire) DeployFromTarball(ctx context.Context, app *empire.App, tarURL string, opts empire.TarballDeployOptions) (r0 *empire.Release, r1 error) {
+	f.record("DeployFromTarball", ctx, app, tarURL, opts)
+	if f.OnDeployFromTarball != nil {
+		return f.OnDeployFromTarball(ctx, app, tarURL, opts)
+	}
+	return
+}
+
+// SlugsGC records the call, then calls OnSlugsGC if it's set.
+func (f *FakeEmpire) SlugsGC(ctx context.Context) (r0 int, r1 error) {
+	f.record("SlugsGC", ctx)
+	if f.OnSlugsGC != nil {
+		return f.OnSlugsGC(ctx)
+	}
+	return
+}
+
+// StartGarbageCollector records the call, then calls OnStartGarbageCollector if it's set.
+func (f *FakeEmpire) StartGarbageCollector(ctx context.Context, interval time.Duration) {
+	f.record("StartGarbageCollector", ctx, interval)
+	if f.OnStartGarbageCollector != nil {
+		f.OnStartGarbageCollector(ctx, interval)
+	}
+}
+
+// CrashLoopPoliciesSet records the call, then calls OnCrashLoopPoliciesSet if it's set.
+func (f *FakeEmpire) CrashLoopPoliciesSet(app *empire.App, processType string, policy empire.CrashLoopPolicy) (r0 error) {
+	f.record("CrashLoopPoliciesSet", app, processType, policy)
+	if f.OnCrashLoopPoliciesSet != nil {
+		return f.OnCrashLoopPoliciesSet(app, processType, policy)
+	}
+	return
+}
+
+// StartAppsDestroySweeper records the call, then calls OnStartAppsDestroySweeper if it's set.
+func (f *FakeEmpire) StartAppsDestroySweeper(ctx context.Context) {
+	f.record("StartAppsDestroySweeper", ctx)
+	if f.OnStartAppsDestroySweeper != nil {
+		f.OnStartAppsDestroySweeper(ctx)
+	}
+}
+
+// StartCrashLoopDetector records the call, then calls OnStartCrashLoopDetector if it's set.
+func (f *FakeEmpire) StartCrashLoopDetector(ctx context.Context) {
+	f.record("StartCrashLoopDetector", ctx)
+	if f.OnStartCrashLoopDetector != nil {
+		f.OnStartCrashLoopDetector(ctx)
+	}
+}
+
+// StartWebhookRetrier records the call, then calls OnStartWebhookRetrier if it's set.
+func (f *FakeEmpire) StartWebhookRetrier(ctx context.Context) {
+	f.record("StartWebhookRetrier", ctx)
+	if f.OnStartWebhookRetrier != nil {
+		f.OnStartWebhookRetrier(ctx)
+	}
+}
+
+// StartConfigKeyExpirer records the call, then calls OnStartConfigKeyExpirer if it's set.
+func (f *FakeEmpire) StartConfigKeyExpirer(ctx context.Context) {
+	f.record("StartConfigKeyExpirer", ctx)
+	if f.OnStartConfigKeyExpirer != nil {
+		f.OnStartConfigKeyExpirer(ctx)
+	}
+}
+
+// ConfigKeysExpire records the call, then calls OnConfigKeysExpire if it's set.
+func (f *FakeEmpire) ConfigKeysExpire(ctx context.Context) (r0 error) {
+	f.record("ConfigKeysExpire", ctx)
+	if f.OnConfigKeysExpire != nil {
+		return f.OnConfigKeysExpire(ctx)
+	}
+	return
+}
+
+// WebhookDeliveriesRetry records the call, then calls OnWebhookDeliveriesRetry if it's set.
+func (f *FakeEmpire) WebhookDeliveriesRetry(ctx context.Context) (r0 error) {
+	f.record("WebhookDeliveriesRetry", ctx)
+	if f.OnWebhookDeliveriesRetry != nil {
+		return f.OnWebhookDeliveriesRetry(ctx)
+	}
+	return
+}
+
+// WebhookDeliveryAttempts records the call, then calls OnWebhookDeliveryAttempts if it's set.
+func (f *FakeEmpire) WebhookDeliveryAttempts(status string) (r0 []*empire.WebhookDeliveryAttempt, r1 error) {
+	f.record("WebhookDeliveryAttempts", status)
+	if f.OnWebhookDeliveryAttempts != nil {
+		return f.OnWebhookDeliveryAttempts(status)
+	}
+	return
+}
+
+// StoreMode records the call, then calls OnStoreMode if it's set.
+func (f *FakeEmpire) StoreMode() (r0 empire.StoreMode) {
+	f.record("StoreMode")
+	if f.OnStoreMode != nil {
+		return f.OnStoreMode()
+	}
+	return
+}
+
+// StartStoreMonitor records the call, then calls OnStartStoreMonitor if it's set.
+func (f *FakeEmpire) StartStoreMonitor(ctx context.Context) {
+	f.record("StartStoreMonitor", ctx)
+	if f.OnStartStoreMonitor != nil {
+		f.OnStartStoreMonitor(ctx)
+	}
+}
+
+// SLOTargetSet records the call, then calls OnSLOTargetSet if it's set.
+func (f *FakeEmpire) SLOTargetSet(app *empire.App, target empire.DeployFrequencyTarget) (r0 *empire.DeployFrequencyTarget, r1 error) {
+	f.record("SLOTargetSet", app, target)
+	if f.OnSLOTargetSet != nil {
+		return f.OnSLOTargetSet(app, target)
+	}
+	return
+}
+
+// SLOTargetGet records the call, then calls OnSLOTargetGet if it's set.
+func (f *FakeEmpire) SLOTargetGet(app *empire.App) (r0 *empire.DeployFrequencyTarget, r1 error) {
+	f.record("SLOTargetGet", app)
+	if f.OnSLOTargetGet != nil {
+		return f.OnSLOTargetGet(app)
+	}
+	return
+}
+
+// SLOEvaluate records the call, then calls OnSLOEvaluate if it's set.
+func (f *FakeEmpire) SLOEvaluate(app *empire.App) (r0 *empire.SLOReport, r1 error) {
+	f.record("SLOEvaluate", app)
+	if f.OnSLOEvaluate != nil {
+		return f.OnSLOEvaluate(app)
+	}
+	return
+}
+
+// StartSLOController records the call, then calls OnStartSLOController if it's set.
+func (f *FakeEmpire) StartSLOController(ctx context.Context) {
+	f.record("StartSLOController", ctx)
+	if f.OnStartSLOController != nil {
+		f.OnStartSLOController(ctx)
+	}
+}
+
+// MigrateApps records the call, then calls OnMigrateApps if it's set.
+func (f *FakeEmpire) MigrateApps(ctx context.Context, from service.Manager, to service.Manager) (r0 *empire.MigrationReport, r1 error) {
+	f.record("MigrateApps", ctx, from, to)
+	if f.OnMigrateApps != nil {
+		return f.OnMigrateApps(ctx, from, to)
+	}
+	return
+}
+
+// ConfigureTelemetry records the call, then calls OnConfigureTelemetry if it's set.
+func (f *FakeEmpire) ConfigureTelemetry(ctx context.Context, opts empire.TelemetryOptions) (r0 error) {
+	f.record("ConfigureTelemetry", ctx, opts)
+	if f.OnConfigureTelemetry != nil {
+		return f.OnConfigureTelemetry(ctx, opts)
+	}
+	return
+}
+
+// Backup records the call, then calls OnBackup if it's set.
+func (f *FakeEmpire) Backup(ctx context.Context, w io.Writer) (r0 error) {
+	f.record("Backup", ctx, w)
+	if f.OnBackup != nil {
+		return f.OnBackup(ctx, w)
+	}
+	return
+}
+
+// Restore records the call, then calls OnRestore if it's set.
+func (f *FakeEmpire) Restore(ctx context.Context, r io.Reader) (r0 *empire.RestoreReport, r1 error) {
+	f.record("Restore", ctx, r)
+	if f.OnRestore != nil {
+		return f.OnRestore(ctx, r)
+	}
+	return
+}
+
+// Reset records the call, then calls OnReset if it's set.
+func (f *FakeEmpire) Reset() (r0 error) {
+	f.record("Reset")
+	if f.OnReset != nil {
+		return f.OnReset()
+	}
+	return
+}
+
+// IsHealthy records the call, then calls OnIsHealthy if it's set.
+func (f *FakeEmpire) IsHealthy() (r0 bool) {
+	f.record("IsHealthy")
+	if f.OnIsHealthy != nil {
+		return f.OnIsHealthy()
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package empiretest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+)
+
+func TestFakeEmpire_ZeroValues(t *testing.T) {
+	typ := reflect.TypeOf((*empire.EmpireInterface)(nil)).Elem()
+
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		f := &FakeEmpire{}
+		fn := reflect.ValueOf(f).MethodByName(m.Name)
+
+		// Call every method with the zero value of each argument.
+		var args []reflect.Value
+		for j := 0; j < m.Type.NumIn(); j++ {
+			in := m.Type.In(j)
+			if m.Type.IsVariadic() && j == m.Type.NumIn()-1 {
+				in = in.Elem()
+			}
+			args = append(args, reflect.Zero(in))
+		}
+
+		for j, out := range fn.Call(args) {
+			if !reflect.DeepEqual(out.Interface(), reflect.Zero(m.Type.Out(j)).Interface()) {
+				t.Fatalf("%s => %v; want the zero value", m.Name, out)
+			}
+		}
+
+		calls := f.Calls()
+		if len(calls) != 1 {
+			t.Fatalf("%s: Calls => %d; want 1", m.Name, len(calls))
+		}
+
+		if got, want := calls[0].Method, m.Name; got != want {
+			t.Fatalf("Method => %s; want %s", got, want)
+		}
+
+		if got, want := len(calls[0].Args), len(args); got != want {
+			t.Fatalf("%s: Args => %d; want %d", m.Name, got, want)
+		}
+	}
+}
+
+func TestFakeEmpire_Hooks(t *testing.T) {
+	errBoom := errors.New("boom")
+	created := &empire.App{ID: "1234", Name: "acme-inc"}
+
+	f := &FakeEmpire{
+		OnAppsCreate: func(app *empire.App) (*empire.App, error) {
+			return created, nil
+		},
+		OnAppsSetDrainTimeout: func(app *empire.App, seconds int) error {
+			return errBoom
+		},
+	}
+
+	app := &empire.App{Name: "acme-inc"}
+
+	got, err := f.AppsCreate(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != created {
+		t.Fatalf("AppsCreate => %v; want %v", got, created)
+	}
+
+	if err := f.AppsSetDrainTimeout(created, 30); err != errBoom {
+		t.Fatalf("err => %v; want %v", err, errBoom)
+	}
+
+	want := []Call{
+		{Method: "AppsCreate", Args: []interface{}{app}},
+		{Method: "AppsSetDrainTimeout", Args: []interface{}{created, 30}},
+	}
+	if got := f.Calls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Calls => %v; want %v", got, want)
+	}
+}
@@ -20,6 +20,12 @@ var (
 // NewEmpire returns a new Empire instance suitable for testing. It ensures that
 // the database is clean before returning.
 func NewEmpire(t testing.TB) *empire.Empire {
+	return NewEmpireWithOptions(t, nil)
+}
+
+// NewEmpireWithOptions is like NewEmpire, but the options can be changed with
+// configure before the Empire instance is created.
+func NewEmpireWithOptions(t testing.TB, configure func(*empire.Options)) *empire.Empire {
 	opts := empire.Options{
 		DB: DatabaseURL,
 		Runner: empire.RunnerOptions{
@@ -38,6 +44,10 @@ func NewEmpire(t testing.TB) *empire.Empire {
 		},
 	}
 
+	if configure != nil {
+		configure(&opts)
+	}
+
 	e, err := empire.New(opts)
 	if err != nil {
 		t.Fatal(err)
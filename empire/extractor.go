@@ -40,7 +40,7 @@ func (e *fakeExtractor) Extract(image Image) (CommandMap, error) {
 
 type cmdExtractor struct {
 	// Client is the docker client to use to pull the container image.
-	client *docker.Client
+	client dockerClient
 }
 
 func (e *cmdExtractor) Extract(image Image) (CommandMap, error) {
@@ -63,7 +63,7 @@ type procfileFallbackExtractor struct {
 	ce *cmdExtractor
 }
 
-func newProcfileFallbackExtractor(c *docker.Client) Extractor {
+func newProcfileFallbackExtractor(c dockerClient) Extractor {
 	return &procfileFallbackExtractor{
 		pe: &procfileExtractor{
 			client: c,
@@ -88,7 +88,7 @@ func (e *procfileFallbackExtractor) Extract(image Image) (CommandMap, error) {
 // pull a docker image and extract it's Procfile into a process.CommandMap.
 type procfileExtractor struct {
 	// Client is the docker client to use to pull the container image.
-	client *docker.Client
+	client dockerClient
 }
 
 // Extract implements Extractor Extract.
@@ -140,16 +140,33 @@ func TestProcfileFallbackExtractor(t *testing.T) {
 
 }
 
-// newTestDockerClient returns a docker.Client configured to talk to the given http.Handler
-func newTestDockerClient(t *testing.T, fakeDockerAPI http.Handler) (*docker.Client, *httptest.Server) {
+// newTestDockerClient returns a dockerClient configured to talk to the given
+// http.Handler.
+func newTestDockerClient(t *testing.T, fakeDockerAPI http.Handler) (dockerClient, *httptest.Server) {
 	s := httptest.NewServer(fakeDockerAPI)
 
-	c, err := docker.NewClient(s.URL)
+	c, err := newDockerClient(s.URL, "", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	return c, s
+	return &testDockerClient{Client: c, url: s.URL}, s
+}
+
+// testDockerClient is a dockerClient that doesn't reconnect, so that requests
+// made by the tests are exactly the ones that are made to the docker daemon.
+type testDockerClient struct {
+	*docker.Client
+	url string
+}
+
+func (c *testDockerClient) BuildImage(opts BuildImageOptions) error {
+	client, err := newDockerClient(c.url, "", opts.query())
+	if err != nil {
+		return err
+	}
+
+	return client.BuildImage(opts.BuildImageOptions)
 }
 
 func tarProcfile(t *testing.T) string {
@@ -0,0 +1,90 @@
+package empire
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// FeatureFlagPrefix is the prefix for config vars that represent feature
+// flags.
+const FeatureFlagPrefix = "FEATURE_"
+
+// featureFlagsService provides typed access to feature flags, which are stored
+// as config vars.
+type featureFlagsService struct {
+	*configsService
+}
+
+// FeatureFlag returns whether the named feature flag is enabled for the app.
+func (s *featureFlagsService) FeatureFlag(app *App, name string) (bool, error) {
+	c, err := s.ConfigsCurrent(app)
+	if err != nil {
+		return false, err
+	}
+
+	return parseFeatureFlag(c.Vars[featureFlagVariable(name)]), nil
+}
+
+// FeatureFlagSet enables or disables the named feature flag for the app.
+func (s *featureFlagsService) FeatureFlagSet(ctx context.Context, app *App, name string, enabled bool) (*Config, error) {
+	return s.ConfigsApply(ctx, app, featureFlagVars(name, enabled))
+}
+
+// FeatureFlagsAll returns all of the feature flags for the app, keyed by the
+// lowercased flag name.
+func (s *featureFlagsService) FeatureFlagsAll(app *App) (map[string]bool, error) {
+	c, err := s.ConfigsCurrent(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return featureFlags(c.Vars), nil
+}
+
+// featureFlagVariable returns the config var that holds the named feature
+// flag.
+func featureFlagVariable(name string) Variable {
+	return Variable(FeatureFlagPrefix + strings.ToUpper(name))
+}
+
+// featureFlagVars returns the Vars that will set the named feature flag.
+func featureFlagVars(name string, enabled bool) Vars {
+	v := "false"
+	if enabled {
+		v = "true"
+	}
+
+	return Vars{featureFlagVariable(name): &v}
+}
+
+// parseFeatureFlag interprets a config var value as a boolean. "1", "true" and
+// "yes" are true, everything else is false.
+func parseFeatureFlag(v *string) bool {
+	if v == nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(*v)) {
+	case "1", "true", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// featureFlags extracts the feature flags from vars.
+func featureFlags(vars Vars) map[string]bool {
+	flags := make(map[string]bool)
+
+	for k, v := range vars {
+		if !strings.HasPrefix(string(k), FeatureFlagPrefix) {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(string(k), FeatureFlagPrefix))
+		flags[name] = parseFeatureFlag(v)
+	}
+
+	return flags
+}
@@ -0,0 +1,88 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFeatureFlag(t *testing.T) {
+	tests := []struct {
+		in  *string
+		out bool
+	}{
+		{ptr("1"), true},
+		{ptr("true"), true},
+		{ptr("TRUE"), true},
+		{ptr("yes"), true},
+		{ptr("Yes"), true},
+		{ptr("0"), false},
+		{ptr("false"), false},
+		{ptr("no"), false},
+		{ptr(""), false},
+		{ptr("enabled"), false},
+		{nil, false},
+	}
+
+	for i, tt := range tests {
+		if got, want := parseFeatureFlag(tt.in), tt.out; got != want {
+			t.Fatalf("#%d: parseFeatureFlag => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestFeatureFlagVariable(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Variable
+	}{
+		{"new_ui", "FEATURE_NEW_UI"},
+		{"NEW_UI", "FEATURE_NEW_UI"},
+		{"New_Ui", "FEATURE_NEW_UI"},
+	}
+
+	for _, tt := range tests {
+		if got, want := featureFlagVariable(tt.in), tt.out; got != want {
+			t.Fatalf("featureFlagVariable(%q) => %s; want %s", tt.in, got, want)
+		}
+	}
+}
+
+func TestFeatureFlags(t *testing.T) {
+	vars := Vars{
+		"FEATURE_NEW_UI":  ptr("true"),
+		"FEATURE_BILLING": ptr("0"),
+		"RAILS_ENV":       ptr("production"),
+	}
+
+	got := featureFlags(vars)
+	want := map[string]bool{
+		"new_ui":  true,
+		"billing": false,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("featureFlags => %v; want %v", got, want)
+	}
+}
+
+func TestFeatureFlagVars(t *testing.T) {
+	vars := Vars{"RAILS_ENV": ptr("production")}
+
+	vars = mergeVars(vars, featureFlagVars("new_ui", true))
+	if got := featureFlags(vars); !got["new_ui"] {
+		t.Fatal("Expected new_ui to be enabled")
+	}
+
+	vars = mergeVars(vars, featureFlagVars("NEW_UI", false))
+	if got := featureFlags(vars); got["new_ui"] {
+		t.Fatal("Expected new_ui to be disabled")
+	}
+
+	if got, want := len(vars), 2; got != want {
+		t.Fatalf("len(vars) => %d; want %d", got, want)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
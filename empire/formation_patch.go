@@ -0,0 +1,161 @@
+package empire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/net/context"
+)
+
+// ErrInvalidPatch is returned when a JSON Patch document can't be parsed, or
+// can't be applied to a formation.
+var ErrInvalidPatch = &ValidationError{
+	errors.New("Invalid JSON Patch."),
+}
+
+// patchOperation is an operation in an RFC 6902 JSON Patch document.
+type patchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// applyQuantitiesPatch applies a JSON Patch document to quantities, which is
+// treated as a json object like {"web": 3, "worker": 1}. Only paths to the
+// members of the object, like "/web", are supported. quantities is not
+// modified.
+func applyQuantitiesPatch(quantities map[string]int, patch []byte) (map[string]int, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, ErrInvalidPatch
+	}
+
+	doc := make(map[string]int, len(quantities))
+	for t, q := range quantities {
+		doc[t] = q
+	}
+
+	for _, op := range ops {
+		if err := applyPatchOperation(doc, op); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+func applyPatchOperation(doc map[string]int, op patchOperation) error {
+	key, err := patchKey(op.Path)
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		v, err := patchValue(op.Value)
+		if err != nil {
+			return err
+		}
+
+		_, exists := doc[key]
+		switch {
+		case op.Op == "replace" && !exists:
+			return ErrInvalidPatch
+		case op.Op == "test":
+			if !exists || doc[key] != v {
+				return ErrInvalidPatch
+			}
+			return nil
+		}
+
+		doc[key] = v
+	case "remove":
+		if _, ok := doc[key]; !ok {
+			return ErrInvalidPatch
+		}
+		delete(doc, key)
+	case "move", "copy":
+		from, err := patchKey(op.From)
+		if err != nil {
+			return err
+		}
+
+		v, ok := doc[from]
+		if !ok {
+			return ErrInvalidPatch
+		}
+
+		if op.Op == "move" {
+			delete(doc, from)
+		}
+		doc[key] = v
+	default:
+		return ErrInvalidPatch
+	}
+
+	return nil
+}
+
+// patchKey returns the member of the top level object that a JSON Pointer
+// refers to, e.g. "web" for "/web".
+func patchKey(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") || strings.Count(path, "/") != 1 {
+		return "", ErrInvalidPatch
+	}
+
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(path[1:]), nil
+}
+
+// patchValue decodes the value of an operation, which must be an integer.
+func patchValue(raw *json.RawMessage) (int, error) {
+	if raw == nil {
+		return 0, ErrInvalidPatch
+	}
+
+	var v int
+	if err := json.Unmarshal(*raw, &v); err != nil {
+		return 0, ErrInvalidPatch
+	}
+
+	return v, nil
+}
+
+// ProcessesScaleJSONPatch applies a JSON Patch document to the quantities of
+// the current release's formation, then scales the processes like
+// ProcessesScale. Process types that are removed by the patch are scaled to 0.
+func (s *scaler) ProcessesScaleJSONPatch(ctx context.Context, app *App, patch []byte) (*Release, error) {
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			err = &ValidationError{Err: fmt.Errorf("no releases for %s", app.Name)}
+		}
+		return nil, err
+	}
+
+	f, err := s.store.Formation(ProcessesQuery{Release: release})
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[string]int)
+	for t, p := range f {
+		current[string(t)] = p.Quantity
+	}
+
+	quantities, err := applyQuantitiesPatch(current, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	for t := range current {
+		if _, ok := quantities[t]; !ok {
+			quantities[t] = 0
+		}
+	}
+
+	return s.ProcessesScale(ctx, app, quantities)
+}
@@ -0,0 +1,56 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyQuantitiesPatch(t *testing.T) {
+	quantities := map[string]int{"web": 1, "worker": 2}
+
+	tests := []struct {
+		patch    string
+		expected map[string]int
+		err      error
+	}{
+		{`[]`, map[string]int{"web": 1, "worker": 2}, nil},
+		{`[{"op": "add", "path": "/clock", "value": 1}]`, map[string]int{"web": 1, "worker": 2, "clock": 1}, nil},
+		{`[{"op": "add", "path": "/web", "value": 3}]`, map[string]int{"web": 3, "worker": 2}, nil},
+		{`[{"op": "replace", "path": "/web", "value": 3}]`, map[string]int{"web": 3, "worker": 2}, nil},
+		{`[{"op": "remove", "path": "/worker"}]`, map[string]int{"web": 1}, nil},
+		{`[{"op": "test", "path": "/web", "value": 1}, {"op": "replace", "path": "/web", "value": 0}]`, map[string]int{"web": 0, "worker": 2}, nil},
+		{`[{"op": "copy", "from": "/worker", "path": "/web"}]`, map[string]int{"web": 2, "worker": 2}, nil},
+		{`[{"op": "move", "from": "/worker", "path": "/clock"}]`, map[string]int{"web": 1, "clock": 2}, nil},
+		{`[{"op": "add", "path": "/web", "value": -1}]`, map[string]int{"web": -1, "worker": 2}, nil},
+
+		// Malformed patches.
+		{`{"op": "add"}`, nil, ErrInvalidPatch},
+		{`[{"op": "add", "path": "/web"`, nil, ErrInvalidPatch},
+		{`[{"op": "increment", "path": "/web", "value": 1}]`, nil, ErrInvalidPatch},
+		{`[{"op": "add", "path": "web", "value": 1}]`, nil, ErrInvalidPatch},
+		{`[{"op": "add", "path": "/web/quantity", "value": 1}]`, nil, ErrInvalidPatch},
+		{`[{"op": "add", "path": "/web", "value": "3"}]`, nil, ErrInvalidPatch},
+		{`[{"op": "add", "path": "/web", "value": 1.5}]`, nil, ErrInvalidPatch},
+		{`[{"op": "add", "path": "/web"}]`, nil, ErrInvalidPatch},
+		{`[{"op": "replace", "path": "/clock", "value": 1}]`, nil, ErrInvalidPatch},
+		{`[{"op": "remove", "path": "/clock"}]`, nil, ErrInvalidPatch},
+		{`[{"op": "test", "path": "/web", "value": 2}]`, nil, ErrInvalidPatch},
+		{`[{"op": "move", "from": "/clock", "path": "/web"}]`, nil, ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		got, err := applyQuantitiesPatch(quantities, []byte(tt.patch))
+		if err != tt.err {
+			t.Errorf("applyQuantitiesPatch(%s) err => %v; want %v", tt.patch, err, tt.err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("applyQuantitiesPatch(%s) => %v; want %v", tt.patch, got, tt.expected)
+		}
+	}
+
+	if want := map[string]int{"web": 1, "worker": 2}; !reflect.DeepEqual(quantities, want) {
+		t.Fatalf("Expected the quantities to not be modified, got %v", quantities)
+	}
+}
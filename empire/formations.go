@@ -0,0 +1,81 @@
+package empire
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// formationHistory reconstructs the formation of an app at a point in time
+// from its scale events.
+type formationHistory struct {
+	store *store
+}
+
+// FormationAtTime returns the formation of the app at the given time. The
+// processes come from the release that was current at that time, or the first
+// release if there wasn't one yet, and their quantities are replayed from the
+// scale events up to and including at.
+func (s *formationHistory) FormationAtTime(app *App, at time.Time) (Formation, error) {
+	release, err := s.releaseAt(app, at)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.store.ScaleEvents(ScaleEventsQuery{App: app})
+	if err != nil {
+		return nil, err
+	}
+
+	return formationAt(newFormation(release.Processes), events, at), nil
+}
+
+// releaseAt returns the latest release created at or before at, falling back
+// to the apps first release.
+func (s *formationHistory) releaseAt(app *App, at time.Time) (*Release, error) {
+	r, err := s.store.ReleasesFirst(ComposedScope{
+		ReleasesQuery{App: app, Status: ReleaseStatusActive},
+		ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("created_at <= ?", at)
+		}),
+	})
+	if err != gorm.RecordNotFound {
+		return r, err
+	}
+
+	version := 1
+	return s.store.ReleasesFirst(ReleasesQuery{App: app, Version: &version})
+}
+
+// formationAt returns a copy of the formation with the quantity of each
+// process set by the last scale event for its type up to and including at.
+// When a process has no events before at, the quantity of its first event,
+// which is recorded when the release that introduced it is created, is used
+// instead. Events for process types that aren't in the formation are ignored.
+func formationAt(f Formation, events []*ScaleEvent, at time.Time) Formation {
+	sorted := make([]*ScaleEvent, len(events))
+	copy(sorted, events)
+	sort.Stable(scaleEventsByCreatedAt(sorted))
+
+	formation := make(Formation)
+	for t, p := range f {
+		pp := *p
+		formation[t] = &pp
+	}
+
+	replayed := make(map[ProcessType]bool)
+	for _, e := range sorted {
+		p, ok := formation[e.ProcessType]
+		if !ok {
+			continue
+		}
+
+		if !e.CreatedAt.After(at) || !replayed[e.ProcessType] {
+			p.Quantity = e.Quantity
+		}
+		replayed[e.ProcessType] = true
+	}
+
+	return formation
+}
@@ -0,0 +1,69 @@
+package empire
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormationAt(t *testing.T) {
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) *time.Time {
+		t := t0.Add(time.Duration(h) * time.Hour)
+		return &t
+	}
+
+	f := Formation{
+		"web":    &Process{Type: "web", Quantity: 1},
+		"worker": &Process{Type: "worker", Quantity: 0},
+		"clock":  &Process{Type: "clock", Quantity: 1},
+	}
+
+	events := []*ScaleEvent{
+		{ProcessType: "web", Quantity: 5, CreatedAt: at(2)},
+		{ProcessType: "web", Quantity: 1, CreatedAt: at(0)},
+		{ProcessType: "worker", Quantity: 2, CreatedAt: at(1)},
+		{ProcessType: "web", Quantity: 3, CreatedAt: at(4)},
+		{ProcessType: "scheduler", Quantity: 1, CreatedAt: at(1)},
+	}
+
+	tests := []struct {
+		at     time.Time
+		web    int
+		worker int
+	}{
+		// Before any events, the first event of each process is
+		// used.
+		{t0.Add(-time.Hour), 1, 2},
+		{*at(0), 1, 2},
+		{*at(1), 1, 2},
+		{*at(2), 5, 2},
+		{*at(3), 5, 2},
+		{*at(4), 3, 2},
+		{*at(10), 3, 2},
+	}
+
+	for _, tt := range tests {
+		got := formationAt(f, events, tt.at)
+
+		if q := got["web"].Quantity; q != tt.web {
+			t.Errorf("%s: web => %d; want %d", tt.at, q, tt.web)
+		}
+
+		if q := got["worker"].Quantity; q != tt.worker {
+			t.Errorf("%s: worker => %d; want %d", tt.at, q, tt.worker)
+		}
+
+		if q := got["clock"].Quantity; q != 1 {
+			t.Errorf("%s: clock => %d; want 1", tt.at, q)
+		}
+
+		if _, ok := got["scheduler"]; ok {
+			t.Errorf("%s: expected events for unknown process types to be ignored", tt.at)
+		}
+	}
+
+	// The original formation isn't modified.
+	if q := f["web"].Quantity; q != 1 {
+		t.Fatalf("web => %d; want 1", q)
+	}
+}
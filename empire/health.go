@@ -0,0 +1,237 @@
+package empire
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+// Health statuses of an app.
+const (
+	// Every process has at least its desired number of running instances.
+	AppHealthHealthy = "healthy"
+
+	// At least one process has fewer running instances than desired.
+	AppHealthDegraded = "degraded"
+
+	// None of the processes that should be running are. Only reported by
+	// ClusterJobHealthSummary.
+	AppHealthDown = "down"
+
+	// The scheduler couldn't be queried in time.
+	AppHealthUnknown = "unknown"
+)
+
+// AppWithHealth is an app along with its health status.
+type AppWithHealth struct {
+	*App
+
+	// One of AppHealthHealthy, AppHealthDegraded or AppHealthUnknown.
+	HealthStatus string
+}
+
+// ClusterHealthReport is the number of apps in each health status.
+type ClusterHealthReport struct {
+	HealthyApps  int
+	DegradedApps int
+	DownApps     int
+	UnknownApps  int
+}
+
+// add counts an app with the health status.
+func (r *ClusterHealthReport) add(status string) {
+	switch status {
+	case AppHealthHealthy:
+		r.HealthyApps++
+	case AppHealthDegraded:
+		r.DegradedApps++
+	case AppHealthDown:
+		r.DownApps++
+	default:
+		r.UnknownApps++
+	}
+}
+
+// appsHealthService determines the health of apps by comparing the formation
+// of their current release with what's running on the scheduler.
+type appsHealthService struct {
+	store   *store
+	manager service.Manager
+
+	// The maximum time to spend querying the scheduler for each app, and
+	// for all apps when summarizing the cluster's health. Zero means no
+	// timeout.
+	timeout time.Duration
+
+	// The maximum number of apps that the scheduler is queried for at the
+	// same time when summarizing the cluster's health. Zero means
+	// service.DefaultMaxConcurrency.
+	maxConcurrency int
+}
+
+// AppsAllWithHealth returns a page of apps, sorted by name, with their health.
+func (s *appsHealthService) AppsAllWithHealth(ctx context.Context, page Page) ([]*AppWithHealth, error) {
+	apps, err := s.store.Apps(ComposedScope{AppsQuery{SortField: AppsSortName}, page})
+	if err != nil {
+		return nil, err
+	}
+
+	var healths []*AppWithHealth
+	for _, app := range apps {
+		healths = append(healths, &AppWithHealth{
+			App:          app,
+			HealthStatus: s.health(ctx, app),
+		})
+	}
+
+	return healths, nil
+}
+
+// ClusterJobHealthSummary returns the number of apps in each health status.
+// Unlike AppsAllWithHealth, apps that have none of their processes running are
+// counted as down, rather than degraded. Apps are checked in parallel, limited
+// to maxConcurrency at a time, and apps that haven't been checked when timeout
+// has passed since the summary started have an unknown health.
+func (s *appsHealthService) ClusterJobHealthSummary(ctx context.Context) (*ClusterHealthReport, error) {
+	apps, err := s.store.Apps(AppsQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	n := s.maxConcurrency
+	if n <= 0 {
+		n = service.DefaultMaxConcurrency
+	}
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, n)
+		statuses = make(chan string, len(apps))
+	)
+
+	for _, app := range apps {
+		wg.Add(1)
+		go func(app *App) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if ctx.Err() != nil {
+				statuses <- AppHealthUnknown
+				return
+			}
+
+			statuses <- s.check(ctx, app, formationClusterHealth)
+		}(app)
+	}
+
+	wg.Wait()
+	close(statuses)
+
+	report := new(ClusterHealthReport)
+	for status := range statuses {
+		report.add(status)
+	}
+
+	return report, nil
+}
+
+// health returns the health status of the app. Errors are reported, and the
+// app's health is unknown.
+func (s *appsHealthService) health(ctx context.Context, app *App) string {
+	return s.check(ctx, app, formationHealth)
+}
+
+// check returns the health status of the app's current release, as determined
+// by fn.
+func (s *appsHealthService) check(ctx context.Context, app *App, fn func(Formation, []*service.Instance) string) string {
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			// Nothing should be running.
+			return AppHealthHealthy
+		}
+		reporter.Report(ctx, err)
+		return AppHealthUnknown
+	}
+
+	return s.checkFormation(ctx, app, release.Formation(), fn)
+}
+
+// formationHealth queries the scheduler for the app's instances, and compares
+// them with the formation.
+func (s *appsHealthService) formationHealth(ctx context.Context, app *App, f Formation) string {
+	return s.checkFormation(ctx, app, f, formationHealth)
+}
+
+// checkFormation queries the scheduler for the app's instances, and compares
+// them with the formation using fn.
+func (s *appsHealthService) checkFormation(ctx context.Context, app *App, f Formation, fn func(Formation, []*service.Instance) string) string {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	instances, err := s.manager.Instances(ctx, app.ID)
+	if err != nil {
+		if ctx.Err() == nil {
+			reporter.Report(ctx, err)
+		}
+		return AppHealthUnknown
+	}
+
+	return fn(f, instances)
+}
+
+// formationHealth returns AppHealthHealthy if every process in the formation
+// has at least its desired number of running instances.
+func formationHealth(f Formation, instances []*service.Instance) string {
+	running := make(map[ProcessType]int)
+	for _, i := range instances {
+		if i.Process != nil && strings.EqualFold(i.State, "running") {
+			running[ProcessType(i.Process.Type)]++
+		}
+	}
+
+	for t, p := range f {
+		if running[t] < p.Quantity {
+			return AppHealthDegraded
+		}
+	}
+
+	return AppHealthHealthy
+}
+
+// formationClusterHealth is like formationHealth, but returns AppHealthDown if
+// the formation should have instances running, and none are.
+func formationClusterHealth(f Formation, instances []*service.Instance) string {
+	desired := 0
+	for _, p := range f {
+		desired += p.Quantity
+	}
+
+	for _, i := range instances {
+		if i.Process != nil && strings.EqualFold(i.State, "running") {
+			return formationHealth(f, instances)
+		}
+	}
+
+	if desired > 0 {
+		return AppHealthDown
+	}
+
+	return AppHealthHealthy
+}
@@ -0,0 +1,180 @@
+package empire
+
+import (
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+func TestFormationHealth(t *testing.T) {
+	f := Formation{
+		"web":    &Process{Type: "web", Quantity: 2},
+		"worker": &Process{Type: "worker", Quantity: 1},
+	}
+
+	web := &service.Process{Type: "web"}
+	worker := &service.Process{Type: "worker"}
+
+	tests := []struct {
+		instances []*service.Instance
+		health    string
+	}{
+		{
+			[]*service.Instance{
+				{ID: "1", Process: web, State: "RUNNING"},
+				{ID: "2", Process: web, State: "running"},
+				{ID: "3", Process: worker, State: "RUNNING"},
+			},
+			AppHealthHealthy,
+		},
+		{
+			[]*service.Instance{
+				{ID: "1", Process: web, State: "RUNNING"},
+				{ID: "2", Process: web, State: "PENDING"},
+				{ID: "3", Process: worker, State: "RUNNING"},
+			},
+			AppHealthDegraded,
+		},
+		{
+			[]*service.Instance{
+				{ID: "1", Process: web, State: "RUNNING"},
+				{ID: "2", Process: web, State: "RUNNING"},
+			},
+			AppHealthDegraded,
+		},
+		{nil, AppHealthDegraded},
+	}
+
+	for i, tt := range tests {
+		if got, want := formationHealth(f, tt.instances), tt.health; got != want {
+			t.Errorf("#%d: formationHealth => %s; want %s", i, got, want)
+		}
+	}
+
+	if got, want := formationHealth(Formation{}, nil), AppHealthHealthy; got != want {
+		t.Errorf("formationHealth => %s; want %s", got, want)
+	}
+}
+
+func TestAppsHealthService_FormationHealth(t *testing.T) {
+	f := Formation{"web": &Process{Type: "web", Quantity: 1}}
+	app := &App{ID: "1234", Name: "acme-inc"}
+
+	m := newMockManager(&service.Instance{ID: "1", Process: &service.Process{Type: "web"}, State: "RUNNING"})
+	s := &appsHealthService{manager: m, timeout: time.Second}
+
+	if got, want := s.formationHealth(context.Background(), app, f), AppHealthHealthy; got != want {
+		t.Fatalf("health => %s; want %s", got, want)
+	}
+}
+
+func TestAppsHealthService_FormationHealth_Timeout(t *testing.T) {
+	f := Formation{"web": &Process{Type: "web", Quantity: 1}}
+	app := &App{ID: "1234", Name: "acme-inc"}
+
+	s := &appsHealthService{manager: &slowManager{newMockManager()}, timeout: 10 * time.Millisecond}
+
+	if got, want := s.formationHealth(context.Background(), app, f), AppHealthUnknown; got != want {
+		t.Fatalf("health => %s; want %s", got, want)
+	}
+}
+
+func TestFormationClusterHealth(t *testing.T) {
+	f := Formation{
+		"web":    &Process{Type: "web", Quantity: 2},
+		"worker": &Process{Type: "worker", Quantity: 1},
+	}
+
+	web := &service.Process{Type: "web"}
+	worker := &service.Process{Type: "worker"}
+
+	tests := []struct {
+		f         Formation
+		instances []*service.Instance
+		health    string
+	}{
+		{
+			f,
+			[]*service.Instance{
+				{ID: "1", Process: web, State: "RUNNING"},
+				{ID: "2", Process: web, State: "RUNNING"},
+				{ID: "3", Process: worker, State: "RUNNING"},
+			},
+			AppHealthHealthy,
+		},
+		{
+			f,
+			[]*service.Instance{
+				{ID: "1", Process: web, State: "RUNNING"},
+				{ID: "3", Process: worker, State: "RUNNING"},
+			},
+			AppHealthDegraded,
+		},
+		{
+			f,
+			[]*service.Instance{
+				{ID: "1", Process: web, State: "PENDING"},
+			},
+			AppHealthDown,
+		},
+		{f, nil, AppHealthDown},
+		{Formation{"web": &Process{Type: "web", Quantity: 0}}, nil, AppHealthHealthy},
+	}
+
+	for i, tt := range tests {
+		if got, want := formationClusterHealth(tt.f, tt.instances), tt.health; got != want {
+			t.Errorf("#%d: formationClusterHealth => %s; want %s", i, got, want)
+		}
+	}
+}
+
+func TestClusterHealthReport(t *testing.T) {
+	f := Formation{"web": &Process{Type: "web", Quantity: 2}}
+	web := &service.Process{Type: "web"}
+
+	// Each manager stands in for the scheduler's view of a different app.
+	managers := []service.Manager{
+		newMockManager(
+			&service.Instance{ID: "1", Process: web, State: "RUNNING"},
+			&service.Instance{ID: "2", Process: web, State: "RUNNING"},
+		),
+		newMockManager(
+			&service.Instance{ID: "1", Process: web, State: "RUNNING"},
+			&service.Instance{ID: "2", Process: web, State: "RUNNING"},
+		),
+		newMockManager(
+			&service.Instance{ID: "1", Process: web, State: "RUNNING"},
+		),
+		newMockManager(),
+		&slowManager{newMockManager()},
+	}
+
+	report := new(ClusterHealthReport)
+	for _, m := range managers {
+		s := &appsHealthService{manager: m, timeout: 10 * time.Millisecond}
+		report.add(s.checkFormation(context.Background(), &App{ID: "1234"}, f, formationClusterHealth))
+	}
+
+	want := ClusterHealthReport{
+		HealthyApps:  2,
+		DegradedApps: 1,
+		DownApps:     1,
+		UnknownApps:  1,
+	}
+	if *report != want {
+		t.Fatalf("ClusterHealthReport => %+v; want %+v", *report, want)
+	}
+}
+
+// slowManager is a service.Manager whose queries don't return until the
+// context is done.
+type slowManager struct {
+	*mockManager
+}
+
+func (m *slowManager) Instances(ctx context.Context, app string) ([]*service.Instance, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
@@ -0,0 +1,153 @@
+package empire
+
+import (
+	"io"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+// EmpireInterface is the set of methods of Empire. Code that accepts an
+// EmpireInterface, like HTTP handlers, can be tested with empiretest.FakeEmpire
+// instead of a database backed Empire.
+type EmpireInterface interface {
+	AccessTokensFind(token string) (*AccessToken, error)
+	AccessTokensCreate(accessToken *AccessToken) (*AccessToken, error)
+	AccessTokensList(ctx context.Context, page Page) ([]*AccessToken, error)
+	AccessTokensRequireScope(ctx context.Context, scope string) error
+	AccessTokensMigrateToNewSecret(oldSecret, newSecret []byte) (int, error)
+	AppsFirst(q AppsQuery) (*App, error)
+	Apps(q AppsQuery) ([]*App, error)
+	AppsAllBySlug(slug *Slug) ([]*App, error)
+	AppsCreate(app *App) (*App, error)
+	AppsCreateWithConfig(ctx context.Context, app *App, vars Vars) (*App, *Config, error)
+	AppsSetDeployStrategy(app *App, strategy string) error
+	AppsSetDrainTimeout(app *App, seconds int) error
+	AppsSetValidateCommand(ctx context.Context, app *App, cmd string) error
+	AppsAllCursor(cursor string, limit int) ([]*App, string, error)
+	AppsAllWithLastRelease(page Page) ([]*AppWithLastRelease, error)
+	AppsAllWithHealth(ctx context.Context, page Page) ([]*AppWithHealth, error)
+	ClusterJobHealthSummary(ctx context.Context) (*ClusterHealthReport, error)
+	AppsAnnotate(app *App, key, value string) error
+	AppsAnnotations(app *App) (map[string]string, error)
+	AppsDiscoverByLabel(key, value string) ([]*App, error)
+	AppsDiscoverByLabelPrefix(key string) ([]*App, error)
+	AppsDestroy(ctx context.Context, app *App) error
+	AppsDestroyVerify(ctx context.Context, app *App, timeout time.Duration) error
+	AppsDestroyForce(ctx context.Context, app *App) error
+	AppsDestroyScheduled(ctx context.Context, app *App, destroyAfter time.Duration) (*PendingDestroy, error)
+	AppsDestroyCancelScheduled(ctx context.Context, pendingID string) error
+	AppsDestroySweep(ctx context.Context) error
+	CertificatesFirst(ctx context.Context, q CertificatesQuery) (*Certificate, error)
+	CertificatesCreate(ctx context.Context, cert *Certificate) (*Certificate, error)
+	CertificatesUpdate(ctx context.Context, cert *Certificate) (*Certificate, error)
+	CertificatesDestroy(ctx context.Context, cert *Certificate) error
+	ConfigsCurrent(app *App) (*Config, error)
+	ConfigsCurrentWithResolved(ctx context.Context, app *App) (*Config, error)
+	ConfigsFindByVersion(app *App, version int) (*Config, error)
+	ConfigsHistory(app *App, page Page) ([]*Config, error)
+	ConfigsKeySetTTL(app *App, key string, ttl time.Duration) error
+	ConfigDefaultsSet(defaults Vars) error
+	ConfigDefaultsGet() (Vars, error)
+	ConfigsDiffByID(fromID, toID string) (ConfigChangeset, error)
+	ConfigsApply(ctx context.Context, app *App, vars Vars) (*Config, error)
+	ConfigsApplyIfChanged(ctx context.Context, app *App, vars Vars) (*Config, bool, error)
+	ConfigsApplyOrdered(ctx context.Context, app *App, vars Vars, order []string) (*Config, error)
+	ConfigsApplyFromYAML(ctx context.Context, app *App, r io.Reader) (*Config, error)
+	ConfigsApplyFromDotenv(ctx context.Context, app *App, r io.Reader) (*Config, error)
+	ConfigsApplyWithHistory(ctx context.Context, app *App, changes []KeyValueChange) ([]*Config, error)
+	ConfigsApplyAtomic(ctx context.Context, updates map[string]Vars) (map[string]*Config, error)
+	ConfigsDriftReport(app *App, reference Vars) (*DriftReport, error)
+	ConfigsFreeze(configID string) error
+	ConfigsUnfreeze(configID string) error
+	ConfigsMerge(ctx context.Context, app *App, baseConfigID, overrideConfigID string) (*Config, error)
+	ConfigsCopyFromApp(ctx context.Context, src, dst *App, excludeKeys []string) (*Config, error)
+	ConfigsApplyDeltaFromRelease(ctx context.Context, dstApp, srcApp *App, srcVersion int) (*Config, error)
+	DomainsFirst(q DomainsQuery) (*Domain, error)
+	Domains(q DomainsQuery) ([]*Domain, error)
+	DomainsCreate(domain *Domain) (*Domain, error)
+	DomainsDestroy(domain *Domain) error
+	FeatureFlag(app *App, name string) (bool, error)
+	FeatureFlagSet(ctx context.Context, app *App, name string, enabled bool) (*Config, error)
+	FeatureFlagsAll(app *App) (map[string]bool, error)
+	JobsByApp(app *App) ([]*Job, error)
+	JobStatesByApp(ctx context.Context, app *App) ([]*ProcessState, error)
+	JobStatesStream(ctx context.Context, app *App, since time.Time) (<-chan []*ProcessState, error)
+	ProcessTypesAll(app *App) ([]string, error)
+	ProcessesAllSorted(release *Release) ([]*Process, error)
+	ProcessesAllSortedByState(ctx context.Context, app *App) ([]ProcessWithState, error)
+	ProcessesAllByJobState(state string, page Page) ([]*JobStateSummary, error)
+	AppsAllByJobState(state string) ([]*App, error)
+	JobStatesSnapshot(ctx context.Context, app *App) error
+	JobStatesByAppCached(ctx context.Context, app *App, maxAge time.Duration) ([]*ProcessState, error)
+	ProcessesGetMetrics(ctx context.Context, app *App) ([]ProcessMetrics, error)
+	ProcessesTop(ctx context.Context, app *App) ([]ProcessTopEntry, error)
+	ProcessesRestart(ctx context.Context, app *App, t ProcessType, id string) error
+	ProcessesDrain(ctx context.Context, app *App, t ProcessType, count int, timeout time.Duration) error
+	ProcessesRun(ctx context.Context, app *App, command string, opts ProcessesRunOpts) (*ContainerRelay, error)
+	ReleasesFindByApp(app *App) ([]*Release, error)
+	ReleasesFindByAppWithDiff(app *App, page Page) ([]*Release, error)
+	ReleasesFindByAppAndVersion(app *App, version int) (*Release, error)
+	ReleasesLast(app *App) (*Release, error)
+	ReleasesDeploy(ctx context.Context, app *App, config *Config, slug *Slug, desc string) (*Release, error)
+	ReleasesCreateDraft(ctx context.Context, app *App, config *Config, slug *Slug, desc string) (*Release, error)
+	ReleasesActivate(ctx context.Context, release *Release, approverEmail string) (*Release, error)
+	ReleasesRequestApproval(ctx context.Context, release *Release, approvers []string) (string, error)
+	ReleasesApprove(ctx context.Context, token string) (*Release, error)
+	ReleasesReject(ctx context.Context, token string, reason string) error
+	ReleasesPromoteToStable(ctx context.Context, app *App, version int) error
+	ReleasesCompare(app *App, fromVersion, toVersion int) (*ReleaseComparison, error)
+	ReleasesSearch(query string, page Page) ([]*Release, error)
+	ReleasesFind(query ReleasesQuery) ([]*Release, error)
+	ReleasesRollback(ctx context.Context, app *App, version int) (*Release, error)
+	ReleasesGraftConfig(ctx context.Context, app *App, version int, newConfigID string) (*Release, error)
+	ReleasesStream(ctx context.Context, app *App) (<-chan ReleaseEvent, error)
+	ReleaseTagSet(app *App, release *Release, tag string) error
+	ReleaseTagGet(app *App, tag string) (*Release, error)
+	ReleasesTagSearch(app *App, tagPattern string) ([]*Release, error)
+	ReleasesTagAll(app *App) (map[string]*Release, error)
+	ReleasesAutoTag(app *App, release *Release) error
+	DeployImage(ctx context.Context, image Image, out chan Event) (*Release, error)
+	DeployImageWithMetadata(ctx context.Context, image Image, meta ReleaseMetadata, out chan Event) (*Release, error)
+	ReleasesCreateFromImage(ctx context.Context, appName string, image string, opts DeployOptions) (*Release, error)
+	DeployCanary(ctx context.Context, image Image, opts CanaryOptions) (*Release, error)
+	PromoteCanary(ctx context.Context, app *App) error
+	RollbackCanary(ctx context.Context, app *App) error
+	FormationAtTime(app *App, at time.Time) (Formation, error)
+	AppsScale(ctx context.Context, app *App, t ProcessType, quantity int, c *Constraints) (*Process, error)
+	ProcessesScale(ctx context.Context, app *App, quantities map[string]int) (*Release, error)
+	ProcessesSetCommand(ctx context.Context, app *App, processType string, command string) (*Release, error)
+	ScaleReleaseJSONPatch(ctx context.Context, app *App, patch []byte) (*Release, error)
+	UsageReport(ctx context.Context, app *App, since, until time.Time) ([]*AppUsageReport, error)
+	UsageReportAll(ctx context.Context, since, until time.Time) ([]*AppUsageReport, error)
+	SlugsCreateFromDockerfile(ctx context.Context, app *App, buildContext io.Reader, buildOpts docker.BuildImageOptions) (*Slug, error)
+	SlugsBuildFromSource(ctx context.Context, app *App, gitURL, ref string, buildArgs map[string]string, w io.Writer) (*Slug, error)
+	SlugsCreateFromCompose(ctx context.Context, app *App, r io.Reader, overrides ComposeOverrides) ([]*Slug, error)
+	DeployFromTarball(ctx context.Context, app *App, tarURL string, opts TarballDeployOptions) (*Release, error)
+	SlugsGC(ctx context.Context) (int, error)
+	StartGarbageCollector(ctx context.Context, interval time.Duration)
+	CrashLoopPoliciesSet(app *App, processType string, policy CrashLoopPolicy) error
+	StartAppsDestroySweeper(ctx context.Context)
+	StartCrashLoopDetector(ctx context.Context)
+	StartWebhookRetrier(ctx context.Context)
+	StartConfigKeyExpirer(ctx context.Context)
+	ConfigKeysExpire(ctx context.Context) error
+	WebhookDeliveriesRetry(ctx context.Context) error
+	WebhookDeliveryAttempts(status string) ([]*WebhookDeliveryAttempt, error)
+	StoreMode() StoreMode
+	StartStoreMonitor(ctx context.Context)
+	SLOTargetSet(app *App, target DeployFrequencyTarget) (*DeployFrequencyTarget, error)
+	SLOTargetGet(app *App) (*DeployFrequencyTarget, error)
+	SLOEvaluate(app *App) (*SLOReport, error)
+	StartSLOController(ctx context.Context)
+	MigrateApps(ctx context.Context, from, to service.Manager) (*MigrationReport, error)
+	ConfigureTelemetry(ctx context.Context, opts TelemetryOptions) error
+	Backup(ctx context.Context, w io.Writer) error
+	Restore(ctx context.Context, r io.Reader) (*RestoreReport, error)
+	Reset() error
+	IsHealthy() bool
+}
+
+var _ EmpireInterface = (*Empire)(nil)
@@ -0,0 +1,73 @@
+package empire
+
+import (
+	"sort"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Job represents a single instance of a process that should be running for
+// the current release of an app.
+type Job struct {
+	AppName        string
+	ReleaseVersion int
+	ProcessType    ProcessType
+	Instance       int
+	Command        Command
+	Environment    Vars
+}
+
+// jobsService lists jobs from the formation stored in the database, without
+// going through the scheduler.
+type jobsService struct {
+	store *store
+}
+
+// JobsByApp returns the jobs for the current release of the app.
+func (s *jobsService) JobsByApp(app *App) ([]*Job, error) {
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return newJobs(release), nil
+}
+
+// newJobs returns a Job for every instance of every process in the release,
+// ordered by process type then instance number.
+func newJobs(release *Release) []*Job {
+	var jobs []*Job
+
+	for _, p := range release.Processes {
+		for i := 1; i <= p.Quantity; i++ {
+			jobs = append(jobs, &Job{
+				AppName:        release.App.Name,
+				ReleaseVersion: release.Version,
+				ProcessType:    p.Type,
+				Instance:       i,
+				Command:        p.Command,
+				Environment:    release.Config.Vars,
+			})
+		}
+	}
+
+	sort.Sort(jobsByProcessTypeAndInstance(jobs))
+
+	return jobs
+}
+
+// jobsByProcessTypeAndInstance implements sort.Interface to sort jobs by
+// process type, then instance number.
+type jobsByProcessTypeAndInstance []*Job
+
+func (s jobsByProcessTypeAndInstance) Len() int      { return len(s) }
+func (s jobsByProcessTypeAndInstance) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s jobsByProcessTypeAndInstance) Less(i, j int) bool {
+	if s[i].ProcessType != s[j].ProcessType {
+		return s[i].ProcessType < s[j].ProcessType
+	}
+	return s[i].Instance < s[j].Instance
+}
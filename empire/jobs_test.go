@@ -0,0 +1,61 @@
+package empire
+
+import "testing"
+
+func TestNewJobs(t *testing.T) {
+	release := &Release{
+		Version: 2,
+		App:     &App{Name: "acme-inc"},
+		Config:  &Config{Vars: Vars{"RAILS_ENV": ptr("production")}},
+		Processes: []*Process{
+			{Type: "worker", Quantity: 1, Command: "sidekiq"},
+			{Type: "web", Quantity: 3, Command: "./bin/web"},
+			{Type: "scheduler", Quantity: 0, Command: "./bin/scheduler"},
+		},
+	}
+
+	jobs := newJobs(release)
+
+	expected := []struct {
+		t        ProcessType
+		instance int
+		command  Command
+	}{
+		{"web", 1, "./bin/web"},
+		{"web", 2, "./bin/web"},
+		{"web", 3, "./bin/web"},
+		{"worker", 1, "sidekiq"},
+	}
+
+	if got, want := len(jobs), len(expected); got != want {
+		t.Fatalf("len(jobs) => %d; want %d", got, want)
+	}
+
+	for i, e := range expected {
+		j := jobs[i]
+
+		if got, want := j.ProcessType, e.t; got != want {
+			t.Fatalf("#%d: ProcessType => %s; want %s", i, got, want)
+		}
+
+		if got, want := j.Instance, e.instance; got != want {
+			t.Fatalf("#%d: Instance => %d; want %d", i, got, want)
+		}
+
+		if got, want := j.Command, e.command; got != want {
+			t.Fatalf("#%d: Command => %s; want %s", i, got, want)
+		}
+
+		if got, want := j.AppName, "acme-inc"; got != want {
+			t.Fatalf("#%d: AppName => %s; want %s", i, got, want)
+		}
+
+		if got, want := j.ReleaseVersion, 2; got != want {
+			t.Fatalf("#%d: ReleaseVersion => %d; want %d", i, got, want)
+		}
+
+		if got, want := *j.Environment["RAILS_ENV"], "production"; got != want {
+			t.Fatalf("#%d: RAILS_ENV => %s; want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Package middleware provides httpx middleware for authenticating requests to
+// Empire.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/pkg/httpx"
+	"golang.org/x/net/context"
+)
+
+// JWTUser is httpx middleware that authenticates requests with a Bearer JWT in
+// the Authorization header, signed with a shared secret using HMAC.
+type JWTUser struct {
+	// The secret that tokens are signed with.
+	secret []byte
+
+	// handler is the wrapped httpx.Handler.
+	handler httpx.Handler
+}
+
+// JWTUserMiddleware returns middleware that authenticates requests with a
+// Bearer JWT. The email claim becomes the empire.User, and an
+// empire.AccessToken granting the scopes claim is added to the context, so
+// that Empire checks the scopes like it does for its own access tokens. Tokens
+// without a scopes claim are granted empire.AllScopes.
+//
+// Requests without a Bearer token are passed through unchanged, so that they
+// can be authenticated by other means. Requests with an invalid or expired
+// token are rejected with a 401.
+func JWTUserMiddleware(secret []byte) func(httpx.Handler) httpx.Handler {
+	return func(h httpx.Handler) httpx.Handler {
+		return &JWTUser{secret: secret, handler: h}
+	}
+}
+
+// ServeHTTPContext implements the httpx.Handler interface.
+func (m *JWTUser) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	token, ok := bearerToken(r)
+	if !ok {
+		return m.handler.ServeHTTPContext(ctx, w, r)
+	}
+
+	email, scopes, err := parseJWT(m.secret, token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil
+	}
+
+	user := &empire.User{Name: email}
+	ctx = empire.WithUser(ctx, user)
+	ctx = empire.WithAccessToken(ctx, &empire.AccessToken{
+		User:   user,
+		Scopes: scopes,
+	})
+
+	return m.handler.ServeHTTPContext(ctx, w, r)
+}
+
+// UserFromContext returns the email of the user that was authenticated by
+// JWTUserMiddleware.
+func UserFromContext(ctx context.Context) (string, bool) {
+	u, ok := empire.UserFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return u.Name, true
+}
+
+// ScopesFromContext returns the scopes that were granted to the user that was
+// authenticated by JWTUserMiddleware.
+func ScopesFromContext(ctx context.Context) ([]string, bool) {
+	t, ok := empire.AccessTokenFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return t.Scopes, true
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, prefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(h, prefix), true
+}
+
+// parseJWT verifies the token, returning the email and scopes claims. The exp
+// claim, if present, is verified by jwt.Parse.
+func parseJWT(secret []byte, token string) (string, []string, error) {
+	t, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		// Only accept tokens signed with the shared secret. Otherwise,
+		// a token could be signed with a public key that's passed off
+		// as the secret.
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !t.Valid {
+		return "", nil, fmt.Errorf("invalid token")
+	}
+
+	email, ok := t.Claims["email"].(string)
+	if !ok || email == "" {
+		return "", nil, fmt.Errorf("missing email claim")
+	}
+
+	s, ok := t.Claims["scopes"].([]interface{})
+	if !ok {
+		return email, empire.AllScopes, nil
+	}
+
+	var scopes []string
+	for _, sc := range s {
+		if sc, ok := sc.(string); ok {
+			scopes = append(scopes, sc)
+		}
+	}
+
+	return email, scopes, nil
+}
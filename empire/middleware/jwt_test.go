@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/pkg/httpx"
+	"golang.org/x/net/context"
+)
+
+var testSecret = []byte("secret")
+
+func TestJWTUserMiddleware(t *testing.T) {
+	token := signTestJWT(t, jwt.SigningMethodHS256, testSecret, map[string]interface{}{
+		"email":  "foo@example.com",
+		"scopes": []string{"apps:read", "deploys:write"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+
+	var (
+		user   string
+		scopes []string
+	)
+	h := JWTUserMiddleware(testSecret)(httpx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var ok bool
+		if user, ok = UserFromContext(ctx); !ok {
+			t.Fatal("expected a user in the context")
+		}
+		if scopes, ok = ScopesFromContext(ctx); !ok {
+			t.Fatal("expected scopes in the context")
+		}
+		return nil
+	}))
+
+	resp := serveWithToken(h, "Bearer "+token)
+
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+
+	if got, want := user, "foo@example.com"; got != want {
+		t.Fatalf("User => %s; want %s", got, want)
+	}
+
+	if got, want := scopes, []string{"apps:read", "deploys:write"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scopes => %v; want %v", got, want)
+	}
+}
+
+func TestJWTUserMiddleware_AccessToken(t *testing.T) {
+	token := signTestJWT(t, jwt.SigningMethodHS256, testSecret, map[string]interface{}{
+		"email": "foo@example.com",
+	})
+
+	var at *empire.AccessToken
+	h := JWTUserMiddleware(testSecret)(httpx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		at, _ = empire.AccessTokenFromContext(ctx)
+		return nil
+	}))
+
+	serveWithToken(h, "Bearer "+token)
+
+	if at == nil {
+		t.Fatal("expected an access token in the context")
+	}
+
+	if got, want := at.User.Name, "foo@example.com"; got != want {
+		t.Fatalf("User => %s; want %s", got, want)
+	}
+
+	// Tokens without a scopes claim are granted every scope.
+	if got, want := at.Scopes, empire.AllScopes; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scopes => %v; want %v", got, want)
+	}
+}
+
+func TestJWTUserMiddleware_Rejected(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+	})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{
+			"expired",
+			signTestJWT(t, jwt.SigningMethodHS256, testSecret, map[string]interface{}{
+				"email": "foo@example.com",
+				"exp":   time.Now().Add(-time.Hour).Unix(),
+			}),
+		},
+		{
+			"wrong secret",
+			signTestJWT(t, jwt.SigningMethodHS256, []byte("other"), map[string]interface{}{
+				"email": "foo@example.com",
+			}),
+		},
+		{
+			"wrong algorithm",
+			signTestJWT(t, jwt.SigningMethodRS256, key, map[string]interface{}{
+				"email": "foo@example.com",
+			}),
+		},
+		{
+			"missing email",
+			signTestJWT(t, jwt.SigningMethodHS256, testSecret, map[string]interface{}{}),
+		},
+	}
+
+	for _, tt := range tests {
+		h := JWTUserMiddleware(testSecret)(httpx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			t.Errorf("%s: expected the request to be rejected", tt.name)
+			return nil
+		}))
+
+		resp := serveWithToken(h, "Bearer "+tt.token)
+
+		if got, want := resp.Code, http.StatusUnauthorized; got != want {
+			t.Errorf("%s: Status => %d; want %d", tt.name, got, want)
+		}
+	}
+}
+
+func TestJWTUserMiddleware_MissingHeader(t *testing.T) {
+	var called bool
+	h := JWTUserMiddleware(testSecret)(httpx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		called = true
+		if _, ok := UserFromContext(ctx); ok {
+			t.Fatal("expected no user in the context")
+		}
+		return nil
+	}))
+
+	resp := serveWithToken(h, "")
+
+	if !called {
+		t.Fatal("expected the request to be passed through")
+	}
+
+	if got, want := resp.Code, http.StatusOK; got != want {
+		t.Fatalf("Status => %d; want %d", got, want)
+	}
+}
+
+func signTestJWT(t testing.TB, method jwt.SigningMethod, key []byte, claims map[string]interface{}) string {
+	token := jwt.New(method)
+	token.Claims = claims
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func serveWithToken(h httpx.Handler, authorization string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp := httptest.NewRecorder()
+	if err := h.ServeHTTPContext(context.Background(), resp, req); err != nil {
+		panic(err)
+	}
+	return resp
+}
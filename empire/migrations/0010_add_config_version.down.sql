@@ -0,0 +1,2 @@
+DROP INDEX index_configs_on_app_id_and_version;
+ALTER TABLE configs DROP COLUMN version;
@@ -0,0 +1,9 @@
+ALTER TABLE configs ADD COLUMN version int;
+
+UPDATE configs SET version = v.version FROM (
+  SELECT id, row_number() OVER (PARTITION BY app_id ORDER BY created_at) AS version FROM configs
+) v WHERE configs.id = v.id;
+
+ALTER TABLE configs ALTER COLUMN version SET NOT NULL;
+
+CREATE UNIQUE INDEX index_configs_on_app_id_and_version ON configs USING btree (app_id, version);
@@ -0,0 +1 @@
+ALTER TABLE apps ALTER COLUMN name TYPE varchar(63);
@@ -0,0 +1 @@
+DROP TABLE scale_events CASCADE;
@@ -0,0 +1,9 @@
+CREATE TABLE scale_events (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  process_type text NOT NULL,
+  quantity int NOT NULL,
+  created_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+CREATE INDEX index_scale_events_on_app_id_and_created_at ON scale_events USING btree (app_id, created_at);
@@ -0,0 +1 @@
+DROP TABLE canary_deployments CASCADE;
@@ -0,0 +1,10 @@
+CREATE TABLE canary_deployments (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  release_id uuid NOT NULL references releases(id) ON DELETE CASCADE,
+  previous_release_id uuid NOT NULL references releases(id) ON DELETE CASCADE,
+  weight int NOT NULL,
+  created_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+CREATE UNIQUE INDEX index_canary_deployments_on_app_id ON canary_deployments USING btree (app_id);
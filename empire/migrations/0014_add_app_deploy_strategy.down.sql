@@ -0,0 +1 @@
+ALTER TABLE apps DROP COLUMN deploy_strategy;
@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN deploy_strategy text NOT NULL DEFAULT 'recreate';
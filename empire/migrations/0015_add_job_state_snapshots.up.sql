@@ -0,0 +1,8 @@
+CREATE TABLE job_state_snapshots (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  states json NOT NULL,
+  created_at timestamp without time zone default (now() at time zone 'utc')
+);
+
+CREATE UNIQUE INDEX index_job_state_snapshots_on_app_id ON job_state_snapshots USING btree (app_id);
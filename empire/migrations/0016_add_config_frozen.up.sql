@@ -0,0 +1 @@
+ALTER TABLE configs ADD COLUMN frozen boolean NOT NULL DEFAULT false;
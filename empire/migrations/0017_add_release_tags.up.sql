@@ -0,0 +1,8 @@
+CREATE TABLE release_tags (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  release_id uuid NOT NULL references releases(id) ON DELETE CASCADE,
+  tag text NOT NULL
+);
+
+CREATE UNIQUE INDEX index_release_tags_on_app_id_and_tag ON release_tags USING btree (app_id, tag);
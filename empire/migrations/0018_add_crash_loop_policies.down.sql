@@ -0,0 +1 @@
+DROP TABLE crash_loop_policies CASCADE;
@@ -0,0 +1,10 @@
+CREATE TABLE crash_loop_policies (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  process_type text NOT NULL,
+  threshold int NOT NULL,
+  window_minutes int NOT NULL,
+  auto_rollback boolean NOT NULL DEFAULT false
+);
+
+CREATE UNIQUE INDEX index_crash_loop_policies_on_app_id_and_process_type ON crash_loop_policies USING btree (app_id, process_type);
@@ -0,0 +1,8 @@
+CREATE TABLE deploy_frequency_targets (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  releases_per_week int NOT NULL,
+  alert_channel text NOT NULL DEFAULT ''
+);
+
+CREATE UNIQUE INDEX index_deploy_frequency_targets_on_app_id ON deploy_frequency_targets USING btree (app_id);
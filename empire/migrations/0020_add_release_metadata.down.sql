@@ -0,0 +1,2 @@
+ALTER TABLE releases DROP COLUMN commit_sha;
+ALTER TABLE releases DROP COLUMN branch;
@@ -0,0 +1,8 @@
+ALTER TABLE releases ADD COLUMN commit_sha text NOT NULL DEFAULT '';
+ALTER TABLE releases ADD COLUMN branch text NOT NULL DEFAULT '';
+
+-- Releases are searched with ILIKE, which can't use a btree index. On large
+-- installations, a trigram index speeds up searches:
+--
+--   CREATE EXTENSION IF NOT EXISTS pg_trgm;
+--   CREATE INDEX index_releases_on_search ON releases USING gin ((description || ' ' || commit_sha || ' ' || branch) gin_trgm_ops);
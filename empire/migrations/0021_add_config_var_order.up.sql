@@ -0,0 +1 @@
+ALTER TABLE configs ADD COLUMN var_order json NOT NULL DEFAULT '[]';
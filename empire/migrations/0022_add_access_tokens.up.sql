@@ -0,0 +1,9 @@
+CREATE TABLE access_tokens (
+  id uuid NOT NULL primary key,
+  user_name text NOT NULL,
+  scopes text NOT NULL DEFAULT '',
+  created_at timestamp without time zone default (now() at time zone 'utc'),
+  last_used_at timestamp without time zone
+);
+
+CREATE INDEX index_access_tokens_on_created_at ON access_tokens USING btree (created_at);
@@ -0,0 +1,2 @@
+DROP TABLE pending_destroys;
+ALTER TABLE apps DROP COLUMN destroy_scheduled_at;
@@ -0,0 +1,14 @@
+ALTER TABLE apps ADD COLUMN destroy_scheduled_at timestamp without time zone;
+
+-- Not a foreign key, so that the record outlives the app once the destroy has
+-- been executed.
+CREATE TABLE pending_destroys (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL,
+  scheduled_at timestamp without time zone NOT NULL,
+  executes_at timestamp without time zone NOT NULL,
+  cancelled_at timestamp without time zone,
+  executed_at timestamp without time zone
+);
+
+CREATE INDEX index_pending_destroys_on_app_id ON pending_destroys USING btree (app_id);
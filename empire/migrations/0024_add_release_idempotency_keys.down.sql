@@ -0,0 +1,2 @@
+DROP INDEX index_releases_on_app_id_and_idempotency_key;
+ALTER TABLE releases DROP COLUMN idempotency_key;
@@ -0,0 +1,2 @@
+ALTER TABLE releases ADD COLUMN idempotency_key text NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX index_releases_on_app_id_and_idempotency_key ON releases USING btree (app_id, idempotency_key) WHERE idempotency_key <> '';
@@ -0,0 +1,8 @@
+CREATE TABLE app_annotations (
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  key text NOT NULL,
+  value text NOT NULL
+);
+
+CREATE UNIQUE INDEX index_app_annotations_on_app_id_and_key ON app_annotations USING btree (app_id, key);
+CREATE INDEX index_app_annotations_on_key_and_value ON app_annotations USING btree (key, value);
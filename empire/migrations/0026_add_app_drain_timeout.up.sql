@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN drain_timeout_seconds integer NOT NULL DEFAULT 30;
@@ -0,0 +1,2 @@
+ALTER TABLE releases DROP COLUMN approved_by;
+ALTER TABLE releases DROP COLUMN status;
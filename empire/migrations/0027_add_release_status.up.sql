@@ -0,0 +1,2 @@
+ALTER TABLE releases ADD COLUMN status text NOT NULL DEFAULT 'active';
+ALTER TABLE releases ADD COLUMN approved_by text NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+CREATE TABLE webhook_delivery_attempts (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  webhook_id text NOT NULL,
+  url text NOT NULL,
+  payload json NOT NULL,
+  attempted_at timestamp without time zone NOT NULL,
+  status_code integer,
+  error text,
+  next_retry_at timestamp without time zone NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  status text NOT NULL DEFAULT 'pending'
+);
+
+CREATE INDEX index_webhook_delivery_attempts_on_next_retry_at ON webhook_delivery_attempts USING btree (next_retry_at) WHERE status = 'pending';
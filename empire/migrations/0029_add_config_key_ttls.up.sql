@@ -0,0 +1,9 @@
+CREATE TABLE config_key_ttls (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  key text NOT NULL,
+  expires_at timestamp without time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX index_config_key_ttls_on_app_id_and_key ON config_key_ttls USING btree (app_id, key);
+CREATE INDEX index_config_key_ttls_on_expires_at ON config_key_ttls USING btree (expires_at);
@@ -0,0 +1 @@
+DROP TABLE config_defaults;
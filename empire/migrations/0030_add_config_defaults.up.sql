@@ -0,0 +1,4 @@
+CREATE TABLE config_defaults (
+  key text NOT NULL primary key,
+  value text NOT NULL
+);
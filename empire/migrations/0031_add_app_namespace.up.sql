@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN namespace text NOT NULL DEFAULT '';
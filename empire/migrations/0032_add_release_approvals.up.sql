@@ -0,0 +1,12 @@
+CREATE TABLE release_approvals (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  release_id uuid NOT NULL references releases(id) ON DELETE CASCADE,
+  status text NOT NULL,
+  decided_by text NOT NULL DEFAULT '',
+  reason text NOT NULL DEFAULT '',
+  expires_at timestamp without time zone NOT NULL,
+  created_at timestamp without time zone NOT NULL,
+  decided_at timestamp without time zone
+);
+
+CREATE INDEX index_release_approvals_on_release_id ON release_approvals USING btree (release_id);
@@ -0,0 +1 @@
+DROP TABLE process_command_overrides;
@@ -0,0 +1,9 @@
+CREATE TABLE process_command_overrides (
+  id uuid NOT NULL DEFAULT uuid_generate_v4() primary key,
+  app_id uuid NOT NULL references apps(id) ON DELETE CASCADE,
+  process_type text NOT NULL,
+  command text NOT NULL,
+  created_at timestamp without time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX index_process_command_overrides_on_app_id_and_process_type ON process_command_overrides USING btree (app_id, process_type);
@@ -0,0 +1 @@
+ALTER TABLE apps ADD COLUMN validate_command text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE deploy_frequency_targets DROP COLUMN last_evaluated_at;
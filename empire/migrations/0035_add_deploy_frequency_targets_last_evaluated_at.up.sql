@@ -0,0 +1 @@
+ALTER TABLE deploy_frequency_targets ADD COLUMN last_evaluated_at timestamp without time zone;
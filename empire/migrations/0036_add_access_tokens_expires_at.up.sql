@@ -0,0 +1 @@
+ALTER TABLE access_tokens ADD COLUMN expires_at timestamp without time zone;
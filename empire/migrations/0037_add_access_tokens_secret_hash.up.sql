@@ -0,0 +1 @@
+ALTER TABLE access_tokens ADD COLUMN secret_hash text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE slugs DROP COLUMN resolved_image_id;
@@ -0,0 +1 @@
+ALTER TABLE slugs ADD COLUMN resolved_image_id text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE job_state_snapshots DROP COLUMN generation;
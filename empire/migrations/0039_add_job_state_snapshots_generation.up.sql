@@ -0,0 +1 @@
+ALTER TABLE job_state_snapshots ADD COLUMN generation integer NOT NULL DEFAULT 0;
@@ -0,0 +1,217 @@
+package empire
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+// Severity is the severity of a Notification.
+type Severity string
+
+// Notification severities.
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Notification event types.
+const (
+	NotificationDeploy          = "deploy"
+	NotificationDeployFailed    = "deploy_failed"
+	NotificationRollback        = "rollback"
+	NotificationCrashLoop       = "crash_loop"
+	NotificationConfigCopy      = "config_copy"
+	NotificationSLO             = "deploy_frequency_slo"
+	NotificationPromote         = "promote_to_stable"
+	NotificationCommandOverride = "command_override"
+)
+
+// DefaultPagerDutyURL is the url of the PagerDuty Events API v2.
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Notification represents something that happened within Empire that someone
+// should be told about.
+type Notification struct {
+	Severity Severity
+
+	// The name of the app that this notification relates to.
+	App string
+
+	// The type of event, e.g. "deploy" or "rollback".
+	Event string
+
+	// A human readable message.
+	Message string
+
+	// An optional channel that the notification should be sent to, for
+	// NotificationChannels that support more than one, e.g. a Slack
+	// channel.
+	Channel string
+}
+
+// NotificationChannel represents a place that notifications can be sent to.
+type NotificationChannel interface {
+	Notify(context.Context, Notification) error
+}
+
+// notifier sends notifications to all of the channels.
+type notifier struct {
+	channels []NotificationChannel
+
+	// Tracks the notifications that are still being sent.
+	wg sync.WaitGroup
+}
+
+// newNotifier returns a notifier that sends notifications to the channels.
+func newNotifier(channels ...NotificationChannel) *notifier {
+	return &notifier{channels: channels}
+}
+
+// Notify sends the notification to every channel in the background, so that a
+// slow channel doesn't hold up the operation that triggered the notification.
+// Errors are reported. A nil notifier doesn't send anything.
+func (n *notifier) Notify(ctx context.Context, notification Notification) {
+	if n == nil {
+		return
+	}
+
+	for _, c := range n.channels {
+		n.wg.Add(1)
+		go func(c NotificationChannel) {
+			defer n.wg.Done()
+
+			if err := c.Notify(ctx, notification); err != nil {
+				reporter.Report(ctx, err)
+			}
+		}(c)
+	}
+}
+
+// Wait blocks until all of the notifications that have been sent are
+// delivered.
+func (n *notifier) Wait() {
+	n.wg.Wait()
+}
+
+// SlackNotificationChannel is a NotificationChannel that posts notifications
+// to a Slack incoming webhook.
+type SlackNotificationChannel struct {
+	// The Slack incoming webhook url.
+	URL string
+
+	// The http.Client to use. Defaults to a client that times out after
+	// DefaultWebhookTimeout.
+	Client *http.Client
+
+	// Failed deliveries are queued here to be retried.
+	deadLetters deadLetterQueue
+}
+
+func (c *SlackNotificationChannel) setDeadLetters(q deadLetterQueue) {
+	c.deadLetters = q
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Notify implements the NotificationChannel interface.
+func (c *SlackNotificationChannel) Notify(ctx context.Context, n Notification) error {
+	colors := map[Severity]string{
+		SeverityInfo:     "good",
+		SeverityWarning:  "warning",
+		SeverityCritical: "danger",
+	}
+
+	return sendWebhook(c.Client, c.deadLetters, "slack", c.URL, &slackMessage{
+		Channel: n.Channel,
+		Text:    n.Message,
+		Attachments: []slackAttachment{
+			{
+				Color: colors[n.Severity],
+				Fields: []slackField{
+					{Title: "App", Value: n.App, Short: true},
+					{Title: "Event", Value: n.Event, Short: true},
+					{Title: "Severity", Value: string(n.Severity), Short: true},
+				},
+			},
+		},
+	})
+}
+
+// PagerDutyNotificationChannel is a NotificationChannel that triggers events
+// using the PagerDuty Events API v2. Only critical notifications are sent, so
+// that routine events don't page anyone.
+type PagerDutyNotificationChannel struct {
+	// The integration key for the PagerDuty service.
+	RoutingKey string
+
+	// The url of the Events API. Defaults to DefaultPagerDutyURL.
+	URL string
+
+	// The http.Client to use. Defaults to a client that times out after
+	// DefaultWebhookTimeout.
+	Client *http.Client
+
+	// Failed deliveries are queued here to be retried.
+	deadLetters deadLetterQueue
+}
+
+func (c *PagerDutyNotificationChannel) setDeadLetters(q deadLetterQueue) {
+	c.deadLetters = q
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+type pagerDutyPayload struct {
+	Summary   string `json:"summary"`
+	Source    string `json:"source"`
+	Severity  string `json:"severity"`
+	Component string `json:"component"`
+	Class     string `json:"class"`
+}
+
+// Notify implements the NotificationChannel interface.
+func (c *PagerDutyNotificationChannel) Notify(ctx context.Context, n Notification) error {
+	if n.Severity != SeverityCritical {
+		return nil
+	}
+
+	url := c.URL
+	if url == "" {
+		url = DefaultPagerDutyURL
+	}
+
+	return sendWebhook(c.Client, c.deadLetters, "pagerduty", url, &pagerDutyEvent{
+		RoutingKey:  c.RoutingKey,
+		EventAction: "trigger",
+		Payload: pagerDutyPayload{
+			Summary:   n.Message,
+			Source:    "empire",
+			Severity:  string(n.Severity),
+			Component: n.App,
+			Class:     n.Event,
+		},
+	})
+}
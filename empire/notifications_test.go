@@ -0,0 +1,188 @@
+package empire
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestSlackNotificationChannel(t *testing.T) {
+	var msg slackMessage
+	s := newNotificationServer(t, &msg)
+	defer s.Close()
+
+	c := &SlackNotificationChannel{URL: s.URL}
+
+	if err := c.Notify(context.Background(), Notification{
+		Severity: SeverityCritical,
+		App:      "acme-inc",
+		Event:    NotificationDeployFailed,
+		Message:  "Failed to deploy remind101/acme-inc:latest",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := msg.Text, "Failed to deploy remind101/acme-inc:latest"; got != want {
+		t.Fatalf("Text => %s; want %s", got, want)
+	}
+
+	a := msg.Attachments[0]
+
+	if got, want := a.Color, "danger"; got != want {
+		t.Fatalf("Color => %s; want %s", got, want)
+	}
+
+	fields := make(map[string]string)
+	for _, f := range a.Fields {
+		fields[f.Title] = f.Value
+	}
+
+	for k, v := range map[string]string{"App": "acme-inc", "Event": "deploy_failed", "Severity": "critical"} {
+		if got, want := fields[k], v; got != want {
+			t.Fatalf("%s => %s; want %s", k, got, want)
+		}
+	}
+}
+
+func TestPagerDutyNotificationChannel(t *testing.T) {
+	var event pagerDutyEvent
+	s := newNotificationServer(t, &event)
+	defer s.Close()
+
+	c := &PagerDutyNotificationChannel{URL: s.URL, RoutingKey: "key"}
+
+	if err := c.Notify(context.Background(), Notification{
+		Severity: SeverityCritical,
+		App:      "acme-inc",
+		Event:    NotificationDeployFailed,
+		Message:  "Failed to deploy remind101/acme-inc:latest",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		got, want string
+	}{
+		{event.RoutingKey, "key"},
+		{event.EventAction, "trigger"},
+		{event.Payload.Summary, "Failed to deploy remind101/acme-inc:latest"},
+		{event.Payload.Severity, "critical"},
+		{event.Payload.Component, "acme-inc"},
+		{event.Payload.Class, "deploy_failed"},
+	}
+
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Fatalf("#%d: %s; want %s", i, tt.got, tt.want)
+		}
+	}
+}
+
+func TestPagerDutyNotificationChannel_NotCritical(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to PagerDuty")
+	}))
+	defer s.Close()
+
+	c := &PagerDutyNotificationChannel{URL: s.URL, RoutingKey: "key"}
+
+	if err := c.Notify(context.Background(), Notification{
+		Severity: SeverityInfo,
+		App:      "acme-inc",
+		Event:    NotificationDeploy,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotificationChannel_Error(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer s.Close()
+
+	c := &SlackNotificationChannel{URL: s.URL}
+
+	if err := c.Notify(context.Background(), Notification{}); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+func TestNotifier_Async(t *testing.T) {
+	block := make(chan struct{})
+	c := &blockingNotificationChannel{block: block}
+	n := newNotifier(c)
+
+	done := make(chan struct{})
+	go func() {
+		n.Notify(context.Background(), Notification{Event: NotificationDeploy})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Notify to not wait for the channel")
+	}
+
+	close(block)
+	n.Wait()
+
+	if got, want := c.notifications, 1; got != want {
+		t.Fatalf("notifications => %d; want %d", got, want)
+	}
+}
+
+func TestSendWebhook_Timeout(t *testing.T) {
+	timeout := DefaultWebhookTimeout
+	DefaultWebhookTimeout = 10 * time.Millisecond
+	defer func() { DefaultWebhookTimeout = timeout }()
+
+	block := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer s.Close()
+	defer close(block)
+
+	c := &SlackNotificationChannel{URL: s.URL}
+
+	if err := c.Notify(context.Background(), Notification{}); err == nil {
+		t.Fatal("Expected an error")
+	}
+}
+
+// blockingNotificationChannel is a NotificationChannel that counts the
+// notifications it receives, after block is closed.
+type blockingNotificationChannel struct {
+	block         chan struct{}
+	notifications int
+}
+
+func (c *blockingNotificationChannel) Notify(ctx context.Context, n Notification) error {
+	<-c.block
+	c.notifications++
+	return nil
+}
+
+// newNotificationServer returns an httptest.Server that asserts that the
+// request is a POST and json decodes the body into v.
+func newNotificationServer(t testing.TB, v interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Method, "POST"; got != want {
+			t.Errorf("Method => %s; want %s", got, want)
+		}
+
+		if got, want := r.Header.Get("Content-Type"), "application/json"; got != want {
+			t.Errorf("Content-Type => %s; want %s", got, want)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+			t.Error(err)
+		}
+	}))
+}
@@ -56,7 +56,7 @@ func (c *Client) UpdateAppService(ctx context.Context, app string, input *ecs.Up
 }
 
 // RegisterAppTaskDefinition register a task definition for the app.
-func (c *Client) RegisterAppTaskDefinition(ctx context.Context, app string, input *ecs.RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error) {
+func (c *Client) RegisterAppTaskDefinition(ctx context.Context, app string, input *RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error) {
 	input.Family = c.prefix(app, input.Family)
 	return c.ECS.RegisterTaskDefinition(ctx, input)
 }
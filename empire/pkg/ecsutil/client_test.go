@@ -177,6 +177,37 @@ func TestListAppTasks_Paginate(t *testing.T) {
 	}
 }
 
+func TestRegisterAppTaskDefinition_StopTimeouts(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.RegisterTaskDefinition",
+				Body:       `{"containerDefinitions":[{"memory":128,"name":"web","stopTimeout":120},{"memory":128,"name":"worker"}],"family":"1234--web"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"taskDefinition":{"family":"1234--web"}}`,
+			},
+		},
+	})
+	m, s := newTestClient(h)
+	defer s.Close()
+
+	if _, err := m.RegisterAppTaskDefinition(context.Background(), "1234", &RegisterTaskDefinitionInput{
+		RegisterTaskDefinitionInput: &ecs.RegisterTaskDefinitionInput{
+			Family: aws.String("web"),
+			ContainerDefinitions: []*ecs.ContainerDefinition{
+				{Name: aws.String("web"), Memory: aws.Long(128)},
+				{Name: aws.String("worker"), Memory: aws.Long(128)},
+			},
+		},
+		StopTimeouts: map[string]int64{"web": 120},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func newTestClient(h http.Handler) (*Client, *httptest.Server) {
 	s := httptest.NewServer(h)
 
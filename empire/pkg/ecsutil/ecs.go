@@ -1,6 +1,7 @@
 package ecsutil
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -13,7 +14,7 @@ import (
 // ECS represents our ECS client interface.
 type ECS interface {
 	// Task Definitions
-	RegisterTaskDefinition(context.Context, *ecs.RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error)
+	RegisterTaskDefinition(context.Context, *RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error)
 	DescribeTaskDefinition(context.Context, *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error)
 
 	// Services
@@ -29,6 +30,18 @@ type ECS interface {
 	DescribeTasks(context.Context, *ecs.DescribeTasksInput) (*ecs.DescribeTasksOutput, error)
 }
 
+// RegisterTaskDefinitionInput is an ecs.RegisterTaskDefinitionInput with
+// container definition parameters that the vendored aws-sdk-go doesn't support,
+// which are added to the request body.
+type RegisterTaskDefinitionInput struct {
+	*ecs.RegisterTaskDefinitionInput
+
+	// The number of seconds to wait for each container to exit after it's
+	// sent SIGTERM, before it's killed, by container name. Containers
+	// without one use the agent's ECS_CONTAINER_STOP_TIMEOUT.
+	StopTimeouts map[string]int64
+}
+
 // newECSClient builds a new ECS client with autopagination and tracing.
 func newECSClient(config *aws.Config) ECS {
 	ecs := ecs.New(config)
@@ -67,7 +80,7 @@ func (c *ecsClient) UpdateService(ctx context.Context, input *ecs.UpdateServiceI
 	return resp, err
 }
 
-func (c *ecsClient) RegisterTaskDefinition(ctx context.Context, input *ecs.RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error) {
+func (c *ecsClient) RegisterTaskDefinition(ctx context.Context, input *RegisterTaskDefinitionInput) (*ecs.RegisterTaskDefinitionOutput, error) {
 	if c.tdThrottle == nil {
 		// Only allow 1 task definition per second.
 		c.tdThrottle = time.NewTicker(time.Second)
@@ -76,11 +89,54 @@ func (c *ecsClient) RegisterTaskDefinition(ctx context.Context, input *ecs.Regis
 	<-c.tdThrottle.C
 
 	ctx, done := trace.Trace(ctx)
-	resp, err := c.ECS.RegisterTaskDefinition(input)
+	req, resp := c.ECS.RegisterTaskDefinitionRequest(input.RegisterTaskDefinitionInput)
+	if len(input.StopTimeouts) > 0 {
+		req.Handlers.Build.PushBack(func(r *aws.Request) {
+			addStopTimeouts(r, input.StopTimeouts)
+		})
+	}
+	err := req.Send()
 	done(err, "RegisterTaskDefinition", "family", stringField(input.Family))
 	return resp, err
 }
 
+// addStopTimeouts adds the stopTimeout parameter to the container definitions
+// in the body of a RegisterTaskDefinition request.
+func addStopTimeouts(r *aws.Request, timeouts map[string]int64) {
+	if r.Error != nil || r.Body == nil {
+		return
+	}
+
+	var body map[string]interface{}
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		r.Error = err
+		return
+	}
+
+	containers, _ := body["containerDefinitions"].([]interface{})
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := container["name"].(string)
+		if timeout, ok := timeouts[name]; ok {
+			container["stopTimeout"] = timeout
+		}
+	}
+
+	buf, err := json.Marshal(body)
+	if err != nil {
+		r.Error = err
+		return
+	}
+
+	r.SetBufferBody(buf)
+}
+
 func (c *ecsClient) DescribeTaskDefinition(ctx context.Context, input *ecs.DescribeTaskDefinitionInput) (*ecs.DescribeTaskDefinitionOutput, error) {
 	ctx, done := trace.Trace(ctx)
 	resp, err := c.ECS.DescribeTaskDefinition(input)
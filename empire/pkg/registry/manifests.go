@@ -0,0 +1,203 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DockerHubURL is the url of the Docker Hub's v2 registry API.
+const DockerHubURL = "https://registry-1.docker.io"
+
+// manifestTypes are the manifest media types that are accepted when checking
+// whether a manifest exists. Registries respond with a 404 for manifests that
+// exist, but can't be converted to one of the accepted types.
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v1+prettyjws",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// URL returns the url of the v2 API for a registry, as returned by Split. An
+// empty registry is the Docker Hub.
+func URL(registry string) string {
+	if registry == "" {
+		return DockerHubURL
+	}
+
+	return "https://" + registry
+}
+
+// Credentials are used to authenticate with a registry.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// ManifestExists makes a HEAD request for the manifest of the tag in the
+// registry at baseURL, without pulling any layers. When the registry responds
+// with a bearer token challenge, a token is requested from the realm using
+// the credentials, and the request is retried with it.
+func ManifestExists(c *http.Client, baseURL, path, tag string, creds Credentials) (bool, error) {
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", strings.TrimSuffix(baseURL, "/"), path, tag)
+
+	resp, err := headManifest(c, u, func(req *http.Request) {
+		if creds.Username != "" {
+			req.SetBasicAuth(creds.Username, creds.Password)
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return false, fmt.Errorf("registry: unauthorized to check manifest %s", u)
+		}
+
+		token, err := bearerToken(c, challenge, creds)
+		if err != nil {
+			return false, err
+		}
+
+		resp, err = headManifest(c, u, func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("registry: checking manifest %s failed with status %d", u, resp.StatusCode)
+	}
+}
+
+// headManifest makes a HEAD request for the manifest at u, calling auth to
+// authenticate the request.
+func headManifest(c *http.Client, u string, auth func(*http.Request)) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	auth(req)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	return resp, nil
+}
+
+// bearerToken requests a token from the realm of a bearer token challenge,
+// e.g.
+//
+//	Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:remind101/acme-inc:pull"
+func bearerToken(c *http.Client, challenge string, creds Credentials) (string, error) {
+	params := parseChallenge(challenge[len("bearer "):])
+
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry: bearer challenge without a realm: %s", challenge)
+	}
+
+	q := url.Values{}
+	for _, k := range []string{"service", "scope"} {
+		if v, ok := params[k]; ok {
+			q.Set(k, v)
+		}
+	}
+
+	u := realm
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry: requesting a token from %s failed with status %d", realm, resp.StatusCode)
+	}
+
+	var t struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", err
+	}
+
+	if t.Token != "" {
+		return t.Token, nil
+	}
+
+	return t.AccessToken, nil
+}
+
+// parseChallenge parses the comma separated key="value" parameters of a
+// WWW-Authenticate challenge.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+
+		params[key] = value
+		s = strings.TrimLeft(s, ", ")
+	}
+
+	return params
+}
@@ -1,6 +1,11 @@
 package registry
 
-import "testing"
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
 
 func TestSplitRepo(t *testing.T) {
 	tests := []struct {
@@ -31,3 +36,101 @@ func TestSplitRepo(t *testing.T) {
 		}
 	}
 }
+
+func TestManifestExists(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Method, "HEAD"; got != want {
+			t.Errorf("Method => %s; want %s", got, want)
+		}
+
+		if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+			w.WriteHeader(401)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/remind101/acme-inc/manifests/v1":
+			w.WriteHeader(200)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+
+	creds := Credentials{Username: "user", Password: "pass"}
+
+	tests := []struct {
+		tag    string
+		exists bool
+	}{
+		{"v1", true},
+		{"v2", false},
+	}
+
+	for i, tt := range tests {
+		exists, err := ManifestExists(nil, s.URL, "remind101/acme-inc", tt.tag, creds)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		if got, want := exists, tt.exists; got != want {
+			t.Fatalf("#%d: exists => %v; want %v", i, got, want)
+		}
+	}
+
+	if _, err := ManifestExists(nil, s.URL, "remind101/acme-inc", "v1", Credentials{}); err == nil {
+		t.Fatal("Expected an error without credentials")
+	}
+}
+
+func TestManifestExists_BearerToken(t *testing.T) {
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if got, want := r.URL.Query().Get("scope"), "repository:remind101/acme-inc:pull"; got != want {
+				t.Errorf("scope => %s; want %s", got, want)
+			}
+
+			if u, p, _ := r.BasicAuth(); u != "user" || p != "pass" {
+				w.WriteHeader(401)
+				return
+			}
+
+			w.Write([]byte(`{"token":"abcd"}`))
+		case "/v2/remind101/acme-inc/manifests/v1":
+			if r.Header.Get("Authorization") != "Bearer abcd" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="`+s.URL+`/token",service="registry",scope="repository:remind101/acme-inc:pull"`)
+				w.WriteHeader(401)
+				return
+			}
+
+			w.WriteHeader(200)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+
+	exists, err := ManifestExists(nil, s.URL, "remind101/acme-inc", "v1", Credentials{Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !exists {
+		t.Fatal("Expected the manifest to exist")
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	got := parseChallenge(`realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:remind101/acme-inc:pull,push"`)
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:remind101/acme-inc:pull,push",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseChallenge => %v; want %v", got, want)
+	}
+}
@@ -3,7 +3,11 @@ package service
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -18,6 +22,14 @@ import (
 
 var DefaultDelimiter = "-"
 
+// ExitPollInterval is how often WaitForExit checks whether a task has
+// stopped.
+var ExitPollInterval = 5 * time.Second
+
+// DefaultMaxConcurrency is the default number of processes that Submit will
+// create or update at the same time.
+const DefaultMaxConcurrency = 5
+
 // ECSManager is an implementation of the ServiceManager interface that
 // is backed by Amazon ECS.
 type ECSManager struct {
@@ -25,6 +37,10 @@ type ECSManager struct {
 
 	cluster string
 	ecs     *ecsutil.Client
+
+	// The maximum number of processes to create or update at the same
+	// time. Zero means DefaultMaxConcurrency.
+	maxConcurrency int
 }
 
 // ECSConfig holds configuration for generating a new ECS backed Manager
@@ -54,6 +70,10 @@ type ECSConfig struct {
 	// The Subnet IDs to assign when creating external load balancers.
 	ExternalSubnetIDs []string
 
+	// The maximum number of processes that Submit will create or update at
+	// the same time. Defaults to DefaultMaxConcurrency.
+	MaxConcurrency int
+
 	// AWS configuration.
 	AWS *aws.Config
 }
@@ -75,6 +95,7 @@ func NewECSManager(config ECSConfig) (*ECSManager, error) {
 		cluster:        config.Cluster,
 		ProcessManager: pm,
 		ecs:            c,
+		maxConcurrency: config.MaxConcurrency,
 	}, nil
 }
 
@@ -122,6 +143,7 @@ func NewLoadBalancedECSManager(config ECSConfig) (*ECSManager, error) {
 		cluster:        config.Cluster,
 		ProcessManager: pm,
 		ecs:            c,
+		maxConcurrency: config.MaxConcurrency,
 	}, nil
 }
 
@@ -169,10 +191,8 @@ func (m *ECSManager) Submit(ctx context.Context, app *App) error {
 		return err
 	}
 
-	for _, p := range app.Processes {
-		if err := m.CreateProcess(ctx, app, p); err != nil {
-			return err
-		}
+	if err := m.createProcesses(ctx, app); err != nil {
+		return err
 	}
 
 	toRemove := diffProcessTypes(processes, app.Processes)
@@ -185,6 +205,45 @@ func (m *ECSManager) Submit(ctx context.Context, app *App) error {
 	return nil
 }
 
+// createProcesses creates all of the apps processes in parallel, limited to
+// maxConcurrency at a time. The first error is returned after all processes
+// have been attempted.
+func (m *ECSManager) createProcesses(ctx context.Context, app *App) error {
+	n := m.maxConcurrency
+	if n <= 0 {
+		n = DefaultMaxConcurrency
+	}
+
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, n)
+		errs = make(chan error, len(app.Processes))
+	)
+
+	for _, p := range app.Processes {
+		wg.Add(1)
+		go func(p *Process) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			errs <- m.CreateProcess(ctx, app, p)
+		}(p)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Remove removes any ECS services that belong to this app.
 func (m *ECSManager) Remove(ctx context.Context, appID string) error {
 	processes, err := m.Processes(ctx, appID)
@@ -267,6 +326,101 @@ func (m *ECSManager) Stop(ctx context.Context, instanceID string) error {
 	return err
 }
 
+// SendSignal delivers SIGTERM or SIGKILL to the task by stopping it. ECS can't
+// send arbitrary signals to a task. Stopping a task sends SIGTERM to the
+// container, followed by SIGKILL if it doesn't exit within its stop timeout,
+// so other signals return ErrSignalNotSupported rather than stopping the task.
+func (m *ECSManager) SendSignal(ctx context.Context, instanceID string, sig os.Signal) error {
+	switch sig {
+	case syscall.SIGTERM, syscall.SIGKILL:
+		return m.Stop(ctx, instanceID)
+	default:
+		return ErrSignalNotSupported
+	}
+}
+
+// WaitForExit polls the task until it reaches the STOPPED state. It polls
+// every ExitPollInterval, but never waits past the timeout, and returns early
+// with the context's error if the context is cancelled.
+func (m *ECSManager) WaitForExit(ctx context.Context, instanceID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		resp, err := m.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+			Cluster: aws.String(m.cluster),
+			Tasks:   []*string{aws.String(instanceID)},
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(resp.Tasks) == 0 || safeString(resp.Tasks[0].LastStatus) == "STOPPED" {
+			return nil
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return ErrWaitTimeout
+		}
+
+		wait := ExitPollInterval
+		if remaining < wait {
+			wait = remaining
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// InstanceExit describes the container of the stopped task. ECS only keeps
+// stopped tasks around for a short time, after which nil is returned.
+func (m *ECSManager) InstanceExit(ctx context.Context, instanceID string) (*InstanceExit, error) {
+	resp, err := m.ecs.DescribeTasks(ctx, &ecs.DescribeTasksInput{
+		Cluster: aws.String(m.cluster),
+		Tasks:   []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Tasks) == 0 || safeString(resp.Tasks[0].LastStatus) != "STOPPED" {
+		return nil, nil
+	}
+
+	exit := &InstanceExit{}
+
+	// Tasks have a single container, for the process.
+	if containers := resp.Tasks[0].Containers; len(containers) > 0 {
+		c := containers[0]
+		if c.ExitCode != nil {
+			code := int(*c.ExitCode)
+			exit.ExitCode = &code
+		}
+		exit.Reason = safeString(c.Reason)
+	}
+
+	return exit, nil
+}
+
+// Metrics is not supported by ECS, which doesn't expose per task resource
+// usage through its API.
+func (m *ECSManager) Metrics(ctx context.Context, appID string) ([]*InstanceMetrics, error) {
+	return nil, ErrMetricsUnavailable
+}
+
+// Validate checks the task definition that would be registered for the
+// process against the limits that ECS enforces. ECS has no dry run mode, so
+// this doesn't make any API calls.
+func (m *ECSManager) Validate(ctx context.Context, app *App, process *Process) error {
+	return validateTaskDefinition(taskDefinitionInput(process).RegisterTaskDefinitionInput)
+}
+
 var _ ProcessManager = &ecsProcessManager{}
 
 // ecsProcessManager is an implementation of the ProcessManager interface that
@@ -420,9 +574,9 @@ func (m *ecsProcessManager) Scale(ctx context.Context, app string, process strin
 	return err
 }
 
-// taskDefinitionInput returns an ecs.RegisterTaskDefinitionInput suitable for
-// creating a task definition from a Process.
-func taskDefinitionInput(p *Process) *ecs.RegisterTaskDefinitionInput {
+// taskDefinitionInput returns an ecsutil.RegisterTaskDefinitionInput suitable
+// for creating a task definition from a Process.
+func taskDefinitionInput(p *Process) *ecsutil.RegisterTaskDefinitionInput {
 	var command []*string
 	for _, s := range strings.Split(p.Command, " ") {
 		ss := s
@@ -430,10 +584,10 @@ func taskDefinitionInput(p *Process) *ecs.RegisterTaskDefinitionInput {
 	}
 
 	var environment []*ecs.KeyValuePair
-	for k, v := range p.Env {
+	for _, k := range p.EnvKeys() {
 		environment = append(environment, &ecs.KeyValuePair{
 			Name:  aws.String(k),
-			Value: aws.String(v),
+			Value: aws.String(p.Env[k]),
 		})
 	}
 
@@ -445,7 +599,14 @@ func taskDefinitionInput(p *Process) *ecs.RegisterTaskDefinitionInput {
 		})
 	}
 
-	return &ecs.RegisterTaskDefinitionInput{
+	// Without a stop timeout, the agent's ECS_CONTAINER_STOP_TIMEOUT
+	// applies.
+	var stopTimeouts map[string]int64
+	if p.StopTimeout > 0 {
+		stopTimeouts = map[string]int64{p.Type: int64(p.StopTimeout / time.Second)}
+	}
+
+	input := &ecs.RegisterTaskDefinitionInput{
 		Family: aws.String(p.Type),
 		ContainerDefinitions: []*ecs.ContainerDefinition{
 			&ecs.ContainerDefinition{
@@ -460,6 +621,39 @@ func taskDefinitionInput(p *Process) *ecs.RegisterTaskDefinitionInput {
 			},
 		},
 	}
+
+	return &ecsutil.RegisterTaskDefinitionInput{
+		RegisterTaskDefinitionInput: input,
+		StopTimeouts:                stopTimeouts,
+	}
+}
+
+// Limits that ECS enforces on container definitions.
+const (
+	ecsMinMemoryMB = 4
+	ecsMaxCPU      = 10240
+)
+
+// validateTaskDefinition returns an error if ECS would reject the task
+// definition.
+func validateTaskDefinition(input *ecs.RegisterTaskDefinitionInput) error {
+	for _, c := range input.ContainerDefinitions {
+		name := safeString(c.Name)
+
+		if safeString(c.Image) == "" {
+			return fmt.Errorf("%s: image is required", name)
+		}
+
+		if c.Memory == nil || *c.Memory < ecsMinMemoryMB {
+			return fmt.Errorf("%s: memory must be at least %dMB", name, ecsMinMemoryMB)
+		}
+
+		if c.CPU != nil && *c.CPU > ecsMaxCPU {
+			return fmt.Errorf("%s: cpu shares cannot be more than %d", name, ecsMaxCPU)
+		}
+	}
+
+	return nil
 }
 
 func safeString(s *string) string {
@@ -4,11 +4,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/remind101/empire/empire/pkg/awsutil"
+	. "github.com/remind101/empire/empire/pkg/bytesize"
 	"golang.org/x/net/context"
 )
 
@@ -181,6 +185,126 @@ func TestECSManager_Instances(t *testing.T) {
 	}
 }
 
+func TestECSManager_InstanceExit(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTasks",
+				Body:       `{"cluster":"empire","tasks":["ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","lastStatus":"STOPPED","containers":[{"name":"web","exitCode":137,"reason":"OutOfMemoryError: Container killed due to memory usage"}]}]}`,
+			},
+		},
+	})
+	m, s := newTestECSManager(h)
+	defer s.Close()
+
+	exit, err := m.InstanceExit(context.Background(), "ae69bb4c-3903-4844-82fe-548ac5b74570")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := 137
+	if got, want := exit, (&InstanceExit{ExitCode: &code, Reason: "OutOfMemoryError: Container killed due to memory usage"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("InstanceExit => %#v; want %#v", got, want)
+	}
+}
+
+func TestECSManager_WaitForExit_Cancel(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTasks",
+				Body:       `{"cluster":"empire","tasks":["ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","lastStatus":"RUNNING"}]}`,
+			},
+		},
+	})
+	m, s := newTestECSManager(h)
+	defer s.Close()
+
+	interval := ExitPollInterval
+	ExitPollInterval = time.Hour
+	defer func() { ExitPollInterval = interval }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := m.WaitForExit(ctx, "ae69bb4c-3903-4844-82fe-548ac5b74570", time.Hour); err != context.DeadlineExceeded {
+		t.Fatalf("err => %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestECSManager_WaitForExit_Timeout(t *testing.T) {
+	running := awsutil.Cycle{
+		Request: awsutil.Request{
+			RequestURI: "/",
+			Operation:  "AmazonEC2ContainerServiceV20141113.DescribeTasks",
+			Body:       `{"cluster":"empire","tasks":["ae69bb4c-3903-4844-82fe-548ac5b74570"]}`,
+		},
+		Response: awsutil.Response{
+			StatusCode: 200,
+			Body:       `{"tasks":[{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","lastStatus":"RUNNING"}]}`,
+		},
+	}
+	h := awsutil.NewHandler([]awsutil.Cycle{running, running})
+	m, s := newTestECSManager(h)
+	defer s.Close()
+
+	interval := ExitPollInterval
+	ExitPollInterval = time.Hour
+	defer func() { ExitPollInterval = interval }()
+
+	// The wait is cut short by the timeout, not the poll interval.
+	done := make(chan error, 1)
+	go func() {
+		done <- m.WaitForExit(context.Background(), "ae69bb4c-3903-4844-82fe-548ac5b74570", 10*time.Millisecond)
+	}()
+
+	select {
+	case err := <-done:
+		if err != ErrWaitTimeout {
+			t.Fatalf("err => %v; want %v", err, ErrWaitTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitForExit didn't return after the timeout")
+	}
+}
+
+func TestECSManager_SendSignal(t *testing.T) {
+	h := awsutil.NewHandler([]awsutil.Cycle{
+		awsutil.Cycle{
+			Request: awsutil.Request{
+				RequestURI: "/",
+				Operation:  "AmazonEC2ContainerServiceV20141113.StopTask",
+				Body:       `{"cluster":"empire","task":"ae69bb4c-3903-4844-82fe-548ac5b74570"}`,
+			},
+			Response: awsutil.Response{
+				StatusCode: 200,
+				Body:       `{"task":{"taskArn":"arn:aws:ecs:us-east-1:249285743859:task/ae69bb4c-3903-4844-82fe-548ac5b74570","lastStatus":"RUNNING"}}`,
+			},
+		},
+	})
+	m, s := newTestECSManager(h)
+	defer s.Close()
+
+	if err := m.SendSignal(context.Background(), "ae69bb4c-3903-4844-82fe-548ac5b74570", syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// Signals that ECS can't deliver don't stop the task.
+	if err := m.SendSignal(context.Background(), "ae69bb4c-3903-4844-82fe-548ac5b74570", syscall.SIGHUP); err != ErrSignalNotSupported {
+		t.Fatalf("err => %v; want %v", err, ErrSignalNotSupported)
+	}
+}
+
 func TestECSManager_Remove(t *testing.T) {
 	h := awsutil.NewHandler([]awsutil.Cycle{
 		awsutil.Cycle{
@@ -454,3 +578,162 @@ func newTestECSManager(h http.Handler) (*ECSManager, *httptest.Server) {
 
 	return m, s
 }
+
+// timingProcessManager is a ProcessManager that records when each process
+// was created, and how many were being created at the same time.
+type timingProcessManager struct {
+	ProcessManager
+
+	sync.Mutex
+	started     []time.Time
+	inFlight    int
+	maxInFlight int
+}
+
+func (m *timingProcessManager) CreateProcess(ctx context.Context, app *App, process *Process) error {
+	m.Lock()
+	m.started = append(m.started, time.Now())
+	m.inFlight++
+	if m.inFlight > m.maxInFlight {
+		m.maxInFlight = m.inFlight
+	}
+	m.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	m.Lock()
+	m.inFlight--
+	m.Unlock()
+
+	return nil
+}
+
+func (m *timingProcessManager) Processes(ctx context.Context, app string) ([]*Process, error) {
+	return nil, nil
+}
+
+func TestECSManager_Submit_Concurrent(t *testing.T) {
+	pm := &timingProcessManager{}
+	m := &ECSManager{ProcessManager: pm}
+
+	app := &App{
+		ID: "1234",
+		Processes: []*Process{
+			{Type: "web"},
+			{Type: "worker"},
+			{Type: "clock"},
+			{Type: "sidekiq"},
+		},
+	}
+
+	if err := m.Submit(context.Background(), app); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(pm.started), 4; got != want {
+		t.Fatalf("CreateProcess calls => %d; want %d", got, want)
+	}
+
+	first, last := pm.started[0], pm.started[0]
+	for _, s := range pm.started {
+		if s.Before(first) {
+			first = s
+		}
+		if s.After(last) {
+			last = s
+		}
+	}
+
+	if d := last.Sub(first); d >= 50*time.Millisecond {
+		t.Fatalf("Expected all processes to be created in parallel, took %v to start them", d)
+	}
+}
+
+func TestECSManager_Submit_MaxConcurrency(t *testing.T) {
+	pm := &timingProcessManager{}
+	m := &ECSManager{ProcessManager: pm, maxConcurrency: 2}
+
+	app := &App{
+		ID: "1234",
+		Processes: []*Process{
+			{Type: "web"},
+			{Type: "worker"},
+			{Type: "clock"},
+			{Type: "sidekiq"},
+		},
+	}
+
+	if err := m.Submit(context.Background(), app); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := pm.maxInFlight, 2; got != want {
+		t.Fatalf("Concurrent CreateProcess calls => %d; want %d", got, want)
+	}
+}
+
+func TestValidateTaskDefinition(t *testing.T) {
+	tests := []struct {
+		process *Process
+		err     string
+	}{
+		{&Process{Type: "web", Image: "remind101/acme-inc:latest", MemoryLimit: 128 * MB, CPUShares: 256}, ""},
+		{&Process{Type: "web", MemoryLimit: 128 * MB}, "web: image is required"},
+		{&Process{Type: "web", Image: "remind101/acme-inc:latest", MemoryLimit: 1 * MB}, "web: memory must be at least 4MB"},
+		{&Process{Type: "web", Image: "remind101/acme-inc:latest", MemoryLimit: 128 * MB, CPUShares: 20000}, "web: cpu shares cannot be more than 10240"},
+	}
+
+	for i, tt := range tests {
+		err := validateTaskDefinition(taskDefinitionInput(tt.process).RegisterTaskDefinitionInput)
+
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != tt.err {
+			t.Fatalf("#%d: err => %q; want %q", i, got, tt.err)
+		}
+	}
+}
+
+func TestTaskDefinitionInput_EnvOrder(t *testing.T) {
+	p := &Process{
+		Type: "web",
+		Env: map[string]string{
+			"PORT":         "8080",
+			"DATABASE_URL": "postgres://$DB_HOST/acme",
+			"DB_HOST":      "localhost",
+			"APP_ENV":      "production",
+		},
+		EnvOrder: []string{"DB_HOST", "DATABASE_URL", "MISSING"},
+	}
+
+	var names []string
+	for _, kvp := range taskDefinitionInput(p).ContainerDefinitions[0].Environment {
+		names = append(names, *kvp.Name)
+	}
+
+	if got, want := names, []string{"DB_HOST", "DATABASE_URL", "APP_ENV", "PORT"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Environment => %v; want %v", got, want)
+	}
+}
+
+func TestTaskDefinitionInput_StopTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    map[string]int64
+	}{
+		{0, nil},
+		{30 * time.Second, map[string]int64{"web": 30}},
+		{2 * time.Minute, map[string]int64{"web": 120}},
+	}
+
+	for i, tt := range tests {
+		input := taskDefinitionInput(&Process{Type: "web", StopTimeout: tt.timeout})
+
+		if got, want := input.StopTimeouts, tt.want; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d: StopTimeouts => %v; want %v", i, got, want)
+		}
+	}
+}
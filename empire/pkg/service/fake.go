@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/remind101/pkg/timex"
 	"golang.org/x/net/context"
@@ -63,3 +65,32 @@ func (m *FakeManager) Instances(ctx context.Context, appID string) ([]*Instance,
 func (m *FakeManager) Stop(ctx context.Context, instanceID string) error {
 	return nil
 }
+
+func (m *FakeManager) SendSignal(ctx context.Context, instanceID string, sig os.Signal) error {
+	return nil
+}
+
+func (m *FakeManager) WaitForExit(ctx context.Context, instanceID string, timeout time.Duration) error {
+	return nil
+}
+
+func (m *FakeManager) InstanceExit(ctx context.Context, instanceID string) (*InstanceExit, error) {
+	return nil, nil
+}
+
+func (m *FakeManager) Metrics(ctx context.Context, appID string) ([]*InstanceMetrics, error) {
+	instances, err := m.Instances(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []*InstanceMetrics
+	for _, i := range instances {
+		metrics = append(metrics, &InstanceMetrics{Instance: i})
+	}
+	return metrics, nil
+}
+
+func (m *FakeManager) Validate(ctx context.Context, app *App, process *Process) error {
+	return nil
+}
@@ -9,6 +9,25 @@ import (
 
 var ErrUnsuitableLoadBalancer = errors.New("currently assigned load balancer is not suitable for the given exposure")
 
+// keepLoadBalancersKey is the context key for KeepLoadBalancers.
+type keepLoadBalancersKey struct{}
+
+// KeepLoadBalancers returns a context that removes processes without
+// destroying their load balancers, or the CNAMEs pointed at them. Load
+// balancers are found by the app and process type, so when an app is moved to
+// another scheduler, the new scheduler adopts the load balancers that the old
+// one was using.
+func KeepLoadBalancers(ctx context.Context) context.Context {
+	return context.WithValue(ctx, keepLoadBalancersKey{}, true)
+}
+
+// LoadBalancersKept returns true if the context was returned by
+// KeepLoadBalancers.
+func LoadBalancersKept(ctx context.Context) bool {
+	keep, _ := ctx.Value(keepLoadBalancersKey{}).(bool)
+	return keep
+}
+
 // LBProcessManager is an implementation of the ProcessManager interface that creates
 // LoadBalancers when a Process is created.
 type LBProcessManager struct {
@@ -43,8 +62,12 @@ func (m *LBProcessManager) CreateProcess(ctx context.Context, app *App, p *Proce
 		if l == nil {
 			tags := lbTags(app.ID, p.Type)
 
-			// Add "App" tag so that a CNAME can be created.
-			tags[lb.AppTag] = app.Name
+			// Add "App" tag so that a CNAME can be created. Canary
+			// processes are removed when the canary is promoted or
+			// rolled back, which would delete the CNAME with them.
+			if !p.Canary {
+				tags[lb.AppTag] = app.Name
+			}
 
 			l, err = m.lb.CreateLoadBalancer(ctx, lb.CreateLoadBalancerOpts{
 				InstancePort: *p.Ports[0].Host, // TODO: Check that the process has ports.
@@ -65,12 +88,17 @@ func (m *LBProcessManager) CreateProcess(ctx context.Context, app *App, p *Proce
 	return m.ProcessManager.CreateProcess(ctx, app, p)
 }
 
-// RemoveProcess removes the process then removes the associated LoadBalancer.
+// RemoveProcess removes the process then removes the associated LoadBalancer,
+// unless the context was returned by KeepLoadBalancers.
 func (m *LBProcessManager) RemoveProcess(ctx context.Context, app string, p string) error {
 	if err := m.ProcessManager.RemoveProcess(ctx, app, p); err != nil {
 		return err
 	}
 
+	if LoadBalancersKept(ctx) {
+		return nil
+	}
+
 	l, err := m.findLoadBalancer(ctx, app, p)
 	if err != nil {
 		// TODO: Maybe we shouldn't care here.
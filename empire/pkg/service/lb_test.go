@@ -0,0 +1,200 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/remind101/empire/empire/pkg/lb"
+	"golang.org/x/net/context"
+)
+
+func TestLBProcessManager_Canary(t *testing.T) {
+	port := int64(8080)
+	web := func(canary bool) *Process {
+		p := &Process{
+			Type:     "web",
+			Exposure: ExposePrivate,
+			Ports:    []PortMap{{Host: &port}},
+		}
+		if canary {
+			p.Type = "web-canary"
+			p.Canary = true
+		}
+		return p
+	}
+
+	app := &App{ID: "1234", Name: "acme-inc"}
+
+	// Promoting and rolling back a canary both submit the app without the
+	// canary process, which removes it.
+	for _, step := range []string{"promote", "rollback"} {
+		ns := newFakeNameserver()
+		m := &LBProcessManager{
+			ProcessManager: &fakeProcessManager{},
+			lb:             lb.WithCNAME(newFakeLBManager(), ns),
+		}
+		ctx := context.Background()
+
+		if err := m.CreateProcess(ctx, app, web(false)); err != nil {
+			t.Fatal(err)
+		}
+
+		primary := ns.cnames[app.Name]
+		if primary == "" {
+			t.Fatalf("%s: Expected a CNAME for the primary load balancer", step)
+		}
+
+		// Deploy the canary.
+		if err := m.CreateProcess(ctx, app, web(true)); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := ns.cnames[app.Name]; got != primary {
+			t.Fatalf("%s: CNAME => %q after deploying the canary; want %q", step, got, primary)
+		}
+
+		if err := m.CreateProcess(ctx, app, web(false)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.RemoveProcess(ctx, app.ID, "web-canary"); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := ns.cnames[app.Name]; got != primary {
+			t.Fatalf("%s: CNAME => %q; want %q", step, got, primary)
+		}
+	}
+}
+
+func TestLBProcessManager_KeepLoadBalancers(t *testing.T) {
+	port := int64(8080)
+	web := &Process{
+		Type:     "web",
+		Exposure: ExposePrivate,
+		Ports:    []PortMap{{Host: &port}},
+	}
+	app := &App{ID: "1234", Name: "acme-inc"}
+
+	lbs := newFakeLBManager()
+	ns := newFakeNameserver()
+	m := &LBProcessManager{
+		ProcessManager: &fakeProcessManager{},
+		lb:             lb.WithCNAME(lbs, ns),
+	}
+	ctx := context.Background()
+
+	if err := m.CreateProcess(ctx, app, web); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another scheduler has adopted the load balancer, so removing the
+	// process from this one keeps it.
+	if err := m.RemoveProcess(KeepLoadBalancers(ctx), app.ID, "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(lbs.lbs), 1; got != want {
+		t.Fatalf("len(LoadBalancers) => %d; want %d", got, want)
+	}
+
+	if got, want := ns.cnames[app.Name], lbs.lbs[0].DNSName; got != want {
+		t.Fatalf("CNAME => %q; want %q", got, want)
+	}
+
+	if err := m.RemoveProcess(ctx, app.ID, "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(lbs.lbs), 0; got != want {
+		t.Fatalf("len(LoadBalancers) => %d; want %d", got, want)
+	}
+
+	if _, ok := ns.cnames[app.Name]; ok {
+		t.Fatal("Expected the CNAME to be deleted")
+	}
+}
+
+// fakeProcessManager is a ProcessManager that doesn't run any processes.
+type fakeProcessManager struct {
+	ProcessManager
+}
+
+func (m *fakeProcessManager) CreateProcess(ctx context.Context, app *App, p *Process) error {
+	return nil
+}
+
+func (m *fakeProcessManager) RemoveProcess(ctx context.Context, app string, p string) error {
+	return nil
+}
+
+// fakeLBManager is an lb.Manager that keeps load balancers in memory.
+type fakeLBManager struct {
+	lbs []*lb.LoadBalancer
+}
+
+func newFakeLBManager() *fakeLBManager {
+	return &fakeLBManager{}
+}
+
+func (m *fakeLBManager) CreateLoadBalancer(ctx context.Context, opts lb.CreateLoadBalancerOpts) (*lb.LoadBalancer, error) {
+	name := fmt.Sprintf("lb-%d", len(m.lbs)+1)
+	l := &lb.LoadBalancer{
+		Name:         name,
+		DNSName:      name + ".elb.amazonaws.com",
+		External:     opts.External,
+		SSLCert:      opts.SSLCert,
+		InstancePort: opts.InstancePort,
+		Tags:         opts.Tags,
+	}
+	m.lbs = append(m.lbs, l)
+	return l, nil
+}
+
+func (m *fakeLBManager) DestroyLoadBalancer(ctx context.Context, l *lb.LoadBalancer) error {
+	for i, existing := range m.lbs {
+		if existing.Name == l.Name {
+			m.lbs = append(m.lbs[:i], m.lbs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *fakeLBManager) LoadBalancers(ctx context.Context, tags map[string]string) ([]*lb.LoadBalancer, error) {
+	var lbs []*lb.LoadBalancer
+	for _, l := range m.lbs {
+		match := true
+		for k, v := range tags {
+			if l.Tags[k] != v {
+				match = false
+			}
+		}
+		if match {
+			lbs = append(lbs, l)
+		}
+	}
+	return lbs, nil
+}
+
+// fakeNameserver is an lb.Nameserver that keeps CNAMEs in memory. Like
+// Route53, a CNAME is only deleted if it points at the given record.
+type fakeNameserver struct {
+	cnames map[string]string
+}
+
+func newFakeNameserver() *fakeNameserver {
+	return &fakeNameserver{cnames: make(map[string]string)}
+}
+
+func (n *fakeNameserver) CreateCNAME(cname, record string) error {
+	n.cnames[cname] = record
+	return nil
+}
+
+func (n *fakeNameserver) DeleteCNAME(cname, record string) error {
+	if n.cnames[cname] == record {
+		delete(n.cnames, cname)
+	}
+	return nil
+}
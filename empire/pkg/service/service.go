@@ -3,11 +3,26 @@
 package service
 
 import (
+	"errors"
+	"os"
+	"sort"
 	"time"
 
 	"golang.org/x/net/context"
 )
 
+// ErrWaitTimeout is returned by WaitForExit when an instance is still running
+// after the timeout has elapsed.
+var ErrWaitTimeout = errors.New("service: timed out waiting for instance to exit")
+
+// ErrSignalNotSupported is returned by SendSignal when the backend can't
+// deliver the signal to an instance.
+var ErrSignalNotSupported = errors.New("service: signal not supported")
+
+// ErrMetricsUnavailable is returned by Metrics when the backend is unable to
+// report resource usage for instances.
+var ErrMetricsUnavailable = errors.New("service: metrics are not available")
+
 type Exposure int
 
 func (e Exposure) String() string {
@@ -61,6 +76,10 @@ type Process struct {
 	// Environment variables to set.
 	Env map[string]string
 
+	// The order that Env should be set in. Variables that aren't listed are
+	// set after, in alphabetical order.
+	EnvOrder []string
+
 	// Mapping of host -> container port mappings.
 	Ports []PortMap
 
@@ -82,6 +101,39 @@ type Process struct {
 
 	// An SSL Cert associated with this process.
 	SSLCert string
+
+	// How long the process is given to exit after receiving a SIGTERM,
+	// before it's killed. Zero means the scheduler's default.
+	StopTimeout time.Duration
+
+	// True if the process runs a canary release alongside the app's other
+	// processes. Load balancers for canary processes don't get the app's
+	// CNAME, which keeps pointing at the primary process' load balancer.
+	Canary bool
+}
+
+// EnvKeys returns the names of the variables in Env in the order that they
+// should be set.
+func (p *Process) EnvKeys() []string {
+	keys := make([]string, 0, len(p.Env))
+	seen := make(map[string]bool)
+
+	for _, k := range p.EnvOrder {
+		if _, ok := p.Env[k]; ok && !seen[k] {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+
+	var rest []string
+	for k := range p.Env {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(keys, rest...)
 }
 
 // Instance represents an Instance of a Process.
@@ -98,6 +150,27 @@ type Instance struct {
 	UpdatedAt time.Time
 }
 
+// InstanceExit describes how an instance stopped.
+type InstanceExit struct {
+	// The exit code of the process, or nil if the process never exited,
+	// e.g. because it couldn't be started.
+	ExitCode *int
+
+	// Why the scheduler stopped the instance, if it reported a reason.
+	Reason string
+}
+
+// InstanceMetrics represents the resource usage of an Instance.
+type InstanceMetrics struct {
+	Instance *Instance
+
+	// CPU usage, as a percentage of a single CPU.
+	CPUPercent float64
+
+	// Memory usage in bytes.
+	MemoryUsage uint
+}
+
 type Scaler interface {
 	// Scale scales an app process.
 	Scale(ctx context.Context, app string, process string, instances uint) error
@@ -119,6 +192,27 @@ type Manager interface {
 	// Stop stops an instance. The scheduler will automatically start a new
 	// instance.
 	Stop(ctx context.Context, instanceID string) error
+
+	// SendSignal sends a signal to an instance. If the backend can't
+	// deliver the signal, ErrSignalNotSupported is returned.
+	SendSignal(ctx context.Context, instanceID string, sig os.Signal) error
+
+	// WaitForExit blocks until the instance has exited. If the instance is
+	// still running after timeout, ErrWaitTimeout is returned.
+	WaitForExit(ctx context.Context, instanceID string, timeout time.Duration) error
+
+	// InstanceExit returns how a stopped instance exited. A nil
+	// InstanceExit is returned if the instance is still running, or the
+	// scheduler no longer knows about it.
+	InstanceExit(ctx context.Context, instanceID string) (*InstanceExit, error)
+
+	// Metrics returns the current resource usage of the instances of an
+	// app.
+	Metrics(ctx context.Context, app string) ([]*InstanceMetrics, error)
+
+	// Validate checks that the process could be scheduled, without
+	// scheduling it.
+	Validate(ctx context.Context, app *App, process *Process) error
 }
 
 // ProcessManager is a layer level interface than Manager, that provides direct
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultQueryTimeout is the default time that QueryTimeoutManager allows
+// queries to take.
+const DefaultQueryTimeout = 5 * time.Second
+
+// DefaultMaxAbandonedQueries is the default number of queries that
+// QueryTimeoutManager lets run on after they've timed out.
+const DefaultMaxAbandonedQueries = 10
+
+// queryGracePeriod is how long QueryTimeoutManager waits for the wrapped
+// Manager to return after the timeout.
+const queryGracePeriod = 100 * time.Millisecond
+
+// SchedulerTimeoutError is returned by QueryTimeoutManager when a query takes
+// longer than the timeout. Err is the context error.
+type SchedulerTimeoutError struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (e *SchedulerTimeoutError) Error() string {
+	return fmt.Sprintf("service: timed out querying the scheduler: %v", e.Err)
+}
+
+// QueryTimeoutManager wraps a Manager to bound the time that queries for the
+// state of an app can take, so that a slow scheduler can't block callers
+// indefinitely. When the timeout is exceeded, a SchedulerTimeoutError is
+// returned along with whatever the wrapped Manager returned before it gave
+// up.
+//
+// Queries to a Manager that doesn't respect the context keep running after
+// they time out. Once MaxAbandoned of them are still running, new queries fail
+// immediately rather than piling up more goroutines on a scheduler that isn't
+// responding.
+type QueryTimeoutManager struct {
+	Manager
+
+	// The maximum time a query can take. Defaults to
+	// DefaultQueryTimeout.
+	Timeout time.Duration
+
+	// The maximum number of timed out queries that can still be running.
+	// Defaults to DefaultMaxAbandonedQueries.
+	MaxAbandoned int
+
+	mu        sync.Mutex
+	abandoned int
+}
+
+// Instances implements the Manager interface.
+func (m *QueryTimeoutManager) Instances(ctx context.Context, app string) ([]*Instance, error) {
+	var instances []*Instance
+
+	returned, err := m.query(ctx, func(ctx context.Context) (err error) {
+		instances, err = m.Manager.Instances(ctx, app)
+		return err
+	})
+	if !returned {
+		return nil, err
+	}
+
+	return instances, err
+}
+
+// Metrics implements the Manager interface.
+func (m *QueryTimeoutManager) Metrics(ctx context.Context, app string) ([]*InstanceMetrics, error) {
+	var metrics []*InstanceMetrics
+
+	returned, err := m.query(ctx, func(ctx context.Context) (err error) {
+		metrics, err = m.Manager.Metrics(ctx, app)
+		return err
+	})
+	if !returned {
+		return nil, err
+	}
+
+	return metrics, err
+}
+
+// query calls fn with a context that's cancelled after the timeout. If the
+// timeout is exceeded, a SchedulerTimeoutError is returned after waiting at
+// most queryGracePeriod for fn to return, in case the wrapped Manager doesn't
+// respect the context. The results of fn must only be used when returned is
+// true.
+func (m *QueryTimeoutManager) query(ctx context.Context, fn func(context.Context) error) (returned bool, err error) {
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = DefaultQueryTimeout
+	}
+
+	max := m.MaxAbandoned
+	if max == 0 {
+		max = DefaultMaxAbandonedQueries
+	}
+
+	m.mu.Lock()
+	abandoned := m.abandoned
+	m.mu.Unlock()
+
+	if abandoned >= max {
+		return false, &SchedulerTimeoutError{Err: context.DeadlineExceeded}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			err = &SchedulerTimeoutError{Err: ctx.Err()}
+		}
+		return true, err
+	case <-ctx.Done():
+	}
+
+	err = ctx.Err()
+	if err == context.DeadlineExceeded {
+		err = &SchedulerTimeoutError{Err: err}
+	}
+
+	// Give Managers that respect the context a chance to return what they
+	// collected before it was cancelled.
+	select {
+	case <-done:
+		return true, err
+	case <-time.After(queryGracePeriod):
+	}
+
+	// fn is still running, so keep track of it until it returns.
+	m.mu.Lock()
+	m.abandoned++
+	m.mu.Unlock()
+
+	go func() {
+		<-done
+
+		m.mu.Lock()
+		m.abandoned--
+		m.mu.Unlock()
+	}()
+
+	return false, err
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestQueryTimeoutManager_Instances(t *testing.T) {
+	tests := []struct {
+		manager   *blockingManager
+		timeout   time.Duration
+		instances int
+		timedOut  bool
+	}{
+		// Within the timeout.
+		{&blockingManager{instances: 3}, time.Minute, 3, false},
+
+		// Exceeds the timeout, partial results are returned.
+		{&blockingManager{instances: 1, block: true}, 10 * time.Millisecond, 1, true},
+
+		// Exceeds the timeout and doesn't respect the context.
+		{&blockingManager{instances: 1, block: true, ignoreContext: true}, 10 * time.Millisecond, 0, true},
+	}
+
+	for i, tt := range tests {
+		tt.manager.release = make(chan struct{})
+		m := &QueryTimeoutManager{Manager: tt.manager, Timeout: tt.timeout}
+
+		instances, err := m.Instances(context.Background(), "app")
+		close(tt.manager.release)
+
+		if tt.timedOut {
+			terr, ok := err.(*SchedulerTimeoutError)
+			if !ok {
+				t.Fatalf("#%d: err => %v; want a SchedulerTimeoutError", i, err)
+			}
+
+			if got, want := terr.Err, context.DeadlineExceeded; got != want {
+				t.Fatalf("#%d: Err => %v; want %v", i, got, want)
+			}
+		} else if err != nil {
+			t.Fatalf("#%d: err => %v", i, err)
+		}
+
+		if got, want := len(instances), tt.instances; got != want {
+			t.Fatalf("#%d: Instances => %d; want %d", i, got, want)
+		}
+	}
+}
+
+func TestQueryTimeoutManager_MaxAbandoned(t *testing.T) {
+	b := &blockingManager{block: true, ignoreContext: true, release: make(chan struct{})}
+	m := &QueryTimeoutManager{Manager: b, Timeout: time.Millisecond, MaxAbandoned: 2}
+
+	for i := 0; i < 3; i++ {
+		if _, err := m.Instances(context.Background(), "app"); err == nil {
+			t.Fatalf("#%d: Expected an error", i)
+		}
+	}
+
+	// The third query isn't sent to the scheduler, since two are still
+	// running.
+	if got, want := b.calls(), 2; got != want {
+		t.Fatalf("calls => %d; want %d", got, want)
+	}
+
+	// Once the abandoned queries return, queries are sent again.
+	close(b.release)
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		m.mu.Lock()
+		abandoned := m.abandoned
+		m.mu.Unlock()
+
+		if abandoned == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the abandoned queries to return")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := m.Instances(context.Background(), "app"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := b.calls(), 3; got != want {
+		t.Fatalf("calls => %d; want %d", got, want)
+	}
+}
+
+// blockingManager is a Manager that finds instances immediately, then blocks,
+// if block is set, until the context is cancelled or release is closed.
+type blockingManager struct {
+	Manager
+
+	instances     int
+	block         bool
+	ignoreContext bool
+	release       chan struct{}
+
+	mu sync.Mutex
+	n  int
+}
+
+func (m *blockingManager) Instances(ctx context.Context, app string) ([]*Instance, error) {
+	m.mu.Lock()
+	m.n++
+	m.mu.Unlock()
+
+	var instances []*Instance
+	for i := 0; i < m.instances; i++ {
+		instances = append(instances, &Instance{ID: fmt.Sprintf("%d", i)})
+	}
+
+	if !m.block {
+		return instances, nil
+	}
+
+	if m.ignoreContext {
+		<-m.release
+		return instances, nil
+	}
+
+	select {
+	case <-m.release:
+		return instances, nil
+	case <-ctx.Done():
+		return instances, ctx.Err()
+	}
+}
+
+func (m *blockingManager) calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.n
+}
@@ -26,10 +26,14 @@ func (s *store) PortsFindOrCreateByApp(app *App) (*Port, error) {
 }
 
 func (s *store) PortsFindByApp(app *App) (*Port, error) {
-	return portsFindByApp(s.db, app)
+	return portsFindByApp(s.reader(), app)
 }
 
 func (s *store) PortsAssign(app *App) (*Port, error) {
+	if err := s.writable(); err != nil {
+		return nil, err
+	}
+
 	var port *Port
 
 	t := s.db.Begin()
@@ -57,6 +61,10 @@ func (s *store) PortsAssign(app *App) (*Port, error) {
 }
 
 func (s *store) PortsUnassign(app *App) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	return portsUnassign(s.db, app)
 }
 
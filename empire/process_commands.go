@@ -0,0 +1,148 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// ErrBlankCommand is returned when overriding the command of a process with a
+// blank command.
+var ErrBlankCommand = &ValidationError{
+	errors.New("A command is required."),
+}
+
+// ProcessCommandOverride replaces the command from the slug for a process type
+// of an app, until the app is next deployed.
+type ProcessCommandOverride struct {
+	ID          string
+	AppID       string
+	ProcessType ProcessType
+	Command     Command
+	CreatedAt   *time.Time
+}
+
+// BeforeCreate sets created_at before inserting.
+func (o *ProcessCommandOverride) BeforeCreate() error {
+	t := timex.Now()
+	o.CreatedAt = &t
+	return nil
+}
+
+// ProcessCommandOverrides returns the command overrides for the app, by process
+// type.
+func (s *store) ProcessCommandOverrides(app *App) (CommandMap, error) {
+	var overrides []*ProcessCommandOverride
+	if err := s.Find(ForApp(app), &overrides); err != nil {
+		return nil, err
+	}
+
+	cm := make(CommandMap)
+	for _, o := range overrides {
+		cm[o.ProcessType] = o.Command
+	}
+
+	return cm, nil
+}
+
+// ProcessCommandOverridesSet replaces the command override for the process
+// type.
+func (s *store) ProcessCommandOverridesSet(o *ProcessCommandOverride) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	if err := t.Where("app_id = ? and process_type = ?", o.AppID, o.ProcessType).Delete(&ProcessCommandOverride{}).Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	if err := t.Create(o).Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	return t.Commit().Error
+}
+
+// ProcessCommandOverridesDestroy removes all of the app's command overrides.
+func (s *store) ProcessCommandOverridesDestroy(app *App) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	return s.db.Where("app_id = ?", app.ID).Delete(&ProcessCommandOverride{}).Error
+}
+
+// applyCommandOverrides replaces the commands of processes in the formation
+// that have an override.
+func applyCommandOverrides(f Formation, overrides CommandMap) {
+	for t, cmd := range overrides {
+		if p, ok := f[t]; ok {
+			p.Command = cmd
+		}
+	}
+}
+
+// processCommandOverrider overrides the commands of processes by releasing the
+// app with an override.
+type processCommandOverrider struct {
+	store    *store
+	releases *releasesService
+	notifier *notifier
+}
+
+// ProcessesSetCommand overrides the command of the process type, then creates
+// a new release of the current release's config and slug, which runs the
+// process with the new command. The slug isn't changed.
+func (s *processCommandOverrider) ProcessesSetCommand(ctx context.Context, app *App, processType string, command string) (*Release, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, ErrBlankCommand
+	}
+
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			err = &ValidationError{Err: fmt.Errorf("no releases for %s", app.Name)}
+		}
+		return nil, err
+	}
+
+	if _, ok := release.Slug.ProcessTypes[ProcessType(processType)]; !ok {
+		return nil, &ValidationError{Err: fmt.Errorf("no %s process type in slug", processType)}
+	}
+
+	if err := s.store.ProcessCommandOverridesSet(&ProcessCommandOverride{
+		AppID:       app.ID,
+		ProcessType: ProcessType(processType),
+		Command:     Command(command),
+	}); err != nil {
+		return nil, err
+	}
+
+	r, err := s.releases.ReleasesCreate(ctx, &Release{
+		App:         release.App,
+		Config:      release.Config,
+		Slug:        release.Slug,
+		Description: fmt.Sprintf("Override %s command", processType),
+	})
+	if err != nil {
+		return r, err
+	}
+
+	s.notifier.Notify(ctx, Notification{
+		Severity: SeverityInfo,
+		App:      app.Name,
+		Event:    NotificationCommandOverride,
+		Message:  fmt.Sprintf("Overrode the %s command of %s with %q in v%d", processType, app.Name, command, r.Version),
+	})
+
+	return r, nil
+}
@@ -0,0 +1,27 @@
+package empire
+
+import "testing"
+
+func TestApplyCommandOverrides(t *testing.T) {
+	f := Formation{
+		"web":    &Process{Type: "web", Command: "./bin/web"},
+		"worker": &Process{Type: "worker", Command: "./bin/worker"},
+	}
+
+	applyCommandOverrides(f, CommandMap{
+		"web":       "./bin/web --debug",
+		"scheduler": "./bin/scheduler",
+	})
+
+	if got, want := f["web"].Command, Command("./bin/web --debug"); got != want {
+		t.Fatalf("web Command => %s; want %s", got, want)
+	}
+
+	if got, want := f["worker"].Command, Command("./bin/worker"); got != want {
+		t.Fatalf("worker Command => %s; want %s", got, want)
+	}
+
+	if _, ok := f["scheduler"]; ok {
+		t.Fatal("Expected overrides for missing process types to be ignored")
+	}
+}
@@ -1,10 +1,14 @@
 package empire
 
 import (
+	"bytes"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -12,6 +16,8 @@ import (
 	. "github.com/remind101/empire/empire/pkg/bytesize"
 	"github.com/remind101/empire/empire/pkg/constraints"
 	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
 	"golang.org/x/net/context"
 )
 
@@ -34,6 +40,113 @@ var (
 // ProcessQuantityMap represents a map of process types to quantities.
 type ProcessQuantityMap map[ProcessType]int
 
+// NewProcessQuantityMap returns a ProcessQuantityMap from the desired number of
+// instances for each process type. It returns a ValidationError if any
+// quantity is negative.
+func NewProcessQuantityMap(types map[string]int) (ProcessQuantityMap, error) {
+	qm := make(ProcessQuantityMap)
+
+	for t, q := range types {
+		if t == "" {
+			return nil, &ValidationError{Err: fmt.Errorf("process type cannot be blank")}
+		}
+
+		if q < 0 {
+			return nil, &ValidationError{Err: fmt.Errorf("quantity for %s cannot be negative, got %d", t, q)}
+		}
+
+		qm[ProcessType(t)] = q
+	}
+
+	return qm, nil
+}
+
+// ProcessQuantityMapFromString parses the shorthand for a ProcessQuantityMap,
+// e.g. "web=3,worker=1".
+func ProcessQuantityMapFromString(s string) (ProcessQuantityMap, error) {
+	types := make(map[string]int)
+
+	if strings.TrimSpace(s) == "" {
+		return NewProcessQuantityMap(types)
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, &ValidationError{Err: fmt.Errorf("invalid process quantity %q, expected type=quantity", pair)}
+		}
+
+		t := strings.TrimSpace(parts[0])
+		q, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, &ValidationError{Err: fmt.Errorf("quantity for %s must be an integer, got %q", t, parts[1])}
+		}
+
+		if _, ok := types[t]; ok {
+			return nil, &ValidationError{Err: fmt.Errorf("quantity for %s is given more than once", t)}
+		}
+
+		types[t] = q
+	}
+
+	return NewProcessQuantityMap(types)
+}
+
+// MarshalJSON implements the json.Marshaler interface. Process types are
+// always sorted, so that the output is deterministic.
+func (qm ProcessQuantityMap) MarshalJSON() ([]byte, error) {
+	types := make([]string, 0, len(qm))
+	for t := range qm {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, t := range types {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(qm[ProcessType(t)]))
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It returns a
+// ValidationError if any quantity isn't a non-negative integer.
+func (qm *ProcessQuantityMap) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	types := make(map[string]int)
+	for t, v := range raw {
+		var q int
+		if err := json.Unmarshal(v, &q); err != nil {
+			return &ValidationError{Err: fmt.Errorf("quantity for %s must be an integer, got %s", t, v)}
+		}
+		types[t] = q
+	}
+
+	m, err := NewProcessQuantityMap(types)
+	if err != nil {
+		return err
+	}
+
+	*qm = m
+	return nil
+}
+
 // DefaultQuantities maps a process type to the default number of instances to
 // run.
 var DefaultQuantities = ProcessQuantityMap{
@@ -236,6 +349,47 @@ func (f Formation) Processes() []*Process {
 	return processes
 }
 
+// SortedProcesses returns the processes in the Formation, sorted by process
+// type.
+func (f Formation) SortedProcesses() []*Process {
+	processes := f.Processes()
+	sort.Sort(processesByType(processes))
+	return processes
+}
+
+// processesByType sorts Processes by process type.
+type processesByType []*Process
+
+func (s processesByType) Len() int           { return len(s) }
+func (s processesByType) Less(i, j int) bool { return s[i].Type < s[j].Type }
+func (s processesByType) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// WithQuantities returns a new Formation with the quantity of each process
+// updated from qm. Processes not in qm keep their current quantity. A
+// ValidationError is returned if qm contains a process type that isn't in the
+// Formation. The original Formation is not modified.
+func (f Formation) WithQuantities(qm ProcessQuantityMap) (Formation, error) {
+	for t := range qm {
+		if _, ok := f[t]; !ok {
+			return nil, &ValidationError{Err: fmt.Errorf("no %s process type in formation", t)}
+		}
+	}
+
+	processes := make(Formation)
+
+	for t, p := range f {
+		pp := *p
+
+		if q, ok := qm[t]; ok {
+			pp.Quantity = q
+		}
+
+		processes[t] = &pp
+	}
+
+	return processes, nil
+}
+
 // ProcessesQuery is a Scope implementation for common things to filter
 // processes by.
 type ProcessesQuery struct {
@@ -260,6 +414,27 @@ func (s *store) Processes(scope Scope) ([]*Process, error) {
 	return processes, s.Find(scope, &processes)
 }
 
+// ProcessTypesAll returns the unique process types of every release of the
+// app, sorted alphabetically.
+func (s *store) ProcessTypesAll(app *App) ([]string, error) {
+	rows, err := s.reader().Raw(`select distinct processes.type from processes inner join releases on releases.id = processes.release_id where releases.app_id = ? order by processes.type`, app.ID).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return types, err
+		}
+		types = append(types, t)
+	}
+
+	return types, rows.Err()
+}
+
 // Formation returns a Formation for the processes matching the scope.
 func (s *store) Formation(scope Scope) (Formation, error) {
 	p, err := s.Processes(scope)
@@ -271,14 +446,50 @@ func (s *store) Formation(scope Scope) (Formation, error) {
 
 // ProcessesCreate persists the process.
 func (s *store) ProcessesCreate(process *Process) (*Process, error) {
+	if err := s.writable(); err != nil {
+		return process, err
+	}
+
 	return processesCreate(s.db, process)
 }
 
 // ProcessesUpdate updates the process.
 func (s *store) ProcessesUpdate(process *Process) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	return processesUpdate(s.db, process)
 }
 
+// ProcessesScale saves the quantities of the processes of the app, and records
+// a ScaleEvent for each, in a single transaction.
+func (s *store) ProcessesScale(appID string, processes []*Process) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	for _, p := range processes {
+		if err := processesUpdate(t, p); err != nil {
+			t.Rollback()
+			return err
+		}
+
+		if _, err := scaleEventsCreate(t, &ScaleEvent{
+			AppID:       appID,
+			ProcessType: p.Type,
+			Quantity:    p.Quantity,
+		}); err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	return t.Commit().Error
+}
+
 // ProcessesCreate inserts a process into the database.
 func processesCreate(db *gorm.DB, process *Process) (*Process, error) {
 	return process, db.Create(process).Error
@@ -298,25 +509,334 @@ type ProcessState struct {
 	Constraints Constraints
 }
 
+// DefaultJobStatePollInterval is how often JobStatesStream queries the
+// scheduler for changes.
+var DefaultJobStatePollInterval = 5 * time.Second
+
 type processStatesService struct {
+	store   *store
 	manager service.Manager
+
+	// How often JobStatesStream polls the scheduler. Defaults to
+	// DefaultJobStatePollInterval.
+	pollInterval time.Duration
 }
 
 func (s *processStatesService) JobStatesByApp(ctx context.Context, app *App) ([]*ProcessState, error) {
 	var states []*ProcessState
 
+	// If the scheduler timed out, the instances that it found are still
+	// returned along with the error.
 	instances, err := s.manager.Instances(ctx, app.ID)
+	for _, i := range instances {
+		states = append(states, processStateFromInstance(i))
+	}
+
+	return states, err
+}
+
+// JobStatesStream returns a channel that receives the app's JobStates, sorted
+// by name, whenever they change. The current states are sent immediately. Only
+// processes updated after since are included; a zero time includes all of
+// them. The channel is closed when the context is cancelled.
+func (s *processStatesService) JobStatesStream(ctx context.Context, app *App, since time.Time) (<-chan []*ProcessState, error) {
+	states, err := s.jobStatesSince(ctx, app, since)
 	if err != nil {
-		return states, err
+		return nil, err
 	}
 
-	for _, i := range instances {
-		states = append(states, processStateFromInstance(i))
+	interval := s.pollInterval
+	if interval == 0 {
+		interval = DefaultJobStatePollInterval
 	}
 
+	ch := make(chan []*ProcessState)
+
+	go func() {
+		defer close(ch)
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		var last []byte
+		for {
+			// Only send the states when they've changed since the
+			// last time they were sent.
+			b, err := json.Marshal(states)
+			if err != nil {
+				reporter.Report(ctx, err)
+			} else if !bytes.Equal(b, last) {
+				select {
+				case ch <- states:
+					last = b
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			// If the scheduler can't be queried, the last states
+			// are kept.
+			next, err := s.jobStatesSince(ctx, app, since)
+			if err != nil {
+				reporter.Report(ctx, err)
+				continue
+			}
+			states = next
+		}
+	}()
+
+	return ch, nil
+}
+
+// jobStatesSince returns the JobStates for the app that were updated after
+// since, sorted by name.
+func (s *processStatesService) jobStatesSince(ctx context.Context, app *App, since time.Time) ([]*ProcessState, error) {
+	all, err := s.JobStatesByApp(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	states := []*ProcessState{}
+	for _, state := range all {
+		if state.UpdatedAt.After(since) {
+			states = append(states, state)
+		}
+	}
+	sort.Sort(processStatesByName(states))
+
 	return states, nil
 }
 
+// processStatesByName sorts ProcessStates by name.
+type processStatesByName []*ProcessState
+
+func (s processStatesByName) Len() int           { return len(s) }
+func (s processStatesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s processStatesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// ProcessWithState is the state of a single process instance of an app, along
+// with its process from the app's current release.
+type ProcessWithState struct {
+	ProcessType ProcessType
+
+	// Instances are numbered by the order of their names within their
+	// process type.
+	Instance int
+
+	// The process from the current release, or nil if the instance's process
+	// type isn't in it.
+	Process *Process
+
+	State *ProcessState
+}
+
+// jobStateSeverities orders job states for ProcessesAllSortedByState. States
+// that aren't listed sort last.
+var jobStateSeverities = map[string]int{
+	"failed":  0,
+	"stopped": 1,
+	"running": 2,
+}
+
+// ProcessesAllSortedByState returns the app's process instances along with
+// their processes from the current release, sorted by the severity of their
+// state (failed, then stopped, then running), then by process type and
+// instance.
+func (s *processStatesService) ProcessesAllSortedByState(ctx context.Context, app *App) ([]ProcessWithState, error) {
+	states, err := s.JobStatesByApp(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	var f Formation
+	release, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	switch err {
+	case nil:
+		f = release.Formation()
+	case gorm.RecordNotFound:
+		// Without a release, none of the instances have a process.
+	default:
+		return nil, err
+	}
+
+	return processesWithState(f, states), nil
+}
+
+// processesWithState matches each state to its process in the Formation, and
+// sorts them for ProcessesAllSortedByState.
+func processesWithState(f Formation, states []*ProcessState) []ProcessWithState {
+	states = append([]*ProcessState(nil), states...)
+	sort.Sort(processStatesByName(states))
+
+	instances := make(map[ProcessType]int)
+
+	var processes []ProcessWithState
+	for _, state := range states {
+		// Names are of the form "v1.web.1".
+		var t ProcessType
+		if parts := strings.SplitN(state.Name, ".", 3); len(parts) > 1 {
+			t = ProcessType(parts[1])
+		}
+
+		instances[t]++
+		processes = append(processes, ProcessWithState{
+			ProcessType: t,
+			Instance:    instances[t],
+			Process:     f[t],
+			State:       state,
+		})
+	}
+
+	sort.Sort(processesWithStateBySeverity(processes))
+
+	return processes
+}
+
+// processesWithStateBySeverity sorts ProcessWithStates by the severity of their
+// state, then by process type and instance.
+type processesWithStateBySeverity []ProcessWithState
+
+func (s processesWithStateBySeverity) Len() int      { return len(s) }
+func (s processesWithStateBySeverity) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s processesWithStateBySeverity) Less(i, j int) bool {
+	if a, b := jobStateSeverity(s[i].State.State), jobStateSeverity(s[j].State.State); a != b {
+		return a < b
+	}
+	if s[i].ProcessType != s[j].ProcessType {
+		return s[i].ProcessType < s[j].ProcessType
+	}
+	return s[i].Instance < s[j].Instance
+}
+
+func jobStateSeverity(state string) int {
+	if severity, ok := jobStateSeverities[strings.ToLower(state)]; ok {
+		return severity
+	}
+	return len(jobStateSeverities)
+}
+
+// ProcessMetrics represents the resource usage of a running process.
+type ProcessMetrics struct {
+	JobName       string
+	CPUPercent    float64
+	MemoryUsageMB float64
+	MemoryLimitMB float64
+}
+
+// ProcessesGetMetrics returns the resource usage of the running processes
+// for the app.
+func (s *processStatesService) ProcessesGetMetrics(ctx context.Context, app *App) ([]ProcessMetrics, error) {
+	metrics, err := s.manager.Metrics(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pm []ProcessMetrics
+	for _, m := range metrics {
+		pm = append(pm, processMetricsFromInstanceMetrics(m))
+	}
+
+	return pm, nil
+}
+
+// ProcessTopEntry is the resource usage and state of a running process, like a
+// row of `heroku ps:top`.
+type ProcessTopEntry struct {
+	JobName    string
+	CPUPercent float64
+	MemoryMB   float64
+
+	// How long the process has been running. Zero if the state of the
+	// process is unknown.
+	Uptime time.Duration
+
+	// The state of the process, or "unknown" if the scheduler didn't
+	// return one.
+	State string
+}
+
+// ProcessesTop returns the resource usage of the app's processes along with
+// their state, sorted by CPU usage, highest first.
+func (s *processStatesService) ProcessesTop(ctx context.Context, app *App) ([]ProcessTopEntry, error) {
+	metrics, err := s.ProcessesGetMetrics(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := s.JobStatesByApp(ctx, app)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*ProcessState)
+	for _, state := range states {
+		byName[state.Name] = state
+	}
+
+	now := timex.Now()
+
+	var top []ProcessTopEntry
+	for _, m := range metrics {
+		entry := ProcessTopEntry{
+			JobName:    m.JobName,
+			CPUPercent: m.CPUPercent,
+			MemoryMB:   m.MemoryUsageMB,
+			State:      "unknown",
+		}
+
+		if state, ok := byName[m.JobName]; ok {
+			entry.State = state.State
+			entry.Uptime = now.Sub(state.UpdatedAt)
+		}
+
+		top = append(top, entry)
+	}
+
+	sort.Sort(processTopByCPU(top))
+
+	return top, nil
+}
+
+// processTopByCPU sorts ProcessTopEntries by CPU usage, highest first, then by
+// name.
+type processTopByCPU []ProcessTopEntry
+
+func (s processTopByCPU) Len() int      { return len(s) }
+func (s processTopByCPU) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s processTopByCPU) Less(i, j int) bool {
+	if s[i].CPUPercent != s[j].CPUPercent {
+		return s[i].CPUPercent > s[j].CPUPercent
+	}
+	return s[i].JobName < s[j].JobName
+}
+
+// processMetricsFromInstanceMetrics converts a service.InstanceMetrics into a
+// ProcessMetrics.
+func processMetricsFromInstanceMetrics(m *service.InstanceMetrics) ProcessMetrics {
+	return ProcessMetrics{
+		JobName:       instanceName(m.Instance),
+		CPUPercent:    m.CPUPercent,
+		MemoryUsageMB: float64(m.MemoryUsage) / float64(MB),
+		MemoryLimitMB: float64(m.Instance.Process.MemoryLimit) / float64(MB),
+	}
+}
+
+// instanceName returns the name of the instance, e.g. "v1.web.1".
+func instanceName(i *service.Instance) string {
+	version := i.Process.Env["EMPIRE_RELEASE"]
+	if version == "" {
+		version = "v0"
+	}
+
+	return fmt.Sprintf("%s.%s.%s", version, i.Process.Type, i.ID)
+}
+
 // processStateFromInstance converts a service.Instance into a ProcessState.
 // It pulls some of its data from empire specific environment variables if they have been set.
 // Once ECS supports this data natively, we can stop doing this.
@@ -326,13 +846,8 @@ func processStateFromInstance(i *service.Instance) *ProcessState {
 		createdAt = t
 	}
 
-	version := i.Process.Env["EMPIRE_RELEASE"]
-	if version == "" {
-		version = "v0"
-	}
-
 	return &ProcessState{
-		Name:    fmt.Sprintf("%s.%s.%s", version, i.Process.Type, i.ID),
+		Name:    instanceName(i),
 		Command: i.Process.Command,
 		Constraints: Constraints{
 			CPUShare: constraints.CPUShare(i.Process.CPUShares),
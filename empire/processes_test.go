@@ -4,10 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/remind101/empire/empire/pkg/bytesize"
 	"github.com/remind101/empire/empire/pkg/constraints"
+	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
 )
 
 func TestProcessesQuery(t *testing.T) {
@@ -112,6 +118,143 @@ func TestNewFormation(t *testing.T) {
 	}
 }
 
+func TestNewProcessQuantityMap(t *testing.T) {
+	tests := []struct {
+		types    map[string]int
+		expected ProcessQuantityMap
+		err      bool
+	}{
+		{map[string]int{}, ProcessQuantityMap{}, false},
+		{map[string]int{"web": 2, "worker": 0}, ProcessQuantityMap{"web": 2, "worker": 0}, false},
+		{map[string]int{"web": -1}, nil, true},
+		{map[string]int{"": 1}, nil, true},
+	}
+
+	for i, tt := range tests {
+		qm, err := NewProcessQuantityMap(tt.types)
+
+		if got, want := err != nil, tt.err; got != want {
+			t.Fatalf("#%d: err => %v", i, err)
+		}
+
+		if got, want := qm, tt.expected; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d: ProcessQuantityMap => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestProcessQuantityMapFromString(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected ProcessQuantityMap
+		err      bool
+	}{
+		{"", ProcessQuantityMap{}, false},
+		{"web=3", ProcessQuantityMap{"web": 3}, false},
+		{"web=3,worker=1", ProcessQuantityMap{"web": 3, "worker": 1}, false},
+		{" web = 3 , worker=0", ProcessQuantityMap{"web": 3, "worker": 0}, false},
+		{"web", nil, true},
+		{"web=three", nil, true},
+		{"web=-1", nil, true},
+		{"=1", nil, true},
+		{"web=1,web=2", nil, true},
+		{"web=1,", nil, true},
+	}
+
+	for _, tt := range tests {
+		qm, err := ProcessQuantityMapFromString(tt.in)
+
+		if got, want := err != nil, tt.err; got != want {
+			t.Fatalf("ProcessQuantityMapFromString(%q) err => %v", tt.in, err)
+		}
+
+		if got, want := qm, tt.expected; !reflect.DeepEqual(got, want) {
+			t.Fatalf("ProcessQuantityMapFromString(%q) => %v; want %v", tt.in, got, want)
+		}
+	}
+}
+
+func TestProcessQuantityMap_JSON(t *testing.T) {
+	qm := ProcessQuantityMap{"worker": 1, "web": 3, "clock": 0}
+
+	b, err := json.Marshal(qm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(b), `{"clock":0,"web":3,"worker":1}`; got != want {
+		t.Fatalf("MarshalJSON => %s; want %s", got, want)
+	}
+
+	var decoded ProcessQuantityMap
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, qm) {
+		t.Fatalf("UnmarshalJSON => %v; want %v", decoded, qm)
+	}
+
+	for _, in := range []string{
+		`{"web":-1}`,
+		`{"web":1.5}`,
+		`{"web":"3"}`,
+		`{"":1}`,
+	} {
+		var qm ProcessQuantityMap
+		if err := json.Unmarshal([]byte(in), &qm); err == nil {
+			t.Fatalf("UnmarshalJSON(%s) => nil; want an error", in)
+		}
+	}
+}
+
+func TestFormation_WithQuantities(t *testing.T) {
+	f := Formation{
+		"web":    &Process{Type: "web", Quantity: 1, Command: "./bin/web"},
+		"worker": &Process{Type: "worker", Quantity: 1, Command: "./bin/worker"},
+	}
+
+	nf, err := f.WithQuantities(ProcessQuantityMap{"web": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := nf["web"].Quantity, 3; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+
+	if got, want := nf["worker"].Quantity, 1; got != want {
+		t.Fatalf("worker => %d; want %d", got, want)
+	}
+
+	// The original formation should not be modified.
+	if got, want := f["web"].Quantity, 1; got != want {
+		t.Fatalf("original web => %d; want %d", got, want)
+	}
+
+	if _, err := f.WithQuantities(ProcessQuantityMap{"scheduler": 1}); err == nil {
+		t.Fatal("Expected an error for an unknown process type")
+	}
+}
+
+func TestFormation_SortedProcesses(t *testing.T) {
+	f := Formation{
+		"worker":    &Process{Type: "worker"},
+		"web":       &Process{Type: "web"},
+		"scheduler": &Process{Type: "scheduler"},
+		"api":       &Process{Type: "api"},
+	}
+
+	var types []ProcessType
+	for _, p := range f.SortedProcesses() {
+		types = append(types, p.Type)
+	}
+
+	if got, want := types, []ProcessType{"api", "scheduler", "web", "worker"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("SortedProcesses => %v; want %v", got, want)
+	}
+}
+
 func TestConstraints_UnmarshalJSON(t *testing.T) {
 	tests := []struct {
 		in  string
@@ -163,3 +306,251 @@ func TestConstraints_String(t *testing.T) {
 		}
 	}
 }
+
+// metricsManager is a service.Manager that returns canned metrics.
+type metricsManager struct {
+	*service.FakeManager
+	metrics []*service.InstanceMetrics
+}
+
+func (m *metricsManager) Metrics(ctx context.Context, app string) ([]*service.InstanceMetrics, error) {
+	return m.metrics, nil
+}
+
+func TestProcessesGetMetrics(t *testing.T) {
+	web := &service.Process{
+		Type:        "web",
+		MemoryLimit: uint(512 * MB),
+		Env:         map[string]string{"EMPIRE_RELEASE": "v2"},
+	}
+
+	s := &processStatesService{
+		manager: &metricsManager{
+			FakeManager: service.NewFakeManager(),
+			metrics: []*service.InstanceMetrics{
+				{Instance: &service.Instance{ID: "1", Process: web}, CPUPercent: 12.5, MemoryUsage: uint(128 * MB)},
+				{Instance: &service.Instance{ID: "2", Process: web}, CPUPercent: 50, MemoryUsage: uint(256 * MB)},
+			},
+		},
+	}
+
+	metrics, err := s.ProcessesGetMetrics(context.Background(), &App{ID: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ProcessMetrics{
+		{JobName: "v2.web.1", CPUPercent: 12.5, MemoryUsageMB: 128, MemoryLimitMB: 512},
+		{JobName: "v2.web.2", CPUPercent: 50, MemoryUsageMB: 256, MemoryLimitMB: 512},
+	}
+
+	if got, want := metrics, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessesGetMetrics => %v; want %v", got, want)
+	}
+}
+
+// statesManager is a service.Manager that returns the next set of instances
+// each time that Instances is called, repeating the last set once they've all
+// been returned.
+type statesManager struct {
+	*service.FakeManager
+
+	mu        sync.Mutex
+	instances [][]*service.Instance
+}
+
+func (m *statesManager) Instances(ctx context.Context, app string) ([]*service.Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.instances[0]
+	if len(m.instances) > 1 {
+		m.instances = m.instances[1:]
+	}
+	return i, nil
+}
+
+func TestJobStatesStream(t *testing.T) {
+	web := &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}
+	worker := &service.Process{Type: "worker", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}
+	updatedAt := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	instance := func(id string, p *service.Process, state string) *service.Instance {
+		return &service.Instance{ID: id, Process: p, State: state, UpdatedAt: updatedAt}
+	}
+
+	s := &processStatesService{
+		pollInterval: time.Millisecond,
+		manager: &statesManager{
+			FakeManager: service.NewFakeManager(),
+			instances: [][]*service.Instance{
+				{instance("1", web, "PENDING")},
+				{instance("1", web, "PENDING")},
+				{instance("1", web, "RUNNING")},
+				{instance("1", web, "RUNNING")},
+				{instance("2", worker, "RUNNING"), instance("1", web, "RUNNING")},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := s.JobStatesStream(ctx, &App{ID: "1234"}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		select {
+		case states := <-ch:
+			var names []string
+			for _, state := range states {
+				names = append(names, state.Name+"="+state.State)
+			}
+			got = append(got, strings.Join(names, ","))
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for states; got %v", got)
+		}
+	}
+
+	want := []string{
+		"v1.web.1=PENDING",
+		"v1.web.1=RUNNING",
+		"v1.web.1=RUNNING,v1.worker.2=RUNNING",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("States => %v; want %v", got, want)
+	}
+
+	cancel()
+
+	select {
+	case states, ok := <-ch:
+		if ok {
+			t.Fatalf("Expected no more states, got %v", states)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the channel to be closed")
+	}
+}
+
+// topManager is a service.Manager that returns canned instances and metrics.
+type topManager struct {
+	*service.FakeManager
+	instances []*service.Instance
+	metrics   []*service.InstanceMetrics
+}
+
+func (m *topManager) Instances(ctx context.Context, app string) ([]*service.Instance, error) {
+	return m.instances, nil
+}
+
+func (m *topManager) Metrics(ctx context.Context, app string) ([]*service.InstanceMetrics, error) {
+	return m.metrics, nil
+}
+
+func TestProcessesTop(t *testing.T) {
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	timexNow := timex.Now
+	timex.Now = func() time.Time { return now }
+	defer func() { timex.Now = timexNow }()
+
+	web := &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": "v2"}}
+	worker := &service.Process{Type: "worker", Env: map[string]string{"EMPIRE_RELEASE": "v2"}}
+
+	s := &processStatesService{
+		manager: &topManager{
+			FakeManager: service.NewFakeManager(),
+			instances: []*service.Instance{
+				{ID: "1", Process: web, State: "RUNNING", UpdatedAt: now.Add(-time.Hour)},
+				{ID: "2", Process: web, State: "RUNNING", UpdatedAt: now.Add(-time.Minute)},
+			},
+			metrics: []*service.InstanceMetrics{
+				{Instance: &service.Instance{ID: "1", Process: web}, CPUPercent: 12.5, MemoryUsage: uint(128 * MB)},
+				{Instance: &service.Instance{ID: "2", Process: web}, CPUPercent: 50, MemoryUsage: uint(256 * MB)},
+				{Instance: &service.Instance{ID: "3", Process: worker}, CPUPercent: 25, MemoryUsage: uint(64 * MB)},
+			},
+		},
+	}
+
+	top, err := s.ProcessesTop(context.Background(), &App{ID: "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ProcessTopEntry{
+		{JobName: "v2.web.2", CPUPercent: 50, MemoryMB: 256, Uptime: time.Minute, State: "RUNNING"},
+		{JobName: "v2.worker.3", CPUPercent: 25, MemoryMB: 64, State: "unknown"},
+		{JobName: "v2.web.1", CPUPercent: 12.5, MemoryMB: 128, Uptime: time.Hour, State: "RUNNING"},
+	}
+
+	if got, want := top, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessesTop => %v; want %v", got, want)
+	}
+}
+
+func TestProcessesWithState(t *testing.T) {
+	web := &Process{Type: "web", Command: "./bin/web"}
+	worker := &Process{Type: "worker", Command: "./bin/worker"}
+	f := Formation{"web": web, "worker": worker}
+
+	states := []*ProcessState{
+		{Name: "v2.web.3", State: "RUNNING"},
+		{Name: "v2.worker.4", State: "RUNNING"},
+		{Name: "v2.web.1", State: "RUNNING"},
+		{Name: "v1.scheduler.5", State: "PENDING"},
+		{Name: "v2.worker.2", State: "STOPPED"},
+		{Name: "v2.web.6", State: "FAILED"},
+	}
+
+	expected := []ProcessWithState{
+		{ProcessType: "web", Instance: 3, Process: web, State: states[5]},
+		{ProcessType: "worker", Instance: 1, Process: worker, State: states[4]},
+		{ProcessType: "web", Instance: 1, Process: web, State: states[2]},
+		{ProcessType: "web", Instance: 2, Process: web, State: states[0]},
+		{ProcessType: "worker", Instance: 2, Process: worker, State: states[1]},
+		{ProcessType: "scheduler", Instance: 1, State: states[3]},
+	}
+
+	if got, want := processesWithState(f, states), expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("processesWithState => %v; want %v", got, want)
+	}
+
+	// The states passed in aren't reordered.
+	if got, want := states[0].Name, "v2.web.3"; got != want {
+		t.Fatalf("states[0] => %s; want %s", got, want)
+	}
+}
+
+func TestChangedQuantities(t *testing.T) {
+	f := Formation{
+		"web":    &Process{Type: "web", Quantity: 1},
+		"worker": &Process{Type: "worker", Quantity: 2},
+	}
+
+	tests := []struct {
+		qm      ProcessQuantityMap
+		changed []ProcessType
+		err     bool
+	}{
+		{ProcessQuantityMap{}, []ProcessType{}, false},
+		{ProcessQuantityMap{"web": 1, "worker": 2}, []ProcessType{}, false},
+		{ProcessQuantityMap{"web": 3}, []ProcessType{"web"}, false},
+		{ProcessQuantityMap{"web": 3, "worker": 0}, []ProcessType{"web", "worker"}, false},
+		{ProcessQuantityMap{"scheduler": 1}, nil, true},
+	}
+
+	for i, tt := range tests {
+		changed, err := changedQuantities(f, tt.qm)
+
+		if got, want := err != nil, tt.err; got != want {
+			t.Fatalf("#%d: err => %v", i, err)
+		}
+
+		if got, want := changed, tt.changed; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d: changed => %v; want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package empire
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// DefaultReleaseApprovalTTL is the default amount of time that approval tokens
+// are valid for.
+const DefaultReleaseApprovalTTL = 24 * time.Hour
+
+// Statuses of a ReleaseApproval.
+const (
+	ReleaseApprovalPending  = "pending"
+	ReleaseApprovalApproved = "approved"
+	ReleaseApprovalRejected = "rejected"
+)
+
+var (
+	// ErrNoApprovers is returned when requesting approval of a release
+	// without any approvers.
+	ErrNoApprovers = &ValidationError{
+		errors.New("At least one approver is required."),
+	}
+
+	// ErrInvalidApprovalToken is returned when an approval token wasn't
+	// signed by Empire, or its approval request doesn't exist.
+	ErrInvalidApprovalToken = &ValidationError{
+		errors.New("The approval token is invalid."),
+	}
+
+	// ErrApprovalTokenExpired is returned when an approval token is used
+	// after it has expired.
+	ErrApprovalTokenExpired = &ValidationError{
+		errors.New("The approval token has expired."),
+	}
+
+	// ErrReleaseApprovalDecided is returned when an approval token is used
+	// after the release has already been approved or rejected.
+	ErrReleaseApprovalDecided = &ValidationError{
+		errors.New("The release has already been approved or rejected."),
+	}
+
+	// ErrEmailDisabled is returned when sending an email if Empire wasn't
+	// configured with an EmailSender.
+	ErrEmailDisabled = &ValidationError{
+		errors.New("Sending email is not enabled."),
+	}
+)
+
+// EmailSender sends emails.
+type EmailSender interface {
+	SendEmail(ctx context.Context, to, subject, body string) error
+}
+
+// fakeEmailSender is an EmailSender that's used when sending email isn't
+// enabled.
+type fakeEmailSender struct{}
+
+func (s *fakeEmailSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	return ErrEmailDisabled
+}
+
+// ReleaseApproval is a request for a draft release to be approved.
+type ReleaseApproval struct {
+	ID        string
+	ReleaseID string
+
+	// One of ReleaseApprovalPending, ReleaseApprovalApproved or
+	// ReleaseApprovalRejected.
+	Status string
+
+	// The approver that approved or rejected the release, and their reason
+	// for rejecting it.
+	DecidedBy string
+	Reason    string
+
+	ExpiresAt time.Time
+	CreatedAt *time.Time
+	DecidedAt *time.Time
+}
+
+// BeforeCreate sets created_at before inserting.
+func (a *ReleaseApproval) BeforeCreate() error {
+	t := timex.Now()
+	a.CreatedAt = &t
+
+	if a.Status == "" {
+		a.Status = ReleaseApprovalPending
+	}
+
+	return nil
+}
+
+// ReleaseApprovalsCreate persists the approval request.
+func (s *store) ReleaseApprovalsCreate(a *ReleaseApproval) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	return s.db.Create(a).Error
+}
+
+// ReleaseApprovalsFind finds the approval request with the given id.
+func (s *store) ReleaseApprovalsFind(id string) (*ReleaseApproval, error) {
+	var a ReleaseApproval
+	return &a, s.First(ID(id), &a)
+}
+
+// ReleaseApprovalsDecide approves or rejects a pending approval request.
+// ErrReleaseApprovalDecided is returned if it's not pending.
+func (s *store) ReleaseApprovalsDecide(a *ReleaseApproval, status, decidedBy, reason string) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	now := timex.Now()
+	db := s.db.Exec(`update release_approvals set status = ?, decided_by = ?, reason = ?, decided_at = ? where id = ? and status = ?`, status, decidedBy, reason, now, a.ID, ReleaseApprovalPending)
+	if err := db.Error; err != nil {
+		return err
+	}
+
+	if db.RowsAffected == 0 {
+		return ErrReleaseApprovalDecided
+	}
+
+	a.Status = status
+	a.DecidedBy = decidedBy
+	a.Reason = reason
+	a.DecidedAt = &now
+	return nil
+}
+
+// releaseApprovalsService sends approval requests for draft releases, and
+// activates or rejects them when an approver follows the link in the email.
+type releaseApprovalsService struct {
+	store    *store
+	releases *releasesService
+	sender   EmailSender
+
+	// Used to sign approval tokens.
+	secret []byte
+
+	// The url that approval links point to. The token is added as the
+	// "token" query parameter.
+	url string
+
+	// How long approval tokens are valid for.
+	ttl time.Duration
+}
+
+// ReleasesRequestApproval emails each approver a link with a signed token that
+// approves or rejects the draft release, returning the id of the approval
+// request. Only the first approver to respond decides. ErrEmailDisabled is
+// returned, without creating the approval request, if sending email isn't
+// enabled.
+func (s *releaseApprovalsService) ReleasesRequestApproval(ctx context.Context, release *Release, approvers []string) (string, error) {
+	if _, ok := s.sender.(*fakeEmailSender); ok {
+		return "", ErrEmailDisabled
+	}
+
+	if len(approvers) == 0 {
+		return "", ErrNoApprovers
+	}
+
+	if release.Status != ReleaseStatusDraft {
+		return "", ErrReleaseNotDraft
+	}
+
+	a := &ReleaseApproval{
+		ReleaseID: release.ID,
+		ExpiresAt: timex.Now().Add(s.ttl),
+	}
+	if err := s.store.ReleaseApprovalsCreate(a); err != nil {
+		return "", err
+	}
+
+	subject := fmt.Sprintf("Approve v%d of %s", release.Version, release.App.Name)
+	for _, approver := range approvers {
+		token, err := signApprovalToken(s.secret, approvalClaims{
+			ApprovalID: a.ID,
+			Approver:   approver,
+			ExpiresAt:  a.ExpiresAt.Unix(),
+		})
+		if err != nil {
+			return a.ID, err
+		}
+
+		body := fmt.Sprintf("Approval was requested to deploy v%d of %s: %s\n\nApprove or reject the release at %s\n", release.Version, release.App.Name, release.Description, s.link(token))
+		if err := s.sender.SendEmail(ctx, approver, subject, body); err != nil {
+			return a.ID, err
+		}
+	}
+
+	return a.ID, nil
+}
+
+// ReleasesApprove activates the release with the approval token, then records
+// that it was approved. The approval is only recorded once the release has
+// been activated, so that a release that fails to activate can still be
+// approved again, or rejected. Activating the release fails if it was already
+// activated by another approver.
+func (s *releaseApprovalsService) ReleasesApprove(ctx context.Context, token string) (*Release, error) {
+	claims, a, release, err := s.find(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Status != ReleaseApprovalPending {
+		return release, ErrReleaseApprovalDecided
+	}
+
+	release, err = s.releases.ReleasesActivate(ctx, release, claims.Approver)
+	if err != nil {
+		return release, err
+	}
+
+	return release, s.store.ReleaseApprovalsDecide(a, ReleaseApprovalApproved, claims.Approver, "")
+}
+
+// ReleasesReject rejects the release with the approval token, so that it can't
+// be approved, and sends a ReleaseEventRejected to streams of the app.
+func (s *releaseApprovalsService) ReleasesReject(ctx context.Context, token, reason string) error {
+	claims, a, release, err := s.find(token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.ReleaseApprovalsDecide(a, ReleaseApprovalRejected, claims.Approver, reason); err != nil {
+		return err
+	}
+
+	s.releases.notifyRelease(ctx, release, ReleaseEventRejected, reason)
+
+	return nil
+}
+
+// find verifies the token, and finds its approval request and release.
+func (s *releaseApprovalsService) find(token string) (*approvalClaims, *ReleaseApproval, *Release, error) {
+	claims, err := parseApprovalToken(s.secret, token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	a, err := s.store.ReleaseApprovalsFind(claims.ApprovalID)
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			err = ErrInvalidApprovalToken
+		}
+		return claims, nil, nil, err
+	}
+
+	release, err := s.store.ReleasesFirst(ReleasesQuery{ID: &a.ReleaseID})
+	if err != nil {
+		return claims, a, nil, err
+	}
+
+	return claims, a, release, nil
+}
+
+// link returns the url that approves or rejects the release with the token.
+func (s *releaseApprovalsService) link(token string) string {
+	if s.url == "" {
+		return token
+	}
+
+	sep := "?"
+	if strings.Contains(s.url, "?") {
+		sep = "&"
+	}
+
+	return s.url + sep + "token=" + url.QueryEscape(token)
+}
+
+// approvalClaims are the claims of an approval token.
+type approvalClaims struct {
+	ApprovalID string `json:"approval_id"`
+	Approver   string `json:"approver"`
+
+	// When the token expires, as a unix timestamp.
+	ExpiresAt int64 `json:"exp"`
+}
+
+// signApprovalToken returns a token of the claims, followed by their HMAC
+// signature.
+func signApprovalToken(secret []byte, claims approvalClaims) (string, error) {
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload := jwt.EncodeSegment(raw)
+	return payload + "." + approvalSignature(secret, payload), nil
+}
+
+// parseApprovalToken verifies the signature and expiry of a token from
+// signApprovalToken, and returns its claims.
+func parseApprovalToken(secret []byte, token string) (*approvalClaims, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidApprovalToken
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(approvalSignature(secret, parts[0]))) {
+		return nil, ErrInvalidApprovalToken
+	}
+
+	raw, err := jwt.DecodeSegment(parts[0])
+	if err != nil {
+		return nil, ErrInvalidApprovalToken
+	}
+
+	var claims approvalClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, ErrInvalidApprovalToken
+	}
+
+	if timex.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrApprovalTokenExpired
+	}
+
+	return &claims, nil
+}
+
+func approvalSignature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return jwt.EncodeSegment(mac.Sum(nil))
+}
@@ -0,0 +1,104 @@
+package empire
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+func TestApprovalToken(t *testing.T) {
+	now := time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)
+	timexNow := timex.Now
+	timex.Now = func() time.Time { return now }
+	defer func() { timex.Now = timexNow }()
+
+	secret := []byte("secret")
+	claims := approvalClaims{
+		ApprovalID: "1234",
+		Approver:   "alice@example.com",
+		ExpiresAt:  now.Add(time.Hour).Unix(),
+	}
+
+	token, err := signApprovalToken(secret, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := parseApprovalToken(secret, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(*got, claims) {
+		t.Fatalf("claims => %v; want %v", *got, claims)
+	}
+
+	// Tokens signed with a different secret, or that have been tampered
+	// with, are invalid.
+	other, err := signApprovalToken([]byte("other"), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	forged, err := signApprovalToken(secret, approvalClaims{ApprovalID: "5678", ExpiresAt: claims.ExpiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.SplitN(forged, ".", 2)[0] + "." + parts[1]
+
+	for _, token := range []string{"", "abcd", other, tampered} {
+		if _, err := parseApprovalToken(secret, token); err != ErrInvalidApprovalToken {
+			t.Fatalf("parseApprovalToken(%q) => %v; want %v", token, err, ErrInvalidApprovalToken)
+		}
+	}
+
+	timex.Now = func() time.Time { return now.Add(time.Hour) }
+	if _, err := parseApprovalToken(secret, token); err != ErrApprovalTokenExpired {
+		t.Fatalf("err => %v; want %v", err, ErrApprovalTokenExpired)
+	}
+}
+
+func TestReleaseApprovalsService_Link(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"", "a.b"},
+		{"https://empire.example.com/approve", "https://empire.example.com/approve?token=a.b"},
+		{"https://empire.example.com/approve?source=email", "https://empire.example.com/approve?source=email&token=a.b"},
+	}
+
+	for _, tt := range tests {
+		s := &releaseApprovalsService{url: tt.url}
+		if got := s.link("a.b"); got != tt.want {
+			t.Fatalf("link => %s; want %s", got, tt.want)
+		}
+	}
+}
+
+func TestReleaseApprovalsService_RequestApproval_Invalid(t *testing.T) {
+	s := &releaseApprovalsService{}
+	ctx := context.Background()
+
+	if _, err := s.ReleasesRequestApproval(ctx, &Release{Status: ReleaseStatusDraft}, nil); err != ErrNoApprovers {
+		t.Fatalf("err => %v; want %v", err, ErrNoApprovers)
+	}
+
+	if _, err := s.ReleasesRequestApproval(ctx, &Release{Status: ReleaseStatusActive}, []string{"alice@example.com"}); err != ErrReleaseNotDraft {
+		t.Fatalf("err => %v; want %v", err, ErrReleaseNotDraft)
+	}
+}
+
+func TestReleaseApprovalsService_RequestApproval_EmailDisabled(t *testing.T) {
+	// The approval request isn't created, so the store isn't needed.
+	s := &releaseApprovalsService{sender: &fakeEmailSender{}}
+
+	if _, err := s.ReleasesRequestApproval(context.Background(), &Release{Status: ReleaseStatusDraft}, []string{"alice@example.com"}); err != ErrEmailDisabled {
+		t.Fatalf("err => %v; want %v", err, ErrEmailDisabled)
+	}
+}
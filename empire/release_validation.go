@@ -0,0 +1,90 @@
+package empire
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultReleaseValidationTimeout is the default amount of time that an app's
+// validation command has to exit before the release is aborted.
+const DefaultReleaseValidationTimeout = 10 * time.Minute
+
+var (
+	// ErrReleaseValidationFailed is returned when creating a release if the
+	// app's validation command exits non-zero, or doesn't exit within
+	// Options.ReleaseValidationTimeout.
+	ErrReleaseValidationFailed = &ValidationError{
+		errors.New("The release validation command failed."),
+	}
+
+	// ErrTaskRunnerDisabled is returned when running a task if Empire
+	// wasn't configured with a TaskRunner.
+	ErrTaskRunnerDisabled = &ValidationError{
+		errors.New("Running tasks is not enabled."),
+	}
+)
+
+// TaskRunner runs one-off tasks to completion.
+type TaskRunner interface {
+	// RunTask runs the command with the image and config of the release,
+	// waits for it to exit, and returns its exit code. The task should be
+	// stopped when the context is cancelled.
+	RunTask(ctx context.Context, release *Release, command string) (int, error)
+}
+
+// fakeTaskRunner is a TaskRunner that's used when running tasks isn't enabled.
+type fakeTaskRunner struct{}
+
+func (r *fakeTaskRunner) RunTask(ctx context.Context, release *Release, command string) (int, error) {
+	return 0, ErrTaskRunnerDisabled
+}
+
+// withoutValidation returns a context that skips running the validation
+// command when creating a release, e.g. when rolling back to a release that
+// already passed.
+func withoutValidation(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipValidationKey, true)
+}
+
+// releaseValidator runs an app's validation command against a release before
+// it's created.
+type releaseValidator struct {
+	runner TaskRunner
+
+	// How long the validation command has to exit.
+	timeout time.Duration
+}
+
+// Validate runs the app's ValidateCommand as a one-off task with the release,
+// which hasn't been persisted yet. ErrReleaseValidationFailed is returned if it
+// exits non-zero or times out. Apps without a ValidateCommand, and releases
+// created with a context from withoutValidation, aren't validated.
+func (v *releaseValidator) Validate(ctx context.Context, r *Release) error {
+	if r.App.ValidateCommand == "" {
+		return nil
+	}
+
+	if skip, _ := ctx.Value(skipValidationKey).(bool); skip {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	code, err := v.runner.RunTask(ctx, r, r.App.ValidateCommand)
+	if ctx.Err() == context.DeadlineExceeded {
+		return ErrReleaseValidationFailed
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return ErrReleaseValidationFailed
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package empire
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// fakeTaskRunnerFunc is a TaskRunner backed by a function.
+type fakeTaskRunnerFunc func(ctx context.Context, release *Release, command string) (int, error)
+
+func (fn fakeTaskRunnerFunc) RunTask(ctx context.Context, release *Release, command string) (int, error) {
+	return fn(ctx, release, command)
+}
+
+func TestReleaseValidator_Validate(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		code int
+		err  error
+		want error
+	}{
+		{0, nil, nil},
+		{1, nil, ErrReleaseValidationFailed},
+		{0, errBoom, errBoom},
+	}
+
+	for _, tt := range tests {
+		var commands []string
+		v := &releaseValidator{
+			runner: fakeTaskRunnerFunc(func(ctx context.Context, release *Release, command string) (int, error) {
+				commands = append(commands, command)
+				return tt.code, tt.err
+			}),
+			timeout: time.Minute,
+		}
+
+		r := &Release{App: &App{ValidateCommand: "rake spec:smoke"}}
+		if err := v.Validate(context.Background(), r); err != tt.want {
+			t.Fatalf("err => %v; want %v", err, tt.want)
+		}
+
+		if len(commands) != 1 || commands[0] != "rake spec:smoke" {
+			t.Fatalf("commands => %v; want [rake spec:smoke]", commands)
+		}
+	}
+}
+
+func TestReleaseValidator_Validate_Timeout(t *testing.T) {
+	v := &releaseValidator{
+		runner: fakeTaskRunnerFunc(func(ctx context.Context, release *Release, command string) (int, error) {
+			<-ctx.Done()
+			return -1, ctx.Err()
+		}),
+		timeout: time.Millisecond,
+	}
+
+	r := &Release{App: &App{ValidateCommand: "rake spec:smoke"}}
+	if err := v.Validate(context.Background(), r); err != ErrReleaseValidationFailed {
+		t.Fatalf("err => %v; want %v", err, ErrReleaseValidationFailed)
+	}
+}
+
+func TestReleaseValidator_Validate_NoCommand(t *testing.T) {
+	v := &releaseValidator{runner: &fakeTaskRunner{}, timeout: time.Minute}
+
+	if err := v.Validate(context.Background(), &Release{App: &App{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// With a command, but without a TaskRunner.
+	if err := v.Validate(context.Background(), &Release{App: &App{ValidateCommand: "rake spec:smoke"}}); err != ErrTaskRunnerDisabled {
+		t.Fatalf("err => %v; want %v", err, ErrTaskRunnerDisabled)
+	}
+}
+
+func TestReleaseValidator_Validate_Skipped(t *testing.T) {
+	v := &releaseValidator{
+		runner: fakeTaskRunnerFunc(func(ctx context.Context, release *Release, command string) (int, error) {
+			t.Fatal("Expected the validation command to not be run")
+			return 1, nil
+		}),
+		timeout: time.Minute,
+	}
+
+	r := &Release{App: &App{ValidateCommand: "rake spec:smoke"}}
+	if err := v.Validate(withoutValidation(context.Background()), r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppsSetValidateCommand_TaskRunnerDisabled(t *testing.T) {
+	s := &appsService{taskRunner: &fakeTaskRunner{}}
+
+	app := &App{Name: "acme-inc"}
+	if err := s.AppsSetValidateCommand(app, "rake spec:smoke"); err != ErrTaskRunnerDisabled {
+		t.Fatalf("err => %v; want %v", err, ErrTaskRunnerDisabled)
+	}
+
+	if app.ValidateCommand != "" {
+		t.Fatalf("ValidateCommand => %q; want it to be unchanged", app.ValidateCommand)
+	}
+}
@@ -1,15 +1,72 @@
 package empire
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/reporter"
 	"github.com/remind101/pkg/timex"
 	"golang.org/x/net/context"
 )
 
+// SchedulerValidationError is returned when creating a release if the
+// scheduler reports that one of its processes can't be scheduled.
+type SchedulerValidationError struct {
+	ProcessType ProcessType
+	Err         error
+}
+
+func (e *SchedulerValidationError) Error() string {
+	return fmt.Sprintf("scheduler validation failed: %s: %v", e.ProcessType, e.Err)
+}
+
+// errDuplicateIdempotencyKey is returned when creating a release if the app
+// already has a release with its IdempotencyKey, e.g. because another deploy
+// with the same key created one concurrently.
+var errDuplicateIdempotencyKey = errors.New("a release with the idempotency key already exists")
+
+// Release statuses.
+const (
+	// ReleaseStatusActive is the status of releases that have been
+	// scheduled onto the cluster.
+	ReleaseStatusActive = "active"
+
+	// ReleaseStatusDraft is the status of releases that are waiting to be
+	// approved. Drafts aren't scheduled until they're activated.
+	ReleaseStatusDraft = "draft"
+
+	// ReleaseStatusCanary is the status of canary releases that are
+	// running alongside the active release. Canaries don't become the
+	// current release until they're promoted.
+	ReleaseStatusCanary = "canary"
+)
+
+var (
+	// ErrReleaseNotDraft is returned when activating a release that isn't
+	// a draft.
+	ErrReleaseNotDraft = &ValidationError{
+		errors.New("Only draft releases can be activated."),
+	}
+
+	// ErrReleaseDraftSuperseded is returned when activating a draft after
+	// a newer release has been activated.
+	ErrReleaseDraftSuperseded = &ValidationError{
+		errors.New("A newer release has been activated since this draft was created."),
+	}
+
+	// ErrReleaseApproverRequired is returned when activating a draft
+	// without an approver.
+	ErrReleaseApproverRequired = &ValidationError{
+		errors.New("An approver is required to activate a draft release."),
+	}
+)
+
 // Release is a combination of a Config and a Slug, which form a deployable
 // release.
 type Release struct {
@@ -29,6 +86,34 @@ type Release struct {
 
 	Description string
 	CreatedAt   *time.Time
+
+	// The commit and branch that the release was built from, if known.
+	CommitSHA string
+	Branch    string
+
+	// An optional key, unique per app, that's used to make deploys
+	// idempotent.
+	IdempotencyKey string
+
+	// Either ReleaseStatusActive, ReleaseStatusDraft or
+	// ReleaseStatusCanary.
+	Status string
+
+	// The email of the user that activated the release, if it was created
+	// as a draft.
+	ApprovedBy string
+
+	// When true, the "stable" tag won't be moved to this release when it's
+	// created.
+	SkipStableTag bool `sql:"-"`
+
+	// When true, the commands overridden with ProcessesSetCommand aren't
+	// applied to the release's formation.
+	SkipCommandOverrides bool `sql:"-"`
+
+	// The changes to the config since the previous release. Only populated
+	// by ReleasesFindByAppWithDiff.
+	ConfigDiff *ConfigChangeset `sql:"-"`
 }
 
 func (r *Release) Formation() Formation {
@@ -43,23 +128,56 @@ func (r *Release) Formation() Formation {
 func (r *Release) BeforeCreate() error {
 	t := timex.Now()
 	r.CreatedAt = &t
+
+	if r.Status == "" {
+		r.Status = ReleaseStatusActive
+	}
+
 	return nil
 }
 
 // ReleasesQuery is a Scope implementation for common things to filter releases
 // by.
 type ReleasesQuery struct {
+	// If provided, finds the release with the given id.
+	ID *string
+
 	// If Provided, an app to filter by.
 	App *App
 
 	// If provided, a version to filter by.
 	Version *int
+
+	// If provided, an idempotency key to filter by.
+	IdempotencyKey *string
+
+	// If provided, finds releases with the given status, e.g.
+	// ReleaseStatusActive.
+	Status string
+
+	// If provided, finds releases of the given commit.
+	CommitSHA string
+
+	// If provided, finds releases whose description contains the given
+	// string, ignoring case.
+	DescriptionContains string
+
+	// If provided, finds releases created after or before the given times.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// The page of releases to return.
+	Page Page
 }
 
 // Scope implements the Scope interface.
 func (q ReleasesQuery) Scope(db *gorm.DB) *gorm.DB {
 	var scope ComposedScope
 
+	if q.ID != nil {
+		scope = append(scope, ID(*q.ID))
+	}
+
 	if app := q.App; app != nil {
 		scope = append(scope, FieldEquals("app_id", app.ID))
 	}
@@ -68,6 +186,39 @@ func (q ReleasesQuery) Scope(db *gorm.DB) *gorm.DB {
 		scope = append(scope, FieldEquals("version", *version))
 	}
 
+	if key := q.IdempotencyKey; key != nil {
+		scope = append(scope, FieldEquals("idempotency_key", *key))
+	}
+
+	if q.Status != "" {
+		scope = append(scope, FieldEquals("status", q.Status))
+	}
+
+	if q.CommitSHA != "" {
+		scope = append(scope, FieldEquals("commit_sha", q.CommitSHA))
+	}
+
+	if q.DescriptionContains != "" {
+		pattern := "%" + escapeLike(q.DescriptionContains) + "%"
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("description ILIKE ?", pattern)
+		}))
+	}
+
+	if t := q.CreatedAfter; !t.IsZero() {
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("created_at > ?", t)
+		}))
+	}
+
+	if t := q.CreatedBefore; !t.IsZero() {
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("created_at < ?", t)
+		}))
+	}
+
+	scope = append(scope, q.Page)
+
 	// Preload all the things.
 	scope = append(scope, Preload("App", "Config", "Slug", "Processes"))
 	scope = append(scope, Order("version desc"))
@@ -75,6 +226,43 @@ func (q ReleasesQuery) Scope(db *gorm.DB) *gorm.DB {
 	return scope.Scope(db)
 }
 
+// DefaultReleasesSearchLimit is the maximum number of releases returned by a
+// search when the Page doesn't have a Limit.
+const DefaultReleasesSearchLimit = 100
+
+// ReleasesSearchQuery is a Scope implementation that finds releases of any app
+// whose description, commit sha or branch contain Query, ignoring case.
+type ReleasesSearchQuery struct {
+	Query string
+	Page  Page
+}
+
+// Scope implements the Scope interface.
+func (q ReleasesSearchQuery) Scope(db *gorm.DB) *gorm.DB {
+	pattern := "%" + escapeLike(q.Query) + "%"
+
+	page := q.Page
+	if page.Limit == 0 {
+		page.Limit = DefaultReleasesSearchLimit
+	}
+
+	scope := ComposedScope{
+		ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("description ILIKE ? OR commit_sha ILIKE ? OR branch ILIKE ?", pattern, pattern, pattern)
+		}),
+		Preload("App"),
+		Order("created_at desc"),
+		page,
+	}
+
+	return scope.Scope(db)
+}
+
+// escapeLike escapes the LIKE wildcards in s, so that it's matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 // ReleasesFirst returns the first matching release.
 func (s *store) ReleasesFirst(scope Scope) (*Release, error) {
 	var release Release
@@ -90,8 +278,88 @@ func (s *store) Releases(scope Scope) ([]*Release, error) {
 	return releases, s.Find(scope, &releases)
 }
 
+// ReleasesWithConfigDiff returns a page of the app's releases, with ConfigDiff
+// set to the changes since the previous release. The first release has an
+// empty diff.
+func (s *store) ReleasesWithConfigDiff(app *App, page Page) ([]*Release, error) {
+	// Fetch one more release than was asked for, so that the oldest
+	// release in the page can be diffed against its predecessor.
+	q := page
+	if q.Limit > 0 {
+		q.Limit++
+	}
+
+	releases, err := s.Releases(ComposedScope{ReleasesQuery{App: app}, q})
+	if err != nil {
+		return releases, err
+	}
+
+	// Releases are ordered from newest to oldest.
+	for i, r := range releases {
+		diff := ConfigChangeset{}
+		if i+1 < len(releases) {
+			diff = ConfigDiff(releases[i+1].Config.Vars, r.Config.Vars)
+		}
+		r.ConfigDiff = &diff
+	}
+
+	if page.Limit > 0 && len(releases) > page.Limit {
+		releases = releases[:page.Limit]
+	}
+
+	return releases, nil
+}
+
+// ReleasesActivate marks the draft release as active, and records who approved
+// it. ErrReleaseNotDraft is returned if the release has already been
+// activated.
+func (s *store) ReleasesActivate(r *Release, approvedBy string) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	db := s.db.Exec(`update releases set status = ?, approved_by = ? where id = ? and status = ?`, ReleaseStatusActive, approvedBy, r.ID, ReleaseStatusDraft)
+	if err := db.Error; err != nil {
+		return err
+	}
+
+	if db.RowsAffected == 0 {
+		return ErrReleaseNotDraft
+	}
+
+	r.Status = ReleaseStatusActive
+	r.ApprovedBy = approvedBy
+
+	return nil
+}
+
+// ReleasesPromoteCanary marks the canary release as active. ErrNoCanary is
+// returned if the release isn't a canary.
+func (s *store) ReleasesPromoteCanary(r *Release) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	db := s.db.Exec(`update releases set status = ? where id = ? and status = ?`, ReleaseStatusActive, r.ID, ReleaseStatusCanary)
+	if err := db.Error; err != nil {
+		return err
+	}
+
+	if db.RowsAffected == 0 {
+		return ErrNoCanary
+	}
+
+	r.Status = ReleaseStatusActive
+
+	return nil
+}
+
 // ReleasesCreate persists a release.
 func (s *store) ReleasesCreate(r *Release) (*Release, error) {
+	if err := s.writable(); err != nil {
+		return r, err
+	}
+
 	return releasesCreate(s.db, r)
 }
 
@@ -99,15 +367,188 @@ func (s *store) ReleasesCreate(r *Release) (*Release, error) {
 type releasesService struct {
 	store    *store
 	releaser *releaser
+	notifier *notifier
+
+	// When true, every process is validated by the scheduler before the
+	// release is created.
+	validate bool
+
+	// When true, new releases are tagged by tags.ReleasesAutoTag.
+	autoTag bool
+	tags    *releaseTagsService
+
+	// Runs the app's validation command before the release is created.
+	validator *releaseValidator
 }
 
 // ReleasesCreate creates the release, then sets the current process formation on the release.
 func (s *releasesService) ReleasesCreate(ctx context.Context, r *Release) (*Release, error) {
+	r, err := s.create(ctx, r)
+	if err != nil {
+		return r, err
+	}
+
+	s.notifyRelease(ctx, r, ReleaseEventCreated, "")
+
+	return r, s.release(ctx, r)
+}
+
+// ReleasesDeploy creates and schedules a release for a deploy. Commands that
+// were overridden with ProcessesSetCommand only last until the next deploy, so
+// they aren't applied to the release, and they're cleared once the release
+// has been scheduled. If the deploy fails, they're kept.
+func (s *releasesService) ReleasesDeploy(ctx context.Context, r *Release) (*Release, error) {
+	r.SkipCommandOverrides = true
+
+	r, err := s.ReleasesCreate(ctx, r)
+	if err != nil {
+		return r, err
+	}
+
+	return r, s.store.ProcessCommandOverridesDestroy(r.App)
+}
+
+// release schedules the release onto the cluster.
+func (s *releasesService) release(ctx context.Context, r *Release) error {
+	if err := s.releaser.Release(ctx, r); err != nil {
+		s.notifyRelease(ctx, r, ReleaseEventFailed, err.Error())
+		return err
+	}
+
+	s.notifyRelease(ctx, r, ReleaseEventDeployed, "")
+
+	return nil
+}
+
+// ReleasesCreateDraft creates the release as a draft, which isn't scheduled
+// onto the cluster, and doesn't become the current release, until it's
+// activated with ReleasesActivate.
+func (s *releasesService) ReleasesCreateDraft(ctx context.Context, r *Release) (*Release, error) {
+	r.Status = ReleaseStatusDraft
+	r.SkipStableTag = true
+
+	r, err := s.create(ctx, r)
+	if err != nil {
+		return r, err
+	}
+
+	s.notifyRelease(ctx, r, ReleaseEventCreated, "")
+
+	return r, nil
+}
+
+// ReleasesActivate activates a draft release that was approved by approvedBy,
+// then schedules it onto the cluster. Drafts can't be activated once a newer
+// release is active.
+func (s *releasesService) ReleasesActivate(ctx context.Context, r *Release, approvedBy string) (*Release, error) {
+	if approvedBy == "" {
+		return r, ErrReleaseApproverRequired
+	}
+
+	if r.Status != ReleaseStatusDraft {
+		return r, ErrReleaseNotDraft
+	}
+
+	current, err := s.store.ReleasesFirst(ReleasesQuery{App: r.App, Status: ReleaseStatusActive})
+	if err != nil && err != gorm.RecordNotFound {
+		return r, err
+	}
+	if err == nil && current.Version > r.Version {
+		return r, ErrReleaseDraftSuperseded
+	}
+
+	// The active release may have been scaled since the draft was
+	// created, so the draft takes the formation that's running now.
+	if err := s.refreshFormation(r); err != nil {
+		return r, err
+	}
+
+	if err := s.store.ReleasesActivate(r, approvedBy); err != nil {
+		return r, err
+	}
+
+	if err := s.activated(r); err != nil {
+		return r, err
+	}
+
+	if _, err := s.store.ReleaseTagsSet(&ReleaseTag{
+		AppID:     r.App.ID,
+		ReleaseID: r.ID,
+		Tag:       ReleaseTagStable,
+	}); err != nil {
+		return r, err
+	}
+
+	if s.autoTag {
+		if err := s.tags.ReleasesAutoTag(r.App, r); err != nil {
+			return r, err
+		}
+	}
+
+	return r, s.release(ctx, r)
+}
+
+// refreshFormation rebuilds the formation of the draft from the current
+// active release, and saves it over the draft's processes.
+func (s *releasesService) refreshFormation(r *Release) error {
+	existing := r.Formation()
+
+	if err := s.createFormation(r); err != nil {
+		return err
+	}
+
+	for _, p := range r.Processes {
+		if e, ok := existing[p.Type]; ok {
+			p.ID = e.ID
+		}
+		p.ReleaseID = r.ID
+
+		if err := s.store.ProcessesUpdate(p); err != nil {
+			return err
+		}
+	}
+
+	return s.newProcessPorts(r)
+}
+
+// activated records that the release became the active release of the app.
+func (s *releasesService) activated(r *Release) error {
+	// Record the instance counts for usage reporting.
+	if err := s.createScaleEvents(r); err != nil {
+		return err
+	}
+
+	// The stored job states are stale now, they'll be refreshed the next
+	// time they're requested.
+	return s.store.JobStateSnapshotsInvalidate(r.App)
+}
+
+// notifyRelease sends a ReleaseEvent to streams of the app. Failing to notify
+// streams doesn't fail the release, so errors are only reported.
+func (s *releasesService) notifyRelease(ctx context.Context, r *Release, typ, message string) {
+	if err := s.store.notifyRelease(r, typ, message); err != nil {
+		reporter.Report(ctx, err)
+	}
+}
+
+// create persists the release along with its formation, without scheduling
+// it onto the cluster.
+func (s *releasesService) create(ctx context.Context, r *Release) (*Release, error) {
 	// Create a new formation for this release.
 	if err := s.createFormation(r); err != nil {
 		return nil, err
 	}
 
+	if s.validate {
+		if err := s.releaser.Validate(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.validator.Validate(ctx, r); err != nil {
+		return nil, err
+	}
+
 	r, err := s.store.ReleasesCreate(r)
 	if err != nil {
 		return r, err
@@ -118,15 +559,38 @@ func (s *releasesService) ReleasesCreate(ctx context.Context, r *Release) (*Rele
 		return nil, err
 	}
 
-	// Schedule the new release onto the cluster.
-	return r, s.releaser.Release(ctx, r)
+	// Drafts and canaries don't replace the running release until they're
+	// activated or promoted.
+	if r.Status == ReleaseStatusActive {
+		if err := s.activated(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if !r.SkipStableTag {
+		if _, err := s.store.ReleaseTagsSet(&ReleaseTag{
+			AppID:     r.App.ID,
+			ReleaseID: r.ID,
+			Tag:       ReleaseTagStable,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.autoTag && r.Status == ReleaseStatusActive {
+		if err := s.tags.ReleasesAutoTag(r.App, r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
 }
 
 func (s *releasesService) createFormation(release *Release) error {
 	var existing Formation
 
 	// Get the old release, so we can copy the Formation.
-	last, err := s.store.ReleasesFirst(ReleasesQuery{App: release.App})
+	last, err := s.store.ReleasesFirst(ReleasesQuery{App: release.App, Status: ReleaseStatusActive})
 	if err != nil {
 		if err != gorm.RecordNotFound {
 			return err
@@ -136,11 +600,71 @@ func (s *releasesService) createFormation(release *Release) error {
 	}
 
 	f := NewFormation(existing, release.Slug.ProcessTypes)
+
+	if !release.SkipCommandOverrides {
+		overrides, err := s.store.ProcessCommandOverrides(release.App)
+		if err != nil {
+			return err
+		}
+		applyCommandOverrides(f, overrides)
+	}
+
 	release.Processes = f.Processes()
 
 	return nil
 }
 
+// createScaleEvents records a ScaleEvent for each process in the release, and
+// a ScaleEvent with a quantity of 0 for each process type that was running
+// before, but was removed by the release, so that it stops counting towards
+// usage.
+func (s *releasesService) createScaleEvents(r *Release) error {
+	events, err := s.store.ScaleEvents(ScaleEventsQuery{App: r.App})
+	if err != nil {
+		return err
+	}
+
+	// The events are ordered by when they happened, so the last one for
+	// each type is its current quantity.
+	quantities := make(map[ProcessType]int)
+	for _, e := range events {
+		quantities[e.ProcessType] = e.Quantity
+	}
+
+	for _, p := range r.Processes {
+		delete(quantities, p.Type)
+	}
+
+	var removed []string
+	for t, q := range quantities {
+		if q > 0 {
+			removed = append(removed, string(t))
+		}
+	}
+	sort.Strings(removed)
+
+	for _, t := range removed {
+		if _, err := s.store.ScaleEventsCreate(&ScaleEvent{
+			AppID:       r.App.ID,
+			ProcessType: ProcessType(t),
+			Quantity:    0,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range r.Processes {
+		if _, err := s.store.ScaleEventsCreate(&ScaleEvent{
+			AppID:       r.App.ID,
+			ProcessType: p.Type,
+			Quantity:    p.Quantity,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // newProcessPorts returns a map of ports for a release. It will allocate new ports to an app if need be.
 func (s *releasesService) newProcessPorts(r *Release) error {
 	for _, p := range r.Processes {
@@ -163,13 +687,54 @@ func (s *releasesService) ReleasesRollback(ctx context.Context, app *App, versio
 		return nil, err
 	}
 
+	// Rollbacks shouldn't be blocked by a failing validation command,
+	// since they're usually how a bad release is recovered from.
 	desc := fmt.Sprintf("Rollback to v%d", version)
-	return s.ReleasesCreate(ctx, &Release{
+	release, err := s.ReleasesCreate(withoutValidation(ctx), &Release{
 		App:         app,
 		Config:      r.Config,
 		Slug:        r.Slug,
 		Description: desc,
 	})
+	if err != nil {
+		return release, err
+	}
+
+	s.notifier.Notify(ctx, Notification{
+		Severity: SeverityWarning,
+		App:      app.Name,
+		Event:    NotificationRollback,
+		Message:  fmt.Sprintf("Rolled back %s to v%d", app.Name, version),
+	})
+
+	return release, nil
+}
+
+// ReleasesGraftConfig creates a new release with the slug of the given version
+// and the config with newConfigID, e.g. to fix a mistake in the config of a
+// release. ErrConfigNotFound is returned if the config doesn't exist, or
+// belongs to another app.
+func (s *releasesService) ReleasesGraftConfig(ctx context.Context, app *App, version int, newConfigID string) (*Release, error) {
+	r, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Version: &version})
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.store.ConfigsFind(newConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AppID != app.ID {
+		return nil, ErrConfigNotFound
+	}
+
+	return s.ReleasesDeploy(ctx, &Release{
+		App:         app,
+		Config:      config,
+		Slug:        r.Slug,
+		Description: fmt.Sprintf("Config fix for v%d", version),
+	})
 }
 
 // ReleasesLastVersion returns the last ReleaseVersion for the given App. This
@@ -208,6 +773,9 @@ func releasesCreate(db *gorm.DB, release *Release) (*Release, error) {
 
 	if err := t.Create(release).Error; err != nil {
 		t.Rollback()
+		if err, ok := err.(*pq.Error); ok && err.Code.Name() == "unique_violation" && err.Constraint == "index_releases_on_app_id_and_idempotency_key" {
+			return release, errDuplicateIdempotencyKey
+		}
 		return release, err
 	}
 
@@ -219,15 +787,169 @@ func releasesCreate(db *gorm.DB, release *Release) (*Release, error) {
 	return release, nil
 }
 
+// DefaultRollingBatchSize is the number of instances of each process that are
+// added in each step of a rolling deploy.
+var DefaultRollingBatchSize = 2
+
+// DefaultRollingHealthTimeout is how long a rolling deploy waits for each
+// batch to become healthy by default.
+var DefaultRollingHealthTimeout = 5 * time.Minute
+
+// ErrRollingDeployUnhealthy is returned when a batch of a rolling deploy
+// doesn't become healthy in time. The instances that were already added are
+// left running.
+var ErrRollingDeployUnhealthy = errors.New("rolling deploy: batch did not become healthy")
+
 type releaser struct {
 	manager service.Manager
+
+	// The number of instances to add in each step of a rolling deploy.
+	// Defaults to DefaultRollingBatchSize.
+	batchSize int
+
+	// How long to wait for each batch of a rolling deploy to become
+	// healthy, and how often to check. The timeout defaults to
+	// DefaultRollingHealthTimeout.
+	healthTimeout time.Duration
+	pollInterval  time.Duration
+}
+
+// Validate asks the scheduler to validate every process in the release,
+// returning a SchedulerValidationError for the first one that fails.
+func (r *releaser) Validate(ctx context.Context, release *Release) error {
+	a := newServiceApp(release)
+
+	for _, p := range a.Processes {
+		if err := r.manager.Validate(ctx, a, p); err != nil {
+			return &SchedulerValidationError{ProcessType: ProcessType(p.Type), Err: err}
+		}
+	}
+
+	return nil
 }
 
 // ScheduleRelease creates jobs for every process and instance count and
-// schedules them onto the cluster.
+// schedules them onto the cluster, using the apps deploy strategy.
 func (r *releaser) Release(ctx context.Context, release *Release) error {
 	a := newServiceApp(release)
-	return r.manager.Submit(ctx, a)
+
+	switch release.App.DeployStrategy {
+	case DeployStrategyRolling:
+		return r.releaseRolling(ctx, a)
+	default:
+		return r.manager.Submit(ctx, a)
+	}
+}
+
+// releaseRolling submits the app in batches, starting the new release from
+// zero instances of each process and growing it by the batch size in each
+// step, while the instances that are running now are scaled down by the same
+// amount. Each batch of the new release has to be healthy before the next one
+// is submitted.
+func (r *releaser) releaseRolling(ctx context.Context, a *service.App) error {
+	batchSize := r.batchSize
+	if batchSize <= 0 {
+		batchSize = DefaultRollingBatchSize
+	}
+
+	timeout := r.healthTimeout
+	if timeout == 0 {
+		timeout = DefaultRollingHealthTimeout
+	}
+
+	instances, err := r.manager.Instances(ctx, a.ID)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]uint)
+	for _, i := range instances {
+		current[i.Process.Type]++
+	}
+
+	steps := rollingSteps(a, current, uint(batchSize))
+	for i, step := range steps {
+		if err := r.manager.Submit(ctx, step.app); err != nil {
+			return err
+		}
+
+		// The last step is the desired formation, which the scheduler
+		// converges to on its own.
+		if i == len(steps)-1 {
+			break
+		}
+
+		ok, err := waitForHealthy(ctx, r.manager, step.healthy, timeout, r.pollInterval)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return ErrRollingDeployUnhealthy
+		}
+	}
+
+	return nil
+}
+
+// rollingStep is a single batch of a rolling deploy.
+type rollingStep struct {
+	// The app to submit, with the number of instances of each process
+	// that should be running in total.
+	app *service.App
+
+	// The number of instances of the new release that have to be running
+	// before the step is healthy.
+	healthy *service.App
+}
+
+// rollingSteps returns the steps of a rolling deploy. In each step the new
+// release runs batchSize more instances of each process, up to the desired
+// number, and the instances in current are scaled down by batchSize, so the
+// total never drops below what's running. The last step runs the desired
+// number of instances of every process.
+func rollingSteps(a *service.App, current map[string]uint, batchSize uint) []*rollingStep {
+	var steps []*rollingStep
+	for n := batchSize; ; n += batchSize {
+		step := &rollingStep{app: copyServiceApp(a), healthy: copyServiceApp(a)}
+
+		done := true
+		for i, p := range a.Processes {
+			instances := p.Instances
+			if n < instances {
+				instances = n
+				done = false
+			}
+
+			var old uint
+			if c := current[p.Type]; c > n {
+				old = c - n
+				done = false
+			}
+
+			step.app.Processes[i].Instances = instances + old
+			step.healthy.Processes[i].Instances = instances
+		}
+
+		steps = append(steps, step)
+
+		if done {
+			break
+		}
+	}
+
+	return steps
+}
+
+// copyServiceApp returns a copy of the app with copies of its processes.
+func copyServiceApp(a *service.App) *service.App {
+	c := *a
+	c.Processes = nil
+	for _, p := range a.Processes {
+		pp := *p
+		c.Processes = append(c.Processes, &pp)
+	}
+	return &c
 }
 
 func newServiceApp(release *Release) *service.App {
@@ -267,6 +989,7 @@ func newServiceProcess(release *Release, p *Process) *service.Process {
 	return &service.Process{
 		Type:        string(p.Type),
 		Env:         env,
+		EnvOrder:    release.Config.VarOrder,
 		Command:     string(p.Command),
 		Image:       release.Slug.Image.String(),
 		Instances:   uint(p.Quantity),
@@ -275,6 +998,7 @@ func newServiceProcess(release *Release, p *Process) *service.Process {
 		Ports:       ports,
 		Exposure:    procExp,
 		SSLCert:     cert,
+		StopTimeout: time.Duration(release.App.DrainTimeoutSeconds) * time.Second,
 	}
 }
 
@@ -1,17 +1,371 @@
 package empire
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
 
 func TestReleasesQuery(t *testing.T) {
+	id := "4321"
 	app := &App{ID: "1234"}
 	version := 1
+	key := "abcd"
+	after := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2016, 2, 1, 0, 0, 0, 0, time.UTC)
 
 	tests := scopeTests{
 		{ReleasesQuery{}, "ORDER BY version desc", []interface{}{}},
+		{ReleasesQuery{ID: &id}, "WHERE (id = $1) ORDER BY version desc", []interface{}{id}},
 		{ReleasesQuery{App: app}, "WHERE (app_id = $1) ORDER BY version desc", []interface{}{"1234"}},
 		{ReleasesQuery{Version: &version}, "WHERE (version = $1) ORDER BY version desc", []interface{}{1}},
 		{ReleasesQuery{App: app, Version: &version}, "WHERE (app_id = $1) AND (version = $2) ORDER BY version desc", []interface{}{"1234", 1}},
+		{ReleasesQuery{App: app, IdempotencyKey: &key}, "WHERE (app_id = $1) AND (idempotency_key = $2) ORDER BY version desc", []interface{}{"1234", "abcd"}},
+		{ReleasesQuery{App: app, Status: ReleaseStatusActive}, "WHERE (app_id = $1) AND (status = $2) ORDER BY version desc", []interface{}{"1234", "active"}},
+		{ReleasesQuery{CommitSHA: "abc123"}, "WHERE (commit_sha = $1) ORDER BY version desc", []interface{}{"abc123"}},
+		{ReleasesQuery{DescriptionContains: "100%"}, "WHERE (description ILIKE $1) ORDER BY version desc", []interface{}{`%100\%%`}},
+		{ReleasesQuery{App: app, CreatedAfter: after}, "WHERE (app_id = $1) AND (created_at > $2) ORDER BY version desc", []interface{}{"1234", after}},
+		{ReleasesQuery{CreatedAfter: after, CreatedBefore: before}, "WHERE (created_at > $1) AND (created_at < $2) ORDER BY version desc", []interface{}{after, before}},
+		{ReleasesQuery{App: app, Page: Page{Limit: 10, Offset: 20}}, "WHERE (app_id = $1) ORDER BY version desc LIMIT 10 OFFSET 20", []interface{}{"1234"}},
+	}
+
+	tests.Run(t)
+}
+
+func TestReleasesSearchQuery(t *testing.T) {
+	where := "WHERE (description ILIKE $1 OR commit_sha ILIKE $2 OR branch ILIKE $3) ORDER BY created_at desc"
+
+	tests := scopeTests{
+		{ReleasesSearchQuery{Query: "abc123"}, where + " LIMIT 100", []interface{}{"%abc123%", "%abc123%", "%abc123%"}},
+		{ReleasesSearchQuery{Query: "100%"}, where + " LIMIT 100", []interface{}{`%100\%%`, `%100\%%`, `%100\%%`}},
+		{ReleasesSearchQuery{Query: "master", Page: Page{Limit: 10, Offset: 20}}, where + " LIMIT 10 OFFSET 20", []interface{}{"%master%", "%master%", "%master%"}},
 	}
 
 	tests.Run(t)
 }
+
+func TestReleaser_Release(t *testing.T) {
+	newRelease := func(strategy string) *Release {
+		return &Release{
+			App:    &App{ID: "1234", Name: "acme-inc", DeployStrategy: strategy},
+			Config: &Config{},
+			Slug:   &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+			Processes: []*Process{
+				{Type: "web", Quantity: 5},
+				{Type: "worker", Quantity: 1},
+			},
+		}
+	}
+
+	tests := []struct {
+		strategy string
+
+		// The expected number of web and worker instances for each
+		// submit.
+		web    []uint
+		worker []uint
+	}{
+		{DeployStrategyRecreate, []uint{5}, []uint{1}},
+		{"", []uint{5}, []uint{1}},
+		{DeployStrategyRolling, []uint{2, 4, 5}, []uint{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		m := &convergingManager{mockManager: newMockManager()}
+		r := &releaser{manager: m, batchSize: 2, pollInterval: time.Millisecond}
+
+		if err := r.Release(context.Background(), newRelease(tt.strategy)); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := len(m.submitted), len(tt.web); got != want {
+			t.Fatalf("%s: Submits => %d; want %d", tt.strategy, got, want)
+		}
+
+		for i, a := range m.submitted {
+			instances := make(map[string]uint)
+			for _, p := range a.Processes {
+				instances[p.Type] = p.Instances
+			}
+
+			if got, want := instances["web"], tt.web[i]; got != want {
+				t.Fatalf("%s: #%d: web => %d; want %d", tt.strategy, i, got, want)
+			}
+
+			if got, want := instances["worker"], tt.worker[i]; got != want {
+				t.Fatalf("%s: #%d: worker => %d; want %d", tt.strategy, i, got, want)
+			}
+		}
+	}
+}
+
+func TestReleaser_Release_RollingFromCurrent(t *testing.T) {
+	release := &Release{
+		App:     &App{ID: "1234", Name: "acme-inc", DeployStrategy: DeployStrategyRolling},
+		Config:  &Config{},
+		Slug:    &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+		Version: 2,
+		Processes: []*Process{
+			{Type: "web", Quantity: 8},
+			{Type: "worker", Quantity: 1},
+		},
+	}
+
+	// 3 instances of web are running the previous release.
+	v1 := &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}
+	m := &convergingManager{mockManager: newMockManager(
+		&service.Instance{ID: "1", Process: v1, State: "RUNNING"},
+		&service.Instance{ID: "2", Process: v1, State: "RUNNING"},
+		&service.Instance{ID: "3", Process: v1, State: "RUNNING"},
+	)}
+	r := &releaser{manager: m, batchSize: 2, pollInterval: time.Millisecond}
+
+	if err := r.Release(context.Background(), release); err != nil {
+		t.Fatal(err)
+	}
+
+	var web []uint
+	for _, a := range m.submitted {
+		for _, p := range a.Processes {
+			if p.Type == "web" {
+				web = append(web, p.Instances)
+			}
+		}
+	}
+
+	// The 3 instances of v1 are replaced two at a time while v2 grows, so
+	// web is never scaled below the 3 instances that were running.
+	if got, want := web, []uint{3, 4, 6, 8}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("web => %v; want %v", got, want)
+	}
+}
+
+func TestReleaser_Release_RollingSameSize(t *testing.T) {
+	release := &Release{
+		App:       &App{ID: "1234", Name: "acme-inc", DeployStrategy: DeployStrategyRolling},
+		Config:    &Config{},
+		Slug:      &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+		Version:   2,
+		Processes: []*Process{{Type: "web", Quantity: 4}},
+	}
+
+	// The same number of web instances are running the previous release.
+	v1 := &service.Process{Type: "web", Env: map[string]string{"EMPIRE_RELEASE": "v1"}}
+	var instances []*service.Instance
+	for i := 0; i < 4; i++ {
+		instances = append(instances, &service.Instance{ID: fmt.Sprintf("%d", i), Process: v1, State: "RUNNING"})
+	}
+	m := &convergingManager{mockManager: newMockManager(instances...)}
+	r := &releaser{manager: m, batchSize: 2, pollInterval: time.Millisecond}
+
+	if err := r.Release(context.Background(), release); err != nil {
+		t.Fatal(err)
+	}
+
+	// The redeploy is still rolled out in batches, without changing the
+	// number of instances.
+	var web []uint
+	for _, a := range m.submitted {
+		web = append(web, a.Processes[0].Instances)
+	}
+
+	if got, want := web, []uint{4, 4}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("web => %v; want %v", got, want)
+	}
+}
+
+func TestRollingSteps(t *testing.T) {
+	a := &service.App{
+		ID: "1234",
+		Processes: []*service.Process{
+			{Type: "web", Instances: 5},
+			{Type: "worker", Instances: 1},
+		},
+	}
+
+	steps := rollingSteps(a, map[string]uint{"web": 5, "worker": 3}, 2)
+
+	tests := []struct {
+		// The number of instances submitted in total, and of the new
+		// release, for web and worker.
+		web, worker               uint
+		healthyWeb, healthyWorker uint
+	}{
+		{5, 2, 2, 1},
+		{5, 1, 4, 1},
+		{5, 1, 5, 1},
+	}
+
+	if got, want := len(steps), len(tests); got != want {
+		t.Fatalf("steps => %d; want %d", got, want)
+	}
+
+	for i, tt := range tests {
+		step := steps[i]
+
+		if got, want := []uint{step.app.Processes[0].Instances, step.app.Processes[1].Instances}, []uint{tt.web, tt.worker}; !reflect.DeepEqual(got, want) {
+			t.Errorf("#%d: instances => %v; want %v", i, got, want)
+		}
+
+		if got, want := []uint{step.healthy.Processes[0].Instances, step.healthy.Processes[1].Instances}, []uint{tt.healthyWeb, tt.healthyWorker}; !reflect.DeepEqual(got, want) {
+			t.Errorf("#%d: healthy => %v; want %v", i, got, want)
+		}
+	}
+
+	// The app that was passed in isn't modified.
+	if got, want := a.Processes[0].Instances, uint(5); got != want {
+		t.Fatalf("Instances => %d; want %d", got, want)
+	}
+}
+
+func TestReleaser_Release_RollingUnhealthy(t *testing.T) {
+	release := &Release{
+		App:       &App{ID: "1234", Name: "acme-inc", DeployStrategy: DeployStrategyRolling},
+		Config:    &Config{},
+		Slug:      &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+		Processes: []*Process{{Type: "web", Quantity: 4}},
+	}
+
+	// The mock manager never runs what's submitted.
+	m := newMockManager()
+	r := &releaser{manager: m, batchSize: 2, healthTimeout: 10 * time.Millisecond, pollInterval: time.Millisecond}
+
+	if err := r.Release(context.Background(), release); err != ErrRollingDeployUnhealthy {
+		t.Fatalf("err => %v; want %v", err, ErrRollingDeployUnhealthy)
+	}
+
+	// The next batch isn't submitted.
+	if got, want := len(m.submitted), 1; got != want {
+		t.Fatalf("Submits => %d; want %d", got, want)
+	}
+}
+
+// convergingManager is a mockManager that runs every instance of the last app
+// that was submitted.
+type convergingManager struct {
+	*mockManager
+}
+
+func (m *convergingManager) Instances(ctx context.Context, app string) ([]*service.Instance, error) {
+	if len(m.submitted) == 0 {
+		return m.mockManager.Instances(ctx, app)
+	}
+
+	var instances []*service.Instance
+	for _, p := range m.submitted[len(m.submitted)-1].Processes {
+		for i := uint(0); i < p.Instances; i++ {
+			instances = append(instances, &service.Instance{Process: p, State: "RUNNING"})
+		}
+	}
+	return instances, nil
+}
+
+func TestReleaser_Release_EnvOrder(t *testing.T) {
+	host, url, env := "localhost", "postgres://$DB_HOST/acme", "production"
+
+	release := &Release{
+		App: &App{ID: "1234", Name: "acme-inc"},
+		Config: &Config{
+			Vars: Vars{
+				"DB_HOST":      &host,
+				"DATABASE_URL": &url,
+				"RAILS_ENV":    &env,
+			},
+			VarOrder: VarOrder{"DB_HOST", "DATABASE_URL"},
+		},
+		Slug:      &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+		Processes: []*Process{{Type: "web", Quantity: 1}},
+	}
+
+	m := newMockManager()
+	r := &releaser{manager: m}
+
+	if err := r.Release(context.Background(), release); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(m.submitted), 1; got != want {
+		t.Fatalf("Submits => %d; want %d", got, want)
+	}
+
+	// Vars in the order come first, followed by everything else,
+	// including the vars that Empire sets, alphabetically.
+	want := []string{
+		"DB_HOST",
+		"DATABASE_URL",
+		"EMPIRE_APPNAME",
+		"EMPIRE_CREATED_AT",
+		"EMPIRE_PROCESS",
+		"EMPIRE_RELEASE",
+		"RAILS_ENV",
+		"SOURCE",
+	}
+
+	if got := m.submitted[0].Processes[0].EnvKeys(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("EnvKeys => %v; want %v", got, want)
+	}
+}
+
+func TestReleaser_Release_DrainTimeout(t *testing.T) {
+	release := &Release{
+		App:       &App{ID: "1234", Name: "acme-inc", DrainTimeoutSeconds: 120},
+		Config:    &Config{},
+		Slug:      &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+		Processes: []*Process{{Type: "web", Quantity: 1}},
+	}
+
+	m := newMockManager()
+	r := &releaser{manager: m}
+
+	if err := r.Release(context.Background(), release); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.submitted[0].Processes[0].StopTimeout, 120*time.Second; got != want {
+		t.Fatalf("StopTimeout => %v; want %v", got, want)
+	}
+}
+
+func TestReleaser_Validate(t *testing.T) {
+	release := &Release{
+		App:    &App{ID: "1234", Name: "acme-inc"},
+		Config: &Config{},
+		Slug:   &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+		Processes: []*Process{
+			{Type: "web", Quantity: 1},
+			{Type: "worker", Quantity: 1},
+		},
+	}
+
+	m := newMockManager()
+	r := &releaser{manager: m}
+
+	if err := r.Validate(context.Background(), release); err != nil {
+		t.Fatal(err)
+	}
+
+	errInvalid := errors.New("memory must be at least 4MB")
+	m.invalid["worker"] = errInvalid
+
+	err, ok := r.Validate(context.Background(), release).(*SchedulerValidationError)
+	if !ok {
+		t.Fatalf("err => %v; want a SchedulerValidationError", err)
+	}
+
+	if got, want := err.Err, errInvalid; got != want {
+		t.Fatalf("Err => %v; want %v", got, want)
+	}
+
+	if got, want := err.ProcessType, ProcessType("worker"); got != want {
+		t.Fatalf("ProcessType => %s; want %s", got, want)
+	}
+
+	if len(m.submitted) != 0 {
+		t.Fatal("Expected nothing to be submitted")
+	}
+}
@@ -3,13 +3,59 @@ package empire
 import (
 	"encoding/json"
 	"io"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/remind101/empire/empire/pkg/registry"
 )
 
+// DefaultRegistryTimeout is how long a request to check whether an image exists
+// in its registry has to complete.
+const DefaultRegistryTimeout = 30 * time.Second
+
 type Resolver interface {
 	Resolve(Image, chan Event) (Image, error)
+
+	// ImageExists returns false if the image no longer exists in its
+	// registry.
+	ImageExists(Image) (bool, error)
+}
+
+// RegistryRouter determines which registry credentials should be used to pull
+// an image.
+type RegistryRouter interface {
+	// RegistryFor returns the auth configuration to use for the image. A
+	// nil AuthConfiguration means that no specific credentials apply and
+	// the default docker.AuthConfigurations should be used.
+	RegistryFor(image string) (*docker.AuthConfiguration, error)
+}
+
+// MapRegistryRouter is a RegistryRouter that maps image prefixes (e.g.
+// "quay.io/" or "gcr.io/my-project/") to an auth configuration. When more than
+// one prefix matches, the longest prefix wins.
+type MapRegistryRouter map[string]docker.AuthConfiguration
+
+// RegistryFor implements the RegistryRouter interface.
+func (m MapRegistryRouter) RegistryFor(image string) (*docker.AuthConfiguration, error) {
+	var (
+		match string
+		found bool
+	)
+
+	for prefix := range m {
+		if strings.HasPrefix(image, prefix) && (!found || len(prefix) > len(match)) {
+			match, found = prefix, true
+		}
+	}
+
+	if !found {
+		return nil, nil
+	}
+
+	a := m[match]
+	return &a, nil
 }
 
 // fakeResolver is a fake resolver that will just return the provided image.
@@ -23,17 +69,31 @@ func (r *fakeResolver) Resolve(image Image, out chan Event) (Image, error) {
 	return image, nil
 }
 
+// ImageExists always returns true.
+func (r *fakeResolver) ImageExists(image Image) (bool, error) {
+	return true, nil
+}
+
 // dockerResolver is a resolver that pulls the docker image, then inspects it to
 // get the canonical image id.
 type dockerResolver struct {
-	client *docker.Client
+	client dockerClient
 	auth   *docker.AuthConfigurations
+
+	// router, if provided, is consulted before falling back to auth.
+	router RegistryRouter
+
+	// The http.Client used to check whether images exist in their
+	// registry. Defaults to a client that times out after
+	// DefaultRegistryTimeout.
+	registryClient *http.Client
 }
 
-func newDockerResolver(c *docker.Client, auth *docker.AuthConfigurations) Resolver {
+func newDockerResolver(c dockerClient, auth *docker.AuthConfigurations, router RegistryRouter) Resolver {
 	return &dockerResolver{
 		client: c,
 		auth:   auth,
+		router: router,
 	}
 }
 
@@ -72,30 +132,85 @@ func (r *dockerResolver) Resolve(image Image, out chan Event) (Image, error) {
 	}, nil
 }
 
+// ImageExists makes a HEAD request for the manifest of the image in its
+// registry, without pulling it, returning false if the registry reports that it
+// doesn't exist.
+func (r *dockerResolver) ImageExists(image Image) (bool, error) {
+	a, err := r.authConfiguration(image)
+	if err != nil {
+		return false, err
+	}
+
+	reg, path, err := registry.Split(string(image.Repo))
+	if err != nil {
+		return false, err
+	}
+
+	client := r.registryClient
+	if client == nil {
+		client = &http.Client{Timeout: DefaultRegistryTimeout}
+	}
+
+	return registry.ManifestExists(client, registry.URL(reg), path, image.ID, registry.Credentials{
+		Username: a.Username,
+		Password: a.Password,
+	})
+}
+
 // pullImage can pull a docker image from a repo, by it's imageID.
 //
 // Because docker does not support pulling an image by ID, we're assuming that
 // the docker image has been tagged with it's own ID beforehand.
 func (r *dockerResolver) pullImage(i Image, output io.Writer) error {
+	a, err := r.authConfiguration(i)
+	if err != nil {
+		return err
+	}
+
+	return r.client.PullImage(docker.PullImageOptions{
+		Repository:    string(i.Repo),
+		Tag:           i.ID,
+		OutputStream:  output,
+		RawJSONStream: true,
+	}, a)
+}
+
+// authConfiguration returns the credentials to use when pulling the image.
+func (r *dockerResolver) authConfiguration(i Image) (docker.AuthConfiguration, error) {
+	return registryAuth(r.router, r.auth, i)
+}
+
+// registryAuth returns the credentials to use for the images registry. The
+// RegistryRouter takes precedence, falling back to the docker
+// AuthConfigurations keyed by registry.
+func registryAuth(router RegistryRouter, auth *docker.AuthConfigurations, i Image) (docker.AuthConfiguration, error) {
 	var a docker.AuthConfiguration
 
+	if router != nil {
+		c, err := router.RegistryFor(i.String())
+		if err != nil {
+			return a, err
+		}
+
+		if c != nil {
+			return *c, nil
+		}
+	}
+
 	reg, _, err := registry.Split(string(i.Repo))
 	if err != nil {
-		return err
+		return a, err
 	}
 
 	if reg == "" {
 		reg = "https://index.docker.io/v1/"
 	}
 
-	if c, ok := r.auth.Configs[reg]; ok {
-		a = c
+	if auth != nil {
+		if c, ok := auth.Configs[reg]; ok {
+			a = c
+		}
 	}
 
-	return r.client.PullImage(docker.PullImageOptions{
-		Repository:    string(i.Repo),
-		Tag:           i.ID,
-		OutputStream:  output,
-		RawJSONStream: true,
-	}, a)
+	return a, nil
 }
@@ -0,0 +1,86 @@
+package empire
+
+import (
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+func TestMapRegistryRouter(t *testing.T) {
+	router := MapRegistryRouter{
+		"quay.io/":           docker.AuthConfiguration{Username: "quay"},
+		"quay.io/remind101/": docker.AuthConfiguration{Username: "remind101"},
+	}
+
+	tests := []struct {
+		image    string
+		username string
+		found    bool
+	}{
+		{"quay.io/remind101/acme-inc:latest", "remind101", true},
+		{"quay.io/ejholmes/acme-inc:latest", "quay", true},
+		{"remind101/acme-inc:latest", "", false},
+	}
+
+	for i, tt := range tests {
+		a, err := router.RegistryFor(tt.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := a != nil, tt.found; got != want {
+			t.Fatalf("#%d: Found => %v; want %v", i, got, want)
+		}
+
+		if a == nil {
+			continue
+		}
+
+		if got, want := a.Username, tt.username; got != want {
+			t.Fatalf("#%d: Username => %s; want %s", i, got, want)
+		}
+	}
+}
+
+func TestDockerResolver_AuthConfiguration(t *testing.T) {
+	auth := &docker.AuthConfigurations{
+		Configs: map[string]docker.AuthConfiguration{
+			"https://index.docker.io/v1/": docker.AuthConfiguration{Username: "default"},
+			"quay.io":                     docker.AuthConfiguration{Username: "quay"},
+		},
+	}
+
+	router := MapRegistryRouter{
+		"quay.io/remind101/": docker.AuthConfiguration{Username: "remind101"},
+	}
+
+	tests := []struct {
+		router   RegistryRouter
+		image    Image
+		username string
+	}{
+		// Matching prefix uses the routed credentials.
+		{router, Image{Repo: "quay.io/remind101/acme-inc", ID: "latest"}, "remind101"},
+
+		// Unmatched images fall back to the default credentials.
+		{router, Image{Repo: "quay.io/ejholmes/acme-inc", ID: "latest"}, "quay"},
+		{router, Image{Repo: "remind101/acme-inc", ID: "latest"}, "default"},
+
+		// A nil router preserves the existing behavior.
+		{nil, Image{Repo: "quay.io/remind101/acme-inc", ID: "latest"}, "quay"},
+		{nil, Image{Repo: "remind101/acme-inc", ID: "latest"}, "default"},
+	}
+
+	for i, tt := range tests {
+		r := &dockerResolver{auth: auth, router: tt.router}
+
+		a, err := r.authConfiguration(tt.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := a.Username, tt.username; got != want {
+			t.Fatalf("#%d: Username => %s; want %s", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+// DefaultMigrationHealthTimeout is how long MigrateApps waits for an app to
+// become healthy on the new scheduler by default.
+var DefaultMigrationHealthTimeout = 5 * time.Minute
+
+// errMigrationUnhealthy is returned when an app doesn't become healthy on the
+// new scheduler within the timeout.
+var errMigrationUnhealthy = errors.New("app did not become healthy on the new scheduler")
+
+// MigrationReport is the result of migrating apps between schedulers.
+type MigrationReport struct {
+	// The names of the apps that were migrated.
+	Succeeded []string
+
+	// The names of the apps that failed to migrate. These apps are still
+	// running on the old scheduler.
+	Failed []string
+
+	// The names of the apps that weren't migrated because they have no
+	// releases.
+	Skipped []string
+}
+
+// schedulerMigrator moves apps from one scheduler to another.
+type schedulerMigrator struct {
+	store    *store
+	releases *releasesService
+
+	// How long to wait for an app to become healthy on the new scheduler.
+	// Defaults to DefaultMigrationHealthTimeout.
+	healthTimeout time.Duration
+
+	// How often to check if the app is healthy on the new scheduler.
+	pollInterval time.Duration
+}
+
+// MigrateApps migrates the current release of every app from one scheduler to
+// the other. Apps are removed from the old scheduler only after all of their
+// processes are running on the new one; if that doesn't happen, the app is
+// removed from the new scheduler and left running on the old one.
+func (m *schedulerMigrator) MigrateApps(ctx context.Context, from, to service.Manager) (*MigrationReport, error) {
+	apps, err := m.store.Apps(All)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &MigrationReport{}
+
+	for _, app := range apps {
+		release, err := m.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+		if err != nil {
+			if err == gorm.RecordNotFound {
+				report.Skipped = append(report.Skipped, app.Name)
+				continue
+			}
+			return report, err
+		}
+
+		if err := m.migrate(ctx, release, from, to); err != nil {
+			reporter.Report(ctx, fmt.Errorf("migrating %s: %v", app.Name, err))
+			report.Failed = append(report.Failed, app.Name)
+			continue
+		}
+
+		report.Succeeded = append(report.Succeeded, app.Name)
+	}
+
+	return report, nil
+}
+
+// migrate schedules the release on the new scheduler, waits for it to become
+// healthy, then removes it from the old scheduler. The old scheduler isn't
+// touched until the new one is running every process of the release.
+//
+// Both schedulers find an app's load balancers by the app and process type, so
+// the new scheduler adopts the load balancers that the old one is using. The
+// app is removed from either scheduler without destroying them.
+func (m *schedulerMigrator) migrate(ctx context.Context, release *Release, from, to service.Manager) error {
+	// Ports aren't stored with the release, so the web process needs its
+	// port to keep its load balancer.
+	if err := m.releases.newProcessPorts(release); err != nil {
+		return err
+	}
+
+	a := newServiceApp(release)
+
+	if err := to.Submit(ctx, a); err != nil {
+		return m.abort(ctx, a, to, err)
+	}
+
+	if err := m.waitForHealthy(ctx, a, to); err != nil {
+		return m.abort(ctx, a, to, err)
+	}
+
+	return from.Remove(service.KeepLoadBalancers(ctx), a.ID)
+}
+
+// abort removes the app from the new scheduler after a failed migration. The
+// load balancers are still used by the old scheduler, so they're kept.
+func (m *schedulerMigrator) abort(ctx context.Context, a *service.App, to service.Manager, err error) error {
+	if rerr := to.Remove(service.KeepLoadBalancers(ctx), a.ID); rerr != nil {
+		reporter.Report(ctx, rerr)
+	}
+	return err
+}
+
+// waitForHealthy polls the scheduler until every process of the app has its
+// desired number of running instances.
+func (m *schedulerMigrator) waitForHealthy(ctx context.Context, a *service.App, manager service.Manager) error {
+	timeout := m.healthTimeout
+	if timeout == 0 {
+		timeout = DefaultMigrationHealthTimeout
+	}
+
+	ok, err := waitForHealthy(ctx, manager, a, timeout, m.pollInterval)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errMigrationUnhealthy
+	}
+
+	return nil
+}
+
+// waitForHealthy polls the manager every interval, 5 seconds by default, until
+// the app is healthy. false is returned if it isn't healthy within the
+// timeout.
+func waitForHealthy(ctx context.Context, manager service.Manager, a *service.App, timeout, interval time.Duration) (bool, error) {
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+
+	deadline := time.After(timeout)
+
+	for {
+		instances, err := manager.Instances(ctx, a.ID)
+		if err != nil {
+			return false, err
+		}
+
+		if healthy(a, instances) {
+			return true, nil
+		}
+
+		select {
+		case <-deadline:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// healthy returns true if every process of the app has at least its desired
+// number of running instances. Instances of other releases, e.g. left over
+// from an earlier migration, don't count.
+func healthy(a *service.App, instances []*service.Instance) bool {
+	releases := make(map[string]string)
+	for _, p := range a.Processes {
+		releases[p.Type] = p.Env["EMPIRE_RELEASE"]
+	}
+
+	running := make(map[string]uint)
+	for _, i := range instances {
+		if strings.EqualFold(i.State, "running") && i.Process.Env["EMPIRE_RELEASE"] == releases[i.Process.Type] {
+			running[i.Process.Type]++
+		}
+	}
+
+	for _, p := range a.Processes {
+		if running[p.Type] < p.Instances {
+			return false
+		}
+	}
+
+	return true
+}
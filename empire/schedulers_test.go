@@ -0,0 +1,144 @@
+package empire
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+func TestSchedulerMigrator_Migrate(t *testing.T) {
+	release := &Release{
+		App:    &App{ID: "1234", Name: "acme-inc"},
+		Config: &Config{},
+		Slug:   &Slug{Image: Image{Repo: "remind101/acme-inc", ID: "latest"}},
+		Processes: []*Process{
+			{Type: "worker", Quantity: 1},
+		},
+	}
+
+	tests := []struct {
+		submitErr error
+		healthy   bool
+		err       error
+		calls     []string
+	}{
+		{nil, true, nil, []string{"to.Submit", "to.Instances", "from.Remove"}},
+		{nil, false, errMigrationUnhealthy, []string{"to.Submit", "to.Instances", "to.Remove"}},
+		{errors.New("boom"), true, errors.New("boom"), []string{"to.Submit", "to.Remove"}},
+	}
+
+	for i, tt := range tests {
+		var calls []string
+
+		from := &recordingManager{name: "from", calls: &calls}
+		to := &recordingManager{name: "to", calls: &calls, submitErr: tt.submitErr, healthy: tt.healthy}
+
+		m := &schedulerMigrator{
+			releases:      &releasesService{},
+			healthTimeout: 15 * time.Millisecond,
+			pollInterval:  10 * time.Millisecond,
+		}
+
+		err := m.migrate(context.Background(), release, from, to)
+		if got, want := err, tt.err; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d: err => %v; want %v", i, got, want)
+		}
+
+		// The number of health checks depends on timing, so repeated
+		// calls are only compared once.
+		if got, want := uniqCalls(calls), tt.calls; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d: calls => %v; want %v", i, got, want)
+		}
+
+		// Load balancers are shared by both schedulers, so removing
+		// the app from either one keeps them.
+		for _, m := range []*recordingManager{from, to} {
+			if m.removedLBs {
+				t.Fatalf("#%d: Expected %s.Remove to keep load balancers", i, m.name)
+			}
+		}
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	web := &service.Process{Type: "web", Instances: 2, Env: map[string]string{"EMPIRE_RELEASE": "v2"}}
+	worker := &service.Process{Type: "worker", Instances: 1, Env: map[string]string{"EMPIRE_RELEASE": "v2"}}
+	a := &service.App{Processes: []*service.Process{web, worker}}
+
+	// An instance of the previous release.
+	stale := &service.Process{Type: "web", Instances: 2, Env: map[string]string{"EMPIRE_RELEASE": "v1"}}
+
+	tests := []struct {
+		instances []*service.Instance
+		healthy   bool
+	}{
+		{nil, false},
+		{[]*service.Instance{{Process: web, State: "RUNNING"}, {Process: web, State: "RUNNING"}, {Process: worker, State: "RUNNING"}}, true},
+		{[]*service.Instance{{Process: web, State: "RUNNING"}, {Process: web, State: "PENDING"}, {Process: worker, State: "RUNNING"}}, false},
+		{[]*service.Instance{{Process: web, State: "running"}, {Process: web, State: "running"}}, false},
+		{[]*service.Instance{{Process: web, State: "RUNNING"}, {Process: stale, State: "RUNNING"}, {Process: worker, State: "RUNNING"}}, false},
+	}
+
+	for i, tt := range tests {
+		if got, want := healthy(a, tt.instances), tt.healthy; got != want {
+			t.Fatalf("#%d: healthy => %v; want %v", i, got, want)
+		}
+	}
+}
+
+// uniqCalls removes consecutive repeated calls.
+func uniqCalls(calls []string) []string {
+	var uniq []string
+	for _, c := range calls {
+		if len(uniq) == 0 || uniq[len(uniq)-1] != c {
+			uniq = append(uniq, c)
+		}
+	}
+	return uniq
+}
+
+// recordingManager is a service.Manager that records the calls made to it.
+type recordingManager struct {
+	service.Manager
+
+	name      string
+	calls     *[]string
+	submitErr error
+	healthy   bool
+	app       *service.App
+
+	// Set if Remove was called without service.KeepLoadBalancers.
+	removedLBs bool
+}
+
+func (m *recordingManager) Submit(ctx context.Context, app *service.App) error {
+	*m.calls = append(*m.calls, m.name+".Submit")
+	m.app = app
+	return m.submitErr
+}
+
+func (m *recordingManager) Instances(ctx context.Context, appID string) ([]*service.Instance, error) {
+	*m.calls = append(*m.calls, m.name+".Instances")
+
+	var instances []*service.Instance
+	if m.healthy {
+		for _, p := range m.app.Processes {
+			for i := uint(0); i < p.Instances; i++ {
+				instances = append(instances, &service.Instance{Process: p, State: "RUNNING"})
+			}
+		}
+	}
+	return instances, nil
+}
+
+func (m *recordingManager) Remove(ctx context.Context, appID string) error {
+	*m.calls = append(*m.calls, m.name+".Remove")
+	if !service.LoadBalancersKept(ctx) {
+		m.removedLBs = true
+	}
+	return nil
+}
@@ -35,6 +35,10 @@ type GetApps struct {
 }
 
 func (h *GetApps) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeAppsRead); err != nil {
+		return err
+	}
+
 	apps, err := h.Apps(empire.AppsQuery{})
 	if err != nil {
 		return err
@@ -71,6 +75,10 @@ type PostApps struct {
 }
 
 func (h *PostApps) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeAppsWrite); err != nil {
+		return err
+	}
+
 	var form PostAppsForm
 
 	if err := Decode(r, &form); err != nil {
@@ -10,6 +10,11 @@ import (
 	"golang.org/x/net/context"
 )
 
+// HeaderAccessToken is the response header that a replacement for the access
+// token used to authenticate the request is returned in, when the token was
+// re-signed with a new secret. Clients should replace their token with it.
+const HeaderAccessToken = "Empire-Access-Token"
+
 // Middleware for handling authentication.
 type Authentication struct {
 	// findAccessToken is a function that, given a string token, will return
@@ -31,8 +36,14 @@ func Authenticate(e *empire.Empire, h httpx.Handler) httpx.Handler {
 }
 
 // ServeHTTPContext implements the httpx.Handler interface. It will ensure that
-// there is a Bearer token present and that it is valid.
+// there is a Bearer token present and that it is valid, unless an AccessToken
+// was already added to the context by earlier middleware.
 func (h *Authentication) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	// The request was already authenticated, e.g. with a JWT.
+	if _, ok := empire.AccessTokenFromContext(ctx); ok {
+		return h.handler.ServeHTTPContext(ctx, w, r)
+	}
+
 	token, ok := extractToken(r)
 	if !ok {
 		return ErrUnauthorized
@@ -40,6 +51,9 @@ func (h *Authentication) ServeHTTPContext(ctx context.Context, w http.ResponseWr
 
 	at, err := h.findAccessToken(token)
 	if err != nil {
+		if err == empire.ErrTokenInvalid {
+			return ErrUnauthorized
+		}
 		return err
 	}
 
@@ -48,11 +62,20 @@ func (h *Authentication) ServeHTTPContext(ctx context.Context, w http.ResponseWr
 		return ErrUnauthorized
 	}
 
+	// The token was signed with a secret that's being rotated out, and
+	// was re-signed with the current one.
+	if at.Token != "" && at.Token != token {
+		w.Header().Set(HeaderAccessToken, at.Token)
+	}
+
 	user := at.User
 
 	// Embed the associated user into the context.
 	ctx = empire.WithUser(ctx, user)
 
+	// Embed the token into the context, so that its scopes can be checked.
+	ctx = empire.WithAccessToken(ctx, at)
+
 	logger.Info(ctx,
 		"authenticated",
 		"user", user.Name,
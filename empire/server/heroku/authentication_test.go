@@ -38,3 +38,100 @@ func TestAuthentication(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAuthentication_InvalidToken(t *testing.T) {
+	m := &Authentication{
+		findAccessToken: func(token string) (*empire.AccessToken, error) {
+			return nil, empire.ErrTokenInvalid
+		},
+		handler: httpx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			t.Fatal("Expected the handler to not be called")
+			return nil
+		}),
+	}
+
+	ctx := context.Background()
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/apps", nil)
+	req.SetBasicAuth("", "token")
+
+	if err := m.ServeHTTPContext(ctx, resp, req); err != ErrUnauthorized {
+		t.Fatalf("err => %v; want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestAuthentication_AlreadyAuthenticated(t *testing.T) {
+	var called bool
+	m := &Authentication{
+		findAccessToken: func(token string) (*empire.AccessToken, error) {
+			t.Fatal("Expected the token to not be looked up")
+			return nil, nil
+		},
+		handler: httpx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			called = true
+			return nil
+		}),
+	}
+
+	ctx := empire.WithAccessToken(context.Background(), &empire.AccessToken{
+		User: &empire.User{Name: "ehjolmes"},
+	})
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/apps", nil)
+
+	if err := m.ServeHTTPContext(ctx, resp, req); err != nil {
+		t.Fatal(err)
+	}
+
+	if !called {
+		t.Fatal("Expected the handler to be called")
+	}
+}
+
+func TestAuthentication_Resigned(t *testing.T) {
+	m := &Authentication{
+		findAccessToken: func(token string) (*empire.AccessToken, error) {
+			return &empire.AccessToken{
+				Token: "resigned",
+				User: &empire.User{
+					Name: "ehjolmes",
+				},
+			}, nil
+		},
+		handler: httpx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			return nil
+		}),
+	}
+
+	ctx := context.Background()
+	resp := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/apps", nil)
+	req.SetBasicAuth("", "token")
+
+	if err := m.ServeHTTPContext(ctx, resp, req); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := resp.Header().Get(HeaderAccessToken), "resigned"; got != want {
+		t.Fatalf("%s => %q; want %q", HeaderAccessToken, got, want)
+	}
+
+	// Tokens that weren't re-signed aren't returned.
+	m.findAccessToken = func(token string) (*empire.AccessToken, error) {
+		return &empire.AccessToken{
+			Token: token,
+			User: &empire.User{
+				Name: "ehjolmes",
+			},
+		}, nil
+	}
+
+	resp = httptest.NewRecorder()
+	if err := m.ServeHTTPContext(ctx, resp, req); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := resp.Header().Get(HeaderAccessToken); got != "" {
+		t.Fatalf("%s => %q; want an empty header", HeaderAccessToken, got)
+	}
+}
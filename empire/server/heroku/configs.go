@@ -12,6 +12,10 @@ type GetConfigs struct {
 }
 
 func (h *GetConfigs) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeConfigsRead); err != nil {
+		return err
+	}
+
 	a, err := findApp(ctx, h)
 	if err != nil {
 		return err
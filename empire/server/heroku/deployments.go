@@ -17,6 +17,10 @@ type PostDeploys struct {
 // PostDeployForm is the form object that represents the POST body.
 type PostDeployForm struct {
 	Image empire.Image
+
+	// Optional commit sha and branch that the image was built from.
+	CommitSHA string `json:"commit_sha"`
+	Branch    string `json:"branch"`
 }
 
 // Serve implements the Handler interface.
@@ -37,7 +41,10 @@ func (h *PostDeploys) ServeHTTPContext(ctx context.Context, w http.ResponseWrite
 	ch := make(chan empire.Event)
 	errCh := make(chan error)
 	go func() {
-		r, err = h.DeployImage(ctx, form.Image, ch)
+		r, err = h.DeployImageWithMetadata(ctx, form.Image, empire.ReleaseMetadata{
+			CommitSHA: form.CommitSHA,
+			Branch:    form.Branch,
+		}, ch)
 		errCh <- err
 	}()
 
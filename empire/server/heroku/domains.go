@@ -26,6 +26,10 @@ type GetDomains struct {
 }
 
 func (h *GetDomains) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeAppsRead); err != nil {
+		return err
+	}
+
 	a, err := findApp(ctx, h)
 	if err != nil {
 		return err
@@ -49,6 +53,10 @@ type PostDomains struct {
 }
 
 func (h *PostDomains) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeAppsWrite); err != nil {
+		return err
+	}
+
 	a, err := findApp(ctx, h)
 	if err != nil {
 		return err
@@ -83,6 +91,10 @@ type DeleteDomain struct {
 }
 
 func (h *DeleteDomain) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeAppsWrite); err != nil {
+		return err
+	}
+
 	a, err := findApp(ctx, h)
 	if err != nil {
 		return err
@@ -50,6 +50,10 @@ func newError(err error) *ErrorResource {
 		return ErrNotFound
 	}
 
+	if err == empire.ErrInsufficientScope {
+		return ErrForbidden
+	}
+
 	switch err := err.(type) {
 	case *ErrorResource:
 		return err
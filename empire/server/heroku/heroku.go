@@ -33,9 +33,10 @@ func New(e *empire.Empire, auth authorization.Authorizer) httpx.Handler {
 	r.Handle("/deploys", Authenticate(e, &PostDeploys{e})).Methods("POST") // Deploy an app
 
 	// Releases
-	r.Handle("/apps/{app}/releases", Authenticate(e, &GetReleases{e})).Methods("GET")          // hk releases
-	r.Handle("/apps/{app}/releases/{version}", Authenticate(e, &GetRelease{e})).Methods("GET") // hk release-info
-	r.Handle("/apps/{app}/releases", Authenticate(e, &PostReleases{e})).Methods("POST")        // hk rollback
+	r.Handle("/apps/{app}/releases", Authenticate(e, &GetReleases{e})).Methods("GET")              // hk releases
+	r.Handle("/apps/{app}/releases/stream", Authenticate(e, &GetReleasesStream{e})).Methods("GET") // Stream release events
+	r.Handle("/apps/{app}/releases/{version}", Authenticate(e, &GetRelease{e})).Methods("GET")     // hk release-info
+	r.Handle("/apps/{app}/releases", Authenticate(e, &PostReleases{e})).Methods("POST")            // hk rollback
 
 	// Configs
 	r.Handle("/apps/{app}/config-vars", Authenticate(e, &GetConfigs{e})).Methods("GET")     // hk env, hk get
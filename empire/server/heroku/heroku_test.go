@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/remind101/empire/empire"
 )
@@ -60,3 +61,23 @@ func TestError(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteReleaseEvent(t *testing.T) {
+	w := httptest.NewRecorder()
+	createdAt := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := writeReleaseEvent(w, empire.ReleaseEvent{
+		Type:    empire.ReleaseEventFailed,
+		Release: &empire.Release{ID: "1", Version: 2, SlugID: "3", Description: "Deploy", CreatedAt: &createdAt},
+		Message: "boom",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: failed\n" +
+		`data: {"release":{"created_at":"2015-01-01T00:00:00Z","description":"Deploy","id":"1","updated_at":"0001-01-01T00:00:00Z","slug":{"id":"3"},"user":{"id":"","email":""},"version":2},"message":"boom"}` + "\n\n"
+
+	if got := w.Body.String(); got != want {
+		t.Fatalf("Body => %q; want %q", got, want)
+	}
+}
@@ -62,7 +62,8 @@ func (h *PostAuthorizations) ServeHTTPContext(ctx context.Context, w http.Respon
 	}
 
 	at, err := h.Empire.AccessTokensCreate(&empire.AccessToken{
-		User: u,
+		User:   u,
+		Scopes: empire.AllScopes,
 	})
 	if err != nil {
 		return err
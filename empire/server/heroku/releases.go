@@ -1,6 +1,8 @@
 package heroku
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -41,6 +43,10 @@ type GetRelease struct {
 }
 
 func (h *GetRelease) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeAppsRead); err != nil {
+		return err
+	}
+
 	a, err := findApp(ctx, h)
 	if err != nil {
 		return err
@@ -66,6 +72,10 @@ type GetReleases struct {
 }
 
 func (h *GetReleases) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.AccessTokensRequireScope(ctx, empire.ScopeAppsRead); err != nil {
+		return err
+	}
+
 	a, err := findApp(ctx, h)
 	if err != nil {
 		return err
@@ -80,6 +90,79 @@ func (h *GetReleases) ServeHTTPContext(ctx context.Context, w http.ResponseWrite
 	return Encode(w, newReleases(rels))
 }
 
+// GetReleasesStream streams events for an apps releases as Server-Sent
+// Events, until the client disconnects.
+type GetReleasesStream struct {
+	*empire.Empire
+}
+
+func (h *GetReleasesStream) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	a, err := findApp(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	if cn, ok := w.(http.CloseNotifier); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		closed := cn.CloseNotify()
+		go func() {
+			select {
+			case <-closed:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	events, err := h.ReleasesStream(ctx, a)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+
+	for event := range events {
+		if err := writeReleaseEvent(w, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseEvent is the data of a Server-Sent Event for an empire.ReleaseEvent.
+type releaseEvent struct {
+	Release *Release `json:"release"`
+	Message string   `json:"message,omitempty"`
+}
+
+// writeReleaseEvent writes the event in the text/event-stream format and
+// flushes it to the client.
+func writeReleaseEvent(w http.ResponseWriter, event empire.ReleaseEvent) error {
+	data, err := json.Marshal(releaseEvent{
+		Release: newRelease(event.Release),
+		Message: event.Message,
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
 type PostReleases struct {
 	*empire.Empire
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/remind101/empire/empire"
+	jwtauth "github.com/remind101/empire/empire/middleware"
 	"github.com/remind101/empire/empire/server/authorization"
 	githubauth "github.com/remind101/empire/empire/server/authorization/github"
 	"github.com/remind101/empire/empire/server/heroku"
@@ -29,6 +30,10 @@ type Options struct {
 		ClientSecret string
 		Organization string
 	}
+
+	// If set, requests can authenticate with a Bearer JWT signed with this
+	// secret, instead of an Empire access token.
+	JWTSecret string
 }
 
 func New(e *empire.Empire, options Options) http.Handler {
@@ -47,7 +52,13 @@ func New(e *empire.Empire, options Options) http.Handler {
 	// Mount health endpoint
 	r.Handle("/health", NewHealthHandler(e))
 
-	return middleware.Common(r, middleware.CommonOpts{
+	// Authenticate users with a JWT, if enabled.
+	var root httpx.Handler = r
+	if options.JWTSecret != "" {
+		root = jwtauth.JWTUserMiddleware([]byte(options.JWTSecret))(root)
+	}
+
+	return middleware.Common(root, middleware.CommonOpts{
 		Reporter: e.Reporter,
 		Logger:   e.Logger,
 	})
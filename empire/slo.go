@@ -0,0 +1,317 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// SLOWindow is the window that releases are counted within when evaluating a
+// DeployFrequencyTarget.
+const SLOWindow = 7 * 24 * time.Hour
+
+// DefaultSLOInterval is how often the SLOController evaluates targets by
+// default.
+var DefaultSLOInterval = SLOWindow
+
+// DefaultSLOPollInterval is how often the SLOController checks for targets that
+// are due to be evaluated by default.
+var DefaultSLOPollInterval = time.Hour
+
+// ErrInvalidDeployFrequencyTarget is returned when the number of releases per
+// week of a DeployFrequencyTarget is not positive.
+var ErrInvalidDeployFrequencyTarget = &ValidationError{
+	errors.New("Releases per week must be greater than 0."),
+}
+
+// DeployFrequencyTarget is the minimum number of releases that an app is
+// expected to have every week.
+type DeployFrequencyTarget struct {
+	ID string
+
+	AppID string
+	App   *App
+
+	// The minimum number of releases per week.
+	ReleasesPerWeek int
+
+	// An optional channel to send alerts to when the target isn't met,
+	// e.g. a Slack channel.
+	AlertChannel string
+
+	// When the SLOController last evaluated the target, or nil if it
+	// hasn't been evaluated yet.
+	LastEvaluatedAt *time.Time
+}
+
+// SLOReport is the result of evaluating a DeployFrequencyTarget.
+type SLOReport struct {
+	Target *DeployFrequencyTarget
+
+	// The number of active releases within the last SLOWindow.
+	ActualReleasesThisWeek int
+
+	// True when ActualReleasesThisWeek is at least the targets
+	// ReleasesPerWeek.
+	TargetMet bool
+
+	// When the target will next be evaluated by the SLOController.
+	NextEvaluationAt time.Time
+}
+
+// newSLOReport returns the SLOReport for the target, given the number of
+// releases within the window ending at now.
+func newSLOReport(target *DeployFrequencyTarget, releases int, now time.Time, interval time.Duration) *SLOReport {
+	return &SLOReport{
+		Target:                 target,
+		ActualReleasesThisWeek: releases,
+		TargetMet:              releases >= target.ReleasesPerWeek,
+		NextEvaluationAt:       sloNextEvaluation(target, now, interval),
+	}
+}
+
+// sloNextEvaluation returns when the SLOController will next evaluate the
+// target, one interval after it was last evaluated. Targets that are already
+// due are evaluated the next time the controller checks, so now is returned.
+func sloNextEvaluation(target *DeployFrequencyTarget, now time.Time, interval time.Duration) time.Time {
+	if target.LastEvaluatedAt == nil {
+		return now
+	}
+
+	next := target.LastEvaluatedAt.Add(interval)
+	if next.Before(now) {
+		return now
+	}
+	return next
+}
+
+// DeployFrequencyTargetsQuery is a Scope implementation for common things to
+// filter deploy frequency targets by.
+type DeployFrequencyTargetsQuery struct {
+	// If provided, finds the target for the given app.
+	App *App
+}
+
+// Scope implements the Scope interface.
+func (q DeployFrequencyTargetsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.App != nil {
+		scope = append(scope, ForApp(q.App))
+	}
+
+	scope = append(scope, Preload("App"))
+
+	return scope.Scope(db)
+}
+
+// DeployFrequencyTargetsFirst returns the first target matching the scope.
+func (s *store) DeployFrequencyTargetsFirst(scope Scope) (*DeployFrequencyTarget, error) {
+	var target DeployFrequencyTarget
+	return &target, s.First(scope, &target)
+}
+
+// DeployFrequencyTargets returns all targets matching the scope.
+func (s *store) DeployFrequencyTargets(scope Scope) ([]*DeployFrequencyTarget, error) {
+	var targets []*DeployFrequencyTarget
+	return targets, s.Find(scope, &targets)
+}
+
+// DeployFrequencyTargetsSet creates or replaces the target for the app.
+func (s *store) DeployFrequencyTargetsSet(target *DeployFrequencyTarget) (*DeployFrequencyTarget, error) {
+	if err := s.writable(); err != nil {
+		return target, err
+	}
+
+	t := s.db.Begin()
+
+	if err := t.Where("app_id = ?", target.AppID).Delete(DeployFrequencyTarget{}).Error; err != nil {
+		t.Rollback()
+		return target, err
+	}
+
+	if err := t.Create(target).Error; err != nil {
+		t.Rollback()
+		return target, err
+	}
+
+	return target, t.Commit().Error
+}
+
+// DeployFrequencyTargetsEvaluated records when the SLOController evaluated the
+// target.
+func (s *store) DeployFrequencyTargetsEvaluated(target *DeployFrequencyTarget, at time.Time) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	if err := s.db.Exec(`update deploy_frequency_targets set last_evaluated_at = ? where id = ?`, at, target.ID).Error; err != nil {
+		return err
+	}
+
+	target.LastEvaluatedAt = &at
+
+	return nil
+}
+
+// ReleasesCountSince returns the number of active releases of the app created
+// at or after since. Drafts and canaries aren't counted.
+func (s *store) ReleasesCountSince(app *App, since time.Time) (int, error) {
+	var count int
+	return count, s.reader().Model(&Release{}).Where("app_id = ? and status = ? and created_at >= ?", app.ID, ReleaseStatusActive, since).Count(&count).Error
+}
+
+// sloService manages and evaluates deploy frequency targets.
+type sloService struct {
+	store *store
+
+	// How often targets are evaluated, used for
+	// SLOReport.NextEvaluationAt.
+	interval time.Duration
+}
+
+// SetTarget sets the deploy frequency target for the app.
+func (s *sloService) SetTarget(app *App, target DeployFrequencyTarget) (*DeployFrequencyTarget, error) {
+	if target.ReleasesPerWeek <= 0 {
+		return nil, ErrInvalidDeployFrequencyTarget
+	}
+
+	target.AppID = app.ID
+
+	return s.store.DeployFrequencyTargetsSet(&target)
+}
+
+// GetTarget returns the deploy frequency target for the app.
+func (s *sloService) GetTarget(app *App) (*DeployFrequencyTarget, error) {
+	return s.store.DeployFrequencyTargetsFirst(DeployFrequencyTargetsQuery{App: app})
+}
+
+// EvaluateSLO compares the number of releases of the app within the last
+// SLOWindow against its target.
+func (s *sloService) EvaluateSLO(app *App) (*SLOReport, error) {
+	target, err := s.GetTarget(app)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.evaluate(target)
+}
+
+func (s *sloService) evaluate(target *DeployFrequencyTarget) (*SLOReport, error) {
+	now := timex.Now()
+
+	releases, err := s.store.ReleasesCountSince(target.App, now.Add(-SLOWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	return newSLOReport(target, releases, now, s.interval), nil
+}
+
+// SLOController periodically evaluates every DeployFrequencyTarget, and sends
+// a notification for each app that isn't meeting its target. When each target
+// was last evaluated is stored, so that restarting Empire doesn't delay or
+// repeat evaluations.
+type SLOController struct {
+	// How often to evaluate targets. Defaults to DefaultSLOInterval.
+	Interval time.Duration
+
+	// How often to check for targets that are due to be evaluated.
+	// Defaults to DefaultSLOPollInterval.
+	PollInterval time.Duration
+
+	store    *store
+	slos     *sloService
+	notifier *notifier
+}
+
+// Run checks for targets that are due to be evaluated when it starts, then
+// every PollInterval until the context is cancelled.
+func (c *SLOController) Run(ctx context.Context) {
+	poll := c.PollInterval
+	if poll == 0 {
+		poll = DefaultSLOPollInterval
+	}
+
+	t := time.NewTicker(poll)
+	defer t.Stop()
+
+	for {
+		if err := c.Check(ctx); err != nil {
+			reporter.Report(ctx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Check evaluates every target that hasn't been evaluated within the last
+// Interval, notifying about the ones that aren't met.
+func (c *SLOController) Check(ctx context.Context) error {
+	targets, err := c.store.DeployFrequencyTargets(DeployFrequencyTargetsQuery{})
+	if err != nil {
+		return err
+	}
+
+	now := timex.Now()
+	for _, target := range targets {
+		if !sloDue(target, now, c.interval()) {
+			continue
+		}
+
+		report, err := c.slos.evaluate(target)
+		if err != nil {
+			return err
+		}
+
+		c.alert(ctx, report)
+
+		if err := c.store.DeployFrequencyTargetsEvaluated(target, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *SLOController) interval() time.Duration {
+	if c.Interval == 0 {
+		return DefaultSLOInterval
+	}
+	return c.Interval
+}
+
+// sloDue returns true if the target hasn't been evaluated within the last
+// interval.
+func sloDue(target *DeployFrequencyTarget, now time.Time, interval time.Duration) bool {
+	if target.LastEvaluatedAt == nil {
+		return true
+	}
+
+	return !now.Before(target.LastEvaluatedAt.Add(interval))
+}
+
+// alert sends a notification if the target in the report wasn't met.
+func (c *SLOController) alert(ctx context.Context, report *SLOReport) {
+	if report.TargetMet {
+		return
+	}
+
+	app := report.Target.App.Name
+	c.notifier.Notify(ctx, Notification{
+		Severity: SeverityWarning,
+		App:      app,
+		Event:    NotificationSLO,
+		Message:  fmt.Sprintf("%s had %d releases this week, below the target of %d", app, report.ActualReleasesThisWeek, report.Target.ReleasesPerWeek),
+		Channel:  report.Target.AlertChannel,
+	})
+}
@@ -0,0 +1,135 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestNewSLOReport(t *testing.T) {
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	target := &DeployFrequencyTarget{ReleasesPerWeek: 3}
+
+	tests := []struct {
+		releases  int
+		targetMet bool
+	}{
+		{0, false},
+		{2, false},
+		{3, true},
+		{10, true},
+	}
+
+	for i, tt := range tests {
+		r := newSLOReport(target, tt.releases, now, SLOWindow)
+
+		if got, want := r.TargetMet, tt.targetMet; got != want {
+			t.Fatalf("#%d: TargetMet => %v; want %v", i, got, want)
+		}
+
+		if got, want := r.ActualReleasesThisWeek, tt.releases; got != want {
+			t.Fatalf("#%d: ActualReleasesThisWeek => %d; want %d", i, got, want)
+		}
+
+	}
+}
+
+func TestSLONextEvaluation(t *testing.T) {
+	now := time.Date(2015, 1, 8, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	tests := []struct {
+		lastEvaluatedAt *time.Time
+		next            time.Time
+	}{
+		// Never evaluated, so it's evaluated the next time the
+		// controller checks.
+		{nil, now},
+		{at(time.Hour), now.Add(SLOWindow - time.Hour)},
+		{at(SLOWindow), now},
+		{at(2 * SLOWindow), now},
+	}
+
+	for i, tt := range tests {
+		target := &DeployFrequencyTarget{LastEvaluatedAt: tt.lastEvaluatedAt}
+		if got, want := newSLOReport(target, 0, now, SLOWindow).NextEvaluationAt, tt.next; !got.Equal(want) {
+			t.Fatalf("#%d: NextEvaluationAt => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestSLODue(t *testing.T) {
+	now := time.Date(2015, 1, 8, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	tests := []struct {
+		lastEvaluatedAt *time.Time
+		due             bool
+	}{
+		// Never evaluated, e.g. a new target.
+		{nil, true},
+		{at(time.Hour), false},
+		{at(SLOWindow - time.Second), false},
+		{at(SLOWindow), true},
+		{at(2 * SLOWindow), true},
+	}
+
+	for i, tt := range tests {
+		target := &DeployFrequencyTarget{LastEvaluatedAt: tt.lastEvaluatedAt}
+		if got, want := sloDue(target, now, SLOWindow), tt.due; got != want {
+			t.Fatalf("#%d: sloDue => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestSLOService_SetTarget_Invalid(t *testing.T) {
+	s := &sloService{}
+
+	if _, err := s.SetTarget(&App{}, DeployFrequencyTarget{}); err != ErrInvalidDeployFrequencyTarget {
+		t.Fatalf("err => %v; want %v", err, ErrInvalidDeployFrequencyTarget)
+	}
+}
+
+func TestSLOController_Alert(t *testing.T) {
+	c := &recordingNotificationChannel{}
+	n := newNotifier(c)
+	controller := &SLOController{notifier: n}
+
+	target := &DeployFrequencyTarget{
+		App:             &App{Name: "acme-inc"},
+		ReleasesPerWeek: 2,
+		AlertChannel:    "#deploys",
+	}
+
+	controller.alert(context.Background(), &SLOReport{Target: target, ActualReleasesThisWeek: 2, TargetMet: true})
+	n.Wait()
+
+	if len(c.notifications) != 0 {
+		t.Fatalf("Expected no notifications, got %v", c.notifications)
+	}
+
+	controller.alert(context.Background(), &SLOReport{Target: target, ActualReleasesThisWeek: 1})
+	n.Wait()
+
+	expected := []Notification{
+		{
+			Severity: SeverityWarning,
+			App:      "acme-inc",
+			Event:    NotificationSLO,
+			Message:  "acme-inc had 1 releases this week, below the target of 2",
+			Channel:  "#deploys",
+		},
+	}
+
+	if got, want := c.notifications, expected; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Notifications => %v; want %v", got, want)
+	}
+}
@@ -1,19 +1,112 @@
 package empire
 
-import "github.com/jinzhu/gorm"
+import (
+	"io"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
 
 // Slug represents a container image with the extracted ProcessType.
 type Slug struct {
 	ID           string
 	Image        Image
 	ProcessTypes CommandMap
+
+	// The id of the image that Image resolved to when the slug was
+	// created. Tags like latest can be moved to another image, so slugs
+	// are only reused for an image that resolves to the same id.
+	ResolvedImageID string
+}
+
+// SlugsQuery is a Scope implementation for common things to filter slugs by.
+type SlugsQuery struct {
+	// If provided, finds the slug with the given id.
+	ID *string
+
+	// If provided, finds slugs for the given image.
+	Image *Image
+
+	// If provided, finds slugs whose image resolved to the given id.
+	ResolvedImageID *string
+}
+
+// Scope implements the Scope interface.
+func (q SlugsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.ID != nil {
+		scope = append(scope, ID(*q.ID))
+	}
+
+	if q.Image != nil {
+		scope = append(scope, FieldEquals("image", q.Image.String()))
+	}
+
+	if q.ResolvedImageID != nil {
+		scope = append(scope, FieldEquals("resolved_image_id", *q.ResolvedImageID))
+	}
+
+	return scope.Scope(db)
+}
+
+// SlugsFirst returns the first matching slug.
+func (s *store) SlugsFirst(scope Scope) (*Slug, error) {
+	var slug Slug
+	return &slug, s.First(scope, &slug)
+}
+
+// SlugsUnreferenced returns the slugs that aren't used by any release.
+func (s *store) SlugsUnreferenced() ([]*Slug, error) {
+	var slugs []*Slug
+	return slugs, s.reader().Raw(`select * from slugs where not exists (
+  select 1 from releases where releases.slug_id = slugs.id
+)`).Scan(&slugs).Error
+}
+
+// SlugsDestroyUnreferenced destroys the slug, unless a release has started
+// using it. It returns whether the slug was destroyed.
+func (s *store) SlugsDestroyUnreferenced(slug *Slug) (bool, error) {
+	if err := s.writable(); err != nil {
+		return false, err
+	}
+
+	db := s.db.Exec(`delete from slugs where id = ? and not exists (
+  select 1 from releases where releases.slug_id = slugs.id
+)`, slug.ID)
+	return db.RowsAffected > 0, db.Error
 }
 
 // SlugsCreate persists the slug.
 func (s *store) SlugsCreate(slug *Slug) (*Slug, error) {
+	if err := s.writable(); err != nil {
+		return slug, err
+	}
+
 	return slugsCreate(s.db, slug)
 }
 
+// SlugsCreateAll persists the slugs in a single transaction.
+func (s *store) SlugsCreateAll(slugs []*Slug) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	for _, slug := range slugs {
+		if _, err := slugsCreate(t, slug); err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	return t.Commit().Error
+}
+
 // SlugsCreate inserts a Slug into the database.
 func slugsCreate(db *gorm.DB, slug *Slug) (*Slug, error) {
 	return slug, db.Create(slug).Error
@@ -24,6 +117,8 @@ type slugsService struct {
 	store     *store
 	extractor Extractor
 	resolver  Resolver
+	builder   Builder
+	archiver  SourceArchiver
 }
 
 // SlugsCreateByImage creates a Slug for the given image.
@@ -31,19 +126,124 @@ func (s *slugsService) SlugsCreateByImage(image Image, out chan Event) (*Slug, e
 	return slugsCreateByImage(s.store, s.extractor, s.resolver, image, out)
 }
 
-// SlugsCreateByImage first attempts to find a matching slug for the image. If
-// it's not found, it will fallback to extracting the process types using the
-// provided extractor, then create a slug.
+// SlugsCreateFromDockerfile builds and pushes an image for the app, then
+// creates a Slug for it.
+func (s *slugsService) SlugsCreateFromDockerfile(ctx context.Context, app *App, buildContext io.Reader, opts docker.BuildImageOptions) (*Slug, error) {
+	image, err := s.builder.Build(app, buildContext, "", BuildImageOptions{BuildImageOptions: opts})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.slugsCreateByBuiltImage(image)
+}
+
+// slugsCreateByBuiltImage creates a Slug for an image that was just built.
+func (s *slugsService) slugsCreateByBuiltImage(image Image) (*Slug, error) {
+	// The image was just built, so there's nobody interested in the
+	// events from pulling it.
+	out := make(chan Event)
+	go func() {
+		for range out {
+		}
+	}()
+	defer close(out)
+
+	return s.SlugsCreateByImage(image, out)
+}
+
+// SlugsGC deletes slugs for images that no longer exist in the registry. Slugs
+// that are used by any release are never deleted, since deleting a slug
+// cascades to its releases. It returns the number of slugs that were deleted.
+func (s *slugsService) SlugsGC(ctx context.Context) (int, error) {
+	slugs, err := s.store.SlugsUnreferenced()
+	if err != nil {
+		return 0, err
+	}
+
+	absent, err := slugsWithoutImages(s.resolver, slugs)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, slug := range absent {
+		destroyed, err := s.store.SlugsDestroyUnreferenced(slug)
+		if err != nil {
+			return n, err
+		}
+
+		if destroyed {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// StartGarbageCollector runs SlugsGC every interval until the context is
+// cancelled. Errors are reported, and don't stop the garbage collector.
+func (s *slugsService) StartGarbageCollector(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if _, err := s.SlugsGC(ctx); err != nil {
+					reporter.Report(ctx, err)
+				}
+			}
+		}
+	}()
+}
+
+// slugsWithoutImages returns the slugs whose images no longer exist.
+func slugsWithoutImages(r Resolver, slugs []*Slug) ([]*Slug, error) {
+	var absent []*Slug
+
+	for _, slug := range slugs {
+		exists, err := r.ImageExists(slug.Image)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			absent = append(absent, slug)
+		}
+	}
+
+	return absent, nil
+}
+
+// SlugsCreateByImage first attempts to find a matching slug for the image that
+// resolved to the same image id. If it's not found, it will fallback to
+// extracting the process types using the provided extractor, then create a
+// slug.
 func slugsCreateByImage(store *store, e Extractor, r Resolver, image Image, out chan Event) (*Slug, error) {
-	_, err := r.Resolve(image, out)
+	resolved, err := r.Resolve(image, out)
 	if err != nil {
 		return nil, err
 	}
 
-	slug, err := slugsExtract(e, image)
+	// If we've already extracted the process types for this image, there's
+	// no need to extract them again.
+	slug, err := store.SlugsFirst(SlugsQuery{Image: &image, ResolvedImageID: &resolved.ID})
+	if err == nil {
+		return slug, nil
+	}
+
+	if err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	slug, err = slugsExtract(e, image)
 	if err != nil {
 		return slug, err
 	}
+	slug.ResolvedImageID = resolved.ID
 
 	return store.SlugsCreate(slug)
 }
@@ -0,0 +1,69 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSlugsQuery(t *testing.T) {
+	id := "1234"
+	image := Image{Repo: "remind101/acme-inc", ID: "latest"}
+
+	tests := scopeTests{
+		{SlugsQuery{}, "", []interface{}{}},
+		{SlugsQuery{ID: &id}, "WHERE (id = $1)", []interface{}{id}},
+		{SlugsQuery{Image: &image}, "WHERE (image = $1)", []interface{}{"remind101/acme-inc:latest"}},
+		{SlugsQuery{Image: &image, ResolvedImageID: &id}, "WHERE (image = $1) AND (resolved_image_id = $2)", []interface{}{"remind101/acme-inc:latest", id}},
+	}
+
+	tests.Run(t)
+}
+
+func TestSlugsExtract(t *testing.T) {
+	image := Image{Repo: "remind101/acme-inc", ID: "latest"}
+
+	slug, err := slugsExtract(&fakeExtractor{}, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := slug.ProcessTypes, (CommandMap{"web": "./bin/web"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessTypes => %v; want %v", got, want)
+	}
+
+	f := NewFormation(nil, slug.ProcessTypes)
+	if got, want := f["web"].Command, Command("./bin/web"); got != want {
+		t.Fatalf("Command => %s; want %s", got, want)
+	}
+}
+
+// existsResolver is a Resolver that reports images as missing if they're in
+// the missing map.
+type existsResolver struct {
+	fakeResolver
+	missing map[string]bool
+}
+
+func (r *existsResolver) ImageExists(image Image) (bool, error) {
+	return !r.missing[image.String()], nil
+}
+
+func TestSlugsWithoutImages(t *testing.T) {
+	deleted := &Slug{ID: "2", Image: Image{Repo: "remind101/acme-inc", ID: "v2"}}
+	existing := &Slug{ID: "3", Image: Image{Repo: "remind101/acme-inc", ID: "v3"}}
+
+	r := &existsResolver{
+		missing: map[string]bool{
+			"remind101/acme-inc:v2": true,
+		},
+	}
+
+	absent, err := slugsWithoutImages(r, []*Slug{deleted, existing})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := absent, []*Slug{deleted}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("slugsWithoutImages => %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,337 @@
+package empire
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/empire/pkg/constraints"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// JobStateSnapshot is a stored copy of the job states for an app, as last
+// returned by the scheduler.
+type JobStateSnapshot struct {
+	ID        string
+	AppID     string
+	States    ProcessStates
+	CreatedAt *time.Time
+
+	// Incremented each time the snapshot is invalidated. A snapshot is
+	// only stored if it wasn't invalidated while the scheduler was being
+	// queried.
+	Generation int
+}
+
+// Set created_at before inserting.
+func (s *JobStateSnapshot) BeforeCreate() error {
+	t := timex.Now()
+	s.CreatedAt = &t
+	return nil
+}
+
+// ProcessStates is a slice of ProcessState that is stored as json.
+type ProcessStates []*ProcessState
+
+// processStateJSON is how a ProcessState is stored. Constraints are stored
+// as separate fields, since Constraints can't be unmarshalled from the json
+// that it marshals to.
+type processStateJSON struct {
+	Name      string
+	Command   string
+	State     string
+	UpdatedAt time.Time
+	CPUShare  constraints.CPUShare
+	Memory    constraints.Memory
+}
+
+// Scan implements the sql.Scanner interface.
+func (s *ProcessStates) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ProcessStates", src)
+	}
+
+	var raw []processStateJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	states := make(ProcessStates, 0, len(raw))
+	for _, r := range raw {
+		states = append(states, &ProcessState{
+			Name:      r.Name,
+			Command:   r.Command,
+			State:     r.State,
+			UpdatedAt: r.UpdatedAt,
+			Constraints: Constraints{
+				CPUShare: r.CPUShare,
+				Memory:   r.Memory,
+			},
+		})
+	}
+
+	*s = states
+
+	return nil
+}
+
+// Value implements the driver.Value interface.
+func (s ProcessStates) Value() (driver.Value, error) {
+	raw := make([]processStateJSON, 0, len(s))
+	for _, p := range s {
+		raw = append(raw, processStateJSON{
+			Name:      p.Name,
+			Command:   p.Command,
+			State:     p.State,
+			UpdatedAt: p.UpdatedAt,
+			CPUShare:  p.Constraints.CPUShare,
+			Memory:    p.Constraints.Memory,
+		})
+	}
+
+	b, err := json.Marshal(raw)
+	return driver.Value(b), err
+}
+
+// JobStateSnapshotsFirst returns the snapshot for the app.
+func (s *store) JobStateSnapshotsFirst(app *App) (*JobStateSnapshot, error) {
+	var snapshot JobStateSnapshot
+	return &snapshot, s.First(ForApp(app), &snapshot)
+}
+
+// JobStateSnapshotsCreate replaces the snapshot for the app, unless the
+// snapshot was invalidated since snapshot.Generation was read, in which case
+// the states are stale and nothing is stored.
+func (s *store) JobStateSnapshotsCreate(snapshot *JobStateSnapshot) (*JobStateSnapshot, error) {
+	if err := s.writable(); err != nil {
+		return snapshot, err
+	}
+
+	t := s.db.Begin()
+
+	// Lock the app, so that the snapshot can't be invalidated until it's
+	// stored.
+	if err := t.Exec(`select id from apps where id = ? for update`, snapshot.AppID).Error; err != nil {
+		t.Rollback()
+		return snapshot, err
+	}
+
+	var existing JobStateSnapshot
+	err := t.Where("app_id = ?", snapshot.AppID).First(&existing).Error
+	if err != nil && err != gorm.RecordNotFound {
+		t.Rollback()
+		return snapshot, err
+	}
+
+	if existing.Generation != snapshot.Generation {
+		t.Rollback()
+		return snapshot, nil
+	}
+
+	if err := t.Where("app_id = ?", snapshot.AppID).Delete(JobStateSnapshot{}).Error; err != nil {
+		t.Rollback()
+		return snapshot, err
+	}
+
+	if err := t.Create(snapshot).Error; err != nil {
+		t.Rollback()
+		return snapshot, err
+	}
+
+	return snapshot, t.Commit().Error
+}
+
+// JobStateSnapshotsInvalidate empties the snapshot for the app and increments
+// its generation, so that a snapshot of the scheduler that was started before
+// now isn't stored.
+func (s *store) JobStateSnapshotsInvalidate(app *App) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
+	t := s.db.Begin()
+
+	if err := t.Exec(`select id from apps where id = ? for update`, app.ID).Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	result := t.Exec(`update job_state_snapshots set states = '[]', created_at = null, generation = generation + 1 where app_id = ?`, app.ID)
+	if err := result.Error; err != nil {
+		t.Rollback()
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		if err := t.Exec(`insert into job_state_snapshots (app_id, states, created_at, generation) values (?, '[]', null, 1)`, app.ID).Error; err != nil {
+			t.Rollback()
+			return err
+		}
+	}
+
+	return t.Commit().Error
+}
+
+// JobStatesSnapshot queries the scheduler for the current job states of the
+// app and stores them.
+func (s *processStatesService) JobStatesSnapshot(ctx context.Context, app *App) error {
+	snapshot, err := s.store.JobStateSnapshotsFirst(app)
+	if err != nil && err != gorm.RecordNotFound {
+		return err
+	}
+
+	_, err = s.snapshot(ctx, app, snapshot.Generation)
+	return err
+}
+
+// JobStatesByAppCached returns the stored job states for the app if they were
+// taken less than maxAge ago. Otherwise, the scheduler is queried and the
+// stored job states are updated.
+func (s *processStatesService) JobStatesByAppCached(ctx context.Context, app *App, maxAge time.Duration) ([]*ProcessState, error) {
+	snapshot, err := s.store.JobStateSnapshotsFirst(app)
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	if err == nil && snapshotFresh(snapshot, maxAge, timex.Now()) {
+		return snapshot.States, nil
+	}
+
+	return s.snapshot(ctx, app, snapshot.Generation)
+}
+
+// snapshot queries the scheduler for the job states of the app, and stores
+// them if the snapshot is still at generation.
+func (s *processStatesService) snapshot(ctx context.Context, app *App, generation int) ([]*ProcessState, error) {
+	states, err := s.JobStatesByApp(ctx, app)
+	if err != nil {
+		return states, err
+	}
+
+	_, err = s.store.JobStateSnapshotsCreate(&JobStateSnapshot{
+		AppID:      app.ID,
+		States:     states,
+		Generation: generation,
+	})
+	return states, err
+}
+
+// snapshotFresh returns true if the snapshot was taken less than maxAge
+// before now.
+func snapshotFresh(snapshot *JobStateSnapshot, maxAge time.Duration, now time.Time) bool {
+	if snapshot.CreatedAt == nil {
+		return false
+	}
+
+	return now.Sub(*snapshot.CreatedAt) < maxAge
+}
+
+// Job states that can be passed to ProcessesAllByJobState.
+var jobStates = []string{"running", "stopped", "failed"}
+
+// ErrInvalidJobState is returned by ProcessesAllByJobState when the state isn't
+// one of the known job states.
+var ErrInvalidJobState = &ValidationError{
+	errors.New("State must be one of running, stopped or failed."),
+}
+
+// JobStateSummary is the state of a single process instance of an app.
+type JobStateSummary struct {
+	AppName     string
+	ProcessType string
+	Instance    int
+	State       string
+}
+
+// JobStateSummaries returns the job states of all apps, as of their last
+// snapshot, that are in the given state. Instances are numbered by the order
+// of their names within their process type.
+func (s *store) JobStateSummaries(state string, page Page) ([]*JobStateSummary, error) {
+	query := `select app_name, process_type, instance, state from (
+  select
+    apps.name as app_name,
+    split_part(js->>'Name', '.', 2) as process_type,
+    row_number() over (partition by apps.id, split_part(js->>'Name', '.', 2) order by js->>'Name') as instance,
+    lower(js->>'State') as state
+  from job_state_snapshots
+  join apps on apps.id = job_state_snapshots.app_id, json_array_elements(job_state_snapshots.states) js
+  where apps.destroy_scheduled_at is null
+) jobs
+where state = ?
+order by app_name, process_type, instance`
+	args := []interface{}{state}
+
+	if page.Limit > 0 {
+		query += ` limit ?`
+		args = append(args, page.Limit)
+	}
+
+	if page.Offset > 0 {
+		query += ` offset ?`
+		args = append(args, page.Offset)
+	}
+
+	rows, err := s.reader().Raw(query, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []*JobStateSummary
+	for rows.Next() {
+		var j JobStateSummary
+		if err := rows.Scan(&j.AppName, &j.ProcessType, &j.Instance, &j.State); err != nil {
+			return summaries, err
+		}
+		summaries = append(summaries, &j)
+	}
+
+	return summaries, rows.Err()
+}
+
+// AppsAllByJobState returns the apps, sorted by name, with at least one job in
+// the given state as of their last snapshot.
+func (s *store) AppsAllByJobState(state string) ([]*App, error) {
+	var apps []*App
+	return apps, s.reader().Raw(`select apps.* from apps
+where apps.destroy_scheduled_at is null and exists (
+  select 1 from job_state_snapshots, json_array_elements(job_state_snapshots.states) js
+  where job_state_snapshots.app_id = apps.id and lower(js->>'State') = ?
+)
+order by apps.name`, state).Scan(&apps).Error
+}
+
+// ProcessesAllByJobState returns the instances of all apps that were in the
+// given state when their job states were last snapshotted.
+func (s *processStatesService) ProcessesAllByJobState(state string, page Page) ([]*JobStateSummary, error) {
+	if err := validateJobState(state); err != nil {
+		return nil, err
+	}
+
+	return s.store.JobStateSummaries(state, page)
+}
+
+// AppsAllByJobState returns the apps that had at least one job in the given
+// state when their job states were last snapshotted.
+func (s *processStatesService) AppsAllByJobState(state string) ([]*App, error) {
+	if err := validateJobState(state); err != nil {
+		return nil, err
+	}
+
+	return s.store.AppsAllByJobState(state)
+}
+
+func validateJobState(state string) error {
+	for _, s := range jobStates {
+		if s == state {
+			return nil
+		}
+	}
+
+	return ErrInvalidJobState
+}
@@ -0,0 +1,64 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProcessStates_Value(t *testing.T) {
+	states := ProcessStates{
+		{Name: "v1.web.1", Command: "./bin/web", State: "RUNNING", UpdatedAt: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), Constraints: Constraints2X},
+	}
+
+	v, err := states.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scanned ProcessStates
+	if err := scanned.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := scanned, states; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessStates => %v; want %v", got, want)
+	}
+}
+
+func TestSnapshotFresh(t *testing.T) {
+	now := time.Date(2015, 1, 1, 0, 1, 0, 0, time.UTC)
+	createdAt := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		snapshot *JobStateSnapshot
+		maxAge   time.Duration
+		fresh    bool
+	}{
+		{&JobStateSnapshot{CreatedAt: &createdAt}, 2 * time.Minute, true},
+		{&JobStateSnapshot{CreatedAt: &createdAt}, 30 * time.Second, false},
+		{&JobStateSnapshot{CreatedAt: &createdAt}, time.Minute, false},
+		{&JobStateSnapshot{CreatedAt: &createdAt}, 0, false},
+		{&JobStateSnapshot{}, time.Hour, false},
+	}
+
+	for i, tt := range tests {
+		if got, want := snapshotFresh(tt.snapshot, tt.maxAge, now), tt.fresh; got != want {
+			t.Fatalf("#%d: snapshotFresh => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestValidateJobState(t *testing.T) {
+	for _, state := range []string{"running", "stopped", "failed"} {
+		if err := validateJobState(state); err != nil {
+			t.Errorf("validateJobState(%q) => %v; want nil", state, err)
+		}
+	}
+
+	for _, state := range []string{"", "RUNNING", "pending"} {
+		if err := validateJobState(state); err != ErrInvalidJobState {
+			t.Errorf("validateJobState(%q) => %v; want %v", state, err, ErrInvalidJobState)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package empire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"golang.org/x/net/context"
+)
+
+// DefaultGitCloneTimeout is the default maximum time that cloning a repository
+// for SlugsBuildFromSource can take.
+const DefaultGitCloneTimeout = 5 * time.Minute
+
+var (
+	// ErrInvalidGitURL is returned when building from a git repository
+	// that isn't an https or ssh URL.
+	ErrInvalidGitURL = &ValidationError{
+		errors.New("Git URLs must be https or ssh."),
+	}
+
+	// ErrInvalidGitRef is returned when building from a ref that git could
+	// mistake for an option.
+	ErrInvalidGitRef = &ValidationError{
+		errors.New("Git refs can't start with -."),
+	}
+)
+
+// SourceArchive is a tar archive of a git repository at a commit.
+type SourceArchive struct {
+	io.ReadCloser
+
+	// The commit sha that the ref was resolved to.
+	Commit string
+}
+
+// SourceArchiver archives git repositories, to be used as the context of a
+// docker build.
+type SourceArchiver interface {
+	// Archive returns a tar archive of the repository at ref, which can be
+	// a branch, tag or commit sha.
+	Archive(ctx context.Context, gitURL, ref string) (*SourceArchive, error)
+}
+
+// gitArchiver is a SourceArchiver that clones repositories with the git
+// command.
+type gitArchiver struct {
+	// The maximum time that cloning and archiving a repository can take.
+	// Zero means no timeout.
+	timeout time.Duration
+}
+
+// Archive implements the SourceArchiver interface. The repository is cloned to
+// a temporary directory, which is removed once the archive has been read into
+// memory.
+func (a *gitArchiver) Archive(ctx context.Context, gitURL, ref string) (*SourceArchive, error) {
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+
+	dir, err := ioutil.TempDir("", "empire-source")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := git(ctx, "", "clone", "--quiet", "--", gitURL, dir); err != nil {
+		return nil, err
+	}
+
+	commit, err := resolveGitRef(ctx, dir, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := git(ctx, dir, "archive", "--format=tar", commit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SourceArchive{
+		ReadCloser: ioutil.NopCloser(bytes.NewReader(archive)),
+		Commit:     commit,
+	}, nil
+}
+
+// resolveGitRef returns the commit sha that ref resolves to in the clone at
+// dir. Only the default branch is checked out by a clone, so other branches
+// are resolved from their remote tracking branch.
+func resolveGitRef(ctx context.Context, dir, ref string) (string, error) {
+	for _, r := range []string{ref, "refs/remotes/origin/" + ref} {
+		sha, err := git(ctx, dir, "rev-parse", "--verify", "--quiet", r+"^{commit}")
+		if err == nil {
+			return strings.TrimSpace(string(sha)), nil
+		}
+
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+	}
+
+	return "", fmt.Errorf("git rev-parse: unknown ref %q", ref)
+}
+
+// git runs the git command in dir, returning its output. The command is killed
+// if the context is cancelled before it exits.
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// validateGitSource returns an error if the repository isn't an https or ssh
+// URL, or the ref could be mistaken for an option. Other schemes, like file://
+// or ext::, would let callers read from the host or run commands on it.
+func validateGitSource(gitURL, ref string) error {
+	u, err := url.Parse(gitURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "ssh") || u.Host == "" {
+		return ErrInvalidGitURL
+	}
+
+	if strings.HasPrefix(ref, "-") {
+		return ErrInvalidGitRef
+	}
+
+	return nil
+}
+
+// SlugsBuildFromSource builds and pushes an image for the app from the
+// Dockerfile in the git repository at ref, then creates a Slug for it. The
+// image is tagged with the commit sha that ref resolved to. Build output is
+// streamed to w as the image is built.
+func (s *slugsService) SlugsBuildFromSource(ctx context.Context, app *App, gitURL, ref string, buildArgs map[string]string, w io.Writer) (*Slug, error) {
+	if err := validateGitSource(gitURL, ref); err != nil {
+		return nil, err
+	}
+
+	image, err := s.buildFromSource(ctx, app, gitURL, ref, buildArgs, w)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.slugsCreateByBuiltImage(image)
+}
+
+// buildFromSource archives the repository at ref, then builds and pushes an
+// image for the app from it.
+func (s *slugsService) buildFromSource(ctx context.Context, app *App, gitURL, ref string, buildArgs map[string]string, w io.Writer) (Image, error) {
+	src, err := s.archiver.Archive(ctx, gitURL, ref)
+	if err != nil {
+		return Image{}, err
+	}
+	defer src.Close()
+
+	return s.builder.Build(app, src, src.Commit, BuildImageOptions{
+		BuildImageOptions: docker.BuildImageOptions{
+			OutputStream: w,
+		},
+		BuildArgs: buildArgs,
+	})
+}
@@ -0,0 +1,183 @@
+package empire
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+// fakeArchiver is a SourceArchiver that returns the same archive for every
+// repository.
+type fakeArchiver struct {
+	archive string
+	commit  string
+
+	// The url and ref of each call to Archive.
+	calls []string
+}
+
+func (a *fakeArchiver) Archive(ctx context.Context, gitURL, ref string) (*SourceArchive, error) {
+	a.calls = append(a.calls, gitURL+"#"+ref)
+	return &SourceArchive{
+		ReadCloser: ioutil.NopCloser(strings.NewReader(a.archive)),
+		Commit:     a.commit,
+	}, nil
+}
+
+func TestSlugsService_BuildFromSource(t *testing.T) {
+	var requests []string
+	log := new(bytes.Buffer)
+
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		switch fmt.Sprintf("%s %s", r.Method, buildTagRegexp.ReplaceAllString(r.URL.Path, "")) {
+		case "POST /build":
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, fmt.Sprintf("build body=%s buildargs=%s", body, q.Get("buildargs")))
+			w.Write([]byte(`{"stream":"Step 0 : FROM busybox\n"}`))
+		case "GET /images/quay.io/remind101/acme-inc/json":
+			w.Write([]byte(`{"Id":"abcd"}`))
+		case "DELETE /images/quay.io/remind101/acme-inc":
+			w.Write([]byte(`[]`))
+		case "POST /images/quay.io/remind101/acme-inc/tag":
+			requests = append(requests, fmt.Sprintf("tag tag=%s", q.Get("tag")))
+			w.WriteHeader(http.StatusCreated)
+		case "POST /images/quay.io/remind101/acme-inc/push":
+			// The build output has already been streamed.
+			if !strings.Contains(log.String(), "FROM busybox") {
+				t.Errorf("build output => %q; want it to be written before pushing", log.String())
+			}
+			requests = append(requests, fmt.Sprintf("push tag=%s", q.Get("tag")))
+			w.Write([]byte(`{"status":"Pushed"}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	c, srv := newTestDockerClient(t, api)
+	defer srv.Close()
+
+	a := &fakeArchiver{archive: "archive", commit: "f0e4c2f76c58916ec258f246851bea091d14d4247a2fc3e18694461b1816e13b"}
+	s := &slugsService{
+		builder:  newDockerBuilder(c, "quay.io/remind101", nil, nil),
+		archiver: a,
+	}
+
+	buildArgs := map[string]string{"RAILS_ENV": "production"}
+	image, err := s.buildFromSource(context.Background(), &App{Name: "acme-inc"}, "https://github.com/remind101/acme-inc.git", "master", buildArgs, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := image.String(), "quay.io/remind101/acme-inc:"+a.commit; got != want {
+		t.Fatalf("Image => %s; want %s", got, want)
+	}
+
+	if got, want := a.calls, []string{"https://github.com/remind101/acme-inc.git#master"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Archive => %v; want %v", got, want)
+	}
+
+	want := []string{
+		`build body=archive buildargs={"RAILS_ENV":"production"}`,
+		"tag tag=" + a.commit,
+		"push tag=" + a.commit,
+	}
+	if !reflect.DeepEqual(requests, want) {
+		t.Fatalf("requests => %v; want %v", requests, want)
+	}
+}
+
+func TestSlugsService_BuildFromSource_Invalid(t *testing.T) {
+	a := &fakeArchiver{}
+	s := &slugsService{archiver: a}
+
+	tests := []struct {
+		gitURL string
+		ref    string
+		err    error
+	}{
+		{"file:///etc", "master", ErrInvalidGitURL},
+		{"ext::sh -c touch% /tmp/pwned", "master", ErrInvalidGitURL},
+		{"--upload-pack=touch /tmp/pwned", "master", ErrInvalidGitURL},
+		{"http://github.com/remind101/acme-inc.git", "master", ErrInvalidGitURL},
+		{"https:///remind101/acme-inc.git", "master", ErrInvalidGitURL},
+		{"https://github.com/remind101/acme-inc.git", "--output=/tmp/pwned", ErrInvalidGitRef},
+	}
+
+	for _, tt := range tests {
+		if _, err := s.SlugsBuildFromSource(context.Background(), &App{Name: "acme-inc"}, tt.gitURL, tt.ref, nil, ioutil.Discard); err != tt.err {
+			t.Fatalf("SlugsBuildFromSource(%q, %q) => %v; want %v", tt.gitURL, tt.ref, err, tt.err)
+		}
+	}
+
+	if len(a.calls) != 0 {
+		t.Fatalf("Archive => %v; want no calls", a.calls)
+	}
+}
+
+func TestValidateGitSource(t *testing.T) {
+	for _, gitURL := range []string{
+		"https://github.com/remind101/acme-inc.git",
+		"ssh://git@github.com/remind101/acme-inc.git",
+	} {
+		if err := validateGitSource(gitURL, "master"); err != nil {
+			t.Fatalf("validateGitSource(%q) => %v", gitURL, err)
+		}
+	}
+}
+
+func TestGitArchiver_Archive(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "empire-source-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A repository with a commit on the default branch, and another on a
+	// branch that isn't checked out when it's cloned.
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"checkout", "--quiet", "-b", "master"},
+		{"-c", "user.name=empire", "-c", "user.email=empire@example.com", "commit", "--quiet", "--allow-empty", "-m", "Initial commit"},
+		{"checkout", "--quiet", "-b", "feature"},
+		{"-c", "user.name=empire", "-c", "user.email=empire@example.com", "commit", "--quiet", "--allow-empty", "-m", "Feature"},
+		{"checkout", "--quiet", "master"},
+	} {
+		if _, err := git(ctx, dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &gitArchiver{}
+	for _, ref := range []string{"master", "feature"} {
+		sha, err := git(ctx, dir, "rev-parse", ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		src, err := a.Archive(ctx, dir, ref)
+		if err != nil {
+			t.Fatalf("Archive(%q) => %v", ref, err)
+		}
+		src.Close()
+
+		if got, want := src.Commit, strings.TrimSpace(string(sha)); got != want {
+			t.Fatalf("Archive(%q) Commit => %s; want %s", ref, got, want)
+		}
+	}
+
+	if _, err := a.Archive(ctx, dir, "missing"); err == nil {
+		t.Fatal("Expected an error for a ref that doesn't exist")
+	}
+}
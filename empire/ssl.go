@@ -110,16 +110,28 @@ func (s *store) CertificatesFirst(scope Scope) (*Certificate, error) {
 
 // CertificatesCreate persists the certificate.
 func (s *store) CertificatesCreate(cert *Certificate) (*Certificate, error) {
+	if err := s.writable(); err != nil {
+		return cert, err
+	}
+
 	return certificatesCreate(s.db, cert)
 }
 
 // CertificatesUpdate updates the certificate.
 func (s *store) CertificatesUpdate(cert *Certificate) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	return certificatesUpdate(s.db, cert)
 }
 
 // CertificatesDestroy destroys the certificate.
 func (s *store) CertificatesDestroy(cert *Certificate) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	return certificatesDestroy(s.db, cert)
 }
 
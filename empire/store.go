@@ -1,11 +1,49 @@
 package empire
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/logger"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
 )
 
+// DefaultStoreMonitorInterval is the default interval that the primary and
+// replica databases are pinged at.
+const DefaultStoreMonitorInterval = 10 * time.Second
+
+// ErrStoreReadOnly is returned by write methods on the store when the primary
+// database is unavailable.
+var ErrStoreReadOnly = errors.New("store is in read-only mode")
+
+// StoreMode represents whether the store can be written to.
+type StoreMode int32
+
+const (
+	// StoreModePrimary is the normal mode, where reads and writes go to
+	// the primary database.
+	StoreModePrimary StoreMode = iota
+
+	// StoreModeReadOnly is used when the primary database is unavailable.
+	// Reads go to the replica, if there is one, and writes return
+	// ErrStoreReadOnly.
+	StoreModeReadOnly
+)
+
+// String implements the fmt.Stringer interface.
+func (m StoreMode) String() string {
+	switch m {
+	case StoreModeReadOnly:
+		return "read-only"
+	default:
+		return "primary"
+	}
+}
+
 // Scope is an interface that scopes a gorm.DB. Scopes are used in
 // ThingsFirst and ThingsAll methods on the store for filtering/querying.
 type Scope interface {
@@ -76,14 +114,72 @@ func Order(order string) Scope {
 	})
 }
 
+// Page is a Scope that limits the results to a single page.
+type Page struct {
+	// The maximum number of results. Zero means no limit.
+	Limit int
+
+	// The number of results to skip.
+	Offset int
+}
+
+// Scope implements the Scope interface.
+func (p Page) Scope(db *gorm.DB) *gorm.DB {
+	if p.Limit > 0 {
+		db = db.Limit(p.Limit)
+	}
+
+	if p.Offset > 0 {
+		db = db.Offset(p.Offset)
+	}
+
+	return db
+}
+
 // store provides methods for CRUD'ing things.
 type store struct {
 	db *gorm.DB
+
+	// The connection string for db, used to open dedicated connections
+	// for LISTEN.
+	url string
+
+	// An optional read replica of db, which is read from when the store is
+	// in read-only mode.
+	replica *store
+
+	mode int32
+}
+
+// Mode returns the current StoreMode.
+func (s *store) Mode() StoreMode {
+	return StoreMode(atomic.LoadInt32(&s.mode))
+}
+
+func (s *store) setMode(mode StoreMode) {
+	atomic.StoreInt32(&s.mode, int32(mode))
+}
+
+// writable returns ErrStoreReadOnly if the store is in read-only mode. It
+// should be called by all methods that write to the database.
+func (s *store) writable() error {
+	if s.Mode() == StoreModeReadOnly {
+		return ErrStoreReadOnly
+	}
+	return nil
+}
+
+// reader returns the gorm.DB that reads should go to.
+func (s *store) reader() *gorm.DB {
+	if s.Mode() == StoreModeReadOnly && s.replica != nil {
+		return s.replica.db
+	}
+	return s.db
 }
 
 // Scope applies the scope to the gorm.DB.
 func (s *store) Scope(scope Scope) *gorm.DB {
-	return scope.Scope(s.db)
+	return scope.Scope(s.reader())
 }
 
 // First applies the scope to the gorm.DB and finds the first record, populating
@@ -99,6 +195,10 @@ func (s *store) Find(scope Scope, v interface{}) error {
 }
 
 func (s *store) Reset() error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+
 	var err error
 	exec := func(sql string) {
 		if err == nil {
@@ -108,11 +208,97 @@ func (s *store) Reset() error {
 
 	exec(`TRUNCATE TABLE apps CASCADE`)
 	exec(`TRUNCATE TABLE ports CASCADE`)
+	exec(`TRUNCATE TABLE access_tokens`)
+	exec(`TRUNCATE TABLE pending_destroys`)
+	exec(`TRUNCATE TABLE webhook_delivery_attempts`)
+	exec(`TRUNCATE TABLE config_defaults`)
 	exec(`INSERT INTO ports (port) (SELECT generate_series(9000,10000))`)
 
 	return err
 }
 
 func (s *store) IsHealthy() bool {
-	return s.db.DB().Ping() == nil
+	return s.Ping() == nil
+}
+
+// Ping checks that the database can be connected to.
+func (s *store) Ping() error {
+	return s.db.DB().Ping()
+}
+
+// pinger is something that can be pinged to check its health.
+type pinger interface {
+	Ping() error
+}
+
+// storeMonitor periodically pings the primary and replica databases, and
+// switches the store to read-only mode when the primary is unavailable.
+type storeMonitor struct {
+	// How often to ping the databases. Defaults to
+	// DefaultStoreMonitorInterval.
+	Interval time.Duration
+
+	store *store
+
+	primary pinger
+	replica pinger
+}
+
+func newStoreMonitor(s *store) *storeMonitor {
+	m := &storeMonitor{
+		store:   s,
+		primary: s,
+	}
+
+	if s.replica != nil {
+		m.replica = s.replica
+	}
+
+	return m
+}
+
+// Run checks the databases every Interval until the context is cancelled.
+func (m *storeMonitor) Run(ctx context.Context) {
+	interval := m.Interval
+	if interval == 0 {
+		interval = DefaultStoreMonitorInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// Check pings the databases and sets the mode of the store. Writes are only
+// allowed when the primary is healthy; the health of the replica only
+// determines whether reads can be served while the primary is down.
+func (m *storeMonitor) Check(ctx context.Context) StoreMode {
+	mode := StoreModePrimary
+
+	if err := m.primary.Ping(); err != nil {
+		reporter.Report(ctx, err)
+		mode = StoreModeReadOnly
+	}
+
+	if m.replica != nil {
+		if err := m.replica.Ping(); err != nil {
+			reporter.Report(ctx, err)
+		}
+	}
+
+	if prev := m.store.Mode(); prev != mode {
+		logger.Info(ctx, "store mode changed", "from", prev, "to", mode)
+	}
+
+	m.store.setMode(mode)
+
+	return mode
 }
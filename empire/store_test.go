@@ -1,6 +1,7 @@
 package empire
 
 import (
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	gosql "database/sql"
 
 	"github.com/jinzhu/gorm"
+	"golang.org/x/net/context"
 )
 
 func TestComposedScope(t *testing.T) {
@@ -82,3 +84,66 @@ func conditionSql(scope Scope) (sql string, vars []interface{}) {
 	vars = ds.SqlVars
 	return
 }
+
+func TestStoreMonitor_Check(t *testing.T) {
+	down := errors.New("connection refused")
+
+	tests := []struct {
+		primary, replica error
+		mode             StoreMode
+	}{
+		{nil, nil, StoreModePrimary},
+		{down, nil, StoreModeReadOnly},
+		{nil, down, StoreModePrimary},
+		{down, down, StoreModeReadOnly},
+	}
+
+	for i, tt := range tests {
+		s := &store{}
+		m := &storeMonitor{
+			store:   s,
+			primary: mockPinger{tt.primary},
+			replica: mockPinger{tt.replica},
+		}
+
+		if got, want := m.Check(context.Background()), tt.mode; got != want {
+			t.Fatalf("#%d: Check => %v; want %v", i, got, want)
+		}
+
+		if got, want := s.Mode(), tt.mode; got != want {
+			t.Fatalf("#%d: Mode => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestStore_ReadOnly(t *testing.T) {
+	primary, replica := &gorm.DB{}, &gorm.DB{}
+	s := &store{db: primary, replica: &store{db: replica}}
+
+	if got, want := s.reader(), primary; got != want {
+		t.Fatal("Expected reads to go to the primary")
+	}
+
+	s.setMode(StoreModeReadOnly)
+
+	if got, want := s.reader(), replica; got != want {
+		t.Fatal("Expected reads to go to the replica")
+	}
+
+	if _, err := s.AppsCreate(&App{Name: "acme-inc"}); err != ErrStoreReadOnly {
+		t.Fatalf("err => %v; want %v", err, ErrStoreReadOnly)
+	}
+
+	if err := s.DomainsDestroy(&Domain{}); err != ErrStoreReadOnly {
+		t.Fatalf("err => %v; want %v", err, ErrStoreReadOnly)
+	}
+}
+
+// mockPinger is a pinger implementation that returns err.
+type mockPinger struct {
+	err error
+}
+
+func (p mockPinger) Ping() error {
+	return p.err
+}
@@ -0,0 +1,154 @@
+package empire
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+// Types of ReleaseEvents.
+const (
+	ReleaseEventCreated  = "created"
+	ReleaseEventDeployed = "deployed"
+	ReleaseEventFailed   = "failed"
+	ReleaseEventPromoted = "promote_to_stable"
+	ReleaseEventRejected = "rejected"
+)
+
+// ReleaseEvent is sent to streams of an apps releases when a release is
+// created, and again when it has been deployed or failed to deploy.
+type ReleaseEvent struct {
+	Type    string
+	Release *Release
+	Message string
+}
+
+// releaseEventPayload is the NOTIFY payload for a ReleaseEvent. Payloads are
+// limited in size, so only the id of the release is included.
+type releaseEventPayload struct {
+	Type      string `json:"type"`
+	ReleaseID string `json:"release_id"`
+	Message   string `json:"message,omitempty"`
+}
+
+// releasesChannel returns the name of the NOTIFY channel for events about the
+// apps releases.
+func releasesChannel(app *App) string {
+	return fmt.Sprintf("releases.%s", app.ID)
+}
+
+// Listen LISTENs on the channel, and sends the payload of each notification
+// to payload until the context is cancelled, at which point payload is
+// closed. It returns once the channel is being listened on.
+func (s *store) Listen(ctx context.Context, channel string, payload chan<- string) error {
+	l := pq.NewListener(s.url, 10*time.Second, time.Minute, nil)
+
+	if err := l.Listen(channel); err != nil {
+		l.Close()
+		return err
+	}
+
+	go func() {
+		defer close(payload)
+		defer l.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n := <-l.Notify:
+				// A nil notification is sent when the connection
+				// is re-established.
+				if n == nil {
+					continue
+				}
+
+				select {
+				case payload <- n.Extra:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Notify sends a notification with the payload to listeners of the channel.
+func (s *store) Notify(channel, payload string) error {
+	return s.db.Exec(`SELECT pg_notify(?, ?)`, channel, payload).Error
+}
+
+// releaseStreamer streams ReleaseEvents for an app.
+type releaseStreamer struct {
+	store *store
+}
+
+// ReleasesStream returns a channel of ReleaseEvents for the app, which is
+// closed when the context is cancelled.
+func (s *releaseStreamer) ReleasesStream(ctx context.Context, app *App) (<-chan ReleaseEvent, error) {
+	payloads := make(chan string)
+	if err := s.store.Listen(ctx, releasesChannel(app), payloads); err != nil {
+		return nil, err
+	}
+
+	events := make(chan ReleaseEvent)
+
+	go func() {
+		defer close(events)
+
+		for p := range payloads {
+			event, err := s.event(p)
+			if err != nil {
+				reporter.Report(ctx, err)
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// event decodes the NOTIFY payload and finds the release.
+func (s *releaseStreamer) event(payload string) (ReleaseEvent, error) {
+	var p releaseEventPayload
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return ReleaseEvent{}, err
+	}
+
+	r, err := s.store.ReleasesFirst(ReleasesQuery{ID: &p.ReleaseID})
+	if err != nil {
+		return ReleaseEvent{}, err
+	}
+
+	return ReleaseEvent{
+		Type:    p.Type,
+		Release: r,
+		Message: p.Message,
+	}, nil
+}
+
+// notifyRelease sends a ReleaseEvent to streams of the releases app.
+func (s *store) notifyRelease(r *Release, typ, message string) error {
+	raw, err := json.Marshal(releaseEventPayload{
+		Type:      typ,
+		ReleaseID: r.ID,
+		Message:   message,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.Notify(releasesChannel(r.App), string(raw))
+}
@@ -0,0 +1,397 @@
+package empire
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/reporter"
+	"golang.org/x/net/context"
+)
+
+const (
+	// ReleaseTagStable is moved to every new release, unless
+	// Release.SkipStableTag is set.
+	ReleaseTagStable = "stable"
+
+	// ReleaseTagCanary is set on canary releases.
+	ReleaseTagCanary = "canary"
+
+	// ReleaseTagSemver is moved to every release with a semantic version in
+	// its description, by ReleasesAutoTag.
+	ReleaseTagSemver = "semver"
+
+	// ReleaseTagSemverLatest points to the release with the greatest
+	// semantic version. Unlike ReleaseTagSemver, it never moves to a lower
+	// version.
+	ReleaseTagSemverLatest = "semver-latest"
+
+	// ReleaseTagHealthy is moved to a release by the CrashLoopDetector once
+	// it has run for the window of the app's crash loop policies without
+	// crashing.
+	ReleaseTagHealthy = "healthy"
+)
+
+// ErrTagNotFound is returned when an app doesn't have a release with the given
+// tag.
+var ErrTagNotFound = &ValidationError{
+	errors.New("Release tag not found."),
+}
+
+// ErrReleaseNotActive is returned when promoting a release that hasn't been
+// activated.
+var ErrReleaseNotActive = &ValidationError{
+	errors.New("Only active releases can be promoted to stable."),
+}
+
+// ReleaseTag is a name that points to a release of an app, e.g. "stable". An
+// app can only have one release with a given tag.
+type ReleaseTag struct {
+	ID        string
+	AppID     string
+	ReleaseID string
+	Tag       string
+}
+
+// ReleaseTagsQuery is a Scope implementation for common things to filter
+// release tags by.
+type ReleaseTagsQuery struct {
+	// If provided, filters tags for the given app.
+	App *App
+
+	// If provided, finds the given tag.
+	Tag *string
+
+	// If provided, finds tags matching the SQL LIKE pattern, e.g.
+	// "rollback%".
+	TagPattern *string
+}
+
+// Scope implements the Scope interface.
+func (q ReleaseTagsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.App != nil {
+		scope = append(scope, ForApp(q.App))
+	}
+
+	if q.Tag != nil {
+		scope = append(scope, FieldEquals("tag", *q.Tag))
+	}
+
+	if q.TagPattern != nil {
+		pattern := *q.TagPattern
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("tag LIKE ?", pattern)
+		}))
+	}
+
+	return scope.Scope(db)
+}
+
+// ReleaseTagsFirst returns the first matching release tag.
+func (s *store) ReleaseTagsFirst(scope Scope) (*ReleaseTag, error) {
+	var tag ReleaseTag
+	return &tag, s.First(scope, &tag)
+}
+
+// ReleaseTags returns all release tags matching the scope, sorted by tag.
+func (s *store) ReleaseTags(scope Scope) ([]*ReleaseTag, error) {
+	var tags []*ReleaseTag
+	scope = ComposedScope{scope, Order("tag")}
+	return tags, s.Find(scope, &tags)
+}
+
+// ReleaseTagsSet points the tag at the release, moving it from any other
+// release of the app.
+func (s *store) ReleaseTagsSet(tag *ReleaseTag) (*ReleaseTag, error) {
+	if err := s.writable(); err != nil {
+		return tag, err
+	}
+
+	return releaseTagsSet(s.db, tag)
+}
+
+func releaseTagsSet(db *gorm.DB, tag *ReleaseTag) (*ReleaseTag, error) {
+	t := db.Begin()
+
+	if err := t.Where("app_id = ? and tag = ?", tag.AppID, tag.Tag).Delete(ReleaseTag{}).Error; err != nil {
+		t.Rollback()
+		return tag, err
+	}
+
+	if err := t.Create(tag).Error; err != nil {
+		t.Rollback()
+		return tag, err
+	}
+
+	return tag, t.Commit().Error
+}
+
+// releaseTagsService is a service for tagging releases.
+type releaseTagsService struct {
+	store *store
+}
+
+// ReleaseTagSet points the tag at the release.
+func (s *releaseTagsService) ReleaseTagSet(app *App, release *Release, tag string) error {
+	_, err := s.store.ReleaseTagsSet(&ReleaseTag{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Tag:       tag,
+	})
+	return err
+}
+
+// ReleaseTagGet returns the release with the given tag.
+func (s *releaseTagsService) ReleaseTagGet(app *App, tag string) (*Release, error) {
+	t, err := s.store.ReleaseTagsFirst(ReleaseTagsQuery{App: app, Tag: &tag})
+	if err != nil {
+		if err == gorm.RecordNotFound {
+			err = ErrTagNotFound
+		}
+		return nil, err
+	}
+
+	return s.store.ReleasesFirst(ReleasesQuery{ID: &t.ReleaseID})
+}
+
+// ReleasesTagSearch returns the releases with a tag matching the SQL LIKE
+// pattern. A release with more than one matching tag is only returned once.
+func (s *releaseTagsService) ReleasesTagSearch(app *App, tagPattern string) ([]*Release, error) {
+	tags, err := s.store.ReleaseTags(ReleaseTagsQuery{App: app, TagPattern: &tagPattern})
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []*Release
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		if seen[t.ReleaseID] {
+			continue
+		}
+		seen[t.ReleaseID] = true
+
+		r, err := s.store.ReleasesFirst(ReleasesQuery{ID: &t.ReleaseID})
+		if err != nil {
+			return releases, err
+		}
+		releases = append(releases, r)
+	}
+
+	return releases, nil
+}
+
+// ReleasesTagAll returns the release for each of the app's tags.
+func (s *releaseTagsService) ReleasesTagAll(app *App) (map[string]*Release, error) {
+	tags, err := s.store.ReleaseTags(ReleaseTagsQuery{App: app})
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make(map[string]*Release)
+	for _, t := range tags {
+		r, err := s.store.ReleasesFirst(ReleasesQuery{ID: &t.ReleaseID})
+		if err != nil {
+			return releases, err
+		}
+		releases[t.Tag] = r
+	}
+
+	return releases, nil
+}
+
+// stablePromoter promotes releases to stable.
+type stablePromoter struct {
+	store    *store
+	scaler   *scaler
+	notifier *notifier
+}
+
+// ReleasesPromoteToStable moves ReleaseTagStable to the release. If the
+// release's formation differs from the current release's, the running
+// processes are scaled to match it. Promoting the release that's already
+// stable does nothing.
+func (s *stablePromoter) ReleasesPromoteToStable(ctx context.Context, app *App, version int) error {
+	r, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Version: &version})
+	if err != nil {
+		return err
+	}
+
+	if r.Status != ReleaseStatusActive {
+		return ErrReleaseNotActive
+	}
+
+	tag := ReleaseTagStable
+	stable, err := s.store.ReleaseTagsFirst(ReleaseTagsQuery{App: app, Tag: &tag})
+	if err != nil && err != gorm.RecordNotFound {
+		return err
+	}
+	if err == nil && stable.ReleaseID == r.ID {
+		return nil
+	}
+
+	if _, err := s.store.ReleaseTagsSet(&ReleaseTag{
+		AppID:     app.ID,
+		ReleaseID: r.ID,
+		Tag:       ReleaseTagStable,
+	}); err != nil {
+		return err
+	}
+
+	if err := s.scale(ctx, app, r.Formation()); err != nil {
+		return err
+	}
+
+	if err := s.store.notifyRelease(r, ReleaseEventPromoted, ""); err != nil {
+		reporter.Report(ctx, err)
+	}
+
+	s.notifier.Notify(ctx, Notification{
+		Severity: SeverityInfo,
+		App:      app.Name,
+		Event:    NotificationPromote,
+		Message:  fmt.Sprintf("Promoted %s v%d to stable", app.Name, r.Version),
+	})
+
+	return nil
+}
+
+// scale scales the processes of the current release to the quantities in the
+// stable formation, if they're different. Process types that the current
+// release doesn't have are ignored.
+func (s *stablePromoter) scale(ctx context.Context, app *App, stable Formation) error {
+	current, err := s.store.ReleasesFirst(ReleasesQuery{App: app, Status: ReleaseStatusActive})
+	if err != nil {
+		return err
+	}
+
+	f := current.Formation()
+	if len(FormationDiff(f, stable)) == 0 {
+		return nil
+	}
+
+	quantities := make(map[string]int)
+	for t, p := range stable {
+		if _, ok := f[t]; ok {
+			quantities[string(t)] = p.Quantity
+		}
+	}
+
+	if len(quantities) == 0 {
+		return nil
+	}
+
+	if _, err := s.scaler.ProcessesScale(ctx, app, quantities); err != nil && err != ErrNoChangeRequired {
+		return err
+	}
+
+	return nil
+}
+
+// ReleasesAutoTag tags the release with ReleaseTagSemver if its description
+// contains a semantic version, e.g. "Deploy v1.2.3". ReleaseTagSemverLatest is
+// also moved to the release if its version is greater than the release that
+// currently has the tag.
+func (s *releaseTagsService) ReleasesAutoTag(app *App, release *Release) error {
+	v, ok := findSemver(release.Description)
+	if !ok {
+		return nil
+	}
+
+	if err := s.ReleaseTagSet(app, release, ReleaseTagSemver); err != nil {
+		return err
+	}
+
+	latest, err := s.ReleaseTagGet(app, ReleaseTagSemverLatest)
+	if err != nil && err != ErrTagNotFound {
+		return err
+	}
+
+	if err == nil {
+		if lv, ok := findSemver(latest.Description); ok && !lv.Less(v) {
+			return nil
+		}
+	}
+
+	return s.ReleaseTagSet(app, release, ReleaseTagSemverLatest)
+}
+
+// semverPattern matches a semantic version, with an optional "v" prefix and
+// pre-release. Build metadata is ignored, since it doesn't affect precedence.
+var semverPattern = regexp.MustCompile(`\bv?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?`)
+
+// semver is a parsed semantic version.
+type semver struct {
+	Major, Minor, Patch int
+	Pre                 []string
+}
+
+// findSemver returns the first semantic version in s.
+func findSemver(s string) (semver, bool) {
+	m := semverPattern.FindStringSubmatch(s)
+	if m == nil {
+		return semver{}, false
+	}
+
+	var v semver
+	for i, p := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			// Too large to be a version anyone means.
+			return semver{}, false
+		}
+		*p = n
+	}
+
+	if m[4] != "" {
+		v.Pre = strings.Split(m[4], ".")
+	}
+
+	return v, true
+}
+
+// Less returns true if v has a lower precedence than o, following the rules in
+// https://semver.org/#spec-item-11.
+func (v semver) Less(o semver) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	if v.Patch != o.Patch {
+		return v.Patch < o.Patch
+	}
+
+	// A pre-release version has a lower precedence than the release.
+	if len(v.Pre) == 0 || len(o.Pre) == 0 {
+		return len(v.Pre) > len(o.Pre)
+	}
+
+	for i := 0; i < len(v.Pre) && i < len(o.Pre); i++ {
+		a, b := v.Pre[i], o.Pre[i]
+		if a == b {
+			continue
+		}
+
+		an, aerr := strconv.Atoi(a)
+		bn, berr := strconv.Atoi(b)
+		switch {
+		case aerr == nil && berr == nil:
+			return an < bn
+		case aerr == nil:
+			// Numeric identifiers are lower than alphanumeric ones.
+			return true
+		case berr == nil:
+			return false
+		default:
+			return a < b
+		}
+	}
+
+	return len(v.Pre) < len(o.Pre)
+}
@@ -0,0 +1,86 @@
+package empire
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReleaseTagsQuery(t *testing.T) {
+	app := &App{ID: "1234"}
+	tag := ReleaseTagStable
+	pattern := "rollback%"
+
+	tests := scopeTests{
+		{ReleaseTagsQuery{}, "", []interface{}{}},
+		{ReleaseTagsQuery{App: app}, "WHERE (app_id = $1)", []interface{}{app.ID}},
+		{ReleaseTagsQuery{Tag: &tag}, "WHERE (tag = $1)", []interface{}{tag}},
+		{ReleaseTagsQuery{App: app, Tag: &tag}, "WHERE (app_id = $1) AND (tag = $2)", []interface{}{app.ID, tag}},
+		{ReleaseTagsQuery{TagPattern: &pattern}, "WHERE (tag LIKE $1)", []interface{}{pattern}},
+	}
+
+	tests.Run(t)
+}
+
+func TestFindSemver(t *testing.T) {
+	tests := []struct {
+		in string
+		v  *semver
+	}{
+		{"Deploy v1.2.3", &semver{1, 2, 3, nil}},
+		{"Release 10.0.1 to production", &semver{10, 0, 1, nil}},
+		{"v2.0.0-rc.1+build.5", &semver{2, 0, 0, []string{"rc", "1"}}},
+		{"v1.2.3 then v1.2.4", &semver{1, 2, 3, nil}},
+		{"Deploy remind101/acme-inc:latest", nil},
+		{"Deploy v1.2", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		v, ok := findSemver(tt.in)
+		if tt.v == nil {
+			if ok {
+				t.Errorf("findSemver(%q) => %v; want none", tt.in, v)
+			}
+			continue
+		}
+
+		if !ok || !reflect.DeepEqual(v, *tt.v) {
+			t.Errorf("findSemver(%q) => %v; want %v", tt.in, v, *tt.v)
+		}
+	}
+}
+
+func TestSemver_Less(t *testing.T) {
+	// In order of precedence, from https://semver.org/#spec-item-11.
+	versions := []string{
+		"0.9.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+	}
+
+	for i := 0; i+1 < len(versions); i++ {
+		a, _ := findSemver(versions[i])
+		b, _ := findSemver(versions[i+1])
+
+		if !a.Less(b) {
+			t.Errorf("%s < %s => false; want true", versions[i], versions[i+1])
+		}
+
+		if b.Less(a) {
+			t.Errorf("%s < %s => true; want false", versions[i+1], versions[i])
+		}
+
+		if a.Less(a) {
+			t.Errorf("%s < %s => true; want false", versions[i], versions[i])
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package empire
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultTarballDownloadTimeout is the default maximum time that downloading a
+// tarball for DeployFromTarball can take.
+const DefaultTarballDownloadTimeout = 5 * time.Minute
+
+var (
+	// ErrInvalidTarballURL is returned when deploying from a URL that
+	// isn't http or https.
+	ErrInvalidTarballURL = &ValidationError{
+		errors.New("Tarball URLs must be http or https."),
+	}
+
+	// ErrTarballHostNotAllowed is returned when deploying from, or
+	// being redirected to, a host that isn't in
+	// Options.TarballAllowedHosts.
+	ErrTarballHostNotAllowed = &ValidationError{
+		errors.New("Tarballs can't be downloaded from this host."),
+	}
+)
+
+// TarballDeployOptions are options for DeployFromTarball.
+type TarballDeployOptions struct {
+	// Build args to pass to the Dockerfile.
+	BuildArgs map[string]string
+}
+
+// imageDeployer deploys an image that's already been pushed to a registry.
+type imageDeployer interface {
+	DeployImageToApp(ctx context.Context, app *App, image Image, meta ReleaseMetadata, out chan Event) (*Release, error)
+}
+
+// tarballDeployer builds images from a gzipped tar archive, with a Dockerfile,
+// that's downloaded from a URL, then deploys them.
+type tarballDeployer struct {
+	// The hosts that tarballs can be downloaded from. Since the tarball is
+	// downloaded from inside the network that Empire runs in, other hosts
+	// are rejected with ErrTarballHostNotAllowed.
+	allowedHosts []string
+
+	// The maximum time that downloading a tarball can take. Defaults to
+	// DefaultTarballDownloadTimeout.
+	timeout time.Duration
+
+	builder  Builder
+	deployer imageDeployer
+}
+
+// DeployFromTarball downloads the tarball and uses it as the build context of
+// an image for the app. The image is tagged with the sha256 of the URL, pushed,
+// and deployed.
+func (d *tarballDeployer) DeployFromTarball(ctx context.Context, app *App, tarURL string, opts TarballDeployOptions) (*Release, error) {
+	u, err := url.Parse(tarURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, ErrInvalidTarballURL
+	}
+
+	if !d.hostAllowed(u) {
+		return nil, ErrTarballHostNotAllowed
+	}
+
+	resp, err := d.download(ctx, tarURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", tarURL, resp.Status)
+	}
+
+	image, err := d.builder.Build(app, resp.Body, tarballTag(tarURL), BuildImageOptions{BuildArgs: opts.BuildArgs})
+	if err != nil {
+		return nil, err
+	}
+
+	// The image was just built, so there's nobody interested in the events
+	// from pulling it.
+	out := make(chan Event)
+	go func() {
+		for range out {
+		}
+	}()
+	defer close(out)
+
+	return d.deployer.DeployImageToApp(ctx, app, image, ReleaseMetadata{}, out)
+}
+
+// download starts downloading the tarball. The download is cancelled if the
+// context is done before the body is closed, and redirects are only followed
+// to allowed hosts.
+func (d *tarballDeployer) download(ctx context.Context, tarURL string) (*http.Response, error) {
+	timeout := d.timeout
+	if timeout == 0 {
+		timeout = DefaultTarballDownloadTimeout
+	}
+
+	// Each download gets its own connection, so that it can be closed
+	// when the context is done.
+	dialer := new(closingDialer)
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			Dial:              dialer.Dial,
+			DisableKeepAlives: true,
+		},
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !d.hostAllowed(req.URL) {
+				return ErrTarballHostNotAllowed
+			}
+			return nil
+		},
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			dialer.Close()
+		case <-closed:
+		}
+	}()
+
+	resp, err := client.Get(tarURL)
+	if err != nil {
+		close(closed)
+		if err, ok := err.(*url.Error); ok && err.Err == ErrTarballHostNotAllowed {
+			return nil, ErrTarballHostNotAllowed
+		}
+		return nil, err
+	}
+
+	resp.Body = &notifyCloser{ReadCloser: resp.Body, closed: closed}
+	return resp, nil
+}
+
+// hostAllowed returns true if the host of u is one of the allowed hosts.
+func (d *tarballDeployer) hostAllowed(u *url.URL) bool {
+	host := u.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	for _, allowed := range d.allowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// closingDialer dials connections that can all be closed at once.
+type closingDialer struct {
+	mu     sync.Mutex
+	conns  []net.Conn
+	closed bool
+}
+
+// Dial dials the address, failing if the dialer has been closed.
+func (d *closingDialer) Dial(network, addr string) (net.Conn, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		conn.Close()
+		return nil, errors.New("download cancelled")
+	}
+
+	d.conns = append(d.conns, conn)
+	return conn, nil
+}
+
+// Close closes every connection that was dialed.
+func (d *closingDialer) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+}
+
+// notifyCloser closes the closed channel when it's closed.
+type notifyCloser struct {
+	io.ReadCloser
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (c *notifyCloser) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.ReadCloser.Close()
+}
+
+// tarballTag returns the tag for images built from the tarball at tarURL.
+func tarballTag(tarURL string) string {
+	sum := sha256.Sum256([]byte(tarURL))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,155 @@
+package empire
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestTarballDeployer_DeployFromTarball(t *testing.T) {
+	tarball := []byte("FROM busybox")
+
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(tarball)
+	}))
+	defer files.Close()
+
+	var buildContext []byte
+	var buildArgs string
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch fmt.Sprintf("%s %s", r.Method, buildTagRegexp.ReplaceAllString(r.URL.Path, "")) {
+		case "POST /build":
+			buildContext, _ = ioutil.ReadAll(r.Body)
+			buildArgs = r.URL.Query().Get("buildargs")
+			w.Write([]byte(`{"stream":"Step 0 : FROM busybox\n"}`))
+		case "GET /images/quay.io/remind101/acme-inc/json":
+			w.Write([]byte(`{"Id":"abcd"}`))
+		case "DELETE /images/quay.io/remind101/acme-inc":
+			w.Write([]byte(`[]`))
+		case "POST /images/quay.io/remind101/acme-inc/tag":
+			w.WriteHeader(http.StatusCreated)
+		case "POST /images/quay.io/remind101/acme-inc/push":
+			w.Write([]byte(`{"status":"Pushed"}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	c, s := newTestDockerClient(t, api)
+	defer s.Close()
+
+	deployer := new(fakeImageDeployer)
+	d := &tarballDeployer{
+		allowedHosts: []string{"127.0.0.1"},
+		builder:      newDockerBuilder(c, "quay.io/remind101", nil, nil),
+		deployer:     deployer,
+	}
+
+	tarURL := files.URL + "/app.tar.gz"
+	opts := TarballDeployOptions{BuildArgs: map[string]string{"VERSION": "1"}}
+	if _, err := d.DeployFromTarball(context.Background(), &App{Name: "acme-inc"}, tarURL, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buildContext, tarball) {
+		t.Fatalf("build context => %q; want %q", buildContext, tarball)
+	}
+
+	if got, want := buildArgs, `{"VERSION":"1"}`; got != want {
+		t.Fatalf("buildargs => %q; want %q", got, want)
+	}
+
+	want := Image{Repo: "quay.io/remind101/acme-inc", ID: tarballTag(tarURL)}
+	if got := deployer.image; got != want {
+		t.Fatalf("Image => %v; want %v", got, want)
+	}
+}
+
+func TestTarballDeployer_DeployFromTarball_Errors(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer files.Close()
+
+	d := &tarballDeployer{
+		allowedHosts: []string{"127.0.0.1"},
+		builder:      &fakeBuilder{},
+		deployer:     new(fakeImageDeployer),
+	}
+
+	tests := []struct {
+		url  string
+		opts TarballDeployOptions
+		err  string
+	}{
+		{"ftp://example.com/app.tar.gz", TarballDeployOptions{}, ErrInvalidTarballURL.Error()},
+		{"/app.tar.gz", TarballDeployOptions{}, ErrInvalidTarballURL.Error()},
+		{"http://169.254.169.254/latest/meta-data/", TarballDeployOptions{}, ErrTarballHostNotAllowed.Error()},
+		{files.URL + "/redirect", TarballDeployOptions{}, ErrTarballHostNotAllowed.Error()},
+		{files.URL + "/app.tar.gz", TarballDeployOptions{}, fmt.Sprintf("downloading %s/app.tar.gz: 404 Not Found", files.URL)},
+	}
+
+	for _, tt := range tests {
+		_, err := d.DeployFromTarball(context.Background(), &App{Name: "acme-inc"}, tt.url, tt.opts)
+		if err == nil || err.Error() != tt.err {
+			t.Fatalf("DeployFromTarball(%q) => %v; want %s", tt.url, err, tt.err)
+		}
+	}
+}
+
+func TestTarballDeployer_DeployFromTarball_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Never respond, until the request is cancelled.
+		cancel()
+		<-w.(http.CloseNotifier).CloseNotify()
+	}))
+	defer files.Close()
+
+	d := &tarballDeployer{
+		allowedHosts: []string{"127.0.0.1"},
+		builder:      &fakeBuilder{},
+		deployer:     new(fakeImageDeployer),
+	}
+
+	if _, err := d.DeployFromTarball(ctx, &App{Name: "acme-inc"}, files.URL+"/app.tar.gz", TarballDeployOptions{}); err == nil {
+		t.Fatal("Expected the download to be cancelled")
+	}
+}
+
+func TestTarballTag(t *testing.T) {
+	a := tarballTag("https://example.com/a.tar.gz")
+	if got, want := len(a), 64; got != want {
+		t.Fatalf("len(tag) => %d; want %d", got, want)
+	}
+
+	if a == tarballTag("https://example.com/b.tar.gz") {
+		t.Fatal("expected different urls to have different tags")
+	}
+}
+
+// fakeImageDeployer is an imageDeployer that records the image it was asked to
+// deploy.
+type fakeImageDeployer struct {
+	image Image
+}
+
+func (d *fakeImageDeployer) DeployImageToApp(ctx context.Context, app *App, image Image, meta ReleaseMetadata, out chan Event) (*Release, error) {
+	d.image = image
+	return &Release{App: app}, nil
+}
@@ -0,0 +1,194 @@
+package empire
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultEC2MetadataURL is the url of the EC2 instance metadata service.
+const DefaultEC2MetadataURL = "http://169.254.169.254/latest/meta-data"
+
+// Resource describes the environment that Empire is running in, using the
+// OpenTelemetry semantic conventions for attribute names, e.g.
+// "cloud.provider" or "k8s.pod.name".
+type Resource map[string]string
+
+// pairs returns the attributes as sorted key value pairs, for adding to a
+// logger.
+func (r Resource) pairs() []interface{} {
+	keys := make([]string, 0, len(r))
+	for k := range r {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []interface{}
+	for _, k := range keys {
+		pairs = append(pairs, k, r[k])
+	}
+	return pairs
+}
+
+// ResourceDetector detects attributes of the environment that Empire is
+// running in. If the environment isn't one that the detector knows about, it
+// returns an empty Resource.
+type ResourceDetector interface {
+	Detect(context.Context) (Resource, error)
+}
+
+// DefaultResourceDetectors are the detectors used when
+// TelemetryOptions.Detectors is nil.
+var DefaultResourceDetectors = []ResourceDetector{
+	&EC2ResourceDetector{},
+	&KubernetesResourceDetector{},
+}
+
+// TelemetryOptions configures the attributes that are attached to Empire's
+// logs and traces.
+type TelemetryOptions struct {
+	// The name of this Empire service, e.g. "empire".
+	ServiceName string
+
+	// The environment that Empire is deployed to, e.g. "production".
+	Environment string
+
+	// The detectors used to find attributes of the host. Defaults to
+	// DefaultResourceDetectors.
+	Detectors []ResourceDetector
+}
+
+// detectResource runs the detectors, merging the attributes that they find
+// with the service name and environment.
+func detectResource(ctx context.Context, opts TelemetryOptions) (Resource, error) {
+	detectors := opts.Detectors
+	if detectors == nil {
+		detectors = DefaultResourceDetectors
+	}
+
+	resource := make(Resource)
+
+	for _, d := range detectors {
+		r, err := d.Detect(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range r {
+			resource[k] = v
+		}
+	}
+
+	if opts.ServiceName != "" {
+		resource["service.name"] = opts.ServiceName
+	}
+
+	if opts.Environment != "" {
+		resource["deployment.environment"] = opts.Environment
+	}
+
+	return resource, nil
+}
+
+// EC2ResourceDetector detects the EC2 instance that Empire is running on using
+// the instance metadata service.
+type EC2ResourceDetector struct {
+	// The url of the metadata service. Defaults to DefaultEC2MetadataURL.
+	URL string
+
+	// The http.Client to use. Defaults to a client with a short timeout,
+	// since the metadata service isn't reachable outside of EC2.
+	Client *http.Client
+}
+
+// Detect implements the ResourceDetector interface.
+func (d *EC2ResourceDetector) Detect(ctx context.Context) (Resource, error) {
+	id, ok := d.get("instance-id")
+	if !ok {
+		return Resource{}, nil
+	}
+
+	r := Resource{
+		"cloud.provider": "aws",
+		"host.id":        id,
+	}
+
+	if az, ok := d.get("placement/availability-zone"); ok {
+		r["cloud.availability_zone"] = az
+	}
+
+	return r, nil
+}
+
+// get returns the metadata at the path, and false if the metadata service
+// couldn't be reached.
+func (d *EC2ResourceDetector) get(path string) (string, bool) {
+	url := d.URL
+	if url == "" {
+		url = DefaultEC2MetadataURL
+	}
+
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second}
+	}
+
+	resp, err := client.Get(url + "/" + path)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(string(raw)), true
+}
+
+// KubernetesResourceDetector detects the Kubernetes pod that Empire is
+// running in from the environment.
+type KubernetesResourceDetector struct {
+	// Getenv is used to look up environment variables. Defaults to
+	// os.Getenv.
+	Getenv func(string) string
+}
+
+// Detect implements the ResourceDetector interface.
+func (d *KubernetesResourceDetector) Detect(ctx context.Context) (Resource, error) {
+	getenv := d.Getenv
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+
+	// Set in every container that Kubernetes runs.
+	if getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return Resource{}, nil
+	}
+
+	r := Resource{}
+
+	// POD_NAME and POD_NAMESPACE are conventionally exposed with the
+	// downward API. The hostname of a pod is its name.
+	if name := getenv("POD_NAME"); name != "" {
+		r["k8s.pod.name"] = name
+	} else if name := getenv("HOSTNAME"); name != "" {
+		r["k8s.pod.name"] = name
+	}
+
+	if ns := getenv("POD_NAMESPACE"); ns != "" {
+		r["k8s.namespace.name"] = ns
+	}
+
+	return r, nil
+}
@@ -0,0 +1,198 @@
+package empire
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/remind101/pkg/logger"
+	"github.com/remind101/pkg/trace"
+	"golang.org/x/net/context"
+)
+
+func TestEmpire_ConfigureTelemetry(t *testing.T) {
+	var records []*log15.Record
+	l := log15.New()
+	l.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	e := &Empire{Logger: l}
+	err := e.ConfigureTelemetry(context.Background(), TelemetryOptions{
+		ServiceName: "empire",
+		Environment: "staging",
+		Detectors: []ResourceDetector{
+			staticDetector{"cloud.provider": "aws", "host.id": "i-1234"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := logger.WithLogger(context.Background(), &log15Logger{e.Logger})
+	_, done := trace.Trace(ctx)
+	done(nil, "span")
+
+	if len(records) != 1 {
+		t.Fatalf("records => %d; want 1", len(records))
+	}
+
+	pairs := pairsMap(records[0].Ctx)
+	for k, v := range map[string]string{
+		"service.name":           "empire",
+		"deployment.environment": "staging",
+		"cloud.provider":         "aws",
+		"host.id":                "i-1234",
+	} {
+		if got := pairs[k]; got != v {
+			t.Errorf("%s => %v; want %s", k, got, v)
+		}
+	}
+
+	if pairs["trace.id"] == nil {
+		t.Error("expected the span to have a trace.id")
+	}
+}
+
+func TestEmpire_ConfigureTelemetry_Error(t *testing.T) {
+	l := log15.New()
+	e := &Empire{Logger: l}
+	errBoom := errors.New("boom")
+
+	err := e.ConfigureTelemetry(context.Background(), TelemetryOptions{
+		Detectors: []ResourceDetector{errDetector{errBoom}},
+	})
+	if err != errBoom {
+		t.Fatalf("err => %v; want %v", err, errBoom)
+	}
+
+	if e.Logger != l {
+		t.Fatal("expected the logger to be unchanged")
+	}
+}
+
+func TestEC2ResourceDetector(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/instance-id":
+			w.Write([]byte("i-1234\n"))
+		case "/placement/availability-zone":
+			w.Write([]byte("us-east-1a"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	d := &EC2ResourceDetector{URL: s.URL}
+	r, err := d.Detect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Resource{
+		"cloud.provider":          "aws",
+		"cloud.availability_zone": "us-east-1a",
+		"host.id":                 "i-1234",
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Fatalf("Resource => %v; want %v", r, want)
+	}
+}
+
+func TestEC2ResourceDetector_NotEC2(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	defer s.Close()
+
+	d := &EC2ResourceDetector{URL: s.URL}
+	r, err := d.Detect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r) != 0 {
+		t.Fatalf("Resource => %v; want empty", r)
+	}
+}
+
+func TestKubernetesResourceDetector(t *testing.T) {
+	tests := []struct {
+		env      map[string]string
+		resource Resource
+	}{
+		{
+			map[string]string{},
+			Resource{},
+		},
+		{
+			map[string]string{
+				"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+				"HOSTNAME":                "empire-abcd",
+			},
+			Resource{"k8s.pod.name": "empire-abcd"},
+		},
+		{
+			map[string]string{
+				"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+				"HOSTNAME":                "empire-abcd",
+				"POD_NAME":                "empire-1234",
+				"POD_NAMESPACE":           "platform",
+			},
+			Resource{"k8s.pod.name": "empire-1234", "k8s.namespace.name": "platform"},
+		},
+	}
+
+	for _, tt := range tests {
+		env := tt.env
+		d := &KubernetesResourceDetector{
+			Getenv: func(k string) string { return env[k] },
+		}
+
+		r, err := d.Detect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(r, tt.resource) {
+			t.Errorf("Resource => %v; want %v", r, tt.resource)
+		}
+	}
+}
+
+// staticDetector is a ResourceDetector that always detects the same
+// attributes.
+type staticDetector Resource
+
+func (d staticDetector) Detect(ctx context.Context) (Resource, error) {
+	return Resource(d), nil
+}
+
+// errDetector is a ResourceDetector that always fails.
+type errDetector struct {
+	err error
+}
+
+func (d errDetector) Detect(ctx context.Context) (Resource, error) {
+	return nil, d.err
+}
+
+// log15Logger adapts a log15.Logger to the logger.Logger interface.
+type log15Logger struct {
+	log15.Logger
+}
+
+func (l *log15Logger) New(pairs ...interface{}) logger.Logger {
+	return &log15Logger{l.Logger.New(pairs...)}
+}
+
+func pairsMap(pairs []interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for i := 0; i+1 < len(pairs); i += 2 {
+		m[pairs[i].(string)] = pairs[i+1]
+	}
+	return m
+}
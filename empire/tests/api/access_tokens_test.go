@@ -0,0 +1,298 @@
+package api_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+func TestAccessTokensList(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	user := &empire.User{Name: "ejholmes", GitHubToken: "token"}
+
+	deploy, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: []string{empire.ScopeDeploysWrite}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: []string{empire.ScopeAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := e.AccessTokensList(empire.WithAccessToken(ctx, admin), empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(tokens), 2; got != want {
+		t.Fatalf("AccessTokensList => %d tokens; want %d", got, want)
+	}
+
+	for _, token := range tokens {
+		if token.Token != "" {
+			t.Fatalf("Expected the raw token of %s to be absent", token.ID)
+		}
+
+		if token.User.Name != user.Name {
+			t.Fatalf("User => %s; want %s", token.User.Name, user.Name)
+		}
+
+		if token.CreatedAt == nil {
+			t.Fatal("Expected CreatedAt to be set")
+		}
+
+		if token.LastUsedAt != nil {
+			t.Fatal("Expected LastUsedAt to not be set")
+		}
+	}
+
+	// Tokens without the admin scope can't list tokens.
+	if _, err := e.AccessTokensList(empire.WithAccessToken(ctx, deploy), empire.Page{}); err != empire.ErrInsufficientScope {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInsufficientScope)
+	}
+}
+
+func TestAccessTokensFind_LastUsedAt(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	user := &empire.User{Name: "ejholmes", GitHubToken: "token"}
+
+	admin, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: []string{empire.ScopeAdmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: empire.AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastUsedAt := func() *time.Time {
+		tokens, err := e.AccessTokensList(empire.WithAccessToken(context.Background(), admin), empire.Page{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, at := range tokens {
+			if at.ID == token.ID {
+				return at.LastUsedAt
+			}
+		}
+
+		t.Fatalf("Expected %s to be listed", token.ID)
+		return nil
+	}
+
+	timexNow := timex.Now
+	defer func() { timex.Now = timexNow }()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	find := func(at time.Time) {
+		timex.Now = func() time.Time { return at }
+		if _, err := e.AccessTokensFind(token.Token); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find(now)
+
+	if got := lastUsedAt(); got == nil || !got.Equal(now) {
+		t.Fatalf("LastUsedAt => %v; want %v", got, now)
+	}
+
+	// Using the token again shortly after doesn't update the record.
+	find(now.Add(30 * time.Second))
+
+	if got := lastUsedAt(); got == nil || !got.Equal(now) {
+		t.Fatalf("LastUsedAt => %v; want %v", got, now)
+	}
+
+	find(now.Add(2 * time.Minute))
+
+	if got, want := lastUsedAt(), now.Add(2*time.Minute); got == nil || !got.Equal(want) {
+		t.Fatalf("LastUsedAt => %v; want %v", got, want)
+	}
+}
+
+func TestAccessTokensList_ExpiresAt(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	user := &empire.User{Name: "ejholmes", GitHubToken: "token"}
+
+	expiresAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	admin, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: []string{empire.ScopeAdmin}, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := e.AccessTokensList(empire.WithAccessToken(context.Background(), admin), empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(tokens), 1; got != want {
+		t.Fatalf("AccessTokensList => %d tokens; want %d", got, want)
+	}
+
+	if got := tokens[0].ExpiresAt; got == nil || !got.Equal(expiresAt) {
+		t.Fatalf("ExpiresAt => %v; want %v", got, expiresAt)
+	}
+
+	// Listing tokens requires an access token.
+	if _, err := e.AccessTokensList(context.Background(), empire.Page{}); err != empire.ErrInsufficientScope {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInsufficientScope)
+	}
+}
+
+func TestAccessTokensFind_Invalid(t *testing.T) {
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Secret = "secret"
+	})
+	user := &empire.User{Name: "ejholmes", GitHubToken: "token"}
+
+	token, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: empire.AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A recorded id, with a signature from another secret.
+	forged, err := empire.SignToken([]byte("other"), &empire.AccessToken{ID: token.ID, User: user, Scopes: empire.AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Correctly signed, but never recorded.
+	unknown, err := empire.SignToken([]byte("secret"), &empire.AccessToken{ID: "c9366591-ab68-4d49-a333-95ce5a23df68", User: user, Scopes: empire.AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Correctly signed, with an id that isn't a uuid.
+	malformed, err := empire.SignToken([]byte("secret"), &empire.AccessToken{ID: "1234", User: user, Scopes: empire.AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []string{forged, unknown, malformed} {
+		at, err := e.AccessTokensFind(tt)
+		if err != empire.ErrTokenInvalid {
+			t.Fatalf("err => %v; want %v", err, empire.ErrTokenInvalid)
+		}
+
+		if at != nil {
+			t.Fatal("Expected access token to be nil")
+		}
+	}
+}
+
+func TestAccessTokensFind_SecondarySecret(t *testing.T) {
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Secret = "new"
+		o.SecondarySecrets = []string{"old"}
+	})
+	user := &empire.User{Name: "ejholmes", GitHubToken: "token"}
+
+	token, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: empire.AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same token, signed with the secret that's being rotated out.
+	old, err := empire.SignToken([]byte("old"), &empire.AccessToken{ID: token.ID, User: user, Scopes: empire.AllScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at, err := e.AccessTokensFind(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if at.Token == old {
+		t.Fatal("Expected the token to be re-signed")
+	}
+
+	if _, err := empire.ParseToken([]byte("new"), at.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := storedSecretHash(t, token.ID), secretHash("new", token.ID); got != want {
+		t.Fatalf("stored secret hash => %q; want %q", got, want)
+	}
+}
+
+func TestAccessTokensMigrateToNewSecret(t *testing.T) {
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Secret = "old"
+	})
+	user := &empire.User{Name: "ejholmes", GitHubToken: "token"}
+
+	var tokens []*empire.AccessToken
+	for i := 0; i < 2; i++ {
+		token, err := e.AccessTokensCreate(&empire.AccessToken{User: user, Scopes: empire.AllScopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	n, err := e.AccessTokensMigrateToNewSecret([]byte("old"), []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := n, len(tokens); got != want {
+		t.Fatalf("AccessTokensMigrateToNewSecret => %d; want %d", got, want)
+	}
+
+	for _, token := range tokens {
+		if got, want := storedSecretHash(t, token.ID), secretHash("new", token.ID); got != want {
+			t.Fatalf("stored secret hash => %q; want %q", got, want)
+		}
+	}
+
+	// Tokens are no longer signed with the old secret.
+	n, err = e.AccessTokensMigrateToNewSecret([]byte("old"), []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 {
+		t.Fatalf("AccessTokensMigrateToNewSecret => %d; want 0", n)
+	}
+}
+
+// storedSecretHash returns the hash of the secret that's stored in the record
+// of the token with the given id.
+func storedSecretHash(t testing.TB, id string) string {
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var hash string
+	if err := db.QueryRow(`SELECT secret_hash FROM access_tokens WHERE id = $1`, id).Scan(&hash); err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
+// secretHash returns the hash that identifies the secret that the token with
+// the given id was signed with.
+func secretHash(secret, id string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))
+}
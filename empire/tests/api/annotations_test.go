@@ -0,0 +1,124 @@
+package api_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+)
+
+func TestAppsAnnotate(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	apps := make(map[string]*empire.App)
+	for _, name := range []string{"acme-inc", "acme-api", "acme-web"} {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps[name] = app
+	}
+
+	annotate := func(app, key, value string) {
+		if err := e.AppsAnnotate(apps[app], key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	annotate("acme-inc", "owner_email", "bob@example.com")
+	annotate("acme-inc", "owner_email", "alice@example.com")
+	annotate("acme-inc", "cost_center", "platform")
+	annotate("acme-api", "owner_email", "bob@example.com")
+
+	annotations, err := e.AppsAnnotations(apps["acme-inc"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]string{"owner_email": "alice@example.com", "cost_center": "platform"}; !reflect.DeepEqual(annotations, want) {
+		t.Fatalf("Annotations => %v; want %v", annotations, want)
+	}
+
+	found := func(q empire.AppsQuery) []string {
+		q.SortField = empire.AppsSortName
+		apps, err := e.Apps(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, app := range apps {
+			names = append(names, app.Name)
+		}
+		return names
+	}
+
+	if got, want := found(empire.AppsQuery{AnnotationKey: "owner_email", AnnotationValue: "alice@example.com"}), []string{"acme-inc"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+
+	if got, want := found(empire.AppsQuery{AnnotationKey: "owner_email"}), []string{"acme-api", "acme-inc"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+
+	if got := found(empire.AppsQuery{AnnotationKey: "on_call_rotation"}); len(got) != 0 {
+		t.Fatalf("Apps => %v; want none", got)
+	}
+
+	if err := e.AppsAnnotate(apps["acme-web"], "", "value"); err != empire.ErrInvalidAnnotationKey {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInvalidAnnotationKey)
+	}
+}
+
+func TestAppsDiscoverByLabel(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	labels := map[string]string{
+		"acme-inc": "platform",
+		"acme-api": "platform-api",
+		"acme-web": "web",
+	}
+	for name, team := range labels {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := e.AppsAnnotate(app, "team", team); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := e.AppsCreate(&empire.App{Name: "acme-jobs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(apps []*empire.App, err error) []string {
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, app := range apps {
+			names = append(names, app.Name)
+		}
+		return names
+	}
+
+	if got, want := names(e.AppsDiscoverByLabelPrefix("team")), []string{"acme-api", "acme-inc", "acme-web"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+
+	if got, want := names(e.AppsDiscoverByLabel("team", "platform")), []string{"acme-inc"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+
+	if got := names(e.AppsDiscoverByLabel("team", "data")); len(got) != 0 {
+		t.Fatalf("Apps => %v; want none", got)
+	}
+
+	if _, err := e.AppsDiscoverByLabelPrefix(""); err != empire.ErrInvalidAnnotationKey {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInvalidAnnotationKey)
+	}
+}
@@ -28,7 +28,8 @@ func NewTestClient(t testing.TB) (*heroku.Client, *httptest.Server) {
 	s := empiretest.NewServer(t, e)
 
 	token, err := e.AccessTokensCreate(&empire.AccessToken{
-		User: &empire.User{Name: "fake", GitHubToken: "token"},
+		User:   &empire.User{Name: "fake", GitHubToken: "token"},
+		Scopes: empire.AllScopes,
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -1,10 +1,17 @@
 package api_test
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/bgentry/heroku-go"
+	"github.com/jinzhu/gorm"
 	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
 )
 
 func TestAppCreate(t *testing.T) {
@@ -111,3 +118,442 @@ func mustAppDelete(t testing.TB, c *heroku.Client, appName string) {
 		t.Fatal(err)
 	}
 }
+
+func TestAppsSort(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	for _, name := range []string{"bravo", "charlie", "alpha"} {
+		if _, err := e.AppsCreate(&empire.App{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		q     empire.AppsQuery
+		names []string
+	}{
+		{empire.AppsQuery{}, []string{"alpha", "bravo", "charlie"}},
+		{empire.AppsQuery{SortField: empire.AppsSortName, SortOrder: empire.AppsSortDesc}, []string{"charlie", "bravo", "alpha"}},
+		{empire.AppsQuery{SortField: empire.AppsSortCreatedAt}, []string{"bravo", "charlie", "alpha"}},
+		{empire.AppsQuery{SortField: empire.AppsSortCreatedAt, SortOrder: empire.AppsSortDesc}, []string{"alpha", "charlie", "bravo"}},
+	}
+
+	for i, tt := range tests {
+		apps, err := e.Apps(tt.q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, a := range apps {
+			names = append(names, a.Name)
+		}
+
+		if got, want := names, tt.names; !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%d: Apps => %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestAppsCreateWithConfig(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	env := "production"
+	app, config, err := e.AppsCreateWithConfig(ctx, &empire.App{Name: "acme-inc"}, empire.Vars{
+		"RAILS_ENV": &env,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := e.AppsFirst(empire.AppsQuery{Name: &app.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := found.ID, app.ID; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	current, err := e.ConfigsCurrent(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := current.ID, config.ID; got != want {
+		t.Fatalf("Config ID => %s; want %s", got, want)
+	}
+
+	if got, want := current.Vars, config.Vars; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Vars => %v; want %v", got, want)
+	}
+}
+
+func TestAppsCreateWithConfig_EmptyVars(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	app, config, err := e.AppsCreateWithConfig(context.Background(), &empire.App{Name: "acme-inc"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config != nil {
+		t.Fatal("Expected no config to be created")
+	}
+
+	if _, err := e.ConfigsFindByVersion(app, 1); err != gorm.RecordNotFound {
+		t.Fatalf("err => %v; want %v", err, gorm.RecordNotFound)
+	}
+}
+
+func TestAppsCreateWithConfig_Rollback(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	// Postgres rejects null bytes in text, so creating the config fails.
+	invalid := "foo\x00bar"
+	if _, _, err := e.AppsCreateWithConfig(context.Background(), &empire.App{Name: "acme-inc"}, empire.Vars{
+		"INVALID": &invalid,
+	}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	name := "acme-inc"
+	if _, err := e.AppsFirst(empire.AppsQuery{Name: &name}); err != gorm.RecordNotFound {
+		t.Fatalf("err => %v; want %v", err, gorm.RecordNotFound)
+	}
+}
+
+func TestAppsSetDrainTimeout(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := app.DrainTimeoutSeconds, empire.DefaultDrainTimeout; got != want {
+		t.Fatalf("DrainTimeoutSeconds => %d; want %d", got, want)
+	}
+
+	err = e.AppsSetDrainTimeout(app, 3601)
+	if _, ok := err.(*empire.ValidationError); !ok {
+		t.Fatalf("err => %v; want a ValidationError", err)
+	}
+
+	tests := []struct {
+		seconds int
+		want    int
+	}{
+		{120, 120},
+		{0, empire.DefaultDrainTimeout},
+	}
+
+	for _, tt := range tests {
+		if err := e.AppsSetDrainTimeout(app, tt.seconds); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := e.AppsFirst(empire.AppsQuery{Name: &app.Name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := found.DrainTimeoutSeconds; got != tt.want {
+			t.Fatalf("AppsSetDrainTimeout(%d) => %d; want %d", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestAppsDestroy_Strict(t *testing.T) {
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.StrictDestroy = true
+	})
+	ctx := context.Background()
+
+	// A fresh app without any resources isn't blocked.
+	fresh, err := e.AppsCreate(&empire.App{Name: "fresh"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.AppsDestroy(ctx, fresh); err != nil {
+		t.Fatal(err)
+	}
+
+	// An app with running processes is.
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = e.AppsDestroy(ctx, r.App)
+	if !empire.IsAppsDestroyConflict(err) {
+		t.Fatalf("err => %v; want ErrAppsDestroyConflict", err)
+	}
+
+	if _, err := e.AppsFirst(empire.AppsQuery{Name: &r.App.Name}); err != nil {
+		t.Fatalf("err => %v; want the app to still exist", err)
+	}
+
+	// Unless the destroy is forced.
+	if err := e.AppsDestroyForce(ctx, r.App); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AppsFirst(empire.AppsQuery{Name: &r.App.Name}); err != gorm.RecordNotFound {
+		t.Fatalf("err => %v; want the app to be destroyed", err)
+	}
+}
+
+func TestMigrateApps(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	from, to := service.NewFakeManager(), service.NewFakeManager()
+
+	if _, err := e.AppsCreate(&empire.App{Name: "no-releases"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan empire.Event)
+	go func() {
+		for range out {
+		}
+	}()
+	r, err := e.DeployImage(ctx, empire.Image{Repo: "remind101/acme-inc", ID: strings.TrimPrefix(DefaultImage, "remind101/acme-inc:")}, out)
+	close(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := e.MigrateApps(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := report.Succeeded, []string{r.App.Name}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Succeeded => %v; want %v", got, want)
+	}
+
+	if got, want := report.Skipped, []string{"no-releases"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Skipped => %v; want %v", got, want)
+	}
+
+	instances, err := to.Instances(ctx, r.App.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) == 0 {
+		t.Fatal("Expected the app to be running on the new scheduler")
+	}
+
+	// The web process keeps the port for its load balancer.
+	for _, i := range instances {
+		if i.Process.Type == "web" && len(i.Process.Ports) == 0 {
+			t.Fatal("Expected the web process to have a port on the new scheduler")
+		}
+	}
+}
+
+func TestAppsAllBySlug(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// release releases the slug that was deployed to acme-inc to the app.
+	release := func(app *empire.App) {
+		config, err := e.ConfigsCurrent(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		draft, err := e.ReleasesCreateDraft(ctx, app, config, r1.Slug, "Deploy shared image")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := e.ReleasesActivate(ctx, draft, "ops@example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	api, err := e.AppsCreate(&empire.App{Name: "acme-api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(api)
+
+	// Releasing the slug to acme-inc again shouldn't return it twice.
+	release(r1.App)
+
+	r3, err := e.ReleasesCreateFromImage(ctx, "acme-jobs", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r3.Slug.ID == r1.Slug.ID {
+		t.Fatal("Expected acme-jobs to be deployed with a different slug")
+	}
+
+	apps, err := e.AppsAllBySlug(r1.Slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, app := range apps {
+		names = append(names, app.Name)
+	}
+
+	if got, want := names, []string{"acme-api", "acme-inc"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+}
+
+func TestAppsAllCursor(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	create := func(name string) {
+		if _, err := e.AppsCreate(&empire.App{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		create(fmt.Sprintf("acme-%02d", i))
+	}
+
+	names := func(apps []*empire.App) []string {
+		var n []string
+		for _, app := range apps {
+			n = append(n, app.Name)
+		}
+		return n
+	}
+
+	page1, cursor, err := e.AppsAllCursor("", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := names(page1), []string{"acme-00", "acme-01", "acme-02", "acme-03"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Page 1 => %v; want %v", got, want)
+	}
+
+	if cursor == "" {
+		t.Fatal("Expected a cursor for the next page")
+	}
+
+	// Sorts into the second page.
+	create("acme-04a")
+
+	page2, _, err := e.AppsAllCursor(cursor, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := names(page2), []string{"acme-04", "acme-04a", "acme-05", "acme-06"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Page 2 => %v; want %v", got, want)
+	}
+
+	var all []*empire.App
+	for cursor = ""; ; {
+		var page []*empire.App
+		page, cursor, err = e.AppsAllCursor(cursor, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, page...)
+		if cursor == "" {
+			break
+		}
+	}
+
+	if got, want := len(all), 11; got != want {
+		t.Fatalf("len(apps) => %d; want %d", got, want)
+	}
+
+	if _, _, err := e.AppsAllCursor("acme-inc", 4); err != empire.ErrInvalidCursor {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInvalidCursor)
+	}
+}
+
+func TestAppsAllWithLastRelease(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"acme-api", "acme-inc"} {
+		if _, err := e.ReleasesCreateFromImage(ctx, name, DefaultImage, empire.DeployOptions{
+			CreateAppIfMissing: true,
+			Description:        "Deploy " + name,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// acme-inc is released again.
+	production := "production"
+	name := "acme-inc"
+	inc, err := e.AppsFirst(empire.AppsQuery{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.ConfigsApply(ctx, inc, empire.Vars{"RAILS_ENV": &production}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AppsCreate(&empire.App{Name: "acme-jobs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	apps, err := e.AppsAllWithLastRelease(empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		Name    string
+		Version int
+	}
+
+	var got []result
+	for _, app := range apps {
+		r := result{Name: app.Name}
+		if app.LastRelease != nil {
+			r.Version = app.LastRelease.Version
+		}
+		got = append(got, r)
+	}
+
+	want := []result{{"acme-api", 1}, {"acme-inc", 2}, {"acme-jobs", 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+
+	if apps[2].LastRelease != nil {
+		t.Fatalf("LastRelease => %v; want nil", apps[2].LastRelease)
+	}
+
+	if got, want := apps[0].LastRelease.Description, "Deploy acme-api"; got != want {
+		t.Fatalf("Description => %s; want %s", got, want)
+	}
+
+	page, err := e.AppsAllWithLastRelease(empire.Page{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(page) != 1 || page[0].Name != "acme-inc" {
+		t.Fatalf("Page => %v; want acme-inc", page)
+	}
+}
@@ -0,0 +1,104 @@
+package api_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestBackupRestore(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	opts := empire.DeployOptions{CreateAppIfMissing: true}
+	for _, name := range []string{"acme-inc", "acme-api"} {
+		if _, err := e.ReleasesCreateFromImage(ctx, name, DefaultImage, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	name := "acme-inc"
+	app, err := e.AppsFirst(empire.AppsQuery{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := "production"
+	if _, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &env}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := countRecords(t, e)
+
+	buf := new(bytes.Buffer)
+	if err := e.Backup(ctx, buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	if err := e.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := e.Restore(ctx, bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Conflicts) != 0 {
+		t.Fatalf("Conflicts => %v; want none", report.Conflicts)
+	}
+
+	if got, want := report.Restored["apps.json"], 2; got != want {
+		t.Fatalf("Restored apps => %d; want %d", got, want)
+	}
+
+	if got := countRecords(t, e); got != before {
+		t.Fatalf("counts => %v; want %v", got, before)
+	}
+
+	// Restoring again conflicts with every record.
+	report, err = e.Restore(ctx, bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(report.Restored); got != 0 {
+		t.Fatalf("Restored => %v; want none", report.Restored)
+	}
+
+	if len(report.Conflicts) == 0 {
+		t.Fatal("expected conflicts")
+	}
+}
+
+type recordCounts struct {
+	Apps, Releases, Configs int
+}
+
+func countRecords(t testing.TB, e *empire.Empire) recordCounts {
+	apps, err := e.Apps(empire.AppsQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := recordCounts{Apps: len(apps)}
+	for _, app := range apps {
+		releases, err := e.ReleasesFindByApp(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts.Releases += len(releases)
+
+		config, err := e.ConfigsCurrent(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts.Configs += config.Version
+	}
+
+	return counts
+}
@@ -0,0 +1,67 @@
+package api_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestDeployCanary(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+
+	image := empire.Image{
+		Repo: "remind101/acme-inc",
+		ID:   strings.TrimPrefix(DefaultImage, "remind101/acme-inc:"),
+	}
+
+	canary, err := e.DeployCanary(ctx, image, empire.CanaryOptions{Weight: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := canary.Status, empire.ReleaseStatusCanary; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	// The canary isn't the current release until it's promoted, so scaling
+	// applies to the previous release.
+	if _, err := e.ProcessesScale(ctx, app, map[string]int{"web": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := e.ReleasesLast(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := current.Version, r1.Version; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if err := e.PromoteCanary(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err = e.ReleasesLast(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := current.ID, canary.ID; got != want {
+		t.Fatalf("ID => %s; want %s", got, want)
+	}
+
+	if got, want := current.Formation()["web"].Quantity, 2; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/client"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestEmbeddedClient_AppsAll(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	if _, err := e.AppsCreate(&empire.App{Name: "acme-inc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := client.NewEmbedded(e)
+
+	apps, err := c.AppsAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := e.Apps(empire.AppsQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(apps), len(want); got != want {
+		t.Fatalf("AppsAll => %d apps; want %d", got, want)
+	}
+
+	if got, want := apps[0].Name, "acme-inc"; got != want {
+		t.Fatalf("Name => %s; want %s", got, want)
+	}
+}
+
+func TestRemoteClient_AppsAll(t *testing.T) {
+	hc, s := NewTestClient(t)
+	defer s.Close()
+
+	mustAppCreate(t, hc, empire.App{Name: "acme-inc"})
+
+	c := client.NewRemote(s.URL, hc.Password)
+
+	apps, err := c.AppsAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(apps), 1; got != want {
+		t.Fatalf("AppsAll => %d apps; want %d", got, want)
+	}
+
+	if got, want := apps[0].Name, "acme-inc"; got != want {
+		t.Fatalf("Name => %s; want %s", got, want)
+	}
+}
@@ -2,10 +2,15 @@ package api_test
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bgentry/heroku-go"
 	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
 )
 
 func TestConfigVarUpdate(t *testing.T) {
@@ -95,3 +100,1068 @@ func mustConfigVarInfo(t testing.TB, c *heroku.Client, appName string) map[strin
 
 	return vars
 }
+
+func TestConfigsCopyFromApp(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	src, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := e.AppsCreate(&empire.App{Name: "acme-inc-staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		env    = "production"
+		secret = "secret"
+	)
+
+	if _, err := e.ConfigsApply(ctx, src, empire.Vars{
+		"RAILS_ENV":  &env,
+		"SECRET_KEY": &secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := e.ConfigsCopyFromApp(ctx, src, dst, []string{"SECRET_KEY"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Vars["SECRET_KEY"]; ok {
+		t.Fatal("Expected SECRET_KEY to be excluded")
+	}
+
+	if got, want := *c.Vars["RAILS_ENV"], env; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+
+	sc, err := e.ConfigsCurrent(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(sc.Vars), 2; got != want {
+		t.Fatalf("len(source vars) => %d; want %d", got, want)
+	}
+}
+
+func TestConfigsCopyFromApp_AppNotFound(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	src, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := &empire.App{ID: "c9366591-ab68-4d49-a333-95ce5a23df68", Name: "missing"}
+
+	if _, err := e.ConfigsCopyFromApp(context.Background(), src, dst, nil); err != empire.ErrAppNotFound {
+		t.Fatalf("err => %v; want %v", err, empire.ErrAppNotFound)
+	}
+}
+
+func TestConfigsFreeze(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		production = "production"
+		staging    = "staging"
+	)
+
+	frozen, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &production})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.ConfigsFreeze(frozen.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &staging})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ID == frozen.ID {
+		t.Fatal("Expected a new config to be created")
+	}
+
+	if c.Frozen {
+		t.Fatal("Expected the new config to not be frozen")
+	}
+
+	old, err := e.ConfigsFindByVersion(app, frozen.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !old.Frozen {
+		t.Fatal("Expected the old config to still be frozen")
+	}
+
+	if got, want := *old.Vars["RAILS_ENV"], production; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+
+	if err := e.ConfigsUnfreeze(frozen.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	old, err = e.ConfigsFindByVersion(app, frozen.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if old.Frozen {
+		t.Fatal("Expected the old config to be unfrozen")
+	}
+}
+
+func TestConfigsFindByVersion(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := []string{"development", "staging", "production"}
+
+	var configs []*empire.Config
+	for i := range values {
+		c, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &values[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs = append(configs, c)
+	}
+
+	for i, c := range configs {
+		if i > 0 && c.Version <= configs[i-1].Version {
+			t.Fatalf("#%d: Version => %d; want greater than %d", i, c.Version, configs[i-1].Version)
+		}
+
+		found, err := e.ConfigsFindByVersion(app, c.Version)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := found.ID, c.ID; got != want {
+			t.Fatalf("#%d: ID => %s; want %s", i, got, want)
+		}
+
+		if got, want := *found.Vars["RAILS_ENV"], values[i]; got != want {
+			t.Fatalf("#%d: RAILS_ENV => %s; want %s", i, got, want)
+		}
+	}
+
+	// The current config is the one with the highest version.
+	current, err := e.ConfigsCurrent(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := current.Version, configs[2].Version; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+}
+
+func TestConfigsApplyOrdered(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		host = "localhost"
+		url  = "postgres://$DB_HOST/acme"
+		env  = "production"
+	)
+
+	c, err := e.ConfigsApplyOrdered(ctx, app, empire.Vars{
+		"DATABASE_URL": &url,
+		"DB_HOST":      &host,
+	}, []string{"DB_HOST", "DATABASE_URL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := c.VarOrder, (empire.VarOrder{"DB_HOST", "DATABASE_URL"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("VarOrder => %v; want %v", got, want)
+	}
+
+	// An empty order behaves like ConfigsApply, keeping the current order.
+	c, err = e.ConfigsApplyOrdered(ctx, app, empire.Vars{"RAILS_ENV": &env}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = e.ConfigsFindByVersion(app, c.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := c.VarOrder, (empire.VarOrder{"DB_HOST", "DATABASE_URL"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("VarOrder => %v; want %v", got, want)
+	}
+
+	if got, want := len(c.Vars), 3; got != want {
+		t.Fatalf("Vars => %d; want %d", got, want)
+	}
+}
+
+func TestConfigsApplyWithHistory(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := e.ConfigsApplyWithHistory(ctx, app, []empire.KeyValueChange{
+		{Key: "RAILS_ENV", Value: "production", ChangeType: empire.ChangeTypeSet},
+		{Key: "LOG_LEVEL", Value: "info", ChangeType: empire.ChangeTypeSet},
+		{Key: "RAILS_ENV", ChangeType: empire.ChangeTypeUnset},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(configs), 3; got != want {
+		t.Fatalf("len(configs) => %d; want %d", got, want)
+	}
+
+	if _, ok := configs[1].Vars["RAILS_ENV"]; !ok {
+		t.Fatal("expected the second config to have RAILS_ENV")
+	}
+
+	current, err := e.ConfigsCurrent(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := current.Version, configs[2].Version; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if _, ok := current.Vars["RAILS_ENV"]; ok {
+		t.Fatal("expected RAILS_ENV to be unset")
+	}
+}
+
+func TestConfigsApplyWithHistory_Failure(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := e.ConfigsCurrent(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := e.ConfigsApplyWithHistory(ctx, app, []empire.KeyValueChange{
+		{Key: "RAILS_ENV", Value: "production", ChangeType: empire.ChangeTypeSet},
+		{Key: "LOG_LEVEL", Value: "info", ChangeType: "append"},
+		{Key: "WORKERS", Value: "4", ChangeType: empire.ChangeTypeSet},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if !strings.Contains(err.Error(), "LOG_LEVEL") {
+		t.Fatalf("err => %v; want it to reference LOG_LEVEL", err)
+	}
+
+	if got, want := len(configs), 1; got != want {
+		t.Fatalf("len(configs) => %d; want %d", got, want)
+	}
+
+	after, err := e.ConfigsCurrent(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := after.Version, before.Version; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+}
+
+func TestConfigsDriftReport(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		production = "production"
+		staging    = "staging"
+		url        = "postgres://localhost"
+		info       = "info"
+	)
+
+	if _, err := e.ConfigsApply(ctx, app, empire.Vars{
+		"RAILS_ENV":    &staging,
+		"DATABASE_URL": &url,
+		"LOG_LEVEL":    &info,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := e.ConfigsDriftReport(app, empire.Vars{
+		"RAILS_ENV":    &production,
+		"DATABASE_URL": &url,
+		"WORKERS":      &info,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := func(changes []empire.ConfigChange) []empire.Variable {
+		var vars []empire.Variable
+		for _, c := range changes {
+			vars = append(vars, c.Variable)
+		}
+		return vars
+	}
+
+	if got, want := variables(report.Missing), []empire.Variable{"WORKERS"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Missing => %v; want %v", got, want)
+	}
+
+	if got, want := variables(report.Extra), []empire.Variable{"LOG_LEVEL"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Extra => %v; want %v", got, want)
+	}
+
+	if *report.Extra[0].Actual == info {
+		t.Fatal("expected the extra value to be masked")
+	}
+
+	if got, want := variables(report.Changed), []empire.Variable{"RAILS_ENV"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Changed => %v; want %v", got, want)
+	}
+}
+
+func TestConfigsDiffByID(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		production = "production"
+		staging    = "staging"
+		secret     = "ssm://acme-inc/secret_key"
+	)
+
+	from, err := e.ConfigsApply(ctx, app, empire.Vars{
+		"RAILS_ENV": &staging,
+		"WORKERS":   &staging,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := e.ConfigsApply(ctx, app, empire.Vars{
+		"RAILS_ENV":  &production,
+		"WORKERS":    nil,
+		"SECRET_KEY": &secret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := e.ConfigsDiffByID(from.ID, from.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %d", len(changes))
+	}
+
+	changes, err = e.ConfigsDiffByID(from.ID, to.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type change struct {
+		Variable empire.Variable
+		Old, New string
+	}
+
+	var got []change
+	for _, c := range changes {
+		ch := change{Variable: c.Variable}
+		if c.Old != nil {
+			ch.Old = *c.Old
+		}
+		if c.New != nil {
+			ch.New = *c.New
+		}
+		got = append(got, ch)
+	}
+
+	// Values are masked, except for references to secrets.
+	want := []change{
+		{"RAILS_ENV", "********", "********"},
+		{"SECRET_KEY", "", secret},
+		{"WORKERS", "********", ""},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ConfigsDiffByID => %v; want %v", got, want)
+	}
+
+	if _, err := e.ConfigsDiffByID(from.ID, "00000000-0000-0000-0000-000000000000"); err != empire.ErrConfigNotFound {
+		t.Fatalf("err => %v; want %v", err, empire.ErrConfigNotFound)
+	}
+}
+
+func TestConfigsApplyAtomic(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"acme-inc", "acme-api"} {
+		if _, err := e.AppsCreate(&empire.App{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		production = "production"
+		staging    = "staging"
+	)
+
+	configs, err := e.ConfigsApplyAtomic(ctx, map[string]empire.Vars{
+		"acme-inc": {"RAILS_ENV": &production},
+		"acme-api": {"RAILS_ENV": &staging},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(configs), 2; got != want {
+		t.Fatalf("Configs => %d; want %d", got, want)
+	}
+
+	if got, want := *configs["acme-inc"].Vars["RAILS_ENV"], production; got != want {
+		t.Fatalf("acme-inc RAILS_ENV => %s; want %s", got, want)
+	}
+
+	if got, want := *configs["acme-api"].Vars["RAILS_ENV"], staging; got != want {
+		t.Fatalf("acme-api RAILS_ENV => %s; want %s", got, want)
+	}
+
+	// If any app doesn't exist, nothing should be applied.
+	_, err = e.ConfigsApplyAtomic(ctx, map[string]empire.Vars{
+		"acme-inc":  {"RAILS_ENV": &staging},
+		"acme-jobs": {"RAILS_ENV": &staging},
+	})
+	bulkErr, ok := err.(*empire.BulkApplyError)
+	if !ok {
+		t.Fatalf("err => %v; want a BulkApplyError", err)
+	}
+
+	if got, want := bulkErr.Errors, map[string]error{"acme-jobs": empire.ErrAppNotFound}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Errors => %v; want %v", got, want)
+	}
+
+	name := "acme-inc"
+	app, err := e.AppsFirst(empire.AppsQuery{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := e.ConfigsCurrent(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := config.Version, configs["acme-inc"].Version; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if got, want := *config.Vars["RAILS_ENV"], production; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+}
+
+func TestConfigsApplyAtomic_ValidationFailed(t *testing.T) {
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.MaxConfigValueBytes = 16
+	})
+	ctx := context.Background()
+
+	production := "production"
+
+	apps := make(map[string]*empire.App)
+	for _, name := range []string{"acme-api", "acme-inc", "acme-jobs"} {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &production}); err != nil {
+			t.Fatal(err)
+		}
+
+		apps[name] = app
+	}
+
+	before := make(map[string]*empire.Config)
+	for name, app := range apps {
+		config, err := e.ConfigsCurrent(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[name] = config
+	}
+
+	// Apps are applied in order of their name, so acme-api has already been
+	// applied when the vars for acme-inc fail validation.
+	var (
+		staging = "staging"
+		large   = "a value that's too large"
+	)
+	_, err := e.ConfigsApplyAtomic(ctx, map[string]empire.Vars{
+		"acme-api":  {"RAILS_ENV": &staging},
+		"acme-inc":  {"RAILS_ENV": &staging, "LARGE": &large},
+		"acme-jobs": {"RAILS_ENV": &staging},
+	})
+	bulkErr, ok := err.(*empire.BulkApplyError)
+	if !ok {
+		t.Fatalf("err => %v; want a BulkApplyError", err)
+	}
+
+	if _, ok := bulkErr.Errors["acme-inc"].(*empire.ValidationError); !ok {
+		t.Fatalf("acme-inc err => %v; want a ValidationError", bulkErr.Errors["acme-inc"])
+	}
+
+	if got, want := len(bulkErr.Errors), 1; got != want {
+		t.Fatalf("Errors => %v; want %d error", bulkErr.Errors, want)
+	}
+
+	// None of the changes, including those to acme-api, were applied.
+	for name, app := range apps {
+		config, err := e.ConfigsCurrent(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := config.Version, before[name].Version; got != want {
+			t.Fatalf("%s Version => %d; want %d", name, got, want)
+		}
+
+		if got, want := *config.Vars["RAILS_ENV"], production; got != want {
+			t.Fatalf("%s RAILS_ENV => %s; want %s", name, got, want)
+		}
+	}
+}
+
+func TestConfigsHistory(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"1", "2", "3", "4"} {
+		v := v
+		if _, err := e.ConfigsApply(ctx, app, empire.Vars{"WORKERS": &v}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		page empire.Page
+		want []string
+	}{
+		{empire.Page{Limit: 2, Offset: 0}, []string{"4", "3"}},
+		{empire.Page{Limit: 2, Offset: 2}, []string{"2", "1"}},
+	}
+
+	for _, tt := range tests {
+		configs, err := e.ConfigsHistory(app, tt.page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, c := range configs {
+			got = append(got, *c.Vars["WORKERS"])
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ConfigsHistory(%+v) => %v; want %v", tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestConfigsKeySetTTL(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		production  = "production"
+		maintenance = "true"
+	)
+
+	if _, err := e.ConfigsApply(ctx, app, empire.Vars{
+		"RAILS_ENV":   &production,
+		"MAINTENANCE": &maintenance,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.ConfigsKeySetTTL(app, "MAINTENANCE", 0); err != empire.ErrInvalidConfigKeyTTL {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInvalidConfigKeyTTL)
+	}
+
+	if err := e.ConfigsKeySetTTL(app, "MAINTENANCE", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	current := func() *empire.Config {
+		c, err := e.ConfigsCurrent(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Nothing has expired yet.
+	if err := e.ConfigKeysExpire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := current().Vars["MAINTENANCE"]; !ok {
+		t.Fatal("Expected MAINTENANCE to be set before it expires")
+	}
+
+	now := timex.Now
+	timex.Now = func() time.Time {
+		return now().Add(61 * time.Minute)
+	}
+	defer func() { timex.Now = now }()
+
+	if err := e.ConfigKeysExpire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c := current()
+	if _, ok := c.Vars["MAINTENANCE"]; ok {
+		t.Fatal("Expected MAINTENANCE to be unset after it expired")
+	}
+
+	if got, want := *c.Vars["RAILS_ENV"], production; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+
+	// The key has already been unset, so a new config shouldn't be created.
+	if err := e.ConfigKeysExpire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := current().Version, c.Version; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+}
+
+func TestConfigKeysExpire_HiddenApp(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	maintenance := "true"
+
+	var apps []*empire.App
+	for _, name := range []string{"acme-inc", "acme-api"} {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := e.ConfigsApply(ctx, app, empire.Vars{"MAINTENANCE": &maintenance}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := e.ConfigsKeySetTTL(app, "MAINTENANCE", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+
+		apps = append(apps, app)
+	}
+
+	// The first app is hidden until it's destroyed.
+	pending, err := e.AppsDestroyScheduled(ctx, apps[0], time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := timex.Now
+	timex.Now = func() time.Time {
+		return now().Add(61 * time.Minute)
+	}
+	defer func() { timex.Now = now }()
+
+	if err := e.ConfigKeysExpire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys of the hidden app are unset too, so they stay unset if the
+	// destroy is cancelled.
+	if err := e.AppsDestroyCancelScheduled(ctx, pending.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, app := range apps {
+		c, err := e.ConfigsCurrent(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := c.Vars["MAINTENANCE"]; ok {
+			t.Fatalf("%s: Expected MAINTENANCE to be unset after it expired", app.Name)
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	existing, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		info       = "info"
+		production = "production"
+	)
+
+	defaults := empire.Vars{
+		"LOG_LEVEL": &info,
+		"RAILS_ENV": &production,
+	}
+	if err := e.ConfigDefaultsSet(defaults); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := e.ConfigDefaultsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, defaults) {
+		t.Fatalf("Defaults => %v; want %v", got, defaults)
+	}
+
+	vars := func(app *empire.App) map[string]string {
+		c, err := e.ConfigsCurrent(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		m := make(map[string]string)
+		for k, v := range c.Vars {
+			m[string(k)] = *v
+		}
+		return m
+	}
+
+	want := map[string]string{"LOG_LEVEL": "info", "RAILS_ENV": "production"}
+	for _, name := range []string{"acme-api", "acme-web"} {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := vars(app); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s vars => %v; want %v", name, got, want)
+		}
+	}
+
+	if got := vars(existing); len(got) != 0 {
+		t.Fatalf("Expected the existing app to be unaffected, got %v", got)
+	}
+
+	// Vars given when creating the app take precedence over the defaults.
+	debug := "debug"
+	app, config, err := e.AppsCreateWithConfig(context.Background(), &empire.App{Name: "acme-jobs"}, empire.Vars{"LOG_LEVEL": &debug})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := *config.Vars["LOG_LEVEL"], debug; got != want {
+		t.Fatalf("LOG_LEVEL => %s; want %s", got, want)
+	}
+
+	if got, want := vars(app)["RAILS_ENV"], production; got != want {
+		t.Fatalf("RAILS_ENV => %s; want %s", got, want)
+	}
+
+	// Defaults can be removed.
+	if err := e.ConfigDefaultsSet(empire.Vars{"RAILS_ENV": nil}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = e.ConfigDefaultsGet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (empire.Vars{"LOG_LEVEL": &info}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Defaults => %v; want %v", got, want)
+	}
+}
+
+func TestConfigsApplyIfChanged(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		production = "production"
+		staging    = "staging"
+		info       = "info"
+	)
+
+	current, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &production, "LOG_LEVEL": &info})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		vars    empire.Vars
+		changed bool
+		want    map[string]string
+	}{
+		// All the same vars.
+		{empire.Vars{"RAILS_ENV": &production}, false, map[string]string{"RAILS_ENV": production, "LOG_LEVEL": info}},
+
+		// One changed var.
+		{empire.Vars{"RAILS_ENV": &staging}, true, map[string]string{"RAILS_ENV": staging, "LOG_LEVEL": info}},
+
+		// One added var.
+		{empire.Vars{"RACK_ENV": &staging}, true, map[string]string{"RAILS_ENV": staging, "LOG_LEVEL": info, "RACK_ENV": staging}},
+
+		// One removed var.
+		{empire.Vars{"LOG_LEVEL": nil}, true, map[string]string{"RAILS_ENV": staging, "RACK_ENV": staging}},
+	}
+
+	for _, tt := range tests {
+		config, changed, err := e.ConfigsApplyIfChanged(ctx, app, tt.vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if changed != tt.changed {
+			t.Fatalf("ConfigsApplyIfChanged(%v) changed => %v; want %v", tt.vars, changed, tt.changed)
+		}
+
+		if !changed && config.ID != current.ID {
+			t.Fatalf("ConfigsApplyIfChanged(%v) => %s; want the current config %s", tt.vars, config.ID, current.ID)
+		}
+
+		if changed && config.ID == current.ID {
+			t.Fatalf("ConfigsApplyIfChanged(%v) => the current config; want a new config", tt.vars)
+		}
+
+		got := make(map[string]string)
+		for k, v := range config.Vars {
+			got[string(k)] = *v
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("ConfigsApplyIfChanged(%v) vars => %v; want %v", tt.vars, got, tt.want)
+		}
+
+		current = config
+	}
+}
+
+func TestConfigsMerge(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	var apps []*empire.App
+	for _, name := range []string{"acme-inc", "acme-api", "acme-jobs"} {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps = append(apps, app)
+	}
+
+	var (
+		one   = "1"
+		two   = "2"
+		three = "3"
+		four  = "4"
+	)
+
+	base, err := e.ConfigsApply(ctx, apps[0], empire.Vars{"A": &one, "B": &two})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	override, err := e.ConfigsApply(ctx, apps[1], empire.Vars{"B": &three, "C": &four})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := func(c *empire.Config) map[string]string {
+		m := make(map[string]string)
+		for k, v := range c.Vars {
+			m[string(k)] = *v
+		}
+		return m
+	}
+
+	merged, err := e.ConfigsMerge(ctx, apps[2], base.ID, override.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := vars(merged), map[string]string{"A": "1", "B": "3", "C": "4"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Vars => %v; want %v", got, want)
+	}
+
+	// The merged configs should be unchanged.
+	for i, want := range []map[string]string{
+		{"A": "1", "B": "2"},
+		{"B": "3", "C": "4"},
+	} {
+		current, err := e.ConfigsCurrent(apps[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := vars(current); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s Vars => %v; want %v", apps[i].Name, got, want)
+		}
+	}
+
+	if _, err := e.ConfigsMerge(ctx, apps[2], "4a6a9d05-0b19-4a7b-8ad2-3f8c8d9f8e1a", override.ID); err != empire.ErrConfigNotFound {
+		t.Fatalf("err => %v; want %v", err, empire.ErrConfigNotFound)
+	}
+
+	if _, err := e.ConfigsMerge(ctx, apps[2], base.ID, "4a6a9d05-0b19-4a7b-8ad2-3f8c8d9f8e1a"); err != empire.ErrConfigNotFound {
+		t.Fatalf("err => %v; want %v", err, empire.ErrConfigNotFound)
+	}
+}
+
+func TestConfigsApplyDeltaFromRelease(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	var apps []*empire.App
+	for _, name := range []string{"acme-staging", "acme-production"} {
+		r, err := e.ReleasesCreateFromImage(ctx, name, DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps = append(apps, r.App)
+	}
+	staging, production := apps[0], apps[1]
+
+	var (
+		newRelic     = "abcd"
+		stagingDB    = "postgres://staging"
+		productionDB = "postgres://production"
+		secret       = "secret"
+		later        = "later"
+	)
+
+	if _, err := e.ConfigsApply(ctx, staging, empire.Vars{"NEW_RELIC_APP_ID": &newRelic, "DATABASE_URL": &stagingDB}); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := e.ReleasesLast(staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Vars added to staging after the release aren't applied.
+	if _, err := e.ConfigsApply(ctx, staging, empire.Vars{"LATER": &later}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ConfigsApply(ctx, production, empire.Vars{"DATABASE_URL": &productionDB, "SECRET_KEY": &secret}); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := func(c *empire.Config) map[string]string {
+		m := make(map[string]string)
+		for k, v := range c.Vars {
+			m[string(k)] = *v
+		}
+		return m
+	}
+
+	c, err := e.ConfigsApplyDeltaFromRelease(ctx, production, staging, src.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NEW_RELIC_APP_ID is added, DATABASE_URL is updated, and SECRET_KEY,
+	// which isn't in the staging config, is kept.
+	want := map[string]string{
+		"NEW_RELIC_APP_ID": "abcd",
+		"DATABASE_URL":     "postgres://staging",
+		"SECRET_KEY":       "secret",
+	}
+	if got := vars(c); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Vars => %v; want %v", got, want)
+	}
+
+	// The staging config is unchanged.
+	current, err := e.ConfigsCurrent(staging)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = map[string]string{
+		"NEW_RELIC_APP_ID": "abcd",
+		"DATABASE_URL":     "postgres://staging",
+		"LATER":            "later",
+	}
+	if got := vars(current); !reflect.DeepEqual(got, want) {
+		t.Fatalf("staging Vars => %v; want %v", got, want)
+	}
+}
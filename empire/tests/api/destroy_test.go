@@ -0,0 +1,178 @@
+package api_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/empire/empire/pkg/service"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+func TestAppsDestroyScheduled_Cancel(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := e.AppsDestroyScheduled(ctx, app, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AppsFirst(empire.AppsQuery{Name: &app.Name}); err != gorm.RecordNotFound {
+		t.Fatalf("err => %v; want the app to be hidden", err)
+	}
+
+	if err := e.AppsDestroyCancelScheduled(ctx, pending.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AppsFirst(empire.AppsQuery{Name: &app.Name}); err != nil {
+		t.Fatalf("err => %v; want the app to be restored", err)
+	}
+
+	// Cancelling twice is a noop.
+	if err := e.AppsDestroyCancelScheduled(ctx, pending.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppsDestroyScheduled_Execute(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := e.AppsDestroyScheduled(ctx, app, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Destroys that aren't due yet are left alone.
+	if err := e.AppsDestroySweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.AppsDestroyCancelScheduled(ctx, pending.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err = e.AppsDestroyScheduled(ctx, app, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An hour later, on any Empire instance, the destroy is due.
+	now := time.Now().Add(2 * time.Hour)
+	timex.Now = func() time.Time { return now }
+	defer func() { timex.Now = time.Now }()
+
+	if err := e.AppsDestroySweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.AppsDestroyCancelScheduled(ctx, pending.ID); err != empire.ErrDestroyAlreadyExecuted {
+		t.Fatalf("err => %v; want %v", err, empire.ErrDestroyAlreadyExecuted)
+	}
+}
+
+func TestAppsDestroyScheduled_Twice(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := e.AppsDestroyScheduled(ctx, app, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := e.AppsDestroyScheduled(ctx, app, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := again.ID, pending.ID; got != want {
+		t.Fatalf("PendingDestroy => %s; want %s", got, want)
+	}
+}
+
+// removeErrorManager is a service.Manager that fails to remove apps.
+type removeErrorManager struct {
+	*service.FakeManager
+}
+
+func (m *removeErrorManager) Remove(ctx context.Context, appID string) error {
+	return errors.New("boom")
+}
+
+func TestAppsDestroyScheduled_ExecuteFailed(t *testing.T) {
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Scheduler = &removeErrorManager{FakeManager: service.NewFakeManager()}
+	})
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := e.AppsDestroyScheduled(ctx, app, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Add(2 * time.Hour)
+	timex.Now = func() time.Time { return now }
+	defer func() { timex.Now = time.Now }()
+
+	if err := e.AppsDestroySweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The destroy failed, so it's still pending and can be cancelled.
+	if err := e.AppsDestroyCancelScheduled(ctx, pending.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AppsFirst(empire.AppsQuery{Name: &app.Name}); err != nil {
+		t.Fatalf("err => %v; want the app to be restored", err)
+	}
+}
+
+func TestAppsDestroyScheduled_Immediate(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := e.AppsDestroyScheduled(ctx, app, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending != nil {
+		t.Fatalf("PendingDestroy => %v; want nil", pending)
+	}
+
+	if _, err := e.AppsFirst(empire.AppsQuery{Name: &app.Name}); err != gorm.RecordNotFound {
+		t.Fatalf("err => %v; want the app to be destroyed", err)
+	}
+}
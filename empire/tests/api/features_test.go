@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestFeatureFlagSet(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.FeatureFlagSet(ctx, app, "new_ui", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.FeatureFlagSet(ctx, app, "beta", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// The flags are stored in the current config.
+	c, err := e.ConfigsCurrent(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := c.Vars["FEATURE_NEW_UI"]; v == nil || *v != "true" {
+		t.Fatalf("FEATURE_NEW_UI => %v; want true", v)
+	}
+
+	enabled, err := e.FeatureFlag(app, "new_ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !enabled {
+		t.Fatal("Expected new_ui to be enabled")
+	}
+
+	flags, err := e.FeatureFlagsAll(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := flags, map[string]bool{"new_ui": true, "beta": false}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("FeatureFlagsAll => %v; want %v", got, want)
+	}
+}
@@ -1,9 +1,16 @@
 package api_test
 
 import (
+	"database/sql"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bgentry/heroku-go"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
 )
 
 func TestFormationBatchUpdate(t *testing.T) {
@@ -33,3 +40,105 @@ func mustFormationBatchUpdate(t testing.TB, c *heroku.Client, appName string, up
 
 	return f
 }
+
+func TestFormationAtTime(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	t0 := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := timex.Now
+	defer func() { timex.Now = now }()
+	setNow := func(h int) {
+		timex.Now = func() time.Time {
+			return t0.Add(time.Duration(h) * time.Hour)
+		}
+	}
+
+	image := empire.Image{
+		Repo: "remind101/acme-inc",
+		ID:   strings.TrimPrefix(DefaultImage, "remind101/acme-inc:"),
+	}
+
+	out := make(chan empire.Event)
+	go func() {
+		for range out {
+		}
+	}()
+
+	setNow(0)
+	r, err := e.DeployImage(ctx, image, out)
+	close(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setNow(1)
+	if _, err := e.AppsScale(ctx, r.App, "web", 3, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	setNow(2)
+	if _, err := e.AppsScale(ctx, r.App, "web", 5, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at  time.Time
+		web int
+	}{
+		// Before the first release, the initial formation.
+		{t0.Add(-time.Hour), 1},
+		// Scale events after the time are ignored.
+		{t0.Add(30 * time.Minute), 1},
+		{t0.Add(1 * time.Hour), 3},
+		{t0.Add(90 * time.Minute), 3},
+		{t0.Add(3 * time.Hour), 5},
+	}
+
+	for _, tt := range tests {
+		f, err := e.FormationAtTime(r.App, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := f["web"].Quantity; got != tt.web {
+			t.Errorf("%s: web => %d; want %d", tt.at, got, tt.web)
+		}
+	}
+}
+
+func TestReleasesCreate_RemovedProcessScaleEvents(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A worker that was running, but isn't in the next release.
+	if _, err := db.Exec(`insert into scale_events (app_id, process_type, quantity) values ($1, 'worker', 2)`, r.App.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var quantity int
+	if err := db.QueryRow(`select quantity from scale_events where app_id = $1 and process_type = 'worker' order by created_at desc limit 1`, r.App.ID).Scan(&quantity); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := quantity, 0; got != want {
+		t.Fatalf("worker => %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+func TestAppsAllWithHealth(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	if _, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AppsCreate(&empire.App{Name: "acme-api"}); err != nil {
+		t.Fatal(err)
+	}
+
+	apps, err := e.AppsAllWithHealth(ctx, empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(apps), 2; got != want {
+		t.Fatalf("len(apps) => %d; want %d", got, want)
+	}
+
+	for _, app := range apps {
+		if got, want := app.HealthStatus, empire.AppHealthHealthy; got != want {
+			t.Errorf("%s => %s; want %s", app.Name, got, want)
+		}
+	}
+
+	apps, err = e.AppsAllWithHealth(ctx, empire.Page{Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(apps) != 1 || apps[0].Name != "acme-inc" {
+		t.Fatalf("apps => %v; want acme-inc", apps)
+	}
+}
+
+func TestClusterJobHealthSummary(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	if _, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.AppsCreate(&empire.App{Name: "acme-api"}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := e.ClusterJobHealthSummary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := *report, (empire.ClusterHealthReport{HealthyApps: 2}); got != want {
+		t.Fatalf("ClusterJobHealthSummary => %+v; want %+v", got, want)
+	}
+}
+
+// healthManager is a service.Manager that reports fewer running instances than
+// were scheduled for some apps, and never responds for others.
+type healthManager struct {
+	*service.FakeManager
+
+	// The number of instances that are reported as running, by app id.
+	// All instances of other apps are reported.
+	running map[string]int
+
+	// Apps whose instances can't be queried before the context is done.
+	slow map[string]bool
+}
+
+func (m *healthManager) Instances(ctx context.Context, appID string) ([]*service.Instance, error) {
+	if m.slow[appID] {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	instances, err := m.FakeManager.Instances(ctx, appID)
+	if n, ok := m.running[appID]; ok && n < len(instances) {
+		instances = instances[:n]
+	}
+	return instances, err
+}
+
+func TestClusterJobHealthSummary_Unhealthy(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	m := &healthManager{
+		FakeManager: service.NewFakeManager(),
+		running:     make(map[string]int),
+		slow:        make(map[string]bool),
+	}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Scheduler = m
+		o.SchedulerQueryTimeout = timeout
+	})
+	ctx := context.Background()
+
+	apps := make(map[string]*empire.App)
+	for _, name := range []string{"acme-inc", "acme-degraded", "acme-down", "acme-slow-1", "acme-slow-2", "acme-slow-3"} {
+		r, err := e.ReleasesCreateFromImage(ctx, name, DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		apps[name] = r.App
+	}
+
+	if _, err := e.ProcessesScale(ctx, apps["acme-degraded"], map[string]int{"web": 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.running[apps["acme-degraded"].ID] = 1
+	m.running[apps["acme-down"].ID] = 0
+	for _, name := range []string{"acme-slow-1", "acme-slow-2", "acme-slow-3"} {
+		m.slow[apps[name].ID] = true
+	}
+
+	start := time.Now()
+
+	report, err := e.ClusterJobHealthSummary(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := empire.ClusterHealthReport{
+		HealthyApps:  1,
+		DegradedApps: 1,
+		DownApps:     1,
+		UnknownApps:  3,
+	}
+	if got := *report; got != want {
+		t.Fatalf("ClusterJobHealthSummary => %+v; want %+v", got, want)
+	}
+
+	// Apps are queried in parallel, within a single timeout, rather than
+	// waiting for each slow app in turn.
+	if elapsed := time.Since(start); elapsed >= 2*timeout {
+		t.Fatalf("ClusterJobHealthSummary took %v; want less than %v", elapsed, 2*timeout)
+	}
+}
@@ -0,0 +1,254 @@
+package api_test
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+func TestProcessesAllByJobState(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	seed := map[string]empire.ProcessStates{
+		"acme-inc": {
+			{Name: "v1.web.a", State: "RUNNING"},
+			{Name: "v1.web.b", State: "FAILED"},
+			{Name: "v1.worker.c", State: "STOPPED"},
+		},
+		"acme-api": {
+			{Name: "v2.web.d", State: "FAILED"},
+			{Name: "v2.web.e", State: "FAILED"},
+		},
+	}
+
+	for name, states := range seed {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec(`insert into job_state_snapshots (app_id, states) values ($1, $2)`, app.ID, states); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobs, err := e.ProcessesAllByJobState("failed", empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*empire.JobStateSummary{
+		{AppName: "acme-api", ProcessType: "web", Instance: 1, State: "failed"},
+		{AppName: "acme-api", ProcessType: "web", Instance: 2, State: "failed"},
+		{AppName: "acme-inc", ProcessType: "web", Instance: 2, State: "failed"},
+	}
+	if !reflect.DeepEqual(jobs, want) {
+		t.Fatalf("Jobs => %v; want %v", jobs, want)
+	}
+
+	jobs, err = e.ProcessesAllByJobState("failed", empire.Page{Limit: 1, Offset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(jobs, want[2:]) {
+		t.Fatalf("Jobs => %v; want %v", jobs, want[2:])
+	}
+}
+
+func TestProcessesAllByJobState_Invalid(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	if _, err := e.ProcessesAllByJobState("exploded", empire.Page{}); err != empire.ErrInvalidJobState {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInvalidJobState)
+	}
+}
+
+func TestAppsAllByJobState(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	seed := map[string]empire.ProcessStates{
+		"acme-inc": {
+			{Name: "v1.web.a", State: "RUNNING"},
+			{Name: "v1.web.b", State: "FAILED"},
+		},
+		"acme-api": {
+			{Name: "v2.web.c", State: "RUNNING"},
+			{Name: "v2.web.d", State: "FAILED"},
+			{Name: "v2.web.e", State: "FAILED"},
+		},
+		"acme-web": {
+			{Name: "v3.web.f", State: "RUNNING"},
+			{Name: "v3.web.g", State: "RUNNING"},
+		},
+	}
+
+	for name, states := range seed {
+		app, err := e.AppsCreate(&empire.App{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec(`insert into job_state_snapshots (app_id, states) values ($1, $2)`, app.ID, states); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(state string) []string {
+		apps, err := e.AppsAllByJobState(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, app := range apps {
+			names = append(names, app.Name)
+		}
+		return names
+	}
+
+	if got, want := names("failed"), []string{"acme-api", "acme-inc"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+
+	if got, want := names("running"), []string{"acme-api", "acme-inc", "acme-web"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Apps => %v; want %v", got, want)
+	}
+
+	if got := names("stopped"); len(got) != 0 {
+		t.Fatalf("Apps => %v; want none", got)
+	}
+
+	if _, err := e.AppsAllByJobState("exploded"); err != empire.ErrInvalidJobState {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInvalidJobState)
+	}
+}
+
+// instancesManager is a service.Manager that counts the calls to Instances,
+// and calls onInstances, if it's set, the next time Instances is called.
+type instancesManager struct {
+	*service.FakeManager
+
+	calls       int
+	onInstances func()
+}
+
+func (m *instancesManager) Instances(ctx context.Context, app string) ([]*service.Instance, error) {
+	m.calls++
+	if f := m.onInstances; f != nil {
+		m.onInstances = nil
+		f()
+	}
+	return m.FakeManager.Instances(ctx, app)
+}
+
+func TestJobStatesByAppCached(t *testing.T) {
+	m := &instancesManager{FakeManager: service.NewFakeManager()}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Scheduler = m
+	})
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cached returns the job states, and whether the scheduler was
+	// queried for them.
+	cached := func(maxAge time.Duration) ([]*empire.ProcessState, bool) {
+		calls := m.calls
+		states, err := e.JobStatesByAppCached(ctx, r.App, maxAge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return states, m.calls > calls
+	}
+
+	// Nothing is stored yet, so the scheduler is queried.
+	states, live := cached(time.Hour)
+	if !live {
+		t.Fatal("Expected a cache miss to query the scheduler")
+	}
+
+	if len(states) == 0 {
+		t.Fatal("Expected job states")
+	}
+
+	// The stored job states are returned.
+	cachedStates, live := cached(time.Hour)
+	if live {
+		t.Fatal("Expected a cache hit not to query the scheduler")
+	}
+
+	if got, want := len(cachedStates), len(states); got != want {
+		t.Fatalf("len(states) => %d; want %d", got, want)
+	}
+
+	// A maxAge of zero always queries the scheduler.
+	if _, live := cached(0); !live {
+		t.Fatal("Expected a maxAge of 0 to query the scheduler")
+	}
+
+	// A deploy invalidates the stored job states.
+	if _, err := e.ReleasesDeploy(ctx, r.App, r.Config, r.Slug, "Redeploy"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, live := cached(time.Hour); !live {
+		t.Fatal("Expected a deploy to invalidate the cache")
+	}
+}
+
+func TestJobStatesByAppCached_InvalidatedWhileQuerying(t *testing.T) {
+	m := &instancesManager{FakeManager: service.NewFakeManager()}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Scheduler = m
+	})
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A deploy finishes while the scheduler is being queried.
+	m.onInstances = func() {
+		if _, err := e.ReleasesDeploy(ctx, r.App, r.Config, r.Slug, "Redeploy"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := e.JobStatesByAppCached(ctx, r.App, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// The job states from before the deploy weren't stored.
+	calls := m.calls
+	if _, err := e.JobStatesByAppCached(ctx, r.App, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.calls == calls {
+		t.Fatal("Expected the stale job states not to be stored")
+	}
+}
@@ -0,0 +1,68 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestJobsByApp(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := e.ProcessesScale(ctx, r.App, map[string]int{"web": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := e.JobsByApp(r.App)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var web []*empire.Job
+	for _, j := range jobs {
+		if j.ProcessType == "web" {
+			web = append(web, j)
+		}
+	}
+
+	if got, want := len(web), 3; got != want {
+		t.Fatalf("web jobs => %d; want %d", got, want)
+	}
+
+	for i, j := range web {
+		if got, want := j.Instance, i+1; got != want {
+			t.Fatalf("#%d: Instance => %d; want %d", i, got, want)
+		}
+
+		if got, want := j.AppName, "acme-inc"; got != want {
+			t.Fatalf("#%d: AppName => %s; want %s", i, got, want)
+		}
+
+		if got, want := j.ReleaseVersion, release.Version; got != want {
+			t.Fatalf("#%d: ReleaseVersion => %d; want %d", i, got, want)
+		}
+	}
+
+	// Once the app is destroyed, it has no jobs.
+	if err := e.AppsDestroy(ctx, r.App); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err = e.JobsByApp(r.App)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 0 {
+		t.Fatalf("Jobs => %v; want none", jobs)
+	}
+}
@@ -0,0 +1,201 @@
+package api_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+func TestProcessesSetCommand(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+	original := r1.Slug.ProcessTypes["web"]
+
+	// commands returns the commands that web processes are scheduled with.
+	commands := func() []string {
+		states, err := e.JobStatesByApp(ctx, app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var commands []string
+		for _, s := range states {
+			if strings.Contains(s.Name, ".web.") {
+				commands = append(commands, s.Command)
+			}
+		}
+		return commands
+	}
+
+	r2, err := e.ProcessesSetCommand(ctx, app, "web", "./bin/web --debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r2.Version, 2; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if got, want := commands(), []string{"./bin/web --debug"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Commands => %v; want %v", got, want)
+	}
+
+	// The slug is unchanged.
+	if got, want := r2.Slug.ID, r1.Slug.ID; got != want {
+		t.Fatalf("Slug => %s; want %s", got, want)
+	}
+
+	if got, want := r2.Slug.ProcessTypes["web"], original; got != want {
+		t.Fatalf("Slug web command => %s; want %s", got, want)
+	}
+
+	// Changing config keeps the override.
+	production := "production"
+	if _, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &production}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := e.JobsByApp(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, j := range jobs {
+		if j.ProcessType == "web" && j.Command != "./bin/web --debug" {
+			t.Fatalf("Job Command => %s; want the override", j.Command)
+		}
+	}
+
+	// A full deploy clears the override.
+	if _, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := commands(), []string{string(original)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Commands => %v; want %v", got, want)
+	}
+
+	if _, err := e.ProcessesSetCommand(ctx, app, "web", " "); err != empire.ErrBlankCommand {
+		t.Fatalf("err => %v; want %v", err, empire.ErrBlankCommand)
+	}
+
+	if _, err := e.ProcessesSetCommand(ctx, app, "scheduler", "./bin/scheduler"); err == nil {
+		t.Fatal("Expected an error for a process type that isn't in the slug")
+	}
+}
+
+// failingSubmitManager is a service.Manager that fails to submit apps while
+// fail is true.
+type failingSubmitManager struct {
+	*service.FakeManager
+	fail bool
+}
+
+func (m *failingSubmitManager) Submit(ctx context.Context, app *service.App) error {
+	if m.fail {
+		return errors.New("submit failed")
+	}
+
+	return m.FakeManager.Submit(ctx, app)
+}
+
+func TestProcessesSetCommand_Deploys(t *testing.T) {
+	m := &failingSubmitManager{FakeManager: service.NewFakeManager()}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Scheduler = m
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+	original := string(r1.Slug.ProcessTypes["web"])
+
+	// command returns the command of the web process of a release that's
+	// created after changing the config.
+	var n int
+	command := func() string {
+		n++
+		v := fmt.Sprintf("%d", n)
+		if _, err := e.ConfigsApply(ctx, app, empire.Vars{"N": &v}); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := e.ReleasesLast(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return string(r.Formation()["web"].Command)
+	}
+
+	deploys := []struct {
+		name   string
+		deploy func() error
+	}{
+		{"image", func() error {
+			_, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{})
+			return err
+		}},
+		{"ReleasesDeploy", func() error {
+			config, err := e.ConfigsCurrent(app)
+			if err != nil {
+				return err
+			}
+			_, err = e.ReleasesDeploy(ctx, app, config, r1.Slug, "Deploy")
+			return err
+		}},
+		{"ReleasesGraftConfig", func() error {
+			config, err := e.ConfigsCurrent(app)
+			if err != nil {
+				return err
+			}
+			_, err = e.ReleasesGraftConfig(ctx, app, r1.Version, config.ID)
+			return err
+		}},
+	}
+
+	for _, d := range deploys {
+		if _, err := e.ProcessesSetCommand(ctx, app, "web", "./bin/web --debug"); err != nil {
+			t.Fatal(err)
+		}
+
+		// A failed deploy keeps the override.
+		m.fail = true
+		if err := d.deploy(); err == nil {
+			t.Fatalf("%s: expected the deploy to fail", d.name)
+		}
+		m.fail = false
+
+		if got, want := command(), "./bin/web --debug"; got != want {
+			t.Fatalf("%s: Command => %s; want %s", d.name, got, want)
+		}
+
+		if err := d.deploy(); err != nil {
+			t.Fatalf("%s: %v", d.name, err)
+		}
+
+		if got, want := command(), original; got != want {
+			t.Fatalf("%s: Command => %s; want %s", d.name, got, want)
+		}
+	}
+}
@@ -1,9 +1,15 @@
 package api_test
 
 import (
+	"database/sql"
+	"reflect"
 	"testing"
 
 	"github.com/bgentry/heroku-go"
+	_ "github.com/lib/pq"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
 )
 
 func TestProcessesPost(t *testing.T) {
@@ -30,3 +36,51 @@ func TestProcessesPost(t *testing.T) {
 		t.Fatalf("AttachURL => %v; want %v", got, want)
 	}
 }
+
+func TestProcessTypesAll(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Every release of DefaultImage has a web process. Releases 2 and 3 also
+	// declare a worker and a clock process.
+	extra := map[int]string{2: "worker", 3: "clock"}
+
+	var app *empire.App
+	var releases []*empire.Release
+	for i := 0; i < 3; i++ {
+		r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+			CreateAppIfMissing: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		app = r.App
+		releases = append(releases, r)
+	}
+
+	for _, r := range releases {
+		typ, ok := extra[r.Version]
+		if !ok {
+			continue
+		}
+
+		if _, err := db.Exec(`insert into processes (release_id, type, quantity, command) values ($1, $2, 0, './bin/run')`, r.ID, typ); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	types, err := e.ProcessTypesAll(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := types, []string{"clock", "web", "worker"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessTypesAll => %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package api_test
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// mockEmailSender is an empire.EmailSender that records the approval token
+// sent to each recipient.
+type mockEmailSender struct {
+	tokens map[string]string
+}
+
+var approvalTokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+func (s *mockEmailSender) SendEmail(ctx context.Context, to, subject, body string) error {
+	m := approvalTokenPattern.FindStringSubmatch(body)
+	if m == nil {
+		return nil
+	}
+
+	token, err := url.QueryUnescape(m[1])
+	if err != nil {
+		return err
+	}
+
+	s.tokens[to] = token
+	return nil
+}
+
+func TestReleasesApprove(t *testing.T) {
+	sender := &mockEmailSender{tokens: make(map[string]string)}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.EmailSender = sender
+		o.ReleaseApprovalURL = "https://empire.example.com/approve"
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draft, err := e.ReleasesCreateDraft(ctx, r1.App, r1.Config, r1.Slug, "Deploy to production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesRequestApproval(ctx, draft, []string{"alice@example.com", "bob@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(sender.tokens), 2; got != want {
+		t.Fatalf("Emails => %d; want %d", got, want)
+	}
+
+	release, err := e.ReleasesApprove(ctx, sender.tokens["alice@example.com"])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := release.Status, empire.ReleaseStatusActive; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if got, want := release.ApprovedBy, "alice@example.com"; got != want {
+		t.Fatalf("ApprovedBy => %s; want %s", got, want)
+	}
+
+	// Only the first approver decides.
+	if _, err := e.ReleasesApprove(ctx, sender.tokens["bob@example.com"]); err != empire.ErrReleaseApprovalDecided {
+		t.Fatalf("err => %v; want %v", err, empire.ErrReleaseApprovalDecided)
+	}
+}
+
+func TestReleasesReject(t *testing.T) {
+	sender := &mockEmailSender{tokens: make(map[string]string)}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.EmailSender = sender
+		o.ReleaseApprovalURL = "https://empire.example.com/approve"
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draft, err := e.ReleasesCreateDraft(ctx, r1.App, r1.Config, r1.Slug, "Deploy to production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesRequestApproval(ctx, draft, []string{"alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	token := sender.tokens["alice@example.com"]
+	if err := e.ReleasesReject(ctx, token, "Not during the freeze"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesApprove(ctx, token); err != empire.ErrReleaseApprovalDecided {
+		t.Fatalf("err => %v; want %v", err, empire.ErrReleaseApprovalDecided)
+	}
+
+	last, err := e.ReleasesLast(r1.App)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := last.Version, r1.Version; got != want {
+		t.Fatalf("ReleasesLast => v%d; want v%d", got, want)
+	}
+}
+
+func TestReleasesApprove_Expired(t *testing.T) {
+	sender := &mockEmailSender{tokens: make(map[string]string)}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.EmailSender = sender
+		o.ReleaseApprovalURL = "https://empire.example.com/approve"
+		o.ReleaseApprovalTTL = time.Hour
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draft, err := e.ReleasesCreateDraft(ctx, r1.App, r1.Config, r1.Slug, "Deploy to production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesRequestApproval(ctx, draft, []string{"alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := timex.Now
+	timex.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	defer func() { timex.Now = now }()
+
+	if _, err := e.ReleasesApprove(ctx, sender.tokens["alice@example.com"]); err != empire.ErrApprovalTokenExpired {
+		t.Fatalf("err => %v; want %v", err, empire.ErrApprovalTokenExpired)
+	}
+}
+
+func TestReleasesApprove_ActivateFails(t *testing.T) {
+	sender := &mockEmailSender{tokens: make(map[string]string)}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.EmailSender = sender
+		o.ReleaseApprovalURL = "https://empire.example.com/approve"
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draft, err := e.ReleasesCreateDraft(ctx, r1.App, r1.Config, r1.Slug, "Deploy to production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesRequestApproval(ctx, draft, []string{"alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A newer release is deployed, so the draft can't be activated.
+	if _, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	token := sender.tokens["alice@example.com"]
+	if _, err := e.ReleasesApprove(ctx, token); err != empire.ErrReleaseDraftSuperseded {
+		t.Fatalf("err => %v; want %v", err, empire.ErrReleaseDraftSuperseded)
+	}
+
+	// The failed approval wasn't recorded, so the release can still be
+	// rejected.
+	if err := e.ReleasesReject(ctx, token, "Superseded"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,127 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+// exitCodeRunner is an empire.TaskRunner that exits with the given code.
+type exitCodeRunner struct {
+	code     int
+	commands []string
+}
+
+func (r *exitCodeRunner) RunTask(ctx context.Context, release *empire.Release, command string) (int, error) {
+	r.commands = append(r.commands, command)
+	return r.code, nil
+}
+
+func TestReleasesCreate_ValidateCommand(t *testing.T) {
+	runner := &exitCodeRunner{}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.TaskRunner = runner
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+
+	if err := e.AppsSetValidateCommand(ctx, app, "rake spec:smoke"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The validation command fails, so the release isn't created.
+	runner.code = 1
+	if _, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{}); err != empire.ErrReleaseValidationFailed {
+		t.Fatalf("err => %v; want %v", err, empire.ErrReleaseValidationFailed)
+	}
+
+	releases, err := e.ReleasesFindByApp(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(releases), 1; got != want {
+		t.Fatalf("Releases => %d; want %d", got, want)
+	}
+
+	// The validation command succeeds.
+	runner.code = 0
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.Version, 2; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if got, want := len(runner.commands), 2; got != want {
+		t.Fatalf("RunTask calls => %d; want %d", got, want)
+	}
+
+	for _, cmd := range runner.commands {
+		if cmd != "rake spec:smoke" {
+			t.Fatalf("Command => %s; want rake spec:smoke", cmd)
+		}
+	}
+}
+
+func TestReleasesRollback_ValidateCommand(t *testing.T) {
+	runner := &exitCodeRunner{}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.TaskRunner = runner
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+
+	if err := e.AppsSetValidateCommand(ctx, app, "rake spec:smoke"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rolling back isn't blocked by a failing validation command.
+	runner.code = 1
+	r, err := e.ReleasesRollback(ctx, app, r1.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.Version, 2; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if got, want := len(runner.commands), 0; got != want {
+		t.Fatalf("RunTask calls => %d; want %d", got, want)
+	}
+}
+
+func TestAppsSetValidateCommand(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a TaskRunner, every release would fail validation.
+	if err := e.AppsSetValidateCommand(ctx, r.App, "rake spec:smoke"); err != empire.ErrTaskRunnerDisabled {
+		t.Fatalf("err => %v; want %v", err, empire.ErrTaskRunnerDisabled)
+	}
+
+	token := &empire.AccessToken{Scopes: []string{empire.ScopeAppsRead}}
+	if err := e.AppsSetValidateCommand(empire.WithAccessToken(ctx, token), r.App, ""); err != empire.ErrInsufficientScope {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInsufficientScope)
+	}
+}
@@ -0,0 +1,130 @@
+package api_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestReleasesCreateFromImage(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		Description:        "Deploy from CI",
+		ReleaseMetadata:    empire.ReleaseMetadata{CommitSHA: "abcd", Branch: "master"},
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.App.Name, "acme-inc"; got != want {
+		t.Fatalf("App => %s; want %s", got, want)
+	}
+
+	if got, want := r.Version, 1; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if got, want := r.Description, "Deploy from CI"; got != want {
+		t.Fatalf("Description => %s; want %s", got, want)
+	}
+
+	if got, want := r.CommitSHA, "abcd"; got != want {
+		t.Fatalf("CommitSHA => %s; want %s", got, want)
+	}
+}
+
+func TestReleasesCreateFromImage_AppNotFound(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	_, err := e.ReleasesCreateFromImage(context.Background(), "acme-inc", DefaultImage, empire.DeployOptions{})
+	if err != empire.ErrAppNotFound {
+		t.Fatalf("err => %v; want %v", err, empire.ErrAppNotFound)
+	}
+}
+
+func TestReleasesCreateFromImage_Idempotent(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	opts := empire.DeployOptions{
+		CreateAppIfMissing: true,
+		IdempotencyKey:     "build-1234",
+	}
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r2, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r1.ID != r2.ID {
+		t.Fatalf("Release => %s; want %s", r2.ID, r1.ID)
+	}
+
+	releases, err := e.ReleasesFindByApp(r1.App)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(releases), 1; got != want {
+		t.Fatalf("len(releases) => %d; want %d", got, want)
+	}
+}
+
+func TestReleasesCreateFromImage_IdempotentConcurrent(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	if _, err := e.AppsCreate(&empire.App{Name: "acme-inc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := empire.DeployOptions{
+		IdempotencyKey: "build-1234",
+	}
+
+	// Deploys with the same key that race each other all return the same
+	// release.
+	var (
+		wg       sync.WaitGroup
+		releases = make([]*empire.Release, 5)
+		errs     = make([]error, len(releases))
+	)
+	for i := range releases {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			releases[i], errs[i] = e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, opts)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+
+		if got, want := releases[i].ID, releases[0].ID; got != want {
+			t.Fatalf("#%d: Release => %s; want %s", i, got, want)
+		}
+	}
+
+	all, err := e.ReleasesFindByApp(releases[0].App)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(all), 1; got != want {
+		t.Fatalf("len(releases) => %d; want %d", got, want)
+	}
+}
@@ -1,9 +1,17 @@
 package api_test
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bgentry/heroku-go"
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
 )
 
 func TestReleaseList(t *testing.T) {
@@ -74,3 +82,891 @@ func mustReleaseRollback(t testing.TB, c *heroku.Client, appName string, version
 
 	return release
 }
+
+func TestReleaseTags(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	image := empire.Image{
+		Repo: "remind101/acme-inc",
+		ID:   strings.TrimPrefix(DefaultImage, "remind101/acme-inc:"),
+	}
+
+	deploy := func() *empire.Release {
+		out := make(chan empire.Event)
+		go func() {
+			for range out {
+			}
+		}()
+		defer close(out)
+
+		r, err := e.DeployImage(ctx, image, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	deploy()
+	r2 := deploy()
+
+	stable, err := e.ReleaseTagGet(r2.App, empire.ReleaseTagStable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stable.Version, r2.Version; got != want {
+		t.Fatalf("stable => v%d; want v%d", got, want)
+	}
+
+	if err := e.ReleaseTagSet(r2.App, r2, "qa"); err != nil {
+		t.Fatal(err)
+	}
+
+	qa, err := e.ReleaseTagGet(r2.App, "qa")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := qa.ID, r2.ID; got != want {
+		t.Fatalf("qa => %s; want %s", got, want)
+	}
+
+	if _, err := e.ReleaseTagGet(r2.App, "missing"); err != empire.ErrTagNotFound {
+		t.Fatalf("err => %v; want %v", err, empire.ErrTagNotFound)
+	}
+}
+
+func TestReleasesTagSearch(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	image := empire.Image{
+		Repo: "remind101/acme-inc",
+		ID:   strings.TrimPrefix(DefaultImage, "remind101/acme-inc:"),
+	}
+
+	deploy := func() *empire.Release {
+		out := make(chan empire.Event)
+		go func() {
+			for range out {
+			}
+		}()
+		defer close(out)
+
+		r, err := e.DeployImage(ctx, image, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r1, r2, r3 := deploy(), deploy(), deploy()
+	app := r3.App
+
+	for tag, r := range map[string]*empire.Release{
+		empire.ReleaseTagStable: r1,
+		empire.ReleaseTagCanary: r2,
+		"rollback-v5":           r3,
+	} {
+		if err := e.ReleaseTagSet(app, r, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	releases, err := e.ReleasesTagSearch(app, "rollback%")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(releases) != 1 || releases[0].ID != r3.ID {
+		t.Fatalf("Expected only v%d to be returned, got %d releases", r3.Version, len(releases))
+	}
+
+	tags, err := e.ReleasesTagAll(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]int)
+	for tag, r := range tags {
+		got[tag] = r.Version
+	}
+
+	want := map[string]int{
+		empire.ReleaseTagStable: r1.Version,
+		empire.ReleaseTagCanary: r2.Version,
+		"rollback-v5":           r3.Version,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Tags => %v; want %v", got, want)
+	}
+}
+
+func TestReleasesStream(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	image := empire.Image{
+		Repo: "remind101/acme-inc",
+		ID:   strings.TrimPrefix(DefaultImage, "remind101/acme-inc:"),
+	}
+
+	deploy := func() *empire.Release {
+		out := make(chan empire.Event)
+		go func() {
+			for range out {
+			}
+		}()
+		defer close(out)
+
+		r, err := e.DeployImage(ctx, image, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	// The first deploy creates the app.
+	r1 := deploy()
+
+	events, err := e.ReleasesStream(ctx, r1.App)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r2 := deploy()
+
+	for _, want := range []string{empire.ReleaseEventCreated, empire.ReleaseEventDeployed} {
+		select {
+		case event := <-events:
+			if got := event.Type; got != want {
+				t.Fatalf("Type => %s; want %s", got, want)
+			}
+
+			if got, want := event.Release.ID, r2.ID; got != want {
+				t.Fatalf("Release => %s; want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s event", want)
+		}
+	}
+}
+
+func TestSLOEvaluate(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	image := empire.Image{
+		Repo: "remind101/acme-inc",
+		ID:   strings.TrimPrefix(DefaultImage, "remind101/acme-inc:"),
+	}
+
+	deploy := func() *empire.Release {
+		out := make(chan empire.Event)
+		go func() {
+			for range out {
+			}
+		}()
+		defer close(out)
+
+		r, err := e.DeployImage(ctx, image, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	deploy()
+	r := deploy()
+	app := r.App
+
+	// Drafts aren't counted.
+	if _, err := e.ReleasesCreateDraft(ctx, app, r.Config, r.Slug, "Draft"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.SLOTargetSet(app, empire.DeployFrequencyTarget{ReleasesPerWeek: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := e.SLOEvaluate(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := report.ActualReleasesThisWeek, 2; got != want {
+		t.Fatalf("ActualReleasesThisWeek => %d; want %d", got, want)
+	}
+
+	if !report.TargetMet {
+		t.Fatal("Expected the target to be met")
+	}
+
+	// A week later, the releases are no longer counted.
+	now := timex.Now
+	timex.Now = func() time.Time {
+		return now().Add(8 * 24 * time.Hour)
+	}
+	defer func() { timex.Now = now }()
+
+	report, err = e.SLOEvaluate(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := report.ActualReleasesThisWeek, 0; got != want {
+		t.Fatalf("ActualReleasesThisWeek => %d; want %d", got, want)
+	}
+
+	if report.TargetMet {
+		t.Fatal("Expected the target to not be met")
+	}
+}
+
+func TestReleasesSearch(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	image := empire.Image{
+		Repo: "remind101/acme-inc",
+		ID:   strings.TrimPrefix(DefaultImage, "remind101/acme-inc:"),
+	}
+
+	deploy := func(sha string) *empire.Release {
+		out := make(chan empire.Event)
+		go func() {
+			for range out {
+			}
+		}()
+		defer close(out)
+
+		r, err := e.DeployImageWithMetadata(ctx, image, empire.ReleaseMetadata{CommitSHA: sha, Branch: "master"}, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r1 := deploy("abc123def456")
+	deploy("fff999eee888")
+
+	releases, err := e.ReleasesSearch("ABC123", empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(releases) != 1 {
+		t.Fatalf("Expected 1 release, got %d", len(releases))
+	}
+
+	if got, want := releases[0].ID, r1.ID; got != want {
+		t.Fatalf("Release => %s; want %s", got, want)
+	}
+
+	if got, want := releases[0].App.Name, "acme-inc"; got != want {
+		t.Fatalf("App => %s; want %s", got, want)
+	}
+
+	releases, err = e.ReleasesSearch("0000000", empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(releases) != 0 {
+		t.Fatalf("Expected no releases, got %d", len(releases))
+	}
+}
+
+func TestReleasesFind(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	timexNow := timex.Now
+	defer func() { timex.Now = timexNow }()
+
+	// deploy creates a release of the app an hour after the last one.
+	deploy := func(app, sha, desc string) *empire.Release {
+		now = now.Add(time.Hour)
+		timex.Now = func() time.Time { return now }
+
+		r, err := e.ReleasesCreateFromImage(ctx, app, DefaultImage, empire.DeployOptions{
+			Description:        desc,
+			ReleaseMetadata:    empire.ReleaseMetadata{CommitSHA: sha},
+			CreateAppIfMissing: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r1 := deploy("acme-inc", "aaa111", "Deploy hotfix for login")
+	r2 := deploy("acme-api", "bbb222", "Deploy new endpoints")
+	r3 := deploy("acme-inc", "ccc333", "Deploy HOTFIX for signup")
+
+	find := func(q empire.ReleasesQuery) []string {
+		releases, err := e.ReleasesFind(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, r := range releases {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		query empire.ReleasesQuery
+		want  []string
+	}{
+		{empire.ReleasesQuery{App: r1.App}, []string{r3.ID, r1.ID}},
+		{empire.ReleasesQuery{CommitSHA: "bbb222"}, []string{r2.ID}},
+		{empire.ReleasesQuery{CommitSHA: "bbb"}, nil},
+		{empire.ReleasesQuery{DescriptionContains: "hotfix"}, []string{r3.ID, r1.ID}},
+		{empire.ReleasesQuery{App: r1.App, CreatedAfter: *r1.CreatedAt}, []string{r3.ID}},
+		{empire.ReleasesQuery{CreatedBefore: *r3.CreatedAt}, []string{r2.ID, r1.ID}},
+		{empire.ReleasesQuery{}, []string{r3.ID, r2.ID, r1.ID}},
+		{empire.ReleasesQuery{Page: empire.Page{Limit: 2, Offset: 1}}, []string{r2.ID, r1.ID}},
+	}
+
+	for i, tt := range tests {
+		if got := find(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("#%d: Releases => %v; want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestReleasesFindByAppWithDiff(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r.App
+
+	one, two := "1", "2"
+	for _, vars := range []empire.Vars{
+		{"A": &one},
+		{"A": &two, "B": &one},
+	} {
+		if _, err := e.ConfigsApply(ctx, app, vars); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	releases, err := e.ReleasesFindByAppWithDiff(app, empire.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := e.ReleasesFindByApp(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(releases), len(all); got != want {
+		t.Fatalf("Releases => %d; want %d", got, want)
+	}
+
+	for i := range all {
+		if got, want := releases[i].ID, all[i].ID; got != want {
+			t.Fatalf("Releases[%d] => %s; want %s", i, got, want)
+		}
+	}
+
+	want := []empire.ConfigChangeset{
+		// v3
+		{
+			{Variable: "A", Old: &one, New: &two},
+			{Variable: "B", New: &one},
+		},
+		// v2
+		{
+			{Variable: "A", New: &one},
+		},
+		// v1
+		{},
+	}
+
+	check := func(releases []*empire.Release, want []empire.ConfigChangeset) {
+		if got, want := len(releases), len(want); got != want {
+			t.Fatalf("Releases => %d; want %d", got, want)
+		}
+
+		for i, r := range releases {
+			if r.ConfigDiff == nil {
+				t.Fatalf("v%d: expected a ConfigDiff", r.Version)
+			}
+
+			if got, want := len(*r.ConfigDiff), len(want[i]); got != want {
+				t.Fatalf("v%d: changes => %d; want %d", r.Version, got, want)
+			}
+
+			for j, c := range *r.ConfigDiff {
+				w := want[i][j]
+				if c.Variable != w.Variable || !equalPtr(c.Old, w.Old) || !equalPtr(c.New, w.New) {
+					t.Fatalf("v%d: change %d => %v; want %v", r.Version, j, c, w)
+				}
+			}
+		}
+	}
+
+	check(releases, want)
+
+	// The oldest release in a page is still diffed against its
+	// predecessor.
+	releases, err = e.ReleasesFindByAppWithDiff(app, empire.Page{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check(releases, want[:2])
+}
+
+func equalPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestReleasesCreateDraft(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+
+	// scheduled returns the releases that the app's running processes
+	// belong to.
+	scheduled := func() []string {
+		states, err := e.JobStatesByApp(ctx, app)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var versions []string
+		for _, s := range states {
+			versions = append(versions, strings.SplitN(s.Name, ".", 2)[0])
+		}
+		return versions
+	}
+
+	last := func() int {
+		r, err := e.ReleasesLast(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Version
+	}
+
+	draft, err := e.ReleasesCreateDraft(ctx, app, r1.Config, r1.Slug, "Deploy to production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := draft.Status, empire.ReleaseStatusDraft; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	// Drafts aren't scheduled, and aren't the current release.
+	for _, v := range scheduled() {
+		if v != "v1" {
+			t.Fatalf("Expected only v1 to be scheduled, got %s", v)
+		}
+	}
+
+	if got, want := last(), 1; got != want {
+		t.Fatalf("ReleasesLast => v%d; want v%d", got, want)
+	}
+
+	if _, err := e.ReleasesActivate(ctx, draft, ""); err != empire.ErrReleaseApproverRequired {
+		t.Fatalf("err => %v; want %v", err, empire.ErrReleaseApproverRequired)
+	}
+
+	activated, err := e.ReleasesActivate(ctx, draft, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions := scheduled()
+	if len(versions) == 0 {
+		t.Fatal("Expected the draft to be scheduled")
+	}
+	for _, v := range versions {
+		if v != "v2" {
+			t.Fatalf("Expected only v2 to be scheduled, got %s", v)
+		}
+	}
+
+	if got, want := last(), 2; got != want {
+		t.Fatalf("ReleasesLast => v%d; want v%d", got, want)
+	}
+
+	found, err := e.ReleasesFindByAppAndVersion(app, activated.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := found.Status, empire.ReleaseStatusActive; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if got, want := found.ApprovedBy, "bob@example.com"; got != want {
+		t.Fatalf("ApprovedBy => %s; want %s", got, want)
+	}
+
+	// Active releases can't be activated again.
+	if _, err := e.ReleasesActivate(ctx, found, "bob@example.com"); err != empire.ErrReleaseNotDraft {
+		t.Fatalf("err => %v; want %v", err, empire.ErrReleaseNotDraft)
+	}
+
+	// Neither can drafts that have been superseded by a newer release.
+	stale, err := e.ReleasesCreateDraft(ctx, app, r1.Config, r1.Slug, "Deploy to production")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesActivate(ctx, stale, "bob@example.com"); err != empire.ErrReleaseDraftSuperseded {
+		t.Fatalf("err => %v; want %v", err, empire.ErrReleaseDraftSuperseded)
+	}
+}
+
+func TestReleasesActivate_Formation(t *testing.T) {
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.AutoTagReleases = true
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	draft, err := e.ReleasesCreateDraft(ctx, r1.App, r1.Config, r1.Slug, "Deploy v1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scaling after the draft was created changes the formation that the
+	// draft is activated with.
+	if _, err := e.ProcessesScale(ctx, r1.App, map[string]int{"web": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	activated, err := e.ReleasesActivate(ctx, draft, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := e.ReleasesFindByAppAndVersion(r1.App, activated.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := found.Formation()["web"].Quantity, 3; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+
+	tagged, err := e.ReleaseTagGet(r1.App, empire.ReleaseTagSemver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := tagged.Version, activated.Version; got != want {
+		t.Fatalf("semver => v%d; want v%d", got, want)
+	}
+}
+
+func TestReleasesPromoteToStable(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deploy := func() *empire.Release {
+		r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+			CreateAppIfMissing: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r1 := deploy()
+	r2 := deploy()
+	app := r2.App
+
+	// The current release, v2, is stable, and runs more web processes
+	// than v1.
+	if _, err := e.AppsScale(ctx, app, "web", 3, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	instances := func() int {
+		states, err := e.JobStatesByApp(ctx, app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(states)
+	}
+
+	stable := func() int {
+		r, err := e.ReleaseTagGet(app, empire.ReleaseTagStable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.Version
+	}
+
+	events, err := e.ReleasesStream(ctx, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.ReleasesPromoteToStable(ctx, app, 99); err == nil {
+		t.Fatal("Expected an error promoting a version that doesn't exist")
+	}
+
+	// Promoting the stable release does nothing.
+	if err := e.ReleasesPromoteToStable(ctx, app, r2.Version); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := instances(), 3; got != want {
+		t.Fatalf("Instances => %d; want %d", got, want)
+	}
+
+	if err := e.ReleasesPromoteToStable(ctx, app, r1.Version); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stable(), r1.Version; got != want {
+		t.Fatalf("stable => v%d; want v%d", got, want)
+	}
+
+	if got, want := instances(), 1; got != want {
+		t.Fatalf("Instances => %d; want %d", got, want)
+	}
+
+	// The first event is from promoting v1, since promoting v2 was a noop.
+	select {
+	case event := <-events:
+		if got, want := event.Type, empire.ReleaseEventPromoted; got != want {
+			t.Fatalf("Type => %s; want %s", got, want)
+		}
+
+		if got, want := event.Release.ID, r1.ID; got != want {
+			t.Fatalf("Release => %s; want %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the promote event")
+	}
+}
+
+func TestReleasesAutoTag(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	release := func(desc string) *empire.Release {
+		r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+			Description:        desc,
+			CreateAppIfMissing: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := e.ReleasesAutoTag(r.App, r); err != nil {
+			t.Fatal(err)
+		}
+
+		return r
+	}
+
+	tagged := func(r *empire.Release, tag string) int {
+		tr, err := e.ReleaseTagGet(r.App, tag)
+		if err == empire.ErrTagNotFound {
+			return 0
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tr.Version
+	}
+
+	// No semver is a noop.
+	r1 := release("Deploy master")
+	if got := tagged(r1, empire.ReleaseTagSemver); got != 0 {
+		t.Fatalf("semver => v%d; want untagged", got)
+	}
+
+	r2 := release("Deploy v1.2.3")
+	if got, want := tagged(r2, empire.ReleaseTagSemver), r2.Version; got != want {
+		t.Fatalf("semver => v%d; want v%d", got, want)
+	}
+	if got, want := tagged(r2, empire.ReleaseTagSemverLatest), r2.Version; got != want {
+		t.Fatalf("semver-latest => v%d; want v%d", got, want)
+	}
+
+	// A greater version moves the latest tag.
+	r3 := release("Deploy v1.3.0")
+	if got, want := tagged(r3, empire.ReleaseTagSemverLatest), r3.Version; got != want {
+		t.Fatalf("semver-latest => v%d; want v%d", got, want)
+	}
+
+	// A lower version, e.g. a hotfix to an older branch, doesn't.
+	r4 := release("Deploy v1.2.4")
+	if got, want := tagged(r4, empire.ReleaseTagSemver), r4.Version; got != want {
+		t.Fatalf("semver => v%d; want v%d", got, want)
+	}
+	if got, want := tagged(r4, empire.ReleaseTagSemverLatest), r3.Version; got != want {
+		t.Fatalf("semver-latest => v%d; want v%d", got, want)
+	}
+}
+
+func TestReleasesDeploy(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+
+	r2, err := e.ReleasesDeploy(ctx, app, r1.Config, r1.Slug, "Redeploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r2.Version, 2; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if got, want := r2.Status, empire.ReleaseStatusActive; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if got, want := r2.Description, "Redeploy"; got != want {
+		t.Fatalf("Description => %s; want %s", got, want)
+	}
+
+	states, err := e.JobStatesByApp(ctx, app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(states) == 0 {
+		t.Fatal("Expected the release to be scheduled")
+	}
+
+	for _, s := range states {
+		if got, want := strings.SplitN(s.Name, ".", 2)[0], "v2"; got != want {
+			t.Fatalf("Scheduled => %s; want %s", got, want)
+		}
+	}
+
+	last, err := e.ReleasesLast(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := last.ID, r2.ID; got != want {
+		t.Fatalf("ReleasesLast => %s; want %s", got, want)
+	}
+}
+
+func TestReleasesGraftConfig(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{
+		CreateAppIfMissing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := r1.App
+
+	production := "production"
+	config, err := e.ConfigsApply(ctx, app, empire.Vars{"RAILS_ENV": &production})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := e.ReleasesGraftConfig(ctx, app, 1, config.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.Version, 3; got != want {
+		t.Fatalf("Version => %d; want %d", got, want)
+	}
+
+	if got, want := r.Slug.ID, r1.Slug.ID; got != want {
+		t.Fatalf("Slug => %s; want %s", got, want)
+	}
+
+	if got, want := r.Config.ID, config.ID; got != want {
+		t.Fatalf("Config => %s; want %s", got, want)
+	}
+
+	if got, want := r.Description, "Config fix for v1"; got != want {
+		t.Fatalf("Description => %s; want %s", got, want)
+	}
+
+	// The grafted release is unchanged.
+	old, err := e.ReleasesFindByAppAndVersion(app, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := old.Config.ID, r1.Config.ID; got != want {
+		t.Fatalf("v1 Config => %s; want %s", got, want)
+	}
+
+	if _, err := e.ReleasesGraftConfig(ctx, app, 1, "4a6a9d05-0b19-4a7b-8ad2-3f8c8d9f8e1a"); err != empire.ErrConfigNotFound {
+		t.Fatalf("err => %v; want %v", err, empire.ErrConfigNotFound)
+	}
+}
+
+func TestReleasesCompare_VersionNotFound(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ReleasesCompare(r.App, r.Version, r.Version+1); err != gorm.RecordNotFound {
+		t.Fatalf("err => %v; want %v", err, gorm.RecordNotFound)
+	}
+
+	if _, err := e.ReleasesCompare(r.App, r.Version+1, r.Version); err != gorm.RecordNotFound {
+		t.Fatalf("err => %v; want %v", err, gorm.RecordNotFound)
+	}
+}
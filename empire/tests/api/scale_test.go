@@ -0,0 +1,171 @@
+package api_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"github.com/remind101/empire/empire/pkg/service"
+	"golang.org/x/net/context"
+)
+
+func TestProcessesScale(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := e.ProcessesScale(ctx, r.App, map[string]int{"web": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := release.Formation()["web"].Quantity, 3; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+
+	if _, err := e.ProcessesScale(ctx, r.App, map[string]int{"web": 3}); err != empire.ErrNoChangeRequired {
+		t.Fatalf("err => %v; want %v", err, empire.ErrNoChangeRequired)
+	}
+
+	if _, err := e.ProcessesScale(ctx, r.App, map[string]int{"scheduler": 1}); err == nil {
+		t.Fatal("expected an error for an unknown process type")
+	} else if _, ok := err.(*empire.ValidationError); !ok {
+		t.Fatalf("err => %T; want a ValidationError", err)
+	}
+}
+
+func TestProcessesScale_NoRelease(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ProcessesScale(context.Background(), app, map[string]int{"web": 1}); err == nil {
+		t.Fatal("expected an error")
+	} else if _, ok := err.(*empire.ValidationError); !ok {
+		t.Fatalf("err => %T; want a ValidationError", err)
+	}
+}
+
+func TestScaleReleaseJSONPatch(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scale := func(patch string) int {
+		release, err := e.ScaleReleaseJSONPatch(ctx, r.App, []byte(patch))
+		if err != nil {
+			t.Fatalf("ScaleReleaseJSONPatch(%s) => %v", patch, err)
+		}
+		return release.Formation()["web"].Quantity
+	}
+
+	if got, want := scale(`[{"op": "replace", "path": "/web", "value": 3}]`), 3; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+
+	if got, want := scale(`[{"op": "add", "path": "/web", "value": 2}]`), 2; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+
+	// Removed process types are scaled down.
+	if got, want := scale(`[{"op": "remove", "path": "/web"}]`), 0; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+
+	if _, err := e.ScaleReleaseJSONPatch(ctx, r.App, []byte(`[{"op": "replace", "path": "/web"`)); err != empire.ErrInvalidPatch {
+		t.Fatalf("err => %v; want %v", err, empire.ErrInvalidPatch)
+	}
+
+	for _, patch := range []string{
+		// Process types can only be added if they're in the release.
+		`[{"op": "add", "path": "/scheduler", "value": 1}]`,
+		`[{"op": "replace", "path": "/web", "value": -1}]`,
+	} {
+		if _, err := e.ScaleReleaseJSONPatch(ctx, r.App, []byte(patch)); err == nil {
+			t.Fatalf("ScaleReleaseJSONPatch(%s) => nil; want an error", patch)
+		} else if _, ok := err.(*empire.ValidationError); !ok {
+			t.Fatalf("err => %T; want a ValidationError", err)
+		}
+	}
+}
+
+// failingScaleManager is a service.Manager that records the quantities that
+// processes are scaled to, and fails to scale the process types in fail.
+type failingScaleManager struct {
+	*service.FakeManager
+
+	fail   map[string]bool
+	scaled []string
+}
+
+func (m *failingScaleManager) Scale(ctx context.Context, app, process string, instances uint) error {
+	if m.fail[process] {
+		return errors.New("scale failed")
+	}
+
+	m.scaled = append(m.scaled, fmt.Sprintf("%s=%d", process, instances))
+	return m.FakeManager.Scale(ctx, app, process, instances)
+}
+
+func TestProcessesScale_Rollback(t *testing.T) {
+	m := &failingScaleManager{
+		FakeManager: service.NewFakeManager(),
+		fail:        map[string]bool{"worker": true},
+	}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Scheduler = m
+	})
+	ctx := context.Background()
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	r, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`insert into processes (release_id, type, quantity, command) values ($1, 'worker', 0, './bin/worker')`, r.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.ProcessesScale(ctx, r.App, map[string]int{"web": 2, "worker": 1}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	// web was scaled before worker failed, so it's scaled back.
+	if got, want := m.scaled, []string{"web=2", "web=1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Scaled => %v; want %v", got, want)
+	}
+
+	release, err := e.ReleasesLast(r.App)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := release.Formation()
+	if got, want := f["web"].Quantity, 1; got != want {
+		t.Fatalf("web => %d; want %d", got, want)
+	}
+	if got, want := f["worker"].Quantity, 0; got != want {
+		t.Fatalf("worker => %d; want %d", got, want)
+	}
+}
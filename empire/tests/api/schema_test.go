@@ -0,0 +1,91 @@
+package api_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+)
+
+const migrationsPath = "../../migrations"
+
+func TestSchemaVersion(t *testing.T) {
+	files, err := ioutil.ReadDir(migrationsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test database has every migration applied, so the schema
+	// version is the version of the last migration.
+	var latest int
+	for _, f := range files {
+		v, err := strconv.Atoi(strings.SplitN(f.Name(), "_", 2)[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v > latest {
+			latest = v
+		}
+	}
+
+	version, err := empire.SchemaVersion(empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := version, latest; got != want {
+		t.Fatalf("SchemaVersion => %d; want %d", got, want)
+	}
+
+	upgrade, version, err := empire.SchemaNeedsUpgrade(empiretest.DatabaseURL, migrationsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upgrade {
+		t.Fatal("Expected no pending migrations")
+	}
+
+	if got, want := version, latest; got != want {
+		t.Fatalf("SchemaNeedsUpgrade version => %d; want %d", got, want)
+	}
+
+	// Copy the migrations, and add a new one that hasn't been applied.
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range files {
+		b, err := ioutil.ReadFile(filepath.Join(migrationsPath, f.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, f.Name()), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	name := strconv.Itoa(latest+1) + "_add_widgets"
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".up.sql"), []byte("CREATE TABLE widgets (id uuid);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".down.sql"), []byte("DROP TABLE widgets;"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	upgrade, _, err = empire.SchemaNeedsUpgrade(empiretest.DatabaseURL, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !upgrade {
+		t.Fatal("Expected a pending migration")
+	}
+}
@@ -0,0 +1,269 @@
+package api_test
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestSlugsCreateFromCompose(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compose := `
+services:
+  web:
+    image: remind101/acme-inc:v1
+    command: ./bin/web
+  worker:
+    image: remind101/acme-inc:v1
+    command: ./bin/worker
+`
+
+	slugs, err := e.SlugsCreateFromCompose(ctx, app, strings.NewReader(compose), empire.ComposeOverrides{"worker": "v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var images []string
+	var types []empire.ProcessType
+	for _, slug := range slugs {
+		if slug.ID == "" {
+			t.Fatal("Expected the slug to be created")
+		}
+
+		images = append(images, slug.Image.String())
+		for pt := range slug.ProcessTypes {
+			types = append(types, pt)
+		}
+	}
+
+	if got, want := images, []string{"remind101/acme-inc:v1", "remind101/acme-inc:v2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Images => %v; want %v", got, want)
+	}
+
+	if got, want := types, []empire.ProcessType{"web", "worker"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Process types => %v; want %v", got, want)
+	}
+}
+
+// recordingResolver is an empire.Resolver that records the images that it
+// resolved, and fails to resolve the images in missing.
+type recordingResolver struct {
+	missing  map[string]bool
+	resolved []string
+}
+
+func (r *recordingResolver) Resolve(image empire.Image, out chan empire.Event) (empire.Image, error) {
+	if r.missing[image.String()] {
+		return image, errors.New("image not found")
+	}
+	r.resolved = append(r.resolved, image.String())
+	return image, nil
+}
+
+func (r *recordingResolver) ImageExists(image empire.Image) (bool, error) {
+	return !r.missing[image.String()], nil
+}
+
+func TestSlugsCreateFromCompose_Resolve(t *testing.T) {
+	r := &recordingResolver{
+		missing: map[string]bool{
+			"remind101/acme-inc:v2": true,
+		},
+	}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Docker.Resolver = r
+	})
+	ctx := context.Background()
+
+	app, err := e.AppsCreate(&empire.App{Name: "acme-inc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compose := `
+services:
+  web:
+    image: remind101/acme-inc:v1
+    command: ./bin/web
+  worker:
+    image: remind101/acme-inc:v2
+    command: ./bin/worker
+`
+
+	// The image of the worker can't be resolved, so no slugs are created.
+	if _, err := e.SlugsCreateFromCompose(ctx, app, strings.NewReader(compose), nil); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow(`select count(*) from slugs`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 0 {
+		t.Fatalf("slugs => %d; want 0", count)
+	}
+
+	// Once it can, every image is pulled.
+	r.missing = nil
+	r.resolved = nil
+
+	if _, err := e.SlugsCreateFromCompose(ctx, app, strings.NewReader(compose), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r.resolved, []string{"remind101/acme-inc:v1", "remind101/acme-inc:v2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Resolved => %v; want %v", got, want)
+	}
+}
+
+// missingImagesResolver is an empire.Resolver that reports the images in
+// missing as deleted from the registry.
+type missingImagesResolver struct {
+	missing map[string]bool
+}
+
+func (r *missingImagesResolver) Resolve(image empire.Image, out chan empire.Event) (empire.Image, error) {
+	return image, nil
+}
+
+func (r *missingImagesResolver) ImageExists(image empire.Image) (bool, error) {
+	return !r.missing[image.String()], nil
+}
+
+// tagsResolver is an empire.Resolver that resolves tags to the image ids in
+// ids.
+type tagsResolver struct {
+	ids map[string]string
+}
+
+func (r *tagsResolver) Resolve(image empire.Image, out chan empire.Event) (empire.Image, error) {
+	return empire.Image{Repo: image.Repo, ID: r.ids[image.String()]}, nil
+}
+
+func (r *tagsResolver) ImageExists(image empire.Image) (bool, error) {
+	return true, nil
+}
+
+func TestSlugsCreateByImage_Reused(t *testing.T) {
+	r := &tagsResolver{
+		ids: map[string]string{
+			DefaultImage: "1",
+		},
+	}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Docker.Resolver = r
+	})
+	ctx := context.Background()
+
+	r1, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The tag still resolves to the same image, so its process types
+	// aren't extracted again.
+	r2, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := r2.Slug.ID, r1.Slug.ID; got != want {
+		t.Fatalf("Slug => %s; want %s", got, want)
+	}
+
+	if got, want := r2.Slug.ProcessTypes, r1.Slug.ProcessTypes; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessTypes => %v; want %v", got, want)
+	}
+
+	if got, want := r2.Formation()["web"].Command, r1.Slug.ProcessTypes["web"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Command => %v; want %v", got, want)
+	}
+
+	// The tag was moved to another image, which gets its own slug.
+	r.ids[DefaultImage] = "2"
+
+	r3, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r3.Slug.ID == r1.Slug.ID {
+		t.Fatal("Expected a new slug for the moved tag")
+	}
+
+	if got, want := r3.Slug.ResolvedImageID, "2"; got != want {
+		t.Fatalf("ResolvedImageID => %s; want %s", got, want)
+	}
+}
+
+func TestSlugsGC(t *testing.T) {
+	r := &missingImagesResolver{
+		missing: map[string]bool{
+			DefaultImage:            true,
+			"remind101/acme-inc:v2": true,
+		},
+	}
+	e := empiretest.NewEmpireWithOptions(t, func(o *empire.Options) {
+		o.Docker.Resolver = r
+	})
+	ctx := context.Background()
+
+	// The image of the release is gone, but the slug is still used by the
+	// release, so it's kept.
+	release, err := e.ReleasesCreateFromImage(ctx, "acme-inc", DefaultImage, empire.DeployOptions{CreateAppIfMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compose := `
+services:
+  web:
+    image: remind101/acme-inc:v1
+    command: ./bin/web
+  worker:
+    image: remind101/acme-inc:v2
+    command: ./bin/worker
+`
+
+	// Neither slug is used by a release, but only the image of v2 is gone.
+	if _, err := e.SlugsCreateFromCompose(ctx, release.App, strings.NewReader(compose), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := e.SlugsGC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := n, 1; got != want {
+		t.Fatalf("SlugsGC => %d; want %d", got, want)
+	}
+
+	if _, err := e.ReleasesFindByAppAndVersion(release.App, release.Version); err != nil {
+		t.Fatalf("Expected the release to be kept: %v", err)
+	}
+
+	if n, err := e.SlugsGC(ctx); err != nil || n != 0 {
+		t.Fatalf("SlugsGC => %d, %v; want 0", n, err)
+	}
+}
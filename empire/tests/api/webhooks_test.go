@@ -0,0 +1,168 @@
+package api_test
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/remind101/empire/empire"
+	"github.com/remind101/empire/empire/empiretest"
+	"golang.org/x/net/context"
+)
+
+func TestWebhookDeliveriesRetry(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	var (
+		mu   sync.Mutex
+		hits = make(map[string]int)
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer s.Close()
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC()
+	seed := []struct {
+		path        string
+		attempts    int
+		nextRetryAt time.Time
+	}{
+		{"/ok", 1, now.Add(-time.Minute)},
+		// One attempt left before it's exhausted.
+		{"/fail", empire.DefaultWebhookMaxAttempts - 1, now.Add(-time.Minute)},
+		// Not due yet.
+		{"/later", 1, now.Add(time.Hour)},
+	}
+
+	for _, d := range seed {
+		if _, err := db.Exec(`insert into webhook_delivery_attempts (webhook_id, url, payload, attempted_at, status_code, error, next_retry_at, attempts) values ('slack', $1, '{"text":"Deployed"}', $2, 500, 'failed', $3, $4)`, s.URL+d.path, now, d.nextRetryAt, d.attempts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := e.WebhookDeliveriesRetry(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{"/ok": 1, "/fail": 1, "/later": 0} {
+		if got := hits[path]; got != want {
+			t.Fatalf("%s => %d requests; want %d", path, got, want)
+		}
+	}
+
+	delivered, err := e.WebhookDeliveryAttempts(empire.WebhookDeliveryDelivered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(delivered), 1; got != want {
+		t.Fatalf("Delivered => %d; want %d", got, want)
+	}
+
+	exhausted, err := e.WebhookDeliveryAttempts(empire.WebhookDeliveryExhausted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(exhausted), 1; got != want {
+		t.Fatalf("Exhausted => %d; want %d", got, want)
+	}
+
+	if got, want := exhausted[0].Attempts, empire.DefaultWebhookMaxAttempts; got != want {
+		t.Fatalf("Attempts => %d; want %d", got, want)
+	}
+
+	// Exhausted and delivered deliveries aren't retried again.
+	if err := e.WebhookDeliveriesRetry(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{"/ok": 1, "/fail": 1, "/later": 0} {
+		if got := hits[path]; got != want {
+			t.Fatalf("%s => %d requests; want %d", path, got, want)
+		}
+	}
+}
+
+func TestWebhookDeliveriesRetry_SkipLocked(t *testing.T) {
+	e := empiretest.NewEmpire(t)
+	ctx := context.Background()
+
+	var (
+		mu   sync.Mutex
+		hits = make(map[string]int)
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+	}))
+	defer s.Close()
+
+	db, err := sql.Open("postgres", empiretest.DatabaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC()
+	for _, path := range []string{"/locked", "/unlocked"} {
+		if _, err := db.Exec(`insert into webhook_delivery_attempts (webhook_id, url, payload, attempted_at, status_code, error, next_retry_at, attempts) values ('slack', $1, '{"text":"Deployed"}', $2, 500, 'failed', $3, 1)`, s.URL+path, now, now.Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another retrier is retrying the delivery to /locked.
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`select id from webhook_delivery_attempts where url = $1 for update`, s.URL+"/locked"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.WebhookDeliveriesRetry(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{"/locked": 0, "/unlocked": 1} {
+		if got := hits[path]; got != want {
+			t.Fatalf("%s => %d requests; want %d", path, got, want)
+		}
+	}
+
+	// Once it's unlocked, it's retried.
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.WebhookDeliveriesRetry(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]int{"/locked": 1, "/unlocked": 1} {
+		if got := hits[path]; got != want {
+			t.Fatalf("%s => %d requests; want %d", path, got, want)
+		}
+	}
+}
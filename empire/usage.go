@@ -0,0 +1,195 @@
+package empire
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// ScaleEvent records the desired instance count of a process at a point in
+// time. Scale events are recorded whenever a release is created or a process
+// is scaled, and are used to calculate usage.
+type ScaleEvent struct {
+	ID          string
+	AppID       string
+	ProcessType ProcessType
+	Quantity    int
+	CreatedAt   *time.Time
+}
+
+// Set created_at before inserting.
+func (e *ScaleEvent) BeforeCreate() error {
+	if e.CreatedAt == nil {
+		t := timex.Now()
+		e.CreatedAt = &t
+	}
+	return nil
+}
+
+// ScaleEventsQuery is a Scope implementation for common things to filter scale
+// events by.
+type ScaleEventsQuery struct {
+	// If provided, filters scale events for the given app.
+	App *App
+
+	// If provided, only returns scale events that happened before this
+	// time.
+	Until *time.Time
+}
+
+// Scope implements the Scope interface.
+func (q ScaleEventsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.App != nil {
+		scope = append(scope, ForApp(q.App))
+	}
+
+	if q.Until != nil {
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("created_at < ?", *q.Until)
+		}))
+	}
+
+	scope = append(scope, Order("created_at"))
+
+	return scope.Scope(db)
+}
+
+// ScaleEvents returns all scale events matching the scope.
+func (s *store) ScaleEvents(scope Scope) ([]*ScaleEvent, error) {
+	var events []*ScaleEvent
+	return events, s.Find(scope, &events)
+}
+
+// ScaleEventsCreate persists a scale event.
+func (s *store) ScaleEventsCreate(event *ScaleEvent) (*ScaleEvent, error) {
+	if err := s.writable(); err != nil {
+		return event, err
+	}
+
+	return scaleEventsCreate(s.db, event)
+}
+
+func scaleEventsCreate(db *gorm.DB, event *ScaleEvent) (*ScaleEvent, error) {
+	return event, db.Create(event).Error
+}
+
+// AppUsageReport is the usage of a single process type for an app over a
+// period of time.
+type AppUsageReport struct {
+	AppID       string
+	ProcessType ProcessType
+
+	// The total number of instance hours used.
+	InstanceHours float64
+
+	// The time weighted average number of instances that were running.
+	AverageInstances float64
+}
+
+// usageService calculates usage from scale events.
+type usageService struct {
+	store *store
+}
+
+// UsageReport returns a usage report for each process type of the app.
+func (s *usageService) UsageReport(ctx context.Context, app *App, since, until time.Time) ([]*AppUsageReport, error) {
+	events, err := s.store.ScaleEvents(ScaleEventsQuery{App: app, Until: &until})
+	if err != nil {
+		return nil, err
+	}
+
+	return usageReports(events, since, until), nil
+}
+
+// UsageReportAll returns a usage report for every process type of every app.
+func (s *usageService) UsageReportAll(ctx context.Context, since, until time.Time) ([]*AppUsageReport, error) {
+	events, err := s.store.ScaleEvents(ScaleEventsQuery{Until: &until})
+	if err != nil {
+		return nil, err
+	}
+
+	return usageReports(events, since, until), nil
+}
+
+// usageReports calculates usage between since and until from the scale
+// events. The instance count of a process is assumed to stay constant between
+// scale events, so usage is the area under that step function. The last event
+// before since provides the instance count at the start of the period.
+func usageReports(events []*ScaleEvent, since, until time.Time) []*AppUsageReport {
+	type key struct {
+		appID string
+		t     ProcessType
+	}
+
+	var (
+		keys    []key
+		grouped = make(map[key][]*ScaleEvent)
+	)
+
+	for _, e := range events {
+		k := key{e.AppID, e.ProcessType}
+		if _, ok := grouped[k]; !ok {
+			keys = append(keys, k)
+		}
+		grouped[k] = append(grouped[k], e)
+	}
+
+	period := until.Sub(since)
+
+	var reports []*AppUsageReport
+	for _, k := range keys {
+		es := grouped[k]
+		sort.Stable(scaleEventsByCreatedAt(es))
+
+		var (
+			hours    float64
+			quantity int
+			last     = since
+		)
+
+		for _, e := range es {
+			t := *e.CreatedAt
+			if t.After(until) {
+				break
+			}
+
+			if t.After(last) {
+				hours += float64(quantity) * t.Sub(last).Hours()
+				last = t
+			}
+
+			quantity = e.Quantity
+		}
+
+		if until.After(last) {
+			hours += float64(quantity) * until.Sub(last).Hours()
+		}
+
+		r := &AppUsageReport{
+			AppID:         k.appID,
+			ProcessType:   k.t,
+			InstanceHours: hours,
+		}
+
+		if period > 0 {
+			r.AverageInstances = hours / period.Hours()
+		}
+
+		reports = append(reports, r)
+	}
+
+	return reports
+}
+
+// scaleEventsByCreatedAt implements sort.Interface to sort scale events in
+// chronological order.
+type scaleEventsByCreatedAt []*ScaleEvent
+
+func (s scaleEventsByCreatedAt) Len() int           { return len(s) }
+func (s scaleEventsByCreatedAt) Less(i, j int) bool { return s[i].CreatedAt.Before(*s[j].CreatedAt) }
+func (s scaleEventsByCreatedAt) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
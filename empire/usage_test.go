@@ -0,0 +1,81 @@
+package empire
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScaleEventsQuery(t *testing.T) {
+	app := &App{ID: "1234"}
+	until := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := scopeTests{
+		{ScaleEventsQuery{}, "ORDER BY created_at", []interface{}{}},
+		{ScaleEventsQuery{App: app}, "WHERE (app_id = $1) ORDER BY created_at", []interface{}{app.ID}},
+		{ScaleEventsQuery{Until: &until}, "WHERE (created_at < $1) ORDER BY created_at", []interface{}{until}},
+	}
+
+	tests.Run(t)
+}
+
+func TestUsageReports(t *testing.T) {
+	since := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := since.Add(10 * time.Hour)
+
+	at := func(d time.Duration) *time.Time {
+		t := since.Add(d)
+		return &t
+	}
+
+	events := []*ScaleEvent{
+		// Before the period, web is running 2 instances.
+		{AppID: "1234", ProcessType: "web", Quantity: 2, CreatedAt: at(-5 * time.Hour)},
+		// Scaled up to 4 after 5 hours.
+		{AppID: "1234", ProcessType: "web", Quantity: 4, CreatedAt: at(5 * time.Hour)},
+
+		// Worker is created halfway through and scaled to zero after
+		// another 2 hours.
+		{AppID: "1234", ProcessType: "worker", Quantity: 1, CreatedAt: at(5 * time.Hour)},
+		{AppID: "1234", ProcessType: "worker", Quantity: 0, CreatedAt: at(7 * time.Hour)},
+
+		// Another app.
+		{AppID: "4321", ProcessType: "web", Quantity: 1, CreatedAt: at(0)},
+	}
+
+	reports := usageReports(events, since, until)
+
+	tests := []struct {
+		appID    string
+		t        ProcessType
+		hours    float64
+		averages float64
+	}{
+		{"1234", "web", 30, 3},
+		{"1234", "worker", 2, 0.2},
+		{"4321", "web", 10, 1},
+	}
+
+	if got, want := len(reports), len(tests); got != want {
+		t.Fatalf("len(reports) => %d; want %d", got, want)
+	}
+
+	for i, tt := range tests {
+		r := reports[i]
+
+		if got, want := r.AppID, tt.appID; got != want {
+			t.Fatalf("#%d: AppID => %s; want %s", i, got, want)
+		}
+
+		if got, want := r.ProcessType, tt.t; got != want {
+			t.Fatalf("#%d: ProcessType => %s; want %s", i, got, want)
+		}
+
+		if got, want := r.InstanceHours, tt.hours; got != want {
+			t.Fatalf("#%d: InstanceHours => %v; want %v", i, got, want)
+		}
+
+		if got, want := r.AverageInstances, tt.averages; got != want {
+			t.Fatalf("#%d: AverageInstances => %v; want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package empire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/remind101/pkg/reporter"
+	"github.com/remind101/pkg/timex"
+	"golang.org/x/net/context"
+)
+
+// Statuses of a WebhookDeliveryAttempt.
+const (
+	// WebhookDeliveryPending is the status of deliveries that will be
+	// retried.
+	WebhookDeliveryPending = "pending"
+
+	// WebhookDeliveryDelivered is the status of deliveries that succeeded
+	// when they were retried.
+	WebhookDeliveryDelivered = "delivered"
+
+	// WebhookDeliveryExhausted is the status of deliveries that failed
+	// MaxAttempts times, and won't be retried again.
+	WebhookDeliveryExhausted = "exhausted"
+)
+
+var (
+	// DefaultWebhookMaxAttempts is the number of times that a webhook is
+	// delivered, including the first attempt, before giving up.
+	DefaultWebhookMaxAttempts = 5
+
+	// DefaultWebhookRetryInterval is how often the WebhookRetrier checks for
+	// deliveries to retry.
+	DefaultWebhookRetryInterval = 30 * time.Second
+
+	// DefaultWebhookTimeout is how long a webhook delivery has to complete
+	// before it's abandoned, when a channel isn't configured with its own
+	// http.Client.
+	DefaultWebhookTimeout = 10 * time.Second
+
+	// DefaultWebhookRetryBackoff is how long to wait before retrying a
+	// delivery for the first time. The wait doubles after each attempt.
+	DefaultWebhookRetryBackoff = time.Minute
+)
+
+// WebhookDeliveryAttempt is a webhook delivery that failed, and is queued to be
+// retried.
+type WebhookDeliveryAttempt struct {
+	ID string
+
+	// Identifies the NotificationChannel that sent the webhook, e.g.
+	// "slack".
+	WebhookID string
+
+	// The url that the payload is POSTed to.
+	URL     string
+	Payload json.RawMessage
+
+	// The time, status code and error of the last attempt. StatusCode is
+	// nil if no response was received.
+	AttemptedAt time.Time
+	StatusCode  *int
+	Error       *string
+
+	// When the delivery will next be retried.
+	NextRetryAt time.Time
+
+	// The number of times that delivery has been attempted.
+	Attempts int
+
+	// One of WebhookDeliveryPending, WebhookDeliveryDelivered or
+	// WebhookDeliveryExhausted.
+	Status string
+}
+
+// WebhookDeliveryAttemptsQuery is a Scope implementation for common things to
+// filter webhook deliveries by.
+type WebhookDeliveryAttemptsQuery struct {
+	// If provided, finds deliveries with the given status.
+	Status string
+
+	// If provided, finds pending deliveries that are due to be retried
+	// before this time, with fewer than MaxAttempts attempts.
+	DueBefore *time.Time
+
+	// Used with DueBefore.
+	MaxAttempts int
+}
+
+// Scope implements the Scope interface.
+func (q WebhookDeliveryAttemptsQuery) Scope(db *gorm.DB) *gorm.DB {
+	var scope ComposedScope
+
+	if q.Status != "" {
+		scope = append(scope, FieldEquals("status", q.Status))
+	}
+
+	if q.DueBefore != nil {
+		scope = append(scope, FieldEquals("status", WebhookDeliveryPending))
+		scope = append(scope, ScopeFunc(func(db *gorm.DB) *gorm.DB {
+			return db.Where("next_retry_at < ? and attempts < ?", *q.DueBefore, q.MaxAttempts)
+		}))
+	}
+
+	scope = append(scope, Order("next_retry_at"))
+
+	return scope.Scope(db)
+}
+
+// WebhookDeliveryAttempts returns all webhook deliveries matching the scope.
+func (s *store) WebhookDeliveryAttempts(scope Scope) ([]*WebhookDeliveryAttempt, error) {
+	var deliveries []*WebhookDeliveryAttempt
+	return deliveries, s.Find(scope, &deliveries)
+}
+
+// WebhookDeliveryAttemptsCreate queues a failed delivery to be retried.
+func (s *store) WebhookDeliveryAttemptsCreate(d *WebhookDeliveryAttempt) (*WebhookDeliveryAttempt, error) {
+	if err := s.writable(); err != nil {
+		return d, err
+	}
+
+	return d, s.db.Create(d).Error
+}
+
+// WebhookDeliveryAttemptsRetryNext locks the pending delivery that has been
+// due the longest, calls retry with it, then saves it. Deliveries that are
+// locked by another WebhookRetrier are skipped, so that several Empire
+// instances can retry deliveries concurrently without delivering any of them
+// twice. It returns false if there weren't any deliveries due before
+// dueBefore.
+func (s *store) WebhookDeliveryAttemptsRetryNext(dueBefore time.Time, maxAttempts int, retry func(*WebhookDeliveryAttempt)) (bool, error) {
+	if err := s.writable(); err != nil {
+		return false, err
+	}
+
+	t := s.db.Begin()
+
+	rows, err := t.Raw(`select id from webhook_delivery_attempts where status = ? and next_retry_at < ? and attempts < ? order by next_retry_at limit 1 for update skip locked`, WebhookDeliveryPending, dueBefore, maxAttempts).Rows()
+	if err != nil {
+		t.Rollback()
+		return false, err
+	}
+
+	var id string
+	for rows.Next() {
+		err = rows.Scan(&id)
+	}
+	rows.Close()
+
+	if err != nil {
+		t.Rollback()
+		return false, err
+	}
+
+	if id == "" {
+		t.Rollback()
+		return false, nil
+	}
+
+	var d WebhookDeliveryAttempt
+	if err := t.Where("id = ?", id).First(&d).Error; err != nil {
+		t.Rollback()
+		return false, err
+	}
+
+	retry(&d)
+
+	if err := t.Save(&d).Error; err != nil {
+		t.Rollback()
+		return false, err
+	}
+
+	return true, t.Commit().Error
+}
+
+// deadLetterQueue stores failed webhook deliveries so that they can be
+// retried.
+type deadLetterQueue interface {
+	WebhookDeliveryAttemptsCreate(*WebhookDeliveryAttempt) (*WebhookDeliveryAttempt, error)
+}
+
+// webhookChannel is implemented by NotificationChannels that deliver
+// notifications with webhooks, which are queued to be retried when they fail.
+type webhookChannel interface {
+	setDeadLetters(deadLetterQueue)
+}
+
+// sendWebhook json encodes v and POSTs it to url. If delivery fails, and q is
+// non-nil, the delivery is queued to be retried by the WebhookRetrier. The
+// error from the first attempt is always returned.
+func sendWebhook(client *http.Client, q deadLetterQueue, webhookID, url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	status, err := postWebhook(client, url, b)
+	if err == nil || q == nil {
+		return err
+	}
+
+	now := timex.Now()
+	d := &WebhookDeliveryAttempt{
+		WebhookID:   webhookID,
+		URL:         url,
+		Payload:     b,
+		AttemptedAt: now,
+		NextRetryAt: now.Add(webhookRetryDelay(DefaultWebhookRetryBackoff, 1)),
+		Attempts:    1,
+		Status:      WebhookDeliveryPending,
+	}
+	d.recordFailure(status, err)
+
+	if _, qerr := q.WebhookDeliveryAttemptsCreate(d); qerr != nil {
+		return fmt.Errorf("%v (and queueing a retry failed: %v)", err, qerr)
+	}
+
+	return err
+}
+
+// postWebhook POSTs the json payload to url, returning the status code of the
+// response, or 0 if there wasn't one.
+func postWebhook(client *http.Client, url string, payload []byte) (int, error) {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("notification to %s failed with status %d", url, resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// recordFailure records the status code, if there was a response, and error
+// of a failed attempt.
+func (d *WebhookDeliveryAttempt) recordFailure(status int, err error) {
+	d.StatusCode = nil
+	if status != 0 {
+		d.StatusCode = &status
+	}
+
+	msg := err.Error()
+	d.Error = &msg
+}
+
+// webhookRetryDelay returns how long to wait before retrying a delivery that
+// has been attempted the given number of times. The delay doubles after each
+// attempt.
+func webhookRetryDelay(backoff time.Duration, attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	return backoff << uint(attempts-1)
+}
+
+// WebhookRetrier periodically retries webhook deliveries that failed, with
+// exponential backoff, until they succeed or have been attempted MaxAttempts
+// times.
+type WebhookRetrier struct {
+	// The number of times a delivery is attempted, including the first
+	// attempt, before it's marked as exhausted. Defaults to
+	// DefaultWebhookMaxAttempts.
+	MaxAttempts int
+
+	// How often to check for deliveries to retry. Defaults to
+	// DefaultWebhookRetryInterval.
+	Interval time.Duration
+
+	// How long to wait before the first retry. Defaults to
+	// DefaultWebhookRetryBackoff.
+	Backoff time.Duration
+
+	// The http.Client to use. Defaults to a client with a timeout of
+	// DefaultWebhookTimeout, so that an endpoint that never responds
+	// doesn't block retries.
+	Client *http.Client
+
+	store *store
+}
+
+// Run retries deliveries every Interval until the context is cancelled.
+func (r *WebhookRetrier) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval == 0 {
+		interval = DefaultWebhookRetryInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Retry(ctx); err != nil {
+				reporter.Report(ctx, err)
+			}
+		}
+	}
+}
+
+// Retry retries every delivery that is due, one at a time. Each delivery is
+// locked while it's retried, and deliveries that another WebhookRetrier is
+// retrying are skipped.
+func (r *WebhookRetrier) Retry(ctx context.Context) error {
+	now := timex.Now()
+
+	for {
+		ok, err := r.store.WebhookDeliveryAttemptsRetryNext(now, r.maxAttempts(), func(d *WebhookDeliveryAttempt) {
+			r.retry(d, now)
+		})
+		if err != nil || !ok {
+			return err
+		}
+	}
+}
+
+// retry attempts the delivery again, and updates it with the result.
+func (r *WebhookRetrier) retry(d *WebhookDeliveryAttempt, now time.Time) {
+	status, err := postWebhook(r.Client, d.URL, d.Payload)
+
+	d.Attempts++
+	d.AttemptedAt = now
+
+	if err == nil {
+		d.StatusCode = &status
+		d.Error = nil
+		d.Status = WebhookDeliveryDelivered
+		return
+	}
+
+	d.recordFailure(status, err)
+
+	if d.Attempts >= r.maxAttempts() {
+		d.Status = WebhookDeliveryExhausted
+		return
+	}
+
+	backoff := r.Backoff
+	if backoff == 0 {
+		backoff = DefaultWebhookRetryBackoff
+	}
+	d.NextRetryAt = now.Add(webhookRetryDelay(backoff, d.Attempts))
+}
+
+func (r *WebhookRetrier) maxAttempts() int {
+	if r.MaxAttempts == 0 {
+		return DefaultWebhookMaxAttempts
+	}
+	return r.MaxAttempts
+}
@@ -0,0 +1,207 @@
+package empire
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestSendWebhook(t *testing.T) {
+	status := http.StatusOK
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+
+	q := new(fakeDeadLetterQueue)
+	c := &SlackNotificationChannel{URL: s.URL}
+	c.setDeadLetters(q)
+
+	if err := c.Notify(context.Background(), Notification{Message: "Deployed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(q.deliveries) != 0 {
+		t.Fatalf("Expected successful deliveries not to be queued, got %d", len(q.deliveries))
+	}
+
+	status = http.StatusBadGateway
+
+	if err := c.Notify(context.Background(), Notification{Message: "Deployed"}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if got, want := len(q.deliveries), 1; got != want {
+		t.Fatalf("Queued => %d; want %d", got, want)
+	}
+
+	d := q.deliveries[0]
+
+	if got, want := d.WebhookID, "slack"; got != want {
+		t.Fatalf("WebhookID => %s; want %s", got, want)
+	}
+
+	if got, want := d.URL, s.URL; got != want {
+		t.Fatalf("URL => %s; want %s", got, want)
+	}
+
+	if len(d.Payload) == 0 {
+		t.Fatal("Expected the payload to be queued")
+	}
+
+	if d.StatusCode == nil || *d.StatusCode != http.StatusBadGateway {
+		t.Fatalf("StatusCode => %v; want %d", d.StatusCode, http.StatusBadGateway)
+	}
+
+	if got, want := d.Attempts, 1; got != want {
+		t.Fatalf("Attempts => %d; want %d", got, want)
+	}
+
+	if got, want := d.Status, WebhookDeliveryPending; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if got, want := d.NextRetryAt.Sub(d.AttemptedAt), DefaultWebhookRetryBackoff; got != want {
+		t.Fatalf("NextRetryAt => %v after the attempt; want %v", got, want)
+	}
+}
+
+func TestSendWebhook_ConnectionError(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+
+	q := new(fakeDeadLetterQueue)
+	if err := sendWebhook(nil, q, "slack", s.URL, struct{}{}); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if got, want := len(q.deliveries), 1; got != want {
+		t.Fatalf("Queued => %d; want %d", got, want)
+	}
+
+	if d := q.deliveries[0]; d.StatusCode != nil || d.Error == nil {
+		t.Fatalf("Expected an error without a status code, got %v, %v", d.StatusCode, d.Error)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{5, 16 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := webhookRetryDelay(time.Minute, tt.attempts); got != tt.delay {
+			t.Fatalf("webhookRetryDelay(%d) => %v; want %v", tt.attempts, got, tt.delay)
+		}
+	}
+}
+
+func TestWebhookRetrier_retry(t *testing.T) {
+	status := http.StatusOK
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+
+	r := &WebhookRetrier{MaxAttempts: 3, Backoff: time.Minute}
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d := &WebhookDeliveryAttempt{URL: s.URL, Payload: []byte(`{}`), Attempts: 1, Status: WebhookDeliveryPending}
+
+	// Failures are retried with exponential backoff.
+	status = http.StatusInternalServerError
+	r.retry(d, now)
+
+	if got, want := d.Attempts, 2; got != want {
+		t.Fatalf("Attempts => %d; want %d", got, want)
+	}
+
+	if got, want := d.Status, WebhookDeliveryPending; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if got, want := d.NextRetryAt, now.Add(2*time.Minute); !got.Equal(want) {
+		t.Fatalf("NextRetryAt => %v; want %v", got, want)
+	}
+
+	// Until MaxAttempts.
+	r.retry(d, now)
+
+	if got, want := d.Status, WebhookDeliveryExhausted; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	// Successful deliveries are marked as delivered.
+	d = &WebhookDeliveryAttempt{URL: s.URL, Payload: []byte(`{}`), Attempts: 1, Status: WebhookDeliveryPending}
+	status = http.StatusOK
+	r.retry(d, now)
+
+	if got, want := d.Status, WebhookDeliveryDelivered; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+
+	if d.Error != nil {
+		t.Fatalf("Error => %s; want nil", *d.Error)
+	}
+}
+
+func TestWebhookRetrier_retryTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+
+	timeout := DefaultWebhookTimeout
+	DefaultWebhookTimeout = 10 * time.Millisecond
+	defer func() { DefaultWebhookTimeout = timeout }()
+
+	// Without a Client, deliveries are abandoned after
+	// DefaultWebhookTimeout.
+	r := &WebhookRetrier{MaxAttempts: 3, Backoff: time.Minute}
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d := &WebhookDeliveryAttempt{URL: s.URL, Payload: []byte(`{}`), Attempts: 1, Status: WebhookDeliveryPending}
+	r.retry(d, now)
+
+	if d.StatusCode != nil || d.Error == nil {
+		t.Fatalf("Expected an error without a status code, got %v, %v", d.StatusCode, d.Error)
+	}
+
+	if got, want := d.Status, WebhookDeliveryPending; got != want {
+		t.Fatalf("Status => %s; want %s", got, want)
+	}
+}
+
+func TestWebhookDeliveryAttemptsQuery(t *testing.T) {
+	now := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := scopeTests{
+		{WebhookDeliveryAttemptsQuery{}, "ORDER BY next_retry_at", []interface{}{}},
+		{WebhookDeliveryAttemptsQuery{Status: WebhookDeliveryExhausted}, "WHERE (status = $1) ORDER BY next_retry_at", []interface{}{"exhausted"}},
+		{WebhookDeliveryAttemptsQuery{DueBefore: &now, MaxAttempts: 5}, "WHERE (status = $1) AND (next_retry_at < $2 and attempts < $3) ORDER BY next_retry_at", []interface{}{"pending", now, 5}},
+	}
+
+	tests.Run(t)
+}
+
+// fakeDeadLetterQueue is a deadLetterQueue that records deliveries in memory.
+type fakeDeadLetterQueue struct {
+	deliveries []*WebhookDeliveryAttempt
+}
+
+func (q *fakeDeadLetterQueue) WebhookDeliveryAttemptsCreate(d *WebhookDeliveryAttempt) (*WebhookDeliveryAttempt, error) {
+	q.deliveries = append(q.deliveries, d)
+	return d, nil
+}